@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"beacon/internal/control"
+	"beacon/internal/master"
+
+	"github.com/spf13/cobra"
+)
+
+// eventsRetry is how long `beacon events -f` waits before reconnecting to the master.
+const eventsRetry = 2 * time.Second
+
+var eventsCmd = &cobra.Command{
+	Use:   "events [project]",
+	Short: "Show what the master did: deploys, alerts, restarts, tunnel and VPN changes",
+	Long: `Prints the master's event log, oldest first: deploys, health alerts, agent restarts,
+tunnel and VPN state changes, remote and local commands, config reloads and master
+starts and stops. Events are kept in ~/.beacon/state/events.jsonl (rotated daily, 30 days),
+so they survive restarts; without a running master the file is read directly.
+
+With -f, new events are printed as they happen. The stream resumes where it left off
+when the master restarts.
+
+Examples:
+  beacon events --since 12h             # what happened overnight
+  beacon events myapp --type deploy
+  beacon events -f`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runEvents,
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().BoolP("follow", "f", false, "Keep printing new events as they happen")
+	eventsCmd.Flags().String("since", "", "Only events newer than a duration (12h, 30m) or time (RFC 3339)")
+	eventsCmd.Flags().String("type", "", "Only one type: deploy, alert, restart, start, stop, config, sync, tunnel, vpn, command, upgrade")
+	eventsCmd.Flags().IntP("lines", "n", 50, "Events of history to show when --since is not given (0 = none)")
+	eventsCmd.Flags().Bool("json", false, "Print one JSON object per line")
+	eventsCmd.Flags().Bool("no-color", false, "Disable ANSI color output")
+}
+
+func runEvents(cmd *cobra.Command, args []string) error {
+	follow, _ := cmd.Flags().GetBool("follow")
+	sinceFlag, _ := cmd.Flags().GetString("since")
+	typeFlag, _ := cmd.Flags().GetString("type")
+	lines, _ := cmd.Flags().GetInt("lines")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	if os.Getenv("NO_COLOR") != "" {
+		noColor = true
+	}
+
+	q := master.EventQuery{Type: master.EventType(typeFlag)}
+	params := url.Values{}
+	if len(args) == 1 {
+		q.Project = args[0]
+		params.Set("project", q.Project)
+	}
+	if typeFlag != "" {
+		params.Set("type", typeFlag)
+	}
+	if sinceFlag != "" {
+		since, err := parseSince(sinceFlag, time.Now())
+		if err != nil {
+			return err
+		}
+		q.Since = since
+		params.Set("since", since.Format(time.RFC3339Nano))
+	} else if lines > 0 {
+		q.Limit = lines
+		params.Set("limit", strconv.Itoa(lines))
+	}
+
+	p := &eventPrinter{w: os.Stdout, json: asJSON, color: !noColor}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, err := control.NewClient()
+	if err != nil {
+		return err
+	}
+	if !follow {
+		if sinceFlag == "" && lines == 0 {
+			return nil
+		}
+		var events []master.Event
+		err := client.Events(ctx, params, &events)
+		if errors.Is(err, control.ErrMasterNotRunning) {
+			events, err = readStoredEvents(q)
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			p.print(e)
+		}
+		return nil
+	}
+
+	// The first connection prints the requested history; reconnects resume after the
+	// last event printed.
+	waiting := false
+	for {
+		err := client.FollowEvents(ctx, params, func(id string, data []byte) error {
+			var e master.Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return fmt.Errorf("decode event %s: %w", id, err)
+			}
+			p.print(e)
+			return nil
+		})
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, control.ErrMasterNotRunning):
+			if !waiting && p.lastID == 0 && (sinceFlag != "" || lines > 0) {
+				// Show the history from the file while the master is down
+				events, err := readStoredEvents(q)
+				if err != nil {
+					return err
+				}
+				for _, e := range events {
+					p.print(e)
+				}
+			}
+			if !waiting {
+				fmt.Fprintln(os.Stderr, "Waiting for the master (beacon start)...")
+				waiting = true
+			}
+		case err != nil:
+			return err
+		default:
+			waiting = false
+		}
+		if p.lastID > 0 {
+			params.Del("since")
+			params.Del("limit")
+			params.Set("after", strconv.FormatUint(p.lastID, 10))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(eventsRetry):
+		}
+	}
+}
+
+// readStoredEvents reads the event store directly, for when the master is not running.
+func readStoredEvents(q master.EventQuery) ([]master.Event, error) {
+	path, err := master.EventStorePath()
+	if err != nil {
+		return nil, err
+	}
+	return master.ReadEvents(path, q)
+}
+
+// eventPrinter writes events as aligned lines or JSON lines and remembers the last ID.
+type eventPrinter struct {
+	w      io.Writer
+	json   bool
+	color  bool
+	lastID uint64
+}
+
+func (p *eventPrinter) print(e master.Event) {
+	if e.ID <= p.lastID {
+		return // resent after a reconnect
+	}
+	p.lastID = e.ID
+	if p.json {
+		data, _ := json.Marshal(e)
+		fmt.Fprintln(p.w, string(data))
+		return
+	}
+
+	noColor := !p.color
+	typeColor := colorTeal
+	switch e.Type {
+	case master.EventAlert:
+		typeColor = colorRed
+	case master.EventRestart, master.EventStop:
+		typeColor = colorAmber
+	case master.EventSync:
+		typeColor = colorSubtle
+	}
+	source := ""
+	if e.Child != "" {
+		source = e.Child + ": "
+	}
+	dur := ""
+	if e.DurationMs > 0 {
+		dur = fmt.Sprintf(" %s(%s)%s", c(noColor, colorSubtle), (time.Duration(e.DurationMs) * time.Millisecond).Round(100*time.Millisecond), c(noColor, colorReset))
+	}
+	fmt.Fprintf(p.w, "%s%s%s  %s%-8s%s %s%s\n",
+		c(noColor, colorSubtle), e.Timestamp.Local().Format("2006-01-02 15:04:05"), c(noColor, colorReset),
+		c(noColor, typeColor), e.Type, c(noColor, colorReset),
+		source+e.Message, dur,
+	)
+}
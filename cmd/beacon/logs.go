@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/logging"
+	"beacon/internal/master"
+
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [project]",
+	Short: "Show the master and project agent logs",
+	Long: `Prints the master's log and the logs the master captures from each project agent
+(~/.beacon/config/projects/<project>/logs/agent.log), including rotated and compressed
+files. Without a project, all logs are merged by time and each line is prefixed with its
+source; "master" selects the master's own log.
+
+Examples:
+  beacon logs                       # last lines of every log
+  beacon logs myapp -f              # follow one project
+  beacon logs --since 1h --level warn`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogs,
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep printing new lines as they are written")
+	logsCmd.Flags().String("since", "", "Only lines newer than a duration (1h, 30m) or time (RFC 3339)")
+	logsCmd.Flags().String("level", "", "Minimum level: debug, info, warn, error")
+	logsCmd.Flags().IntP("lines", "n", 100, "Lines of history to show when --since is not given (0 = none)")
+	logsCmd.Flags().Bool("no-color", false, "Disable ANSI color output")
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	follow, _ := cmd.Flags().GetBool("follow")
+	sinceFlag, _ := cmd.Flags().GetString("since")
+	levelFlag, _ := cmd.Flags().GetString("level")
+	lines, _ := cmd.Flags().GetInt("lines")
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	if os.Getenv("NO_COLOR") != "" {
+		noColor = true
+	}
+	if lines < 0 {
+		return fmt.Errorf("invalid --lines %d: must be 0 or more", lines)
+	}
+
+	var filter logging.Filter
+	if sinceFlag != "" {
+		since, err := parseSince(sinceFlag, time.Now())
+		if err != nil {
+			return err
+		}
+		filter.Since = since
+	}
+	if levelFlag != "" {
+		lvl, ok := logging.ParseLevel(levelFlag)
+		if !ok {
+			return fmt.Errorf("invalid --level %q: use debug, info, warn or error", levelFlag)
+		}
+		filter.MinLevel = lvl
+	}
+
+	project := ""
+	if len(args) == 1 {
+		project = args[0]
+	}
+	sources, err := logSources(project)
+	if err != nil {
+		return err
+	}
+	p := &logPrinter{w: os.Stdout, color: !noColor, prefix: len(sources) > 1}
+	for _, src := range sources {
+		p.width = max(p.width, len(src.Name))
+	}
+
+	var history [][]logging.Entry
+	for _, src := range sources {
+		entries, err := logging.ReadEntries(src, filter)
+		if err != nil {
+			return err
+		}
+		history = append(history, entries)
+	}
+	entries := logging.Merge(history...)
+	if filter.Since.IsZero() {
+		entries = entries[len(entries)-min(lines, len(entries)):]
+	}
+	for _, e := range entries {
+		p.print(e)
+	}
+	if !follow {
+		return nil
+	}
+
+	// A source whose file does not exist yet (the master's) is picked up once it is created.
+	fw := logging.NewFollower(sources)
+	defer fw.Close()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	tick := time.NewTicker(500 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-sig:
+			return nil
+		case <-tick.C:
+			for _, e := range fw.Poll(filter) {
+				p.print(e)
+			}
+		}
+	}
+}
+
+// logSources returns the logs to read: the master's and every project's, or one of them.
+func logSources(project string) ([]logging.Source, error) {
+	masterLog, err := master.MasterLogPath()
+	if err != nil {
+		return nil, err
+	}
+	if project == "master" {
+		return []logging.Source{{Name: "master", Path: masterLog}}, nil
+	}
+	if project != "" {
+		path := master.AgentLogPath(project)
+		if !logExists(path) {
+			return nil, fmt.Errorf("no logs for project %q (expected %s)", project, path)
+		}
+		return []logging.Source{{Name: project, Path: path}}, nil
+	}
+
+	sources := []logging.Source{{Name: "master", Path: masterLog}}
+	dirs, _ := filepath.Glob(config.ProjectConfigDir("*"))
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		if path := master.AgentLogPath(name); logExists(path) {
+			sources = append(sources, logging.Source{Name: name, Path: path})
+		}
+	}
+	return sources, nil
+}
+
+// logExists reports whether a log or any of its rotated files exists.
+func logExists(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	return len(logging.RotatedFiles(path)) > 0
+}
+
+// parseSince accepts a duration before now or an RFC 3339 time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use a duration (1h, 30m) or a time (2006-01-02T15:04:05Z07:00)", s)
+}
+
+// logPrinter writes entries, prefixed with their source when several logs are merged.
+type logPrinter struct {
+	w      io.Writer
+	color  bool
+	prefix bool
+	width  int
+}
+
+func (p *logPrinter) print(e logging.Entry) {
+	var name, color string
+	if p.prefix {
+		name = fmt.Sprintf("%-*s | ", p.width, e.Source)
+	}
+	if p.color {
+		if name != "" {
+			name = colorTeal + name + colorReset
+		}
+		switch e.Level {
+		case logging.LevelError:
+			color = colorRed
+		case logging.LevelWarn:
+			color = colorAmber
+		case logging.LevelDebug:
+			color = colorSubtle
+		}
+	}
+	for _, line := range strings.Split(e.Text, "\n") {
+		if color != "" {
+			line = color + line + colorReset
+		}
+		fmt.Fprintln(p.w, name+line)
+	}
+}
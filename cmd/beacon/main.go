@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	"beacon/internal/server"
 	"beacon/internal/state"
 	"beacon/internal/version"
+	"beacon/internal/webhook"
 	"beacon/internal/wizard"
 
 	"beacon/internal/bootstrap"
@@ -183,13 +186,19 @@ in the foreground (useful for systemd, Docker, or debugging).`,
 			// Build args: beacon start --foreground (pass through any other flags)
 			childArgs := []string{"start", "--foreground"}
 
-			logPath := filepath.Join(os.Getenv("HOME"), ".beacon", "master.log")
+			// The master writes its log to master.log itself; master.out catches anything
+			// else it prints, such as a crash.
+			logPath, err := master.MasterLogPath()
+			if err != nil {
+				logger.Fatalf("Cannot find log dir: %v", err)
+			}
 			if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
 				logger.Fatalf("Cannot create log dir: %v", err)
 			}
-			logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			outPath := strings.TrimSuffix(logPath, ".log") + ".out"
+			logFile, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 			if err != nil {
-				logger.Fatalf("Cannot open log file %s: %v", logPath, err)
+				logger.Fatalf("Cannot open log file %s: %v", outPath, err)
 			}
 
 			proc := &os.ProcAttr{
@@ -207,7 +216,7 @@ in the foreground (useful for systemd, Docker, or debugging).`,
 
 			fmt.Println()
 			fmt.Printf("  ✓ Beacon started (pid %d)\n", p.Pid)
-			fmt.Printf("  ✓ Logs: %s\n", logPath)
+			fmt.Printf("  ✓ Logs: %s (beacon logs -f)\n", logPath)
 			fmt.Printf("  ✓ Dashboard: http://127.0.0.1:9100\n")
 			fmt.Println()
 			fmt.Println("  Your device will appear in BeaconInfra after the first")
@@ -255,6 +264,12 @@ func init() {
 	_ = childAgentCmd.MarkFlagRequired("project-id")
 	_ = childAgentCmd.MarkFlagRequired("config")
 	_ = childAgentCmd.MarkFlagRequired("ipc-dir")
+
+	// Upgrade watchdog flags (hidden command - started by the master on self-upgrade)
+	upgradeWatchdogCmd.Flags().Int("pid", 0, "PID of the upgrading master")
+	upgradeWatchdogCmd.Flags().String("exe", "", "Path of the master's binary")
+	_ = upgradeWatchdogCmd.MarkFlagRequired("pid")
+	_ = upgradeWatchdogCmd.MarkFlagRequired("exe")
 }
 
 // childAgentCmd is the hidden "beacon agent" subcommand spawned by the master.
@@ -285,11 +300,32 @@ var childAgentCmd = &cobra.Command{
 	},
 }
 
+// upgradeWatchdogCmd is the hidden "beacon upgrade-watchdog" subcommand the master runs
+// from its previous binary while it upgrades itself, to roll back a new master that
+// hangs or dies.
+var upgradeWatchdogCmd = &cobra.Command{
+	Use:    "upgrade-watchdog",
+	Short:  "Watch a master self-upgrade (internal - started by master)",
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		pid, _ := cmd.Flags().GetInt("pid")
+		exe, _ := cmd.Flags().GetString("exe")
+		if err := master.WatchUpgrade(pid, exe); err != nil {
+			logger.Fatalf("upgrade-watchdog: %v", err)
+		}
+	},
+}
+
 var deployCmd = &cobra.Command{
 	Use:   "deploy",
 	Short: "Run beacon in deployment mode (poll Git for new tags and deploy)",
 	Long: `Run beacon in deployment mode: polls Git repositories for new tags
-and automatically deploys them. Must be run explicitly: beacon deploy`,
+and automatically deploys them. Must be run explicitly: beacon deploy
+
+Set BEACON_WEBHOOK_SECRET to also accept signed push webhooks from GitHub,
+Gitea/Forgejo or GitLab on /webhook (same port as /status), so releases deploy
+without waiting for the next poll. Projects run by beacon master do not serve
+/webhook; trigger those with beacon projects redeploy.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runDeploy()
 	},
@@ -301,7 +337,8 @@ func main() {
 	rootCmd.AddCommand(initAgentCmd)
 	rootCmd.AddCommand(masterCmd)
 	rootCmd.AddCommand(monitorCmd)
-	rootCmd.AddCommand(childAgentCmd) // Hidden - spawned by master only
+	rootCmd.AddCommand(childAgentCmd)      // Hidden - spawned by master only
+	rootCmd.AddCommand(upgradeWatchdogCmd) // Hidden - started by master only
 	rootCmd.AddCommand(deployCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(restartCmd)
@@ -378,6 +415,27 @@ func runDeploy() {
 	statusStorage := filepath.Join(os.Getenv("HOME"), ".beacon", cfg.ProjectDir)
 	status := state.NewStatus(statusStorage)
 
+	// Push webhooks (GitHub, Gitea/Forgejo, GitLab) wake the loop instead of waiting for the
+	// next poll. The channel holds one pending event, so a burst of pushes collapses into one check.
+	webhookC := make(chan webhook.Event, 1)
+	if cfg.WebhookSecret != "" {
+		receiver, err := webhook.NewReceiver(webhook.Config{
+			Secret:       cfg.WebhookSecret,
+			Repositories: append([]string{cfg.RepoURL}, cfg.Webhook.Repositories...),
+			Branch:       webhookBranch(cfg),
+		}, func(ev webhook.Event) {
+			select {
+			case webhookC <- ev:
+			default:
+			}
+		})
+		if err != nil {
+			logger.Fatalf("Webhook receiver: %v", err)
+		}
+		http.Handle(webhook.Path, receiver)
+		logger.Infof("Webhook receiver enabled at %s on port %s", webhook.Path, cfg.Port)
+	}
+
 	// Start HTTP status/metrics endpoint
 	go server.StartHTTPServer(cfg, status)
 
@@ -391,7 +449,20 @@ func runDeploy() {
 			logger.Infof("Shutdown signal received, stopping...")
 			return
 		case <-ticker.C:
-			deploy.CheckForNewTag(cfg, status)
+			deploy.CheckForNewTag(cfg, status, state.TriggerPoll)
+		case ev := <-webhookC:
+			logger.Infof("%s %s webhook received, checking for new release...", ev.Provider, ev.Kind)
+			deploy.CheckForNewTag(cfg, status, state.TriggerWebhook)
+			ticker.Reset(cfg.PollInterval)
 		}
 	}
 }
+
+// webhookBranch returns the branch whose pushes should trigger a deploy: only projects whose
+// deploy policy tracks a branch redeploy on plain pushes.
+func webhookBranch(cfg *config.Config) string {
+	if cfg.Policy.EffectiveTrack() == config.TrackBranch {
+		return cfg.Policy.Branch
+	}
+	return ""
+}
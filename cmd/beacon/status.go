@@ -350,6 +350,69 @@ func renderStatusProjectRow(ch master.ChildStatus, noColor bool) {
 		c(noColor, chkColor), ch.Checks.Passing, ch.Checks.Total, c(noColor, colorReset),
 	)
 
+	if d := ch.Deploy; d != nil {
+		fmt.Printf("    %s└─ deploying: %s (%s)%s\n",
+			c(noColor, colorTeal),
+			d.Stage,
+			formatUptime(int64(d.StageElapsed().Seconds())),
+			c(noColor, colorReset),
+		)
+	}
+
+	if ch.Agent == master.AgentFailed || ch.Agent == master.AgentExited {
+		reason := ch.CrashReason
+		if reason == "" {
+			reason = "no exit recorded"
+		}
+		fmt.Printf("    %s└─ agent %s: %s (beacon projects agent-restart %s)%s\n",
+			c(noColor, colorRed),
+			ch.Agent,
+			reason,
+			ch.Name,
+			c(noColor, colorReset),
+		)
+	}
+
+	if ch.SandboxError != "" {
+		fmt.Printf("    %s└─ ⚠ %s%s\n", c(noColor, colorAmber), ch.SandboxError, c(noColor, colorReset))
+	}
+
+	for _, p := range ch.Pending {
+		release := p.Tag
+		if p.Image != "" {
+			release = p.Image + ":" + p.Tag
+		}
+		reason := p.Reason
+		switch {
+		case p.Approved && reason == "approval":
+			reason = "approved"
+		case reason == "":
+			reason = "ready"
+		}
+		fmt.Printf("    %s└─ held: %s (%s)%s\n",
+			c(noColor, colorAmber),
+			release,
+			reason,
+			c(noColor, colorReset),
+		)
+	}
+
+	for _, svc := range ch.Services {
+		if svc.State == "running" && svc.Health != "unhealthy" {
+			continue
+		}
+		state := svc.State
+		if svc.Health != "" {
+			state += ", " + svc.Health
+		}
+		fmt.Printf("    %s└─ ⚠ service %s  %s%s\n",
+			c(noColor, colorAmber),
+			svc.Name,
+			state,
+			c(noColor, colorReset),
+		)
+	}
+
 	if ch.Checks.Failing == 0 {
 		return
 	}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -10,6 +12,7 @@ import (
 	"text/tabwriter"
 	"time"
 
+	"beacon/internal/control"
 	"beacon/internal/identity"
 
 	"github.com/spf13/cobra"
@@ -67,24 +70,22 @@ Use --host (and optional --protocol) to forward to a LAN or Docker hostname inst
 	enableCmd := &cobra.Command{
 		Use:   "enable <id>",
 		Short: "Enable a tunnel",
-		Args:  cobra.ExactArgs(1),
+		Long: `Enable a tunnel in ~/.beacon/config.yaml. A running master writes the change and
+starts the tunnel right away; otherwise it starts with the master.`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := identity.SetTunnelEnabled(args[0], true); err != nil {
-				logger.Fatalf("beacon tunnel enable: %v", err)
-			}
-			fmt.Printf("Enabled tunnel %q\n", args[0])
+			setTunnelEnabled(args[0], true)
 		},
 	}
 
 	disableCmd := &cobra.Command{
 		Use:   "disable <id>",
 		Short: "Disable a tunnel",
-		Args:  cobra.ExactArgs(1),
+		Long: `Disable a tunnel in ~/.beacon/config.yaml. A running master writes the change and
+stops the tunnel right away.`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := identity.SetTunnelEnabled(args[0], false); err != nil {
-				logger.Fatalf("beacon tunnel disable: %v", err)
-			}
-			fmt.Printf("Disabled tunnel %q\n", args[0])
+			setTunnelEnabled(args[0], false)
 		},
 	}
 
@@ -92,6 +93,31 @@ Use --host (and optional --protocol) to forward to a LAN or Docker hostname inst
 	return root
 }
 
+// setTunnelEnabled has the running master enable or disable the tunnel, or edits
+// config.yaml when no master is running.
+func setTunnelEnabled(id string, enabled bool) {
+	verb := "disable"
+	if enabled {
+		verb = "enable"
+	}
+	client, err := control.NewClient()
+	if err == nil {
+		var res *control.Result
+		res, err = client.SetTunnelEnabled(context.Background(), id, enabled)
+		if err == nil {
+			fmt.Printf("Master: %s\n", res.Message)
+			return
+		}
+	}
+	if !errors.Is(err, control.ErrMasterNotRunning) {
+		logger.Fatalf("beacon tunnel %s: %v", verb, err)
+	}
+	if err := identity.SetTunnelEnabled(id, enabled); err != nil {
+		logger.Fatalf("beacon tunnel %s: %v", verb, err)
+	}
+	fmt.Printf("%sd tunnel %q (applied when the master starts)\n", strings.ToUpper(verb[:1])+verb[1:], id)
+}
+
 func runTunnelAdd(cmd *cobra.Command, args []string) {
 	id := args[0]
 	port, _ := cmd.Flags().GetInt("port")
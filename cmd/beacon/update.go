@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
 	"time"
 
+	"beacon/internal/control"
+	"beacon/internal/master"
 	"beacon/internal/update"
 	"beacon/internal/version"
 
@@ -21,11 +25,28 @@ func createUpdateCommand() *cobra.Command {
 and replace the current binary. Works on Linux and macOS.
 
 By default, downloads and installs the update. Use --check to only check
-if an update is available without installing it.`,
-		Example: `  beacon update          # download and install latest
-  beacon update --check  # just check, don't install`,
+if an update is available without installing it.
+
+The running master (beacon start) keeps the old version until it restarts. With
+--restart-master it is upgraded in place instead (Linux): it hands its projects and
+listeners over to the new binary, so project agents keep running, and tunnels
+reconnect. If the new master is not healthy within a minute, the previous binary is
+restored and takes over again.`,
+		Example: `  beacon update                    # download and install latest
+  beacon update --check            # just check, don't install
+  beacon update --restart-master   # install, then upgrade the running master in place
+  beacon update --apply            # upgrade the master to a binary installed another way`,
 		Run: func(cmd *cobra.Command, args []string) {
 			checkOnly, _ := cmd.Flags().GetBool("check")
+			apply, _ := cmd.Flags().GetBool("apply")
+			restartMaster, _ := cmd.Flags().GetBool("restart-master")
+			if apply {
+				if err := upgradeRunningMaster(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
 			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 			defer cancel()
 
@@ -58,10 +79,70 @@ if an update is available without installing it.`,
 			}
 
 			fmt.Printf("Updated to %s\n", info.Tag)
-			fmt.Println("Restart beacon start to use the new version.")
+			if !restartMaster {
+				fmt.Println("Restart beacon start (or run `beacon update --apply`) to use the new version.")
+				return
+			}
+			if err := upgradeRunningMaster(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
 		},
 	}
 
 	cmd.Flags().Bool("check", false, "Only check for updates, don't install")
+	cmd.Flags().Bool("apply", false, "Upgrade the running master to the binary on disk without downloading")
+	cmd.Flags().Bool("restart-master", false, "Upgrade the running master in place after installing, keeping projects running")
 	return cmd
 }
+
+// upgradeRunningMaster hands the running master over to the binary on disk and waits
+// until the new master is confirmed healthy or rolled back.
+func upgradeRunningMaster() error {
+	client, err := control.NewClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	res, err := client.Upgrade(ctx)
+	if errors.Is(err, control.ErrMasterNotRunning) {
+		fmt.Println("The master is not running; `beacon start` uses the new version.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("upgrade the running master: %w", err)
+	}
+	var started master.UpgradeStatus
+	_ = json.Unmarshal(res.Data, &started)
+	fmt.Printf("Upgrading the running master from %s to %s; projects keep running...\n", started.From, started.To)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("no outcome from the master in time; see `beacon events --type upgrade`")
+		case <-time.After(time.Second):
+		}
+		var st master.UpgradeStatus
+		if err := client.UpgradeStatus(ctx, &st); err != nil {
+			// The master is between binaries or was restarted after a crash
+			cur, ferr := master.ReadUpgradeStatus()
+			if ferr != nil || cur == nil {
+				continue
+			}
+			st = *cur
+		}
+		if !st.StartedAt.Equal(started.StartedAt) {
+			continue
+		}
+		switch st.State {
+		case master.UpgradeCommitted:
+			fmt.Printf("Master upgraded to %s\n", st.To)
+			return nil
+		case master.UpgradeRolledBack:
+			return fmt.Errorf("the new master was not healthy (%s); rolled back to %s", st.Error, st.From)
+		case master.UpgradeFailed:
+			return fmt.Errorf("upgrade failed: %s", st.Error)
+		}
+	}
+}
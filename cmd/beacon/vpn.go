@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -9,6 +11,7 @@ import (
 	"text/tabwriter"
 	"time"
 
+	"beacon/internal/control"
 	"beacon/internal/identity"
 
 	"github.com/spf13/cobra"
@@ -17,7 +20,8 @@ import (
 // createVPNCommand returns the `beacon vpn` command tree.
 //
 // The model is config-driven: each subcommand edits ~/.beacon/config.yaml and
-// the master picks up the change on its next reconcile tick. This mirrors
+// asks a running master to reconcile right away (otherwise the master picks up
+// the change on its next reconcile tick). This mirrors
 // `beacon tunnel` and avoids the agent having two separate state machines for
 // "what should be running" vs "what is running".
 //
@@ -124,6 +128,7 @@ func runVPNEnable(cmd *cobra.Command, args []string) {
 		logger.Fatalf("beacon vpn enable: %v", err)
 	}
 	fmt.Printf("Marked as VPN exit node (listen port %d).\n", listenPort)
+	reconcileVPNNow()
 	fmt.Println()
 	fmt.Println("Next steps:")
 	fmt.Printf("  1. Forward UDP port %d on your router to this device.\n", listenPort)
@@ -152,7 +157,9 @@ func runVPNUse(cmd *cobra.Command, args []string) {
 		logger.Fatalf("beacon vpn use: %v", err)
 	}
 	fmt.Printf("Marked as VPN client of %q.\n", peer)
-	fmt.Println("The master agent will fetch the peer's key + endpoint and bring up the tunnel on its next reconcile tick.")
+	if !reconcileVPNNow() {
+		fmt.Println("The master agent will fetch the peer's key + endpoint and bring up the tunnel on its next reconcile tick.")
+	}
 	fmt.Println("Run `beacon vpn status` to monitor the connection.")
 }
 
@@ -160,7 +167,31 @@ func runVPNDisable(cmd *cobra.Command, args []string) {
 	if err := identity.ClearVPN(); err != nil {
 		logger.Fatalf("beacon vpn disable: %v", err)
 	}
-	fmt.Println("VPN disabled. The master will tear down the tunnel and deregister with BeaconInfra.")
+	fmt.Println("VPN disabled.")
+	if !reconcileVPNNow() {
+		fmt.Println("The master will tear down the tunnel and deregister with BeaconInfra.")
+	}
+}
+
+// reconcileVPNNow asks a running master to apply the VPN config and prints the outcome.
+// It reports false when no master could be reached.
+func reconcileVPNNow() bool {
+	client, err := control.NewClient()
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	res, err := client.ReconcileVPN(ctx)
+	if errors.Is(err, control.ErrMasterNotRunning) {
+		return false
+	}
+	if err != nil {
+		fmt.Printf("Master could not reconcile the VPN: %v\n", err)
+		return true
+	}
+	fmt.Printf("Master: %s\n", res.Message)
+	return true
 }
 
 func runVPNStatus(cmd *cobra.Command, args []string) {
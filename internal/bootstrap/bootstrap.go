@@ -23,18 +23,21 @@ import (
 // DockerImageBootstrapConfig holds bootstrap configuration for a single Docker image
 type DockerImageBootstrapConfig struct {
 	Image              string   `yaml:"image"`
+	Tag                string   `yaml:"tag,omitempty"` // Follow a moving tag (e.g. "latest") by digest
 	Registry           string   `yaml:"registry"`
 	Username           string   `yaml:"username"`
 	Password           string   `yaml:"password"`
 	Token              string   `yaml:"token"`
 	DeployCommand      string   `yaml:"deploy_command"`
 	DockerComposeFiles []string `yaml:"docker_compose_files"` // Array of compose files
+
+	Policy *config.DeployPolicy `yaml:"policy,omitempty"` // Optional per-image deploy policy
 }
 
 // BootstrapConfig holds configuration for bootstrapping a new Beacon project
 type BootstrapConfig struct {
 	ProjectName    string `yaml:"project_name"`
-	DeploymentType string `yaml:"deployment_type"` // "git" or "docker"
+	DeploymentType string `yaml:"deployment_type"` // "git", "docker", "compose" or "artifact"
 
 	// Git repository configuration
 	RepoURL    string `yaml:"repo_url"`
@@ -44,6 +47,37 @@ type BootstrapConfig struct {
 	// Docker registry configuration (array of images)
 	DockerImages []DockerImageBootstrapConfig `yaml:"docker_images"`
 
+	// Deploy policy (track a branch, pin a commit, semver constraint, tag filters).
+	// Written to deploy.yml in the project config directory.
+	DeployPolicy *config.DeployPolicy `yaml:"deploy_policy,omitempty"`
+
+	// Compose stack managed by Beacon (deployment_type "compose"). Written to deploy.yml.
+	Compose *config.ComposeConfig `yaml:"compose,omitempty"`
+
+	// Deploy pipeline stages (pre_deploy, build, migrate, switch, post_deploy, on_failure). Written to deploy.yml.
+	DeployPipeline *config.DeployPipeline `yaml:"deploy_pipeline,omitempty"`
+
+	// Git fetch/checkout options (mirror or clone mode, shallow depth, submodules, LFS). Written to deploy.yml.
+	Git *config.GitFetchConfig `yaml:"git,omitempty"`
+
+	// Signature verification for Git releases and Docker images. Written to deploy.yml.
+	Verify *config.VerifyConfig `yaml:"verify,omitempty"`
+
+	// Release source for deployment_type "artifact" (GitHub/Gitea releases or an HTTP index). Written to deploy.yml.
+	Artifact *config.ArtifactConfig `yaml:"artifact,omitempty"`
+
+	// Deploy windows, manual approval and a readiness command for new releases. Written to deploy.yml.
+	Gate *config.GateConfig `yaml:"gate,omitempty"`
+
+	// Container runtime (docker, podman or auto-detect) for Docker and compose deploys. Written to deploy.yml.
+	Container *config.ContainerConfig `yaml:"container,omitempty"`
+
+	// Restart/stop/start for remote commands (commands, systemd unit or compose). Written to deploy.yml.
+	Lifecycle *config.LifecycleConfig `yaml:"lifecycle,omitempty"`
+
+	// Environment for deploy stages and alert commands (key://<name> reads the key store). Written to deploy.yml.
+	Env map[string]string `yaml:"env,omitempty"`
+
 	// Common configuration
 	LocalPath        string `yaml:"local_path"`
 	DeployCommand    string `yaml:"deploy_command"`
@@ -123,8 +157,8 @@ func (bm *BootstrapManager) BootstrapProject(projectName string, skipSystemd boo
 		return fmt.Errorf("failed to create environment file: %v", err)
 	}
 
-	// Create Docker deployment configs if needed
-	if config.DeploymentType == "docker" {
+	// Create Docker deployment configs if needed (compose projects use them for registry credentials)
+	if config.DeploymentType == "docker" || config.DeploymentType == "compose" {
 		if len(config.DockerImages) > 0 {
 			if err := bm.createDockerImagesConfig(config); err != nil {
 				return fmt.Errorf("failed to create Docker images config: %v", err)
@@ -132,6 +166,10 @@ func (bm *BootstrapManager) BootstrapProject(projectName string, skipSystemd boo
 		}
 	}
 
+	if err := bm.createDeployConfig(config); err != nil {
+		return fmt.Errorf("failed to create deploy config: %v", err)
+	}
+
 	// Create systemd service if requested and available
 	systemdCreated := false
 	if !skipSystemd && bm.serviceManager.IsAvailable() {
@@ -195,8 +233,8 @@ func (bm *BootstrapManager) BootstrapProjectFromConfig(projectName, configFile s
 		return fmt.Errorf("failed to create environment file: %v", err)
 	}
 
-	// Create Docker deployment configs if needed
-	if config.DeploymentType == "docker" {
+	// Create Docker deployment configs if needed (compose projects use them for registry credentials)
+	if config.DeploymentType == "docker" || config.DeploymentType == "compose" {
 		if len(config.DockerImages) > 0 {
 			if err := bm.createDockerImagesConfig(config); err != nil {
 				return fmt.Errorf("failed to create Docker images config: %v", err)
@@ -204,6 +242,10 @@ func (bm *BootstrapManager) BootstrapProjectFromConfig(projectName, configFile s
 		}
 	}
 
+	if err := bm.createDeployConfig(config); err != nil {
+		return fmt.Errorf("failed to create deploy config: %v", err)
+	}
+
 	// Create systemd service if requested and available
 	systemdCreated := false
 	if !skipSystemd && bm.serviceManager.IsAvailable() {
@@ -271,8 +313,8 @@ func (bm *BootstrapManager) collectConfiguration(projectName string) (*Bootstrap
 	}
 
 	// Ask for deployment type first
-	deploymentType := promptForInput("Enter deployment type (git or docker)", "git")
-	if deploymentType != "git" && deploymentType != "docker" {
+	deploymentType := promptForInput("Enter deployment type (git, docker, compose or artifact)", "git")
+	if deploymentType != "git" && deploymentType != "docker" && deploymentType != "compose" && deploymentType != "artifact" {
 		deploymentType = "git" // Default to git if invalid
 	}
 
@@ -319,11 +361,44 @@ func (bm *BootstrapManager) collectConfiguration(projectName string) (*Bootstrap
 		imgCfg.DeployCommand = promptForInput("Enter deploy command for this image (e.g., 'docker compose up -d' or 'docker run ...')", "")
 
 		config.DockerImages = []DockerImageBootstrapConfig{imgCfg}
+	case "compose":
+		config.Compose = promptComposeConfig()
+	case "artifact":
+		config.Artifact = promptArtifactConfig()
 	}
 
 	return config, nil
 }
 
+// promptComposeConfig collects the compose stack definition in interactive mode
+func promptComposeConfig() *config.ComposeConfig {
+	fmt.Println("\n📦 Docker Compose Stack Configuration")
+	compose := &config.ComposeConfig{}
+	if files := promptForInput("Enter compose file(s) (optional, comma or space separated, relative to local_path)", ""); files != "" {
+		compose.Files = strings.Fields(strings.ReplaceAll(files, ",", " "))
+	}
+	if profiles := promptForInput("Enter compose profiles to enable (optional, comma or space separated)", ""); profiles != "" {
+		compose.Profiles = strings.Fields(strings.ReplaceAll(profiles, ",", " "))
+	}
+	return compose
+}
+
+// promptArtifactConfig collects the release source in interactive mode
+func promptArtifactConfig() *config.ArtifactConfig {
+	fmt.Println("\n📦 Release Artifact Configuration")
+	artifact := &config.ArtifactConfig{
+		Source: promptForInput("Enter release source (github, gitea or http)", config.ArtifactSourceGitHub),
+	}
+	if artifact.Source != config.ArtifactSourceHTTP {
+		artifact.Repo = promptForInput("Enter repository (owner/name)", "")
+	}
+	if artifact.Source != config.ArtifactSourceGitHub {
+		artifact.URL = promptForInput("Enter Gitea base URL or HTTP index URL", "")
+	}
+	artifact.Asset = promptForInput("Enter asset name pattern (optional, e.g. myapp_{version}_{os}_{arch}.tar.gz)", "")
+	return artifact
+}
+
 // createEnvironmentFile creates the environment file for the project
 func (bm *BootstrapManager) createEnvironmentFile(config *BootstrapConfig) error {
 	// Default to "git" when DeploymentType is unset so env file contains BEACON_REPO_URL etc.
@@ -380,6 +455,55 @@ func (bm *BootstrapManager) createDockerImagesConfig(config *BootstrapConfig) er
 	return nil
 }
 
+// createDeployConfig writes deploy.yml (deploy policy, compose stack, pipeline, git, verify, env, artifact, gate, container, lifecycle) when the bootstrap config sets one
+func (bm *BootstrapManager) createDeployConfig(cfg *BootstrapConfig) error {
+	if cfg.DeployPolicy == nil && cfg.Compose == nil && cfg.DeployPipeline == nil && cfg.Git == nil && cfg.Verify == nil && len(cfg.Env) == 0 && cfg.Artifact == nil && cfg.Gate == nil && cfg.Container == nil && cfg.Lifecycle == nil {
+		return nil
+	}
+	if err := cfg.Verify.Validate(); err != nil {
+		return err
+	}
+	if cfg.Artifact != nil {
+		if err := cfg.Artifact.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := cfg.Gate.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Container.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Lifecycle.Validate(); err != nil {
+		return err
+	}
+	dc := config.DeployFileConfig{Compose: cfg.Compose, Pipeline: cfg.DeployPipeline, Verify: cfg.Verify, Env: cfg.Env, Artifact: cfg.Artifact, Gate: cfg.Gate, Container: cfg.Container, Lifecycle: cfg.Lifecycle}
+	if cfg.Git != nil {
+		if err := cfg.Git.Validate(); err != nil {
+			return err
+		}
+		dc.Git = *cfg.Git
+	}
+	if cfg.DeployPolicy != nil {
+		if err := cfg.DeployPolicy.Validate(); err != nil {
+			return err
+		}
+		dc.Policy = *cfg.DeployPolicy
+	}
+
+	deployConfigPath := filepath.Join(bm.paths.GetProjectConfigDir(cfg.ProjectName), "deploy.yml")
+	data, err := yaml.Marshal(dc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deploy config: %v", err)
+	}
+	if err := os.WriteFile(deployConfigPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write deploy config: %v", err)
+	}
+
+	fmt.Printf("✅ Created deploy configuration: %s\n", deployConfigPath)
+	return nil
+}
+
 // createSystemdService creates a systemd service for the project
 func (bm *BootstrapManager) createSystemdService(config *BootstrapConfig) error {
 	serviceConfig := systemd.GetDefaultServiceConfig(
@@ -559,7 +683,7 @@ func promptForInput(prompt, defaultValue string) string {
 // Environment file template
 const envTemplate = `# Beacon project environment file for {{.ProjectName}}
 
-# Deployment type: "git" or "docker"
+# Deployment type: "git", "docker", "compose" or "artifact"
 BEACON_DEPLOYMENT_TYPE={{.DeploymentType}}
 
 {{- if eq .DeploymentType "git"}}
@@ -580,6 +704,14 @@ BEACON_GIT_TOKEN={{.GitToken}}
 # Docker registry configuration
 # Docker images are configured in docker-images.yml file in the project config directory
 # See: ~/.beacon/config/projects/{{.ProjectName}}/docker-images.yml
+{{- else if eq .DeploymentType "compose"}}
+# Docker Compose stack managed by Beacon (docker compose pull + up -d)
+# Compose files, profiles and env files are configured in deploy.yml
+# See: ~/.beacon/config/projects/{{.ProjectName}}/deploy.yml
+{{- else if eq .DeploymentType "artifact"}}
+# Release assets (GitHub/Gitea releases or an HTTP index), unpacked into releases/<tag>
+# with current/ pointing at the active release. The source is configured in deploy.yml
+# See: ~/.beacon/config/projects/{{.ProjectName}}/deploy.yml
 {{- end}}
 
 # Local deployment path
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"beacon/internal/config"
 )
@@ -184,6 +185,46 @@ func TestBootstrapManager_CreateEnvironmentFile(t *testing.T) {
 	}
 }
 
+// TestBootstrapManager_CreateDeployConfigCompose tests that a compose stack is written to deploy.yml
+func TestBootstrapManager_CreateDeployConfigCompose(t *testing.T) {
+	bm, err := NewBootstrapManager(false)
+	if err != nil {
+		t.Fatalf("Failed to create bootstrap manager: %v", err)
+	}
+
+	projectName := "compose-test-project"
+	if err := bm.paths.CreateProjectStructure(projectName); err != nil {
+		t.Fatalf("Failed to create project structure: %v", err)
+	}
+	defer func() { _ = bm.paths.RemoveProject(projectName) }()
+
+	cfg := &BootstrapConfig{
+		ProjectName:    projectName,
+		DeploymentType: "compose",
+		Compose: &config.ComposeConfig{
+			Files:    []string{"docker-compose.yml"},
+			Profiles: []string{"media"},
+		},
+		DeployPipeline: &config.DeployPipeline{
+			Migrate: &config.PipelineStage{Command: "./migrate.sh", Timeout: 90 * time.Second},
+		},
+	}
+	if err := bm.createDeployConfig(cfg); err != nil {
+		t.Fatalf("createDeployConfig failed: %v", err)
+	}
+
+	dc, err := config.LoadDeployFileConfig(filepath.Join(bm.paths.GetProjectConfigDir(projectName), "deploy.yml"))
+	if err != nil {
+		t.Fatalf("Failed to load deploy.yml: %v", err)
+	}
+	if dc.Compose == nil || len(dc.Compose.Files) != 1 || dc.Compose.Profiles[0] != "media" {
+		t.Errorf("Unexpected compose config: %+v", dc.Compose)
+	}
+	if st := dc.Pipeline.Stage(config.StageMigrate); st == nil || st.Timeout != 90*time.Second {
+		t.Errorf("Unexpected pipeline: %+v", dc.Pipeline)
+	}
+}
+
 // TestBootstrapManager_CreateSystemdService tests systemd service creation (if available)
 func TestBootstrapManager_CreateSystemdService(t *testing.T) {
 	bm, err := NewBootstrapManager(false)
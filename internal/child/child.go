@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"beacon/internal/config"
+	"beacon/internal/deploy"
 	"beacon/internal/ipc"
 	"beacon/internal/logging"
 	"beacon/internal/monitor"
@@ -28,6 +29,8 @@ import (
 const (
 	healthWriteInterval = 10 * time.Second
 	commandPollInterval = 1 * time.Second
+	// healthLogsTail is how many log lines are attached to a health report while a check fails.
+	healthLogsTail = 20
 )
 
 // Config holds the configuration for the child agent.
@@ -46,8 +49,20 @@ type Child struct {
 	log        *logging.Logger
 
 	results    map[string]*checkResult
+	services   []ipc.ServiceStatus // compose stack state; guarded by resultsMux
 	resultsMux sync.RWMutex
 
+	// logs buffers the lines collected from the project's log sources for fetch_logs
+	logs *monitor.LogManager
+
+	// compose is set for projects with deployment type "compose" or lifecycle adapter "compose"
+	compose *deploy.ComposeStack
+
+	// Remote restart/stop/start settings (lifecycle: and env: in deploy.yml)
+	deploymentType string
+	lifecycle      *config.LifecycleConfig
+	lifecycleEnv   map[string]string
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -96,20 +111,54 @@ func projectNameFromConfigPath(configPath string, fallbackDeviceName string) str
 	return "default"
 }
 
-// readDeployedAt attempts to load last deployment time from ~/.beacon/state/<project>/status.json.
-// If the file is missing/invalid (or last_deployed is zero), it returns nil.
-func (c *Child) readDeployedAt() *time.Time {
+// stateDir returns the project state directory (~/.beacon/state/<project>), or "" when the
+// child has no config path to derive the project from.
+func (c *Child) stateDir() string {
 	if c == nil || c.cfg == nil || c.cfg.ConfigPath == "" {
-		return nil
+		return ""
 	}
-
 	fallbackDeviceName := ""
 	if c.monitorCfg != nil {
 		fallbackDeviceName = c.monitorCfg.Device.Name
 	}
-
 	projectName := projectNameFromConfigPath(c.cfg.ConfigPath, fallbackDeviceName)
-	statusFile := filepath.Join(getConfigDir(), "state", projectName, "status.json")
+	return filepath.Join(getConfigDir(), "state", projectName)
+}
+
+// readDeployProgress returns the running deploy recorded by the deploying process, if any.
+func (c *Child) readDeployProgress() *state.DeployProgress {
+	dir := c.stateDir()
+	if dir == "" {
+		return nil
+	}
+	progress, err := state.ReadDeployProgress(dir)
+	if err != nil {
+		return nil
+	}
+	return progress
+}
+
+// readPendingReleases returns the releases held by the project's deploy gate.
+func (c *Child) readPendingReleases() []state.PendingRelease {
+	dir := c.stateDir()
+	if dir == "" {
+		return nil
+	}
+	pending, err := state.ReadPendingReleases(dir)
+	if err != nil {
+		return nil
+	}
+	return pending
+}
+
+// readDeployedAt attempts to load last deployment time from ~/.beacon/state/<project>/status.json.
+// If the file is missing/invalid (or last_deployed is zero), it returns nil.
+func (c *Child) readDeployedAt() *time.Time {
+	dir := c.stateDir()
+	if dir == "" {
+		return nil
+	}
+	statusFile := filepath.Join(dir, "status.json")
 
 	// Avoid creating directories during periodic health writes.
 	data, err := os.ReadFile(statusFile)
@@ -145,24 +194,45 @@ func New(cfg *Config) (*Child, error) {
 	if err != nil {
 		return nil, fmt.Errorf("load project config: %w", err)
 	}
+	// container: in monitor.yml wins over the project's deploy settings
+	monitorCfg.Container = deploy.ProjectContainerConfig(filepath.Dir(cfg.ConfigPath)).Override(&monitorCfg.Container)
 
 	ipcWriter, err := ipc.NewWriter(cfg.IPCDir)
 	if err != nil {
 		return nil, fmt.Errorf("create IPC writer: %w", err)
 	}
 
+	log := logging.New(cfg.ProjectID)
+
+	// Compose projects report per-service state and accept per-service restart/stop
+	compose, err := deploy.ComposeStackForProject(filepath.Dir(cfg.ConfigPath), cfg.ProjectID)
+	if err != nil {
+		log.Infof("Compose stack unavailable: %v", err)
+	}
+
+	deploymentType, lifecycle, lifecycleEnv, err := loadLifecycle(filepath.Dir(cfg.ConfigPath))
+	if err != nil {
+		log.Infof("Lifecycle config unavailable: %v", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Child{
-		cfg:        cfg,
-		monitorCfg: monitorCfg,
-		ipcWriter:  ipcWriter,
-		startedAt:  time.Now(),
-		log:        logging.New(cfg.ProjectID),
-		results:    make(map[string]*checkResult),
-		ctx:        ctx,
-		cancel:     cancel,
-	}, nil
+	c := &Child{
+		cfg:            cfg,
+		monitorCfg:     monitorCfg,
+		ipcWriter:      ipcWriter,
+		startedAt:      time.Now(),
+		log:            log,
+		results:        make(map[string]*checkResult),
+		compose:        compose,
+		deploymentType: deploymentType,
+		lifecycle:      lifecycle,
+		lifecycleEnv:   lifecycleEnv,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+	c.logs = monitor.NewProjectLogManager(monitorCfg, c.stateDir())
+	return c, nil
 }
 
 // Run starts the child agent and blocks until shutdown.
@@ -180,9 +250,18 @@ func (c *Child) Run() error {
 	for _, check := range c.monitorCfg.Checks {
 		c.executeCheck(check)
 	}
+	c.refreshServices()
 	// Write initial health report with check results
 	c.writeHealthReport()
 
+	// Switch to the master's socket once it accepts; the files are used until then
+	c.ipcWriter.Connect(c.ctx, c.cfg.ProjectID)
+
+	// Collect the project's log sources into memory for fetch_logs and failing checks
+	if len(c.monitorCfg.LogSources) > 0 {
+		c.logs.StartLogCollection(c.ctx)
+	}
+
 	// Start health check loops for each configured check
 	var wg sync.WaitGroup
 	for _, check := range c.monitorCfg.Checks {
@@ -213,6 +292,9 @@ func (c *Child) Run() error {
 
 	c.cancel()
 	wg.Wait()
+	if len(c.monitorCfg.LogSources) > 0 {
+		c.logs.FlushAndStop(context.Background())
+	}
 
 	c.logger().Infof("Stopped")
 	return nil
@@ -256,9 +338,15 @@ func (c *Child) executeCheck(check monitor.CheckConfig) {
 	result.LatencyMs = time.Since(start).Milliseconds()
 
 	c.resultsMux.Lock()
+	prev := c.results[check.Name]
 	c.results[check.Name] = &result
 	c.resultsMux.Unlock()
 
+	// Push a state change right away instead of waiting for the next report
+	if prev != nil && prev.Passed != result.Passed {
+		c.writeHealthReport()
+	}
+
 	status := "passed"
 	if !result.Passed {
 		status = "failed"
@@ -331,15 +419,23 @@ func (c *Child) executeCommandCheck(check monitor.CheckConfig) checkResult {
 	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
 	defer cancel()
 
+	env, err := c.monitorCfg.CommandEnv()
+	if err != nil {
+		result.Passed = false
+		result.Error = err.Error()
+		return result
+	}
+
 	cmd := exec.CommandContext(ctx, "sh", "-c", check.Cmd)
+	cmd.Env = append(os.Environ(), env.Vars...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		result.Passed = false
-		result.Error = fmt.Sprintf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		result.Error = env.Redact(fmt.Sprintf("%v: %s", err, strings.TrimSpace(stderr.String())))
 		return result
 	}
 
@@ -358,6 +454,7 @@ func (c *Child) runHealthWriteLoop() {
 		case <-c.ctx.Done():
 			return
 		case <-ticker.C:
+			c.refreshServices()
 			c.writeHealthReport()
 		}
 	}
@@ -368,10 +465,32 @@ func (c *Child) writeHealthReport() {
 	c.resultsMux.RLock()
 	defer c.resultsMux.RUnlock()
 
+	status, checks := c.healthLocked()
+
+	report := &ipc.HealthReport{
+		ProjectID:     c.cfg.ProjectID,
+		Timestamp:     time.Now(),
+		Status:        status,
+		UptimeSeconds: int64(time.Since(c.startedAt).Seconds()),
+		DeployedAt:    c.readDeployedAt(),
+		LogsTail:      c.failingLogsTail(),
+		Checks:        checks,
+		Services:      c.services,
+		Deploy:        c.readDeployProgress(),
+		Pending:       c.readPendingReleases(),
+	}
+
+	if err := c.ipcWriter.WriteHealth(report); err != nil {
+		c.logger().Infof("Failed to write health report: %v", err)
+	}
+}
+
+// healthLocked returns the project status and check results; c.resultsMux must be held.
+func (c *Child) healthLocked() (string, []ipc.CheckResult) {
 	checks := make([]ipc.CheckResult, 0, len(c.results))
 	allPassing := true
-	allFailing := len(c.results) > 0
-	hasChecks := len(c.results) > 0
+	allFailing := len(c.results)+len(c.services) > 0
+	hasChecks := len(c.results)+len(c.services) > 0
 
 	for _, r := range c.results {
 		checks = append(checks, ipc.CheckResult{
@@ -387,34 +506,29 @@ func (c *Child) writeHealthReport() {
 		}
 	}
 
-	// Determine status
-	var status string
+	// Compose services count like checks: running and not unhealthy = passing
+	for _, svc := range c.services {
+		if svc.State == "running" && svc.Health != "unhealthy" {
+			allFailing = false
+		} else {
+			allPassing = false
+		}
+	}
+
 	switch {
 	case !hasChecks:
-		status = ipc.StatusUnknown
+		return ipc.StatusUnknown, checks
 	case allPassing:
-		status = ipc.StatusHealthy
+		return ipc.StatusHealthy, checks
 	case allFailing:
-		status = ipc.StatusDown
+		return ipc.StatusDown, checks
 	default:
-		status = ipc.StatusDegraded
-	}
-
-	report := &ipc.HealthReport{
-		ProjectID:     c.cfg.ProjectID,
-		Timestamp:     time.Now(),
-		Status:        status,
-		UptimeSeconds: int64(time.Since(c.startedAt).Seconds()),
-		DeployedAt:    c.readDeployedAt(),
-		Checks:        checks,
-	}
-
-	if err := c.ipcWriter.WriteHealth(report); err != nil {
-		c.logger().Infof("Failed to write health report: %v", err)
+		return ipc.StatusDegraded, checks
 	}
 }
 
-// runCommandPollLoop polls for commands from the master via IPC.
+// runCommandPollLoop runs commands queued over the socket as they arrive and polls
+// command.json for commands sent through the file fallback.
 func (c *Child) runCommandPollLoop() {
 	ticker := time.NewTicker(commandPollInterval)
 	defer ticker.Stop()
@@ -423,28 +537,40 @@ func (c *Child) runCommandPollLoop() {
 		select {
 		case <-c.ctx.Done():
 			return
+		case <-c.ipcWriter.CommandReady():
+			c.checkForCommand()
 		case <-ticker.C:
 			c.checkForCommand()
 		}
 	}
 }
 
-// checkForCommand reads and executes any pending command.
+// checkForCommand executes pending commands in order until none is left.
 func (c *Child) checkForCommand() {
-	cmd, err := c.ipcWriter.ReadCommand()
-	if err != nil {
-		c.logger().Infof("Failed to read command: %v", err)
-		return
-	}
-	if cmd == nil {
-		return // No command
-	}
+	for c.ctx.Err() == nil {
+		cmd, err := c.ipcWriter.ReadCommand()
+		if err != nil {
+			c.logger().Infof("Failed to read command: %v", err)
+			return
+		}
+		if cmd == nil {
+			return // No command
+		}
 
-	c.logger().Infof("Received command: %s (id=%s)", cmd.Action, cmd.ID)
-	result := c.executeCommand(cmd)
+		c.logger().Infof("Received command: %s (id=%s)", cmd.Action, cmd.ID)
+		result := c.executeCommand(cmd)
 
-	if err := c.ipcWriter.WriteCommandResult(result); err != nil {
-		c.logger().Infof("Failed to write command result: %v", err)
+		if err := c.ipcWriter.WriteCommandResult(result); err != nil {
+			c.logger().Infof("Failed to write command result: %v", err)
+		}
+	}
+}
+
+// progress streams a progress update for a running command to the master.
+func (c *Child) progress(cmd *ipc.Command, format string, args ...any) {
+	p := &ipc.CommandProgress{CommandID: cmd.ID, Message: fmt.Sprintf(format, args...), Timestamp: time.Now()}
+	if err := c.ipcWriter.WriteProgress(p); err != nil {
+		c.logger().Infof("Failed to send progress for %s: %v", cmd.ID, err)
 	}
 }
 
@@ -462,21 +588,21 @@ func (c *Child) executeCommand(cmd *ipc.Command) *ipc.CommandResult {
 		result.Message = "Health checks executed"
 
 	case ipc.ActionFetchLogs:
-		lines := 100
-		if l, ok := cmd.Payload["lines"].(float64); ok {
-			lines = int(l)
+		lines, err := c.fetchLogs(cmd.Payload)
+		if err != nil {
+			result.Status = ipc.ResultFailed
+			result.Message = fmt.Sprintf("Fetch logs failed: %v", err)
+			break
 		}
 		result.Status = ipc.ResultSuccess
-		result.Message = fmt.Sprintf("Fetched %d log lines", lines)
-		result.Data = c.fetchLogs(lines)
+		result.Message = fmt.Sprintf("Fetched %d log lines", len(lines))
+		result.Data = lines
 
-	case ipc.ActionRestart:
-		result.Status = ipc.ResultFailed
-		result.Message = "Restart not implemented - no restart command configured"
+	case ipc.ActionRestart, ipc.ActionStop, ipc.ActionStart:
+		c.runLifecycleAction(cmd, result)
 
-	case ipc.ActionStop:
-		result.Status = ipc.ResultFailed
-		result.Message = "Stop not implemented - no stop command configured"
+	case ipc.ActionApproveDeploy:
+		c.approveDeploy(result)
 
 	default:
 		result.Status = ipc.ResultFailed
@@ -487,17 +613,134 @@ func (c *Child) executeCommand(cmd *ipc.Command) *ipc.CommandResult {
 	return result
 }
 
+// approveDeploy approves the releases held by the deploy gate; the project's deploy poll
+// loop deploys them once its deploy window is open.
+func (c *Child) approveDeploy(result *ipc.CommandResult) {
+	dir := c.stateDir()
+	if dir == "" {
+		result.Status = ipc.ResultFailed
+		result.Message = "Approve failed - project state directory unknown"
+		return
+	}
+	approved, err := state.ApprovePendingReleases(dir, state.TriggerCloud)
+	if err != nil {
+		result.Status = ipc.ResultFailed
+		result.Message = fmt.Sprintf("Approve failed: %v", err)
+		return
+	}
+	result.Status = ipc.ResultSuccess
+	if len(approved) == 0 {
+		result.Message = "No releases are held"
+		return
+	}
+	result.Message = fmt.Sprintf("Approved %d held release(s)", len(approved))
+	result.Data = approved
+}
+
 // runAllChecksNow triggers all health checks immediately.
 func (c *Child) runAllChecksNow() {
+	if c.monitorCfg == nil {
+		c.writeHealthReport()
+		return
+	}
 	for _, check := range c.monitorCfg.Checks {
 		c.executeCheck(check)
 	}
 	c.writeHealthReport()
 }
 
-// fetchLogs returns the last N lines from configured log sources.
-func (c *Child) fetchLogs(lines int) []string {
-	// For now, return empty - log tailing can be added later
-	// This would read from c.monitorCfg.LogSources
-	return []string{}
+// fetchLogs returns buffered log lines selected by the command payload: "lines" (default
+// 100), "since" (duration or RFC 3339 time), "grep" (regular expression) and "source".
+func (c *Child) fetchLogs(payload map[string]any) ([]string, error) {
+	var q monitor.LogQuery
+	if l, ok := payload["lines"].(float64); ok {
+		q.Lines = int(l)
+	}
+	if since, _ := payload["since"].(string); since != "" {
+		t, err := monitor.ParseLogSince(since, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		q.Since = t
+	}
+	q.Grep, _ = payload["grep"].(string)
+	if source, _ := payload["source"].(string); source != "" {
+		q.Sources = []string{source}
+	}
+	if c.logs == nil {
+		return []string{}, nil
+	}
+	entries, err := c.logs.Tail(q)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, monitor.FormatLogLine(e))
+	}
+	return lines, nil
+}
+
+// failingLogsTail returns the last log lines of the sources tied to failing checks (all
+// sources for checks that name none); nil while every check passes. c.resultsMux must be held.
+func (c *Child) failingLogsTail() []string {
+	if c.logs == nil || c.monitorCfg == nil {
+		return nil
+	}
+	var sources []string
+	failing, allSources := false, false
+	for _, check := range c.monitorCfg.Checks {
+		if r, ok := c.results[check.Name]; !ok || r.Passed {
+			continue
+		}
+		failing = true
+		if len(check.LogSources) == 0 {
+			allSources = true
+		}
+		sources = append(sources, check.LogSources...)
+	}
+	if !failing {
+		return nil
+	}
+	if allSources {
+		sources = nil
+	}
+	entries, _ := c.logs.Tail(monitor.LogQuery{Lines: healthLogsTail, Sources: sources})
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, monitor.FormatLogLine(e))
+	}
+	return lines
+}
+
+// refreshServices updates the cached compose service states (no-op for non-compose projects).
+func (c *Child) refreshServices() {
+	if c.compose == nil {
+		return
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	list, err := c.compose.Services(ctx)
+	if err != nil {
+		c.logger().Infof("Failed to read compose services: %v", err)
+		return
+	}
+	services := make([]ipc.ServiceStatus, 0, len(list))
+	for _, svc := range list {
+		services = append(services, ipc.ServiceStatus{
+			Name:      svc.Service,
+			Container: svc.Name,
+			Image:     svc.Image,
+			State:     svc.State,
+			Health:    svc.Health,
+			ExitCode:  svc.ExitCode,
+			Status:    svc.Status,
+		})
+	}
+
+	c.resultsMux.Lock()
+	c.services = services
+	c.resultsMux.Unlock()
 }
@@ -1,6 +1,8 @@
 package child
 
 import (
+	"beacon/internal/config"
+	"beacon/internal/deploy"
 	"beacon/internal/ipc"
 	"beacon/internal/monitor"
 	"context"
@@ -8,6 +10,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -383,6 +386,59 @@ func TestExecuteCommand_fetchLogs(t *testing.T) {
 	}
 }
 
+func TestExecuteCommand_fetchLogsFilters(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	ipcDir := t.TempDir()
+	ipcWriter, _ := ipc.NewWriter(ipcDir)
+	cfg := &monitor.Config{LogSources: []monitor.LogSource{
+		{Name: "app", Type: "command", Enabled: true, Interval: time.Hour,
+			Command: "echo '2026-10-18T10:00:00Z ready'; echo '2026-10-18T10:01:00Z ERROR db refused'"},
+	}}
+	c := &Child{
+		cfg:        &Config{ProjectID: "test"},
+		monitorCfg: cfg,
+		ipcWriter:  ipcWriter,
+		startedAt:  time.Now(),
+		results:    make(map[string]*checkResult),
+		logs:       monitor.NewProjectLogManager(cfg, t.TempDir()),
+		ctx:        context.Background(),
+	}
+	c.logs.FlushAndStop(context.Background()) // one-shot collection of every source
+
+	result := c.executeCommand(&ipc.Command{
+		ID:      "cmd_logs",
+		Action:  ipc.ActionFetchLogs,
+		Payload: map[string]any{"grep": "ERROR", "since": "2026-10-18T09:00:00Z", "source": "app"},
+	})
+	lines, _ := result.Data.([]string)
+	if result.Status != ipc.ResultSuccess || len(lines) != 1 || lines[0] != "2026-10-18T10:01:00Z [app] ERROR db refused" {
+		t.Fatalf("result = %s: %s, data %q", result.Status, result.Message, result.Data)
+	}
+
+	result = c.executeCommand(&ipc.Command{ID: "cmd_bad", Action: ipc.ActionFetchLogs, Payload: map[string]any{"since": "last week"}})
+	if result.Status != ipc.ResultFailed {
+		t.Errorf("invalid since accepted: %s", result.Message)
+	}
+
+	// A failing check attaches the tail of its log sources to the health report
+	c.monitorCfg.Checks = []monitor.CheckConfig{{Name: "db", Type: "command", Cmd: "false", LogSources: []string{"app"}}}
+	c.results["db"] = &checkResult{Name: "db", Passed: false}
+	c.writeHealthReport()
+	report, err := ipc.NewReader(ipcDir).ReadHealth()
+	if err != nil || report == nil {
+		t.Fatalf("read health: %v", err)
+	}
+	if len(report.LogsTail) != 2 || !strings.HasSuffix(report.LogsTail[1], "ERROR db refused") {
+		t.Errorf("logs tail = %q", report.LogsTail)
+	}
+
+	c.results["db"].Passed = true
+	c.writeHealthReport()
+	if report, _ := ipc.NewReader(ipcDir).ReadHealth(); len(report.LogsTail) != 0 {
+		t.Errorf("logs tail while healthy = %q", report.LogsTail)
+	}
+}
+
 func TestExecuteCommand_unknown(t *testing.T) {
 	dir := t.TempDir()
 	ipcWriter, _ := ipc.NewWriter(dir)
@@ -405,3 +461,77 @@ func TestExecuteCommand_unknown(t *testing.T) {
 		t.Errorf("expected failed, got %s", result.Status)
 	}
 }
+
+// fakeDocker puts a `docker` script on PATH that logs its arguments and prints ps output.
+func fakeDocker(t *testing.T, psOutput string) string {
+	t.Helper()
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "calls.log")
+	script := "#!/bin/sh\necho \"$@\" >> " + logFile + "\n" +
+		"case \"$*\" in *' ps '*) cat <<'JSON'\n" + psOutput + "\nJSON\n;; esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatalf("write fake docker: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logFile
+}
+
+func TestExecuteCommand_composeRestartService(t *testing.T) {
+	logFile := fakeDocker(t, `{"Name":"media-web-1","Service":"web","State":"running","Health":"healthy"}
+{"Name":"media-db-1","Service":"db","State":"exited","ExitCode":137}`)
+
+	projectDir := t.TempDir()
+	env := "BEACON_DEPLOYMENT_TYPE=compose\nBEACON_LOCAL_PATH=" + projectDir + "\n"
+	if err := os.WriteFile(filepath.Join(projectDir, "env"), []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stack, err := deploy.ComposeStackForProject(projectDir, "media")
+	if err != nil || stack == nil {
+		t.Fatalf("ComposeStackForProject: %v, %v", stack, err)
+	}
+
+	ipcDir := filepath.Join(t.TempDir(), "ipc")
+	ipcWriter, _ := ipc.NewWriter(ipcDir)
+	c := &Child{
+		cfg:       &Config{ProjectID: "media"},
+		ipcWriter: ipcWriter,
+		startedAt: time.Now(),
+		results:   make(map[string]*checkResult),
+		compose:   stack,
+		lifecycle: &config.LifecycleConfig{HealthTimeout: time.Millisecond},
+		ctx:       context.Background(),
+	}
+
+	result := c.executeCommand(&ipc.Command{
+		ID:      "cmd_4",
+		Action:  ipc.ActionRestart,
+		Payload: map[string]any{ipc.PayloadService: "db"},
+	})
+	if result.Status != ipc.ResultSuccess {
+		t.Fatalf("expected success, got %s: %s", result.Status, result.Message)
+	}
+
+	calls, _ := os.ReadFile(logFile)
+	if !strings.Contains(string(calls), "--project-name media --project-directory "+projectDir+" restart db") {
+		t.Errorf("docker calls = %q, want a restart of service db", calls)
+	}
+
+	data, ok := result.Data.(*ipc.LifecycleResult)
+	if !ok || len(data.Services) != 2 {
+		t.Fatalf("result data = %#v, want 2 service states", result.Data)
+	}
+	if data.Adapter != config.LifecycleCompose || data.Target != "service db" || data.Health != ipc.StatusDegraded {
+		t.Errorf("result data = %+v", data)
+	}
+
+	report, err := ipc.NewReader(ipcDir).ReadHealth()
+	if err != nil || report == nil {
+		t.Fatalf("read health: %v", err)
+	}
+	if report.Status != ipc.StatusDegraded {
+		t.Errorf("status = %s, want %s (one of two services exited)", report.Status, ipc.StatusDegraded)
+	}
+	if len(report.Services) != 2 || report.Services[1].ExitCode != 137 {
+		t.Errorf("services = %+v", report.Services)
+	}
+}
@@ -0,0 +1,245 @@
+package child
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/deploy"
+	"beacon/internal/ipc"
+	"beacon/internal/keys"
+	"beacon/internal/state"
+	"beacon/internal/util"
+)
+
+const (
+	// lifecycleOutputMax bounds the command output kept in a LifecycleResult.
+	lifecycleOutputMax = 16 << 10
+	// healthRecheckInterval is the pause between health re-checks after a restart or start.
+	healthRecheckInterval = time.Second
+	// lifecycleKillDelay is how long a timed-out command's output pipes may stay open after the kill.
+	lifecycleKillDelay = 5 * time.Second
+)
+
+// loadLifecycle reads the project's deployment type, lifecycle settings and deploy env
+// from its config dir (env file + deploy.yml). Missing files mean no lifecycle config.
+func loadLifecycle(projectConfigDir string) (string, *config.LifecycleConfig, map[string]string, error) {
+	env, err := util.ParseEnvFile(filepath.Join(projectConfigDir, "env"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", nil, nil, err
+	}
+	dc, err := config.LoadDeployFileConfig(filepath.Join(projectConfigDir, "deploy.yml"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return env["BEACON_DEPLOYMENT_TYPE"], nil, nil, nil
+		}
+		return env["BEACON_DEPLOYMENT_TYPE"], nil, nil, err
+	}
+	return env["BEACON_DEPLOYMENT_TYPE"], dc.Lifecycle, dc.Env, nil
+}
+
+// lifecycleAdapter returns the adapter for restart/stop/start, or "" when none is configured.
+func (c *Child) lifecycleAdapter() string {
+	if adapter := c.lifecycle.EffectiveAdapter(c.deploymentType); adapter != "" {
+		return adapter
+	}
+	if c.compose != nil {
+		return config.LifecycleCompose
+	}
+	return ""
+}
+
+// runLifecycleAction restarts, stops or starts the project with its lifecycle adapter,
+// re-checks health and reports an ipc.LifecycleResult as result.Data.
+func (c *Child) runLifecycleAction(cmd *ipc.Command, result *ipc.CommandResult) {
+	verb := cmd.Action
+	adapter := c.lifecycleAdapter()
+	if adapter == "" {
+		result.Status = ipc.ResultFailed
+		result.Message = fmt.Sprintf("Cannot %s: no lifecycle configured (set restart_command, stop_command, start_command or systemd_unit under lifecycle: in deploy.yml)", verb)
+		return
+	}
+	service, _ := cmd.Payload[ipc.PayloadService].(string)
+	service = strings.TrimSpace(service)
+	if service != "" && adapter != config.LifecycleCompose {
+		result.Status = ipc.ResultFailed
+		result.Message = fmt.Sprintf("Cannot %s service %s: the %s lifecycle adapter acts on the whole project", verb, service, adapter)
+		return
+	}
+
+	res := &ipc.LifecycleResult{Action: verb, Adapter: adapter}
+	out := state.NewTailBuffer(lifecycleOutputMax)
+	c.progress(cmd, "Running %s via %s", verb, adapter)
+	ctx, cancel := context.WithTimeout(c.ctx, c.lifecycle.EffectiveTimeout())
+	start := time.Now()
+	var err error
+	switch adapter {
+	case config.LifecycleCommand:
+		err = c.runLifecycleCommand(ctx, verb, res, out)
+	case config.LifecycleSystemd:
+		err = c.runSystemctl(ctx, verb, res, out)
+	case config.LifecycleCompose:
+		err = c.runComposeLifecycle(ctx, verb, service, res, out)
+	}
+	res.DurationMs = time.Since(start).Milliseconds()
+	res.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	cancel()
+	res.Output = out.String()
+	res.ExitCode = exitCode(err)
+
+	// Wait for the project to come up after restart/start; a stop is checked once
+	if err == nil {
+		c.progress(cmd, "%s finished in %dms, checking health", strings.ToUpper(verb[:1])+verb[1:], res.DurationMs)
+	}
+	c.recheckHealth(err == nil && verb != ipc.ActionStop, res)
+	result.Data = res
+
+	if err != nil {
+		if res.TimedOut {
+			err = fmt.Errorf("timed out after %s", c.lifecycle.EffectiveTimeout())
+		}
+		result.Status = ipc.ResultFailed
+		result.Message = fmt.Sprintf("Failed to %s %s: %v", verb, res.Target, err)
+		if last := lastOutputLine(res.Output); last != "" {
+			result.Message += ": " + last
+		}
+		return
+	}
+	result.Status = ipc.ResultSuccess
+	result.Message = fmt.Sprintf("%s of %s completed via %s (health: %s)", strings.ToUpper(verb[:1])+verb[1:], res.Target, adapter, res.Health)
+}
+
+// runLifecycleCommand runs the configured shell command for verb. A restart without
+// restart_command runs stop_command, then start_command.
+func (c *Child) runLifecycleCommand(ctx context.Context, verb string, res *ipc.LifecycleResult, out *state.TailBuffer) error {
+	lc := c.lifecycle
+	res.Target = "project " + c.cfg.ProjectID
+	var commands []string
+	switch {
+	case verb == ipc.ActionRestart && lc.RestartCommand != "":
+		commands = []string{lc.RestartCommand}
+	case verb == ipc.ActionRestart && lc.StopCommand != "" && lc.StartCommand != "":
+		commands = []string{lc.StopCommand, lc.StartCommand}
+	case verb == ipc.ActionStop && lc.StopCommand != "":
+		commands = []string{lc.StopCommand}
+	case verb == ipc.ActionStart && lc.StartCommand != "":
+		commands = []string{lc.StartCommand}
+	default:
+		return fmt.Errorf("no %s_command configured", verb)
+	}
+	res.Command = strings.Join(commands, " && ")
+
+	env, err := keys.ResolveEnv(c.lifecycleEnv)
+	if err != nil {
+		return err
+	}
+	redacted := env.Writer(out)
+	defer redacted.Close()
+	for _, line := range commands {
+		cmd := exec.CommandContext(ctx, "sh", "-c", line)
+		cmd.Env = append(os.Environ(), env.Vars...)
+		cmd.Env = append(cmd.Env, "BEACON_PROJECT_NAME="+c.cfg.ProjectID, "BEACON_ACTION="+verb)
+		cmd.Stdout, cmd.Stderr = redacted, redacted
+		cmd.WaitDelay = lifecycleKillDelay
+		deploy.SetProcessGroup(cmd)
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSystemctl restarts, stops or starts the configured systemd unit.
+func (c *Child) runSystemctl(ctx context.Context, verb string, res *ipc.LifecycleResult, out *state.TailBuffer) error {
+	args := []string{verb, c.lifecycle.SystemdUnit}
+	if c.lifecycle.SystemdUser {
+		args = append([]string{"--user"}, args...)
+	}
+	res.Target = c.lifecycle.SystemdUnit
+	res.Command = "systemctl " + strings.Join(args, " ")
+	cmd := exec.CommandContext(ctx, "systemctl", args...)
+	cmd.Stdout, cmd.Stderr = out, out
+	return cmd.Run()
+}
+
+// runComposeLifecycle restarts, stops or starts the compose service named in the command,
+// the lifecycle services, or the whole stack.
+func (c *Child) runComposeLifecycle(ctx context.Context, verb, service string, res *ipc.LifecycleResult, out *state.TailBuffer) error {
+	if c.compose == nil {
+		res.Target = "compose stack"
+		return errors.New("compose stack unavailable")
+	}
+	var services []string
+	if service != "" {
+		services = []string{service}
+	} else if c.lifecycle != nil {
+		services = c.lifecycle.Services
+	}
+	switch len(services) {
+	case 0:
+		res.Target = "stack " + c.compose.ProjectName()
+	case 1:
+		res.Target = "service " + services[0]
+	default:
+		res.Target = "services " + strings.Join(services, ", ")
+	}
+
+	action := map[string]func(context.Context, ...string) (string, error){
+		ipc.ActionRestart: c.compose.Restart,
+		ipc.ActionStop:    c.compose.Stop,
+		ipc.ActionStart:   c.compose.Start,
+	}[verb]
+	res.Command = "compose " + strings.Join(append([]string{verb}, services...), " ")
+	output, err := action(ctx, services...)
+	out.Write([]byte(output))
+	return err
+}
+
+// recheckHealth re-runs the health checks and records the resulting state in res. With
+// wait set it keeps re-checking until the project is healthy or the health timeout ends.
+func (c *Child) recheckHealth(wait bool, res *ipc.LifecycleResult) {
+	deadline := time.Now().Add(c.lifecycle.EffectiveHealthTimeout())
+	for {
+		c.refreshServices()
+		c.runAllChecksNow()
+
+		c.resultsMux.RLock()
+		res.Health, res.Checks = c.healthLocked()
+		res.Services = c.services
+		c.resultsMux.RUnlock()
+
+		if !wait || res.Health == ipc.StatusHealthy || res.Health == ipc.StatusUnknown || time.Now().After(deadline) {
+			return
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(healthRecheckInterval):
+		}
+	}
+}
+
+// exitCode returns the exit status of a finished command: 0 on success, -1 when it did not
+// run to completion (not found, killed on timeout).
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// lastOutputLine returns the last non-empty line of command output.
+func lastOutputLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,158 @@
+package child
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/ipc"
+	"beacon/internal/monitor"
+)
+
+func newLifecycleChild(t *testing.T, lc *config.LifecycleConfig, checks ...monitor.CheckConfig) *Child {
+	t.Helper()
+	ipcWriter, err := ipc.NewWriter(filepath.Join(t.TempDir(), "ipc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Child{
+		cfg:        &Config{ProjectID: "app"},
+		monitorCfg: &monitor.Config{Checks: checks},
+		ipcWriter:  ipcWriter,
+		startedAt:  time.Now(),
+		results:    make(map[string]*checkResult),
+		lifecycle:  lc,
+		ctx:        context.Background(),
+	}
+}
+
+func TestLifecycle_notConfigured(t *testing.T) {
+	c := newLifecycleChild(t, nil)
+	result := c.executeCommand(&ipc.Command{ID: "cmd_1", Action: ipc.ActionRestart})
+	if result.Status != ipc.ResultFailed || !strings.Contains(result.Message, "no lifecycle configured") {
+		t.Errorf("result = %s: %s", result.Status, result.Message)
+	}
+}
+
+func TestLifecycle_commandRestartWaitsForHealth(t *testing.T) {
+	dir := t.TempDir()
+	up := filepath.Join(dir, "up")
+	log := filepath.Join(dir, "calls")
+
+	// No restart_command: restart runs stop, then start; the check passes once "up" exists
+	c := newLifecycleChild(t, &config.LifecycleConfig{
+		StopCommand:   "echo stop $BEACON_PROJECT_NAME $BEACON_ACTION >> " + log + "; rm -f " + up,
+		StartCommand:  "echo start >> " + log + "; (sleep 1; touch " + up + ") &",
+		HealthTimeout: 10 * time.Second,
+	}, monitor.CheckConfig{Name: "up", Type: "command", Cmd: "test -f " + up})
+
+	result := c.executeCommand(&ipc.Command{ID: "cmd_2", Action: ipc.ActionRestart})
+	if result.Status != ipc.ResultSuccess {
+		t.Fatalf("result = %s: %s", result.Status, result.Message)
+	}
+	data := result.Data.(*ipc.LifecycleResult)
+	if data.Adapter != config.LifecycleCommand || data.ExitCode != 0 || data.Health != ipc.StatusHealthy {
+		t.Errorf("result data = %+v", data)
+	}
+	if len(data.Checks) != 1 || !data.Checks[0].Passed {
+		t.Errorf("checks = %+v", data.Checks)
+	}
+	if calls, _ := os.ReadFile(log); string(calls) != "stop app restart\nstart\n" {
+		t.Errorf("calls = %q", calls)
+	}
+	if !strings.Contains(result.Message, "(health: healthy)") {
+		t.Errorf("message = %q", result.Message)
+	}
+
+	// stop has its own command; start is reported as not configured when missing
+	c.lifecycle = &config.LifecycleConfig{StopCommand: "rm -f " + up}
+	result = c.executeCommand(&ipc.Command{ID: "cmd_3", Action: ipc.ActionStop})
+	if data := result.Data.(*ipc.LifecycleResult); result.Status != ipc.ResultSuccess || data.Health != ipc.StatusDown {
+		t.Errorf("stop = %s: %s, health %s", result.Status, result.Message, data.Health)
+	}
+	result = c.executeCommand(&ipc.Command{ID: "cmd_4", Action: ipc.ActionStart})
+	if result.Status != ipc.ResultFailed || !strings.Contains(result.Message, "no start_command configured") {
+		t.Errorf("start = %s: %s", result.Status, result.Message)
+	}
+}
+
+func TestLifecycle_commandFailureAndTimeout(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	c := newLifecycleChild(t, &config.LifecycleConfig{
+		RestartCommand: "echo restarting; echo unit not found >&2; exit 3",
+	})
+	result := c.executeCommand(&ipc.Command{ID: "cmd_5", Action: ipc.ActionRestart})
+	data := result.Data.(*ipc.LifecycleResult)
+	if result.Status != ipc.ResultFailed || data.ExitCode != 3 || data.Output != "restarting\nunit not found\n" {
+		t.Errorf("result = %s: %s, data %+v", result.Status, result.Message, data)
+	}
+	if !strings.HasSuffix(result.Message, ": unit not found") {
+		t.Errorf("message = %q", result.Message)
+	}
+
+	c.lifecycle = &config.LifecycleConfig{RestartCommand: "sleep 5", Timeout: 100 * time.Millisecond}
+	result = c.executeCommand(&ipc.Command{ID: "cmd_6", Action: ipc.ActionRestart})
+	data = result.Data.(*ipc.LifecycleResult)
+	if result.Status != ipc.ResultFailed || !data.TimedOut || data.ExitCode != -1 || !strings.Contains(result.Message, "timed out after 100ms") {
+		t.Errorf("timeout = %s: %s, data %+v", result.Status, result.Message, data)
+	}
+}
+
+func TestLifecycle_systemd(t *testing.T) {
+	bin := t.TempDir()
+	log := filepath.Join(bin, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	c := newLifecycleChild(t, &config.LifecycleConfig{SystemdUnit: "app.service", SystemdUser: true})
+	result := c.executeCommand(&ipc.Command{ID: "cmd_7", Action: ipc.ActionRestart})
+	if result.Status != ipc.ResultSuccess {
+		t.Fatalf("result = %s: %s", result.Status, result.Message)
+	}
+	if data := result.Data.(*ipc.LifecycleResult); data.Command != "systemctl --user restart app.service" || data.Target != "app.service" {
+		t.Errorf("result data = %+v", data)
+	}
+	if calls, _ := os.ReadFile(log); string(calls) != "--user restart app.service\n" {
+		t.Errorf("calls = %q", calls)
+	}
+
+	// Single compose services cannot be targeted through a unit
+	result = c.executeCommand(&ipc.Command{ID: "cmd_8", Action: ipc.ActionStop, Payload: map[string]any{ipc.PayloadService: "db"}})
+	if result.Status != ipc.ResultFailed {
+		t.Errorf("service payload accepted: %s", result.Message)
+	}
+}
+
+func TestLoadLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	if typ, lc, _, err := loadLifecycle(dir); err != nil || typ != "" || lc != nil {
+		t.Fatalf("empty dir: %q, %+v, %v", typ, lc, err)
+	}
+	os.WriteFile(filepath.Join(dir, "env"), []byte("BEACON_DEPLOYMENT_TYPE=docker\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "deploy.yml"), []byte(`
+lifecycle:
+  systemd_unit: app.service
+  timeout: 45s
+env:
+  APP_ENV: production
+`), 0644)
+	typ, lc, env, err := loadLifecycle(dir)
+	if err != nil || typ != "docker" || lc == nil {
+		t.Fatalf("loadLifecycle: %q, %+v, %v", typ, lc, err)
+	}
+	if lc.EffectiveAdapter(typ) != config.LifecycleSystemd || lc.EffectiveTimeout() != 45*time.Second || env["APP_ENV"] != "production" {
+		t.Errorf("lifecycle = %+v, env = %v", lc, env)
+	}
+
+	os.WriteFile(filepath.Join(dir, "deploy.yml"), []byte("lifecycle:\n  adapter: systemd\n"), 0644)
+	if _, _, _, err := loadLifecycle(dir); err == nil {
+		t.Error("adapter systemd without a unit accepted")
+	}
+}
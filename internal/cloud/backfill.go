@@ -0,0 +1,242 @@
+package cloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"beacon/internal/state"
+)
+
+const (
+	// BackfillBatchSize is the most spooled entries sent in one request.
+	BackfillBatchSize = 200
+	// backfillBatchesPerRun bounds the batches one Backfiller run sends, so a long outage
+	// is backfilled over a few reports.
+	backfillBatchesPerRun = 5
+	// backfillUnsupportedWait is how long a Backfiller pauses when the cloud has no
+	// endpoint for it.
+	backfillUnsupportedWait = time.Hour
+)
+
+// ErrBackfillUnsupported is returned when the cloud has no backfill endpoint.
+var ErrBackfillUnsupported = errors.New("the cloud does not accept backfilled reports")
+
+// BackfillClient replays reports spooled while the cloud was unreachable to
+// POST /agent/backfill, oldest first, as gzipped JSON batches.
+type BackfillClient struct {
+	baseURL    string
+	apiKey     string
+	deviceName string
+	hostname   string
+	http       *http.Client
+}
+
+// NewBackfillClient builds a backfill client for the API base (with /api) and the
+// device's API key or token.
+func NewBackfillClient(baseURL, apiKey, deviceName, hostname string) *BackfillClient {
+	return &BackfillClient{
+		baseURL:    strings.TrimRight(strings.TrimSpace(baseURL), "/"),
+		apiKey:     strings.TrimSpace(apiKey),
+		deviceName: strings.TrimSpace(deviceName),
+		hostname:   hostname,
+		http:       &http.Client{Timeout: 45 * time.Second},
+	}
+}
+
+// backfillPayload is the body of POST /agent/backfill. Each entry carries the payload it
+// would have had when it was recorded (a heartbeat, a metrics sample, a check transition
+// or a command result), flagged as backfilled.
+type backfillPayload struct {
+	DeviceName string          `json:"device_name"`
+	Hostname   string          `json:"hostname"`
+	Backfilled bool            `json:"backfilled"`
+	Dropped    int             `json:"dropped,omitempty"` // entries lost to the spool's limits before these
+	Entries    []backfillEntry `json:"entries"`
+}
+
+type backfillEntry struct {
+	Seq        uint64          `json:"seq"`
+	Kind       string          `json:"kind"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Backfilled bool            `json:"backfilled"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// backfillError is a batch the cloud answered with an HTTP error.
+type backfillError struct {
+	code int
+	body string
+}
+
+func (e *backfillError) Error() string {
+	return fmt.Sprintf("backfill: HTTP %d: %s", e.code, e.body)
+}
+
+// rejected reports whether the cloud refused the batch itself, so sending it again
+// cannot succeed.
+func (e *backfillError) rejected() bool {
+	return e.code == http.StatusBadRequest || e.code == http.StatusRequestEntityTooLarge || e.code == http.StatusUnprocessableEntity
+}
+
+// Drain sends the spool's pending entries until it is empty or maxBatches were sent, and
+// returns how many entries the cloud took. A batch that is too large is split; one the
+// cloud rejects is dropped so it does not hold back the rest, and reported in the error.
+func (c *BackfillClient) Drain(ctx context.Context, spool *state.Spool, maxBatches int) (int, error) {
+	sent, limit := 0, BackfillBatchSize
+	var rejectErr error
+	for batches := 0; batches < maxBatches; {
+		b, err := spool.Next(limit)
+		if err != nil || b == nil {
+			return sent, errors.Join(rejectErr, err)
+		}
+		err = c.Send(ctx, b)
+		var be *backfillError
+		switch {
+		case err == nil:
+			sent += len(b.Entries)
+		case errors.As(err, &be) && be.code == http.StatusRequestEntityTooLarge && limit > 1:
+			limit /= 2
+			continue
+		case errors.As(err, &be) && be.rejected():
+			rejectErr = fmt.Errorf("dropped %d entries the cloud rejected: %w", len(b.Entries), err)
+		default:
+			return sent, errors.Join(rejectErr, err)
+		}
+		if err := spool.Ack(b); err != nil {
+			return sent, errors.Join(rejectErr, err)
+		}
+		batches++
+	}
+	return sent, rejectErr
+}
+
+// Send posts one batch.
+func (c *BackfillClient) Send(ctx context.Context, b *state.SpoolBatch) error {
+	if c.baseURL == "" {
+		return fmt.Errorf("backfill: base url not set")
+	}
+	payload := backfillPayload{
+		DeviceName: c.deviceName,
+		Hostname:   c.hostname,
+		Backfilled: true,
+		Dropped:    b.Dropped,
+		Entries:    make([]backfillEntry, len(b.Entries)),
+	}
+	for i, e := range b.Entries {
+		payload.Entries[i] = backfillEntry{Seq: e.Seq, Kind: e.Kind, RecordedAt: e.RecordedAt, Backfilled: true, Data: e.Data}
+	}
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if err := json.NewEncoder(zw).Encode(payload); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/agent/backfill", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, _ := io.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrBackfillUnsupported
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return &backfillError{code: resp.StatusCode, body: strings.TrimSpace(string(respBody))}
+	}
+	return nil
+}
+
+// Backfiller drains a spool in the background after a report got through, so a slow
+// backfill never holds up the loop that sends reports. One run is in flight at a time.
+type Backfiller struct {
+	// Logf logs progress and errors.
+	Logf func(format string, args ...any)
+	// Done, when set, is called after each run with the entries sent since the spool was
+	// last empty and how many are left.
+	Done func(sent, left int)
+
+	mu          sync.Mutex
+	running     bool
+	pausedUntil time.Time
+	sent        int
+	wg          sync.WaitGroup
+}
+
+// Start drains up to a few batches of spool with client unless a run is in flight,
+// backfill is paused or nothing is pending.
+func (b *Backfiller) Start(ctx context.Context, client *BackfillClient, spool *state.Spool) {
+	if spool == nil || spool.Pending() == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running || time.Now().Before(b.pausedUntil) {
+		return
+	}
+	b.running = true
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.run(ctx, client, spool)
+	}()
+}
+
+// Wait blocks until the run in flight, if any, has finished.
+func (b *Backfiller) Wait() {
+	b.wg.Wait()
+}
+
+func (b *Backfiller) run(ctx context.Context, client *BackfillClient, spool *state.Spool) {
+	sent, err := client.Drain(ctx, spool, backfillBatchesPerRun)
+	left := spool.Pending()
+	if sent > 0 {
+		b.logf("Backfilled %d report(s); %d left", sent, left)
+	}
+	b.mu.Lock()
+	switch {
+	case errors.Is(err, ErrBackfillUnsupported):
+		b.logf("Backfill: %v; %d report(s) stay spooled, retrying in %s", err, left, backfillUnsupportedWait)
+		b.pausedUntil = time.Now().Add(backfillUnsupportedWait)
+	case err != nil:
+		b.logf("Backfill: %v", err)
+	}
+	b.sent += sent
+	total := b.sent
+	if left == 0 {
+		b.sent = 0
+	}
+	b.mu.Unlock()
+	if b.Done != nil {
+		b.Done(total, left)
+	}
+	b.mu.Lock()
+	b.running = false
+	b.mu.Unlock()
+}
+
+func (b *Backfiller) logf(format string, args ...any) {
+	if b.Logf != nil {
+		b.Logf(format, args...)
+	}
+}
@@ -0,0 +1,153 @@
+package cloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"beacon/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSpool(t *testing.T, n int) *state.Spool {
+	t.Helper()
+	s, err := state.OpenSpool(t.TempDir(), state.SpoolOptions{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	for i := range n {
+		require.NoError(t, s.Append(state.SpoolHeartbeat, time.Now(), map[string]int{"n": i}))
+	}
+	return s
+}
+
+func decodeBackfill(t *testing.T, body []byte) backfillPayload {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	var p backfillPayload
+	require.NoError(t, json.Unmarshal(raw, &p))
+	return p
+}
+
+func TestBackfillClient_Drain(t *testing.T) {
+	srv, rec := newTestServer(t, http.StatusOK, `{}`)
+	s := newTestSpool(t, 3)
+
+	c := NewBackfillClient(srv.URL, "usr_test_key", "n100-pi", "host")
+	sent, err := c.Drain(context.Background(), s, 5)
+	require.NoError(t, err)
+	require.Equal(t, 3, sent)
+	require.Zero(t, s.Pending())
+
+	require.Equal(t, http.MethodPost, rec.method)
+	require.Equal(t, "/agent/backfill", rec.path)
+	require.Equal(t, "gzip", rec.headers.Get("Content-Encoding"))
+	require.Equal(t, "Bearer usr_test_key", rec.headers.Get("Authorization"))
+	p := decodeBackfill(t, rec.body)
+	require.Equal(t, "n100-pi", p.DeviceName)
+	require.True(t, p.Backfilled)
+	require.Len(t, p.Entries, 3)
+	for i, e := range p.Entries {
+		require.Equal(t, uint64(i+1), e.Seq)
+		require.Equal(t, state.SpoolHeartbeat, e.Kind)
+		require.True(t, e.Backfilled)
+	}
+	require.JSONEq(t, `{"n":0}`, string(p.Entries[0].Data))
+}
+
+func TestBackfillClient_Drain_unsupported(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusNotFound, `not found`)
+	s := newTestSpool(t, 2)
+
+	sent, err := NewBackfillClient(srv.URL, "k", "d", "h").Drain(context.Background(), s, 5)
+	require.ErrorIs(t, err, ErrBackfillUnsupported)
+	require.Zero(t, sent)
+	require.Equal(t, 2, s.Pending(), "kept for when the cloud supports it")
+}
+
+func TestBackfillClient_Drain_serverError(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusServiceUnavailable, `busy`)
+	s := newTestSpool(t, 2)
+
+	_, err := NewBackfillClient(srv.URL, "k", "d", "h").Drain(context.Background(), s, 5)
+	require.Error(t, err)
+	require.Equal(t, 2, s.Pending())
+}
+
+func TestBackfillClient_Drain_rejected(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusBadRequest, `bad entry`)
+	s := newTestSpool(t, 2)
+
+	sent, err := NewBackfillClient(srv.URL, "k", "d", "h").Drain(context.Background(), s, 5)
+	require.ErrorContains(t, err, "dropped 2 entries")
+	require.Zero(t, sent)
+	require.Zero(t, s.Pending(), "a rejected batch does not hold back the rest")
+}
+
+func TestBackfillClient_Drain_splitsLargeBatch(t *testing.T) {
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n := len(decodeBackfill(t, body).Entries)
+		sizes = append(sizes, n)
+		if n > 60 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	s := newTestSpool(t, 120)
+
+	sent, err := NewBackfillClient(srv.URL, "k", "d", "h").Drain(context.Background(), s, 5)
+	require.NoError(t, err)
+	require.Equal(t, 120, sent)
+	require.Equal(t, []int{120, 100, 50, 50, 20}, sizes)
+}
+
+func TestBackfiller_runsInBackground(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	s := newTestSpool(t, 3)
+
+	var done [][2]int
+	b := &Backfiller{Done: func(sent, left int) { done = append(done, [2]int{sent, left}) }}
+	client := NewBackfillClient(srv.URL, "k", "d", "h")
+	b.Start(context.Background(), client, s) // returns while the cloud is still answering
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+	b.Start(context.Background(), client, s) // one run at a time
+	close(release)
+	b.Wait()
+
+	require.Equal(t, int32(1), requests.Load())
+	require.Equal(t, [][2]int{{3, 0}}, done)
+	require.Zero(t, s.Pending())
+}
+
+func TestBackfiller_pausesWhenUnsupported(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusNotFound, `not found`)
+	s := newTestSpool(t, 2)
+	client := NewBackfillClient(srv.URL, "k", "d", "h")
+
+	runs := 0
+	b := &Backfiller{Done: func(sent, left int) { runs++ }}
+	b.Start(context.Background(), client, s)
+	b.Wait()
+	b.Start(context.Background(), client, s)
+	b.Wait()
+	require.Equal(t, 1, runs, "paused after the cloud had no backfill endpoint")
+	require.Equal(t, 2, s.Pending())
+}
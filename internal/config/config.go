@@ -16,18 +16,20 @@ import (
 
 // DockerImageConfig holds configuration for a single Docker image to monitor
 type DockerImageConfig struct {
-	Image    string // Full image name (e.g., "username/app" or "ghcr.io/username/app")
-	Registry string // Registry URL (e.g., "docker.io", "ghcr.io") - optional, auto-detected
-	Username string // Registry username (optional)
-	Password string // Registry password (optional)
+	Image    string `yaml:"image"`              // Full image name (e.g., "username/app" or "ghcr.io/username/app")
+	Tag      string `yaml:"tag,omitempty"`      // Follow a fixed tag (e.g. "latest", "stable") by digest instead of looking for new tags
+	Registry string `yaml:"registry,omitempty"` // Registry URL (e.g., "docker.io", "ghcr.io") - optional, auto-detected
+	Username string `yaml:"username,omitempty"` // Registry username (optional)
+	Password string `yaml:"password,omitempty"` // Registry password (optional)
 	// Token is an alternative auth mechanism (e.g., GHCR token)
-	Token              string   // Registry token (optional, alternative to username/password)
-	DeployCommand      string   // Command to run when new tag is found
-	DockerComposeFiles []string // Optional list of compose files used for this image's deploy command
+	Token              string        `yaml:"token,omitempty"`                // Registry token (optional, alternative to username/password)
+	DeployCommand      string        `yaml:"deploy_command,omitempty"`       // Command to run when new tag is found
+	DockerComposeFiles []string      `yaml:"docker_compose_files,omitempty"` // Optional list of compose files used for this image's deploy command
+	Policy             *DeployPolicy `yaml:"policy,omitempty"`               // Optional per-image deploy policy (overrides the project policy)
 }
 
 type Config struct {
-	// Deployment type: "git" or "docker"
+	// Deployment type: "git", "docker", "compose" or "artifact"
 	DeploymentType string
 
 	// Git repository configuration
@@ -46,8 +48,45 @@ type Config struct {
 	DeployCommand string // Legacy: kept for backward compatibility
 	SecureEnvPath string // Path to secure environment file for deploy command
 	ProjectDir    string
+	ProjectName   string // BEACON_PROJECT_NAME, falls back to ProjectDir
+
+	// Policy selects which release to deploy (from deploy.yml in the project config dir)
+	Policy DeployPolicy
+
+	// Compose is the stack Beacon manages for deployment type "compose" (from deploy.yml)
+	Compose *ComposeConfig
+
+	// WebhookSecret enables the push webhook receiver of `beacon deploy` (BEACON_WEBHOOK_SECRET);
+	// projects run by the master ignore it
+	WebhookSecret string
+	// Webhook lists extra repositories accepted by the receiver (from deploy.yml)
+	Webhook WebhookConfig
+
+	// Pipeline declares the deploy stages (from deploy.yml); nil runs DeployCommand only
+	Pipeline *DeployPipeline
+
+	// Git controls fetch/checkout for Git projects (from deploy.yml)
+	Git GitFetchConfig
+
+	// Verify refuses unsigned releases (from deploy.yml); nil disables verification
+	Verify *VerifyConfig
+
+	// Artifact is the release source for deployment type "artifact" (from deploy.yml)
+	Artifact *ArtifactConfig
+
+	// Gate holds new releases outside deploy windows or until approved (from deploy.yml)
+	Gate *GateConfig
+
+	// Container selects Docker, rootless Docker or Podman (BEACON_CONTAINER_*, overridden by deploy.yml)
+	Container ContainerConfig
+
+	// Env is passed to deploy commands and alert commands (from deploy.yml). Values of the
+	// form key://<name> are decrypted from the key store when a command runs.
+	Env map[string]string
 }
 
+// Load reads the deploy config from the process environment (after loading the secure env
+// file into it), prompting for missing values on a terminal, and creates the local path.
 func Load() *Config {
 	// First, check if BEACON_SECURE_ENV_PATH is set in environment (from systemd or bootstrap env file)
 	// If it is, load the secure env file before reading other config values
@@ -58,44 +97,75 @@ func Load() *Config {
 			fmt.Fprintf(os.Stderr, "[Beacon] Warning: Failed to load secure environment file %s: %v\n", secureEnvPath, err)
 		}
 	}
+	cfg := load(envSource{getenv: os.Getenv, prompt: isInteractive()})
+	ensureDir(cfg.LocalPath)
+	return cfg
+}
 
+// LoadFromEnv reads the deploy config like Load, but from env (a parsed project env file)
+// over the process environment, which is left unchanged. It does not prompt or create the
+// local path.
+func LoadFromEnv(env map[string]string) *Config {
+	vars := make(map[string]string, len(env))
+	for k, v := range env {
+		vars[k] = v
+	}
+	getenv := func(key string) string {
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+	if secureEnvPath := getenv("BEACON_SECURE_ENV_PATH"); secureEnvPath != "" {
+		secureEnvPath = os.Expand(secureEnvPath, getenv)
+		secure, err := util.ParseEnvFile(secureEnvPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[Beacon] Warning: Failed to load secure environment file %s: %v\n", secureEnvPath, err)
+		}
+		for k, v := range secure {
+			vars[k] = v
+		}
+	}
+	return load(envSource{getenv: getenv})
+}
+
+// envSource is where load reads the config variables from.
+type envSource struct {
+	getenv func(string) string
+	prompt bool // ask on the terminal for missing values (and set them in the process environment)
+}
+
+func load(env envSource) *Config {
 	// Determine deployment type (default to "git" for backward compatibility)
-	deploymentType := getEnvOrPrompt("BEACON_DEPLOYMENT_TYPE", "Enter deployment type (git or docker)", "git")
-	if deploymentType != "git" && deploymentType != "docker" {
+	deploymentType := env.getOrPrompt("BEACON_DEPLOYMENT_TYPE", "Enter deployment type (git, docker, compose or artifact)", "git")
+	if deploymentType != "git" && deploymentType != "docker" && deploymentType != "compose" && deploymentType != "artifact" {
 		deploymentType = "git" // Default to git if invalid
 	}
 
 	cfg := &Config{
 		DeploymentType: deploymentType,
-		PollInterval:   getDurationEnv("BEACON_POLL_INTERVAL", 60*time.Second),
-		Port:           getEnvOrPrompt("BEACON_PORT", "Enter the port to run on", "8080"),
-		DeployCommand:  getEnvOrPrompt("BEACON_DEPLOY_CMD", "Enter the deploy command to run after update (optional)", ""),
-		SecureEnvPath:  getEnvOrPrompt("BEACON_SECURE_ENV_PATH", "Enter secure environment file path (optional)", "$HOME/beacon/project/.env"),
+		PollInterval:   env.getDuration("BEACON_POLL_INTERVAL", 60*time.Second),
+		Port:           env.getOrPrompt("BEACON_PORT", "Enter the port to run on", "8080"),
+		DeployCommand:  env.getOrPrompt("BEACON_DEPLOY_CMD", "Enter the deploy command to run after update (optional)", ""),
+		SecureEnvPath:  env.getOrPrompt("BEACON_SECURE_ENV_PATH", "Enter secure environment file path (optional)", "$HOME/beacon/project/.env"),
+		WebhookSecret:  env.getenv("BEACON_WEBHOOK_SECRET"),
+		Container:      ContainerFromEnv(env.getenv),
 	}
 
 	switch deploymentType {
 	case "git":
-		cfg.RepoURL = getEnvOrPrompt("BEACON_REPO_URL", "Enter the Git repo URL", "https://github.com/yourusername/yourrepo.git")
-		cfg.LocalPath = os.ExpandEnv(getEnvOrPrompt("BEACON_LOCAL_PATH", "Enter the local path for the project", "$HOME/beacon/project"))
-		cfg.SSHKeyPath = getEnvOrPrompt("BEACON_SSH_KEY_PATH", "Enter the SSH key path (optional)", "")
-		cfg.GitToken = getEnvOrPrompt("BEACON_GIT_TOKEN", "Enter the Git token (optional)", "")
-		ensureDir(cfg.LocalPath)
-	case "docker":
-		// Docker images / stacks are configured via bootstrap or config file
-		cfg.LocalPath = os.ExpandEnv(getEnvOrPrompt("BEACON_LOCAL_PATH", "Enter the local path for the project", "$HOME/beacon/project"))
-		ensureDir(cfg.LocalPath)
-
-		projectName := os.Getenv("BEACON_PROJECT_NAME")
-		if projectName == "" {
-			projectName = filepath.Base(cfg.LocalPath)
-		}
+		cfg.RepoURL = env.getOrPrompt("BEACON_REPO_URL", "Enter the Git repo URL", "https://github.com/yourusername/yourrepo.git")
+		cfg.LocalPath = env.expand(env.getOrPrompt("BEACON_LOCAL_PATH", "Enter the local path for the project", "$HOME/beacon/project"))
+		cfg.SSHKeyPath = env.getOrPrompt("BEACON_SSH_KEY_PATH", "Enter the SSH key path (optional)", "")
+		cfg.GitToken = env.getOrPrompt("BEACON_GIT_TOKEN", "Enter the Git token (optional)", "")
+	case "docker", "compose", "artifact":
+		// Docker images / stacks / release sources are configured via bootstrap or config file
+		cfg.LocalPath = env.expand(env.getOrPrompt("BEACON_LOCAL_PATH", "Enter the local path for the project", "$HOME/beacon/project"))
+
+		projectName := projectNameFromEnv(env.getenv, cfg.LocalPath)
 
 		// Load Docker images from docker-images.yml if it exists
-		base, err := BeaconHomeDir()
-		if err != nil {
-			base = filepath.Join(os.Getenv("HOME"), ".beacon")
-		}
-		dockerImagesPath := filepath.Join(base, "config", "projects", projectName, "docker-images.yml")
+		dockerImagesPath := filepath.Join(ProjectConfigDir(projectName), "docker-images.yml")
 		if images, err := loadDockerImagesConfig(dockerImagesPath); err == nil {
 			cfg.DockerImages = images
 		} else if !os.IsNotExist(err) {
@@ -103,10 +173,49 @@ func Load() *Config {
 		}
 	}
 	cfg.ProjectDir = filepath.Base(cfg.LocalPath)
+	cfg.ProjectName = projectNameFromEnv(env.getenv, cfg.LocalPath)
+
+	// Load optional deploy.yml (deploy policy, compose stack, webhook, pipeline, git fetch, verify, env, artifact, gate, container)
+	deployConfigPath := filepath.Join(ProjectConfigDir(cfg.ProjectName), "deploy.yml")
+	if dc, err := LoadDeployFileConfig(deployConfigPath); err == nil {
+		cfg.Policy = dc.Policy
+		cfg.Compose = dc.Compose
+		cfg.Webhook = dc.Webhook
+		cfg.Pipeline = dc.Pipeline
+		cfg.Git = dc.Git
+		cfg.Verify = dc.Verify
+		cfg.Env = dc.Env
+		cfg.Artifact = dc.Artifact
+		cfg.Gate = dc.Gate
+		cfg.Container = cfg.Container.Override(dc.Container)
+	} else if !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "[Beacon] Warning: Failed to load deploy config: %v\n", err)
+	}
+	if deploymentType == "compose" && cfg.Compose == nil {
+		// No compose section: let docker compose find the stack in the local path
+		cfg.Compose = &ComposeConfig{}
+	}
 
 	return cfg
 }
 
+// ImagePolicy returns the deploy policy for a Docker image: its own policy if set,
+// otherwise the project-wide policy.
+func (c *Config) ImagePolicy(img *DockerImageConfig) DeployPolicy {
+	if img != nil && img.Policy != nil {
+		return *img.Policy
+	}
+	return c.Policy
+}
+
+// projectNameFromEnv returns BEACON_PROJECT_NAME, or the base name of localPath when unset.
+func projectNameFromEnv(getenv func(string) string, localPath string) string {
+	if name := strings.TrimSpace(getenv("BEACON_PROJECT_NAME")); name != "" {
+		return name
+	}
+	return filepath.Base(localPath)
+}
+
 // loadDockerImagesConfig loads Docker images configuration from a YAML file
 func loadDockerImagesConfig(path string) ([]DockerImageConfig, error) {
 	data, err := os.ReadFile(path)
@@ -121,8 +230,8 @@ func loadDockerImagesConfig(path string) ([]DockerImageConfig, error) {
 	return images, nil
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+func (env envSource) getDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := env.getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
@@ -130,9 +239,9 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
-func getEnvOrPrompt(key, prompt, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" && isInteractive() {
+func (env envSource) getOrPrompt(key, prompt, defaultValue string) string {
+	value := env.getenv(key)
+	if value == "" && env.prompt {
 		if defaultValue != "" {
 			fmt.Printf("%s [%s]: ", prompt, defaultValue)
 		} else {
@@ -157,6 +266,11 @@ func getEnvOrPrompt(key, prompt, defaultValue string) string {
 	return value
 }
 
+// expand replaces $VAR references in value from the source.
+func (env envSource) expand(value string) string {
+	return os.Expand(value, env.getenv)
+}
+
 func isInteractive() bool {
 	return term.IsTerminal(int(os.Stdin.Fd()))
 }
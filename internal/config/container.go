@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Container runtimes
+const (
+	RuntimeAuto   = "auto"   // detect (default)
+	RuntimeDocker = "docker" // Docker Engine, rootful or rootless
+	RuntimePodman = "podman"
+)
+
+// How Beacon talks to the container runtime
+const (
+	RuntimeModeAuto = "auto" // the engine API socket when it answers, the CLI otherwise (default)
+	RuntimeModeAPI  = "api"  // always the engine API socket
+	RuntimeModeCLI  = "cli"  // always the docker/podman CLI
+)
+
+// ContainerConfig selects the container runtime used for Docker deploys, compose stacks,
+// container log sources and compose service state. Unset fields fall back to
+// BEACON_CONTAINER_RUNTIME, BEACON_CONTAINER_HOST and BEACON_CONTAINER_MODE, then to detection.
+// Compose stacks always go through the CLI (`docker compose` / `podman compose`).
+type ContainerConfig struct {
+	Runtime string `yaml:"runtime,omitempty"` // "auto" (default), "docker" or "podman"
+	Host    string `yaml:"host,omitempty"`    // engine socket, e.g. unix:///run/user/1000/podman/podman.sock, or tcp://host:port
+	Mode    string `yaml:"mode,omitempty"`    // "auto" (default), "api" or "cli"
+}
+
+// ContainerFromEnv returns the container runtime settings in an environment (os.Getenv or
+// a parsed project env file).
+func ContainerFromEnv(getenv func(string) string) ContainerConfig {
+	return ContainerConfig{
+		Runtime: strings.ToLower(strings.TrimSpace(getenv("BEACON_CONTAINER_RUNTIME"))),
+		Host:    strings.TrimSpace(getenv("BEACON_CONTAINER_HOST")),
+		Mode:    strings.ToLower(strings.TrimSpace(getenv("BEACON_CONTAINER_MODE"))),
+	}
+}
+
+// Override returns c with the fields set in o replacing its own.
+func (c ContainerConfig) Override(o *ContainerConfig) ContainerConfig {
+	if o == nil {
+		return c
+	}
+	if o.Runtime != "" {
+		c.Runtime = o.Runtime
+	}
+	if o.Host != "" {
+		c.Host = o.Host
+	}
+	if o.Mode != "" {
+		c.Mode = o.Mode
+	}
+	return c
+}
+
+// Validate checks runtime and mode names and the engine URL.
+func (c *ContainerConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	switch c.Runtime {
+	case "", RuntimeAuto, RuntimeDocker, RuntimePodman:
+	default:
+		return fmt.Errorf("container: unknown runtime %q (use auto, docker or podman)", c.Runtime)
+	}
+	switch c.Mode {
+	case "", RuntimeModeAuto, RuntimeModeAPI, RuntimeModeCLI:
+	default:
+		return fmt.Errorf("container: unknown mode %q (use auto, api or cli)", c.Mode)
+	}
+	if c.Host != "" && !strings.HasPrefix(c.Host, "unix://") && !strings.HasPrefix(c.Host, "/") && !strings.HasPrefix(c.Host, "tcp://") {
+		return fmt.Errorf("container: host must be a unix socket (unix:///path/to/engine.sock) or tcp://host:port")
+	}
+	return nil
+}
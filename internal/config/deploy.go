@@ -0,0 +1,597 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Deploy policy track modes
+const (
+	TrackTag    = "tag"    // newest tag allowed by the policy (default)
+	TrackBranch = "branch" // head of a branch
+	TrackCommit = "commit" // a pinned commit SHA
+)
+
+// DeployPolicy controls which release a project deploys.
+// Version, IncludePrerelease, TagPattern and ExcludePattern apply to both Git tags and
+// Docker registry tags; Branch and Commit only apply to Git projects.
+type DeployPolicy struct {
+	Track             string `yaml:"track,omitempty"`              // "tag" (default), "branch" or "commit"
+	Branch            string `yaml:"branch,omitempty"`             // branch to follow when track is "branch"
+	Commit            string `yaml:"commit,omitempty"`             // commit SHA to pin when track is "commit"
+	Version           string `yaml:"version,omitempty"`            // semver constraint, e.g. "~1.4", "^2", ">=1.2 <2"
+	IncludePrerelease *bool  `yaml:"include_prerelease,omitempty"` // default: false with a version constraint, true otherwise
+	TagPattern        string `yaml:"tag_pattern,omitempty"`        // only consider tags matching this regex
+	ExcludePattern    string `yaml:"exclude_pattern,omitempty"`    // ignore tags matching this regex
+}
+
+// EffectiveTrack returns the track mode, inferring it from Branch/Commit when unset.
+func (p DeployPolicy) EffectiveTrack() string {
+	switch {
+	case p.Track != "":
+		return p.Track
+	case p.Commit != "":
+		return TrackCommit
+	case p.Branch != "":
+		return TrackBranch
+	}
+	return TrackTag
+}
+
+// AllowsPrerelease reports whether pre-release versions may be selected.
+func (p DeployPolicy) AllowsPrerelease() bool {
+	if p.IncludePrerelease != nil {
+		return *p.IncludePrerelease
+	}
+	return p.Version == ""
+}
+
+// IsZero reports whether no policy fields are set (latest tag wins).
+func (p DeployPolicy) IsZero() bool {
+	return p.Track == "" && p.Branch == "" && p.Commit == "" && p.Version == "" &&
+		p.IncludePrerelease == nil && p.TagPattern == "" && p.ExcludePattern == ""
+}
+
+// Validate checks track values and required fields.
+func (p DeployPolicy) Validate() error {
+	switch p.EffectiveTrack() {
+	case TrackTag:
+	case TrackBranch:
+		if p.Branch == "" {
+			return fmt.Errorf("deploy policy: track %q requires branch", TrackBranch)
+		}
+	case TrackCommit:
+		if p.Commit == "" {
+			return fmt.Errorf("deploy policy: track %q requires commit", TrackCommit)
+		}
+	default:
+		return fmt.Errorf("deploy policy: unknown track %q (use tag, branch or commit)", p.Track)
+	}
+	return nil
+}
+
+// ComposeConfig describes a Docker Compose stack managed by Beacon (deployment type "compose").
+// Relative paths are resolved against the project's local path.
+type ComposeConfig struct {
+	ProjectName   string   `yaml:"project_name,omitempty"`   // compose project name (-p); default: Beacon project name
+	Files         []string `yaml:"files,omitempty"`          // compose files (-f); default: compose's own lookup
+	Profiles      []string `yaml:"profiles,omitempty"`       // profiles to enable (--profile)
+	EnvFiles      []string `yaml:"env_files,omitempty"`      // env files for interpolation (--env-file)
+	Services      []string `yaml:"services,omitempty"`       // limit pull/up to these services (default: all)
+	RemoveOrphans bool     `yaml:"remove_orphans,omitempty"` // pass --remove-orphans to up
+}
+
+// Artifact release sources
+const (
+	ArtifactSourceGitHub = "github" // GitHub releases API
+	ArtifactSourceGitea  = "gitea"  // Gitea / Forgejo releases API
+	ArtifactSourceHTTP   = "http"   // plain HTTP directory index
+)
+
+// DefaultArtifactKeep is how many unpacked releases an artifact project keeps on disk.
+const DefaultArtifactKeep = 3
+
+// ArtifactConfig describes where deployment type "artifact" finds release assets.
+// Asset patterns may contain {version}, {os} and {arch}; {version} is the release tag
+// without a leading "v".
+type ArtifactConfig struct {
+	Source          string `yaml:"source,omitempty"`           // "github" (default), "gitea" or "http"
+	Repo            string `yaml:"repo,omitempty"`             // owner/name for github and gitea
+	URL             string `yaml:"url,omitempty"`              // Gitea base URL, GitHub API URL (Enterprise) or HTTP index URL
+	Asset           string `yaml:"asset,omitempty"`            // asset name glob; default: an asset naming the host OS and arch (required for http)
+	Checksums       string `yaml:"checksums,omitempty"`        // checksum file name; default: SHA256SUMS(.txt), checksums.txt or <asset>.sha256
+	RequireChecksum bool   `yaml:"require_checksum,omitempty"` // refuse assets without a checksum
+	Token           string `yaml:"token,omitempty"`            // API / download token; key://<name> reads the key store
+	StripComponents int    `yaml:"strip_components,omitempty"` // leading path components to drop when unpacking
+	Binary          string `yaml:"binary,omitempty"`           // file name for a bare (non-archive) asset; default: asset name
+	Keep            int    `yaml:"keep,omitempty"`             // releases kept on disk (default 3)
+}
+
+// EffectiveSource returns the release source, defaulting to GitHub.
+func (a *ArtifactConfig) EffectiveSource() string {
+	if a.Source == "" {
+		return ArtifactSourceGitHub
+	}
+	return a.Source
+}
+
+// EffectiveKeep returns how many releases to keep on disk.
+func (a *ArtifactConfig) EffectiveKeep() int {
+	if a.Keep <= 0 {
+		return DefaultArtifactKeep
+	}
+	return a.Keep
+}
+
+// Validate checks the source and its required fields.
+func (a *ArtifactConfig) Validate() error {
+	if a == nil {
+		return fmt.Errorf("artifact: missing artifact section in deploy.yml")
+	}
+	switch a.EffectiveSource() {
+	case ArtifactSourceGitHub:
+		if a.Repo == "" {
+			return fmt.Errorf("artifact: source github requires repo (owner/name)")
+		}
+	case ArtifactSourceGitea:
+		if a.Repo == "" || a.URL == "" {
+			return fmt.Errorf("artifact: source gitea requires repo and url")
+		}
+	case ArtifactSourceHTTP:
+		if a.URL == "" {
+			return fmt.Errorf("artifact: source http requires url")
+		}
+		if !strings.Contains(a.Asset, "{version}") {
+			return fmt.Errorf("artifact: source http requires an asset pattern containing {version}")
+		}
+	default:
+		return fmt.Errorf("artifact: unknown source %q (use github, gitea or http)", a.Source)
+	}
+	if a.StripComponents < 0 {
+		return fmt.Errorf("artifact: strip_components must not be negative")
+	}
+	return nil
+}
+
+// Deploy pipeline stages, in execution order. on_failure only runs when a stage fails.
+const (
+	StagePreDeploy  = "pre_deploy"
+	StageBuild      = "build"
+	StageMigrate    = "migrate"
+	StageSwitch     = "switch"
+	StagePostDeploy = "post_deploy"
+	StageOnFailure  = "on_failure"
+)
+
+// DefaultStageTimeout bounds a pipeline stage when neither the stage nor the pipeline sets a timeout.
+const DefaultStageTimeout = 30 * time.Minute
+
+// PipelineStage is one command in the deploy pipeline.
+type PipelineStage struct {
+	Command         string            `yaml:"command"`
+	Timeout         time.Duration     `yaml:"timeout,omitempty"`           // default: pipeline timeout, then 30m
+	WorkingDir      string            `yaml:"working_dir,omitempty"`       // relative to the project's local path
+	Env             map[string]string `yaml:"env,omitempty"`               // added to the pipeline env
+	ContinueOnError bool              `yaml:"continue_on_error,omitempty"` // a failure does not fail the deploy
+}
+
+// UnmarshalYAML accepts either a mapping or a bare command string ("build: make").
+func (s *PipelineStage) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		s.Command = node.Value
+		return nil
+	}
+	type plain PipelineStage
+	return node.Decode((*plain)(s))
+}
+
+// DeployPipeline declares the commands run for a deploy. When switch is not set, the
+// project's deploy command (BEACON_DEPLOY_CMD or the image deploy_command) is the switch stage.
+type DeployPipeline struct {
+	Timeout    time.Duration     `yaml:"timeout,omitempty"` // default timeout for every stage
+	Env        map[string]string `yaml:"env,omitempty"`     // env for every stage
+	PreDeploy  *PipelineStage    `yaml:"pre_deploy,omitempty"`
+	Build      *PipelineStage    `yaml:"build,omitempty"`
+	Migrate    *PipelineStage    `yaml:"migrate,omitempty"`
+	Switch     *PipelineStage    `yaml:"switch,omitempty"`
+	PostDeploy *PipelineStage    `yaml:"post_deploy,omitempty"`
+	OnFailure  *PipelineStage    `yaml:"on_failure,omitempty"`
+}
+
+// Stage returns the named stage, or nil if it is not declared.
+func (p *DeployPipeline) Stage(name string) *PipelineStage {
+	if p == nil {
+		return nil
+	}
+	var st *PipelineStage
+	switch name {
+	case StagePreDeploy:
+		st = p.PreDeploy
+	case StageBuild:
+		st = p.Build
+	case StageMigrate:
+		st = p.Migrate
+	case StageSwitch:
+		st = p.Switch
+	case StagePostDeploy:
+		st = p.PostDeploy
+	case StageOnFailure:
+		st = p.OnFailure
+	}
+	if st == nil || st.Command == "" {
+		return nil
+	}
+	return st
+}
+
+// StageTimeout returns the effective timeout for st.
+func (p *DeployPipeline) StageTimeout(st *PipelineStage) time.Duration {
+	switch {
+	case st != nil && st.Timeout > 0:
+		return st.Timeout
+	case p != nil && p.Timeout > 0:
+		return p.Timeout
+	}
+	return DefaultStageTimeout
+}
+
+// Git checkout modes
+const (
+	GitModeMirror = "mirror" // persistent bare mirror + worktree checkout (default)
+	GitModeClone  = "clone"  // delete the local path and clone it again on every deploy
+)
+
+// Git clean modes for the worktree before checkout
+const (
+	GitCleanUntracked = "untracked" // remove untracked files, keep ignored ones such as node_modules (default)
+	GitCleanAll       = "all"       // also remove ignored files (a fresh tree, like a re-clone)
+	GitCleanNone      = "none"      // leave untracked files alone
+)
+
+// GitFetchConfig controls how Git projects fetch and check out releases.
+type GitFetchConfig struct {
+	Mode       string `yaml:"mode,omitempty"`       // "mirror" (default) or "clone"
+	Depth      int    `yaml:"depth,omitempty"`      // shallow fetch depth; 0 = full history
+	Filter     string `yaml:"filter,omitempty"`     // partial clone filter, e.g. "blob:none"
+	Submodules bool   `yaml:"submodules,omitempty"` // init/update submodules recursively
+	LFS        bool   `yaml:"lfs,omitempty"`        // fetch Git LFS objects with `git lfs pull`
+	Clean      string `yaml:"clean,omitempty"`      // "untracked" (default), "all" or "none"
+}
+
+// EffectiveMode returns the checkout mode, defaulting to mirror.
+func (g GitFetchConfig) EffectiveMode() string {
+	if g.Mode == "" {
+		return GitModeMirror
+	}
+	return g.Mode
+}
+
+// Validate checks mode and clean values.
+func (g GitFetchConfig) Validate() error {
+	switch g.EffectiveMode() {
+	case GitModeMirror, GitModeClone:
+	default:
+		return fmt.Errorf("git: unknown mode %q (use mirror or clone)", g.Mode)
+	}
+	switch g.Clean {
+	case "", GitCleanUntracked, GitCleanAll, GitCleanNone:
+	default:
+		return fmt.Errorf("git: unknown clean mode %q (use untracked, all or none)", g.Clean)
+	}
+	if g.Depth < 0 {
+		return fmt.Errorf("git: depth must not be negative")
+	}
+	return nil
+}
+
+// Signature requirements for Git releases
+const (
+	VerifyGitTag    = "tag"    // tag deploys need a signed annotated tag, other refs a signed commit (default)
+	VerifyGitCommit = "commit" // the deployed commit itself must be signed
+)
+
+// VerifyConfig refuses releases that are not signed by a trusted key. Key paths may be
+// relative to the project config directory; keep them out of the repository being deployed.
+type VerifyConfig struct {
+	Git          *GitVerifyConfig   `yaml:"git,omitempty"`
+	Image        *ImageVerifyConfig `yaml:"image,omitempty"`
+	AlertCommand string             `yaml:"alert_command,omitempty"` // run when a release is refused
+}
+
+// GitVerifyConfig requires Git tags or commits signed by an allowed SSH or GPG key.
+type GitVerifyConfig struct {
+	Require        string `yaml:"require,omitempty"`         // "tag" (default) or "commit"
+	AllowedSigners string `yaml:"allowed_signers,omitempty"` // SSH allowed_signers file (see ssh-keygen(1))
+	GPGKeyring     string `yaml:"gpg_keyring,omitempty"`     // exported GPG public keys (armored or binary)
+}
+
+// ImageVerifyConfig requires Docker images signed with cosign against a public key.
+type ImageVerifyConfig struct {
+	PublicKey string `yaml:"public_key,omitempty"` // cosign public key (PEM), e.g. cosign.pub
+}
+
+// Enabled reports whether any verification is configured.
+func (v *VerifyConfig) Enabled() bool {
+	return v != nil && (v.Git != nil || v.Image != nil)
+}
+
+// Validate checks that every enabled verifier has a key to verify against.
+func (v *VerifyConfig) Validate() error {
+	if v == nil {
+		return nil
+	}
+	if g := v.Git; g != nil {
+		switch g.Require {
+		case "", VerifyGitTag, VerifyGitCommit:
+		default:
+			return fmt.Errorf("verify.git: unknown require %q (use tag or commit)", g.Require)
+		}
+		if g.AllowedSigners == "" && g.GPGKeyring == "" {
+			return fmt.Errorf("verify.git: set allowed_signers and/or gpg_keyring")
+		}
+	}
+	if v.Image != nil && v.Image.PublicKey == "" {
+		return fmt.Errorf("verify.image: public_key is required")
+	}
+	return nil
+}
+
+// resolvePaths makes relative key paths absolute against dir.
+func (v *VerifyConfig) resolvePaths(dir string) {
+	if v == nil {
+		return
+	}
+	abs := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		if rest, ok := strings.CutPrefix(p, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				return filepath.Join(home, rest)
+			}
+		}
+		return filepath.Join(dir, p)
+	}
+	if v.Git != nil {
+		v.Git.AllowedSigners = abs(v.Git.AllowedSigners)
+		v.Git.GPGKeyring = abs(v.Git.GPGKeyring)
+	}
+	if v.Image != nil {
+		v.Image.PublicKey = abs(v.Image.PublicKey)
+	}
+}
+
+// GateConfig holds new releases that the poll loop and push webhooks find until they may be
+// deployed: inside one of Windows, once approved when RequireApproval is set, and while
+// ReadyCommand succeeds. Deploys started by hand (CLI, MCP, cloud) are not gated.
+type GateConfig struct {
+	Windows         []DeployWindow `yaml:"windows,omitempty"`          // allowed deploy windows; none means any time
+	Timezone        string         `yaml:"timezone,omitempty"`         // IANA zone for the windows, default local time
+	RequireApproval bool           `yaml:"require_approval,omitempty"` // park releases until `beacon projects approve`
+	ReadyCommand    string         `yaml:"ready_command,omitempty"`    // hold while this exits non-zero (e.g. someone is home)
+}
+
+// DeployWindow is a daily time range in which deploys are allowed. An End before Start
+// spans midnight; the window then belongs to the day it starts on.
+type DeployWindow struct {
+	Days  []string `yaml:"days,omitempty"` // mon..sun, "weekdays", "weekends"; default every day
+	Start string   `yaml:"start"`          // "HH:MM"
+	End   string   `yaml:"end"`            // "HH:MM"
+}
+
+var windowDays = map[string][]time.Weekday{
+	"sun": {time.Sunday}, "mon": {time.Monday}, "tue": {time.Tuesday}, "wed": {time.Wednesday},
+	"thu": {time.Thursday}, "fri": {time.Friday}, "sat": {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Enabled reports whether the gate can hold a release.
+func (g *GateConfig) Enabled() bool {
+	return g != nil && (len(g.Windows) > 0 || g.RequireApproval || g.ReadyCommand != "")
+}
+
+// Validate checks the time zone and window syntax.
+func (g *GateConfig) Validate() error {
+	if g == nil {
+		return nil
+	}
+	if _, err := time.LoadLocation(g.Timezone); err != nil {
+		return fmt.Errorf("gate: unknown timezone %q", g.Timezone)
+	}
+	for i, w := range g.Windows {
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("gate: window %d: start: %w", i+1, err)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("gate: window %d: end: %w", i+1, err)
+		}
+		if w.Start == w.End {
+			return fmt.Errorf("gate: window %d: start and end are equal", i+1)
+		}
+		if _, err := w.weekdays(); err != nil {
+			return fmt.Errorf("gate: window %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Location returns the time zone the windows are written in.
+func (g *GateConfig) Location() *time.Location {
+	if g == nil || g.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(g.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// InWindow reports whether t falls in a deploy window. With no windows every time does.
+func (g *GateConfig) InWindow(t time.Time) bool {
+	if g == nil || len(g.Windows) == 0 {
+		return true
+	}
+	t = t.In(g.Location())
+	for _, w := range g.Windows {
+		// A window that spans midnight may have opened yesterday
+		for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+			if start, end, ok := w.on(day); ok && !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NextWindow returns when the next deploy window opens after t, or t itself when t is in a
+// window. The zero time means no window ever opens.
+func (g *GateConfig) NextWindow(t time.Time) time.Time {
+	if g.InWindow(t) {
+		return t
+	}
+	t = t.In(g.Location())
+	var next time.Time
+	for _, w := range g.Windows {
+		for d := 0; d <= 7; d++ {
+			start, _, ok := w.on(t.AddDate(0, 0, d))
+			if ok && start.After(t) {
+				if next.IsZero() || start.Before(next) {
+					next = start
+				}
+				break
+			}
+		}
+	}
+	return next
+}
+
+// on returns the window's start and end when it opens on day's date.
+func (w DeployWindow) on(day time.Time) (time.Time, time.Time, bool) {
+	days, err := w.weekdays()
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if len(days) > 0 && !containsWeekday(days, day.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+	startMin, err1 := parseClock(w.Start)
+	endMin, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	y, m, d := day.Date()
+	start := time.Date(y, m, d, startMin/60, startMin%60, 0, 0, day.Location())
+	end := time.Date(y, m, d, endMin/60, endMin%60, 0, 0, day.Location())
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, true
+}
+
+// weekdays returns the days the window opens on; nil means every day.
+func (w DeployWindow) weekdays() ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, name := range w.Days {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if len(key) > 3 && key != "weekdays" && key != "weekends" {
+			key = key[:3] // "monday" -> "mon"
+		}
+		wd, ok := windowDays[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q (use mon..sun, weekdays or weekends)", name)
+		}
+		days = append(days, wd...)
+	}
+	return days, nil
+}
+
+func containsWeekday(days []time.Weekday, d time.Weekday) bool {
+	for _, wd := range days {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses "HH:MM" into minutes after midnight. "24:00" is accepted as an end.
+func parseClock(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// WebhookConfig configures the push webhook receiver of `beacon deploy`.
+// The shared secret is read from BEACON_WEBHOOK_SECRET, not from this file.
+type WebhookConfig struct {
+	Repositories []string `yaml:"repositories,omitempty"` // extra repositories (mirrors) whose events trigger a deploy
+}
+
+// DeployFileConfig is the optional per-project deploy.yml in the project config directory
+// (~/.beacon/config/projects/<project>/deploy.yml).
+type DeployFileConfig struct {
+	Policy    DeployPolicy      `yaml:"policy,omitempty"`
+	Compose   *ComposeConfig    `yaml:"compose,omitempty"`
+	Webhook   WebhookConfig     `yaml:"webhook,omitempty"`
+	Pipeline  *DeployPipeline   `yaml:"pipeline,omitempty"`
+	Git       GitFetchConfig    `yaml:"git,omitempty"`
+	Verify    *VerifyConfig     `yaml:"verify,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty"` // key://<name> values come from the key store
+	Artifact  *ArtifactConfig   `yaml:"artifact,omitempty"`
+	Gate      *GateConfig       `yaml:"gate,omitempty"`
+	Container *ContainerConfig  `yaml:"container,omitempty"`
+	Lifecycle *LifecycleConfig  `yaml:"lifecycle,omitempty"`
+}
+
+// ProjectConfigDir returns ~/.beacon/config/projects/<project> (or under $BEACON_HOME).
+func ProjectConfigDir(projectName string) string {
+	base, err := BeaconHomeDir()
+	if err != nil {
+		base = filepath.Join(os.Getenv("HOME"), ".beacon")
+	}
+	return filepath.Join(base, "config", "projects", projectName)
+}
+
+// LoadDeployFileConfig reads deploy.yml from path.
+func LoadDeployFileConfig(path string) (*DeployFileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dc DeployFileConfig
+	if err := yaml.Unmarshal(data, &dc); err != nil {
+		return nil, fmt.Errorf("failed to parse deploy config: %w", err)
+	}
+	if err := dc.Policy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := dc.Git.Validate(); err != nil {
+		return nil, err
+	}
+	if err := dc.Verify.Validate(); err != nil {
+		return nil, err
+	}
+	if err := dc.Gate.Validate(); err != nil {
+		return nil, err
+	}
+	if err := dc.Container.Validate(); err != nil {
+		return nil, err
+	}
+	if err := dc.Lifecycle.Validate(); err != nil {
+		return nil, err
+	}
+	dc.Verify.resolvePaths(filepath.Dir(path))
+	return &dc, nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lifecycle adapters: how the child agent restarts, stops and starts a project
+const (
+	LifecycleCommand = "command" // restart_command / stop_command / start_command
+	LifecycleSystemd = "systemd" // systemctl restart|stop|start <systemd_unit>
+	LifecycleCompose = "compose" // docker/podman compose restart|stop|start for the compose: stack
+)
+
+// Defaults for lifecycle actions
+const (
+	DefaultLifecycleTimeout       = 2 * time.Minute
+	DefaultLifecycleHealthTimeout = 30 * time.Second
+)
+
+// LifecycleConfig controls the remote restart, stop and start actions run by the project's
+// child agent. Without an explicit adapter it is picked from the fields that are set:
+// commands, then systemd_unit, then the compose stack of a compose project.
+type LifecycleConfig struct {
+	Adapter        string        `yaml:"adapter,omitempty"`         // "command", "systemd" or "compose"
+	RestartCommand string        `yaml:"restart_command,omitempty"` // default: stop_command, then start_command
+	StopCommand    string        `yaml:"stop_command,omitempty"`
+	StartCommand   string        `yaml:"start_command,omitempty"`
+	SystemdUnit    string        `yaml:"systemd_unit,omitempty"`   // e.g. "myapp.service"
+	SystemdUser    bool          `yaml:"systemd_user,omitempty"`   // systemctl --user
+	Services       []string      `yaml:"services,omitempty"`       // compose services acted on when a command names none (default: whole stack)
+	Timeout        time.Duration `yaml:"timeout,omitempty"`        // per action, default 2m
+	HealthTimeout  time.Duration `yaml:"health_timeout,omitempty"` // wait for checks to pass after restart/start, default 30s
+}
+
+// EffectiveAdapter returns the adapter used for a project of the given deployment type, or
+// "" when restart/stop/start are not configured.
+func (l *LifecycleConfig) EffectiveAdapter(deploymentType string) string {
+	switch {
+	case l != nil && l.Adapter != "":
+		return l.Adapter
+	case l != nil && (l.RestartCommand != "" || l.StopCommand != "" || l.StartCommand != ""):
+		return LifecycleCommand
+	case l != nil && l.SystemdUnit != "":
+		return LifecycleSystemd
+	case deploymentType == "compose":
+		return LifecycleCompose
+	}
+	return ""
+}
+
+// EffectiveTimeout returns the timeout of one action.
+func (l *LifecycleConfig) EffectiveTimeout() time.Duration {
+	if l != nil && l.Timeout > 0 {
+		return l.Timeout
+	}
+	return DefaultLifecycleTimeout
+}
+
+// EffectiveHealthTimeout returns how long to wait for health checks after a restart or start.
+func (l *LifecycleConfig) EffectiveHealthTimeout() time.Duration {
+	if l != nil && l.HealthTimeout > 0 {
+		return l.HealthTimeout
+	}
+	return DefaultLifecycleHealthTimeout
+}
+
+// Validate checks the adapter name and that the adapter has what it needs.
+func (l *LifecycleConfig) Validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.Timeout < 0 || l.HealthTimeout < 0 {
+		return fmt.Errorf("lifecycle: timeouts must not be negative")
+	}
+	switch l.Adapter {
+	case "", LifecycleCompose:
+	case LifecycleCommand:
+		if l.RestartCommand == "" && l.StopCommand == "" && l.StartCommand == "" {
+			return fmt.Errorf("lifecycle: adapter command needs restart_command, stop_command or start_command")
+		}
+	case LifecycleSystemd:
+		if l.SystemdUnit == "" {
+			return fmt.Errorf("lifecycle: adapter systemd needs systemd_unit")
+		}
+	default:
+		return fmt.Errorf("lifecycle: unknown adapter %q (use command, systemd or compose)", l.Adapter)
+	}
+	return nil
+}
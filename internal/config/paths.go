@@ -126,6 +126,12 @@ func (bp *BeaconPaths) GetProjectSourcesFile(projectName string) string {
 	return filepath.Join(bp.GetProjectConfigDir(projectName), "sources.yml")
 }
 
+// GetProjectGitMirrorDir returns the bare Git mirror Beacon keeps for a Git project
+// (~/.beacon/state/<project>/repo.git); releases are checked out from it as worktrees.
+func (bp *BeaconPaths) GetProjectGitMirrorDir(projectName string) string {
+	return filepath.Join(bp.StateDir, projectName, "repo.git")
+}
+
 // GetProjectStateDir returns the state directory for a specific project (checks, k8s, etc.)
 func (bp *BeaconPaths) GetProjectStateDir(projectName string) string {
 	return filepath.Join(bp.StateDir, projectName)
@@ -269,6 +275,11 @@ func (bp *BeaconPaths) RemoveProject(projectName string) error {
 		return fmt.Errorf("failed to remove project logs directory: %v", err)
 	}
 
+	// Remove the Git mirror (deploy history in the state directory is kept)
+	if err := os.RemoveAll(bp.GetProjectGitMirrorDir(projectName)); err != nil {
+		return fmt.Errorf("failed to remove project git mirror: %v", err)
+	}
+
 	// Remove project working directory
 	projectWorkingDir := bp.GetProjectWorkingDir(projectName)
 	if err := os.RemoveAll(projectWorkingDir); err != nil {
@@ -0,0 +1,206 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLogsBytes caps the container output read by one logs call.
+const maxLogsBytes = 16 << 20
+
+// apiClient talks to the Docker Engine API over a unix socket (or plain TCP). Podman serves
+// the same (compatible) API on its socket, so one client covers both.
+type apiClient struct {
+	http *http.Client
+}
+
+func newAPIClient(host string) *apiClient {
+	network, addr := "unix", strings.TrimPrefix(host, "unix://")
+	if tcp, ok := strings.CutPrefix(host, "tcp://"); ok {
+		network, addr = "tcp", tcp
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &apiClient{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}}
+}
+
+// do sends a request to the engine and returns the response, or an error carrying the
+// engine's message for non-2xx statuses.
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, header http.Header) (*http.Response, error) {
+	u := "http://engine" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var msg struct {
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(body, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(body))
+		}
+		return nil, fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, msg.Message)
+	}
+	return resp, nil
+}
+
+func (c *apiClient) ping(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// pull runs POST /images/create and relays the progress stream.
+func (c *apiClient) pull(ctx context.Context, image string, auth *Auth, out io.Writer) error {
+	repo, tag := splitRef(image)
+	query := url.Values{"fromImage": {repo}, "tag": {tag}}
+	header := http.Header{}
+	if auth != nil && auth.Username != "" {
+		cred, _ := json.Marshal(map[string]string{
+			"username": auth.Username, "password": auth.Password, "serveraddress": auth.Registry,
+		})
+		header.Set("X-Registry-Auth", base64.URLEncoding.EncodeToString(cred))
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", query, header)
+	if err != nil {
+		return fmt.Errorf("pull %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+
+	// One JSON message per line; failures arrive in-stream after a 200
+	dec := json.NewDecoder(resp.Body)
+	last := ""
+	for {
+		var msg struct {
+			Status string `json:"status"`
+			ID     string `json:"id"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("pull %s: %w", image, err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("pull %s: %s", image, msg.Error)
+		}
+		line := strings.TrimSpace(msg.ID + " " + msg.Status)
+		if out != nil && line != "" && line != last && !strings.HasPrefix(msg.Status, "Downloading") && !strings.HasPrefix(msg.Status, "Extracting") {
+			fmt.Fprintln(out, line)
+			last = line
+		}
+	}
+}
+
+func (c *apiClient) imageDigests(ctx context.Context, image string) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var info struct {
+		RepoDigests []string `json:"RepoDigests"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("inspect %s: %w", image, err)
+	}
+	return info.RepoDigests, nil
+}
+
+func (c *apiClient) runningContainers(ctx context.Context) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/containers/json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list []struct {
+		Names []string `json:"Names"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	var names []string
+	for _, ctr := range list {
+		if len(ctr.Names) > 0 {
+			names = append(names, strings.TrimPrefix(ctr.Names[0], "/"))
+		}
+	}
+	return names, nil
+}
+
+func (c *apiClient) logs(ctx context.Context, container string, since time.Time) ([]byte, error) {
+	query := url.Values{
+		"stdout": {"1"}, "stderr": {"1"}, "timestamps": {"1"},
+		"since": {strconv.FormatInt(since.Unix(), 10)},
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(container)+"/logs", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLogsBytes))
+	if err != nil {
+		return nil, fmt.Errorf("logs %s: %w", container, err)
+	}
+	return demux(data), nil
+}
+
+// demux strips the 8-byte frame headers the engine puts on stdout/stderr of containers
+// without a TTY. Raw (TTY) output is returned as is.
+func demux(data []byte) []byte {
+	if len(data) < 8 || data[0] > 2 || data[1] != 0 || data[2] != 0 || data[3] != 0 {
+		return data
+	}
+	var out bytes.Buffer
+	r := bufio.NewReader(bytes.NewReader(data))
+	hdr := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return out.Bytes()
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[4:]))
+		if _, err := io.CopyN(&out, r, size); err != nil {
+			return out.Bytes()
+		}
+	}
+}
+
+// splitRef splits an image reference into repository and tag or digest ("latest" by default).
+func splitRef(ref string) (string, string) {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, "latest"
+}
@@ -0,0 +1,309 @@
+// Package container abstracts the container runtime (Docker, rootless Docker or Podman) that
+// Beacon pulls images from, inspects and reads container logs through, using the engine API
+// socket when it answers and the docker/podman CLI otherwise.
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"beacon/internal/config"
+)
+
+// pingTimeout bounds the engine API probe made while detecting the runtime.
+const pingTimeout = 2 * time.Second
+
+// Well-known engine sockets; variables so tests can point them elsewhere.
+var (
+	rootfulDockerSocket = "/var/run/docker.sock"
+	rootfulPodmanSocket = "/run/podman/podman.sock"
+)
+
+// Runtime is a detected container engine.
+type Runtime struct {
+	Name     string // config.RuntimeDocker or config.RuntimePodman
+	Rootless bool
+	Host     string // engine API endpoint (unix://... or tcp://...); "" when none was found
+
+	api *apiClient // nil: CLI only
+}
+
+// Auth holds registry credentials for a pull.
+type Auth struct {
+	Username string
+	Password string
+	Registry string // registry host; "" for Docker Hub
+}
+
+var detected = struct {
+	sync.Mutex
+	m map[config.ContainerConfig]*Runtime
+}{m: make(map[config.ContainerConfig]*Runtime)}
+
+// Detect returns the runtime selected by cfg. Unset fields mean auto-detection: the socket
+// in cfg.Host or DOCKER_HOST, then rootful and rootless Docker, then Podman. Successful
+// detections are cached for the life of the process.
+func Detect(cfg config.ContainerConfig) (*Runtime, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	detected.Lock()
+	defer detected.Unlock()
+	if rt, ok := detected.m[cfg]; ok {
+		return rt, nil
+	}
+	rt, err := detect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	detected.m[cfg] = rt
+	return rt, nil
+}
+
+func detect(cfg config.ContainerConfig) (*Runtime, error) {
+	rt := &Runtime{Name: cfg.Runtime, Host: socketURL(cfg.Host)}
+	switch rt.Name {
+	case config.RuntimeDocker:
+		if rt.Host == "" {
+			rt.Host = firstSocket(dockerSockets())
+		}
+	case config.RuntimePodman:
+		if rt.Host == "" {
+			rt.Host = firstSocket(podmanSockets())
+		}
+	default:
+		if err := rt.autodetect(); err != nil {
+			return nil, err
+		}
+	}
+	rt.Rootless = rt.rootless()
+
+	switch cfg.Mode {
+	case config.RuntimeModeAPI:
+		if rt.Host == "" {
+			return nil, fmt.Errorf("container: mode api needs an engine socket; none found for %s (set container.host)", rt.Name)
+		}
+		rt.api = newAPIClient(rt.Host)
+	case config.RuntimeModeCLI:
+	default:
+		if rt.Host != "" {
+			api := newAPIClient(rt.Host)
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			if api.ping(ctx) == nil {
+				rt.api = api
+			}
+			cancel()
+		}
+		if rt.api == nil {
+			if _, err := exec.LookPath(rt.Name); err != nil {
+				return nil, fmt.Errorf("container: %s CLI not found and no engine socket answers", rt.Name)
+			}
+		}
+	}
+	return rt, nil
+}
+
+// autodetect picks the runtime when none is configured.
+func (rt *Runtime) autodetect() error {
+	_, dockerErr := exec.LookPath(config.RuntimeDocker)
+	_, podmanErr := exec.LookPath(config.RuntimePodman)
+	hasDocker, hasPodman := dockerErr == nil, podmanErr == nil
+
+	if rt.Host == "" {
+		rt.Host = socketURL(os.Getenv("DOCKER_HOST"))
+	}
+	if rt.Host != "" {
+		rt.Name = config.RuntimeDocker
+		if strings.Contains(rt.Host, "podman") || (!hasDocker && hasPodman) {
+			rt.Name = config.RuntimePodman
+		}
+		return nil
+	}
+
+	dockerSock, podmanSock := firstSocket(dockerSockets()), firstSocket(podmanSockets())
+	switch {
+	case dockerSock != "" && (hasDocker || !hasPodman):
+		rt.Name, rt.Host = config.RuntimeDocker, dockerSock
+	case hasDocker && (podmanSock == "" || !hasPodman):
+		rt.Name = config.RuntimeDocker
+	case hasPodman || podmanSock != "":
+		rt.Name, rt.Host = config.RuntimePodman, podmanSock
+	default:
+		return errors.New("container: no container runtime found (install Docker or Podman, or set container.runtime)")
+	}
+	return nil
+}
+
+// rootless reports whether the engine runs as an unprivileged user. An engine reached over
+// TCP is assumed to be rootful.
+func (rt *Runtime) rootless() bool {
+	if rt.Name == config.RuntimePodman && rt.Host == "" {
+		// The CLI runs the containers itself, as this user
+		return os.Geteuid() != 0
+	}
+	path, ok := strings.CutPrefix(rt.Host, "unix://")
+	if !ok {
+		return false
+	}
+	if rt.Name == config.RuntimePodman {
+		return path != rootfulPodmanSocket && path != "/var/run/podman/podman.sock"
+	}
+	return path != rootfulDockerSocket && path != "/run/docker.sock"
+}
+
+// String describes the runtime, e.g. "podman (rootless, api)".
+func (rt *Runtime) String() string {
+	var attrs []string
+	if rt.Rootless {
+		attrs = append(attrs, "rootless")
+	}
+	if rt.api != nil {
+		attrs = append(attrs, "api")
+	} else {
+		attrs = append(attrs, "cli")
+	}
+	return rt.Name + " (" + strings.Join(attrs, ", ") + ")"
+}
+
+// Env returns the environment a docker/podman CLI needs to reach the same engine. Podman
+// itself ignores DOCKER_HOST, but `podman compose` hands it to the compose provider.
+func (rt *Runtime) Env() []string {
+	if rt.Host != "" {
+		return []string{"DOCKER_HOST=" + rt.Host}
+	}
+	return nil
+}
+
+// Command builds `docker args...` or `podman args...` for the runtime.
+func (rt *Runtime) Command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, rt.Name, args...)
+	if env := rt.Env(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// Pull pulls image (repo:tag or repo@digest), logging in first when auth is given.
+// Progress goes to out.
+func (rt *Runtime) Pull(ctx context.Context, image string, auth *Auth, out io.Writer) error {
+	if rt.api != nil {
+		return rt.api.pull(ctx, image, auth, out)
+	}
+	if auth != nil && auth.Username != "" && auth.Password != "" {
+		args := []string{"login", "--username", auth.Username, "--password-stdin"}
+		if auth.Registry != "" {
+			args = append(args, auth.Registry)
+		}
+		login := rt.Command(ctx, args...)
+		login.Stdin = strings.NewReader(auth.Password)
+		if msg, err := login.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s login: %w: %s", rt.Name, err, strings.TrimSpace(string(msg)))
+		}
+	}
+	cmd := rt.Command(ctx, "pull", image)
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s pull: %w", rt.Name, err)
+	}
+	return nil
+}
+
+// ImageDigests returns the repo digests (name@sha256:...) recorded for a local image.
+func (rt *Runtime) ImageDigests(ctx context.Context, image string) ([]string, error) {
+	if rt.api != nil {
+		return rt.api.imageDigests(ctx, image)
+	}
+	out, err := rt.Command(ctx, "image", "inspect", "--format", "{{range .RepoDigests}}{{.}} {{end}}", image).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s image inspect: %w", rt.Name, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// RunningContainers returns the names of running containers.
+func (rt *Runtime) RunningContainers(ctx context.Context) ([]string, error) {
+	if rt.api != nil {
+		return rt.api.runningContainers(ctx)
+	}
+	out, err := rt.Command(ctx, "ps", "--format", "{{.Names}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s ps: %w", rt.Name, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Logs returns a container's stdout and stderr since the given time, each line prefixed
+// with its RFC 3339 timestamp. extraArgs are passed to `logs` and force the CLI.
+func (rt *Runtime) Logs(ctx context.Context, container string, since time.Time, extraArgs []string) ([]byte, error) {
+	if rt.api != nil && len(extraArgs) == 0 {
+		return rt.api.logs(ctx, container, since)
+	}
+	args := append([]string{"logs", "--since", since.Format("2006-01-02T15:04:05"), "--timestamps"}, extraArgs...)
+	var out bytes.Buffer
+	cmd := rt.Command(ctx, append(args, container)...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s logs %s: %w: %s", rt.Name, container, err, strings.TrimSpace(out.String()))
+	}
+	return out.Bytes(), nil
+}
+
+// dockerSockets lists rootful, then rootless Docker sockets.
+func dockerSockets() []string {
+	socks := []string{rootfulDockerSocket}
+	if dir := runtimeDir(); dir != "" {
+		socks = append(socks, filepath.Join(dir, "docker.sock"))
+	}
+	return socks
+}
+
+// podmanSockets lists the current user's Podman socket, then the rootful one.
+func podmanSockets() []string {
+	var socks []string
+	if dir := runtimeDir(); dir != "" && os.Geteuid() != 0 {
+		socks = append(socks, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	return append(socks, rootfulPodmanSocket)
+}
+
+// runtimeDir returns $XDG_RUNTIME_DIR, or /run/user/<uid> for non-root users.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	if uid := os.Geteuid(); uid > 0 {
+		return fmt.Sprintf("/run/user/%d", uid)
+	}
+	return ""
+}
+
+// firstSocket returns the first path that is a unix socket, as a unix:// URL.
+func firstSocket(paths []string) string {
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return "unix://" + p
+		}
+	}
+	return ""
+}
+
+// socketURL normalizes a socket path to a unix:// URL. tcp:// URLs are kept; other schemes
+// (ssh://, npipe://) are ignored.
+func socketURL(host string) string {
+	switch {
+	case strings.HasPrefix(host, "unix://"), strings.HasPrefix(host, "tcp://"):
+		return host
+	case strings.HasPrefix(host, "/"):
+		return "unix://" + host
+	}
+	return ""
+}
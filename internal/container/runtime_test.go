@@ -0,0 +1,247 @@
+package container
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"beacon/internal/config"
+)
+
+// shortTempDir returns a temp directory short enough for unix socket paths.
+func shortTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ctr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// fakeBinary puts an executable named name on a fresh PATH; it appends its arguments to log.
+func fakeBinary(t *testing.T, dir, name, log string) {
+	t.Helper()
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\necho $DOCKER_HOST >> %s\n", log, log)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveEngine serves a fake engine API on a unix socket at path.
+func serveEngine(t *testing.T, path string, handler http.Handler) {
+	t.Helper()
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+}
+
+func resetDetected(t *testing.T) {
+	t.Helper()
+	detected.Lock()
+	detected.m = make(map[config.ContainerConfig]*Runtime)
+	detected.Unlock()
+	oldDocker, oldPodman := rootfulDockerSocket, rootfulPodmanSocket
+	rootfulDockerSocket, rootfulPodmanSocket = "/nonexistent/docker.sock", "/nonexistent/podman.sock"
+	t.Cleanup(func() { rootfulDockerSocket, rootfulPodmanSocket = oldDocker, oldPodman })
+}
+
+func TestDetect_PrefersDockerThenPodman(t *testing.T) {
+	resetDetected(t)
+	bin := shortTempDir(t)
+	t.Setenv("PATH", bin)
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("XDG_RUNTIME_DIR", shortTempDir(t))
+	log := filepath.Join(bin, "log")
+
+	if _, err := Detect(config.ContainerConfig{}); err == nil {
+		t.Fatal("detected a runtime with neither docker nor podman installed")
+	}
+
+	fakeBinary(t, bin, "podman", log)
+	rt, err := Detect(config.ContainerConfig{})
+	if err != nil || rt.Name != config.RuntimePodman || rt.api != nil {
+		t.Fatalf("podman only: %v, %v", rt, err)
+	}
+
+	resetDetected(t)
+	fakeBinary(t, bin, "docker", log)
+	if rt, err := Detect(config.ContainerConfig{}); err != nil || rt.Name != config.RuntimeDocker {
+		t.Fatalf("docker and podman: %v, %v", rt, err)
+	}
+	// An explicit runtime wins
+	if rt, err := Detect(config.ContainerConfig{Runtime: config.RuntimePodman}); err != nil || rt.Name != config.RuntimePodman {
+		t.Fatalf("override: %v, %v", rt, err)
+	}
+	if _, err := Detect(config.ContainerConfig{Runtime: "lxc"}); err == nil {
+		t.Error("unknown runtime accepted")
+	}
+}
+
+func TestDetect_RootlessDockerSocket(t *testing.T) {
+	resetDetected(t)
+	bin := shortTempDir(t)
+	t.Setenv("PATH", bin)
+	t.Setenv("DOCKER_HOST", "")
+	xdg := shortTempDir(t)
+	t.Setenv("XDG_RUNTIME_DIR", xdg)
+	log := filepath.Join(bin, "log")
+	fakeBinary(t, bin, "docker", log)
+	fakeBinary(t, bin, "podman", log)
+
+	sock := filepath.Join(xdg, "docker.sock")
+	serveEngine(t, sock, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+
+	rt, err := Detect(config.ContainerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Name != config.RuntimeDocker || !rt.Rootless || rt.Host != "unix://"+sock || rt.api == nil {
+		t.Fatalf("runtime = %+v", rt)
+	}
+	if got := rt.String(); got != "docker (rootless, api)" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// The CLI is pointed at the same engine
+	cli, err := Detect(config.ContainerConfig{Mode: config.RuntimeModeCLI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Command(t.Context(), "ps").Run(); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := os.ReadFile(log)
+	if !strings.Contains(string(out), "ps\nunix://"+sock) {
+		t.Errorf("docker CLI saw %q", out)
+	}
+}
+
+func TestDetect_TCPDockerHost(t *testing.T) {
+	resetDetected(t)
+	bin := shortTempDir(t)
+	t.Setenv("PATH", bin)
+	t.Setenv("XDG_RUNTIME_DIR", shortTempDir(t))
+	fakeBinary(t, bin, "docker", filepath.Join(bin, "log"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	t.Cleanup(srv.Close)
+	host := "tcp://" + srv.Listener.Addr().String()
+	t.Setenv("DOCKER_HOST", host)
+
+	rt, err := Detect(config.ContainerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Name != config.RuntimeDocker || rt.Rootless || rt.Host != host || rt.api == nil {
+		t.Fatalf("runtime = %+v", rt)
+	}
+	if env := rt.Env(); len(env) != 1 || env[0] != "DOCKER_HOST="+host {
+		t.Errorf("Env() = %v", env)
+	}
+}
+
+func TestRuntime_PodmanSocket(t *testing.T) {
+	rootful := &Runtime{Name: config.RuntimePodman, Host: "unix://" + rootfulPodmanSocket}
+	if rootful.rootless() {
+		t.Error("rootful Podman socket reported as rootless")
+	}
+	if user := (&Runtime{Name: config.RuntimePodman, Host: "unix:///run/user/1000/podman/podman.sock"}); !user.rootless() {
+		t.Error("user Podman socket reported as rootful")
+	}
+	// podman compose hands DOCKER_HOST to the compose provider
+	if env := rootful.Env(); len(env) != 1 || env[0] != "DOCKER_HOST=unix://"+rootfulPodmanSocket {
+		t.Errorf("Env() = %v", env)
+	}
+}
+
+func TestRuntime_API(t *testing.T) {
+	resetDetected(t)
+	sock := filepath.Join(shortTempDir(t), "podman.sock")
+	var pullQuery, pullAuth string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "OK") })
+	mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+		pullQuery, pullAuth = r.URL.RawQuery, r.Header.Get("X-Registry-Auth")
+		if r.URL.Query().Get("tag") == "missing" {
+			fmt.Fprintln(w, `{"status":"Trying to pull"}`)
+			fmt.Fprintln(w, `{"error":"manifest unknown"}`)
+			return
+		}
+		fmt.Fprintln(w, `{"status":"Pulling from acme/app","id":"1.2"}`)
+		fmt.Fprintln(w, `{"status":"Download complete","id":"abc"}`)
+	})
+	mux.HandleFunc("/images/registry.example.com/acme/app:1.2/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"RepoDigests":["registry.example.com/acme/app@sha256:1111"]}`)
+	})
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"Names":["/web"]},{"Names":["/db"]}]`)
+	})
+	mux.HandleFunc("/containers/web/logs", func(w http.ResponseWriter, r *http.Request) {
+		for stream, line := range []string{"", "2026-10-18T10:00:00Z out\n", "2026-10-18T10:00:01Z err\n"} {
+			if line == "" {
+				continue
+			}
+			hdr := make([]byte, 8)
+			hdr[0] = byte(stream)
+			binary.BigEndian.PutUint32(hdr[4:], uint32(len(line)))
+			w.Write(append(hdr, line...))
+		}
+	})
+	serveEngine(t, sock, mux)
+
+	rt, err := Detect(config.ContainerConfig{Runtime: config.RuntimePodman, Host: sock, Mode: config.RuntimeModeAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := t.Context()
+
+	var progress strings.Builder
+	auth := &Auth{Username: "bob", Password: "s3cret", Registry: "registry.example.com"}
+	if err := rt.Pull(ctx, "registry.example.com/acme/app:1.2", auth, &progress); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if pullQuery != "fromImage=registry.example.com%2Facme%2Fapp&tag=1.2" {
+		t.Errorf("pull query = %s", pullQuery)
+	}
+	var cred map[string]string
+	raw, _ := base64.URLEncoding.DecodeString(pullAuth)
+	if json.Unmarshal(raw, &cred) != nil || cred["username"] != "bob" || cred["serveraddress"] != "registry.example.com" {
+		t.Errorf("registry auth = %s", raw)
+	}
+	if !strings.Contains(progress.String(), "abc Download complete") {
+		t.Errorf("progress = %q", progress.String())
+	}
+	if err := rt.Pull(ctx, "acme/app:missing", nil, nil); err == nil || !strings.Contains(err.Error(), "manifest unknown") {
+		t.Errorf("failed pull: %v", err)
+	}
+
+	digests, err := rt.ImageDigests(ctx, "registry.example.com/acme/app:1.2")
+	if err != nil || len(digests) != 1 || digests[0] != "registry.example.com/acme/app@sha256:1111" {
+		t.Errorf("digests = %v, %v", digests, err)
+	}
+	names, err := rt.RunningContainers(ctx)
+	if err != nil || strings.Join(names, ",") != "web,db" {
+		t.Errorf("containers = %v, %v", names, err)
+	}
+	logs, err := rt.Logs(ctx, "web", time.Now().Add(-time.Hour), nil)
+	if err != nil || string(logs) != "2026-10-18T10:00:00Z out\n2026-10-18T10:00:01Z err\n" {
+		t.Errorf("logs = %q, %v", logs, err)
+	}
+}
@@ -0,0 +1,212 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// Client talks to the master's control socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the control socket of this BEACON_HOME.
+func NewClient() (*Client, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, err
+	}
+	return NewSocketClient(path), nil
+}
+
+// NewSocketClient returns a client for the control socket at path.
+func NewSocketClient(path string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}}
+}
+
+// Status returns the master's /api/status snapshot into out.
+func (c *Client) Status(ctx context.Context, out any) error {
+	return c.do(ctx, http.MethodGet, "/v1/status", out)
+}
+
+// ProjectAction runs start, stop, restart, check or agent-restart for a project and
+// waits for the outcome.
+func (c *Client) ProjectAction(ctx context.Context, project, action string) (*Result, error) {
+	var res Result
+	err := c.do(ctx, http.MethodPost, "/v1/projects/"+url.PathEscape(project)+"/"+action, &res)
+	return &res, err
+}
+
+// Deploy runs a full deploy of a project in the master and copies its output to out as
+// it is written. With wait, the deploy queues behind a running one.
+func (c *Client) Deploy(ctx context.Context, project string, wait bool, out io.Writer) error {
+	path := "/v1/projects/" + url.PathEscape(project) + "/" + ActionDeploy
+	if wait {
+		path += "?wait=1"
+	}
+	resp, err := c.send(ctx, http.MethodPost, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return replyError(resp)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("deploy output: %w", err)
+	}
+	if msg := resp.Trailer.Get(DeployErrorTrailer); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// SetTunnelEnabled enables or disables a tunnel in config.yaml and applies it.
+func (c *Client) SetTunnelEnabled(ctx context.Context, id string, enabled bool) (*Result, error) {
+	verb := "disable"
+	if enabled {
+		verb = "enable"
+	}
+	var res Result
+	err := c.do(ctx, http.MethodPost, "/v1/tunnels/"+url.PathEscape(id)+"/"+verb, &res)
+	return &res, err
+}
+
+// ReconcileVPN makes the master apply the VPN settings of config.yaml now.
+func (c *Client) ReconcileVPN(ctx context.Context) (*Result, error) {
+	var res Result
+	err := c.do(ctx, http.MethodPost, "/v1/vpn/reconcile", &res)
+	return &res, err
+}
+
+// Upgrade makes the master hand over to the binary on disk, e.g. after `beacon update`,
+// keeping its agents running. It returns once the new binary passed a trial run; the
+// handoff follows and UpgradeStatus tells how it went.
+func (c *Client) Upgrade(ctx context.Context) (*Result, error) {
+	var res Result
+	err := c.do(ctx, http.MethodPost, "/v1/upgrade", &res)
+	return &res, err
+}
+
+// UpgradeStatus returns the state of the master's last self-upgrade into out.
+func (c *Client) UpgradeStatus(ctx context.Context, out any) error {
+	return c.do(ctx, http.MethodGet, "/v1/upgrade", out)
+}
+
+// Events returns the master's recent events matching query (since, type, project,
+// limit) into out.
+func (c *Client) Events(ctx context.Context, query url.Values, out any) error {
+	path := "/v1/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.do(ctx, http.MethodGet, path, out)
+}
+
+// FollowEvents streams the master's events matching query (as for Events; after=<id>
+// resumes after an event) and calls fn with each event's ID and JSON. It returns when the
+// master closes the stream, ctx ends or fn fails.
+func (c *Client) FollowEvents(ctx context.Context, query url.Values, fn func(id string, data []byte) error) error {
+	q := url.Values{"follow": {"1"}}
+	for k, v := range query {
+		q[k] = v
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/v1/events?"+q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return replyError(resp)
+	}
+
+	var id string
+	var data []byte
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data != nil {
+				if err := fn(id, data); err != nil {
+					return err
+				}
+			}
+			id, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// keepalive
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("event stream: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	resp, err := c.send(ctx, method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return replyError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode control reply: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://beacon"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, ErrMasterNotRunning
+		}
+		return nil, fmt.Errorf("control socket: %w", err)
+	}
+	return resp, nil
+}
+
+func replyError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var reply ErrorReply
+	if json.Unmarshal(body, &reply) == nil && reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return fmt.Errorf("control API: %s: %s", resp.Status, msg)
+	}
+	return fmt.Errorf("control API: %s", resp.Status)
+}
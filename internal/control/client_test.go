@@ -0,0 +1,34 @@
+package control
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_MasterNotRunning(t *testing.T) {
+	client := NewSocketClient(filepath.Join(t.TempDir(), "control.sock"))
+	_, err := client.ReconcileVPN(t.Context())
+	require.ErrorIs(t, err, ErrMasterNotRunning)
+}
+
+func TestClient_ErrorReply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	var gotPath string
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"error":"check failed"}`))
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	_, err = NewSocketClient(path).ProjectAction(t.Context(), "my app", ActionCheck)
+	require.EqualError(t, err, "check failed")
+	require.Equal(t, "/v1/projects/my%20app/check", gotPath)
+}
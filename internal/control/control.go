@@ -0,0 +1,66 @@
+// Package control is the client of the master's local control API: the CLI uses it to
+// drive the running master (beacon start) instead of editing files and waiting for the
+// master to notice.
+//
+// The API is HTTP/JSON served on ~/.beacon/control.sock, where the master only accepts
+// connections from its own user and root (peer credentials), and, when control_token is
+// set in ~/.beacon/config.yaml, under /api/control/ on the status server with
+// "Authorization: Bearer <token>".
+//
+//	GET  /v1/status                          the /api/status snapshot
+//	POST /v1/projects/{project}/{action}     start, stop, restart, check, agent-restart
+//	POST /v1/projects/{project}/deploy       deploy; ?wait=1 queues behind a running deploy
+//	POST /v1/tunnels/{id}/{enable|disable}   write config.yaml and apply it
+//	POST /v1/vpn/reconcile                   reconcile the VPN with config.yaml
+//	GET  /v1/events                          ?since=1h|RFC3339&type=&project=&limit=&after=<id>
+//	POST /v1/upgrade                         hand over to the binary on disk, keeping agents
+//	GET  /v1/upgrade                         state of the last self-upgrade
+//
+// /v1/events streams Server-Sent Events with follow=1 (or Accept: text/event-stream).
+// Errors are reported with a non-2xx status and {"error": "..."}.
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+
+	"beacon/internal/config"
+)
+
+// Project actions for POST /v1/projects/{project}/{action}.
+const (
+	ActionStart        = "start"   // the project's lifecycle start (lifecycle: in deploy.yml)
+	ActionStop         = "stop"    // the project's lifecycle stop
+	ActionRestart      = "restart" // the project's lifecycle restart
+	ActionCheck        = "check"   // run the project's health checks now
+	ActionAgentRestart = "agent-restart"
+	ActionDeploy       = "deploy"
+)
+
+// DeployErrorTrailer is the trailer of a streamed deploy response that carries the
+// deploy's error; it is empty when the deploy succeeded.
+const DeployErrorTrailer = "X-Beacon-Deploy-Error"
+
+// ErrMasterNotRunning is returned when nothing listens on the control socket.
+var ErrMasterNotRunning = errors.New("the master is not running (start it with `beacon start`)")
+
+// Result is the reply to a control request.
+type Result struct {
+	Message string          `json:"message,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// ErrorReply is the body of a failed request.
+type ErrorReply struct {
+	Error string `json:"error"`
+}
+
+// SocketPath returns ~/.beacon/control.sock (or under $BEACON_HOME).
+func SocketPath() (string, error) {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "control.sock"), nil
+}
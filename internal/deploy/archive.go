@@ -0,0 +1,294 @@
+package deploy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// unpackAsset extracts the downloaded asset at src into dir. Archives (.tar.gz, .tgz, .tar,
+// .zip) are unpacked with the first strip leading path components removed; anything else is
+// treated as a single binary and copied to dir/binary. Entries that would land outside dir
+// are rejected; symlinks are created last, so no entry is written through one.
+func unpackAsset(src, assetName, dir string, strip int, binary string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create release directory: %w", err)
+	}
+	name := strings.ToLower(assetName)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", assetName, err)
+		}
+		defer func() { _ = gz.Close() }()
+		return untar(gz, dir, strip)
+	case strings.HasSuffix(name, ".tar"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		return untar(f, dir, strip)
+	case strings.HasSuffix(name, ".zip"):
+		return unzip(src, dir, strip)
+	}
+
+	if binary == "" {
+		binary = assetName
+	}
+	target, err := archiveTarget(dir, binary, 0)
+	if err != nil || target == "" {
+		return fmt.Errorf("invalid binary name %q", binary)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	return writeArchiveFile(dir, target, in, 0755)
+}
+
+// archiveLink is a symlink entry, created after the archive's files and directories.
+type archiveLink struct {
+	target, link string
+}
+
+func untar(r io.Reader, dir string, strip int) error {
+	tr := tar.NewReader(r)
+	var links []archiveLink
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return createArchiveLinks(dir, links)
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue // metadata written by git archive
+		}
+		target, err := archiveTarget(dir, hdr.Name, strip)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := archiveDir(dir, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(dir, target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			links = append(links, archiveLink{target: target, link: hdr.Linkname})
+		default:
+			// Hard links, devices and FIFOs have no place in a release
+			return fmt.Errorf("archive entry %s: unsupported type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func unzip(src, dir string, strip int) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("read archive: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+	var links []archiveLink
+	for _, f := range zr.File {
+		target, err := archiveTarget(dir, f.Name, strip)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := archiveDir(dir, target); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			link, err := io.ReadAll(io.LimitReader(rc, 4096))
+			_ = rc.Close()
+			if err != nil {
+				return err
+			}
+			links = append(links, archiveLink{target: target, link: string(link)})
+		default:
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			perm := mode.Perm()
+			if perm == 0 {
+				perm = 0644
+			}
+			err = writeArchiveFile(dir, target, rc, perm)
+			_ = rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return createArchiveLinks(dir, links)
+}
+
+// archiveTarget maps an archive entry to a path under dir after stripping components. It
+// returns "" for entries removed entirely by strip and an error for entries escaping dir.
+func archiveTarget(dir, name string, strip int) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	for _, p := range strings.Split(name, "/") {
+		if p == ".." {
+			return "", fmt.Errorf("archive entry %q escapes the release directory", name)
+		}
+	}
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "" {
+		return "", nil
+	}
+	parts := strings.Split(clean, "/")
+	if len(parts) <= strip {
+		return "", nil
+	}
+	return filepath.Join(dir, filepath.FromSlash(strings.Join(parts[strip:], "/"))), nil
+}
+
+// createArchiveLinks creates the archive's symlinks once everything else is written, then
+// follows each through the others: a link can stay inside dir on its own and still lead
+// out of it through another (x/l -> .. and a -> x/l/..).
+func createArchiveLinks(dir string, links []archiveLink) error {
+	for _, l := range links {
+		if err := archiveSymlink(dir, l.target, l.link); err != nil {
+			return err
+		}
+	}
+	for _, l := range links {
+		hops := 0
+		if _, err := followArchiveLink(dir, filepath.Dir(l.target), l.link, &hops); err != nil {
+			return fmt.Errorf("archive symlink %s -> %s: %w", l.target, l.link, err)
+		}
+	}
+	return nil
+}
+
+// followArchiveLink resolves link relative to cur the way the OS would, following the
+// symlinks it passes, and returns where it leads. It fails when the path leaves dir.
+func followArchiveLink(dir, cur, link string, hops *int) (string, error) {
+	if filepath.IsAbs(link) {
+		return "", errors.New("escapes the release directory")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(link), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if cur == dir {
+				return "", errors.New("escapes the release directory")
+			}
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, part)
+		if fi, err := os.Lstat(next); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if *hops++; *hops > 40 {
+				return "", errors.New("too many levels of symbolic links")
+			}
+			target, err := os.Readlink(next)
+			if err != nil {
+				return "", err
+			}
+			if next, err = followArchiveLink(dir, cur, target, hops); err != nil {
+				return "", err
+			}
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// checkArchivePath refuses p when it, or a directory between dir and p, is a symlink: the
+// link target check is lexical, so a chain of links could otherwise lead out of dir.
+func checkArchivePath(dir, p string) error {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := dir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil // the rest is created as plain directories
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %s passes through symlink %s", p, cur)
+		}
+	}
+	return nil
+}
+
+func archiveDir(dir, target string) error {
+	if err := checkArchivePath(dir, target); err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// archiveSymlink creates a symlink at target, refusing links that point outside dir.
+func archiveSymlink(dir, target, link string) error {
+	resolved := link
+	if !filepath.IsAbs(link) {
+		resolved = filepath.Join(filepath.Dir(target), link)
+	}
+	rel, err := filepath.Rel(dir, filepath.Clean(resolved))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(link) {
+		return fmt.Errorf("archive symlink %s -> %s escapes the release directory", target, link)
+	}
+	if err := archiveDir(dir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	_ = os.Remove(target)
+	return os.Symlink(link, target)
+}
+
+func writeArchiveFile(dir, target string, r io.Reader, perm os.FileMode) error {
+	if err := archiveDir(dir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	_ = os.Remove(target) // never write through a symlink from an earlier entry
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write %s: %w", target, err)
+	}
+	return f.Close()
+}
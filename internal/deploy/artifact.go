@@ -0,0 +1,791 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/keys"
+	"beacon/internal/state"
+	"beacon/internal/update"
+)
+
+// Artifact projects unpack each release into <local_path>/releases/<tag> and point the
+// <local_path>/current symlink at the active one, so a deploy hook can restart a service
+// that runs from current/ and a failed deploy can switch straight back.
+const (
+	artifactReleasesDir = "releases"
+	artifactCurrentLink = "current"
+
+	artifactAPITimeout      = 30 * time.Second
+	artifactDownloadTimeout = 30 * time.Minute
+)
+
+// artifactRelease is one release offered by the source, with its downloadable assets.
+type artifactRelease struct {
+	Tag        string
+	Prerelease bool
+	Assets     []artifactAsset
+}
+
+type artifactAsset struct {
+	Name string
+	URL  string
+	Size int64 // bytes; 0 when the source does not say
+}
+
+// artifactSource lists releases from GitHub, Gitea/Forgejo or an HTTP index.
+type artifactSource struct {
+	cfg    *config.ArtifactConfig
+	policy config.DeployPolicy
+	token  string
+	client *http.Client
+}
+
+func newArtifactSource(cfg *config.Config) (*artifactSource, error) {
+	if err := cfg.Artifact.Validate(); err != nil {
+		return nil, err
+	}
+	token, err := keys.ResolveValue(cfg.Artifact.Token)
+	if err != nil {
+		return nil, fmt.Errorf("artifact token: %w", err)
+	}
+	return &artifactSource{
+		cfg:    cfg.Artifact,
+		policy: cfg.Policy,
+		token:  token,
+		client: &http.Client{Timeout: artifactAPITimeout},
+	}, nil
+}
+
+// header returns the authorization header for an API or download request to link. The
+// token is only sent to the configured source's host: links found in an HTTP index or a
+// release may point anywhere.
+func (s *artifactSource) header(link string) http.Header {
+	h := http.Header{}
+	if s.token == "" || !s.sourceHost(link) {
+		return h
+	}
+	switch s.cfg.EffectiveSource() {
+	case config.ArtifactSourceGitea:
+		h.Set("Authorization", "token "+s.token)
+	default:
+		h.Set("Authorization", "Bearer "+s.token)
+	}
+	return h
+}
+
+// sourceHost reports whether link is on the host of the configured source (artifact.url,
+// or the GitHub API when unset).
+func (s *artifactSource) sourceHost(link string) bool {
+	source := s.cfg.URL
+	if source == "" && s.cfg.EffectiveSource() == config.ArtifactSourceGitHub {
+		source = "https://api.github.com"
+	}
+	su, err := url.Parse(source)
+	if err != nil || su.Host == "" {
+		return false
+	}
+	lu, err := url.Parse(link)
+	return err == nil && strings.EqualFold(lu.Host, su.Host)
+}
+
+// latest returns the newest release allowed by the deploy policy that has an asset for
+// this host.
+func (s *artifactSource) latest(ctx context.Context) (*artifactRelease, error) {
+	releases, err := s.releases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byTag := make(map[string]*artifactRelease, len(releases))
+	tags := make([]string, 0, len(releases))
+	allowPre := s.policy.AllowsPrerelease()
+	for i := range releases {
+		r := &releases[i]
+		if r.Prerelease && !allowPre {
+			continue
+		}
+		if _, err := s.pickAsset(r); err != nil {
+			continue
+		}
+		byTag[r.Tag] = r
+		tags = append(tags, r.Tag)
+	}
+	tag, err := selectTag(s.policy, tags)
+	if err != nil {
+		return nil, err
+	}
+	if tag == "" {
+		return nil, fmt.Errorf("no release with an asset for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	return byTag[tag], nil
+}
+
+// release returns the release named tag.
+func (s *artifactSource) release(ctx context.Context, tag string) (*artifactRelease, error) {
+	releases, err := s.releases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if releases[i].Tag == tag {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s not found", tag)
+}
+
+// releases lists releases newest first.
+func (s *artifactSource) releases(ctx context.Context) ([]artifactRelease, error) {
+	switch s.cfg.EffectiveSource() {
+	case config.ArtifactSourceHTTP:
+		return s.indexReleases(ctx)
+	case config.ArtifactSourceGitea:
+		return s.apiReleases(ctx, strings.TrimSuffix(s.cfg.URL, "/")+"/api/v1/repos/"+s.cfg.Repo+"/releases?limit=50")
+	}
+	base := "https://api.github.com"
+	if s.cfg.URL != "" {
+		base = strings.TrimSuffix(s.cfg.URL, "/")
+	}
+	return s.apiReleases(ctx, base+"/repos/"+s.cfg.Repo+"/releases?per_page=50")
+}
+
+// apiRelease is the release shape shared by the GitHub and Gitea APIs.
+type apiRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
+		Name               string `json:"name"`
+		Size               int64  `json:"size"`
+		URL                string `json:"url"` // GitHub API URL, needed for private repositories
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (s *artifactSource) apiReleases(ctx context.Context, endpoint string) ([]artifactRelease, error) {
+	body, err := s.get(ctx, endpoint, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var list []apiRelease
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("decode releases: %w", err)
+	}
+	github := s.cfg.EffectiveSource() == config.ArtifactSourceGitHub
+	var out []artifactRelease
+	for _, r := range list {
+		if r.Draft || r.TagName == "" {
+			continue
+		}
+		rel := artifactRelease{Tag: r.TagName, Prerelease: r.Prerelease}
+		for _, a := range r.Assets {
+			link := a.BrowserDownloadURL
+			if github && s.token != "" && a.URL != "" {
+				link = a.URL
+			}
+			rel.Assets = append(rel.Assets, artifactAsset{Name: a.Name, URL: link, Size: a.Size})
+		}
+		out = append(out, rel)
+	}
+	return out, nil
+}
+
+var hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'?#]+)`)
+
+// indexReleases reads a directory listing (HTML autoindex or one file name per line) and
+// groups the files matching the asset pattern by version. Checksum files listed in the
+// index are attached to every release.
+func (s *artifactSource) indexReleases(ctx context.Context) ([]artifactRelease, error) {
+	body, err := s.get(ctx, s.cfg.URL, "")
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("artifact url: %w", err)
+	}
+
+	var links []string
+	if m := hrefPattern.FindAllStringSubmatch(string(body), -1); len(m) > 0 {
+		for _, sub := range m {
+			links = append(links, sub[1])
+		}
+	} else {
+		links = strings.Fields(string(body))
+	}
+
+	pattern := assetPatternRegexp(s.cfg.Asset)
+	releases := make(map[string]*artifactRelease)
+	var shared []artifactAsset
+	for _, link := range links {
+		ref, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		name, err := url.PathUnescape(path.Base(ref.Path))
+		if err != nil || name == "" || name == "." || name == "/" {
+			continue
+		}
+		asset := artifactAsset{Name: name, URL: base.ResolveReference(ref).String()}
+		if m := pattern.FindStringSubmatch(name); m != nil {
+			tag := m[1]
+			if releases[tag] == nil {
+				releases[tag] = &artifactRelease{Tag: tag}
+			}
+			releases[tag].Assets = append(releases[tag].Assets, asset)
+			continue
+		}
+		shared = append(shared, asset)
+	}
+
+	out := make([]artifactRelease, 0, len(releases))
+	for _, r := range releases {
+		v, ok := parseSemver(r.Tag)
+		r.Prerelease = ok && v.isPrerelease()
+		r.Assets = append(r.Assets, shared...)
+		out = append(out, *r)
+	}
+	// An index has no release dates: order by version, newest first
+	sort.Slice(out, func(i, j int) bool {
+		vi, oki := parseSemver(out[i].Tag)
+		vj, okj := parseSemver(out[j].Tag)
+		if oki && okj {
+			return vi.compare(vj) > 0
+		}
+		if oki != okj {
+			return oki
+		}
+		return out[i].Tag > out[j].Tag
+	})
+	return out, nil
+}
+
+// assetPatternRegexp turns an http asset pattern into a regexp capturing {version}.
+func assetPatternRegexp(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\{version\}`, `(v?[0-9][0-9A-Za-z.+_-]*?)`, 1)
+	expr = strings.ReplaceAll(expr, `\{version\}`, `[0-9A-Za-z.+_-]+`)
+	expr = strings.ReplaceAll(expr, `\{os\}`, regexp.QuoteMeta(runtime.GOOS))
+	expr = strings.ReplaceAll(expr, `\{arch\}`, regexp.QuoteMeta(runtime.GOARCH))
+	expr = strings.ReplaceAll(expr, `\*`, `[^/]*`)
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// expandAssetPattern fills in {version}, {os} and {arch} for release tag.
+func expandAssetPattern(pattern, tag string) string {
+	return strings.NewReplacer(
+		"{version}", strings.TrimPrefix(tag, "v"),
+		"{os}", runtime.GOOS,
+		"{arch}", runtime.GOARCH,
+	).Replace(pattern)
+}
+
+// Names used for the host platform in release asset names.
+var (
+	osAliases = map[string][]string{
+		"linux":   {"linux"},
+		"darwin":  {"darwin", "macos", "apple"},
+		"windows": {"windows", "win64", "win32"},
+		"freebsd": {"freebsd"},
+	}
+	archAliases = map[string][]string{
+		"amd64": {"amd64", "x86_64", "x64"},
+		"arm64": {"arm64", "aarch64"},
+		"arm":   {"armv7", "armhf", "armv6", "arm"},
+		"386":   {"386", "i386", "i686"},
+	}
+	// Files published next to assets that are never the asset itself
+	sidecarSuffixes = []string{".sha256", ".sha512", ".sig", ".asc", ".pem", ".sbom", ".json", ".txt", ".md5", ".intoto.jsonl"}
+)
+
+// pickAsset returns the asset to deploy: the one matching the asset pattern, or the one
+// whose name mentions this host's OS and architecture (archives preferred).
+func (s *artifactSource) pickAsset(r *artifactRelease) (artifactAsset, error) {
+	if s.cfg.Asset != "" {
+		if s.cfg.EffectiveSource() == config.ArtifactSourceHTTP {
+			pattern := assetPatternRegexp(s.cfg.Asset)
+			for _, a := range r.Assets {
+				if m := pattern.FindStringSubmatch(a.Name); m != nil && m[1] == r.Tag {
+					return a, nil
+				}
+			}
+		} else {
+			want := expandAssetPattern(s.cfg.Asset, r.Tag)
+			for _, a := range r.Assets {
+				if ok, _ := path.Match(want, a.Name); ok {
+					return a, nil
+				}
+			}
+		}
+		return artifactAsset{}, fmt.Errorf("release %s has no asset matching %q", r.Tag, s.cfg.Asset)
+	}
+
+	var matches []artifactAsset
+	for _, a := range r.Assets {
+		name := strings.ToLower(a.Name)
+		if isSidecar(name) {
+			continue
+		}
+		if containsAny(name, osAliases[runtime.GOOS]) && containsArch(name, runtime.GOARCH) {
+			matches = append(matches, a)
+		}
+	}
+	if len(matches) == 0 {
+		names := make([]string, 0, len(r.Assets))
+		for _, a := range r.Assets {
+			names = append(names, a.Name)
+		}
+		return artifactAsset{}, fmt.Errorf("release %s has no asset for %s/%s (available: %s)", r.Tag, runtime.GOOS, runtime.GOARCH, strings.Join(names, ", "))
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return assetRank(matches[i].Name) < assetRank(matches[j].Name) })
+	return matches[0], nil
+}
+
+func isSidecar(name string) bool {
+	for _, suffix := range sidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(name string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsArch matches the architecture as a whole word, so "arm" does not match "arm64"
+// and "386" does not match "x86_64".
+func containsArch(name, arch string) bool {
+	for _, alias := range archAliases[arch] {
+		re := regexp.MustCompile(`(^|[^a-z0-9])` + regexp.QuoteMeta(alias) + `($|[^a-z0-9])`)
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// assetRank orders candidate assets: tarballs, zips, then bare binaries.
+func assetRank(name string) int {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return 0
+	case strings.HasSuffix(name, ".zip"):
+		return 1
+	case strings.HasSuffix(name, ".tar"):
+		return 2
+	case strings.HasSuffix(name, ".deb"), strings.HasSuffix(name, ".rpm"), strings.HasSuffix(name, ".apk"):
+		return 4
+	}
+	return 3
+}
+
+// checksumURL finds the checksum file for asset: the configured one, <asset>.sha256, or a
+// SHA256SUMS / checksums.txt style file. It returns "" when the release has none.
+func (s *artifactSource) checksumURL(r *artifactRelease, asset artifactAsset) string {
+	byName := make(map[string]string, len(r.Assets))
+	for _, a := range r.Assets {
+		byName[a.Name] = a.URL
+	}
+	if s.cfg.Checksums != "" {
+		return byName[expandAssetPattern(s.cfg.Checksums, r.Tag)]
+	}
+	for _, name := range []string{asset.Name + ".sha256", "SHA256SUMS", "SHA256SUMS.txt", "sha256sums.txt", "checksums.txt"} {
+		if u, ok := byName[name]; ok {
+			return u
+		}
+	}
+	for _, a := range r.Assets {
+		lower := strings.ToLower(a.Name)
+		if strings.HasSuffix(lower, "checksums.txt") || strings.HasSuffix(lower, "sha256sums.txt") {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// get fetches an API or index URL.
+func (s *artifactSource) get(ctx context.Context, link, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = s.header(link)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch releases: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read releases: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP %d", redactURL(link), resp.StatusCode)
+	}
+	return body, nil
+}
+
+// download streams asset to a temporary file in the project state directory and returns
+// its path, size and SHA-256.
+func (s *artifactSource) download(ctx context.Context, cfg *config.Config, asset artifactAsset) (string, int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return "", 0, "", err
+	}
+	req.Header = s.header(asset.URL)
+	req.Header.Set("Accept", "application/octet-stream")
+	client := &http.Client{Timeout: artifactDownloadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("download %s: %w", asset.Name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, "", fmt.Errorf("download %s: HTTP %d", asset.Name, resp.StatusCode)
+	}
+
+	dir := projectStateDir(cfg)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, "", err
+	}
+	f, err := os.CreateTemp(dir, "artifact-*")
+	if err != nil {
+		return "", 0, "", fmt.Errorf("create download file: %w", err)
+	}
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hasher), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", 0, "", fmt.Errorf("download %s: %w", asset.Name, err)
+	}
+	if n == 0 {
+		_ = os.Remove(f.Name())
+		return "", 0, "", fmt.Errorf("download %s: empty file", asset.Name)
+	}
+	return f.Name(), n, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// redactURL drops credentials and query strings from a URL for error messages.
+func redactURL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
+
+// CheckForNewArtifact deploys the newest release allowed by the deploy policy when it
+// differs from the deployed one (or nothing is deployed yet).
+func CheckForNewArtifact(cfg *config.Config, status *state.Status, trigger string) {
+	src, err := newArtifactSource(cfg)
+	if err != nil {
+		logger.Infof("Artifact configuration error: %v\n", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), artifactAPITimeout)
+	defer cancel()
+	latest, err := src.latest(ctx)
+	if err != nil {
+		logger.Infof("Error checking for new release: %v\n", err)
+		return
+	}
+
+	lastTag, _ := status.Get()
+	if latest.Tag == lastTag && currentArtifactRelease(cfg) != "" {
+		return
+	}
+	if recentlyRefused(cfg, "", latest.Tag, "") || holdRelease(cfg, trigger, "", latest.Tag, "") {
+		return
+	}
+	logger.Infof("New release found: %s (prev: %s)\n", latest.Tag, lastTag)
+	if err := DeployArtifact(cfg, latest.Tag, status, trigger); err != nil {
+		logger.Infof("Error deploying: %v\n", err)
+	}
+}
+
+// DeployArtifact downloads the asset of release tag (the newest allowed release when empty)
+// for this host, verifies its checksum, unpacks it into a release directory, switches the
+// current symlink to it and runs the deploy pipeline in it. If the pipeline fails, current
+// is pointed back at the previous release.
+// Callers must hold the project's deploy lock (see TryLock and Acquire).
+func DeployArtifact(cfg *config.Config, tag string, status *state.Status, trigger string) (err error) {
+	run := startDeployRun(cfg, trigger, tag, status)
+	defer func() { run.finish(err) }()
+
+	src, err := newArtifactSource(cfg)
+	if err != nil {
+		return err
+	}
+
+	run.setStage("fetch")
+	var rel *artifactRelease
+	if tag == "" {
+		rel, err = src.latest(run.ctx)
+	} else {
+		rel, err = src.release(run.ctx, tag)
+	}
+	if err != nil {
+		return err
+	}
+	run.rec.Tag = rel.Tag
+	asset, err := src.pickAsset(rel)
+	if err != nil {
+		return err
+	}
+	run.rec.Asset = asset.Name
+	logger.Infof("Deploying release %s (%s)...\n", rel.Tag, asset.Name)
+
+	start := time.Now()
+	file, size, sum, err := src.download(run.ctx, cfg, asset)
+	if err != nil {
+		if cerr := run.canceled(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	defer func() { _ = os.Remove(file) }()
+	run.rec.FetchBytes = size
+	run.rec.FetchDurationMs = time.Since(start).Milliseconds()
+	run.rec.Digest = "sha256:" + sum
+	run.target = run.rec.Digest
+
+	run.setStage("verify")
+	if err := src.verifyChecksum(run.ctx, rel, asset, sum); err != nil {
+		return err
+	}
+
+	run.setStage("unpack")
+	releaseDir, err := unpackRelease(cfg, rel.Tag, file, asset.Name)
+	if err != nil {
+		return err
+	}
+	if err := run.canceled(); err != nil {
+		return err
+	}
+
+	previous := currentArtifactRelease(cfg)
+	activated := false
+	pipeline := &pipelineRun{
+		cfg:           cfg,
+		run:           run,
+		dir:           releaseDir,
+		switchCommand: cfg.DeployCommand,
+		env: []string{
+			"BEACON_RELEASE_DIR=" + releaseDir,
+			"BEACON_CURRENT_DIR=" + filepath.Join(cfg.LocalPath, artifactCurrentLink),
+			"BEACON_ARTIFACT_ASSET=" + asset.Name,
+			"BEACON_ARTIFACT_SHA256=" + sum,
+		},
+		// current/ flips right before the switch stage, after pre_deploy and build
+		beforeSwitch: func() error {
+			run.setStage("activate")
+			if err := activateArtifactRelease(cfg, releaseDir); err != nil {
+				return err
+			}
+			activated = true
+			return nil
+		},
+	}
+	if err := pipeline.execute(); err != nil {
+		if activated {
+			rollbackArtifactRelease(cfg, previous)
+		}
+		logger.Infof("Deploy pipeline failed: %v\n", err)
+		return err
+	}
+
+	status.SetWithDigest(rel.Tag, run.rec.Digest, time.Now())
+	pruneArtifactReleases(cfg, releaseDir)
+	logger.Infof("Deployment of release %s complete.\n", rel.Tag)
+	return nil
+}
+
+// verifyChecksum compares sum with the release's checksum file. Without a checksum file
+// the asset is accepted unless artifact.require_checksum is set.
+func (s *artifactSource) verifyChecksum(ctx context.Context, r *artifactRelease, asset artifactAsset, sum string) error {
+	link := s.checksumURL(r, asset)
+	if link == "" {
+		if s.cfg.RequireChecksum {
+			return fmt.Errorf("%w: release %s has no checksum file for %s (require_checksum is set)", errChecksumRefused, r.Tag, asset.Name)
+		}
+		logger.Infof("Warning: release %s publishes no checksum for %s; skipping verification\n", r.Tag, asset.Name)
+		return nil
+	}
+	expected, err := update.FetchExpectedHash(ctx, link, asset.Name, s.header(link))
+	if err != nil {
+		return fmt.Errorf("fetch checksums: %w", err)
+	}
+	if expected != sum {
+		return fmt.Errorf("%w: checksum mismatch for %s: expected %s, got %s", errChecksumRefused, asset.Name, expected, sum)
+	}
+	logger.Infof("Checksum verified: %s\n", shortDigest(sum))
+	return nil
+}
+
+// unpackRelease extracts the asset into <local_path>/releases/<tag>, replacing an earlier
+// unpack of the same release (see releaseDir for redeploys of the active one). It returns
+// the release directory.
+func unpackRelease(cfg *config.Config, tag, file, assetName string) (string, error) {
+	releases := filepath.Join(cfg.LocalPath, artifactReleasesDir)
+	if err := os.MkdirAll(releases, 0755); err != nil {
+		return "", fmt.Errorf("create releases directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(releases, "."+releaseDirName(tag)+"-")
+	if err != nil {
+		return "", fmt.Errorf("create staging directory: %w", err)
+	}
+	if err := unpackAsset(file, assetName, staging, cfg.Artifact.StripComponents, cfg.Artifact.Binary); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("unpack %s: %w", assetName, err)
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", err
+	}
+
+	dir := releaseDir(cfg, tag)
+	if err := os.RemoveAll(dir); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("remove old release directory: %w", err)
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("move release into place: %w", err)
+	}
+	return dir, nil
+}
+
+// releaseDir returns the directory tag unpacks into. Redeploying the active release uses
+// <tag>~ (and back again the next time), so current/ never points at a half-replaced tree.
+func releaseDir(cfg *config.Config, tag string) string {
+	dir := filepath.Join(cfg.LocalPath, artifactReleasesDir, releaseDirName(tag))
+	if currentArtifactRelease(cfg) == dir {
+		dir += "~"
+	}
+	return dir
+}
+
+// releaseDirName makes a tag safe to use as a directory name. '~' is reserved for releaseDir.
+func releaseDirName(tag string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", ":", "_", "~", "_").Replace(tag)
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	return name
+}
+
+// currentArtifactRelease returns the release directory current/ points at, or "".
+func currentArtifactRelease(cfg *config.Config) string {
+	link := filepath.Join(cfg.LocalPath, artifactCurrentLink)
+	target, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(cfg.LocalPath, target)
+	}
+	if _, err := os.Stat(target); err != nil {
+		return ""
+	}
+	return filepath.Clean(target)
+}
+
+// activateArtifactRelease atomically points current/ at releaseDir.
+func activateArtifactRelease(cfg *config.Config, releaseDir string) error {
+	rel, err := filepath.Rel(cfg.LocalPath, releaseDir)
+	if err != nil {
+		return err
+	}
+	link := filepath.Join(cfg.LocalPath, artifactCurrentLink)
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(rel, tmp); err != nil {
+		return fmt.Errorf("create current link: %w", err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("switch current link: %w", err)
+	}
+	logger.Infof("Activated %s\n", rel)
+	return nil
+}
+
+// rollbackArtifactRelease points current/ back at previous (removes it when there was none).
+func rollbackArtifactRelease(cfg *config.Config, previous string) {
+	if previous == "" {
+		_ = os.Remove(filepath.Join(cfg.LocalPath, artifactCurrentLink))
+		return
+	}
+	if err := activateArtifactRelease(cfg, previous); err != nil {
+		logger.Infof("Failed to roll back current release: %v\n", err)
+		return
+	}
+	logger.Infof("Rolled back to %s\n", filepath.Base(previous))
+}
+
+// pruneArtifactReleases keeps the newest artifact.keep release directories (by modification
+// time) and never removes the active one.
+func pruneArtifactReleases(cfg *config.Config, active string) {
+	releases := filepath.Join(cfg.LocalPath, artifactReleasesDir)
+	entries, err := os.ReadDir(releases)
+	if err != nil {
+		return
+	}
+	type dirInfo struct {
+		path string
+		mod  time.Time
+	}
+	var dirs []dirInfo
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, dirInfo{filepath.Join(releases, e.Name()), info.ModTime()})
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].mod.After(dirs[j].mod) })
+	keep := cfg.Artifact.EffectiveKeep()
+	for i, d := range dirs {
+		if i < keep || d.path == active {
+			continue
+		}
+		logger.Infof("Removing old release %s\n", filepath.Base(d.path))
+		if err := os.RemoveAll(d.path); err != nil {
+			logger.Infof("Failed to remove %s: %v\n", d.path, err)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package deploy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+// tarball builds a .tar.gz holding files under a top-level directory, like most release archives.
+func tarball(t *testing.T, top string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		hdr := &tar.Header{Name: top + "/" + name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// releaseServer fakes the GitHub releases API for acme/tool. Each version gets a tarball for
+// this host, one for another platform and a checksums.txt (corrupted when badSum is set).
+type releaseServer struct {
+	*httptest.Server
+	files map[string][]byte
+}
+
+func newReleaseServer(t *testing.T, versions []string, badSum bool) *releaseServer {
+	t.Helper()
+	rs := &releaseServer{files: make(map[string][]byte)}
+	mux := http.NewServeMux()
+	rs.Server = httptest.NewServer(mux)
+	t.Cleanup(rs.Close)
+
+	var releases []string
+	for _, v := range versions {
+		asset := fmt.Sprintf("tool_%s_%s_%s.tar.gz", strings.TrimPrefix(v, "v"), runtime.GOOS, runtime.GOARCH)
+		other := fmt.Sprintf("tool_%s_plan9_mips.tar.gz", strings.TrimPrefix(v, "v"))
+		data := tarball(t, "tool", map[string]string{"tool": "#!/bin/sh\necho " + v + "\n"})
+		sum := sha256Hex(data)
+		if badSum {
+			sum = strings.Repeat("0", 64)
+		}
+		rs.files[v+"/"+asset] = data
+		rs.files[v+"/"+other] = []byte("other platform")
+		rs.files[v+"/checksums.txt"] = []byte(sum + "  " + asset + "\n")
+
+		var assets []string
+		for _, name := range []string{other, asset, "checksums.txt"} {
+			assets = append(assets, fmt.Sprintf(`{"name":%q,"browser_download_url":"%s/download/%s/%s"}`, name, rs.URL, v, name))
+		}
+		releases = append(releases, fmt.Sprintf(`{"tag_name":%q,"assets":[%s]}`, v, strings.Join(assets, ",")))
+	}
+
+	mux.HandleFunc("/repos/acme/tool/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "[%s]", strings.Join(releases, ","))
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := rs.files[strings.TrimPrefix(r.URL.Path, "/download/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	})
+	return rs
+}
+
+func newArtifactTestConfig(t *testing.T, srvURL string) *config.Config {
+	t.Helper()
+	cfg := newTestConfig(t, "tool")
+	cfg.DeploymentType = "artifact"
+	cfg.Artifact = &config.ArtifactConfig{Source: config.ArtifactSourceGitHub, URL: srvURL, Repo: "acme/tool", StripComponents: 1}
+	return cfg
+}
+
+func currentTool(t *testing.T, cfg *config.Config) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(cfg.LocalPath, "current", "tool"))
+	if err != nil {
+		t.Fatalf("read current/tool: %v", err)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(data), "#!/bin/sh\necho "))
+}
+
+func TestDeployArtifact_LatestRelease(t *testing.T) {
+	rs := newReleaseServer(t, []string{"v1.1.0", "v1.0.0"}, false)
+	cfg := newArtifactTestConfig(t, rs.URL)
+	hookOut := filepath.Join(t.TempDir(), "hook")
+	// current/ is already switched when the deploy hook runs
+	cfg.DeployCommand = `echo "$BEACON_RELEASE_DIR $BEACON_ARTIFACT_ASSET" > ` + hookOut + ` && test -x "$BEACON_CURRENT_DIR/tool"`
+	status := state.NewStatus(t.TempDir())
+
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+
+	if got := currentTool(t, cfg); got != "v1.1.0" {
+		t.Fatalf("current release = %q, want v1.1.0", got)
+	}
+	hook, err := os.ReadFile(hookOut)
+	wantDir := filepath.Join(cfg.LocalPath, "releases", "v1.1.0")
+	if err != nil || !strings.Contains(string(hook), wantDir+" tool_1.1.0_"+runtime.GOOS) {
+		t.Errorf("deploy hook saw %q, %v", hook, err)
+	}
+	if tag, _ := status.Get(); tag != "v1.1.0" {
+		t.Errorf("status tag = %q", tag)
+	}
+
+	last, _ := ProjectHistory(cfg).Last()
+	if last == nil || !last.Success || last.Type != "artifact" || !strings.HasPrefix(last.Digest, "sha256:") || last.FetchBytes == 0 {
+		t.Errorf("history record = %+v", last)
+	}
+
+	// Nothing new: the poll does not redeploy
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+	if records, _ := ProjectHistory(cfg).List(0); len(records) != 1 {
+		t.Errorf("history has %d records, want 1", len(records))
+	}
+}
+
+func TestDeployArtifact_ChecksumMismatch(t *testing.T) {
+	rs := newReleaseServer(t, []string{"v1.0.0"}, true)
+	cfg := newArtifactTestConfig(t, rs.URL)
+	t.Cleanup(func() {
+		refusals.Lock()
+		delete(refusals.m, releaseKey(cfg, "", "v1.0.0"))
+		refusals.Unlock()
+	})
+
+	err := DeployArtifact(cfg, "v1.0.0", state.NewStatus(t.TempDir()), state.TriggerManual)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("err = %v, want checksum mismatch", err)
+	}
+	if _, err := os.Lstat(filepath.Join(cfg.LocalPath, "current")); !os.IsNotExist(err) {
+		t.Error("current link created for a corrupt download")
+	}
+	// The poll loop backs off from the refused release like from an unsigned one
+	if last, _ := ProjectHistory(cfg).Last(); last == nil || !last.Refused {
+		t.Errorf("history record = %+v, want refused", last)
+	}
+	if !recentlyRefused(cfg, "", "v1.0.0", "") {
+		t.Error("refused release is retried on the next poll")
+	}
+}
+
+func TestDeployArtifact_RollsBackOnFailedHook(t *testing.T) {
+	rs := newReleaseServer(t, []string{"v2.0.0", "v1.0.0"}, false)
+	cfg := newArtifactTestConfig(t, rs.URL)
+	status := state.NewStatus(t.TempDir())
+
+	if err := DeployArtifact(cfg, "v1.0.0", status, state.TriggerManual); err != nil {
+		t.Fatalf("deploy v1.0.0: %v", err)
+	}
+	cfg.DeployCommand = "exit 4"
+	if err := DeployArtifact(cfg, "v2.0.0", status, state.TriggerManual); err == nil {
+		t.Fatal("deploy with failing hook succeeded")
+	}
+	if got := currentTool(t, cfg); got != "v1.0.0" {
+		t.Errorf("current release after rollback = %q, want v1.0.0", got)
+	}
+	if tag, _ := status.Get(); tag != "v1.0.0" {
+		t.Errorf("status tag = %q", tag)
+	}
+}
+
+func TestDeployArtifact_RedeployKeepsCurrentIntact(t *testing.T) {
+	rs := newReleaseServer(t, []string{"v1.0.0"}, false)
+	cfg := newArtifactTestConfig(t, rs.URL)
+	status := state.NewStatus(t.TempDir())
+
+	if err := DeployArtifact(cfg, "v1.0.0", status, state.TriggerManual); err != nil {
+		t.Fatalf("deploy v1.0.0: %v", err)
+	}
+	// The redeploy unpacks beside the active release; current/ stays whole until activation
+	cfg.Pipeline = &config.DeployPipeline{PreDeploy: &config.PipelineStage{Command: `test -x "$BEACON_CURRENT_DIR/tool"`}}
+	cfg.DeployCommand = "exit 4"
+	if err := DeployArtifact(cfg, "v1.0.0", status, state.TriggerManual); err == nil || strings.Contains(err.Error(), "pre_deploy") {
+		t.Fatalf("err = %v, want the switch to fail", err)
+	}
+	if got := currentArtifactRelease(cfg); got != filepath.Join(cfg.LocalPath, "releases", "v1.0.0") {
+		t.Errorf("current release after rollback = %q", got)
+	}
+
+	cfg.DeployCommand = ""
+	if err := DeployArtifact(cfg, "v1.0.0", status, state.TriggerManual); err != nil {
+		t.Fatalf("redeploy v1.0.0: %v", err)
+	}
+	if got := currentArtifactRelease(cfg); got != filepath.Join(cfg.LocalPath, "releases", "v1.0.0~") {
+		t.Errorf("current release after redeploy = %q", got)
+	}
+	if got := currentTool(t, cfg); got != "v1.0.0" {
+		t.Errorf("current tool = %q", got)
+	}
+}
+
+func TestArtifactSource_HTTPIndex(t *testing.T) {
+	data := tarball(t, "site", map[string]string{"index.html": "hello"})
+	files := map[string][]byte{
+		"site-1.9.0.tar.gz":         []byte("old"),
+		"site-1.10.0.tar.gz":        data,
+		"site-1.10.0.tar.gz.sha256": []byte(sha256Hex(data) + "\n"),
+		"site-2.0.0-rc.1.tar.gz":    []byte("pre-release"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/releases/" {
+			fmt.Fprint(w, `<html><body><a href="../">../</a>`)
+			for name := range files {
+				fmt.Fprintf(w, `<a href="%s">%s</a>`, name, name)
+			}
+			fmt.Fprint(w, `</body></html>`)
+			return
+		}
+		if d, ok := files[strings.TrimPrefix(r.URL.Path, "/releases/")]; ok {
+			_, _ = w.Write(d)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	cfg := newArtifactTestConfig(t, "")
+	cfg.Artifact = &config.ArtifactConfig{Source: config.ArtifactSourceHTTP, URL: srv.URL + "/releases/", Asset: "site-{version}.tar.gz", StripComponents: 1}
+	cfg.Policy = config.DeployPolicy{Version: ">=1.0"}
+	status := state.NewStatus(t.TempDir())
+
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+	if tag, _ := status.Get(); tag != "1.10.0" {
+		t.Fatalf("deployed %q, want 1.10.0 (semver order, no pre-releases)", tag)
+	}
+	if b, err := os.ReadFile(filepath.Join(cfg.LocalPath, "current", "index.html")); err != nil || string(b) != "hello" {
+		t.Errorf("current/index.html = %q, %v", b, err)
+	}
+}
+
+func TestArtifactSource_TokenOnlySentToSource(t *testing.T) {
+	data := tarball(t, "site", map[string]string{"index.html": "hello"})
+	var leaked string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization")
+		_, _ = w.Write(data)
+	}))
+	defer mirror.Close()
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get("Authorization")
+		fmt.Fprintf(w, `<a href="%s/site-1.0.0.tar.gz">site-1.0.0.tar.gz</a>`, mirror.URL)
+	}))
+	defer srv.Close()
+
+	cfg := newArtifactTestConfig(t, "")
+	cfg.Artifact = &config.ArtifactConfig{Source: config.ArtifactSourceHTTP, URL: srv.URL + "/releases/", Asset: "site-{version}.tar.gz", StripComponents: 1, Token: "secret"}
+	if err := DeployArtifact(cfg, "", state.NewStatus(t.TempDir()), state.TriggerCLI); err != nil {
+		t.Fatalf("DeployArtifact: %v", err)
+	}
+	if sent != "Bearer secret" {
+		t.Errorf("index request Authorization = %q, want the token", sent)
+	}
+	if leaked != "" {
+		t.Errorf("token sent to another host: %q", leaked)
+	}
+}
+
+func TestPickAsset_MatchesHostPlatform(t *testing.T) {
+	src := &artifactSource{cfg: &config.ArtifactConfig{}}
+	rel := &artifactRelease{Tag: "v1.0.0", Assets: []artifactAsset{
+		{Name: "tool_1.0.0_checksums.txt"},
+		{Name: fmt.Sprintf("tool_1.0.0_%s_%s.tar.gz.sig", runtime.GOOS, runtime.GOARCH)},
+		{Name: fmt.Sprintf("tool-%s-%s", runtime.GOOS, runtime.GOARCH)},
+		{Name: fmt.Sprintf("tool_1.0.0_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)},
+	}}
+	asset, err := src.pickAsset(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("tool_1.0.0_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH); asset.Name != want {
+		t.Errorf("picked %s, want %s", asset.Name, want)
+	}
+
+	src.cfg.Asset = "tool-{os}-{arch}"
+	if asset, err := src.pickAsset(rel); err != nil || asset.Name != fmt.Sprintf("tool-%s-%s", runtime.GOOS, runtime.GOARCH) {
+		t.Errorf("pattern picked %v, %v", asset, err)
+	}
+}
+
+func TestUnpackAsset_RejectsEscapingEntries(t *testing.T) {
+	for name, hdr := range map[string]*tar.Header{
+		"parent":  {Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644},
+		"symlink": {Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			src := filepath.Join(t.TempDir(), "evil.tar")
+			writeFile(t, src, buf.String())
+			dir := filepath.Join(t.TempDir(), "release")
+			if err := unpackAsset(src, "evil.tar", dir, 0, ""); err == nil || !strings.Contains(err.Error(), "escapes") {
+				t.Errorf("err = %v, want escape rejected", err)
+			}
+		})
+	}
+}
+
+func TestUnpackAsset_RejectsChainedSymlinks(t *testing.T) {
+	// Each link stays inside the release lexically, but a/b/c resolves through a/b
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "a/b/c", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "a/b/c/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 3},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			_, _ = tw.Write([]byte("bad"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	base := t.TempDir()
+	src := filepath.Join(t.TempDir(), "evil.tar")
+	writeFile(t, src, buf.String())
+	dir := filepath.Join(base, "release")
+
+	if err := unpackAsset(src, "evil.tar", dir, 0, ""); err == nil {
+		t.Error("chained symlinks accepted")
+	}
+	err := filepath.Walk(base, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Name() == "pwned" && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			t.Errorf("file written outside the release directory: %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(base, "pwned")); err == nil {
+		t.Error("pwned written next to the release directory")
+	}
+}
+
+func TestUnpackAsset_RejectsLinksLeadingOutThroughLinks(t *testing.T) {
+	// x/l -> .. is the release directory itself; a -> x/l/.. is its parent
+	for _, order := range [][]*tar.Header{
+		{{Name: "x/l", Typeflag: tar.TypeSymlink, Linkname: ".."}, {Name: "a", Typeflag: tar.TypeSymlink, Linkname: "x/l/.."}},
+		{{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "x/l/.."}, {Name: "x/l", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+	} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range append([]*tar.Header{{Name: "x/", Typeflag: tar.TypeDir, Mode: 0755}}, order...) {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(t.TempDir(), "evil.tar")
+		writeFile(t, src, buf.String())
+
+		err := unpackAsset(src, "evil.tar", filepath.Join(t.TempDir(), "release"), 0, "")
+		if err == nil || !strings.Contains(err.Error(), "escapes") {
+			t.Errorf("%s first: err = %v, want an escape", order[0].Name, err)
+		}
+	}
+}
+
+func TestUnpackAsset_KeepsInternalSymlinks(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "bin/current", Typeflag: tar.TypeSymlink, Linkname: "tool-1.0"},
+		{Name: "bin/tool-1.0", Typeflag: tar.TypeReg, Mode: 0755, Size: 2},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			_, _ = tw.Write([]byte("ok"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "tool.tar")
+	writeFile(t, src, buf.String())
+	dir := filepath.Join(t.TempDir(), "release")
+
+	if err := unpackAsset(src, "tool.tar", dir, 0, ""); err != nil {
+		t.Fatalf("unpackAsset: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "bin", "current")); err != nil || string(data) != "ok" {
+		t.Errorf("bin/current = %q, %v", data, err)
+	}
+}
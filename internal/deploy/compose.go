@@ -0,0 +1,512 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/container"
+	"beacon/internal/state"
+	"beacon/internal/util"
+)
+
+// composeQueryTimeout bounds read-only compose calls (config, ps) made from health loops.
+const composeQueryTimeout = 15 * time.Second
+
+// ComposeStack runs `docker compose` for a project's declared stack.
+type ComposeStack struct {
+	cfg     config.ComposeConfig
+	project string // compose project name (-p)
+	dir     string // project directory; relative paths resolve against it
+	// container selects docker or podman; the zero value auto-detects
+	container config.ContainerConfig
+}
+
+// ComposeService is one container of the stack as reported by `docker compose ps`.
+type ComposeService struct {
+	Name     string `json:"Name"`
+	Service  string `json:"Service"`
+	Image    string `json:"Image"`
+	State    string `json:"State"`  // "running", "exited", "restarting", ...
+	Health   string `json:"Health"` // "healthy", "unhealthy", "starting" or "" without a healthcheck
+	ExitCode int    `json:"ExitCode"`
+	Status   string `json:"Status"` // human readable, e.g. "Up 5 minutes (healthy)"
+}
+
+// Healthy reports whether the container is running and not failing its healthcheck.
+func (s ComposeService) Healthy() bool {
+	return s.State == "running" && s.Health != "unhealthy"
+}
+
+// NewComposeStack creates a stack for cc rooted at dir. projectName is used as the compose
+// project name unless cc sets one.
+func NewComposeStack(cc *config.ComposeConfig, projectName, dir string) *ComposeStack {
+	s := &ComposeStack{dir: dir}
+	if cc != nil {
+		s.cfg = *cc
+	}
+	s.project = s.cfg.ProjectName
+	if s.project == "" {
+		s.project = composeProjectName(projectName)
+	}
+	return s
+}
+
+// composeStack returns the compose stack of cfg's project, run with its container runtime.
+func composeStack(cfg *config.Config) *ComposeStack {
+	s := NewComposeStack(cfg.Compose, cfg.ProjectName, cfg.LocalPath)
+	s.container = cfg.Container
+	return s
+}
+
+// ProjectContainerConfig returns the container runtime settings of the project whose config
+// lives in projectConfigDir: BEACON_CONTAINER_* from the process environment, overridden by
+// the project env file, overridden by container: in deploy.yml.
+func ProjectContainerConfig(projectConfigDir string) config.ContainerConfig {
+	cc := config.ContainerFromEnv(os.Getenv)
+	if env, err := util.ParseEnvFile(filepath.Join(projectConfigDir, "env")); err == nil {
+		fromFile := config.ContainerFromEnv(func(k string) string { return env[k] })
+		cc = cc.Override(&fromFile)
+	}
+	if dc, err := config.LoadDeployFileConfig(filepath.Join(projectConfigDir, "deploy.yml")); err == nil {
+		cc = cc.Override(dc.Container)
+	}
+	return cc
+}
+
+// ComposeStackForProject returns the compose stack of the project whose config lives in
+// projectConfigDir (env file + deploy.yml), or nil if it is not a compose project and its
+// lifecycle adapter is not compose either.
+// Used by the child agent, which does not load the project env into its own environment.
+func ComposeStackForProject(projectConfigDir, projectName string) (*ComposeStack, error) {
+	env, err := util.ParseEnvFile(filepath.Join(projectConfigDir, "env"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	dc, err := config.LoadDeployFileConfig(filepath.Join(projectConfigDir, "deploy.yml"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var cc *config.ComposeConfig
+	var lc *config.LifecycleConfig
+	if dc != nil {
+		cc, lc = dc.Compose, dc.Lifecycle
+	}
+	// Other deployment types may still run under compose (lifecycle adapter "compose")
+	if env["BEACON_DEPLOYMENT_TYPE"] != "compose" && lc.EffectiveAdapter("") != config.LifecycleCompose {
+		return nil, nil
+	}
+	if name := env["BEACON_PROJECT_NAME"]; name != "" {
+		projectName = name
+	}
+	s := NewComposeStack(cc, projectName, env["BEACON_LOCAL_PATH"])
+	s.container = ProjectContainerConfig(projectConfigDir)
+	return s, nil
+}
+
+// ProjectName returns the compose project name.
+func (s *ComposeStack) ProjectName() string {
+	return s.project
+}
+
+// baseArgs returns the global `docker compose` flags for the stack.
+func (s *ComposeStack) baseArgs() []string {
+	args := []string{"compose", "--project-name", s.project}
+	if s.dir != "" {
+		args = append(args, "--project-directory", s.dir)
+	}
+	for _, f := range s.cfg.Files {
+		args = append(args, "-f", s.resolve(f))
+	}
+	for _, p := range s.cfg.Profiles {
+		args = append(args, "--profile", p)
+	}
+	for _, e := range s.cfg.EnvFiles {
+		args = append(args, "--env-file", s.resolve(e))
+	}
+	return args
+}
+
+func (s *ComposeStack) resolve(path string) string {
+	if filepath.IsAbs(path) || s.dir == "" {
+		return path
+	}
+	return filepath.Join(s.dir, path)
+}
+
+// runtime returns the stack's container runtime, or nil when none could be detected (the
+// docker CLI is then run and reports the problem itself).
+func (s *ComposeStack) runtime() *container.Runtime {
+	rt, err := container.Detect(s.container)
+	if err != nil {
+		logger.Infof("%v\n", err)
+		return nil
+	}
+	return rt
+}
+
+// command builds `docker compose <flags> args...` (or `podman compose`) running in the
+// project directory.
+func (s *ComposeStack) command(ctx context.Context, args ...string) *exec.Cmd {
+	args = append(s.baseArgs(), args...)
+	var cmd *exec.Cmd
+	if rt := s.runtime(); rt != nil {
+		cmd = rt.Command(ctx, args...)
+	} else {
+		cmd = exec.CommandContext(ctx, config.RuntimeDocker, args...)
+	}
+	cmd.Dir = s.dir
+	return cmd
+}
+
+// env returns the environment for a compose command that runs with env (a pipeline
+// stage's environment) instead of the process environment.
+func (s *ComposeStack) env(env []string) []string {
+	if rt := s.runtime(); rt != nil {
+		return append(env, rt.Env()...)
+	}
+	return env
+}
+
+// Images returns the registry images of the stack's (enabled) services. Services with a
+// build: section are left out: `pull --ignore-buildable` skips them and there is no registry
+// digest or signature to check for an image built on this host.
+func (s *ComposeStack) Images(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, composeQueryTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := s.command(ctx, "config", "--format", "json")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("compose config: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseComposeImages(out)
+}
+
+// parseComposeImages returns the distinct images of the services in `docker compose config
+// --format json` output that are pulled rather than built, in service name order.
+func parseComposeImages(data []byte) ([]string, error) {
+	var project struct {
+		Services map[string]struct {
+			Image string          `json:"image"`
+			Build json.RawMessage `json:"build"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("parse compose config: %w", err)
+	}
+	names := make([]string, 0, len(project.Services))
+	for name := range project.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seen := make(map[string]bool)
+	var images []string
+	for _, name := range names {
+		svc := project.Services[name]
+		if svc.Image == "" || len(svc.Build) > 0 || seen[svc.Image] {
+			continue
+		}
+		seen[svc.Image] = true
+		images = append(images, svc.Image)
+	}
+	return images, nil
+}
+
+// Services returns the state of every container in the stack, including stopped ones.
+func (s *ComposeStack) Services(ctx context.Context) ([]ComposeService, error) {
+	ctx, cancel := context.WithTimeout(ctx, composeQueryTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := s.command(ctx, "ps", "--all", "--format", "json")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("compose ps: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseComposePS(out)
+}
+
+// Restart restarts the given services, or the whole stack when none are given.
+func (s *ComposeStack) Restart(ctx context.Context, services ...string) (string, error) {
+	return s.run(ctx, append([]string{"restart"}, services...)...)
+}
+
+// Stop stops the given services, or the whole stack when none are given.
+func (s *ComposeStack) Stop(ctx context.Context, services ...string) (string, error) {
+	return s.run(ctx, append([]string{"stop"}, services...)...)
+}
+
+// Start starts the stopped containers of the given services, or of the whole stack.
+func (s *ComposeStack) Start(ctx context.Context, services ...string) (string, error) {
+	return s.run(ctx, append([]string{"start"}, services...)...)
+}
+
+func (s *ComposeStack) run(ctx context.Context, args ...string) (string, error) {
+	out, err := s.command(ctx, args...).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("compose %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// parseComposePS parses `docker compose ps --format json`, which is a JSON array in older
+// Compose v2 releases and one JSON object per line in newer ones.
+func parseComposePS(data []byte) ([]ComposeService, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var services []ComposeService
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &services); err != nil {
+			return nil, fmt.Errorf("parse compose ps: %w", err)
+		}
+		return services, nil
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var svc ComposeService
+		if err := json.Unmarshal(line, &svc); err != nil {
+			return nil, fmt.Errorf("parse compose ps: %w", err)
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// composeProjectName lowercases name and replaces characters compose does not accept.
+func composeProjectName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return strings.TrimLeft(b.String(), "-_")
+}
+
+// parseImageRef splits an image reference into repository and tag (default "latest").
+// pinned is true for digest references (image@sha256:...), which never change.
+func parseImageRef(ref string) (repo, tag string, pinned bool) {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i], "", true
+	}
+	repo, tag = ref, "latest"
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repo, tag = ref[:i], ref[i+1:]
+	}
+	return repo, tag, false
+}
+
+// pinnedStatusDir is where the digest an image pinned by digest (repo@sha256:...) was
+// deployed at is recorded. It is keyed by the repository, so a changed pin is seen as new
+// content.
+func pinnedStatusDir(cfg *config.Config, repo string) string {
+	return imageStatusDir(cfg, repo+"@pinned")
+}
+
+// composeDigests resolves the digest of every image in the stack; an image whose digest
+// cannot be resolved has "".
+func composeDigests(cfg *config.Config, stack *ComposeStack) []string {
+	images, err := stack.Images(context.Background())
+	if err != nil {
+		return nil
+	}
+	digests := make([]string, 0, len(images))
+	for _, ref := range images {
+		repo, tag, pinned := parseImageRef(ref)
+		if pinned {
+			digests = append(digests, ref[len(repo)+1:])
+			continue
+		}
+		digest, _ := registryClientFor(cfg, repo).resolveDigest(tag)
+		digests = append(digests, digest)
+	}
+	return digests
+}
+
+// registryClientFor returns a registry client for repo, reusing credentials from a matching
+// docker-images.yml entry. The registry is taken from the first path component when it looks
+// like a host (contains "." or ":", or is "localhost"), as the Docker CLI does.
+func registryClientFor(cfg *config.Config, repo string) *DockerRegistryClient {
+	imgCfg := config.DockerImageConfig{Image: repo}
+	for _, img := range cfg.DockerImages {
+		if img.Image == repo {
+			imgCfg = img
+			break
+		}
+	}
+	if imgCfg.Registry == "" {
+		if first, _, ok := strings.Cut(repo, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+			imgCfg.Registry = first
+		}
+	}
+	return NewDockerRegistryClient(&imgCfg)
+}
+
+// CheckForComposeUpdates deploys the stack on first run, or when any image it references
+// points at a new digest (so re-pushed tags such as `latest` are picked up).
+func CheckForComposeUpdates(cfg *config.Config, status *state.Status, trigger string) {
+	stack := composeStack(cfg)
+
+	if _, lastDeployed := status.Get(); lastDeployed.IsZero() {
+		if cfg.Gate.Enabled() && gatedTrigger(trigger) && holdRelease(cfg, trigger, "", "", composeTarget(composeDigests(cfg, stack))) {
+			return
+		}
+		logger.Infof("No previous deployment found for compose stack %s. Performing initial deployment...\n", stack.ProjectName())
+		if err := DeployCompose(cfg, status, trigger); err != nil {
+			logger.Infof("Error deploying compose stack %s: %v\n", stack.ProjectName(), err)
+		}
+		return
+	}
+
+	images, err := stack.Images(context.Background())
+	if err != nil {
+		logger.Infof("Error listing images of compose stack %s: %v\n", stack.ProjectName(), err)
+		return
+	}
+
+	changed := false
+	digests := make([]string, 0, len(images))
+	for _, ref := range images {
+		repo, tag, pinned := parseImageRef(ref)
+		if pinned {
+			digests = append(digests, ref[len(repo)+1:])
+			continue
+		}
+		imageStatus := state.NewStatus(imageStatusDir(cfg, ref))
+		digest, imageChanged := digestChanged(registryClientFor(cfg, repo), tag, imageStatus)
+		digests = append(digests, digest)
+		changed = changed || imageChanged
+	}
+	if !changed || recentlyRefused(cfg, strings.Join(images, " "), "", "") ||
+		holdRelease(cfg, trigger, "", "", composeTarget(digests)) {
+		return
+	}
+
+	if err := DeployCompose(cfg, status, trigger); err != nil {
+		logger.Infof("Error deploying compose stack %s: %v\n", stack.ProjectName(), err)
+	}
+}
+
+// DeployCompose pulls and (re)creates the stack with `docker compose pull` and `up -d`,
+// then records the digest of every image in the stack. The attempt is recorded in the deploy history.
+// Callers must hold the project's deploy lock.
+func DeployCompose(cfg *config.Config, status *state.Status, trigger string) (err error) {
+	stack := composeStack(cfg)
+	ctx := context.Background()
+
+	run := startDeployRun(cfg, trigger, "", status)
+	defer func() { run.finish(err) }()
+
+	images, err := stack.Images(ctx)
+	if err != nil {
+		return err
+	}
+	run.rec.Image = strings.Join(images, " ")
+
+	logger.Infof("Deploying compose stack %s (%d images)...\n", stack.ProjectName(), len(images))
+
+	var services []string
+	if cfg.Compose != nil {
+		services = cfg.Compose.Services
+	}
+
+	// Every image in the stack must be signed; verified digests are checked again after the pull
+	verified := make(map[string]string)
+	if cfg.Verify != nil && cfg.Verify.Image != nil {
+		run.setStage("verify")
+		var signatures []string
+		for _, ref := range images {
+			repo, tag, pinned := parseImageRef(ref)
+			if pinned {
+				tag = ref[strings.Index(ref, "@")+1:]
+			}
+			digest, signature, err := registryClientFor(cfg, repo).verifyImageSignature(tag, cfg.Verify.Image.PublicKey)
+			if err != nil {
+				return err
+			}
+			verified[ref] = digest
+			signatures = append(signatures, ref+": "+signature)
+		}
+		run.rec.Signature = strings.Join(signatures, "; ")
+	}
+
+	// docker compose pull + up -d is the switch stage; declared pre/post stages run around it
+	pipeline := &pipelineRun{cfg: cfg, run: run, dir: cfg.LocalPath}
+	pipeline.switchFunc = func(ctx context.Context, env []string, stdout, stderr io.Writer) error {
+		pull := stack.command(ctx, append([]string{"pull", "--ignore-buildable"}, services...)...)
+		pull.Env = stack.env(env)
+		pull.Stdout, pull.Stderr = stdout, stderr
+		if err := pull.Run(); err != nil {
+			return fmt.Errorf("docker compose pull failed: %w", err)
+		}
+		for ref, digest := range verified {
+			if err := checkPulledDigest(stack.runtime(), ref, digest); err != nil {
+				return err
+			}
+		}
+
+		upArgs := []string{"up", "-d"}
+		if cfg.Compose != nil && cfg.Compose.RemoveOrphans {
+			upArgs = append(upArgs, "--remove-orphans")
+		}
+		up := stack.command(ctx, append(upArgs, services...)...)
+		up.Env = stack.env(env)
+		up.Stdout, up.Stderr = stdout, stderr
+		if err := up.Run(); err != nil {
+			return fmt.Errorf("docker compose up failed: %w", err)
+		}
+		return nil
+	}
+	if err := pipeline.execute(); err != nil {
+		return err
+	}
+
+	// Record what is now running so the next poll only redeploys on a real change
+	now := time.Now()
+	digests := make([]string, 0, len(images))
+	for _, ref := range images {
+		repo, tag, pinned := parseImageRef(ref)
+		if pinned {
+			digests = append(digests, ref[len(repo)+1:])
+			state.NewStatus(pinnedStatusDir(cfg, repo)).SetWithDigest("", ref[len(repo)+1:], now)
+			continue
+		}
+		digest, derr := registryClientFor(cfg, repo).resolveDigest(tag)
+		digests = append(digests, digest)
+		if derr != nil {
+			logger.Infof("Could not resolve digest for %s: %v\n", ref, derr)
+			continue
+		}
+		state.NewStatus(imageStatusDir(cfg, ref)).SetWithDigest(tag, digest, now)
+	}
+	run.target = composeTarget(digests)
+	status.Set("", now)
+
+	logger.Infof("Deployment of compose stack %s complete.\n", stack.ProjectName())
+	return nil
+}
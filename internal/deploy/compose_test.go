@@ -0,0 +1,195 @@
+package deploy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+func TestParseComposePS(t *testing.T) {
+	array := `[{"Name":"app-web-1","Service":"web","Image":"nginx:latest","State":"running","Health":"healthy","ExitCode":0},
+{"Name":"app-db-1","Service":"db","Image":"postgres:16","State":"exited","Health":"","ExitCode":1}]`
+	ndjson := `{"Name":"app-web-1","Service":"web","Image":"nginx:latest","State":"running","Health":"healthy","ExitCode":0}
+{"Name":"app-db-1","Service":"db","Image":"postgres:16","State":"exited","Health":"","ExitCode":1}
+`
+	for name, input := range map[string]string{"array": array, "ndjson": ndjson} {
+		t.Run(name, func(t *testing.T) {
+			services, err := parseComposePS([]byte(input))
+			if err != nil {
+				t.Fatalf("parseComposePS: %v", err)
+			}
+			if len(services) != 2 {
+				t.Fatalf("got %d services, want 2", len(services))
+			}
+			if services[0].Service != "web" || !services[0].Healthy() {
+				t.Errorf("web = %+v, want running/healthy", services[0])
+			}
+			if services[1].Service != "db" || services[1].Healthy() || services[1].ExitCode != 1 {
+				t.Errorf("db = %+v, want exited with code 1", services[1])
+			}
+		})
+	}
+
+	if services, err := parseComposePS([]byte("  \n")); err != nil || services != nil {
+		t.Errorf("empty output: got %v, %v", services, err)
+	}
+}
+
+func TestParseComposeImages(t *testing.T) {
+	out := `{"name":"media","services":{
+"web":{"image":"nginx:1.27"},
+"app":{"image":"registry.example.com/app:2","build":{"context":"."}},
+"worker":{"build":{"context":"./worker"}},
+"proxy":{"image":"nginx:1.27"},
+"db":{"image":"postgres:16"}}}`
+	images, err := parseComposeImages([]byte(out))
+	if err != nil {
+		t.Fatalf("parseComposeImages: %v", err)
+	}
+	if want := []string{"postgres:16", "nginx:1.27"}; !reflect.DeepEqual(images, want) {
+		t.Errorf("images = %v, want %v (built services left out)", images, want)
+	}
+}
+
+func TestParseImageRef(t *testing.T) {
+	tests := []struct {
+		ref, repo, tag string
+		pinned         bool
+	}{
+		{"nginx", "nginx", "latest", false},
+		{"nextcloud:29-apache", "nextcloud", "29-apache", false},
+		{"ghcr.io/home-assistant/home-assistant:stable", "ghcr.io/home-assistant/home-assistant", "stable", false},
+		{"localhost:5000/app", "localhost:5000/app", "latest", false},
+		{"localhost:5000/app:v2", "localhost:5000/app", "v2", false},
+		{"redis@sha256:abc", "redis", "", true},
+	}
+	for _, tt := range tests {
+		repo, tag, pinned := parseImageRef(tt.ref)
+		if repo != tt.repo || tag != tt.tag || pinned != tt.pinned {
+			t.Errorf("parseImageRef(%q) = %q, %q, %v; want %q, %q, %v", tt.ref, repo, tag, pinned, tt.repo, tt.tag, tt.pinned)
+		}
+	}
+}
+
+func TestRegistryClientFor(t *testing.T) {
+	cfg := &config.Config{DockerImages: []config.DockerImageConfig{
+		{Image: "ghcr.io/acme/api", Token: "secret"},
+	}}
+
+	c := registryClientFor(cfg, "ghcr.io/acme/api")
+	if c.registry != "ghcr.io" || c.image != "acme/api" || c.token != "secret" {
+		t.Errorf("ghcr client = %+v", c)
+	}
+	c = registryClientFor(cfg, "localhost:5000/app")
+	if c.registry != "localhost:5000" || c.image != "app" {
+		t.Errorf("local registry client = %+v", c)
+	}
+	c = registryClientFor(cfg, "linuxserver/nextcloud")
+	if c.registry != "docker.io" || c.image != "linuxserver/nextcloud" {
+		t.Errorf("docker hub client = %+v", c)
+	}
+}
+
+func TestComposeStackArgs(t *testing.T) {
+	stack := NewComposeStack(&config.ComposeConfig{
+		Files:    []string{"compose.yml", "/etc/app/override.yml"},
+		Profiles: []string{"media"},
+		EnvFiles: []string{".env.prod"},
+	}, "My App", "/srv/app")
+
+	want := []string{
+		"compose", "--project-name", "my-app", "--project-directory", "/srv/app",
+		"-f", "/srv/app/compose.yml", "-f", "/etc/app/override.yml",
+		"--profile", "media",
+		"--env-file", "/srv/app/.env.prod",
+	}
+	if got := stack.baseArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("baseArgs =\n%v\nwant\n%v", got, want)
+	}
+
+	named := NewComposeStack(&config.ComposeConfig{ProjectName: "media"}, "homelab", "/srv")
+	if named.ProjectName() != "media" {
+		t.Errorf("ProjectName = %q, want media", named.ProjectName())
+	}
+}
+
+func TestComposeStackForProject(t *testing.T) {
+	dir := t.TempDir()
+
+	stack, err := ComposeStackForProject(dir, "app")
+	if err != nil || stack != nil {
+		t.Fatalf("missing env file: got %v, %v; want nil, nil", stack, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "env"), []byte("BEACON_DEPLOYMENT_TYPE=git\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if stack, _ := ComposeStackForProject(dir, "app"); stack != nil {
+		t.Fatal("git project should not have a compose stack")
+	}
+
+	env := "BEACON_DEPLOYMENT_TYPE=compose\nBEACON_LOCAL_PATH=/srv/media\n"
+	if err := os.WriteFile(filepath.Join(dir, "env"), []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deployYAML := "compose:\n  files: [compose.yml]\n  profiles: [gpu]\n"
+	if err := os.WriteFile(filepath.Join(dir, "deploy.yml"), []byte(deployYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stack, err = ComposeStackForProject(dir, "media")
+	if err != nil || stack == nil {
+		t.Fatalf("ComposeStackForProject: %v, %v", stack, err)
+	}
+	if stack.dir != "/srv/media" || stack.ProjectName() != "media" {
+		t.Errorf("stack = %+v", stack)
+	}
+	if !reflect.DeepEqual(stack.cfg.Profiles, []string{"gpu"}) {
+		t.Errorf("profiles = %v", stack.cfg.Profiles)
+	}
+}
+
+func TestCheckForComposeUpdates_SkipsBuiltServices(t *testing.T) {
+	var hits atomic.Int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(registry.Close)
+	image := strings.TrimPrefix(registry.URL, "http://") + "/app:latest"
+
+	// A fake docker CLI whose stack only holds a service built from source
+	bin := t.TempDir()
+	log := filepath.Join(bin, "log")
+	writeFile(t, filepath.Join(bin, "docker"), `#!/bin/sh
+echo "$*" >> `+log+`
+case "$*" in *"config --format json"*) echo '{"services":{"app":{"image":"`+image+`","build":{"context":"."}}}}' ;; esac
+`)
+	if err := os.Chmod(filepath.Join(bin, "docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cfg := newTestConfig(t, "stack")
+	cfg.DeploymentType = "compose"
+	cfg.Container = config.ContainerConfig{Runtime: config.RuntimeDocker, Mode: config.RuntimeModeCLI}
+	status := state.NewStatus(t.TempDir())
+	status.Set("", time.Now())
+
+	CheckForComposeUpdates(cfg, status, state.TriggerPoll)
+
+	if n := hits.Load(); n != 0 {
+		t.Errorf("registry asked %d times about an image built on this host", n)
+	}
+	if out, _ := os.ReadFile(log); strings.Contains(string(out), " up ") {
+		t.Errorf("stack redeployed: %s", out)
+	}
+}
@@ -0,0 +1,220 @@
+package deploy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+
+	beaconerrors "beacon/internal/errors"
+)
+
+// Cosign stores signatures as an OCI manifest tagged "sha256-<hex>.sig" next to the image.
+// Each layer is a "simple signing" payload naming the signed digest; the layer annotation
+// holds the base64 signature of that payload.
+const (
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	cosignPayloadType         = "cosign container image signature"
+
+	// maxSignatureBlob bounds a signature payload download.
+	maxSignatureBlob = 1 << 20
+)
+
+type cosignManifest struct {
+	Layers []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// verifyImageSignature checks that tag carries a cosign signature made with the public key
+// in keyPath (`cosign sign --key`). The signature may cover the tag's manifest list or the
+// manifest for this host's platform. It returns the tag's top-level digest, which the pulled
+// image must match, and a description of the signature; a refused image is reported as a
+// signature BeaconError.
+func (c *DockerRegistryClient) verifyImageSignature(tag, keyPath string) (digest, signature string, err error) {
+	pub, err := loadCosignPublicKey(keyPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	var lastErr error
+	for _, base := range c.registryBaseURLs() {
+		body, top, err := c.getManifest(fmt.Sprintf("%s/v2/%s/manifests/%s", base, c.repositoryPath(), url.PathEscape(tag)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if top == "" {
+			sum := sha256.Sum256(body)
+			top = "sha256:" + hex.EncodeToString(sum[:])
+		}
+		candidates := []string{top}
+		if platform, perr := pickPlatformDigest(body, top, runtime.GOARCH); perr == nil && platform != top {
+			candidates = append(candidates, platform)
+		}
+
+		reason := "no cosign signature found"
+		for _, d := range candidates {
+			ok, why, err := c.checkCosignSignature(base, d, pub)
+			if err != nil {
+				return "", "", err
+			}
+			if ok {
+				return top, fmt.Sprintf("cosign signature on %s verified with %s", shortDigest(d), keyPath), nil
+			}
+			if why != "" {
+				reason = why
+			}
+		}
+		return "", "", beaconerrors.NewSignatureError("image "+c.getFullImageName()+":"+tag, errors.New(reason))
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no registry endpoint")
+	}
+	return "", "", fmt.Errorf("resolve %s:%s: %w", c.getFullImageName(), tag, lastErr)
+}
+
+// checkCosignSignature looks for a valid signature of digest. It returns ok=false with a
+// reason when the signature is missing or does not verify, and an error when the registry
+// cannot be queried.
+func (c *DockerRegistryClient) checkCosignSignature(base, digest string, pub crypto.PublicKey) (bool, string, error) {
+	sigTag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	resp, err := c.authorizedGet(fmt.Sprintf("%s/v2/%s/manifests/%s", base, c.repositoryPath(), sigTag))
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, "", nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSignatureBlob))
+	if err != nil {
+		return false, "", fmt.Errorf("read signature manifest: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("registry returned status %d for signature manifest: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var m cosignManifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return false, "", fmt.Errorf("parse signature manifest: %w", err)
+	}
+	reason := "signature manifest has no signatures"
+	for _, layer := range m.Layers {
+		sig, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		payload, err := c.getBlob(base, layer.Digest)
+		if err != nil {
+			return false, "", err
+		}
+		if why := verifyCosignPayload(pub, payload, sig, digest); why != "" {
+			reason = why
+			continue
+		}
+		return true, "", nil
+	}
+	return false, reason, nil
+}
+
+// verifyCosignPayload checks one signature layer; it returns "" when the payload is signed
+// by pub and names digest, or the reason it was rejected.
+func verifyCosignPayload(pub crypto.PublicKey, payload []byte, sigB64, digest string) string {
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		return "malformed signature"
+	}
+	if !verifyWithKey(pub, payload, sig) {
+		return "signature does not match the configured public key"
+	}
+	var p simpleSigningPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return "malformed signature payload"
+	}
+	if p.Critical.Type != cosignPayloadType {
+		return fmt.Sprintf("unexpected signature type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Sprintf("signature is for %s, not %s", shortDigest(p.Critical.Image.DockerManifestDigest), shortDigest(digest))
+	}
+	return ""
+}
+
+func verifyWithKey(pub crypto.PublicKey, payload, sig []byte) bool {
+	sum := sha256.Sum256(payload)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, sum[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil ||
+			rsa.VerifyPSS(k, crypto.SHA256, sum[:], sig, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, sig)
+	}
+	return false
+}
+
+// getBlob downloads a blob and checks it against its digest.
+func (c *DockerRegistryClient) getBlob(base, digest string) ([]byte, error) {
+	resp, err := c.authorizedGet(fmt.Sprintf("%s/v2/%s/blobs/%s", base, c.repositoryPath(), digest))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned status %d for blob %s", resp.StatusCode, shortDigest(digest))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSignatureBlob))
+	if err != nil {
+		return nil, fmt.Errorf("read blob: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s does not match its digest", shortDigest(digest))
+	}
+	return data, nil
+}
+
+// loadCosignPublicKey reads a PEM public key (ECDSA, RSA or Ed25519) as written by
+// `cosign generate-key-pair`.
+func loadCosignPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM public key found", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pub, nil
+}
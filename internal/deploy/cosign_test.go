@@ -0,0 +1,157 @@
+package deploy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"beacon/internal/config"
+	"beacon/internal/container"
+)
+
+const testImageManifest = `{"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newSignedRegistry serves acme/app:1.0 with a cosign signature over signedDigest made by key.
+func newSignedRegistry(t *testing.T, key *ecdsa.PrivateKey, signedDigest func(imageDigest string) string) (*DockerRegistryClient, string) {
+	t.Helper()
+	imageDigest := sha256Digest([]byte(testImageManifest))
+	payload := fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"acme/app"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, signedDigest(imageDigest))
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadDigest := sha256Digest([]byte(payload))
+	sigManifest := fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"mediaType":"application/vnd.dev.cosign.simplesigning.v1+json","digest":%q,"annotations":{"dev.cosignproject.cosign/signature":%q}}]}`,
+		payloadDigest, base64.StdEncoding.EncodeToString(sig))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/acme/app/manifests/1.0":
+			w.Header().Set("Docker-Content-Digest", imageDigest)
+			fmt.Fprint(w, testImageManifest)
+		case "/v2/acme/app/manifests/" + strings.Replace(imageDigest, ":", "-", 1) + ".sig":
+			fmt.Fprint(w, sigManifest)
+		case "/v2/acme/app/blobs/" + payloadDigest:
+			fmt.Fprint(w, payload)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	return NewDockerRegistryClient(&config.DockerImageConfig{Image: host + "/acme/app", Registry: host}), imageDigest
+}
+
+func writePublicKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyImageSignature(t *testing.T) {
+	signer := newTestKey(t)
+	same := func(d string) string { return d }
+
+	t.Run("valid", func(t *testing.T) {
+		client, imageDigest := newSignedRegistry(t, signer, same)
+		digest, sig, err := client.verifyImageSignature("1.0", writePublicKey(t, signer))
+		if err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+		if digest != imageDigest || !strings.Contains(sig, "cosign signature") {
+			t.Errorf("digest = %q, signature = %q", digest, sig)
+		}
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		client, _ := newSignedRegistry(t, signer, same)
+		_, _, err := client.verifyImageSignature("1.0", writePublicKey(t, newTestKey(t)))
+		if !isSignatureError(err) || !strings.Contains(err.Error(), "does not match the configured public key") {
+			t.Errorf("err = %v, want signature error", err)
+		}
+	})
+
+	t.Run("signature for another image", func(t *testing.T) {
+		client, _ := newSignedRegistry(t, signer, func(string) string { return "sha256:" + strings.Repeat("0", 64) })
+		_, _, err := client.verifyImageSignature("1.0", writePublicKey(t, signer))
+		if !isSignatureError(err) || !strings.Contains(err.Error(), "signature is for") {
+			t.Errorf("err = %v, want digest mismatch", err)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v2/acme/app/manifests/1.0" {
+				fmt.Fprint(w, testImageManifest)
+				return
+			}
+			http.NotFound(w, r)
+		}))
+		defer srv.Close()
+		host := strings.TrimPrefix(srv.URL, "http://")
+		client := NewDockerRegistryClient(&config.DockerImageConfig{Image: host + "/acme/app", Registry: host})
+		_, _, err := client.verifyImageSignature("1.0", writePublicKey(t, signer))
+		if !isSignatureError(err) || !strings.Contains(err.Error(), "no cosign signature") {
+			t.Errorf("err = %v, want missing signature", err)
+		}
+	})
+}
+
+func TestCheckPulledDigest(t *testing.T) {
+	// A fake docker CLI: the image was pulled under two names, ours second
+	bin := t.TempDir()
+	writeFile(t, filepath.Join(bin, "docker"), "#!/bin/sh\necho 'mirror.local/app@sha256:aaaa registry.example.com/app@sha256:bbbb '\n")
+	if err := os.Chmod(filepath.Join(bin, "docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	rt := &container.Runtime{Name: config.RuntimeDocker}
+	image := "registry.example.com/app:1.0"
+
+	if err := checkPulledDigest(rt, image, "sha256:bbbb"); err != nil {
+		t.Errorf("digest of the second name rejected: %v", err)
+	}
+	for _, verified := range []string{"sha256:bbb", "sha256:cccc"} {
+		if err := checkPulledDigest(rt, image, verified); !isSignatureError(err) {
+			t.Errorf("%s: err = %v, want signature error", verified, err)
+		}
+	}
+	if got := localImageDigest(rt, image); got != "registry.example.com/app@sha256:bbbb" {
+		t.Errorf("localImageDigest = %q", got)
+	}
+}
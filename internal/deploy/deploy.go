@@ -14,7 +14,17 @@ import (
 	"beacon/internal/util"
 )
 
-func CheckForNewTag(cfg *config.Config, status *state.Status) {
+// CheckForNewTag is the poll-loop entry point: it deploys a new release if one is available.
+// trigger is recorded in the deploy history (state.TriggerPoll or state.TriggerWebhook).
+// The check is skipped while another deploy of the project is running.
+func CheckForNewTag(cfg *config.Config, status *state.Status, trigger string) {
+	lock, err := TryLock(cfg)
+	if err != nil {
+		logger.Infof("Skipping %s check: %v\n", trigger, err)
+		return
+	}
+	defer lock.Unlock()
+
 	// Determine deployment type (default to "git" for backward compatibility)
 	deploymentType := cfg.DeploymentType
 	if deploymentType == "" {
@@ -23,15 +33,19 @@ func CheckForNewTag(cfg *config.Config, status *state.Status) {
 
 	switch deploymentType {
 	case "docker":
-		CheckForNewImageTag(cfg, status)
+		CheckForNewImageTag(cfg, status, trigger)
+	case "compose":
+		CheckForComposeUpdates(cfg, status, trigger)
+	case "artifact":
+		CheckForNewArtifact(cfg, status, trigger)
 	case "git":
 		fallthrough
 	default:
-		CheckForNewGitTag(cfg, status)
+		CheckForNewGitTag(cfg, status, trigger)
 	}
 }
 
-func CheckForNewGitTag(cfg *config.Config, status *state.Status) {
+func CheckForNewGitTag(cfg *config.Config, status *state.Status, trigger string) {
 	// Get Git token from key manager if token name is specified
 	gitToken, err := getGitToken(cfg)
 	if err != nil {
@@ -58,11 +72,14 @@ func CheckForNewGitTag(cfg *config.Config, status *state.Status) {
 	}
 
 	if shouldDeploy {
-		latestTag := LatestGitTag(cfg)
+		latestTag := TargetGitRef(cfg)
+		if recentlyRefused(cfg, "", latestTag, "") || holdRelease(cfg, trigger, "", latestTag, "") {
+			return
+		}
 		if latestTag == "" {
 			logger.Infof("No Git tags found. Falling back to default branch for initial deployment...")
 		}
-		err := Deploy(cfg, latestTag, status)
+		err := Deploy(cfg, latestTag, status, trigger)
 		if err != nil {
 			logger.Infof("Error during initial deployment: %v\n", err)
 			return
@@ -71,25 +88,116 @@ func CheckForNewGitTag(cfg *config.Config, status *state.Status) {
 		return
 	}
 
+	switch cfg.Policy.EffectiveTrack() {
+	case config.TrackBranch:
+		// Follow the branch head: redeploy whenever the remote head moves
+		branch := cfg.Policy.Branch
+		head, err := remoteBranchHead(cfg, gitToken, branch)
+		if err != nil {
+			logger.Infof("Error resolving branch head: %v\n", err)
+			return
+		}
+		if head == status.Commit() || recentlyRefused(cfg, "", branch, head) || holdRelease(cfg, trigger, "", branch, head) {
+			return
+		}
+		logger.Infof("New commit on %s: %s (prev: %s)\n", branch, head, status.Commit())
+		if err := Deploy(cfg, branch, status, trigger); err != nil {
+			logger.Infof("Error deploying: %v\n", err)
+		}
+		return
+
+	case config.TrackCommit:
+		// Pinned commit: only deploy if something else is checked out
+		pinned := cfg.Policy.Commit
+		if lastTag == pinned || strings.HasPrefix(status.Commit(), pinned) || holdRelease(cfg, trigger, "", pinned, "") {
+			return
+		}
+		logger.Infof("Deploying pinned commit %s (prev: %s)\n", pinned, lastTag)
+		if err := Deploy(cfg, pinned, status, trigger); err != nil {
+			logger.Infof("Error deploying: %v\n", err)
+		}
+		return
+	}
+
 	// For existing repos, fetch latest tags and check for updates
 	latestTag := getLatestTagFromRepo(cfg)
-	if latestTag == "" || latestTag == lastTag {
+	if latestTag == "" || latestTag == lastTag || recentlyRefused(cfg, "", latestTag, "") {
+		return
+	}
+	if holdRelease(cfg, trigger, "", latestTag, "") {
 		return
 	}
 
 	logger.Infof("New tag found: %s (prev: %s)\n", latestTag, lastTag)
-	if err := Deploy(cfg, latestTag, status); err != nil {
+	if err := Deploy(cfg, latestTag, status, trigger); err != nil {
 		logger.Infof("Error deploying: %v\n", err)
 	}
 }
 
-func Deploy(cfg *config.Config, tag string, status *state.Status) error {
+// Deploy checks out tag (a tag, branch or commit SHA; the default branch when empty) into
+// cfg.LocalPath and runs the deploy command. Every attempt is recorded in the project's deploy history with the given trigger.
+// Callers must hold the project's deploy lock (see TryLock and Acquire).
+func Deploy(cfg *config.Config, tag string, status *state.Status, trigger string) (err error) {
+	run := startDeployRun(cfg, trigger, tag, status)
+	run.rec.FromCommit = gitHead(cfg.LocalPath)
+	defer func() { run.finish(err) }()
+
 	if tag == "" {
 		logger.Infof("Deploying default branch...\n")
 	} else {
 		logger.Infof("Deploying tag %s...\n", tag)
 	}
 
+	if cfg.Git.EffectiveMode() == config.GitModeMirror {
+		run.setStage("fetch")
+		res, err := checkoutRelease(run.ctx, cfg, cfg.GitToken, tag, run.stderr)
+		run.rec.FetchBytes = res.Bytes
+		run.rec.FetchDurationMs = res.Duration.Milliseconds()
+		run.rec.Signature = res.Signature
+		run.target = res.Commit
+		if err != nil {
+			if cerr := run.canceled(); cerr != nil {
+				return cerr
+			}
+			logger.Infof("Error checking out release: %v\n", err)
+			return err
+		}
+		logger.Infof("Fetched %d bytes in %s\n", res.Bytes, res.Duration.Round(time.Millisecond))
+	} else if err := cloneRelease(run, cfg, authenticatedRepoURL(cfg.RepoURL, cfg.GitToken), tag); err != nil {
+		return err
+	}
+	if err := run.canceled(); err != nil {
+		return err
+	}
+	run.rec.ToCommit = gitHead(cfg.LocalPath)
+
+	// Run the deploy pipeline (just the deploy command when no pipeline is declared)
+	pipeline := &pipelineRun{cfg: cfg, run: run, dir: cfg.LocalPath, switchCommand: cfg.DeployCommand}
+	if err := pipeline.execute(); err != nil {
+		logger.Infof("Deploy pipeline failed: %v\n", err)
+		return err
+	}
+
+	// Store the tag (or "default" for default branch)
+	tagToStore := tag
+	if tag == "" {
+		tagToStore = "default"
+	}
+	status.SetWithCommit(tagToStore, run.rec.ToCommit, time.Now())
+
+	if tag == "" {
+		logger.Infof("Deployment of default branch complete.\n")
+	} else {
+		logger.Infof("Deployment of tag %s complete.\n", tag)
+	}
+	return nil
+}
+
+// cloneRelease is the git.mode "clone" checkout: it deletes cfg.LocalPath and clones tag
+// into it from scratch.
+func cloneRelease(run *deployRun, cfg *config.Config, repoURL, tag string) error {
+	run.setStage("clone")
+	start := time.Now()
 	if err := os.RemoveAll(cfg.LocalPath); err != nil {
 		logger.Infof("Error removing local path %s: %v\n", cfg.LocalPath, err)
 		return err
@@ -101,78 +209,66 @@ func Deploy(cfg *config.Config, tag string, status *state.Status) error {
 		return err
 	}
 
-	repoURL := authenticatedRepoURL(cfg.RepoURL, cfg.GitToken)
-
 	// Clone the repository
 	// Set working directory to parentDir to avoid "Unable to read current working directory" errors
 	var cloneCmd *exec.Cmd
 	var stderr strings.Builder
-	if tag == "" {
-		// Clone default branch
-		cloneCmd = exec.Command("git", "clone", repoURL, cfg.LocalPath)
+	if tag == "" || isCommitRef(cfg, tag) {
+		// Clone default branch (commits are checked out after cloning)
+		cloneCmd = exec.CommandContext(run.ctx, "git", "clone", repoURL, cfg.LocalPath)
 	} else {
 		// Clone specific tag
-		cloneCmd = exec.Command("git", "clone", "--branch", tag, repoURL, cfg.LocalPath)
+		cloneCmd = exec.CommandContext(run.ctx, "git", "clone", "--branch", tag, repoURL, cfg.LocalPath)
 	}
 	cloneCmd.Dir = parentDir // Set working directory to parent to avoid CWD issues
 	cloneCmd.Stderr = &stderr
 
 	if err := cloneCmd.Run(); err != nil {
+		if cerr := run.canceled(); cerr != nil {
+			return cerr
+		}
 		logger.Infof("Error cloning repository: %v\n", err)
 		logger.Infof("Git error output: %s\n", stderr.String())
+		_, _ = run.stderr.Write([]byte(stderr.String()))
 		return err
 	}
 
-	// Execute deploy command if specified
-	if cfg.DeployCommand != "" {
-		logger.Infof("Executing deploy command: %s\n", cfg.DeployCommand)
-
-		// Build the command with secure environment file sourcing
-		var command string
-		if cfg.SecureEnvPath != "" {
-			// Check if secure env file exists
-			if _, err := os.Stat(cfg.SecureEnvPath); err == nil {
-				logger.Infof("Sourcing secure environment file: %s\n", cfg.SecureEnvPath)
-				command = fmt.Sprintf("set -a && . %s && set +a && %s", cfg.SecureEnvPath, cfg.DeployCommand)
-			} else {
-				logger.Infof("Warning: Secure environment file not found: %s\n", cfg.SecureEnvPath)
-				logger.Infof("Running deploy command without secure environment\n")
-				command = cfg.DeployCommand
-			}
-		} else {
-			command = cfg.DeployCommand
+	if isCommitRef(cfg, tag) {
+		checkoutCmd := exec.Command("git", "checkout", "--detach", tag)
+		checkoutCmd.Dir = cfg.LocalPath
+		if out, err := checkoutCmd.CombinedOutput(); err != nil {
+			logger.Infof("Error checking out commit %s: %v\n", tag, err)
+			_, _ = run.stderr.Write(out)
+			return fmt.Errorf("checkout %s: %w", tag, err)
 		}
+	}
+	run.rec.FetchDurationMs = time.Since(start).Milliseconds()
 
-		// Execute the command - set working directory to avoid CWD issues
-		cmd := exec.Command("sh", "-c", command)
-		cmd.Dir = cfg.LocalPath // Set working directory to project directory
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			logger.Infof("Deploy command failed: %v\n", err)
+	if cfg.Verify != nil && cfg.Verify.Git != nil {
+		run.target = gitHead(cfg.LocalPath)
+		sig, err := verifyGitRelease(run.ctx, cfg, cfg.LocalPath, tag, run.target)
+		if err != nil {
+			// Do not leave an unverified tree behind in the deploy path
+			util.LogError(os.RemoveAll(cfg.LocalPath), "remove refused release")
 			return err
 		}
-
-		logger.Infof("Deploy command completed successfully\n")
-	}
-
-	// Store the tag (or "default" for default branch)
-	tagToStore := tag
-	if tag == "" {
-		tagToStore = "default"
-	}
-	status.Set(tagToStore, time.Now())
-
-	if tag == "" {
-		logger.Infof("Deployment of default branch complete.\n")
-	} else {
-		logger.Infof("Deployment of tag %s complete.\n", tag)
+		run.rec.Signature = sig
 	}
 	return nil
 }
 
 func getLatestTagFromRepo(cfg *config.Config) string {
+	if cfg.Git.EffectiveMode() == config.GitModeMirror {
+		gitToken, _ := getGitToken(cfg)
+		if cfg.Git.Depth > 0 {
+			// A shallow mirror only holds deployed refs; ask the remote for its tags
+			return getLatestTagFromRemote(cfg, gitToken)
+		}
+		if tag, ok := latestMirrorTag(cfg, gitToken); ok {
+			return tag
+		}
+	}
+
 	// Check if repository exists
 	if _, err := os.Stat(cfg.LocalPath); os.IsNotExist(err) {
 		logger.Infof("Repository path does not exist: %s\n", cfg.LocalPath)
@@ -187,8 +283,8 @@ func getLatestTagFromRepo(cfg *config.Config) string {
 		return ""
 	}
 
-	// Get the latest tag - set working directory to avoid CWD issues
-	forEachCmd := exec.Command("sh", "-c", "git for-each-ref --sort=-creatordate --format='%(refname:short)' refs/tags | head -n 1")
+	// List tags newest first - set working directory to avoid CWD issues
+	forEachCmd := exec.Command("git", "for-each-ref", "--sort=-creatordate", "--format=%(refname:short)", "refs/tags")
 	forEachCmd.Dir = cfg.LocalPath
 	output, err := forEachCmd.Output()
 	if err != nil {
@@ -196,10 +292,15 @@ func getLatestTagFromRepo(cfg *config.Config) string {
 		return ""
 	}
 
-	return strings.TrimSpace(string(output))
+	tag, err := selectTag(cfg.Policy, strings.Fields(string(output)))
+	if err != nil {
+		logger.Infof("Error applying deploy policy: %v\n", err)
+		return ""
+	}
+	return tag
 }
 
-// LatestGitTag returns the newest Git tag visible for cfg.RepoURL.
+// LatestGitTag returns the newest Git tag visible for cfg.RepoURL that the deploy policy allows.
 // It prefers an existing local checkout so fetch credentials/remotes behave as configured,
 // then falls back to ls-remote for first deployments where LocalPath does not exist yet.
 func LatestGitTag(cfg *config.Config) string {
@@ -230,6 +331,7 @@ func getLatestTagFromRemote(cfg *config.Config, gitToken string) string {
 		return ""
 	}
 
+	var tags []string
 	for _, line := range strings.Split(string(output), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasSuffix(line, "^{}") {
@@ -241,10 +343,16 @@ func getLatestTagFromRemote(cfg *config.Config, gitToken string) string {
 		}
 		ref := strings.TrimPrefix(parts[1], "refs/tags/")
 		if ref != "" {
-			return ref
+			tags = append(tags, ref)
 		}
 	}
-	return ""
+
+	tag, err := selectTag(cfg.Policy, tags)
+	if err != nil {
+		logger.Infof("Error applying deploy policy: %v\n", err)
+		return ""
+	}
+	return tag
 }
 
 func authenticatedRepoURL(repoURL, gitToken string) string {
@@ -0,0 +1,16 @@
+package deploy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"beacon/internal/config"
+)
+
+// newTestConfig points BEACON_HOME at a temp directory and returns a config for project
+// with an empty local path.
+func newTestConfig(t *testing.T, project string) *config.Config {
+	t.Helper()
+	t.Setenv("BEACON_HOME", t.TempDir())
+	return &config.Config{ProjectName: project, LocalPath: filepath.Join(t.TempDir(), project)}
+}
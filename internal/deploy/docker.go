@@ -1,19 +1,21 @@
 package deploy
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
 	"beacon/internal/config"
+	"beacon/internal/container"
+	beaconerrors "beacon/internal/errors"
 	"beacon/internal/state"
 )
 
@@ -59,28 +61,18 @@ func NewDockerRegistryClient(imgCfg *config.DockerImageConfig) *DockerRegistryCl
 	}
 }
 
-// CheckForNewImageTag polls all Docker images for new tags
-func CheckForNewImageTag(cfg *config.Config, status *state.Status) {
+// CheckForNewImageTag polls all Docker images for new tags.
+// trigger is recorded in the deploy history for any deploy it starts.
+func CheckForNewImageTag(cfg *config.Config, status *state.Status, trigger string) {
 	if len(cfg.DockerImages) == 0 {
 		logger.Infof("No Docker images configured")
 		return
 	}
 
-	// Get the base storage directory from the existing status
-	// We'll use the same directory structure but with image-specific subdirectories
-	base, err := config.BeaconHomeDir()
-	if err != nil {
-		base = filepath.Join(os.Getenv("HOME"), ".beacon")
-	}
-	statusStorageDir := filepath.Join(base, cfg.ProjectDir)
-
 	// Check each configured image
 	for _, imgCfg := range cfg.DockerImages {
-		// Create a unique status storage for each image
-		// Sanitize image name for filesystem use
-		sanitizedImageName := strings.ReplaceAll(strings.ReplaceAll(imgCfg.Image, "/", "_"), ":", "_")
-		imageStatusDir := filepath.Join(statusStorageDir, "docker_images", sanitizedImageName)
-		imageStatus := state.NewStatus(imageStatusDir)
+		// Each image keeps its own status (tag + digest)
+		imageStatus := state.NewStatus(imageStatusDir(cfg, imgCfg.Image))
 
 		client := NewDockerRegistryClient(&imgCfg)
 
@@ -93,11 +85,15 @@ func CheckForNewImageTag(cfg *config.Config, status *state.Status) {
 			shouldDeploy = true
 		}
 
-		// Get latest tag from registry
-		latestTag, err := client.getLatestTag()
-		if err != nil {
-			logger.Infof("Error getting latest tag from registry for %s: %v\n", imgCfg.Image, err)
-			continue
+		// A fixed tag is followed by digest; otherwise look for the newest tag in the registry
+		latestTag := imgCfg.Tag
+		if latestTag == "" {
+			var err error
+			latestTag, err = client.getLatestTag(cfg.ImagePolicy(&imgCfg))
+			if err != nil {
+				logger.Infof("Error getting latest tag from registry for %s: %v\n", imgCfg.Image, err)
+				continue
+			}
 		}
 
 		if latestTag == "" {
@@ -105,26 +101,69 @@ func CheckForNewImageTag(cfg *config.Config, status *state.Status) {
 			continue
 		}
 
-		// Check if we have a new tag
+		// Check if we have a new tag, or the same tag re-pushed with new content
+		digest := ""
 		if !shouldDeploy && latestTag == lastTag {
-			continue
-		}
-
-		if shouldDeploy {
+			var changed bool
+			if digest, changed = digestChanged(client, latestTag, imageStatus); !changed {
+				continue
+			}
+		} else if shouldDeploy {
 			logger.Infof("Initial deployment for image %s with tag: %s\n", imgCfg.Image, latestTag)
 		} else {
 			logger.Infof("New tag found for image %s: %s (prev: %s)\n", imgCfg.Image, latestTag, lastTag)
 		}
 
+		if digest == "" {
+			// The deploy gate keys a held release by its digest; "" if it cannot be resolved
+			digest, _ = client.resolveDigest(latestTag)
+		}
+		if recentlyRefused(cfg, client.getFullImageName(), latestTag, "") ||
+			holdRelease(cfg, trigger, client.getFullImageName(), latestTag, digest) {
+			continue
+		}
+
 		// Deploy the new image
-		if err := DeployDockerImage(&imgCfg, cfg, latestTag, imageStatus); err != nil {
+		if err := DeployDockerImage(&imgCfg, cfg, latestTag, imageStatus, trigger); err != nil {
 			logger.Infof("Error deploying Docker image %s: %v\n", imgCfg.Image, err)
 		}
 	}
 }
 
-// getLatestTag fetches the latest tag from the Docker registry
-func (c *DockerRegistryClient) getLatestTag() (string, error) {
+// imageStatusDir returns the status directory for one image of a project
+// (~/.beacon/<project-dir>/docker_images/<sanitized-image>).
+func imageStatusDir(cfg *config.Config, image string) string {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		base = filepath.Join(os.Getenv("HOME"), ".beacon")
+	}
+	// Sanitize image name for filesystem use
+	sanitizedImageName := strings.ReplaceAll(strings.ReplaceAll(image, "/", "_"), ":", "_")
+	return filepath.Join(base, cfg.ProjectDir, "docker_images", sanitizedImageName)
+}
+
+// digestChanged resolves the digest tag now points at and reports whether it differs from
+// the deployed digest.
+func digestChanged(client *DockerRegistryClient, tag string, status *state.Status) (string, bool) {
+	digest, err := client.resolveDigest(tag)
+	if err != nil {
+		logger.Infof("Could not resolve digest for %s:%s: %v\n", client.getFullImageName(), tag, err)
+		return "", false
+	}
+	deployed := status.Digest()
+	if deployed == "" {
+		status.SetDigest(digest)
+		return digest, false
+	}
+	if digest == deployed {
+		return digest, false
+	}
+	logger.Infof("Tag %s of image %s was re-pushed: %s -> %s\n", tag, client.getFullImageName(), shortDigest(deployed), shortDigest(digest))
+	return digest, true
+}
+
+// getLatestTag fetches the newest tag allowed by policy from the Docker registry
+func (c *DockerRegistryClient) getLatestTag(policy config.DeployPolicy) (string, error) {
 	// Use Docker Registry API v2 to list tags
 	tags, err := c.listTags()
 	if err != nil {
@@ -141,7 +180,7 @@ func (c *DockerRegistryClient) getLatestTag() (string, error) {
 		return compareTags(tags[i], tags[j]) > 0
 	})
 
-	return tags[0], nil
+	return selectTag(policy, tags)
 }
 
 // listTags lists all tags for the image from the registry
@@ -158,7 +197,7 @@ func (c *DockerRegistryClient) listTags() ([]string, error) {
 // listTagsViaDockerHubAPI uses Docker Hub's special API endpoint
 func (c *DockerRegistryClient) listTagsViaDockerHubAPI() ([]string, error) {
 	// Docker Hub uses a different API: https://hub.docker.com/v2/repositories/{namespace}/{repository}/tags
-	parts := strings.Split(c.image, "/")
+	parts := strings.Split(c.repositoryPath(), "/")
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid Docker Hub image format: %s (expected username/repository)", c.image)
 	}
@@ -304,17 +343,60 @@ func (c *DockerRegistryClient) getFullImageName() string {
 	return fmt.Sprintf("%s/%s", c.registry, c.image)
 }
 
-// DeployDockerImage pulls and deploys a Docker image
-func DeployDockerImage(imgCfg *config.DockerImageConfig, cfg *config.Config, tag string, status *state.Status) error {
+// DeployDockerImage pulls and deploys a Docker image and records the attempt in the deploy history.
+// Callers must hold the project's deploy lock.
+func DeployDockerImage(imgCfg *config.DockerImageConfig, cfg *config.Config, tag string, status *state.Status, trigger string) (err error) {
 	client := NewDockerRegistryClient(imgCfg)
 
+	run := startDeployRun(cfg, trigger, tag, status)
+	run.rec.Type = "docker"
+	run.rec.Image = client.getFullImageName()
+	defer func() { run.finish(err) }()
+
 	logger.Infof("Deploying Docker image %s:%s...\n", client.getFullImageName(), tag)
 
-	// Pull the Docker image
 	fullImageName := fmt.Sprintf("%s:%s", client.getFullImageName(), tag)
-	if err := pullDockerImage(fullImageName, client); err != nil {
+
+	// Check the signature in the registry before anything is pulled
+	var verifiedDigest string
+	if cfg.Verify != nil && cfg.Verify.Image != nil {
+		run.setStage("verify")
+		digest, signature, err := client.verifyImageSignature(tag, cfg.Verify.Image.PublicKey)
+		if err != nil {
+			return err
+		}
+		verifiedDigest, run.target, run.rec.Signature = digest, digest, signature
+	}
+
+	rt, err := container.Detect(cfg.Container)
+	if err != nil {
+		return err
+	}
+
+	// Pull the Docker image
+	run.setStage("pull")
+	if err := pullDockerImage(run.ctx, rt, fullImageName, client); err != nil {
 		return fmt.Errorf("failed to pull Docker image: %w", err)
 	}
+	if err := run.canceled(); err != nil {
+		return err
+	}
+	if err := checkPulledDigest(rt, fullImageName, verifiedDigest); err != nil {
+		return err
+	}
+	// Prefer the registry's platform digest (what CheckForNewImageTag compares against)
+	digest, derr := client.resolveDigest(tag)
+	if derr != nil {
+		logger.Infof("Could not resolve digest for %s: %v\n", fullImageName, derr)
+		digest = ""
+	}
+	run.rec.Digest = digest
+	if digest != "" {
+		run.target = digest // what the poll loop holds the release by (see holdRelease)
+	}
+	if run.rec.Digest == "" {
+		run.rec.Digest = localImageDigest(rt, fullImageName)
+	}
 
 	// Determine deploy command (use image-specific command if available, otherwise fallback to global)
 	deployCommand := imgCfg.DeployCommand
@@ -322,113 +404,101 @@ func DeployDockerImage(imgCfg *config.DockerImageConfig, cfg *config.Config, tag
 		deployCommand = cfg.DeployCommand
 	}
 
-	// Execute deploy command if specified
-	if deployCommand != "" {
-		logger.Infof("Executing deploy command: %s\n", deployCommand)
-
-		// Build the command with secure environment file sourcing
-		var command string
-		if cfg.SecureEnvPath != "" {
-			if _, err := os.Stat(cfg.SecureEnvPath); err == nil {
-				logger.Infof("Sourcing secure environment file: %s\n", cfg.SecureEnvPath)
-				command = fmt.Sprintf("set -a && . %s && set +a && %s", cfg.SecureEnvPath, deployCommand)
-			} else {
-				logger.Infof("Warning: Secure environment file not found: %s\n", cfg.SecureEnvPath)
-				command = deployCommand
-			}
-		} else {
-			command = deployCommand
-		}
-
-		// Set environment variables for use in deploy command
-		env := os.Environ()
-		env = append(env, fmt.Sprintf("BEACON_DOCKER_IMAGE=%s", fullImageName))
-		env = append(env, fmt.Sprintf("BEACON_DOCKER_TAG=%s", tag))
-
-		// Use DockerComposeFiles array (legacy DockerComposeFile is normalized during config load)
-		composeFiles := imgCfg.DockerComposeFiles
-
-		// If docker-compose files are specified, set them as environment variables
-		if len(composeFiles) > 0 {
-			// Resolve all compose file paths
-			resolvedPaths := make([]string, 0, len(composeFiles))
-			for _, composeFile := range composeFiles {
-				composePath := composeFile
-				// If path is relative, make it relative to LocalPath
-				if !filepath.IsAbs(composePath) {
-					composePath = filepath.Join(cfg.LocalPath, composePath)
-				}
-				resolvedPaths = append(resolvedPaths, composePath)
-
-				// Verify docker-compose file exists
-				if _, err := os.Stat(composePath); os.IsNotExist(err) {
-					logger.Infof("Warning: Docker Compose file not found: %s\n", composePath)
-				}
-			}
+	// Variables for the deploy command and pipeline stages
+	env := []string{
+		fmt.Sprintf("BEACON_DOCKER_IMAGE=%s", fullImageName),
+		fmt.Sprintf("BEACON_DOCKER_TAG=%s", tag),
+		fmt.Sprintf("BEACON_CONTAINER_RUNTIME=%s", rt.Name),
+	}
+	env = append(env, rt.Env()...)
+	if digest != "" {
+		env = append(env, fmt.Sprintf("BEACON_DOCKER_DIGEST=%s", digest))
+	}
 
-			// Set environment variables for compose files
-			// BEACON_DOCKER_COMPOSE_FILES: Space-separated list of all files (for docker compose -f usage)
-			env = append(env, fmt.Sprintf("BEACON_DOCKER_COMPOSE_FILES=%s", strings.Join(resolvedPaths, " ")))
-		}
+	// Use DockerComposeFiles array (legacy DockerComposeFile is normalized during config load)
+	composeFiles := imgCfg.DockerComposeFiles
 
-		// Set working directory to LocalPath
-		workingDir := cfg.LocalPath
-		if len(composeFiles) > 0 {
-			// If compose files are specified, use the directory of the first file
-			composePath := composeFiles[0]
+	// If docker-compose files are specified, set them as environment variables
+	if len(composeFiles) > 0 {
+		// Resolve all compose file paths
+		resolvedPaths := make([]string, 0, len(composeFiles))
+		for _, composeFile := range composeFiles {
+			composePath := composeFile
+			// If path is relative, make it relative to LocalPath
 			if !filepath.IsAbs(composePath) {
 				composePath = filepath.Join(cfg.LocalPath, composePath)
 			}
-			workingDir = filepath.Dir(composePath)
+			resolvedPaths = append(resolvedPaths, composePath)
+
+			// Verify docker-compose file exists
+			if _, err := os.Stat(composePath); os.IsNotExist(err) {
+				logger.Infof("Warning: Docker Compose file not found: %s\n", composePath)
+			}
 		}
 
-		// Execute the command
-		cmd := exec.Command("sh", "-c", command)
-		cmd.Dir = workingDir
-		cmd.Env = env
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		// Set environment variables for compose files
+		// BEACON_DOCKER_COMPOSE_FILES: Space-separated list of all files (for docker compose -f usage)
+		env = append(env, fmt.Sprintf("BEACON_DOCKER_COMPOSE_FILES=%s", strings.Join(resolvedPaths, " ")))
+	}
 
-		if err := cmd.Run(); err != nil {
-			logger.Infof("Deploy command failed: %v\n", err)
-			return err
+	// Set working directory to LocalPath
+	workingDir := cfg.LocalPath
+	if len(composeFiles) > 0 {
+		// If compose files are specified, use the directory of the first file
+		composePath := composeFiles[0]
+		if !filepath.IsAbs(composePath) {
+			composePath = filepath.Join(cfg.LocalPath, composePath)
 		}
+		workingDir = filepath.Dir(composePath)
+	}
 
-		logger.Infof("Deploy command completed successfully\n")
+	// Run the deploy pipeline (just the deploy command when no pipeline is declared)
+	pipeline := &pipelineRun{cfg: cfg, run: run, dir: workingDir, env: env, switchCommand: deployCommand}
+	if err := pipeline.execute(); err != nil {
+		logger.Infof("Deploy pipeline failed: %v\n", err)
+		return err
 	}
 
-	// Store the tag
-	status.Set(tag, time.Now())
+	// Store the tag and the digest it resolved to
+	status.SetWithDigest(tag, digest, time.Now())
 
 	logger.Infof("Deployment of Docker image %s:%s complete.\n", client.getFullImageName(), tag)
 	return nil
 }
 
-// pullDockerImage pulls a Docker image from the registry
-func pullDockerImage(imageName string, client *DockerRegistryClient) error {
-	logger.Infof("Pulling Docker image: %s\n", imageName)
-
-	// Build docker pull command
-	cmd := exec.Command("docker", "pull", imageName)
-
-	// Set up authentication if needed
-	if client.username != "" && client.password != "" {
-		// Use docker login if credentials are provided
-		loginCmd := exec.Command("docker", "login", "-u", client.username, "-p", client.password, client.registry)
-		loginCmd.Stdin = strings.NewReader(client.password)
-		if err := loginCmd.Run(); err != nil {
-			logger.Infof("Warning: Docker login failed, trying pull without explicit login: %v\n", err)
+// checkPulledDigest makes sure the image pulled by tag is the one whose signature was
+// verified (the tag could have been re-pushed in between). An empty verified digest
+// means verification is off.
+func checkPulledDigest(rt *container.Runtime, image, verified string) error {
+	if verified == "" {
+		return nil
+	}
+	var local []string
+	if rt != nil {
+		local, _ = rt.ImageDigests(context.Background(), image)
+	}
+	for _, d := range local {
+		if _, digest, _ := strings.Cut(d, "@"); digest == verified {
+			return nil
 		}
 	}
+	return beaconerrors.NewSignatureError("image "+image,
+		fmt.Errorf("pulled image (%s) is not the verified digest %s; was the tag re-pushed?", strings.Join(local, ", "), shortDigest(verified)))
+}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// pullDockerImage pulls an image from the registry with the project's container runtime
+func pullDockerImage(ctx context.Context, rt *container.Runtime, imageName string, client *DockerRegistryClient) error {
+	logger.Infof("Pulling image %s with %s\n", imageName, rt)
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("docker pull failed: %w", err)
+	var auth *container.Auth
+	if client.username != "" && client.password != "" {
+		auth = &container.Auth{Username: client.username, Password: client.password, Registry: client.registry}
+	}
+	if err := rt.Pull(ctx, imageName, auth, os.Stdout); err != nil {
+		return err
 	}
 
-	logger.Infof("Successfully pulled Docker image: %s\n", imageName)
+	logger.Infof("Successfully pulled image: %s\n", imageName)
 	return nil
 }
 
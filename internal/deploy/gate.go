@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/keys"
+	"beacon/internal/state"
+)
+
+// readyCommandTimeout bounds gate.ready_command.
+const readyCommandTimeout = 30 * time.Second
+
+// gatedTrigger reports whether deploys started by trigger go through the deploy gate. Only
+// releases found automatically are held; a deploy someone asked for is theirs to time.
+func gatedTrigger(trigger string) bool {
+	return trigger == state.TriggerPoll || trigger == state.TriggerWebhook
+}
+
+// holdRelease reports whether the project's deploy gate holds a new release found by the
+// poll loop or a webhook. image is the full image name for Docker projects and empty
+// otherwise; target is the commit or digest when known (see composeTarget for compose
+// stacks). The release is recorded as pending (replacing an older pending release of the
+// same image, whose approval does not carry over) so it can be listed and approved;
+// deployRun.finish removes it once it is deployed.
+func holdRelease(cfg *config.Config, trigger, image, tag, target string) bool {
+	if !cfg.Gate.Enabled() || !gatedTrigger(trigger) {
+		return false
+	}
+	var (
+		p          state.PendingRelease
+		fresh      bool
+		prevReason string
+		decided    bool
+	)
+	now := time.Now()
+	hold := func(pending []state.PendingRelease) []state.PendingRelease {
+		idx := -1
+		for i := range pending {
+			if pending[i].Image == image {
+				idx = i
+				break
+			}
+		}
+		fresh = idx < 0 || !pending[idx].Same(image, tag, target)
+		if fresh {
+			entry := state.PendingRelease{Image: image, Tag: tag, Target: target, DetectedAt: now}
+			if idx < 0 {
+				pending = append(pending, entry)
+				idx = len(pending) - 1
+			} else {
+				pending[idx] = entry
+			}
+		}
+		e := &pending[idx]
+		prevReason = e.Reason
+		e.Reason, e.Detail = gateReason(cfg, *e, now)
+		e.NextWindow = nil
+		if len(cfg.Gate.Windows) > 0 {
+			if next := cfg.Gate.NextWindow(now); !next.IsZero() && next.After(now) {
+				e.NextWindow = &next
+			}
+		}
+		p, decided = *e, true
+		return pending
+	}
+	// The lock keeps an approval from being lost to this read-modify-write
+	if err := state.UpdatePendingReleases(projectStateDir(cfg), hold); err != nil {
+		logger.Infof("Failed to record pending release: %v\n", err)
+		if !decided {
+			hold(nil)
+		}
+	}
+
+	if p.Reason == "" {
+		return false
+	}
+	if fresh || p.Reason != prevReason {
+		logger.Infof("Holding %s: %s\n", releaseName(image, tag), DescribeHold(cfg, p))
+	}
+	return true
+}
+
+// gateReason returns why the gate holds release p at now (a state.Hold* constant and any
+// detail), or "" when it may be deployed. The ready command only runs once the release is
+// approved and inside a window.
+func gateReason(cfg *config.Config, p state.PendingRelease, now time.Time) (string, string) {
+	g := cfg.Gate
+	switch {
+	case g.RequireApproval && !p.Approved:
+		return state.HoldApproval, ""
+	case !g.InWindow(now):
+		return state.HoldWindow, ""
+	case g.ReadyCommand != "":
+		if err := runReadyCommand(cfg, p.Image, p.Tag); err != nil {
+			return state.HoldNotReady, err.Error()
+		}
+	}
+	return "", ""
+}
+
+// runReadyCommand runs gate.ready_command; a non-zero exit means the release must wait.
+func runReadyCommand(cfg *config.Config, image, tag string) error {
+	env, err := keys.ResolveEnv(cfg.Env)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), readyCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", secureEnvCommand(cfg, cfg.Gate.ReadyCommand))
+	cmd.Dir = os.TempDir()
+	cmd.Env = append(os.Environ(),
+		"BEACON_PROJECT_NAME="+cfg.ProjectName,
+		"BEACON_DEPLOY_TAG="+tag,
+		"BEACON_DOCKER_IMAGE="+image,
+	)
+	cmd.Env = append(cmd.Env, env.Vars...)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if msg := env.Redact(lastLine(string(out))); msg != "" {
+		return fmt.Errorf("ready command: %s", msg)
+	}
+	return fmt.Errorf("ready command: %w", err)
+}
+
+// PendingReleases returns the releases the deploy gate holds for the project.
+func PendingReleases(cfg *config.Config) ([]state.PendingRelease, error) {
+	return state.ReadPendingReleases(projectStateDir(cfg))
+}
+
+// ApproveReleases approves the releases held for the project, recording by as the approver.
+// The poll loop deploys them once the deploy window is open and the ready command passes.
+func ApproveReleases(cfg *config.Config, by string) ([]state.PendingRelease, error) {
+	return state.ApprovePendingReleases(projectStateDir(cfg), by)
+}
+
+// DescribeHold explains why a pending release is held, as of the last poll.
+func DescribeHold(cfg *config.Config, p state.PendingRelease) string {
+	if p.Approved && p.Reason == state.HoldApproval {
+		p.Reason = ""
+		if !cfg.Gate.InWindow(time.Now()) {
+			p.Reason = state.HoldWindow
+		}
+	}
+	switch p.Reason {
+	case state.HoldApproval:
+		return fmt.Sprintf("waiting for approval (beacon projects approve %s)", projectKey(cfg))
+	case state.HoldWindow:
+		if p.NextWindow == nil {
+			return "outside the deploy windows"
+		}
+		return "outside the deploy windows, next opens " + p.NextWindow.Format("Mon 2006-01-02 15:04 MST")
+	case state.HoldNotReady:
+		if p.Detail != "" {
+			return "not ready: " + p.Detail
+		}
+		return "not ready"
+	}
+	return "deploys with the next poll"
+}
+
+// clearPendingRelease forgets the pending release image:tag once it has been deployed. A
+// pending release other than the one deployed stays pending; one recorded without a target
+// is cleared by any deploy of its tag.
+func clearPendingRelease(cfg *config.Config, image, tag, target string) {
+	dir := projectStateDir(cfg)
+	if pending, err := state.ReadPendingReleases(dir); err != nil || len(pending) == 0 {
+		return
+	}
+	err := state.UpdatePendingReleases(dir, func(pending []state.PendingRelease) []state.PendingRelease {
+		kept := pending[:0]
+		for _, p := range pending {
+			if !p.Same(image, tag, target) && !p.Same(image, tag, "") {
+				kept = append(kept, p)
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		logger.Infof("Failed to clear pending release: %v\n", err)
+	}
+}
+
+// composeTarget identifies a compose release by the digests of its images (one per
+// image, in any order), so a held stack is only approved for the content that was held.
+// Returns "" if a digest is unknown.
+func composeTarget(digests []string) string {
+	if len(digests) == 0 || slices.Contains(digests, "") {
+		return ""
+	}
+	sorted := slices.Sorted(slices.Values(digests))
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// releaseName formats image:tag, or the tag alone.
+func releaseName(image, tag string) string {
+	switch {
+	case image == "" && tag == "":
+		return "the default branch"
+	case image == "":
+		return tag
+	case tag == "":
+		return image
+	}
+	return image + ":" + tag
+}
+
+// lastLine returns the last non-empty line of command output.
+func lastLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
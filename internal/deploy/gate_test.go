@@ -0,0 +1,161 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+func TestGateConfig_Windows(t *testing.T) {
+	g := &config.GateConfig{Timezone: "UTC", Windows: []config.DeployWindow{
+		{Days: []string{"weekdays"}, Start: "02:00", End: "05:00"},
+		{Days: []string{"saturday"}, Start: "23:00", End: "01:00"}, // spans midnight
+	}}
+	if err := g.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	// 2026-10-12 is a Monday
+	for when, want := range map[string]bool{
+		"2026-10-12 03:30": true,
+		"2026-10-12 05:00": false,
+		"2026-10-12 01:59": false,
+		"2026-10-17 03:00": false, // Saturday morning
+		"2026-10-17 23:30": true,
+		"2026-10-18 00:30": true, // Saturday's window, after midnight
+		"2026-10-18 23:30": false,
+	} {
+		if got := g.InWindow(at(when)); got != want {
+			t.Errorf("InWindow(%s) = %v, want %v", when, got, want)
+		}
+	}
+
+	if next := g.NextWindow(at("2026-10-16 06:00")); !next.Equal(at("2026-10-17 23:00")) {
+		t.Errorf("next window after Friday 06:00 = %s", next)
+	}
+	if next := g.NextWindow(at("2026-10-18 02:00")); !next.Equal(at("2026-10-19 02:00")) {
+		t.Errorf("next window after Sunday 02:00 = %s", next)
+	}
+
+	for _, bad := range []config.GateConfig{
+		{Windows: []config.DeployWindow{{Start: "2am", End: "05:00"}}},
+		{Windows: []config.DeployWindow{{Days: []string{"someday"}, Start: "02:00", End: "05:00"}}},
+		{Timezone: "Mars/Olympus"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted", bad)
+		}
+	}
+}
+
+func TestGate_HoldsUntilApproved(t *testing.T) {
+	rs := newReleaseServer(t, []string{"v1.1.0", "v1.0.0"}, false)
+	cfg := newArtifactTestConfig(t, rs.URL)
+	cfg.Gate = &config.GateConfig{RequireApproval: true}
+	status := state.NewStatus(t.TempDir())
+
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+	if tag, _ := status.Get(); tag != "" {
+		t.Fatalf("deployed %s without approval", tag)
+	}
+	pending, err := PendingReleases(cfg)
+	if err != nil || len(pending) != 1 || pending[0].Tag != "v1.1.0" || pending[0].Reason != state.HoldApproval {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+
+	// Deploys started by hand are not gated
+	if err := DeployArtifact(cfg, "v1.0.0", status, state.TriggerCLI); err != nil {
+		t.Fatalf("manual deploy: %v", err)
+	}
+
+	if _, err := ApproveReleases(cfg, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+	if tag, _ := status.Get(); tag != "v1.1.0" {
+		t.Fatalf("approved release not deployed: status tag %q", tag)
+	}
+	if pending, _ := PendingReleases(cfg); len(pending) != 0 {
+		t.Errorf("pending after deploy = %+v", pending)
+	}
+}
+
+func TestGate_ReadyCommandAndWindow(t *testing.T) {
+	rs := newReleaseServer(t, []string{"v1.0.0"}, false)
+	cfg := newArtifactTestConfig(t, rs.URL)
+	cfg.Gate = &config.GateConfig{ReadyCommand: "echo family is home; exit 1"}
+	status := state.NewStatus(t.TempDir())
+
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+	pending, _ := PendingReleases(cfg)
+	if len(pending) != 1 || pending[0].Reason != state.HoldNotReady || !strings.Contains(pending[0].Detail, "family is home") {
+		t.Fatalf("pending = %+v", pending)
+	}
+
+	// A window that is never open now holds the release before the ready command runs
+	now := time.Now().In(time.Local)
+	start := now.Add(2 * time.Hour)
+	cfg.Gate = &config.GateConfig{ReadyCommand: "true", Windows: []config.DeployWindow{{
+		Start: start.Format("15:04"), End: start.Add(time.Hour).Format("15:04"),
+	}}}
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+	pending, _ = PendingReleases(cfg)
+	if len(pending) != 1 || pending[0].Reason != state.HoldWindow || pending[0].NextWindow == nil {
+		t.Fatalf("pending = %+v", pending)
+	}
+
+	cfg.Gate.Windows = nil
+	CheckForNewArtifact(cfg, status, state.TriggerPoll)
+	if tag, _ := status.Get(); tag != "v1.0.0" {
+		t.Errorf("ready release not deployed: status tag %q", tag)
+	}
+}
+
+func TestGate_ApprovalIsForTheHeldDigest(t *testing.T) {
+	cfg := newArtifactTestConfig(t, "")
+	cfg.Gate = &config.GateConfig{RequireApproval: true}
+	const image = "registry.example.com/app"
+
+	if !holdRelease(cfg, state.TriggerPoll, image, "latest", "sha256:aaa") {
+		t.Fatal("release not held for approval")
+	}
+	if _, err := ApproveReleases(cfg, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if holdRelease(cfg, state.TriggerPoll, image, "latest", "sha256:aaa") {
+		t.Fatal("approved release still held")
+	}
+
+	// The tag re-pushed, or its digest unknown: the approval does not carry over
+	for _, target := range []string{"sha256:bbb", ""} {
+		if !holdRelease(cfg, state.TriggerPoll, image, "latest", target) {
+			t.Errorf("target %q deployed on the approval of sha256:aaa", target)
+		}
+		pending, _ := PendingReleases(cfg)
+		if len(pending) != 1 || pending[0].Target != target || pending[0].Approved {
+			t.Errorf("target %q: pending = %+v", target, pending)
+		}
+	}
+}
+
+func TestComposeTarget(t *testing.T) {
+	a := composeTarget([]string{"sha256:aaa", "sha256:bbb"})
+	if a == "" || a != composeTarget([]string{"sha256:bbb", "sha256:aaa"}) {
+		t.Errorf("composeTarget depends on the image order: %q", a)
+	}
+	if a == composeTarget([]string{"sha256:aaa", "sha256:ccc"}) {
+		t.Error("composeTarget ignores a changed digest")
+	}
+	if got := composeTarget([]string{"sha256:aaa", ""}); got != "" {
+		t.Errorf("composeTarget with an unknown digest = %q, want empty", got)
+	}
+}
@@ -0,0 +1,381 @@
+package deploy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+)
+
+// headRef is where the remote's default branch is fetched to in the mirror.
+const headRef = "refs/beacon/head"
+
+// mirrorDir returns the persistent bare mirror for cfg's project (~/.beacon/state/<project>/repo.git).
+func mirrorDir(cfg *config.Config) string {
+	return filepath.Join(projectStateDir(cfg), "repo.git")
+}
+
+// gitMirror fetches releases into a project's bare mirror and checks them out into the
+// project's local path as a worktree, so a deploy only transfers what changed.
+type gitMirror struct {
+	cfg    *config.Config
+	ctx    context.Context
+	dir    string
+	token  string    // Git token for HTTPS remotes, handed to git per command
+	stderr io.Writer // receives git's error output
+}
+
+// fetchResult describes what a checkoutRelease call transferred.
+type fetchResult struct {
+	Commit    string
+	Bytes     int64
+	Duration  time.Duration
+	Signature string // verified signature, when verify.git is configured
+}
+
+// checkoutRelease updates the mirror from cfg.RepoURL, resolves ref (a tag, branch or commit;
+// the default branch when empty), verifies its signature when verify.git is configured and
+// checks it out into cfg.LocalPath.
+func checkoutRelease(ctx context.Context, cfg *config.Config, token, ref string, stderr io.Writer) (fetchResult, error) {
+	m := &gitMirror{cfg: cfg, ctx: ctx, dir: mirrorDir(cfg), token: token, stderr: stderr}
+	start := time.Now()
+
+	if err := m.init(); err != nil {
+		return fetchResult{}, err
+	}
+	before := m.size()
+	if err := m.fetch(ref); err != nil {
+		return fetchResult{}, err
+	}
+	res := fetchResult{Duration: time.Since(start)}
+	if grown := m.size() - before; grown > 0 {
+		res.Bytes = grown
+	}
+
+	commit, err := m.resolve(ref)
+	if err != nil {
+		return res, err
+	}
+	res.Commit = commit
+
+	// Verify before checkout so a refused release never reaches the local path
+	if cfg.Verify != nil && cfg.Verify.Git != nil {
+		sig, err := verifyGitRelease(ctx, cfg, m.dir, ref, commit)
+		if err != nil {
+			return res, err
+		}
+		res.Signature = sig
+	}
+
+	if err := m.checkout(commit); err != nil {
+		return res, err
+	}
+	if cfg.Git.Submodules {
+		if err := m.updateSubmodules(); err != nil {
+			return res, err
+		}
+	}
+	if cfg.Git.LFS {
+		if err := m.worktreeGit(nil, "lfs", "pull"); err != nil {
+			return res, fmt.Errorf("git lfs pull: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// init creates the mirror on first use and points origin at cfg.RepoURL. The URL never
+// carries the token, so earlier mirrors that stored one are rewritten here.
+func (m *gitMirror) init() error {
+	repoURL := m.cfg.RepoURL
+	if _, err := os.Stat(filepath.Join(m.dir, "HEAD")); err != nil {
+		logger.Infof("Creating Git mirror in %s\n", m.dir)
+		if err := os.MkdirAll(filepath.Dir(m.dir), 0755); err != nil {
+			return fmt.Errorf("create mirror directory: %w", err)
+		}
+		if err := m.git("", "init", "--bare", "--quiet", m.dir); err != nil {
+			return fmt.Errorf("init mirror: %w", err)
+		}
+		if err := m.git(m.dir, "remote", "add", "origin", repoURL); err != nil {
+			return fmt.Errorf("add mirror remote: %w", err)
+		}
+	} else if err := m.git(m.dir, "remote", "set-url", "origin", repoURL); err != nil {
+		return fmt.Errorf("update mirror remote: %w", err)
+	}
+
+	if filter := m.cfg.Git.Filter; filter != "" {
+		if err := m.git(m.dir, "config", "remote.origin.promisor", "true"); err != nil {
+			return err
+		}
+		if err := m.git(m.dir, "config", "remote.origin.partialclonefilter", filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch brings the mirror up to date. A full mirror fetches all branches and tags; a shallow
+// mirror (git.depth > 0) fetches only ref, truncated to the configured depth.
+func (m *gitMirror) fetch(ref string) error {
+	args := []string{"fetch", "--quiet", "--force"}
+	if m.cfg.Git.Filter != "" {
+		args = append(args, "--filter="+m.cfg.Git.Filter)
+	}
+
+	depth := m.cfg.Git.Depth
+	if depth <= 0 {
+		args = append(args, "--prune", "--tags", "origin", "+refs/heads/*:refs/heads/*", "+HEAD:"+headRef)
+		if err := m.git(m.dir, args...); err != nil {
+			return fmt.Errorf("fetch: %w", err)
+		}
+		return nil
+	}
+
+	args = append(args, "--depth", strconv.Itoa(depth), "--no-tags", "origin")
+	switch {
+	case ref == "":
+		return m.gitErr("fetch default branch", m.git(m.dir, append(args, "+HEAD:"+headRef)...))
+	case isCommitRef(m.cfg, ref):
+		// Servers only allow fetching full SHAs that are reachable from a ref
+		return m.gitErr("fetch commit "+ref, m.git(m.dir, append(args, ref)...))
+	}
+	if err := m.git(m.dir, append(args, "+refs/tags/"+ref+":refs/tags/"+ref)...); err == nil {
+		return nil
+	}
+	return m.gitErr("fetch "+ref, m.git(m.dir, append(args, "+refs/heads/"+ref+":refs/heads/"+ref)...))
+}
+
+// resolve returns the commit SHA ref points at in the mirror.
+func (m *gitMirror) resolve(ref string) (string, error) {
+	candidates := []string{headRef}
+	if ref != "" {
+		candidates = []string{"refs/tags/" + ref, "refs/heads/" + ref, ref}
+	}
+	for _, c := range candidates {
+		out, err := m.output(m.dir, "rev-parse", "--verify", "--quiet", c+"^{commit}")
+		if err == nil && out != "" {
+			return out, nil
+		}
+	}
+	if ref == "" {
+		return "", fmt.Errorf("default branch not found in mirror")
+	}
+	return "", fmt.Errorf("ref %s not found in repository", ref)
+}
+
+// checkout moves cfg.LocalPath to commit. An existing worktree of the mirror is reused so
+// untracked build artifacts can survive (see git.clean); anything else is replaced.
+func (m *gitMirror) checkout(commit string) error {
+	local := m.cfg.LocalPath
+	env := m.checkoutEnv()
+
+	if m.isWorktree(local) {
+		if err := m.worktreeGit(env, "checkout", "--quiet", "--detach", "--force", commit); err != nil {
+			return fmt.Errorf("checkout %s: %w", commit, err)
+		}
+		var cleanArgs []string
+		switch m.cfg.Git.Clean {
+		case config.GitCleanNone:
+		case config.GitCleanAll:
+			cleanArgs = []string{"clean", "-ffdxq"}
+		default:
+			cleanArgs = []string{"clean", "-ffdq"}
+		}
+		if cleanArgs != nil {
+			if err := m.worktreeGit(nil, cleanArgs...); err != nil {
+				return fmt.Errorf("clean worktree: %w", err)
+			}
+		}
+		return nil
+	}
+
+	// First deploy, or LocalPath still holds a standalone clone from an earlier version
+	if err := os.RemoveAll(local); err != nil {
+		return fmt.Errorf("remove %s: %w", local, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return fmt.Errorf("create parent directory: %w", err)
+	}
+	_ = m.git(m.dir, "worktree", "prune")
+	cmd := m.command(m.dir, "worktree", "add", "--quiet", "--detach", "--force", local, commit)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+	return m.gitErr("add worktree", m.run(cmd))
+}
+
+// isWorktree reports whether dir is a worktree of this mirror.
+func (m *gitMirror) isWorktree(dir string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, ".git"))
+	if err != nil {
+		return false
+	}
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return false
+	}
+	gitdir = filepath.Clean(strings.TrimSpace(gitdir))
+	mirror, err := filepath.Abs(m.dir)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(gitdir, filepath.Join(mirror, "worktrees")+string(filepath.Separator))
+}
+
+// checkoutEnv defers LFS downloads to `git lfs pull`, which reports errors clearly.
+func (m *gitMirror) checkoutEnv() []string {
+	if m.cfg.Git.LFS {
+		return []string{"GIT_LFS_SKIP_SMUDGE=1"}
+	}
+	return nil
+}
+
+func (m *gitMirror) updateSubmodules() error {
+	if err := m.worktreeGit(nil, "submodule", "sync", "--quiet", "--recursive"); err != nil {
+		return fmt.Errorf("sync submodules: %w", err)
+	}
+	args := []string{"submodule", "update", "--quiet", "--init", "--recursive", "--force"}
+	if m.cfg.Git.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(m.cfg.Git.Depth))
+	}
+	if err := m.worktreeGit(m.checkoutEnv(), args...); err != nil {
+		return fmt.Errorf("update submodules: %w", err)
+	}
+	return nil
+}
+
+// size returns the mirror's object store size in bytes (loose objects plus packs).
+func (m *gitMirror) size() int64 {
+	out, err := m.output(m.dir, "count-objects", "-v")
+	if err != nil {
+		return 0
+	}
+	var kib int64
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		key, val, ok := strings.Cut(sc.Text(), ": ")
+		if !ok || (key != "size" && key != "size-pack") {
+			continue
+		}
+		n, _ := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+		kib += n
+	}
+	return kib * 1024
+}
+
+func (m *gitMirror) command(dir string, args ...string) *exec.Cmd {
+	if m.token != "" {
+		// Answer HTTPS credential prompts from the environment so the token never reaches
+		// the mirror's config or the process list
+		args = append([]string{"-c", "credential.helper=", "-c", "credential.helper=" + gitCredentialHelper}, args...)
+	}
+	cmd := exec.CommandContext(m.ctx, "git", args...)
+	cmd.Dir = dir
+	if m.token != "" {
+		cmd.Env = append(os.Environ(), "GIT_USERNAME="+gitTokenUser(m.cfg.RepoURL), "GIT_PASSWORD="+m.token)
+	}
+	return cmd
+}
+
+// gitCredentialHelper answers git's credential requests with GIT_USERNAME and GIT_PASSWORD.
+const gitCredentialHelper = `!f() { test "$1" = get && echo "username=$GIT_USERNAME" && echo "password=$GIT_PASSWORD"; }; f`
+
+// gitTokenUser returns the username that goes with a token for repoURL's host.
+func gitTokenUser(repoURL string) string {
+	if strings.Contains(repoURL, "gitlab.com") {
+		return "oauth2"
+	}
+	return "token"
+}
+
+func (m *gitMirror) git(dir string, args ...string) error {
+	return m.run(m.command(dir, args...))
+}
+
+func (m *gitMirror) worktreeGit(env []string, args ...string) error {
+	cmd := m.command(m.cfg.LocalPath, args...)
+	if env != nil {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+	return m.run(cmd)
+}
+
+// hasCommit reports whether the repository holds commit sha.
+func (m *gitMirror) hasCommit(sha string) bool {
+	_, err := m.output(m.dir, "cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+func (m *gitMirror) output(dir string, args ...string) (string, error) {
+	out, err := m.command(dir, args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// run executes cmd, copying git's error output to m.stderr and into the returned error.
+func (m *gitMirror) run(cmd *exec.Cmd) error {
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if m.stderr != nil && msg != "" {
+			_, _ = io.WriteString(m.stderr, msg+"\n")
+		}
+		if msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *gitMirror) gitErr(what string, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	return nil
+}
+
+// fetchTags brings the mirror's tags up to date, leaving branches to the next deploy.
+func (m *gitMirror) fetchTags() error {
+	args := []string{"fetch", "--quiet", "--force", "--prune", "--no-tags"}
+	if m.cfg.Git.Filter != "" {
+		args = append(args, "--filter="+m.cfg.Git.Filter)
+	}
+	return m.git(m.dir, append(args, "origin", "+refs/tags/*:refs/tags/*")...)
+}
+
+// latestMirrorTag refreshes the mirror's tags and returns the newest one the policy allows.
+// ok is false when there is no mirror yet.
+func latestMirrorTag(cfg *config.Config, token string) (tag string, ok bool) {
+	dir := mirrorDir(cfg)
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return "", false
+	}
+	m := &gitMirror{cfg: cfg, ctx: context.Background(), dir: dir, token: token}
+	if err := m.fetchTags(); err != nil {
+		logger.Infof("Error fetching tags: %v\n", err)
+		return "", true
+	}
+	out, err := m.output(dir, "for-each-ref", "--sort=-creatordate", "--format=%(refname:short)", "refs/tags")
+	if err != nil {
+		logger.Infof("Error getting latest tag: %v\n", err)
+		return "", true
+	}
+	tag, err = selectTag(cfg.Policy, strings.Fields(out))
+	if err != nil {
+		logger.Infof("Error applying deploy policy: %v\n", err)
+		return "", true
+	}
+	return tag, true
+}
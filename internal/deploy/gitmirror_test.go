@@ -0,0 +1,232 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+// newMirrorTestRepo creates a source repository with tags v1 and v2 and returns its file:// URL.
+func newMirrorTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	src := t.TempDir()
+	runGit(t, src, "init", "--quiet", "--initial-branch=main")
+	runGit(t, src, "config", "user.email", "test@example.com")
+	runGit(t, src, "config", "user.name", "test")
+	writeFile(t, filepath.Join(src, ".gitignore"), "node_modules/\n")
+	writeFile(t, filepath.Join(src, "version.txt"), "v1\n")
+	runGit(t, src, "add", ".")
+	// Distinct commit dates so tags sort by creation date deterministically
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-01T00:00:00Z")
+	runGit(t, src, "commit", "--quiet", "-m", "v1")
+	runGit(t, src, "tag", "v1")
+	writeFile(t, filepath.Join(src, "version.txt"), "v2\n")
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-02T00:00:00Z")
+	runGit(t, src, "commit", "--quiet", "-am", "v2")
+	runGit(t, src, "tag", "v2")
+	return "file://" + src
+}
+
+func newMirrorTestConfig(t *testing.T, repoURL string, git config.GitFetchConfig) *config.Config {
+	t.Helper()
+	cfg := newTestConfig(t, "app")
+	cfg.RepoURL, cfg.Git = repoURL, git
+	return cfg
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readVersion(t *testing.T, cfg *config.Config) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(cfg.LocalPath, "version.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestDeploy_MirrorReusesWorktree(t *testing.T) {
+	cfg := newMirrorTestConfig(t, newMirrorTestRepo(t), config.GitFetchConfig{})
+	status := state.NewStatus(t.TempDir())
+
+	if err := Deploy(cfg, "v1", status, state.TriggerManual); err != nil {
+		t.Fatalf("deploy v1: %v", err)
+	}
+	if got := readVersion(t, cfg); got != "v1" {
+		t.Fatalf("version after v1 = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(mirrorDir(cfg), "HEAD")); err != nil {
+		t.Fatalf("mirror not created: %v", err)
+	}
+
+	// Build artifacts: ignored files survive the default clean, untracked ones do not
+	writeFile(t, filepath.Join(cfg.LocalPath, "node_modules", "dep.js"), "x")
+	writeFile(t, filepath.Join(cfg.LocalPath, "stray.txt"), "x")
+
+	if tag := getLatestTagFromRepo(cfg); tag != "v2" {
+		t.Errorf("latest tag = %q, want v2", tag)
+	}
+	if err := Deploy(cfg, "v2", status, state.TriggerManual); err != nil {
+		t.Fatalf("deploy v2: %v", err)
+	}
+	if got := readVersion(t, cfg); got != "v2" {
+		t.Fatalf("version after v2 = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LocalPath, "node_modules", "dep.js")); err != nil {
+		t.Error("ignored file removed from reused worktree")
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LocalPath, "stray.txt")); err == nil {
+		t.Error("untracked file kept in worktree")
+	}
+
+	records, err := ProjectHistory(cfg).List(0)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("history = %d records, %v", len(records), err)
+	}
+	first, second := records[1], records[0]
+	if first.FetchBytes <= 0 || first.FetchDurationMs < 0 {
+		t.Errorf("first fetch stats = %d bytes, %d ms", first.FetchBytes, first.FetchDurationMs)
+	}
+	if second.FromCommit == "" || second.ToCommit == "" || second.FromCommit == second.ToCommit {
+		t.Errorf("commit range = %q..%q", second.FromCommit, second.ToCommit)
+	}
+}
+
+func TestGitMirror_TokenStaysOutOfConfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	cfg := newMirrorTestConfig(t, "https://git.example.com/app.git", config.GitFetchConfig{})
+	m := &gitMirror{cfg: cfg, ctx: context.Background(), dir: mirrorDir(cfg), token: "s3cret"}
+	if err := m.init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if got := runGit(t, m.dir, "config", "--get", "remote.origin.url"); got != cfg.RepoURL {
+		t.Errorf("origin url = %q, want %q", got, cfg.RepoURL)
+	}
+	data, err := os.ReadFile(filepath.Join(m.dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("token stored in mirror config:\n%s", data)
+	}
+
+	// Remote commands get the token from the credential helper instead
+	cmd := m.command(m.dir, "credential", "fill")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=git.example.com\n\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("credential fill: %v", err)
+	}
+	if !strings.Contains(string(out), "username=token\n") || !strings.Contains(string(out), "password=s3cret\n") {
+		t.Errorf("credential fill = %q", out)
+	}
+}
+
+func TestLatestMirrorTag_FetchesTagsOnly(t *testing.T) {
+	repoURL := newMirrorTestRepo(t)
+	cfg := newMirrorTestConfig(t, repoURL, config.GitFetchConfig{})
+	if err := Deploy(cfg, "v1", state.NewStatus(t.TempDir()), state.TriggerManual); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	branch := runGit(t, mirrorDir(cfg), "rev-parse", "refs/heads/main")
+
+	src := strings.TrimPrefix(repoURL, "file://")
+	writeFile(t, filepath.Join(src, "version.txt"), "v3\n")
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-03T00:00:00Z")
+	runGit(t, src, "commit", "--quiet", "-am", "v3")
+	runGit(t, src, "tag", "v3")
+
+	if tag, ok := latestMirrorTag(cfg, ""); !ok || tag != "v3" {
+		t.Errorf("latest tag = %q, %v; want v3", tag, ok)
+	}
+	if got := runGit(t, mirrorDir(cfg), "rev-parse", "refs/heads/main"); got != branch {
+		t.Errorf("tag poll moved main from %s to %s", branch, got)
+	}
+}
+
+func TestDeploy_MirrorReplacesLegacyClone(t *testing.T) {
+	repoURL := newMirrorTestRepo(t)
+	cfg := newMirrorTestConfig(t, repoURL, config.GitFetchConfig{})
+	runGit(t, filepath.Dir(cfg.LocalPath), "clone", "--quiet", repoURL, cfg.LocalPath)
+
+	if err := Deploy(cfg, "v1", state.NewStatus(t.TempDir()), state.TriggerManual); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	m := &gitMirror{cfg: cfg, dir: mirrorDir(cfg)}
+	if !m.isWorktree(cfg.LocalPath) {
+		t.Error("local path is not a worktree of the mirror")
+	}
+	if got := readVersion(t, cfg); got != "v1" {
+		t.Errorf("version = %q", got)
+	}
+}
+
+func TestDeploy_ShallowMirror(t *testing.T) {
+	cfg := newMirrorTestConfig(t, newMirrorTestRepo(t), config.GitFetchConfig{Depth: 1})
+	status := state.NewStatus(t.TempDir())
+
+	if err := Deploy(cfg, "v2", status, state.TriggerManual); err != nil {
+		t.Fatalf("deploy v2: %v", err)
+	}
+	if got := readVersion(t, cfg); got != "v2" {
+		t.Fatalf("version = %q", got)
+	}
+	if shallow := runGit(t, mirrorDir(cfg), "rev-parse", "--is-shallow-repository"); shallow != "true" {
+		t.Errorf("mirror shallow = %s", shallow)
+	}
+	if tags := runGit(t, mirrorDir(cfg), "tag"); tags != "v2" {
+		t.Errorf("mirror tags = %q, want only v2", tags)
+	}
+
+	// Default branch
+	if err := Deploy(cfg, "", status, state.TriggerManual); err != nil {
+		t.Fatalf("deploy default branch: %v", err)
+	}
+	if tag, _ := status.Get(); tag != "default" {
+		t.Errorf("status tag = %q", tag)
+	}
+}
+
+func TestDeploy_CloneMode(t *testing.T) {
+	cfg := newMirrorTestConfig(t, newMirrorTestRepo(t), config.GitFetchConfig{Mode: config.GitModeClone})
+
+	if err := Deploy(cfg, "v1", state.NewStatus(t.TempDir()), state.TriggerManual); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if _, err := os.Stat(mirrorDir(cfg)); !os.IsNotExist(err) {
+		t.Error("clone mode created a mirror")
+	}
+	if fi, err := os.Stat(filepath.Join(cfg.LocalPath, ".git")); err != nil || !fi.IsDir() {
+		t.Error("clone mode did not produce a standalone clone")
+	}
+}
@@ -0,0 +1,204 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/container"
+	"beacon/internal/state"
+)
+
+// ProjectHistory returns the deploy history ledger for cfg's project
+// (~/.beacon/state/<project>/deploy_history.jsonl).
+func ProjectHistory(cfg *config.Config) *state.History {
+	return state.NewHistory(projectStateDir(cfg))
+}
+
+// projectStateDir returns ~/.beacon/state/<project>, where history and deploy progress live.
+func projectStateDir(cfg *config.Config) string {
+	return filepath.Join(getConfigDir(), "state", projectKey(cfg))
+}
+
+func projectKey(cfg *config.Config) string {
+	if cfg.ProjectName != "" {
+		return cfg.ProjectName
+	}
+	return cfg.ProjectDir
+}
+
+// deployRun tracks a single deploy while it executes and records it in the history on finish.
+type deployRun struct {
+	cfg      *config.Config
+	rec      state.DeployRecord
+	target   string // commit or digest being deployed, once known
+	stdout   *state.TailBuffer
+	stderr   *state.TailBuffer
+	hist     *state.History
+	stateDir string
+
+	// ctx is canceled when `beacon projects redeploy --cancel` asks this deploy to stop
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// cancelPollInterval is how often a running deploy checks for a cancellation request.
+const cancelPollInterval = time.Second
+
+func startDeployRun(cfg *config.Config, trigger, tag string, status *state.Status) *deployRun {
+	if trigger == "" {
+		trigger = state.TriggerManual
+	}
+	deploymentType := cfg.DeploymentType
+	if deploymentType == "" {
+		deploymentType = "git"
+	}
+	prevTag, _ := status.Get()
+	started := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &deployRun{
+		cfg: cfg,
+		rec: state.DeployRecord{
+			// ID is set up front so per-stage log files can be named after it
+			ID:          started.UTC().Format("20060102T150405.000Z"),
+			Project:     cfg.ProjectName,
+			Type:        deploymentType,
+			Trigger:     trigger,
+			Tag:         tag,
+			PreviousTag: prevTag,
+			StartedAt:   started,
+		},
+		stdout:   state.NewTailBuffer(state.MaxDeployOutput),
+		stderr:   state.NewTailBuffer(state.MaxDeployOutput),
+		hist:     ProjectHistory(cfg),
+		stateDir: projectStateDir(cfg),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go r.watchCancel()
+	return r
+}
+
+// watchCancel cancels the run's context when a cancellation request for it appears.
+func (r *deployRun) watchCancel() {
+	ticker := time.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			if state.DeployCancelRequested(r.stateDir, r.rec.ID) {
+				logger.Infof("Deploy %s canceled on request\n", r.rec.ID)
+				r.cancel()
+				return
+			}
+		}
+	}
+}
+
+// canceled returns ErrDeployCanceled once the run has been canceled.
+func (r *deployRun) canceled() error {
+	if r.ctx.Err() != nil {
+		return ErrDeployCanceled
+	}
+	return nil
+}
+
+// setStage publishes the stage the deploy is in, for the child health report and beacon status.
+func (r *deployRun) setStage(stage string) {
+	err := state.WriteDeployProgress(r.stateDir, state.DeployProgress{
+		ID:             r.rec.ID,
+		PID:            os.Getpid(),
+		Trigger:        r.rec.Trigger,
+		Tag:            r.rec.Tag,
+		Stage:          stage,
+		StartedAt:      r.rec.StartedAt,
+		StageStartedAt: time.Now(),
+	})
+	if err != nil {
+		logger.Infof("Failed to record deploy progress: %v\n", err)
+	}
+}
+
+// finish completes the record with the outcome of err and appends it to the history.
+func (r *deployRun) finish(err error) {
+	r.cancel()
+	if state.DeployCancelRequested(r.stateDir, r.rec.ID) {
+		_ = state.ClearDeployCancel(r.stateDir)
+	}
+	if cerr := state.ClearDeployProgress(r.stateDir); cerr != nil {
+		logger.Infof("Failed to clear deploy progress: %v\n", cerr)
+	}
+	r.rec.FinishedAt = time.Now()
+	r.rec.DurationMs = r.rec.FinishedAt.Sub(r.rec.StartedAt).Milliseconds()
+	r.rec.Success = err == nil
+	r.rec.Stdout = r.stdout.String()
+	r.rec.Stderr = r.stderr.String()
+	if err != nil {
+		r.rec.Error = err.Error()
+		r.rec.ExitCode = exitCodeOf(err)
+	}
+	if isRefusal(err) {
+		r.rec.Refused = true
+		reportRefusal(r.cfg, r.rec, r.target, err)
+	}
+	if err == nil {
+		// Pending releases are keyed by image for Docker projects only
+		image := ""
+		if r.rec.Type == "docker" {
+			image = r.rec.Image
+		}
+		clearPendingRelease(r.cfg, image, r.rec.Tag, r.target)
+	}
+	if herr := r.hist.Append(r.rec); herr != nil {
+		logger.Infof("Failed to record deploy history: %v\n", herr)
+	}
+}
+
+// exitCodeOf returns the process exit code for exec errors, or -1 for other failures.
+func exitCodeOf(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// gitHead returns the commit SHA checked out in dir, or "" if dir is not a Git work tree.
+func gitHead(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return ""
+	}
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// localImageDigest returns the repo digest (name@sha256:...) the runtime recorded for a pulled
+// image, preferring the one of the image's own repository when it was pulled under several names.
+func localImageDigest(rt *container.Runtime, image string) string {
+	if rt == nil {
+		return ""
+	}
+	digests, err := rt.ImageDigests(context.Background(), image)
+	if err != nil || len(digests) == 0 {
+		return ""
+	}
+	repo, _, _ := parseImageRef(image)
+	for _, d := range digests {
+		if name, _, _ := strings.Cut(d, "@"); name == repo {
+			return d
+		}
+	}
+	return digests[0]
+}
@@ -0,0 +1,202 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+const lockFile = "deploy.lock"
+
+// queuePollInterval is how often a queued deploy retries the project lock.
+const queuePollInterval = 500 * time.Millisecond
+
+var (
+	// ErrDeployInProgress is returned (wrapped in a *BusyError) when another deploy holds the lock.
+	ErrDeployInProgress = errors.New("deploy in progress")
+	// ErrDeploySuperseded is returned to a queued request replaced by a newer one.
+	ErrDeploySuperseded = errors.New("deploy request superseded by a newer request")
+	// ErrDeployCanceled is returned when a running or queued deploy is canceled.
+	ErrDeployCanceled = errors.New("deploy canceled")
+)
+
+// BusyError reports the deploy currently holding a project's deploy lock, or the queued
+// request that takes it next.
+type BusyError struct {
+	Progress *state.DeployProgress // nil if the holder has not reported a stage yet
+	Queued   *state.DeployRequest  // set when the lock is free but a queued request goes first
+}
+
+func (e *BusyError) Error() string {
+	p := e.Progress
+	if p == nil && e.Queued != nil {
+		return fmt.Sprintf("%v: a queued %s request goes first", ErrDeployInProgress, e.Queued.Trigger)
+	}
+	if p == nil {
+		return ErrDeployInProgress.Error()
+	}
+	msg := fmt.Sprintf("deploy in progress: %s for %s (trigger %s", p.Stage, p.StageElapsed().Round(time.Second), p.Trigger)
+	if p.Tag != "" {
+		msg += ", " + p.Tag
+	}
+	return msg + ")"
+}
+
+// Is makes errors.Is(err, ErrDeployInProgress) true for a *BusyError.
+func (e *BusyError) Is(target error) bool {
+	return target == ErrDeployInProgress
+}
+
+// Lock is a held project deploy lock (~/.beacon/state/<project>/deploy.lock). All deploy entry
+// points (poll loop, webhooks, cloud deploy_requested, MCP, beacon projects redeploy) take it,
+// so only one deploy touches a project's local path at a time, across processes.
+type Lock struct {
+	f *os.File
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() {
+	if l != nil && l.f != nil {
+		_ = l.f.Close()
+		l.f = nil
+	}
+}
+
+// TryLock takes the project's deploy lock without waiting. If another deploy holds it, or a
+// request queued by Acquire is about to take it, the error is a *BusyError describing that
+// deploy or request.
+func TryLock(cfg *config.Config) (*Lock, error) {
+	lock, err := tryLock(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// The queued request polls for the lock; do not jump ahead of it in between
+	if req, _ := state.ReadDeployRequest(projectStateDir(cfg)); req != nil {
+		lock.Unlock()
+		return nil, &BusyError{Queued: req}
+	}
+	return lock, nil
+}
+
+// tryLock takes the project's deploy lock without waiting, regardless of queued requests.
+func tryLock(cfg *config.Config) (*Lock, error) {
+	dir := projectStateDir(cfg)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create state directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open deploy lock: %w", err)
+	}
+	ok, err := tryFlock(f)
+	if err != nil || !ok {
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("lock deploy: %w", err)
+		}
+		progress, _ := state.ReadDeployProgress(dir)
+		return nil, &BusyError{Progress: progress}
+	}
+	return &Lock{f: f}, nil
+}
+
+// Acquire takes the project's deploy lock, waiting behind a running deploy (or queued request).
+// The project has a single queue slot: a newer request replaces a waiting one, which then returns
+// ErrDeploySuperseded (latest request wins). CancelDeploy removes the waiting request, which
+// then returns ErrDeployCanceled.
+func Acquire(ctx context.Context, cfg *config.Config, trigger, tag string) (*Lock, error) {
+	lock, err := TryLock(cfg)
+	if !errors.Is(err, ErrDeployInProgress) {
+		return lock, err
+	}
+
+	dir := projectStateDir(cfg)
+	req := state.DeployRequest{
+		ID:          fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano()),
+		PID:         os.Getpid(),
+		Trigger:     trigger,
+		Tag:         tag,
+		RequestedAt: time.Now(),
+	}
+	if err := state.WriteDeployRequest(dir, req); err != nil {
+		return nil, err
+	}
+	logger.Infof("%v; queued %s deploy request\n", err, trigger)
+
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = state.ClearDeployRequest(dir, req.ID)
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		if err := checkQueued(dir, req.ID); err != nil {
+			return nil, err
+		}
+		lock, err := tryLock(cfg)
+		if errors.Is(err, ErrDeployInProgress) {
+			continue
+		}
+		if err != nil {
+			_ = state.ClearDeployRequest(dir, req.ID)
+			return nil, err
+		}
+		// Re-check under the lock: a newer request may have arrived meanwhile
+		if err := checkQueued(dir, req.ID); err != nil {
+			lock.Unlock()
+			return nil, err
+		}
+		_ = state.ClearDeployRequest(dir, req.ID)
+		return lock, nil
+	}
+}
+
+// checkQueued verifies that request id still owns the queue slot.
+func checkQueued(dir, id string) error {
+	current, err := state.ReadDeployRequest(dir)
+	switch {
+	case err != nil:
+		return err
+	case current == nil:
+		return ErrDeployCanceled
+	case current.ID != id:
+		return fmt.Errorf("%w (%s)", ErrDeploySuperseded, current.Trigger)
+	}
+	return nil
+}
+
+// DeployStatus returns the running deploy and the queued request for a project (either may be nil).
+func DeployStatus(cfg *config.Config) (*state.DeployProgress, *state.DeployRequest) {
+	dir := projectStateDir(cfg)
+	progress, _ := state.ReadDeployProgress(dir)
+	queued, _ := state.ReadDeployRequest(dir)
+	return progress, queued
+}
+
+// CancelDeploy cancels the queued request and asks the running deploy to stop. The running
+// deploy stops its current stage, skips the rest and runs on_failure. It reports whether
+// there was anything to cancel.
+func CancelDeploy(cfg *config.Config) (bool, error) {
+	dir := projectStateDir(cfg)
+	progress, queued := DeployStatus(cfg)
+	if queued != nil {
+		if err := state.ClearDeployRequest(dir, queued.ID); err != nil {
+			return false, err
+		}
+	}
+	if progress != nil {
+		if err := state.RequestDeployCancel(dir, progress.ID); err != nil {
+			return false, err
+		}
+	}
+	return progress != nil || queued != nil, nil
+}
@@ -0,0 +1,204 @@
+//go:build unix
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+func TestTryLock_Busy(t *testing.T) {
+	cfg := newTestConfig(t, "app")
+
+	lock, err := TryLock(cfg)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	err = state.WriteDeployProgress(projectStateDir(cfg), state.DeployProgress{
+		ID: "d1", PID: os.Getpid(), Trigger: state.TriggerPoll, Stage: "migrate", StageStartedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = TryLock(cfg)
+	var busy *BusyError
+	if !errors.As(err, &busy) || !errors.Is(err, ErrDeployInProgress) {
+		t.Fatalf("second TryLock error = %v, want BusyError", err)
+	}
+	if busy.Progress == nil || busy.Progress.Stage != "migrate" {
+		t.Errorf("busy progress = %+v", busy.Progress)
+	}
+
+	lock.Unlock()
+	lock, err = TryLock(cfg)
+	if err != nil {
+		t.Fatalf("TryLock after unlock: %v", err)
+	}
+	lock.Unlock()
+}
+
+func TestAcquire_LatestRequestWins(t *testing.T) {
+	cfg := newTestConfig(t, "app")
+	holder, err := TryLock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		lock *Lock
+		err  error
+	}
+	first := make(chan result, 1)
+	go func() {
+		l, err := Acquire(context.Background(), cfg, state.TriggerCloud, "")
+		first <- result{l, err}
+	}()
+	waitForQueued(t, cfg, state.TriggerCloud)
+
+	second := make(chan result, 1)
+	go func() {
+		l, err := Acquire(context.Background(), cfg, state.TriggerCLI, "")
+		second <- result{l, err}
+	}()
+
+	select {
+	case r := <-first:
+		if !errors.Is(r.err, ErrDeploySuperseded) {
+			t.Fatalf("first request: %v, want superseded", r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first request was not superseded")
+	}
+
+	holder.Unlock()
+	select {
+	case r := <-second:
+		if r.err != nil {
+			t.Fatalf("second request: %v", r.err)
+		}
+		r.lock.Unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second request did not get the lock")
+	}
+	if _, queued := DeployStatus(cfg); queued != nil {
+		t.Errorf("queue not cleared: %+v", queued)
+	}
+}
+
+func TestTryLock_QueuedRequestGoesFirst(t *testing.T) {
+	cfg := newTestConfig(t, "app")
+	holder, err := TryLock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := make(chan error, 1)
+	go func() {
+		l, err := Acquire(context.Background(), cfg, state.TriggerCloud, "")
+		if err == nil {
+			l.Unlock()
+		}
+		queued <- err
+	}()
+	waitForQueued(t, cfg, state.TriggerCloud)
+
+	// The lock is free until the queued request polls for it, but TryLock leaves it alone
+	holder.Unlock()
+	if l, err := TryLock(cfg); !errors.Is(err, ErrDeployInProgress) {
+		l.Unlock()
+		t.Fatalf("TryLock jumped the queue: err = %v", err)
+	}
+	select {
+	case err := <-queued:
+		if err != nil {
+			t.Fatalf("queued request: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued request did not get the lock")
+	}
+}
+
+func TestCancelDeploy_Queued(t *testing.T) {
+	cfg := newTestConfig(t, "app")
+	holder, err := TryLock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Acquire(context.Background(), cfg, state.TriggerCLI, "")
+		done <- err
+	}()
+	waitForQueued(t, cfg, state.TriggerCLI)
+
+	if canceled, err := CancelDeploy(cfg); err != nil || !canceled {
+		t.Fatalf("CancelDeploy = %v, %v", canceled, err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrDeployCanceled) {
+			t.Errorf("queued request: %v, want canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued request was not canceled")
+	}
+}
+
+func TestCancelDeploy_Running(t *testing.T) {
+	p, local := newTestPipeline(t, &config.DeployPipeline{
+		Build:     &config.PipelineStage{Command: "sleep 10"},
+		Switch:    &config.PipelineStage{Command: "touch switched"},
+		OnFailure: &config.PipelineStage{Command: "touch cleaned-up"},
+	})
+
+	go func() {
+		for {
+			if progress, _ := state.ReadDeployProgress(p.run.stateDir); progress != nil && progress.Stage == "build" {
+				_, _ = CancelDeploy(p.cfg)
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	err := p.execute()
+	if !errors.Is(err, ErrDeployCanceled) {
+		t.Fatalf("execute error = %v, want canceled", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("cancel took %s", time.Since(start))
+	}
+	if _, err := os.Stat(filepath.Join(local, "switched")); err == nil {
+		t.Error("switch ran after cancel")
+	}
+	if _, err := os.Stat(filepath.Join(local, "cleaned-up")); err != nil {
+		t.Error("on_failure did not run after cancel")
+	}
+	p.run.finish(err)
+	if state.DeployCancelRequested(p.run.stateDir, p.run.rec.ID) {
+		t.Error("cancel request not cleared")
+	}
+}
+
+func waitForQueued(t *testing.T, cfg *config.Config, trigger string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, queued := DeployStatus(cfg); queued != nil && queued.Trigger == trigger {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s request never queued", trigger)
+}
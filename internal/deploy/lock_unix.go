@@ -0,0 +1,19 @@
+//go:build unix
+
+package deploy
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryFlock takes an exclusive, non-blocking lock on f. The lock is released when f is closed,
+// including when the process exits, so a crashed deploy never leaves the project locked.
+func tryFlock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,284 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/keys"
+	"beacon/internal/state"
+)
+
+// stageOrder is the order pipeline stages run in. on_failure runs separately, after a failure.
+var stageOrder = []string{
+	config.StagePreDeploy,
+	config.StageBuild,
+	config.StageMigrate,
+	config.StageSwitch,
+	config.StagePostDeploy,
+}
+
+// stageKillDelay is how long a timed-out stage's output pipes may stay open after the kill.
+const stageKillDelay = 10 * time.Second
+
+// pipelineRun executes the deploy pipeline (cfg.Pipeline) for one deploy.
+type pipelineRun struct {
+	cfg *config.Config
+	run *deployRun
+	dir string   // default working directory for stages
+	env []string // extra KEY=value pairs for every stage (e.g. BEACON_DOCKER_IMAGE)
+
+	// switchCommand is the deploy command used as the switch stage when the pipeline
+	// does not declare one (the classic single deploy_command).
+	switchCommand string
+	// switchFunc, when set, is the built-in switch stage (docker compose pull/up) and
+	// takes precedence over any switch command.
+	switchFunc func(ctx context.Context, env []string, stdout, stderr io.Writer) error
+	// beforeSwitch, when set, runs right before the switch stage (whether or not one is
+	// declared), e.g. to activate an unpacked release. An error fails the deploy.
+	beforeSwitch func() error
+}
+
+// execute runs the stages in order. The first failing stage (without continue_on_error)
+// skips the remaining stages, runs on_failure and fails the deploy.
+func (p *pipelineRun) execute() error {
+	var failed error
+	for _, name := range stageOrder {
+		if name == config.StageSwitch && p.beforeSwitch != nil && failed == nil {
+			if failed = p.run.canceled(); failed == nil {
+				if err := p.beforeSwitch(); err != nil {
+					failed = err
+				}
+			}
+		}
+		st := p.stage(name)
+		builtin := name == config.StageSwitch && p.switchFunc != nil
+		if st == nil && !builtin {
+			continue
+		}
+		if failed == nil {
+			failed = p.run.canceled()
+		}
+		if failed != nil {
+			p.run.rec.Stages = append(p.run.rec.Stages, state.StageRecord{Name: name, Skipped: true})
+			continue
+		}
+		err := p.runStage(name, st)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrDeployCanceled) {
+			failed = err
+			continue
+		}
+		if st != nil && st.ContinueOnError {
+			logger.Infof("Stage %s failed, continuing (continue_on_error): %v\n", name, err)
+			continue
+		}
+		failed = fmt.Errorf("%s stage failed: %w", name, err)
+	}
+
+	if failed != nil {
+		if st := p.cfg.Pipeline.Stage(config.StageOnFailure); st != nil {
+			if err := p.runStage(config.StageOnFailure, st); err != nil {
+				logger.Infof("on_failure stage failed: %v\n", err)
+			}
+		}
+	}
+	return failed
+}
+
+// stage returns the declared stage, falling back to switchCommand for the switch stage.
+func (p *pipelineRun) stage(name string) *config.PipelineStage {
+	if name == config.StageSwitch && p.switchFunc != nil {
+		return nil
+	}
+	if st := p.cfg.Pipeline.Stage(name); st != nil {
+		return st
+	}
+	if name == config.StageSwitch && p.switchCommand != "" {
+		return &config.PipelineStage{Command: p.switchCommand}
+	}
+	return nil
+}
+
+// runStage runs one stage with its timeout, teeing output to the agent's stdout/stderr, the
+// deploy record, a per-stage log file and the stage record.
+func (p *pipelineRun) runStage(name string, st *config.PipelineStage) (err error) {
+	p.run.setStage(name)
+	rec := state.StageRecord{Name: name, StartedAt: time.Now()}
+	tail := state.NewTailBuffer(state.MaxStageOutput)
+
+	stdout := io.MultiWriter(os.Stdout, p.run.stdout, tail)
+	stderr := io.MultiWriter(os.Stderr, p.run.stderr, tail)
+	if logFile, path := p.openStageLog(name); logFile != nil {
+		defer func() { _ = logFile.Close() }()
+		rec.LogFile = path
+		stdout = io.MultiWriter(stdout, logFile)
+		stderr = io.MultiWriter(stderr, logFile)
+	}
+
+	// Secrets from key:// references are decrypted only into the stage's environment and
+	// redacted from everything the stage prints (terminal, history, stage log)
+	env, envErr := p.stageEnv(name, st)
+	redactOut, redactErr := env.Secrets.Writer(stdout), env.Secrets.Writer(stderr)
+	stdout, stderr = redactOut, redactErr
+
+	timeout := p.cfg.Pipeline.StageTimeout(st)
+	// Stages stop when the deploy is canceled; on_failure still runs so it can clean up
+	base := p.run.ctx
+	if name == config.StageOnFailure {
+		base = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(base, timeout)
+	defer cancel()
+
+	defer func() {
+		// Flush held-back output before the tail is recorded
+		_ = redactOut.Close()
+		_ = redactErr.Close()
+		rec.DurationMs = time.Since(rec.StartedAt).Milliseconds()
+		rec.Output = tail.String()
+		rec.Success = err == nil
+		switch {
+		case name != config.StageOnFailure && p.run.canceled() != nil:
+			err = ErrDeployCanceled
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			rec.TimedOut = true
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		if err != nil {
+			rec.Error = err.Error()
+			rec.ExitCode = exitCodeOf(err)
+			rec.Success = false
+		}
+		p.run.rec.Stages = append(p.run.rec.Stages, rec)
+	}()
+
+	if envErr != nil {
+		return envErr
+	}
+	if st == nil {
+		logger.Infof("Running %s stage\n", name)
+		return p.switchFunc(ctx, env.Vars, stdout, stderr)
+	}
+
+	logger.Infof("Running %s stage: %s\n", name, st.Command)
+	cmd := exec.CommandContext(ctx, "sh", "-c", secureEnvCommand(p.cfg, st.Command))
+	cmd.Dir = p.stageDir(st)
+	cmd.Env = env.Vars
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = stageKillDelay
+	SetProcessGroup(cmd)
+	return cmd.Run()
+}
+
+// stageDir resolves the stage working directory (relative paths are under the local path).
+func (p *pipelineRun) stageDir(st *config.PipelineStage) string {
+	switch {
+	case st.WorkingDir == "":
+		return p.dir
+	case filepath.IsAbs(st.WorkingDir):
+		return st.WorkingDir
+	}
+	return filepath.Join(p.cfg.LocalPath, st.WorkingDir)
+}
+
+// stageEnv builds the environment: process env, deploy variables, then the project env,
+// pipeline env and stage env with key:// references resolved.
+func (p *pipelineRun) stageEnv(name string, st *config.PipelineStage) (stageEnv, error) {
+	env := os.Environ()
+	env = append(env,
+		"BEACON_DEPLOY_STAGE="+name,
+		"BEACON_DEPLOY_TAG="+p.run.rec.Tag,
+		"BEACON_DEPLOY_TRIGGER="+p.run.rec.Trigger,
+		"BEACON_PROJECT_NAME="+p.cfg.ProjectName,
+		"BEACON_LOCAL_PATH="+p.cfg.LocalPath,
+	)
+	env = append(env, p.env...)
+
+	maps := []map[string]string{p.cfg.Env}
+	if p.cfg.Pipeline != nil {
+		maps = append(maps, p.cfg.Pipeline.Env)
+	}
+	if st != nil {
+		maps = append(maps, st.Env)
+	}
+	resolved, err := keys.ResolveEnv(maps...)
+	if err != nil {
+		return stageEnv{Vars: env}, fmt.Errorf("resolve %s stage env: %w", name, err)
+	}
+	return stageEnv{Vars: append(env, resolved.Vars...), Secrets: resolved}, nil
+}
+
+// stageEnv is a stage's full environment and the secrets to redact from its output.
+type stageEnv struct {
+	Vars    []string
+	Secrets *keys.Env
+}
+
+// openStageLog creates ~/.beacon/logs/<project>/deploys/<deploy-id>/<stage>.log. The
+// first stage of a deploy prunes the oldest deploys' logs, keeping as many as the history.
+func (p *pipelineRun) openStageLog(name string) (*os.File, string) {
+	deploys := filepath.Join(getConfigDir(), "logs", projectKey(p.cfg), "deploys")
+	dir := filepath.Join(deploys, p.run.rec.ID)
+	_, statErr := os.Stat(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Infof("Failed to create deploy log directory: %v\n", err)
+		return nil, ""
+	}
+	if os.IsNotExist(statErr) {
+		pruneDeployLogs(deploys, state.MaxDeployRecords)
+	}
+	path := filepath.Join(dir, name+".log")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		logger.Infof("Failed to create stage log: %v\n", err)
+		return nil, ""
+	}
+	return f, path
+}
+
+// pruneDeployLogs removes all but the newest keep deploy log directories. Their names are
+// deploy IDs, which sort by start time.
+func pruneDeployLogs(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() {
+			ids = append(ids, e.Name())
+		}
+	}
+	if len(ids) <= keep {
+		return
+	}
+	sort.Strings(ids)
+	for _, id := range ids[:len(ids)-keep] {
+		if err := os.RemoveAll(filepath.Join(dir, id)); err != nil {
+			logger.Infof("Failed to remove old deploy logs: %v\n", err)
+		}
+	}
+}
+
+// secureEnvCommand prefixes command with sourcing of the project's secure env file, if present.
+func secureEnvCommand(cfg *config.Config, command string) string {
+	if cfg.SecureEnvPath == "" {
+		return command
+	}
+	if _, err := os.Stat(cfg.SecureEnvPath); err != nil {
+		logger.Infof("Warning: Secure environment file not found: %s\n", cfg.SecureEnvPath)
+		return command
+	}
+	return fmt.Sprintf("set -a && . %s && set +a && %s", cfg.SecureEnvPath, command)
+}
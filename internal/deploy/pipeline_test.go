@@ -0,0 +1,261 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/keys"
+	"beacon/internal/state"
+)
+
+func newTestPipeline(t *testing.T, pipeline *config.DeployPipeline) (*pipelineRun, string) {
+	t.Helper()
+	cfg := newTestConfig(t, "app")
+	cfg.Pipeline = pipeline
+	if err := os.MkdirAll(cfg.LocalPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	run := startDeployRun(cfg, state.TriggerManual, "v1.0.0", state.NewStatus(t.TempDir()))
+	return &pipelineRun{cfg: cfg, run: run, dir: cfg.LocalPath}, cfg.LocalPath
+}
+
+func stageNames(stages []state.StageRecord) []string {
+	var names []string
+	for _, st := range stages {
+		name := st.Name
+		if st.Skipped {
+			name += "(skipped)"
+		} else if !st.Success {
+			name += "(failed)"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestPipeline_RunsStagesInOrder(t *testing.T) {
+	p, local := newTestPipeline(t, &config.DeployPipeline{
+		Env:        map[string]string{"GREETING": "hello"},
+		PostDeploy: &config.PipelineStage{Command: `echo "$BEACON_DEPLOY_STAGE $GREETING" >> order.txt`},
+		Build:      &config.PipelineStage{Command: `echo "$BEACON_DEPLOY_STAGE $BEACON_DEPLOY_TAG" >> ../order.txt`, WorkingDir: "sub"},
+		PreDeploy:  &config.PipelineStage{Command: `echo "$BEACON_DEPLOY_STAGE $STAGE_VAR" >> order.txt`, Env: map[string]string{"STAGE_VAR": "x"}},
+	})
+	p.switchCommand = `echo "$BEACON_DEPLOY_STAGE" >> order.txt`
+	if err := os.Mkdir(filepath.Join(local, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(local, "order.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "pre_deploy x\nbuild v1.0.0\nswitch\npost_deploy hello\n"
+	if string(data) != want {
+		t.Errorf("order.txt =\n%s\nwant\n%s", data, want)
+	}
+
+	got := strings.Join(stageNames(p.run.rec.Stages), " ")
+	if got != "pre_deploy build switch post_deploy" {
+		t.Errorf("stages = %s", got)
+	}
+	logData, err := os.ReadFile(p.run.rec.Stages[0].LogFile)
+	if err != nil || len(logData) != 0 {
+		// Output went to order.txt, so the stage log exists but is empty
+		t.Errorf("stage log: %q, %v", logData, err)
+	}
+}
+
+func TestPipeline_FailureSkipsAndRunsOnFailure(t *testing.T) {
+	p, local := newTestPipeline(t, &config.DeployPipeline{
+		PreDeploy:  &config.PipelineStage{Command: "echo warming up; exit 3", ContinueOnError: true},
+		Migrate:    &config.PipelineStage{Command: "echo migrating; exit 7"},
+		PostDeploy: &config.PipelineStage{Command: "touch post"},
+		OnFailure:  &config.PipelineStage{Command: "touch rolled-back"},
+	})
+	p.switchCommand = "touch switched"
+
+	err := p.execute()
+	if err == nil || !strings.Contains(err.Error(), "migrate stage failed") {
+		t.Fatalf("execute error = %v, want migrate failure", err)
+	}
+	if code := exitCodeOf(err); code != 7 {
+		t.Errorf("exit code = %d, want 7", code)
+	}
+
+	got := strings.Join(stageNames(p.run.rec.Stages), " ")
+	want := "pre_deploy(failed) migrate(failed) switch(skipped) post_deploy(skipped) on_failure"
+	if got != want {
+		t.Errorf("stages = %s\nwant     %s", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(local, "rolled-back")); err != nil {
+		t.Error("on_failure stage did not run")
+	}
+	for _, f := range []string{"switched", "post"} {
+		if _, err := os.Stat(filepath.Join(local, f)); err == nil {
+			t.Errorf("%s ran after a failed stage", f)
+		}
+	}
+
+	migrate := p.run.rec.Stages[1]
+	if !strings.Contains(migrate.Output, "migrating") {
+		t.Errorf("migrate output = %q", migrate.Output)
+	}
+	logData, _ := os.ReadFile(migrate.LogFile)
+	if !strings.Contains(string(logData), "migrating") {
+		t.Errorf("migrate log = %q", logData)
+	}
+}
+
+func TestPipeline_Timeout(t *testing.T) {
+	p, _ := newTestPipeline(t, &config.DeployPipeline{
+		Build: &config.PipelineStage{Command: "sleep 5", Timeout: 100 * time.Millisecond},
+	})
+
+	start := time.Now()
+	err := p.execute()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("execute error = %v, want timeout", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("timeout not enforced (took %s)", time.Since(start))
+	}
+	if st := p.run.rec.Stages[0]; !st.TimedOut || st.Success {
+		t.Errorf("stage = %+v, want timed out", st)
+	}
+}
+
+func TestPipeline_ProgressCleared(t *testing.T) {
+	p, _ := newTestPipeline(t, &config.DeployPipeline{
+		Migrate: &config.PipelineStage{Command: "true"},
+	})
+	p.run.setStage("clone")
+
+	progress, err := state.ReadDeployProgress(p.run.stateDir)
+	if err != nil || progress == nil || progress.Stage != "clone" || progress.Tag != "v1.0.0" {
+		t.Fatalf("progress = %+v, %v", progress, err)
+	}
+
+	if err := p.execute(); err != nil {
+		t.Fatal(err)
+	}
+	p.run.finish(nil)
+
+	if progress, _ := state.ReadDeployProgress(p.run.stateDir); progress != nil {
+		t.Errorf("progress not cleared: %+v", progress)
+	}
+	records, _ := ProjectHistory(p.cfg).List(1)
+	if len(records) != 1 || len(records[0].Stages) != 1 || records[0].Stages[0].Name != "migrate" {
+		t.Errorf("history = %+v", records)
+	}
+}
+
+func TestLoadDeployFileConfig_Pipeline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deploy.yml")
+	yml := `pipeline:
+  timeout: 5m
+  build: make build
+  migrate:
+    command: ./migrate.sh
+    timeout: 90s
+    continue_on_error: true
+`
+	if err := os.WriteFile(path, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := config.LoadDeployFileConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := dc.Pipeline
+	if st := pl.Stage(config.StageBuild); st == nil || st.Command != "make build" || pl.StageTimeout(st) != 5*time.Minute {
+		t.Errorf("build stage = %+v", st)
+	}
+	if st := pl.Stage(config.StageMigrate); st == nil || !st.ContinueOnError || pl.StageTimeout(st) != 90*time.Second {
+		t.Errorf("migrate stage = %+v", st)
+	}
+	if pl.Stage(config.StageSwitch) != nil {
+		t.Error("undeclared switch stage should be nil")
+	}
+}
+
+func TestPipeline_InjectsAndRedactsSecrets(t *testing.T) {
+	p, local := newTestPipeline(t, &config.DeployPipeline{
+		Build: &config.PipelineStage{Command: `echo "connecting with $DB_PASSWORD"; printf %s "$DB_PASSWORD" > secret.txt`},
+	})
+	p.cfg.Env = map[string]string{"DB_PASSWORD": "key://app-db"}
+	km, err := keys.NewKeyManager(os.Getenv("BEACON_HOME"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := km.AddKey("app-db", "s3cret-pa55", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(local, "secret.txt")); string(data) != "s3cret-pa55" {
+		t.Errorf("stage saw DB_PASSWORD = %q", data)
+	}
+	st := p.run.rec.Stages[0]
+	logData, _ := os.ReadFile(st.LogFile)
+	for name, out := range map[string]string{"record": st.Output, "stage log": string(logData), "deploy stdout": p.run.stdout.String()} {
+		if strings.Contains(out, "s3cret-pa55") || !strings.Contains(out, "connecting with ********") {
+			t.Errorf("%s not redacted: %q", name, out)
+		}
+	}
+}
+
+func TestPipeline_MissingSecretFailsStage(t *testing.T) {
+	p, _ := newTestPipeline(t, &config.DeployPipeline{
+		Build: &config.PipelineStage{Command: "true", Env: map[string]string{"TOKEN": "key://missing"}},
+	})
+	err := p.execute()
+	if err == nil || !strings.Contains(err.Error(), "TOKEN") {
+		t.Fatalf("err = %v, want unresolved TOKEN", err)
+	}
+}
+
+func TestPipeline_PrunesOldDeployLogs(t *testing.T) {
+	p, _ := newTestPipeline(t, &config.DeployPipeline{
+		PreDeploy: &config.PipelineStage{Command: "true"},
+		Build:     &config.PipelineStage{Command: "true"},
+	})
+	deploys := filepath.Join(getConfigDir(), "logs", projectKey(p.cfg), "deploys")
+	for i := range state.MaxDeployRecords + 3 {
+		old := filepath.Join(deploys, fmt.Sprintf("20250101T%06d.000Z", i))
+		if err := os.MkdirAll(old, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	entries, err := os.ReadDir(deploys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != state.MaxDeployRecords {
+		t.Errorf("%d deploy log directories kept, want %d", len(entries), state.MaxDeployRecords)
+	}
+	if entries[0].Name() != "20250101T000004.000Z" {
+		t.Errorf("oldest kept = %s, want the four oldest pruned", entries[0].Name())
+	}
+	// Both stages of the current deploy logged to its directory
+	for _, st := range p.run.rec.Stages {
+		if _, err := os.Stat(st.LogFile); err != nil {
+			t.Errorf("stage log %s: %v", st.Name, err)
+		}
+	}
+}
@@ -0,0 +1,674 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/container"
+	"beacon/internal/keys"
+	"beacon/internal/state"
+)
+
+// planTimeout bounds the registry, API and Git calls made to build a plan.
+const planTimeout = 2 * time.Minute
+
+// maxPlanCommits is how many commits of the pending change a plan lists.
+const maxPlanCommits = 50
+
+// Plan check results
+const (
+	PlanPass  = "pass"  // the check allows the deploy
+	PlanWarn  = "warn"  // worth a look, but the deploy would go ahead
+	PlanBlock = "block" // the deploy would be refused or would fail
+	PlanHold  = "hold"  // the deploy gate would hold the release for now
+	PlanSkip  = "skip"  // not configured for this project
+)
+
+// Plan is what the next deploy of a project would do, resolved without doing it: nothing is
+// checked out, pulled, unpacked or run, and the deploy lock is not taken. A Git plan does
+// refresh the project's mirror, which the next deploy would do anyway.
+type Plan struct {
+	Project   string      `json:"project"`
+	Type      string      `json:"type"`
+	Current   PlanRelease `json:"current"`
+	Candidate PlanRelease `json:"candidate"`
+	// UpToDate is set when the candidate is already deployed: the poll loop would do nothing
+	// (a redeploy would run the pipeline again).
+	UpToDate bool `json:"up_to_date"`
+
+	// Commits lists the pending commits (git log --oneline current..candidate), newest first.
+	Commits          []string    `json:"commits,omitempty"`
+	CommitsTruncated bool        `json:"commits_truncated,omitempty"`
+	DiffStat         string      `json:"diff_stat,omitempty"`
+	Images           []PlanImage `json:"images,omitempty"`
+	Stages           []PlanStage `json:"stages"`
+	Checks           []PlanCheck `json:"checks"`
+	// Blocked is set when a check would stop the deploy.
+	Blocked bool `json:"blocked"`
+	// Held is set when the deploy gate would hold the release (outside the deploy windows,
+	// waiting for approval or not ready); the poll loop deploys it once the gate opens.
+	Held  bool     `json:"held,omitempty"`
+	Notes []string `json:"notes,omitempty"`
+}
+
+// PlanRelease identifies a deployed or candidate release.
+type PlanRelease struct {
+	Tag    string `json:"tag,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Digest string `json:"digest,omitempty"`
+	Asset  string `json:"asset,omitempty"`
+	Size   int64  `json:"size,omitempty"` // asset download size in bytes, when known
+}
+
+// PlanImage is an image the deploy would pull.
+type PlanImage struct {
+	Image         string `json:"image"`
+	Tag           string `json:"tag,omitempty"`
+	CurrentTag    string `json:"current_tag,omitempty"`
+	CurrentDigest string `json:"current_digest,omitempty"`
+	Digest        string `json:"digest,omitempty"`
+	Size          int64  `json:"size,omitempty"` // download size for this platform in bytes
+	Pull          bool   `json:"pull"`           // new content since the last deploy
+	Error         string `json:"error,omitempty"`
+}
+
+// PlanStage is a step the deploy would run, in order. Built-in steps have no command.
+type PlanStage struct {
+	Name            string `json:"name"`
+	Command         string `json:"command,omitempty"`
+	Description     string `json:"description,omitempty"`
+	WorkingDir      string `json:"working_dir,omitempty"`
+	Timeout         string `json:"timeout,omitempty"`
+	ContinueOnError bool   `json:"continue_on_error,omitempty"`
+}
+
+// PlanCheck is the outcome of one policy that could hold or refuse the deploy.
+type PlanCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// check records a policy outcome.
+func (p *Plan) check(name, result, detail string) {
+	p.Checks = append(p.Checks, PlanCheck{Name: name, Result: result, Detail: detail})
+	switch result {
+	case PlanBlock:
+		p.Blocked = true
+	case PlanHold:
+		p.Held = true
+	}
+}
+
+func (p *Plan) note(format string, args ...any) {
+	p.Notes = append(p.Notes, fmt.Sprintf(format, args...))
+}
+
+// PlanDeploy resolves what the next deploy of cfg's project would do: ref is deployed when
+// given (as `redeploy`, MCP and cloud deploys can), otherwise the release the deploy policy
+// selects. status is the project's deploy status.
+func PlanDeploy(cfg *config.Config, ref string, status *state.Status) (*Plan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), planTimeout)
+	defer cancel()
+
+	p := &Plan{Project: projectKey(cfg), Type: cfg.DeploymentType}
+	if p.Type == "" {
+		p.Type = "git"
+	}
+
+	var err error
+	switch p.Type {
+	case "docker":
+		err = p.planDocker(cfg, ref)
+	case "compose":
+		err = p.planCompose(ctx, cfg, status)
+	case "artifact":
+		err = p.planArtifact(ctx, cfg, ref, status)
+	default:
+		err = p.planGit(ctx, cfg, ref, status)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.planStages(cfg)
+	p.checkSecrets(cfg)
+	p.checkGate(cfg, ref)
+	p.checkLock(cfg)
+	p.checkHealth(cfg)
+	return p, nil
+}
+
+// planGit resolves the candidate commit and the pending change in the mirror (or, in clone
+// mode, the existing checkout; before the first clone only the remote is asked). The
+// repository is only fetched into while no deploy holds the project's deploy lock; during a
+// deploy the remote is asked and the repository is only read.
+func (p *Plan) planGit(ctx context.Context, cfg *config.Config, ref string, status *state.Status) error {
+	p.Current.Tag, _ = status.Get()
+	p.Current.Commit = status.Commit()
+	if p.Current.Commit == "" {
+		p.Current.Commit = gitHead(cfg.LocalPath)
+	}
+
+	gitToken, err := getGitToken(cfg)
+	if err != nil {
+		return err
+	}
+	setupGitAuth(cfg, gitToken)
+	repoURL := authenticatedRepoURL(cfg.RepoURL, gitToken)
+
+	lock, err := TryLock(cfg)
+	fetch := err == nil
+	if fetch {
+		defer lock.Unlock()
+	} else {
+		p.note("a deploy is running: the repository is not fetched, the remote is asked instead")
+	}
+	switch {
+	case ref != "":
+	case fetch || cfg.Policy.EffectiveTrack() != config.TrackTag:
+		ref = TargetGitRef(cfg)
+	default:
+		ref = getLatestTagFromRemote(cfg, gitToken) // TargetGitRef fetches the tags
+	}
+	p.Candidate.Tag = ref
+
+	var repo *gitMirror
+	switch {
+	case cfg.Git.EffectiveMode() == config.GitModeMirror:
+		repo = &gitMirror{cfg: cfg, ctx: ctx, dir: mirrorDir(cfg), token: gitToken}
+		if !fetch {
+			break
+		}
+		if err := repo.init(); err != nil {
+			return err
+		}
+		if err := repo.fetch(ref); err != nil {
+			return err
+		}
+		if p.Candidate.Commit, err = repo.resolve(ref); err != nil {
+			return err
+		}
+	case gitHead(cfg.LocalPath) != "":
+		repo = &gitMirror{cfg: cfg, ctx: ctx, dir: cfg.LocalPath}
+		if !fetch {
+			break
+		}
+		if err := repo.git(repo.dir, "fetch", "--quiet", "--tags", "origin"); err != nil {
+			return fmt.Errorf("fetch: %w", err)
+		}
+		if p.Candidate.Commit, err = resolveCloneRef(repo, ref); err != nil {
+			return err
+		}
+	}
+	if p.Candidate.Commit == "" {
+		// First clone, or a deploy is running: nothing is fetched
+		if p.Candidate.Commit, err = lsRemoteCommit(ctx, repoURL, ref); err != nil {
+			return err
+		}
+		if repo != nil && !repo.hasCommit(p.Candidate.Commit) {
+			repo = nil
+		}
+	}
+	p.UpToDate = p.Candidate.Commit != "" && p.Candidate.Commit == p.Current.Commit
+
+	if repo != nil && p.Current.Commit != "" && !p.UpToDate {
+		p.gitChanges(repo)
+	}
+
+	switch {
+	case cfg.Verify == nil || cfg.Verify.Git == nil:
+		p.check("signature", PlanSkip, "verify.git is not configured")
+	case repo == nil:
+		p.check("signature", PlanWarn, "verified once the release is fetched")
+	default:
+		if sig, err := verifyGitRelease(ctx, cfg, repo.dir, ref, p.Candidate.Commit); err != nil {
+			p.check("signature", PlanBlock, err.Error())
+		} else {
+			p.check("signature", PlanPass, sig)
+		}
+	}
+	return nil
+}
+
+// gitChanges lists the commits and the diffstat between the deployed and candidate commits.
+func (p *Plan) gitChanges(repo *gitMirror) {
+	rng := p.Current.Commit + ".." + p.Candidate.Commit
+	log, err := repo.output(repo.dir, "log", "--oneline", "--no-decorate", "-n", strconv.Itoa(maxPlanCommits+1), rng)
+	if err != nil {
+		// A shallow mirror may not hold the deployed commit
+		p.note("commit log unavailable: deployed commit %s is not in the repository", shortCommit(p.Current.Commit))
+		return
+	}
+	if log != "" {
+		p.Commits = strings.Split(log, "\n")
+	}
+	if len(p.Commits) > maxPlanCommits {
+		p.Commits, p.CommitsTruncated = p.Commits[:maxPlanCommits], true
+	}
+	if len(p.Commits) == 0 {
+		p.note("candidate %s is not ahead of the deployed commit (rollback or rewritten history)", shortCommit(p.Candidate.Commit))
+	}
+	if stat, err := repo.output(repo.dir, "diff", "--stat", p.Current.Commit, p.Candidate.Commit); err == nil {
+		p.DiffStat = stat
+	}
+}
+
+// resolveCloneRef resolves ref in a clone-mode checkout after `git fetch --tags origin`.
+func resolveCloneRef(repo *gitMirror, ref string) (string, error) {
+	candidates := []string{"refs/remotes/origin/HEAD"}
+	if ref != "" {
+		candidates = []string{"refs/tags/" + ref, "refs/remotes/origin/" + ref, ref}
+	}
+	for _, c := range candidates {
+		if out, err := repo.output(repo.dir, "rev-parse", "--verify", "--quiet", c+"^{commit}"); err == nil && out != "" {
+			return out, nil
+		}
+	}
+	return "", fmt.Errorf("ref %s not found in %s", gitReleaseName(ref), repo.dir)
+}
+
+// lsRemoteCommit asks the remote which commit ref (the default branch when empty) points at.
+func lsRemoteCommit(ctx context.Context, repoURL, ref string) (string, error) {
+	if ref != "" && fullCommitSHA.MatchString(ref) {
+		return ref, nil
+	}
+	patterns := []string{"HEAD"}
+	if ref != "" {
+		patterns = []string{"refs/tags/" + ref + "^{}", "refs/tags/" + ref, "refs/heads/" + ref}
+	}
+	m := &gitMirror{ctx: ctx}
+	out, err := m.output("", append([]string{"ls-remote", repoURL}, patterns...)...)
+	if err != nil {
+		return "", fmt.Errorf("ls-remote: %w", err)
+	}
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	for _, pat := range patterns {
+		if sha := refs[pat]; sha != "" {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("ref %s not found on remote", gitReleaseName(ref))
+}
+
+// planDocker resolves the tag and digest each watched image would be deployed at.
+func (p *Plan) planDocker(cfg *config.Config, ref string) error {
+	if len(cfg.DockerImages) == 0 {
+		return fmt.Errorf("no Docker images configured")
+	}
+	p.UpToDate = true
+	for i, imgCfg := range cfg.DockerImages {
+		imageStatus := state.NewStatus(imageStatusDir(cfg, imgCfg.Image))
+		client := NewDockerRegistryClient(&imgCfg)
+		img := PlanImage{Image: client.getFullImageName(), CurrentDigest: imageStatus.Digest()}
+		img.CurrentTag, _ = imageStatus.Get()
+
+		img.Tag = ref
+		if img.Tag == "" {
+			img.Tag = imgCfg.Tag
+		}
+		if img.Tag == "" {
+			tag, err := client.getLatestTag(cfg.ImagePolicy(&imgCfg))
+			if err != nil || tag == "" {
+				img.Error = "no tag allowed by the deploy policy"
+				if err != nil {
+					img.Error = err.Error()
+				}
+				p.Images = append(p.Images, img)
+				p.check("release", PlanBlock, img.Image+": "+img.Error)
+				continue
+			}
+			img.Tag = tag
+		}
+		p.resolveImage(client, &img)
+		img.Pull = img.Tag != img.CurrentTag || (img.Digest != "" && img.Digest != img.CurrentDigest)
+		if img.Pull {
+			p.UpToDate = false
+		}
+		p.Images = append(p.Images, img)
+		if i == 0 {
+			p.Current = PlanRelease{Tag: img.CurrentTag, Digest: img.CurrentDigest}
+			p.Candidate = PlanRelease{Tag: img.Tag, Digest: img.Digest}
+		}
+		p.checkImageSignature(cfg, client, img.Image, img.Tag)
+	}
+	if cfg.Verify == nil || cfg.Verify.Image == nil {
+		p.check("signature", PlanSkip, "verify.image is not configured")
+	}
+	return nil
+}
+
+// planCompose resolves the digest of every image in the stack and which ones changed.
+func (p *Plan) planCompose(ctx context.Context, cfg *config.Config, status *state.Status) error {
+	stack := composeStack(cfg)
+	images, err := stack.Images(ctx)
+	if err != nil {
+		return err
+	}
+	_, lastDeployed := status.Get()
+	p.UpToDate = !lastDeployed.IsZero()
+	for _, ref := range images {
+		repo, tag, pinned := parseImageRef(ref)
+		imageStatus := state.NewStatus(imageStatusDir(cfg, ref))
+		if pinned {
+			imageStatus = state.NewStatus(pinnedStatusDir(cfg, repo))
+		}
+		client := registryClientFor(cfg, repo)
+		img := PlanImage{Image: repo, Tag: tag, CurrentDigest: imageStatus.Digest()}
+		img.CurrentTag, _ = imageStatus.Get()
+		if pinned {
+			tag = ref[strings.Index(ref, "@")+1:]
+			img.Digest = tag
+			if size, err := client.imageSize(tag); err == nil {
+				img.Size = size
+			}
+		} else {
+			p.resolveImage(client, &img)
+		}
+		img.Pull = lastDeployed.IsZero() || (img.Digest != "" && img.Digest != img.CurrentDigest)
+		if img.Pull {
+			p.UpToDate = false
+		}
+		p.Images = append(p.Images, img)
+		p.checkImageSignature(cfg, client, ref, tag)
+	}
+	if cfg.Verify == nil || cfg.Verify.Image == nil {
+		p.check("signature", PlanSkip, "verify.image is not configured")
+	}
+	return nil
+}
+
+// resolveImage fills in the platform digest of img.Tag and its download size.
+func (p *Plan) resolveImage(client *DockerRegistryClient, img *PlanImage) {
+	digest, err := client.resolveDigest(img.Tag)
+	if err != nil {
+		img.Error = err.Error()
+		return
+	}
+	img.Digest = digest
+	if size, err := client.imageSize(digest); err == nil {
+		img.Size = size
+	}
+}
+
+// checkImageSignature verifies the cosign signature of image:tag when verify.image is set.
+func (p *Plan) checkImageSignature(cfg *config.Config, client *DockerRegistryClient, image, tag string) {
+	if cfg.Verify == nil || cfg.Verify.Image == nil {
+		return
+	}
+	if _, sig, err := client.verifyImageSignature(tag, cfg.Verify.Image.PublicKey); err != nil {
+		p.check("signature", PlanBlock, err.Error())
+	} else {
+		p.check("signature", PlanPass, image+": "+sig)
+	}
+}
+
+// planArtifact resolves the release and asset that would be downloaded.
+func (p *Plan) planArtifact(ctx context.Context, cfg *config.Config, ref string, status *state.Status) error {
+	src, err := newArtifactSource(cfg)
+	if err != nil {
+		return err
+	}
+	p.Current.Tag, _ = status.Get()
+	p.Current.Digest = status.Digest()
+
+	var rel *artifactRelease
+	if ref == "" {
+		rel, err = src.latest(ctx)
+	} else {
+		rel, err = src.release(ctx, ref)
+	}
+	if err != nil {
+		return err
+	}
+	asset, err := src.pickAsset(rel)
+	if err != nil {
+		return err
+	}
+	p.Candidate = PlanRelease{Tag: rel.Tag, Asset: asset.Name, Size: asset.Size}
+	p.UpToDate = rel.Tag == p.Current.Tag && currentArtifactRelease(cfg) != ""
+
+	switch link := src.checksumURL(rel, asset); {
+	case link != "":
+		p.check("checksum", PlanPass, "verified against "+path.Base(redactURL(link)))
+	case cfg.Artifact.RequireChecksum:
+		p.check("checksum", PlanBlock, fmt.Sprintf("release %s has no checksum file for %s (require_checksum is set)", rel.Tag, asset.Name))
+	default:
+		p.check("checksum", PlanWarn, fmt.Sprintf("release %s publishes no checksum for %s", rel.Tag, asset.Name))
+	}
+	return nil
+}
+
+// planStages lists the built-in steps and pipeline stages in the order a deploy runs them.
+func (p *Plan) planStages(cfg *config.Config) {
+	builtin := func(name, desc string) {
+		p.Stages = append(p.Stages, PlanStage{Name: name, Description: desc})
+	}
+	verify := cfg.Verify != nil && cfg.Verify.Image != nil
+	engine := config.RuntimeDocker
+	if p.Type == "docker" || p.Type == "compose" {
+		if rt, err := container.Detect(cfg.Container); err != nil {
+			p.check("runtime", PlanBlock, err.Error())
+		} else {
+			engine = rt.Name
+			p.check("runtime", PlanPass, rt.String())
+		}
+	}
+	switchCommand := cfg.DeployCommand
+	dir := cfg.LocalPath
+	switch p.Type {
+	case "docker":
+		if verify {
+			builtin("verify", "check cosign signatures in the registry")
+		}
+		builtin("pull", engine+" pull the candidate image")
+		if len(cfg.DockerImages) > 0 && cfg.DockerImages[0].DeployCommand != "" {
+			switchCommand = cfg.DockerImages[0].DeployCommand
+		}
+	case "compose":
+		if verify {
+			builtin("verify", "check cosign signatures in the registry")
+		}
+		switchCommand = ""
+	case "artifact":
+		builtin("fetch", "download "+p.Candidate.Asset)
+		builtin("verify", "check the asset's SHA-256")
+		dir = releaseDir(cfg, p.Candidate.Tag)
+		builtin("unpack", "unpack into "+filepath.Join(artifactReleasesDir, filepath.Base(dir)))
+	default:
+		if cfg.Git.EffectiveMode() == config.GitModeMirror {
+			builtin("fetch", "fetch into the mirror and check out into "+cfg.LocalPath)
+		} else {
+			builtin("clone", "delete "+cfg.LocalPath+" and clone it again")
+		}
+	}
+
+	pr := &pipelineRun{cfg: cfg, dir: dir, switchCommand: switchCommand}
+	for _, name := range stageOrder {
+		if name == config.StageSwitch {
+			switch p.Type {
+			case "compose":
+				builtin(name, engine+" compose pull && "+engine+" compose up -d")
+				continue
+			case "artifact":
+				builtin("activate", "point "+artifactCurrentLink+" at the new release")
+			}
+		}
+		if st := pr.stage(name); st != nil {
+			p.Stages = append(p.Stages, p.pipelineStage(cfg, pr, name, st))
+		}
+	}
+	if st := cfg.Pipeline.Stage(config.StageOnFailure); st != nil {
+		p.Stages = append(p.Stages, p.pipelineStage(cfg, pr, config.StageOnFailure, st))
+	}
+}
+
+func (p *Plan) pipelineStage(cfg *config.Config, pr *pipelineRun, name string, st *config.PipelineStage) PlanStage {
+	return PlanStage{
+		Name:            name,
+		Command:         st.Command,
+		WorkingDir:      pr.stageDir(st),
+		Timeout:         cfg.Pipeline.StageTimeout(st).String(),
+		ContinueOnError: st.ContinueOnError,
+	}
+}
+
+// checkSecrets makes sure every key:// reference in the deploy env resolves.
+func (p *Plan) checkSecrets(cfg *config.Config) {
+	maps := []map[string]string{cfg.Env}
+	if cfg.Pipeline != nil {
+		maps = append(maps, cfg.Pipeline.Env)
+		for _, name := range append(stageOrder, config.StageOnFailure) {
+			if st := cfg.Pipeline.Stage(name); st != nil {
+				maps = append(maps, st.Env)
+			}
+		}
+	}
+	refs := 0
+	for _, m := range maps {
+		for _, v := range m {
+			if keys.IsSecretRef(v) {
+				refs++
+			}
+		}
+	}
+	if refs == 0 {
+		return
+	}
+	if _, err := keys.ResolveEnv(maps...); err != nil {
+		p.check("secrets", PlanBlock, err.Error())
+		return
+	}
+	p.check("secrets", PlanPass, fmt.Sprintf("%d %s reference(s) resolve", refs, keys.SecretPrefix))
+}
+
+// checkLock reports a running or queued deploy the next one would wait for.
+func (p *Plan) checkLock(cfg *config.Config) {
+	running, queued := DeployStatus(cfg)
+	switch {
+	case running != nil:
+		p.check("deploy lock", PlanWarn, fmt.Sprintf("a %s deploy is running (stage %s, started %s); the next deploy waits for it",
+			running.Trigger, running.Stage, running.StartedAt.Local().Format("15:04:05")))
+	case queued != nil:
+		p.check("deploy lock", PlanWarn, fmt.Sprintf("a %s deploy is queued", queued.Trigger))
+	default:
+		p.check("deploy lock", PlanPass, "no deploy running")
+	}
+}
+
+// checkGate reports whether the deploy gate would hold the candidate. Only releases the poll
+// loop finds are gated, so a plan for a given ref skips it. gate.ready_command is not run: a
+// plan must not have side effects.
+func (p *Plan) checkGate(cfg *config.Config, ref string) {
+	g := cfg.Gate
+	switch {
+	case !g.Enabled():
+		p.check("gate", PlanSkip, "no deploy windows or approval configured")
+		return
+	case ref != "":
+		p.check("gate", PlanSkip, "deploys of a given ref are not gated")
+		return
+	case p.UpToDate:
+		p.check("gate", PlanSkip, "nothing new to deploy")
+		return
+	}
+
+	now := time.Now()
+	if len(g.Windows) > 0 {
+		switch next := g.NextWindow(now); {
+		case next.Equal(now):
+			p.check("window", PlanPass, "inside a deploy window")
+		case next.IsZero():
+			p.check("window", PlanHold, "no deploy window ever opens")
+		default:
+			p.check("window", PlanHold, "outside the deploy windows; next opens "+next.Format("Mon 2006-01-02 15:04 MST"))
+		}
+	}
+	if g.RequireApproval {
+		if by := p.approvedBy(cfg); by != "" {
+			p.check("approval", PlanPass, "approved by "+by)
+		} else {
+			p.check("approval", PlanHold, "waiting for approval: beacon projects approve "+p.Project)
+		}
+	}
+	if g.ReadyCommand != "" {
+		p.check("ready", PlanSkip, "the ready command only runs when the poll loop deploys")
+	}
+}
+
+// approvedBy returns who approved the candidate release (for Docker projects, every image
+// that would be pulled), or "" when it has not been approved.
+func (p *Plan) approvedBy(cfg *config.Config) string {
+	pending, err := state.ReadPendingReleases(projectStateDir(cfg))
+	if err != nil {
+		return ""
+	}
+	approved := func(image, tag, target string) string {
+		for _, r := range pending {
+			if r.Approved && r.Same(image, tag, target) {
+				return r.ApprovedBy
+			}
+		}
+		return ""
+	}
+	// The targets are the ones the poll loop holds the release by (see holdRelease)
+	switch p.Type {
+	case "docker":
+		by := ""
+		for _, img := range p.Images {
+			if !img.Pull {
+				continue
+			}
+			if by = approved(img.Image, img.Tag, img.Digest); by == "" {
+				return ""
+			}
+		}
+		return by
+	case "compose":
+		digests := make([]string, 0, len(p.Images))
+		for _, img := range p.Images {
+			digests = append(digests, img.Digest)
+		}
+		return approved("", "", composeTarget(digests))
+	case "git":
+		if cfg.Policy.EffectiveTrack() == config.TrackBranch {
+			return approved("", p.Candidate.Tag, p.Candidate.Commit)
+		}
+	}
+	return approved("", p.Candidate.Tag, "")
+}
+
+// checkHealth reports failing health checks. Deploys are not held back by health; a deploy
+// onto a failing project is worth a second look.
+func (p *Plan) checkHealth(cfg *config.Config) {
+	data, err := os.ReadFile(filepath.Join(projectStateDir(cfg), "checks.json"))
+	var st state.ChecksState
+	if err != nil || json.Unmarshal(data, &st) != nil || len(st.Checks) == 0 {
+		p.check("health", PlanSkip, "no health check results")
+		return
+	}
+	var down []string
+	for _, c := range st.Checks {
+		if c.Status != "up" {
+			down = append(down, c.Name)
+		}
+	}
+	if len(down) > 0 {
+		p.check("health", PlanWarn, fmt.Sprintf("%d of %d checks failing: %s", len(down), len(st.Checks), strings.Join(down, ", ")))
+		return
+	}
+	p.check("health", PlanPass, fmt.Sprintf("all %d checks up", len(st.Checks)))
+}
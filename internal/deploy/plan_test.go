@@ -0,0 +1,125 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+func TestPlanDeploy_GitShowsPendingChange(t *testing.T) {
+	cfg := newMirrorTestConfig(t, newMirrorTestRepo(t), config.GitFetchConfig{})
+	cfg.DeployCommand = "true"
+	status := state.NewStatus(t.TempDir())
+	if err := Deploy(cfg, "v1", status, state.TriggerManual); err != nil {
+		t.Fatalf("deploy v1: %v", err)
+	}
+
+	cfg.DeployCommand = "./deploy.sh"
+	plan, err := PlanDeploy(cfg, "", status)
+	if err != nil {
+		t.Fatalf("PlanDeploy: %v", err)
+	}
+	if plan.Current.Tag != "v1" || plan.Candidate.Tag != "v2" || plan.UpToDate || plan.Blocked {
+		t.Errorf("plan = %+v", plan)
+	}
+	if len(plan.Commits) != 1 || !strings.HasSuffix(plan.Commits[0], " v2") {
+		t.Errorf("commits = %q", plan.Commits)
+	}
+	if !strings.Contains(plan.DiffStat, "version.txt") {
+		t.Errorf("diffstat = %q", plan.DiffStat)
+	}
+	var stages []string
+	for _, st := range plan.Stages {
+		stages = append(stages, st.Name+"="+st.Command)
+	}
+	if got := strings.Join(stages, " "); got != "fetch= switch=./deploy.sh" {
+		t.Errorf("stages = %s", got)
+	}
+	if got := readVersion(t, cfg); got != "v1" {
+		t.Errorf("plan changed the checkout to %s", got)
+	}
+
+	// Planning the deployed release reports it as up to date
+	plan, err = PlanDeploy(cfg, "v1", status)
+	if err != nil {
+		t.Fatalf("PlanDeploy v1: %v", err)
+	}
+	if !plan.UpToDate || len(plan.Commits) != 0 {
+		t.Errorf("plan of deployed release = %+v", plan)
+	}
+}
+
+func TestPlanDeploy_BlockedByUnsignedTag(t *testing.T) {
+	cfg := newMirrorTestConfig(t, newMirrorTestRepo(t), config.GitFetchConfig{})
+	cfg.Verify = &config.VerifyConfig{Git: &config.GitVerifyConfig{}}
+
+	plan, err := PlanDeploy(cfg, "v2", state.NewStatus(t.TempDir()))
+	if err != nil {
+		t.Fatalf("PlanDeploy: %v", err)
+	}
+	if !plan.Blocked {
+		t.Fatalf("unsigned tag not blocked: %+v", plan.Checks)
+	}
+	for _, c := range plan.Checks {
+		if c.Name == "signature" && (c.Result != PlanBlock || !strings.Contains(c.Detail, "lightweight")) {
+			t.Errorf("signature check = %+v", c)
+		}
+	}
+}
+
+func TestPlanDeploy_HeldByGate(t *testing.T) {
+	cfg := newMirrorTestConfig(t, newMirrorTestRepo(t), config.GitFetchConfig{})
+	cfg.Gate = &config.GateConfig{RequireApproval: true}
+
+	plan, err := PlanDeploy(cfg, "", state.NewStatus(t.TempDir()))
+	if err != nil {
+		t.Fatalf("PlanDeploy: %v", err)
+	}
+	if !plan.Held || plan.Blocked {
+		t.Fatalf("plan not held: %+v", plan.Checks)
+	}
+
+	// A plan for a given ref is a manual deploy, which the gate does not hold
+	plan, err = PlanDeploy(cfg, "v2", state.NewStatus(t.TempDir()))
+	if err != nil {
+		t.Fatalf("PlanDeploy v2: %v", err)
+	}
+	if plan.Held {
+		t.Errorf("plan for a ref held: %+v", plan.Checks)
+	}
+}
+
+func TestPlanDeploy_HasNoSideEffects(t *testing.T) {
+	cfg := newMirrorTestConfig(t, newMirrorTestRepo(t), config.GitFetchConfig{})
+	marker := filepath.Join(t.TempDir(), "ran")
+	cfg.Gate = &config.GateConfig{ReadyCommand: "touch " + marker}
+
+	// A running deploy holds the lock: the remote is asked, the mirror is left alone
+	lock, err := TryLock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanDeploy(cfg, "", state.NewStatus(t.TempDir()))
+	lock.Unlock()
+	if err != nil {
+		t.Fatalf("PlanDeploy: %v", err)
+	}
+	if plan.Candidate.Commit == "" {
+		t.Errorf("candidate = %+v", plan.Candidate)
+	}
+	if _, err := os.Stat(mirrorDir(cfg)); !os.IsNotExist(err) {
+		t.Errorf("mirror created during a deploy: %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("plan ran the ready command")
+	}
+	for _, c := range plan.Checks {
+		if c.Name == "ready" && c.Result != PlanSkip {
+			t.Errorf("ready check = %+v", c)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package deploy
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"beacon/internal/config"
+)
+
+var fullCommitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// selectTag returns the newest tag allowed by policy, or "" if none qualifies.
+// tags must be ordered newest first; with a version constraint they are re-ordered by semver.
+func selectTag(policy config.DeployPolicy, tags []string) (string, error) {
+	candidates, err := filterTags(policy, tags)
+	if err != nil || len(candidates) == 0 {
+		return "", err
+	}
+	if policy.Version != "" {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			vi, _ := parseSemver(candidates[i])
+			vj, _ := parseSemver(candidates[j])
+			return vi.compare(vj) > 0
+		})
+	}
+	return candidates[0], nil
+}
+
+// filterTags applies the policy's regex, pre-release and version constraint filters, keeping order.
+func filterTags(policy config.DeployPolicy, tags []string) ([]string, error) {
+	var include, exclude *regexp.Regexp
+	var err error
+	if policy.TagPattern != "" {
+		if include, err = regexp.Compile(policy.TagPattern); err != nil {
+			return nil, fmt.Errorf("invalid tag_pattern %q: %w", policy.TagPattern, err)
+		}
+	}
+	if policy.ExcludePattern != "" {
+		if exclude, err = regexp.Compile(policy.ExcludePattern); err != nil {
+			return nil, fmt.Errorf("invalid exclude_pattern %q: %w", policy.ExcludePattern, err)
+		}
+	}
+	var constraint *versionConstraint
+	if policy.Version != "" {
+		if constraint, err = parseConstraint(policy.Version); err != nil {
+			return nil, err
+		}
+	}
+	allowPre := policy.AllowsPrerelease()
+
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if include != nil && !include.MatchString(tag) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(tag) {
+			continue
+		}
+		v, isSemver := parseSemver(tag)
+		if isSemver && v.isPrerelease() && !allowPre {
+			continue
+		}
+		if constraint != nil && (!isSemver || !constraint.matches(v)) {
+			continue
+		}
+		out = append(out, tag)
+	}
+	return out, nil
+}
+
+// isCommitRef reports whether ref names a commit rather than a tag or branch.
+func isCommitRef(cfg *config.Config, ref string) bool {
+	if ref == "" {
+		return false
+	}
+	if cfg.Policy.Commit != "" && ref == cfg.Policy.Commit {
+		return true
+	}
+	return fullCommitSHA.MatchString(ref)
+}
+
+// remoteBranchHead returns the commit SHA at the head of branch on the remote.
+func remoteBranchHead(cfg *config.Config, gitToken, branch string) (string, error) {
+	repoURL := authenticatedRepoURL(cfg.RepoURL, gitToken)
+	out, err := exec.Command("git", "ls-remote", repoURL, "refs/heads/"+branch).Output()
+	if err != nil {
+		return "", fmt.Errorf("ls-remote %s: %w", branch, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("branch %q not found on remote", branch)
+	}
+	return fields[0], nil
+}
+
+// TargetGitRef returns the ref the deploy policy currently points at: the tracked branch,
+// the pinned commit, or the newest tag allowed by the policy ("" = default branch).
+func TargetGitRef(cfg *config.Config) string {
+	switch cfg.Policy.EffectiveTrack() {
+	case config.TrackBranch:
+		return cfg.Policy.Branch
+	case config.TrackCommit:
+		return cfg.Policy.Commit
+	}
+	return LatestGitTag(cfg)
+}
@@ -0,0 +1,148 @@
+package deploy
+
+import (
+	"testing"
+
+	"beacon/internal/config"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestParseSemverCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"1.2", "1.2.0", 0},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"2.0.0+build.5", "2.0.0", 0},
+	}
+	for _, tt := range tests {
+		a, ok := parseSemver(tt.a)
+		if !ok {
+			t.Fatalf("parseSemver(%q) failed", tt.a)
+		}
+		b, ok := parseSemver(tt.b)
+		if !ok {
+			t.Fatalf("parseSemver(%q) failed", tt.b)
+		}
+		if got := a.compare(b); got != tt.want {
+			t.Errorf("compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"latest", "main", "1.2.3.4", "v", "1.x"} {
+		if _, ok := parseSemver(bad); ok {
+			t.Errorf("parseSemver(%q) should fail", bad)
+		}
+	}
+}
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"~1.4", "1.4.0", true},
+		{"~1.4", "1.4.9", true},
+		{"~1.4", "1.5.0", false},
+		{"~1.4.2", "1.4.1", false},
+		{"~1", "1.9.0", true},
+		{"^2", "2.7.1", true},
+		{"^2", "3.0.0", false},
+		{"^0.3.1", "0.3.9", true},
+		{"^0.3.1", "0.4.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{">=1.2 <2", "1.2.0", true},
+		{">=1.2 <2", "1.99.0", true},
+		{">=1.2 <2", "2.0.0", false},
+		{">=1.2, <2", "1.1.9", false},
+		{">= 1.2 < 2", "1.5.0", true},
+		{"1.x", "1.8.0", true},
+		{"1.x", "2.0.0", false},
+		{"1.4", "1.4.7", true},
+		{"1.4.2", "1.4.2", true},
+		{"1.4.2", "1.4.3", false},
+		{">1.4", "1.4.9", false},
+		{">1.4", "1.5.0", true},
+		{"<=1.4", "1.4.9", true},
+		{"<=1.4", "1.5.0", false},
+		{"!=1.2.3", "1.2.3", false},
+		{"1.x || >=3", "3.1.0", true},
+		{"1.x || >=3", "2.1.0", false},
+		{"*", "9.9.9", true},
+	}
+	for _, tt := range tests {
+		c, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("parseConstraint(%q): %v", tt.constraint, err)
+		}
+		v, ok := parseSemver(tt.version)
+		if !ok {
+			t.Fatalf("parseSemver(%q) failed", tt.version)
+		}
+		if got := c.matches(v); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"~", ">=abc", "1.2.3.4", "||"} {
+		if _, err := parseConstraint(bad); err == nil {
+			t.Errorf("parseConstraint(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSelectTag(t *testing.T) {
+	// Newest first, as returned by git for-each-ref --sort=-creatordate
+	tags := []string{"v2.0.0-rc.1", "v1.5.1", "v2.0.0-beta", "v1.4.3", "v1.4.2", "nightly", "v1.3.0"}
+
+	tests := []struct {
+		name   string
+		policy config.DeployPolicy
+		want   string
+	}{
+		{"no policy keeps newest", config.DeployPolicy{}, "v2.0.0-rc.1"},
+		{"exclude prerelease", config.DeployPolicy{IncludePrerelease: boolPtr(false)}, "v1.5.1"},
+		{"patch releases of 1.4", config.DeployPolicy{Version: "~1.4"}, "v1.4.3"},
+		{"major 1", config.DeployPolicy{Version: "^1"}, "v1.5.1"},
+		{"constraint with prerelease", config.DeployPolicy{Version: ">=2.0.0-alpha", IncludePrerelease: boolPtr(true)}, "v2.0.0-rc.1"},
+		{"regex filter", config.DeployPolicy{TagPattern: "^nightly$"}, "nightly"},
+		{"exclude regex", config.DeployPolicy{ExcludePattern: "-(rc|beta)"}, "v1.5.1"},
+		{"nothing matches", config.DeployPolicy{Version: "^3"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectTag(tt.policy, tags)
+			if err != nil {
+				t.Fatalf("selectTag: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("selectTag = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := selectTag(config.DeployPolicy{TagPattern: "("}, tags); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
+
+func TestIsCommitRef(t *testing.T) {
+	cfg := &config.Config{Policy: config.DeployPolicy{Commit: "3f2c1d0"}}
+	if !isCommitRef(cfg, "3f2c1d0") {
+		t.Error("pinned short SHA should be a commit ref")
+	}
+	if !isCommitRef(cfg, "0123456789abcdef0123456789abcdef01234567") {
+		t.Error("full SHA should be a commit ref")
+	}
+	if isCommitRef(cfg, "v1.2.3") || isCommitRef(cfg, "main") || isCommitRef(cfg, "") {
+		t.Error("tags and branches are not commit refs")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package deploy
+
+import "os/exec"
+
+// SetProcessGroup is a no-op where process groups are unavailable; cancellation kills only the shell.
+func SetProcessGroup(cmd *exec.Cmd) {}
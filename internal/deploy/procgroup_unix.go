@@ -0,0 +1,17 @@
+//go:build unix
+
+package deploy
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetProcessGroup runs cmd in its own process group and makes context cancellation kill the
+// whole group, so a timed-out stage does not leave children of `sh -c` running.
+func SetProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
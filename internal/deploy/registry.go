@@ -0,0 +1,311 @@
+package deploy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Manifest media types accepted when resolving a tag's digest.
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestAccept = strings.Join([]string{
+	mediaTypeDockerManifestList,
+	mediaTypeOCIIndex,
+	mediaTypeDockerManifest,
+	mediaTypeOCIManifest,
+}, ", ")
+
+// manifestResponse covers both single-image manifests and manifest lists / OCI indexes.
+type manifestResponse struct {
+	MediaType string `json:"mediaType"`
+	Manifests []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Platform  *struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+			Variant      string `json:"variant"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// resolveDigest returns the content digest of tag for this host's platform.
+// For multi-arch images the manifest list is resolved to the linux/GOARCH entry,
+// so a re-push that only touches other architectures does not trigger a deploy.
+func (c *DockerRegistryClient) resolveDigest(tag string) (string, error) {
+	var lastErr error
+	for _, base := range c.registryBaseURLs() {
+		manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", base, c.repositoryPath(), url.PathEscape(tag))
+		body, digest, err := c.getManifest(manifestURL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return pickPlatformDigest(body, digest, runtime.GOARCH)
+	}
+	if lastErr != nil {
+		return "", lastErr
+	}
+	return "", fmt.Errorf("failed to resolve digest for %s:%s", c.image, tag)
+}
+
+// goarm is the ARM version beacon was built for (GOARM, "7" when not recorded). A build for
+// an older ARM runs on this host, so on 32-bit ARM it selects the image variant.
+var goarm = func() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "GOARM" && s.Value != "" {
+				return s.Value[:1] // "6,softfloat" -> "6"
+			}
+		}
+	}
+	return "7"
+}()
+
+// pickPlatformDigest returns the digest for arch from a manifest list, or the manifest's
+// own digest when it is a single-image manifest.
+func pickPlatformDigest(body []byte, digest, arch string) (string, error) {
+	var m manifestResponse
+	if err := json.Unmarshal(body, &m); err != nil {
+		return "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if len(m.Manifests) == 0 {
+		if digest == "" {
+			return "", fmt.Errorf("registry did not return a Docker-Content-Digest header")
+		}
+		return digest, nil
+	}
+
+	wantVariant := map[string]string{"arm64": "v8", "arm": "v" + goarm}[arch]
+	var match string
+	for _, entry := range m.Manifests {
+		p := entry.Platform
+		if p == nil || p.OS != "linux" || p.Architecture != arch {
+			continue
+		}
+		if p.Variant == wantVariant {
+			return entry.Digest, nil
+		}
+		if match == "" {
+			match = entry.Digest
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("no manifest for linux/%s in manifest list", arch)
+	}
+	return match, nil
+}
+
+// imageSize returns the download size of the image manifest digest (config plus compressed
+// layers), as reported by the registry.
+func (c *DockerRegistryClient) imageSize(digest string) (int64, error) {
+	var lastErr error
+	for _, base := range c.registryBaseURLs() {
+		body, _, err := c.getManifest(fmt.Sprintf("%s/v2/%s/manifests/%s", base, c.repositoryPath(), digest))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var m struct {
+			Config struct {
+				Size int64 `json:"size"`
+			} `json:"config"`
+			Layers []struct {
+				Size int64 `json:"size"`
+			} `json:"layers"`
+		}
+		if err := json.Unmarshal(body, &m); err != nil {
+			return 0, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		size := m.Config.Size
+		for _, l := range m.Layers {
+			size += l.Size
+		}
+		return size, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no registry endpoint")
+	}
+	return 0, lastErr
+}
+
+// getManifest fetches a manifest, answering a Bearer token challenge if the registry sends one.
+func (c *DockerRegistryClient) getManifest(manifestURL string) ([]byte, string, error) {
+	resp, err := c.authorizedGet(manifestURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("registry returned status %d for manifest: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// authorizedGet sends a GET to the registry API, answering a Bearer token challenge if the
+// registry sends one. The caller closes the response body.
+func (c *DockerRegistryClient) authorizedGet(rawURL string) (*http.Response, error) {
+	resp, err := c.doRegistryRequest(rawURL, c.getAuthHeader())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := c.fetchBearerToken(challenge)
+		if err != nil {
+			return nil, err
+		}
+		return c.doRegistryRequest(rawURL, "Bearer "+token)
+	}
+	return resp, nil
+}
+
+func (c *DockerRegistryClient) doRegistryRequest(rawURL, authHeader string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", manifestAccept)
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry API: %w", err)
+	}
+	return resp, nil
+}
+
+// fetchBearerToken implements the registry token flow described by a
+// `WWW-Authenticate: Bearer realm="...",service="...",scope="..."` challenge.
+func (c *DockerRegistryClient) fetchBearerToken(challenge string) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return "", fmt.Errorf("registry requires authentication (challenge: %q)", challenge)
+	}
+
+	q := url.Values{}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", c.repositoryPath())
+	}
+	q.Set("scope", scope)
+
+	req, err := http.NewRequest("GET", params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	if c.username != "" && c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	} else if c.token != "" {
+		// GHCR and similar accept a PAT as the basic-auth password
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("beacon:"+c.token)))
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	if tok.Token != "" {
+		return tok.Token, nil
+	}
+	if tok.AccessToken != "" {
+		return tok.AccessToken, nil
+	}
+	return "", fmt.Errorf("token endpoint returned no token")
+}
+
+// parseAuthChallenge splits `Bearer realm="x",service="y"` into its scheme and parameters.
+func parseAuthChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			params[strings.ToLower(key)] = value
+		}
+	}
+	return scheme, params
+}
+
+// registryBaseURLs returns the API endpoints to try for this registry.
+// Docker Hub's v2 API lives on registry-1.docker.io; other registries are tried
+// over https first and plain http second (like listTagsViaAPI).
+func (c *DockerRegistryClient) registryBaseURLs() []string {
+	if c.isDockerHub() {
+		return []string{"https://registry-1.docker.io"}
+	}
+	return []string{"https://" + c.registry, "http://" + c.registry}
+}
+
+// repositoryPath returns the repository name as used by the v2 API
+// (official Docker Hub images live under "library/").
+func (c *DockerRegistryClient) repositoryPath() string {
+	if c.isDockerHub() && !strings.Contains(c.image, "/") {
+		return "library/" + c.image
+	}
+	return c.image
+}
+
+func (c *DockerRegistryClient) isDockerHub() bool {
+	return c.registry == "docker.io" || c.registry == "registry-1.docker.io"
+}
+
+func (c *DockerRegistryClient) httpClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// shortDigest trims "sha256:" and shortens a digest for log output.
+func shortDigest(digest string) string {
+	d := strings.TrimPrefix(digest, "sha256:")
+	if len(d) > 12 {
+		d = d[:12]
+	}
+	return d
+}
@@ -0,0 +1,128 @@
+package deploy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"beacon/internal/config"
+)
+
+const testManifestList = `{
+  "mediaType": "application/vnd.oci.image.index.v1+json",
+  "manifests": [
+    {"digest": "sha256:amd64", "platform": {"architecture": "amd64", "os": "linux"}},
+    {"digest": "sha256:armv6", "platform": {"architecture": "arm", "os": "linux", "variant": "v6"}},
+    {"digest": "sha256:armv7", "platform": {"architecture": "arm", "os": "linux", "variant": "v7"}},
+    {"digest": "sha256:arm64", "platform": {"architecture": "arm64", "os": "linux", "variant": "v8"}},
+    {"digest": "sha256:attest", "platform": {"architecture": "unknown", "os": "unknown"}}
+  ]
+}`
+
+func TestPickPlatformDigest(t *testing.T) {
+	tests := []struct {
+		arch string
+		want string
+	}{
+		{"amd64", "sha256:amd64"},
+		{"arm", "sha256:armv7"},
+		{"arm64", "sha256:arm64"},
+	}
+	for _, tt := range tests {
+		got, err := pickPlatformDigest([]byte(testManifestList), "sha256:list", tt.arch)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.arch, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.arch, got, tt.want)
+		}
+	}
+
+	// A build for ARMv6 picks the v6 image
+	old := goarm
+	goarm = "6"
+	got, err := pickPlatformDigest([]byte(testManifestList), "sha256:list", "arm")
+	goarm = old
+	if err != nil || got != "sha256:armv6" {
+		t.Errorf("arm (GOARM=6): got %q, %v", got, err)
+	}
+
+	if _, err := pickPlatformDigest([]byte(testManifestList), "sha256:list", "riscv64"); err == nil {
+		t.Error("expected error for missing platform")
+	}
+
+	single := `{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "layers": []}`
+	got, err = pickPlatformDigest([]byte(single), "sha256:single", "amd64")
+	if err != nil || got != "sha256:single" {
+		t.Errorf("single manifest: got %q, %v", got, err)
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`)
+	if scheme != "Bearer" {
+		t.Errorf("scheme = %q", scheme)
+	}
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/nginx:pull",
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("%s = %q, want %q", k, params[k], v)
+		}
+	}
+}
+
+func TestResolveDigest_TokenChallenge(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:acme/app:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token":"t0ken"}`)
+		case r.URL.Path == "/v2/acme/app/manifests/latest":
+			if r.Header.Get("Authorization") != "Bearer t0ken" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), mediaTypeOCIIndex) {
+				t.Errorf("Accept header missing OCI index: %q", r.Header.Get("Accept"))
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:list")
+			fmt.Fprint(w, `{"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	client := NewDockerRegistryClient(&config.DockerImageConfig{Image: host + "/acme/app", Registry: host})
+
+	digest, err := client.resolveDigest("latest")
+	if err != nil {
+		t.Fatalf("resolveDigest: %v", err)
+	}
+	if digest != "sha256:list" {
+		t.Errorf("digest = %q, want sha256:list", digest)
+	}
+}
+
+func TestRepositoryPath_DockerHubOfficialImage(t *testing.T) {
+	c := NewDockerRegistryClient(&config.DockerImageConfig{Image: "nextcloud"})
+	if got := c.repositoryPath(); got != "library/nextcloud" {
+		t.Errorf("repositoryPath = %q, want library/nextcloud", got)
+	}
+	c = NewDockerRegistryClient(&config.DockerImageConfig{Image: "homeassistant/home-assistant"})
+	if got := c.repositoryPath(); got != "homeassistant/home-assistant" {
+		t.Errorf("repositoryPath = %q", got)
+	}
+}
@@ -0,0 +1,286 @@
+package deploy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semVersion is a parsed semantic version (https://semver.org). Build metadata is ignored.
+type semVersion struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// parseSemver parses tags like "v1.2.3", "1.2", "2.0.0-rc.1+build.5".
+// Missing minor/patch components default to zero.
+func parseSemver(tag string) (semVersion, bool) {
+	s := strings.TrimPrefix(strings.TrimSpace(tag), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var v semVersion
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if i == len(s)-1 {
+			return semVersion{}, false
+		}
+		v.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return semVersion{}, false
+	}
+	nums := [3]int{}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semVersion{}, false
+		}
+		nums[i] = n
+	}
+	v.major, v.minor, v.patch = nums[0], nums[1], nums[2]
+	return v, true
+}
+
+func (v semVersion) isPrerelease() bool {
+	return len(v.prerelease) > 0
+}
+
+// compare returns -1, 0 or 1 following semver precedence rules.
+func (v semVersion) compare(o semVersion) int {
+	for _, d := range [3]int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			if d > 0 {
+				return 1
+			}
+			return -1
+		}
+	}
+	// A version without pre-release has higher precedence than one with.
+	switch {
+	case len(v.prerelease) == 0 && len(o.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(o.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(o.prerelease); i++ {
+		a, b := v.prerelease[i], o.prerelease[i]
+		if a == b {
+			continue
+		}
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an > bn {
+				return 1
+			}
+			return -1
+		case aErr == nil: // numeric identifiers sort before alphanumeric
+			return -1
+		case bErr == nil:
+			return 1
+		case a > b:
+			return 1
+		default:
+			return -1
+		}
+	}
+	switch {
+	case len(v.prerelease) > len(o.prerelease):
+		return 1
+	case len(v.prerelease) < len(o.prerelease):
+		return -1
+	}
+	return 0
+}
+
+// versionConstraint is a parsed constraint such as "~1.4", "^2", ">=1.2 <2" or "1.x || >=3".
+// Space or comma separated terms are ANDed; "||" separates OR groups.
+type versionConstraint struct {
+	raw    string
+	groups [][]versionBound
+}
+
+type versionBound struct {
+	op string // "=", "!=", ">", ">=", "<", "<="
+	v  semVersion
+}
+
+// parseConstraint parses a version constraint expression.
+func parseConstraint(expr string) (*versionConstraint, error) {
+	c := &versionConstraint{raw: expr}
+	for _, group := range strings.Split(expr, "||") {
+		terms := strings.FieldsFunc(group, func(r rune) bool { return r == ' ' || r == ',' })
+		terms = joinOperators(terms)
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid version constraint %q: empty term", expr)
+		}
+		var bounds []versionBound
+		for _, term := range terms {
+			b, err := parseConstraintTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %q: %w", expr, err)
+			}
+			bounds = append(bounds, b...)
+		}
+		c.groups = append(c.groups, bounds)
+	}
+	return c, nil
+}
+
+// joinOperators merges a bare operator with the version that follows it (">= 1.2" -> ">=1.2").
+func joinOperators(terms []string) []string {
+	out := make([]string, 0, len(terms))
+	for i := 0; i < len(terms); i++ {
+		t := terms[i]
+		if strings.Trim(t, "<>=!~^") == "" && i+1 < len(terms) {
+			t += terms[i+1]
+			i++
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// parseConstraintTerm expands one term into lower/upper bounds.
+func parseConstraintTerm(term string) ([]versionBound, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(term, prefix) {
+			op = prefix
+			term = strings.TrimSpace(term[len(prefix):])
+			break
+		}
+	}
+	if term == "*" || term == "x" || term == "X" {
+		return nil, nil
+	}
+
+	base, precision, err := parsePartial(term)
+	if err != nil {
+		return nil, err
+	}
+	next := func(p int) semVersion {
+		switch p {
+		case 1:
+			return semVersion{major: base.major + 1}
+		case 2:
+			return semVersion{major: base.major, minor: base.minor + 1}
+		default:
+			return semVersion{major: base.major, minor: base.minor, patch: base.patch + 1}
+		}
+	}
+
+	switch op {
+	case "", "=":
+		if precision == 3 {
+			return []versionBound{{"=", base}}, nil
+		}
+		// "1.4" / "1.4.x" means any 1.4 patch release
+		return []versionBound{{">=", base}, {"<", next(precision)}}, nil
+	case "!=":
+		return []versionBound{{"!=", base}}, nil
+	case ">", ">=", "<", "<=":
+		if precision < 3 && (op == ">" || op == "<=") {
+			// ">1.4" means ">=1.5.0"; "<=1.4" means "<1.5.0"
+			flipped := map[string]string{">": ">=", "<=": "<"}[op]
+			return []versionBound{{flipped, next(precision)}}, nil
+		}
+		return []versionBound{{op, base}}, nil
+	case "~":
+		// ~1.4.2 -> >=1.4.2 <1.5.0; ~1.4 -> >=1.4.0 <1.5.0; ~1 -> >=1.0.0 <2.0.0
+		p := precision
+		if p > 2 {
+			p = 2
+		}
+		return []versionBound{{">=", base}, {"<", next(p)}}, nil
+	case "^":
+		// ^1.2.3 -> <2.0.0; ^0.3.1 -> <0.4.0; ^0.0.3 -> <0.0.4
+		p := 1
+		switch {
+		case base.major == 0 && precision >= 2 && base.minor != 0:
+			p = 2
+		case base.major == 0 && precision == 3 && base.minor == 0:
+			p = 3
+		case base.major == 0 && precision == 2:
+			p = 2
+		}
+		return []versionBound{{">=", base}, {"<", next(p)}}, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %q", op)
+}
+
+// parsePartial parses "1", "1.4", "1.4.x", "1.4.2" and returns how many components were given.
+func parsePartial(s string) (semVersion, int, error) {
+	s = strings.TrimPrefix(s, "v")
+	core := s
+	var pre []string
+	if i := strings.IndexByte(core, '-'); i >= 0 {
+		pre = strings.Split(core[i+1:], ".")
+		core = core[:i]
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return semVersion{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	nums := [3]int{}
+	precision := 0
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semVersion{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		nums[i] = n
+		precision = i + 1
+	}
+	if precision == 0 {
+		return semVersion{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	v := semVersion{major: nums[0], minor: nums[1], patch: nums[2]}
+	if precision == 3 {
+		v.prerelease = pre
+	}
+	return v, precision, nil
+}
+
+// matches reports whether v satisfies the constraint.
+func (c *versionConstraint) matches(v semVersion) bool {
+	for _, group := range c.groups {
+		ok := true
+		for _, b := range group {
+			cmp := v.compare(b.v)
+			switch b.op {
+			case "=":
+				ok = cmp == 0
+			case "!=":
+				ok = cmp != 0
+			case ">":
+				ok = cmp > 0
+			case ">=":
+				ok = cmp >= 0
+			case "<":
+				ok = cmp < 0
+			case "<=":
+				ok = cmp <= 0
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *versionConstraint) String() string {
+	return c.raw
+}
@@ -0,0 +1,221 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"beacon/internal/config"
+	beaconerrors "beacon/internal/errors"
+	"beacon/internal/keys"
+	"beacon/internal/state"
+)
+
+// refusalBackoff is how long the poll loop leaves a release alone after it failed signature
+// or checksum verification, so an unsigned release is not retried (and alerted on) every poll.
+// Manual deploys (CLI, MCP, cloud) always try again.
+const refusalBackoff = time.Hour
+
+// verifyAlertTimeout bounds verify.alert_command.
+const verifyAlertTimeout = 30 * time.Second
+
+// refusal is a release the poll loop should leave alone for a while.
+type refusal struct {
+	at     time.Time
+	target string // commit or digest that was refused; "" when unknown
+}
+
+var refusals = struct {
+	sync.Mutex
+	m map[string]refusal
+}{m: make(map[string]refusal)}
+
+// releaseKey identifies a release for refusal tracking: the image (if any) and the tag.
+func releaseKey(cfg *config.Config, image, tag string) string {
+	return projectKey(cfg) + "|" + image + "|" + tag
+}
+
+// recentlyRefused reports whether the release was refused within refusalBackoff. When target
+// (a branch head) is given, a refusal of a different target does not count.
+func recentlyRefused(cfg *config.Config, image, tag, target string) bool {
+	refusals.Lock()
+	defer refusals.Unlock()
+	r, ok := refusals.m[releaseKey(cfg, image, tag)]
+	if !ok || time.Since(r.at) >= refusalBackoff {
+		return false
+	}
+	return target == "" || r.target == "" || r.target == target
+}
+
+// errChecksumRefused wraps an artifact whose checksum did not match (or was missing while
+// artifact.require_checksum is set).
+var errChecksumRefused = errors.New("checksum verification failed")
+
+// isSignatureError reports whether err is a release refused by signature verification.
+func isSignatureError(err error) bool {
+	var berr *beaconerrors.BeaconError
+	return errors.As(err, &berr) && berr.Type == beaconerrors.ErrorTypeSignature
+}
+
+// isRefusal reports whether err is a release refused by signature or checksum verification.
+func isRefusal(err error) bool {
+	return isSignatureError(err) || errors.Is(err, errChecksumRefused)
+}
+
+// reportRefusal logs a refused release with troubleshooting steps, remembers it for the poll
+// loop and runs verify.alert_command.
+func reportRefusal(cfg *config.Config, rec state.DeployRecord, target string, err error) {
+	if isSignatureError(err) {
+		logger.Infof("%s", beaconerrors.FormatError(err))
+	} else {
+		logger.Infof("Refusing to deploy %s: %v\n", rec.Tag, err)
+	}
+
+	refusals.Lock()
+	refusals.m[releaseKey(cfg, rec.Image, rec.Tag)] = refusal{at: time.Now(), target: target}
+	refusals.Unlock()
+
+	if cfg.Verify == nil || cfg.Verify.AlertCommand == "" {
+		return
+	}
+	env, eerr := keys.ResolveEnv(cfg.Env)
+	if eerr != nil {
+		logger.Infof("Verify alert command not run: %v\n", eerr)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), verifyAlertTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", secureEnvCommand(cfg, cfg.Verify.AlertCommand))
+	cmd.Dir = os.TempDir()
+	cmd.Env = append(os.Environ(),
+		"BEACON_PROJECT_NAME="+cfg.ProjectName,
+		"BEACON_DEPLOY_TAG="+rec.Tag,
+		"BEACON_DEPLOY_TRIGGER="+rec.Trigger,
+		"BEACON_DOCKER_IMAGE="+rec.Image,
+		"BEACON_VERIFY_ERROR="+err.Error(),
+	)
+	cmd.Env = append(cmd.Env, env.Vars...)
+	if out, aerr := cmd.CombinedOutput(); aerr != nil {
+		logger.Infof("Verify alert command failed: %v, output: %s\n", aerr, env.Redact(strings.TrimSpace(string(out))))
+	} else {
+		logger.Infof("Verify alert command executed\n")
+	}
+}
+
+// verifyGitRelease checks that the release is signed by an allowed key. Tag deploys need a
+// signed annotated tag whose name matches the ref (unless verify.git.require is "commit");
+// branches, commits and the default branch need a signed commit. repoDir is any Git
+// directory that holds the objects (the mirror or a clone). It returns git's description of
+// the good signature; a refused release is reported as a signature BeaconError.
+func verifyGitRelease(ctx context.Context, cfg *config.Config, repoDir, ref, commit string) (string, error) {
+	vc := cfg.Verify.Git
+	refuse := func(format string, args ...any) error {
+		return beaconerrors.NewSignatureError(gitReleaseName(ref), fmt.Errorf(format, args...))
+	}
+
+	// Only the configured keys count: the user's own keyring and allowed signers are ignored
+	gnupgHome, err := os.MkdirTemp("", "beacon-gnupg-")
+	if err != nil {
+		return "", fmt.Errorf("create GnuPG home: %w", err)
+	}
+	defer func() {
+		_ = exec.Command("gpgconf", "--homedir", gnupgHome, "--kill", "all").Run()
+		_ = os.RemoveAll(gnupgHome)
+	}()
+	if vc.GPGKeyring != "" {
+		out, err := exec.CommandContext(ctx, "gpg", "--batch", "--quiet", "--homedir", gnupgHome, "--import", vc.GPGKeyring).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("import GPG keyring %s: %v: %s", vc.GPGKeyring, err, strings.TrimSpace(string(out)))
+		}
+	}
+	signers := vc.AllowedSigners
+	if signers == "" {
+		signers = os.DevNull
+	}
+
+	git := func(args ...string) (string, error) {
+		args = append([]string{"-c", "gpg.ssh.allowedSignersFile=" + signers}, args...)
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = repoDir
+		cmd.Env = append(os.Environ(), "GNUPGHOME="+gnupgHome)
+		var out bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &out, &out
+		err := cmd.Run()
+		return strings.TrimSpace(out.String()), err
+	}
+
+	isTag := false
+	if ref != "" && !isCommitRef(cfg, ref) {
+		_, err := git("rev-parse", "--verify", "--quiet", "refs/tags/"+ref)
+		isTag = err == nil
+	}
+
+	if isTag && vc.Require != config.VerifyGitCommit {
+		info, err := git("for-each-ref", "--format=%(objecttype) %(tag)", "refs/tags/"+ref)
+		if err != nil {
+			return "", fmt.Errorf("inspect tag %s: %w", ref, err)
+		}
+		objType, name, _ := strings.Cut(info, " ")
+		if objType != "tag" {
+			return "", refuse("tag %s is a lightweight tag and cannot carry a signature", ref)
+		}
+		if name != ref {
+			return "", refuse("tag object is named %q but was pushed as %s", name, ref)
+		}
+		out, err := git("verify-tag", "refs/tags/"+ref)
+		if err != nil {
+			return "", refuse("tag %s: %s", ref, signatureFailure(out))
+		}
+		return goodSignature(out), nil
+	}
+
+	out, err := git("verify-commit", commit)
+	if err != nil {
+		return "", refuse("commit %s: %s", shortCommit(commit), signatureFailure(out))
+	}
+	return goodSignature(out), nil
+}
+
+// gitReleaseName describes a Git release for error messages.
+func gitReleaseName(ref string) string {
+	if ref == "" {
+		return "the default branch"
+	}
+	return ref
+}
+
+// goodSignature picks git's "Good signature" line out of verify output.
+func goodSignature(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "gpg: ")
+		if strings.HasPrefix(line, "Good ") {
+			return line
+		}
+	}
+	return "signature verified"
+}
+
+// signatureFailure turns git's verify output into a one-line reason.
+func signatureFailure(out string) string {
+	if out == "" {
+		return "no signature"
+	}
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(strings.TrimSpace(line), "gpg: ")
+	}
+	return strings.Join(lines, "; ")
+}
+
+func shortCommit(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,127 @@
+package deploy
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"beacon/internal/config"
+	"beacon/internal/state"
+)
+
+// newSigningKey creates an SSH key and an allowed_signers file trusting it.
+func newSigningKey(t *testing.T, principal string) (key, allowedSigners string) {
+	t.Helper()
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	dir := t.TempDir()
+	key = filepath.Join(dir, "id_ed25519")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v\n%s", err, out)
+	}
+	pub, err := os.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedSigners = filepath.Join(dir, "allowed_signers")
+	writeFile(t, allowedSigners, principal+" "+string(pub))
+	return key, allowedSigners
+}
+
+// addSignedTag commits a new version to the source repo behind repoURL and tags it, signing
+// the tag with key when key is not empty.
+func addSignedTag(t *testing.T, repoURL, tag, key string) {
+	t.Helper()
+	src := strings.TrimPrefix(repoURL, "file://")
+	writeFile(t, filepath.Join(src, "version.txt"), tag+"\n")
+	runGit(t, src, "commit", "--quiet", "-am", tag)
+	if key == "" {
+		runGit(t, src, "tag", "-a", "-m", tag, tag)
+		return
+	}
+	runGit(t, src, "-c", "gpg.format=ssh", "-c", "user.signingkey="+key, "tag", "-s", "-m", tag, tag)
+}
+
+func TestDeploy_VerifiesSignedTag(t *testing.T) {
+	repoURL := newMirrorTestRepo(t)
+	key, allowed := newSigningKey(t, "release@example.com")
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-03T00:00:00Z")
+	addSignedTag(t, repoURL, "v3", key)
+
+	cfg := newMirrorTestConfig(t, repoURL, config.GitFetchConfig{})
+	cfg.Verify = &config.VerifyConfig{Git: &config.GitVerifyConfig{AllowedSigners: allowed}}
+
+	if err := Deploy(cfg, "v3", state.NewStatus(t.TempDir()), state.TriggerManual); err != nil {
+		t.Fatalf("deploy signed tag: %v", err)
+	}
+	if got := readVersion(t, cfg); got != "v3" {
+		t.Errorf("version = %q", got)
+	}
+	last, err := ProjectHistory(cfg).Last()
+	if err != nil || last == nil {
+		t.Fatalf("history: %v", err)
+	}
+	if !strings.Contains(last.Signature, "release@example.com") {
+		t.Errorf("signature = %q", last.Signature)
+	}
+}
+
+func TestDeploy_RefusesUntrustedTag(t *testing.T) {
+	repoURL := newMirrorTestRepo(t)
+	_, allowed := newSigningKey(t, "release@example.com")
+	otherKey, _ := newSigningKey(t, "intruder@example.com")
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-03T00:00:00Z")
+	addSignedTag(t, repoURL, "v3", otherKey)
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-04T00:00:00Z")
+	addSignedTag(t, repoURL, "v4", "")
+
+	cfg := newMirrorTestConfig(t, repoURL, config.GitFetchConfig{})
+	alertFile := filepath.Join(t.TempDir(), "alerts")
+	cfg.Verify = &config.VerifyConfig{
+		Git:          &config.GitVerifyConfig{AllowedSigners: allowed},
+		AlertCommand: `echo "$BEACON_DEPLOY_TAG" >> ` + alertFile,
+	}
+	status := state.NewStatus(t.TempDir())
+
+	// Lightweight tags (v1, v2) carry no signature; v3 is signed by an unknown key; v4 is unsigned
+	for _, tag := range []string{"v2", "v3", "v4"} {
+		err := Deploy(cfg, tag, status, state.TriggerPoll)
+		if !isSignatureError(err) {
+			t.Fatalf("deploy %s: err = %v, want signature error", tag, err)
+		}
+		if !recentlyRefused(cfg, "", tag, "") {
+			t.Errorf("%s not remembered as refused", tag)
+		}
+	}
+	if _, err := os.Stat(cfg.LocalPath); !os.IsNotExist(err) {
+		t.Error("refused release was checked out")
+	}
+
+	last, _ := ProjectHistory(cfg).Last()
+	if last == nil || !last.Refused || last.Success {
+		t.Errorf("last record = %+v, want refused", last)
+	}
+	alerts, err := os.ReadFile(alertFile)
+	if err != nil || strings.Fields(string(alerts))[0] != "v2" || len(strings.Fields(string(alerts))) != 3 {
+		t.Errorf("alerts = %q, %v", alerts, err)
+	}
+}
+
+func TestDeploy_VerifyCommitInCloneMode(t *testing.T) {
+	repoURL := newMirrorTestRepo(t)
+	_, allowed := newSigningKey(t, "release@example.com")
+
+	cfg := newMirrorTestConfig(t, repoURL, config.GitFetchConfig{Mode: config.GitModeClone})
+	cfg.Verify = &config.VerifyConfig{Git: &config.GitVerifyConfig{AllowedSigners: allowed, Require: config.VerifyGitCommit}}
+
+	err := Deploy(cfg, "v2", state.NewStatus(t.TempDir()), state.TriggerManual)
+	if !isSignatureError(err) || !strings.Contains(err.Error(), "commit") {
+		t.Fatalf("err = %v, want unsigned commit", err)
+	}
+	if _, err := os.Stat(cfg.LocalPath); !os.IsNotExist(err) {
+		t.Error("refused clone left in the deploy path")
+	}
+}
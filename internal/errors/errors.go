@@ -20,6 +20,7 @@ const (
 	ErrorTypeAuth       ErrorType = "authentication"
 	ErrorTypeTimeout    ErrorType = "timeout"
 	ErrorTypeFile       ErrorType = "file"
+	ErrorTypeSignature  ErrorType = "signature"
 )
 
 // BeaconError represents a structured error with troubleshooting information
@@ -341,6 +342,31 @@ func NewAuthError(service string, originalError error) *BeaconError {
 	return err
 }
 
+// Signature Errors
+
+// NewSignatureError creates an error for a release refused by signature verification.
+// release names what was refused, e.g. "tag v1.2.0" or "image ghcr.io/acme/app:1.2".
+func NewSignatureError(release string, originalError error) *BeaconError {
+	errorType := ErrorTypeSignature
+	message := fmt.Sprintf("Refusing to deploy %s: signature verification failed", release)
+
+	err := NewBeaconError(errorType, message, originalError)
+
+	err.WithTroubleshooting(
+		"The release is not signed",
+		"It was signed by a key that is not in the allowed signers, keyring or public key",
+		"The signature does not match the release (tag moved or image re-pushed)",
+		"Someone pushed a release with a leaked deploy token",
+	).WithNextSteps(
+		"Check who created the release before deploying it",
+		"Verify the signature manually: git verify-tag <tag> / cosign verify --key <key> <image>",
+		"Add the signer's key to the verify settings in deploy.yml if it is trusted",
+	)
+
+	err.WithDocumentation("https://github.com/Bajusz15/beacon#troubleshooting-signatures")
+	return err
+}
+
 // FormatError formats any error with enhanced information
 func FormatError(err error) string {
 	if beaconErr, ok := err.(*BeaconError); ok {
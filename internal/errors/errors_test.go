@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -429,3 +430,21 @@ func containsSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestNewSignatureError(t *testing.T) {
+	orig := fmt.Errorf("no valid signature")
+	err := NewSignatureError("tag v1.2.0", orig)
+
+	if err.Type != ErrorTypeSignature {
+		t.Errorf("ErrorType = %v, want %v", err.Type, ErrorTypeSignature)
+	}
+	if !strings.Contains(err.Message, "tag v1.2.0") {
+		t.Errorf("Message = %q, want it to name the release", err.Message)
+	}
+	if err.Unwrap() != orig {
+		t.Error("expected original error to be unwrappable")
+	}
+	if len(err.Troubleshooting) == 0 || len(err.NextSteps) == 0 {
+		t.Error("expected troubleshooting and next steps")
+	}
+}
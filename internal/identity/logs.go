@@ -0,0 +1,49 @@
+package identity
+
+import "time"
+
+// Defaults for LogConfig
+const (
+	DefaultLogMaxSizeMB = 10
+	DefaultLogMaxAge    = 24 * time.Hour
+	DefaultLogMaxFiles  = 7
+)
+
+// LogConfig is the logs block in ~/.beacon/config.yaml: rotation of the master's log
+// (~/.beacon/logs/master.log) and the project agents' logs
+// (~/.beacon/config/projects/<project>/logs/agent.log).
+type LogConfig struct {
+	MaxSizeMB int           `yaml:"max_size_mb,omitempty"` // rotate at this size (default 10)
+	MaxAge    time.Duration `yaml:"max_age,omitempty"`     // rotate a file this old (default 24h)
+	MaxFiles  int           `yaml:"max_files,omitempty"`   // rotated files kept per log (default 7)
+	Compress  *bool         `yaml:"compress,omitempty"`    // gzip rotated files (default true)
+}
+
+// EffectiveMaxSizeMB returns the rotation size in MiB.
+func (c *LogConfig) EffectiveMaxSizeMB() int {
+	if c == nil || c.MaxSizeMB <= 0 {
+		return DefaultLogMaxSizeMB
+	}
+	return c.MaxSizeMB
+}
+
+// EffectiveMaxAge returns the rotation age.
+func (c *LogConfig) EffectiveMaxAge() time.Duration {
+	if c == nil || c.MaxAge <= 0 {
+		return DefaultLogMaxAge
+	}
+	return c.MaxAge
+}
+
+// EffectiveMaxFiles returns how many rotated files are kept.
+func (c *LogConfig) EffectiveMaxFiles() int {
+	if c == nil || c.MaxFiles <= 0 {
+		return DefaultLogMaxFiles
+	}
+	return c.MaxFiles
+}
+
+// EffectiveCompress reports whether rotated files are gzipped.
+func (c *LogConfig) EffectiveCompress() bool {
+	return c == nil || c.Compress == nil || *c.Compress
+}
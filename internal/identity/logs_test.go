@@ -0,0 +1,27 @@
+package identity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLogConfig_Defaults(t *testing.T) {
+	var none *LogConfig
+	require.Equal(t, DefaultLogMaxSizeMB, none.EffectiveMaxSizeMB())
+	require.Equal(t, DefaultLogMaxAge, none.EffectiveMaxAge())
+	require.Equal(t, DefaultLogMaxFiles, none.EffectiveMaxFiles())
+	require.True(t, none.EffectiveCompress())
+}
+
+func TestLogConfig_YAML(t *testing.T) {
+	var uc UserConfig
+	require.NoError(t, yaml.Unmarshal([]byte("logs:\n  max_size_mb: 50\n  max_age: 6h\n  max_files: 3\n  compress: false\n"), &uc))
+	require.NotNil(t, uc.Logs)
+	require.Equal(t, 50, uc.Logs.EffectiveMaxSizeMB())
+	require.Equal(t, 6*time.Hour, uc.Logs.EffectiveMaxAge())
+	require.Equal(t, 3, uc.Logs.EffectiveMaxFiles())
+	require.False(t, uc.Logs.EffectiveCompress())
+}
@@ -0,0 +1,40 @@
+package identity
+
+import "time"
+
+// Defaults for OfflineBufferConfig
+const (
+	DefaultOfflineBufferMaxSizeMB = 20
+	DefaultOfflineBufferMaxAge    = 7 * 24 * time.Hour
+)
+
+// OfflineBufferConfig is the offline_buffer block in ~/.beacon/config.yaml: the spool
+// of heartbeats, metrics, check transitions and command results the cloud could not
+// receive, backfilled once it is reachable again. The master and each project agent
+// keep their own spool.
+type OfflineBufferConfig struct {
+	Enabled   *bool         `yaml:"enabled,omitempty"`     // default true
+	MaxSizeMB int           `yaml:"max_size_mb,omitempty"` // per spool; the oldest reports are dropped beyond it (default 20)
+	MaxAge    time.Duration `yaml:"max_age,omitempty"`     // older reports are dropped (default 168h)
+}
+
+// EffectiveEnabled reports whether undelivered reports are spooled.
+func (c *OfflineBufferConfig) EffectiveEnabled() bool {
+	return c == nil || c.Enabled == nil || *c.Enabled
+}
+
+// EffectiveMaxSizeMB returns the size limit of a spool in MiB.
+func (c *OfflineBufferConfig) EffectiveMaxSizeMB() int {
+	if c == nil || c.MaxSizeMB <= 0 {
+		return DefaultOfflineBufferMaxSizeMB
+	}
+	return c.MaxSizeMB
+}
+
+// EffectiveMaxAge returns how long a report is kept for backfill.
+func (c *OfflineBufferConfig) EffectiveMaxAge() time.Duration {
+	if c == nil || c.MaxAge <= 0 {
+		return DefaultOfflineBufferMaxAge
+	}
+	return c.MaxAge
+}
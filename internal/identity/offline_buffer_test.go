@@ -0,0 +1,25 @@
+package identity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestOfflineBufferConfig_Defaults(t *testing.T) {
+	var none *OfflineBufferConfig
+	require.True(t, none.EffectiveEnabled())
+	require.Equal(t, DefaultOfflineBufferMaxSizeMB, none.EffectiveMaxSizeMB())
+	require.Equal(t, DefaultOfflineBufferMaxAge, none.EffectiveMaxAge())
+}
+
+func TestOfflineBufferConfig_YAML(t *testing.T) {
+	var uc UserConfig
+	require.NoError(t, yaml.Unmarshal([]byte("offline_buffer:\n  enabled: false\n  max_size_mb: 5\n  max_age: 48h\n"), &uc))
+	require.NotNil(t, uc.OfflineBuffer)
+	require.False(t, uc.OfflineBuffer.EffectiveEnabled())
+	require.Equal(t, 5, uc.OfflineBuffer.EffectiveMaxSizeMB())
+	require.Equal(t, 48*time.Hour, uc.OfflineBuffer.EffectiveMaxAge())
+}
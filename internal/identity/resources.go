@@ -0,0 +1,102 @@
+package identity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ResourceLimits is the projects[].resources block in ~/.beacon/config.yaml: cgroup v2
+// limits for the project's child agent and everything it runs (checks, lifecycle commands).
+type ResourceLimits struct {
+	MemoryMax string `yaml:"memory_max,omitempty"` // e.g. 256M, 1G (memory.max)
+	CPUWeight int    `yaml:"cpu_weight,omitempty"` // 1-10000, default 100 (cpu.weight)
+	CPUQuota  string `yaml:"cpu_quota,omitempty"`  // share of one CPU, e.g. 50% or 200% (cpu.max)
+	PidsMax   int    `yaml:"pids_max,omitempty"`   // processes and threads (pids.max)
+}
+
+// IsZero reports whether no limit is set.
+func (r *ResourceLimits) IsZero() bool {
+	return r == nil || *r == ResourceLimits{}
+}
+
+// MemoryMaxBytes parses MemoryMax: bytes with an optional K, M, G or T suffix (powers of
+// 1024). Returns 0 when unset.
+func (r *ResourceLimits) MemoryMaxBytes() (int64, error) {
+	if r == nil || r.MemoryMax == "" {
+		return 0, nil
+	}
+	s := strings.ToUpper(strings.TrimSpace(r.MemoryMax))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("resources: invalid memory_max %q (e.g. 512M, 2G)", r.MemoryMax)
+	}
+	return n * mult, nil
+}
+
+// CPUQuotaPercent parses CPUQuota as a percentage of one CPU. Returns 0 when unset.
+func (r *ResourceLimits) CPUQuotaPercent() (int, error) {
+	if r == nil || r.CPUQuota == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(r.CPUQuota), "%"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("resources: invalid cpu_quota %q (e.g. 50%%, 200%%)", r.CPUQuota)
+	}
+	return n, nil
+}
+
+// Validate checks the limits.
+func (r *ResourceLimits) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if _, err := r.MemoryMaxBytes(); err != nil {
+		return err
+	}
+	if _, err := r.CPUQuotaPercent(); err != nil {
+		return err
+	}
+	if r.CPUWeight < 0 || r.CPUWeight > 10000 {
+		return fmt.Errorf("resources: cpu_weight %d out of range 1-10000", r.CPUWeight)
+	}
+	if r.PidsMax < 0 {
+		return fmt.Errorf("resources: pids_max must not be negative")
+	}
+	return nil
+}
+
+// RunAs is the projects[].run_as block: the unprivileged user (and group) the child agent
+// and its checks run as. The master must run as root to switch users. The child gets a
+// restricted environment: PATH, HOME, USER, LOGNAME, LANG, TZ, the BEACON_* variables and
+// the variables listed in Env.
+type RunAs struct {
+	User  string   `yaml:"user"`
+	Group string   `yaml:"group,omitempty"` // default: the user's primary group
+	Env   []string `yaml:"env,omitempty"`   // more variables passed through from the master
+}
+
+// Validate checks that a user is set.
+func (r *RunAs) Validate() error {
+	if r != nil && strings.TrimSpace(r.User) == "" {
+		return fmt.Errorf("run_as: user is required")
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceLimits_MemoryMaxBytes(t *testing.T) {
+	for in, want := range map[string]int64{
+		"":      0,
+		"4096":  4096,
+		"512M":  512 << 20,
+		"512mb": 512 << 20,
+		"2G":    2 << 30,
+		"64K":   64 << 10,
+	} {
+		got, err := (&ResourceLimits{MemoryMax: in}).MemoryMaxBytes()
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+	_, err := (&ResourceLimits{MemoryMax: "lots"}).MemoryMaxBytes()
+	require.Error(t, err)
+}
+
+func TestResourceLimits_Validate(t *testing.T) {
+	var none *ResourceLimits
+	require.True(t, none.IsZero())
+	require.NoError(t, none.Validate())
+
+	ok := &ResourceLimits{MemoryMax: "1G", CPUWeight: 50, CPUQuota: "150%", PidsMax: 128}
+	require.False(t, ok.IsZero())
+	require.NoError(t, ok.Validate())
+	quota, _ := ok.CPUQuotaPercent()
+	require.Equal(t, 150, quota)
+
+	require.Error(t, (&ResourceLimits{CPUQuota: "half"}).Validate())
+	require.Error(t, (&ResourceLimits{CPUWeight: 20000}).Validate())
+	require.Error(t, (&ResourceLimits{PidsMax: -1}).Validate())
+	require.Error(t, (&RunAs{}).Validate())
+}
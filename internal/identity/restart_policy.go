@@ -0,0 +1,98 @@
+package identity
+
+import (
+	"fmt"
+	"time"
+)
+
+// Restart policies for a project's child agent
+const (
+	RestartAlways    = "always"     // respawn after any exit (default)
+	RestartOnFailure = "on-failure" // respawn after a crash or non-zero exit only
+	RestartNever     = "never"      // leave the agent down
+)
+
+// Defaults for RestartPolicy
+const (
+	DefaultMaxRestarts       = 5
+	DefaultRestartBackoff    = time.Second
+	DefaultRestartBackoffMax = 60 * time.Second
+	DefaultRestartResetAfter = 10 * time.Minute
+)
+
+// RestartPolicy is the projects[].restart block in ~/.beacon/config.yaml: when the master
+// respawns a child agent that exited and when it gives up and marks it failed.
+type RestartPolicy struct {
+	Policy      string        `yaml:"policy,omitempty"`       // always (default), on-failure, never
+	MaxRestarts int           `yaml:"max_restarts,omitempty"` // consecutive respawns before failed (default 5; -1 = unlimited)
+	Backoff     time.Duration `yaml:"backoff,omitempty"`      // restart n waits backoff × 2^n (default 1s)
+	BackoffMax  time.Duration `yaml:"backoff_max,omitempty"`  // delay cap (default 60s)
+	ResetAfter  time.Duration `yaml:"reset_after,omitempty"`  // uptime after which the restart count resets (default 10m)
+}
+
+// EffectivePolicy returns the policy name, defaulting to always.
+func (p *RestartPolicy) EffectivePolicy() string {
+	if p == nil || p.Policy == "" {
+		return RestartAlways
+	}
+	return p.Policy
+}
+
+// ShouldRestart reports whether an agent that exited with exitCode (-1 for a signal) is respawned.
+func (p *RestartPolicy) ShouldRestart(exitCode int) bool {
+	switch p.EffectivePolicy() {
+	case RestartNever:
+		return false
+	case RestartOnFailure:
+		return exitCode != 0
+	}
+	return true
+}
+
+// EffectiveMaxRestarts returns the respawn limit; a negative value means unlimited.
+func (p *RestartPolicy) EffectiveMaxRestarts() int {
+	if p == nil || p.MaxRestarts == 0 {
+		return DefaultMaxRestarts
+	}
+	return p.MaxRestarts
+}
+
+// BackoffFor returns the delay before the given restart (1-based): backoff * 2^restart, capped.
+func (p *RestartPolicy) BackoffFor(restart int) time.Duration {
+	base, max := DefaultRestartBackoff, DefaultRestartBackoffMax
+	if p != nil && p.Backoff > 0 {
+		base = p.Backoff
+	}
+	if p != nil && p.BackoffMax > 0 {
+		max = p.BackoffMax
+	}
+	d := base
+	for i := 0; i < restart && d < max; i++ {
+		d *= 2
+	}
+	return min(d, max)
+}
+
+// EffectiveResetAfter returns how long an agent must stay up for its restart count to reset.
+func (p *RestartPolicy) EffectiveResetAfter() time.Duration {
+	if p == nil || p.ResetAfter <= 0 {
+		return DefaultRestartResetAfter
+	}
+	return p.ResetAfter
+}
+
+// Validate checks the policy name and durations.
+func (p *RestartPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Policy {
+	case "", RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		return fmt.Errorf("restart: unknown policy %q (use always, on-failure or never)", p.Policy)
+	}
+	if p.Backoff < 0 || p.BackoffMax < 0 || p.ResetAfter < 0 {
+		return fmt.Errorf("restart: durations must not be negative")
+	}
+	return nil
+}
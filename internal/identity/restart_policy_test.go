@@ -0,0 +1,55 @@
+package identity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRestartPolicy_defaults(t *testing.T) {
+	var p *RestartPolicy
+	require.Equal(t, RestartAlways, p.EffectivePolicy())
+	require.True(t, p.ShouldRestart(0))
+	require.Equal(t, DefaultMaxRestarts, p.EffectiveMaxRestarts())
+	require.Equal(t, DefaultRestartResetAfter, p.EffectiveResetAfter())
+	// Same schedule as before restart policies existed: 2s, 4s, ... capped at 60s
+	require.Equal(t, 2*time.Second, p.BackoffFor(1))
+	require.Equal(t, 32*time.Second, p.BackoffFor(5))
+	require.Equal(t, 60*time.Second, p.BackoffFor(10))
+	require.NoError(t, p.Validate())
+}
+
+func TestRestartPolicy_ShouldRestart(t *testing.T) {
+	onFailure := &RestartPolicy{Policy: RestartOnFailure}
+	require.False(t, onFailure.ShouldRestart(0))
+	require.True(t, onFailure.ShouldRestart(1))
+	require.True(t, onFailure.ShouldRestart(-1), "killed by a signal")
+
+	never := &RestartPolicy{Policy: RestartNever}
+	require.False(t, never.ShouldRestart(1))
+}
+
+func TestRestartPolicy_yaml(t *testing.T) {
+	var pc ProjectConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+id: web
+config_path: /etc/beacon/web.yml
+restart:
+  policy: on-failure
+  max_restarts: -1
+  backoff: 500ms
+  backoff_max: 5s
+  reset_after: 1m
+`), &pc))
+	require.NotNil(t, pc.Restart)
+	require.NoError(t, pc.Restart.Validate())
+	require.Equal(t, -1, pc.Restart.EffectiveMaxRestarts())
+	require.Equal(t, time.Second, pc.Restart.BackoffFor(1))
+	require.Equal(t, 5*time.Second, pc.Restart.BackoffFor(8))
+	require.Equal(t, time.Minute, pc.Restart.EffectiveResetAfter())
+
+	require.Error(t, (&RestartPolicy{Policy: "sometimes"}).Validate())
+	require.Error(t, (&RestartPolicy{Backoff: -time.Second}).Validate())
+}
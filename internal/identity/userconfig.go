@@ -28,9 +28,16 @@ type UserConfig struct {
 	Tunnels               []TunnelConfig  `yaml:"tunnels,omitempty"`
 	VPN                   *VPNConfig      `yaml:"vpn,omitempty"`
 	AllowedRemoteCommands []string        `yaml:"allowed_remote_commands,omitempty"`
+	// ControlToken enables the master's control API on the status server (/api/control/)
+	// for requests with "Authorization: Bearer <token>". The control socket needs no token.
+	ControlToken string `yaml:"control_token,omitempty"`
 	// SystemMetrics configures host metrics sent with cloud heartbeats (~/.beacon/config.yaml only).
 	// Per-project monitor.yml should not duplicate this; omit system_metrics there.
 	SystemMetrics *UserSystemMetricsConfig `yaml:"system_metrics,omitempty"`
+	// Logs configures rotation of the master and project agent log files.
+	Logs *LogConfig `yaml:"logs,omitempty"`
+	// OfflineBuffer bounds the reports kept for backfill while the cloud is unreachable.
+	OfflineBuffer *OfflineBufferConfig `yaml:"offline_buffer,omitempty"`
 }
 
 // UserSystemMetricsConfig is the ~/.beacon/config.yaml block for CPU/memory/disk reporting to BeaconInfra.
@@ -52,6 +59,12 @@ type ProjectConfig struct {
 	// nil => omitted in YAML (default: true)
 	// true/false => explicitly set.
 	Enabled *bool `yaml:"enabled,omitempty"`
+	// Restart controls respawning the child agent after it exits (default: always, 5 restarts).
+	Restart *RestartPolicy `yaml:"restart,omitempty"`
+	// Resources caps the child agent's memory, CPU and processes with a cgroup (Linux).
+	Resources *ResourceLimits `yaml:"resources,omitempty"`
+	// RunAs runs the child agent and its checks as an unprivileged user.
+	RunAs *RunAs `yaml:"run_as,omitempty"`
 }
 
 // VPNConfig is the per-device WireGuard VPN section in ~/.beacon/config.yaml.
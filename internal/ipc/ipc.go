@@ -1,10 +1,14 @@
 package ipc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"beacon/internal/config"
@@ -14,11 +18,16 @@ const (
 	healthFile        = "health.json"
 	commandFile       = "command.json"
 	commandResultFile = "command_result.json"
+	agentRestartFile  = "agent_restart.json"
 )
 
-// Writer handles writing IPC files for child agents.
+// Writer is the child agent's end of IPC: the master's socket when connected (see
+// Connect), the files in the IPC directory otherwise.
 type Writer struct {
 	dir string
+
+	mu   sync.Mutex
+	sock socketState
 }
 
 // NewWriter creates a new IPC writer for the given directory.
@@ -27,22 +36,42 @@ func NewWriter(dir string) (*Writer, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("create IPC directory: %w", err)
 	}
-	return &Writer{dir: dir}, nil
+	return &Writer{dir: dir, sock: socketState{ready: make(chan struct{}, 1)}}, nil
 }
 
-// WriteHealth writes the health report to health.json atomically.
+// WriteHealth pushes the health report to the master, or writes it to health.json
+// atomically when not connected.
 func (w *Writer) WriteHealth(report *HealthReport) error {
+	if c := w.active(); c != nil && c.notify(MethodHealth, report) == nil {
+		return nil
+	}
 	return atomicWriteJSON(filepath.Join(w.dir, healthFile), report)
 }
 
-// WriteCommandResult writes the command result to command_result.json atomically.
+// WriteCommandResult sends the command result to the master and waits for its ack, or
+// writes it to command_result.json atomically when it could not be sent. A result that
+// was sent but not acked is not written again, so the master never records it twice.
 func (w *Writer) WriteCommandResult(result *CommandResult) error {
+	if c := w.active(); c != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+		err := c.call(ctx, MethodResult, result, nil)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, errNotSent) {
+			return fmt.Errorf("result for %s may not have been recorded: %w", result.CommandID, err)
+		}
+	}
 	return atomicWriteJSON(filepath.Join(w.dir, commandResultFile), result)
 }
 
-// ReadCommand reads and deletes the command.json file if it exists.
-// Returns nil, nil if no command file exists.
+// ReadCommand returns the oldest command queued from the socket, else reads and deletes
+// the command.json file if it exists. Returns nil, nil if there is no command.
 func (w *Writer) ReadCommand() (*Command, error) {
+	if cmd := w.popCommand(); cmd != nil {
+		return cmd, nil
+	}
 	path := filepath.Join(w.dir, commandFile)
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
@@ -67,9 +96,12 @@ func (w *Writer) ReadCommand() (*Command, error) {
 	return &cmd, nil
 }
 
-// Reader handles reading IPC files for the master agent.
+// Reader is the master's end of a child's IPC: the child's socket once Listen is called
+// and the child connects, the files in the IPC directory otherwise.
 type Reader struct {
-	dir string
+	dir        string
+	srv        *server     // nil until Listen
+	socketOnly atomic.Bool // never write command.json (see SetSocketOnly)
 }
 
 // NewReader creates a new IPC reader for the given directory.
@@ -77,6 +109,13 @@ func NewReader(dir string) *Reader {
 	return &Reader{dir: dir}
 }
 
+// SetSocketOnly makes WriteCommand deliver commands over the socket only, returning
+// ErrNotConnected instead of writing command.json. It is used for children running as
+// another user, which cannot remove files from the master-owned IPC directory.
+func (r *Reader) SetSocketOnly(on bool) {
+	r.socketOnly.Store(on)
+}
+
 // ReadHealth reads the health.json file.
 // Returns nil, nil if the file doesn't exist.
 func (r *Reader) ReadHealth() (*HealthReport, error) {
@@ -96,9 +135,12 @@ func (r *Reader) ReadHealth() (*HealthReport, error) {
 	return &report, nil
 }
 
-// ReadHealthIfFresh reads the health.json file only if it was modified within maxAge.
-// Returns nil, nil if the file doesn't exist or is stale.
+// ReadHealthIfFresh returns the health report last pushed over the socket, or reads the
+// health.json file, if it is no older than maxAge. Returns nil, nil if there is none or it is stale.
 func (r *Reader) ReadHealthIfFresh(maxAge time.Duration) (*HealthReport, error) {
+	if report := r.freshHealth(maxAge); report != nil {
+		return report, nil
+	}
 	path := filepath.Join(r.dir, healthFile)
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
@@ -115,14 +157,25 @@ func (r *Reader) ReadHealthIfFresh(maxAge time.Duration) (*HealthReport, error)
 	return r.ReadHealth()
 }
 
-// WriteCommand writes a command to command.json for the child to process.
+// WriteCommand queues a command in the connected child, which acks it, or writes it to
+// command.json for the child to poll. Returns ErrQueueFull when the child's queue is full,
+// and ErrNotConnected when it is not connected in socket-only mode.
 func (r *Reader) WriteCommand(cmd *Command) error {
+	if sent, err := r.sendCommand(cmd); sent {
+		return err
+	}
+	if r.socketOnly.Load() {
+		return ErrNotConnected
+	}
 	return atomicWriteJSON(filepath.Join(r.dir, commandFile), cmd)
 }
 
-// ReadCommandResult reads and deletes the command_result.json file.
-// Returns nil, nil if no result file exists.
+// ReadCommandResult returns the oldest result received on the socket, else reads and
+// deletes the command_result.json file. Returns nil, nil if there is no result.
 func (r *Reader) ReadCommandResult() (*CommandResult, error) {
+	if result := r.popResult(); result != nil {
+		return result, nil
+	}
 	path := filepath.Join(r.dir, commandResultFile)
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
@@ -147,15 +200,64 @@ func (r *Reader) ReadCommandResult() (*CommandResult, error) {
 	return &result, nil
 }
 
-// atomicWriteJSON writes data to a file atomically (write to temp, then rename).
+// WriteAgentRestartRequest asks the master to respawn the agent of the project whose IPC
+// directory is dir (beacon projects agent-restart).
+func WriteAgentRestartRequest(dir string, req *AgentRestartRequest) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create IPC directory: %w", err)
+	}
+	return atomicWriteJSON(filepath.Join(dir, agentRestartFile), req)
+}
+
+// AgentRestartPending reports whether a restart request in dir is still waiting for the master.
+func AgentRestartPending(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, agentRestartFile))
+	return err == nil
+}
+
+// ReadAgentRestartRequest reads and deletes agent_restart.json.
+// Returns nil, nil if there is no request.
+func (r *Reader) ReadAgentRestartRequest() (*AgentRestartRequest, error) {
+	path := filepath.Join(r.dir, agentRestartFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read agent restart request: %w", err)
+	}
+	_ = os.Remove(path)
+
+	var req AgentRestartRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("parse agent restart request: %w", err)
+	}
+	return &req, nil
+}
+
+// atomicWriteJSON writes data to a file atomically (write to a fresh temp file, then
+// rename). The temp file is created exclusively, so a symlink planted in the directory
+// is never followed.
 func atomicWriteJSON(path string, v any) error {
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal JSON: %w", err)
 	}
 
-	tmpPath := path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
 		return fmt.Errorf("write temp file: %w", err)
 	}
 
@@ -1,6 +1,7 @@
 package ipc
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -242,7 +243,39 @@ func TestAtomicWrite(t *testing.T) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		t.Fatal("File was not created")
 	}
-	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
-		t.Error("Temp file should not exist after successful write")
+	if tmps, _ := filepath.Glob(path + ".*.tmp"); len(tmps) > 0 {
+		t.Errorf("Temp files should not exist after successful write: %v", tmps)
+	}
+}
+
+func TestAtomicWrite_IgnoresPlantedTempSymlink(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(t.TempDir(), "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, commandFile)
+	if err := os.Symlink(victim, path+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := atomicWriteJSON(path, map[string]string{"key": "value"}); err != nil {
+		t.Fatalf("atomicWriteJSON failed: %v", err)
+	}
+	if data, _ := os.ReadFile(victim); string(data) != "keep" {
+		t.Errorf("symlink target was overwritten: %q", data)
+	}
+}
+
+func TestReader_WriteCommandSocketOnly(t *testing.T) {
+	dir := t.TempDir()
+	r := NewReader(dir)
+	r.SetSocketOnly(true)
+
+	if err := r.WriteCommand(&Command{ID: "cmd-1", Action: "restart"}); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("WriteCommand = %v, want ErrNotConnected", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, commandFile)); !os.IsNotExist(err) {
+		t.Error("command.json should not be written in socket-only mode")
 	}
 }
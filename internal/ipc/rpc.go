@@ -0,0 +1,276 @@
+package ipc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SocketName is the master's per-child socket in the IPC directory.
+const SocketName = "agent.sock"
+
+// ProtocolVersion is sent by the child in its hello.
+const ProtocolVersion = 1
+
+const (
+	// maxFrameSize bounds one JSON-RPC message on the socket.
+	maxFrameSize = 8 << 20
+	// writeTimeout bounds a frame write; a peer that stops reading is disconnected
+	// and the writer falls back to the file protocol.
+	writeTimeout = 5 * time.Second
+	// callTimeout bounds the wait for an ack.
+	callTimeout = 5 * time.Second
+)
+
+// JSON-RPC methods on the socket
+const (
+	MethodHello    = "hello"    // child → master request: Hello, sent on connect
+	MethodCommand  = "command"  // master → child request: Command; result CommandAck
+	MethodHealth   = "health"   // child → master notification: HealthReport
+	MethodProgress = "progress" // child → master notification: CommandProgress
+	MethodResult   = "result"   // child → master request: CommandResult; acked once recorded
+)
+
+// JSON-RPC error codes
+const (
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeQueueFull      = -32000 // the child's command queue is full; retry later
+)
+
+// ErrQueueFull is returned by Reader.WriteCommand when the child refuses a command
+// because its queue is full.
+var ErrQueueFull = errors.New("child command queue is full")
+
+// ErrNotConnected is returned by Reader.WriteCommand in socket-only mode while the child
+// is not connected.
+var ErrNotConnected = errors.New("child is not connected to its socket")
+
+// errClosed is returned for calls on a closed connection.
+var errClosed = errors.New("ipc connection closed")
+
+// errNotSent marks a call whose request never reached the peer, so it is safe to send it
+// another way. Any other call error leaves it unknown whether the peer acted on it.
+var errNotSent = errors.New("request not sent")
+
+// Hello identifies the child on a new connection.
+type Hello struct {
+	ProjectID string `json:"project_id"`
+	PID       int    `json:"pid"`
+	Protocol  int    `json:"protocol"`
+}
+
+// CommandAck acknowledges a queued command.
+type CommandAck struct {
+	Queued int `json:"queued"` // commands waiting in the child's queue, including this one
+}
+
+// CommandProgress is streamed by the child while a command runs.
+type CommandProgress struct {
+	CommandID string    `json:"command_id"`
+	Message   string    `json:"message"`
+	Data      any       `json:"data,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RPCError is a JSON-RPC error response.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// message is one JSON-RPC 2.0 request, notification (no ID) or response.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// handlerFunc serves requests and notifications received on a connection. It runs on the
+// read loop, so it must not block.
+type handlerFunc func(method string, params json.RawMessage) (any, error)
+
+// conn is a JSON-RPC connection over a stream socket. Each message is a frame: a 4-byte
+// big-endian length followed by the JSON body.
+type conn struct {
+	nc      net.Conn
+	handler handlerFunc
+
+	wmu sync.Mutex // serializes frame writes
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *message
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// SocketPath returns the socket path in an IPC directory.
+func SocketPath(dir string) string {
+	return filepath.Join(dir, SocketName)
+}
+
+// newConn wraps nc and starts its read loop.
+func newConn(nc net.Conn, handler handlerFunc) *conn {
+	c := &conn{
+		nc:      nc,
+		handler: handler,
+		pending: make(map[uint64]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Close closes the connection and fails pending calls.
+func (c *conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.nc.Close()
+		close(c.done)
+	})
+	return err
+}
+
+// call sends a request and waits for its response, decoding the result into result
+// (which may be nil).
+func (c *conn) call(ctx context.Context, method string, params, result any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("marshal %s params: %w", method, err)
+	}
+	ch := make(chan *message, 1)
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(&message{ID: id, Method: method, Params: raw}); err != nil {
+		return fmt.Errorf("%w: %w", errNotSent, err)
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-c.done:
+		return errClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification, which gets no response.
+func (c *conn) notify(method string, params any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("marshal %s params: %w", method, err)
+	}
+	return c.write(&message{Method: method, Params: raw})
+}
+
+// write sends one frame. A write that cannot finish within writeTimeout closes the connection.
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	if len(body) > maxFrameSize {
+		return fmt.Errorf("message too large (%d bytes)", len(body))
+	}
+	frame := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(frame, uint32(len(body)))
+	copy(frame[4:], body)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	select {
+	case <-c.done:
+		return errClosed
+	default:
+	}
+	_ = c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.nc.Write(frame); err != nil {
+		c.Close()
+		return fmt.Errorf("write frame: %w", err)
+	}
+	return nil
+}
+
+// readLoop reads frames until the connection fails, serving requests and routing responses.
+func (c *conn) readLoop() {
+	defer c.Close()
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(c.nc, hdr[:]); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n > maxFrameSize {
+			return
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(c.nc, body); err != nil {
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return
+		}
+
+		if msg.Method == "" {
+			c.mu.Lock()
+			ch := c.pending[msg.ID]
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+			continue
+		}
+
+		result, err := c.handler(msg.Method, msg.Params)
+		if msg.ID == 0 {
+			continue // notification
+		}
+		resp := &message{ID: msg.ID}
+		if err != nil {
+			var rpcErr *RPCError
+			if !errors.As(err, &rpcErr) {
+				rpcErr = &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+			}
+			resp.Error = rpcErr
+		} else if resp.Result, err = json.Marshal(result); err != nil {
+			resp.Error = &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		if c.write(resp) != nil {
+			return
+		}
+	}
+}
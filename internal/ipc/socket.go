@@ -0,0 +1,396 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxQueuedCommands bounds the child's command queue; further commands are refused
+	// with CodeQueueFull until it drains.
+	MaxQueuedCommands = 32
+	// maxQueuedProgress bounds the progress updates the master keeps between collections.
+	maxQueuedProgress = 256
+	// maxQueuedResults bounds the command results the master keeps between collections.
+	maxQueuedResults = 256
+	// redialInterval is the pause between the child's connection attempts.
+	redialInterval = 2 * time.Second
+)
+
+// socketState is the child's socket connection and the commands it has queued.
+type socketState struct {
+	conn  *conn // nil while disconnected
+	queue []*Command
+	ready chan struct{} // signalled when a command is queued
+}
+
+// Connect keeps the child connected to the master's socket in the IPC directory until ctx
+// ends, redialing after failures. While connected, health, results and progress go over
+// the socket and commands arrive there; otherwise the files are used.
+func (w *Writer) Connect(ctx context.Context, projectID string) {
+	go func() {
+		for {
+			if c, err := w.dial(ctx, projectID); err == nil {
+				select {
+				case <-c.done:
+				case <-ctx.Done():
+				}
+				c.Close()
+				w.mu.Lock()
+				if w.sock.conn == c {
+					w.sock.conn = nil
+				}
+				w.mu.Unlock()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(redialInterval):
+			}
+		}
+	}()
+}
+
+// dial connects to the master and introduces the child.
+func (w *Writer) dial(ctx context.Context, projectID string) (*conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "unix", SocketPath(w.dir))
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(nc, w.handle)
+	callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	hello := Hello{ProjectID: projectID, PID: os.Getpid(), Protocol: ProtocolVersion}
+	if err := c.call(callCtx, MethodHello, hello, nil); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("hello: %w", err)
+	}
+	w.mu.Lock()
+	w.sock.conn = c
+	w.mu.Unlock()
+	return c, nil
+}
+
+// handle serves the master's requests on the socket.
+func (w *Writer) handle(method string, params json.RawMessage) (any, error) {
+	if method != MethodCommand {
+		return nil, &RPCError{Code: CodeMethodNotFound, Message: "unknown method " + method}
+	}
+	var cmd Command
+	if err := json.Unmarshal(params, &cmd); err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.sock.queue) >= MaxQueuedCommands {
+		return nil, &RPCError{Code: CodeQueueFull, Message: ErrQueueFull.Error()}
+	}
+	w.sock.queue = append(w.sock.queue, &cmd)
+	select {
+	case w.sock.ready <- struct{}{}:
+	default:
+	}
+	return CommandAck{Queued: len(w.sock.queue)}, nil
+}
+
+// Connected reports whether the child is connected to the master's socket.
+func (w *Writer) Connected() bool {
+	return w.active() != nil
+}
+
+// CommandReady is signalled when a command arrives on the socket.
+func (w *Writer) CommandReady() <-chan struct{} {
+	return w.sock.ready
+}
+
+// WriteProgress streams a progress update for a running command. Progress is only sent
+// over the socket; without a connection it is dropped.
+func (w *Writer) WriteProgress(p *CommandProgress) error {
+	c := w.active()
+	if c == nil {
+		return nil
+	}
+	return c.notify(MethodProgress, p)
+}
+
+func (w *Writer) active() *conn {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sock.conn
+}
+
+// popCommand takes the oldest command queued from the socket.
+func (w *Writer) popCommand() *Command {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.sock.queue) == 0 {
+		return nil
+	}
+	cmd := w.sock.queue[0]
+	w.sock.queue = w.sock.queue[1:]
+	return cmd
+}
+
+// server is the master's end of one child's socket.
+type server struct {
+	ln        net.Listener
+	projectID string // the only project allowed to say hello
+
+	mu       sync.Mutex
+	conn     *conn // the child's current connection; nil while disconnected
+	health   *HealthReport
+	healthAt time.Time
+	results  []*CommandResult
+	progress []CommandProgress
+}
+
+// Listen opens projectID's socket in the reader's IPC directory. Until the child connects
+// (or if it never does, e.g. an older agent) the reader uses the files.
+func (r *Reader) Listen(projectID string) error {
+	path := SocketPath(r.dir)
+	_ = os.Remove(path) // stale socket from a previous master
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+	s := &server{ln: ln, projectID: projectID}
+	r.srv = s
+	go s.accept()
+	return nil
+}
+
+// ListenerFile returns a duplicate of the socket's listener, so a new master can take
+// the socket over on self-upgrade without the child losing its address.
+func (r *Reader) ListenerFile() (*os.File, error) {
+	if r.srv == nil {
+		return nil, errors.New("not listening on the socket")
+	}
+	ul, ok := r.srv.ln.(*net.UnixListener)
+	if !ok {
+		return nil, fmt.Errorf("unexpected listener %T", r.srv.ln)
+	}
+	return ul.File()
+}
+
+// ListenFile serves projectID's socket on a listener inherited from a previous master
+// (see ListenerFile). f is closed.
+func (r *Reader) ListenFile(f *os.File, projectID string) error {
+	ln, err := net.FileListener(f)
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("inherit socket listener: %w", err)
+	}
+	s := &server{ln: ln, projectID: projectID}
+	r.srv = s
+	go s.accept()
+	return nil
+}
+
+// Close closes the socket and the child's connection.
+func (r *Reader) Close() error {
+	if r.srv == nil {
+		return nil
+	}
+	err := r.srv.ln.Close()
+	r.srv.mu.Lock()
+	if r.srv.conn != nil {
+		r.srv.conn.Close()
+	}
+	r.srv.mu.Unlock()
+	_ = os.Remove(SocketPath(r.dir))
+	return err
+}
+
+// Connected reports whether the child is connected to the socket.
+func (r *Reader) Connected() bool {
+	return r.active() != nil
+}
+
+// ReadProgress returns and clears the progress updates streamed since the last call.
+func (r *Reader) ReadProgress() []CommandProgress {
+	if r.srv == nil {
+		return nil
+	}
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+	p := r.srv.progress
+	r.srv.progress = nil
+	return p
+}
+
+func (r *Reader) active() *conn {
+	if r.srv == nil {
+		return nil
+	}
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+	return r.srv.conn
+}
+
+// sendCommand queues cmd in the connected child. ok is false when the command never
+// reached the socket and should go to the file instead. Once it was written, an error
+// is returned as is: the child may have queued it, so the file would run it twice.
+func (r *Reader) sendCommand(cmd *Command) (ok bool, err error) {
+	c := r.active()
+	if c == nil {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	var ack CommandAck
+	err = c.call(ctx, MethodCommand, cmd, &ack)
+	var rpcErr *RPCError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &rpcErr) && rpcErr.Code == CodeQueueFull:
+		return true, ErrQueueFull
+	case errors.As(err, &rpcErr):
+		return true, err
+	case errors.Is(err, errNotSent):
+		return false, nil // no connection: fall back to the file
+	}
+	return true, fmt.Errorf("command %s may not have been queued: %w", cmd.ID, err)
+}
+
+// freshHealth returns the last pushed health report if it arrived within maxAge.
+func (r *Reader) freshHealth(maxAge time.Duration) *HealthReport {
+	if r.srv == nil {
+		return nil
+	}
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+	if r.srv.health == nil || time.Since(r.srv.healthAt) > maxAge {
+		return nil
+	}
+	return r.srv.health
+}
+
+// popResult takes the oldest result received on the socket.
+func (r *Reader) popResult() *CommandResult {
+	if r.srv == nil {
+		return nil
+	}
+	r.srv.mu.Lock()
+	defer r.srv.mu.Unlock()
+	if len(r.srv.results) == 0 {
+		return nil
+	}
+	res := r.srv.results[0]
+	r.srv.results = r.srv.results[1:]
+	return res
+}
+
+// accept serves child connections until the listener closes. A connection that says
+// hello for the right project replaces the previous one (the child restarted); one that
+// does not within callTimeout is dropped.
+func (s *server) accept() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		sess := &session{srv: s, ready: make(chan struct{})}
+		c := newConn(nc, sess.handle)
+		go func() {
+			select {
+			case <-sess.ready:
+			case <-c.done:
+				return
+			case <-time.After(callTimeout):
+				c.Close()
+				return
+			}
+			s.mu.Lock()
+			old := s.conn
+			s.conn = c
+			s.mu.Unlock()
+			if old != nil {
+				old.Close()
+			}
+			<-c.done
+			s.mu.Lock()
+			if s.conn == c {
+				s.conn = nil
+			}
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// session is one connection to the server. Until its hello is accepted the child's other
+// messages are refused.
+type session struct {
+	srv   *server
+	hello bool          // guarded by srv.mu
+	ready chan struct{} // closed once hello is accepted
+}
+
+func (sess *session) handle(method string, params json.RawMessage) (any, error) {
+	s := sess.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if method == MethodHello {
+		var hello Hello
+		if err := json.Unmarshal(params, &hello); err != nil {
+			return nil, err
+		}
+		if hello.ProjectID != s.projectID {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: fmt.Sprintf("socket belongs to project %q, not %q", s.projectID, hello.ProjectID)}
+		}
+		if !sess.hello {
+			sess.hello = true
+			close(sess.ready)
+		}
+		return struct{}{}, nil
+	}
+	if !sess.hello {
+		return nil, &RPCError{Code: CodeInvalidRequest, Message: "hello required before " + method}
+	}
+	return s.handle(method, params)
+}
+
+// handle serves the child's messages once it said hello. s.mu is held.
+func (s *server) handle(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case MethodHealth:
+		var report HealthReport
+		if err := json.Unmarshal(params, &report); err != nil {
+			return nil, err
+		}
+		s.health, s.healthAt = &report, time.Now()
+		return nil, nil
+	case MethodProgress:
+		var p CommandProgress
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if len(s.progress) >= maxQueuedProgress {
+			s.progress = s.progress[1:]
+		}
+		s.progress = append(s.progress, p)
+		return nil, nil
+	case MethodResult:
+		var result CommandResult
+		if err := json.Unmarshal(params, &result); err != nil {
+			return nil, err
+		}
+		if len(s.results) >= maxQueuedResults {
+			s.results = s.results[1:]
+		}
+		s.results = append(s.results, &result)
+		return struct{}{}, nil
+	}
+	return nil, &RPCError{Code: CodeMethodNotFound, Message: "unknown method " + method}
+}
@@ -0,0 +1,357 @@
+package ipc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// connectPair listens as the master and connects a child writer in dir.
+func connectPair(t *testing.T, dir string) (*Reader, *Writer) {
+	t.Helper()
+	r := NewReader(dir)
+	if err := r.Listen("test-project"); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	w.Connect(t.Context(), "test-project")
+	waitFor(t, func() bool { return w.Connected() && r.Connected() })
+	return r, w
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSocket_CommandQueueAndResults(t *testing.T) {
+	dir := t.TempDir()
+	r, w := connectPair(t, dir)
+
+	// Commands sent back to back are all queued, in order
+	for i := 1; i <= 3; i++ {
+		if err := r.WriteCommand(&Command{ID: fmt.Sprintf("cmd-%d", i), Action: ActionHealthCheck}); err != nil {
+			t.Fatalf("WriteCommand %d failed: %v", i, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, commandFile)); !os.IsNotExist(err) {
+		t.Error("command.json written while connected")
+	}
+	for i := 1; i <= 3; i++ {
+		cmd, err := w.ReadCommand()
+		if err != nil || cmd == nil || cmd.ID != fmt.Sprintf("cmd-%d", i) {
+			t.Fatalf("ReadCommand %d = %+v, %v", i, cmd, err)
+		}
+	}
+	if cmd, _ := w.ReadCommand(); cmd != nil {
+		t.Errorf("unexpected command %+v", cmd)
+	}
+
+	// Results are acked and kept in order until collected
+	for _, id := range []string{"cmd-1", "cmd-2"} {
+		if err := w.WriteCommandResult(&CommandResult{CommandID: id, Status: ResultSuccess}); err != nil {
+			t.Fatalf("WriteCommandResult failed: %v", err)
+		}
+	}
+	for _, id := range []string{"cmd-1", "cmd-2"} {
+		result, err := r.ReadCommandResult()
+		if err != nil || result == nil || result.CommandID != id {
+			t.Fatalf("ReadCommandResult = %+v, %v; want %s", result, err, id)
+		}
+	}
+	if result, _ := r.ReadCommandResult(); result != nil {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestSocket_Backpressure(t *testing.T) {
+	r, w := connectPair(t, t.TempDir())
+
+	for i := 0; i < MaxQueuedCommands; i++ {
+		if err := r.WriteCommand(&Command{ID: fmt.Sprintf("cmd-%d", i)}); err != nil {
+			t.Fatalf("WriteCommand %d failed: %v", i, err)
+		}
+	}
+	if err := r.WriteCommand(&Command{ID: "overflow"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("WriteCommand on full queue = %v, want ErrQueueFull", err)
+	}
+	// Draining one makes room again
+	if cmd, _ := w.ReadCommand(); cmd == nil {
+		t.Fatal("no command queued")
+	}
+	if err := r.WriteCommand(&Command{ID: "retry"}); err != nil {
+		t.Fatalf("WriteCommand after drain failed: %v", err)
+	}
+}
+
+func TestSocket_HealthPushAndProgress(t *testing.T) {
+	dir := t.TempDir()
+	r, w := connectPair(t, dir)
+
+	if err := w.WriteHealth(&HealthReport{ProjectID: "test-project", Status: StatusDegraded}); err != nil {
+		t.Fatalf("WriteHealth failed: %v", err)
+	}
+	var report *HealthReport
+	waitFor(t, func() bool {
+		report, _ = r.ReadHealthIfFresh(time.Minute)
+		return report != nil
+	})
+	if report.Status != StatusDegraded {
+		t.Errorf("pushed status = %s", report.Status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, healthFile)); !os.IsNotExist(err) {
+		t.Error("health.json written while connected")
+	}
+	if report, _ := r.ReadHealthIfFresh(0); report != nil {
+		t.Error("stale pushed health returned")
+	}
+
+	if err := w.WriteProgress(&CommandProgress{CommandID: "cmd-1", Message: "restarting"}); err != nil {
+		t.Fatalf("WriteProgress failed: %v", err)
+	}
+	var progress []CommandProgress
+	waitFor(t, func() bool {
+		progress = append(progress, r.ReadProgress()...)
+		return len(progress) > 0
+	})
+	if progress[0].CommandID != "cmd-1" || progress[0].Message != "restarting" {
+		t.Errorf("progress = %+v", progress)
+	}
+}
+
+func TestSocket_FileFallback(t *testing.T) {
+	dir := t.TempDir()
+
+	// A child that never connects (older agent) still gets commands through the file
+	r := NewReader(dir)
+	if err := r.Listen("test-project"); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	if err := r.WriteCommand(&Command{ID: "file-cmd"}); err != nil {
+		t.Fatalf("WriteCommand failed: %v", err)
+	}
+	if cmd, err := w.ReadCommand(); err != nil || cmd == nil || cmd.ID != "file-cmd" {
+		t.Fatalf("ReadCommand = %+v, %v", cmd, err)
+	}
+
+	// Once the master goes away the child falls back to the files
+	w.Connect(t.Context(), "test-project")
+	waitFor(t, w.Connected)
+	r.Close()
+	waitFor(t, func() bool { return !w.Connected() })
+	if err := w.WriteHealth(&HealthReport{ProjectID: "test-project", Status: StatusHealthy}); err != nil {
+		t.Fatalf("WriteHealth failed: %v", err)
+	}
+	if report, err := NewReader(dir).ReadHealth(); err != nil || report == nil || report.Status != StatusHealthy {
+		t.Errorf("health.json = %+v, %v", report, err)
+	}
+}
+
+func TestSocket_ListenerHandoff(t *testing.T) {
+	dir := t.TempDir()
+	r, w := connectPair(t, dir)
+
+	f, err := r.ListenerFile()
+	if err != nil {
+		t.Fatalf("ListenerFile failed: %v", err)
+	}
+	next := NewReader(dir)
+	if err := next.ListenFile(f, "test-project"); err != nil {
+		t.Fatalf("ListenFile failed: %v", err)
+	}
+	defer next.Close()
+
+	// The previous master goes away without removing the socket, as on exec
+	r.srv.ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	r.srv.ln.Close()
+	r.srv.conn.Close()
+
+	// The child counts as connected once the new master answered its hello
+	waitFor(t, func() bool { return next.Connected() && w.Connected() })
+	if err := w.WriteHealth(&HealthReport{ProjectID: "test-project", Status: StatusHealthy}); err != nil {
+		t.Fatalf("WriteHealth failed: %v", err)
+	}
+	waitFor(t, func() bool { return next.freshHealth(time.Minute) != nil })
+}
+
+// writeFrame writes one frame to a raw socket connection.
+func writeFrame(nc net.Conn, msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	_, err = nc.Write(append(frame, body...))
+	return err
+}
+
+// readFrame reads one frame from a raw socket connection.
+func readFrame(nc net.Conn) (*message, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(nc, size[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(nc, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	return &msg, json.Unmarshal(body, &msg)
+}
+
+func TestSocket_HelloForOtherProjectRefused(t *testing.T) {
+	dir := t.TempDir()
+	r := NewReader(dir)
+	if err := r.Listen("test-project"); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	nc, err := net.Dial("unix", SocketPath(dir))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer nc.Close()
+
+	// Messages before hello are refused
+	health, _ := json.Marshal(HealthReport{ProjectID: "other", Status: StatusHealthy})
+	if err := writeFrame(nc, &message{ID: 1, Method: MethodHealth, Params: health}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := readFrame(nc); err != nil || msg.Error == nil || msg.Error.Code != CodeInvalidRequest {
+		t.Errorf("health before hello = %+v, %v", msg, err)
+	}
+
+	hello, _ := json.Marshal(Hello{ProjectID: "other", Protocol: ProtocolVersion})
+	if err := writeFrame(nc, &message{ID: 2, Method: MethodHello, Params: hello}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := readFrame(nc); err != nil || msg.Error == nil || msg.Error.Code != CodeInvalidParams {
+		t.Errorf("hello for another project = %+v, %v", msg, err)
+	}
+	if r.Connected() || r.freshHealth(time.Minute) != nil {
+		t.Error("connection for another project accepted")
+	}
+}
+
+func TestSocket_ResultsCapped(t *testing.T) {
+	r, w := connectPair(t, t.TempDir())
+
+	for i := 0; i < maxQueuedResults+1; i++ {
+		if err := w.WriteCommandResult(&CommandResult{CommandID: fmt.Sprintf("cmd-%d", i)}); err != nil {
+			t.Fatalf("WriteCommandResult %d failed: %v", i, err)
+		}
+	}
+	// The oldest result makes room for the newest
+	if result := r.popResult(); result == nil || result.CommandID != "cmd-1" {
+		t.Errorf("oldest kept result = %+v, want cmd-1", result)
+	}
+	r.srv.mu.Lock()
+	n := len(r.srv.results)
+	r.srv.mu.Unlock()
+	if n != maxQueuedResults-1 {
+		t.Errorf("kept %d results after one pop, want %d", n, maxQueuedResults-1)
+	}
+}
+
+func TestSocket_CommandNotResentAfterDrop(t *testing.T) {
+	dir := t.TempDir()
+	r := NewReader(dir)
+	if err := r.Listen("test-project"); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	// A child that reads the command and drops the connection before acking it
+	nc, err := net.Dial("unix", SocketPath(dir))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	hello, _ := json.Marshal(Hello{ProjectID: "test-project", Protocol: ProtocolVersion})
+	if err := writeFrame(nc, &message{ID: 1, Method: MethodHello, Params: hello}); err != nil {
+		t.Fatalf("hello: %v", err)
+	}
+	if msg, err := readFrame(nc); err != nil || msg.Error != nil {
+		t.Fatalf("hello response = %+v, %v", msg, err)
+	}
+	waitFor(t, r.Connected)
+	go func() {
+		_, _ = readFrame(nc)
+		nc.Close()
+	}()
+
+	if err := r.WriteCommand(&Command{ID: "cmd-1", Action: ActionHealthCheck}); err == nil {
+		t.Error("WriteCommand succeeded without an ack")
+	}
+	if _, err := os.Stat(filepath.Join(dir, commandFile)); !os.IsNotExist(err) {
+		t.Error("command.json written for a command the child may have queued")
+	}
+
+	// Without a connection the file is still used
+	waitFor(t, func() bool { return !r.Connected() })
+	if err := r.WriteCommand(&Command{ID: "cmd-2"}); err != nil {
+		t.Fatalf("WriteCommand without connection failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, commandFile)); err != nil {
+		t.Errorf("command.json not written: %v", err)
+	}
+}
+
+func TestSocket_ResultNotResentAfterDrop(t *testing.T) {
+	dir := t.TempDir()
+	ln, err := net.Listen("unix", SocketPath(dir))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+
+	// A master that answers the hello, then reads the result and goes away
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c := newConn(nc, func(method string, params json.RawMessage) (any, error) {
+			if method == MethodResult {
+				nc.Close()
+			}
+			return struct{}{}, nil
+		})
+		<-c.done
+	}()
+	w.Connect(t.Context(), "test-project")
+	waitFor(t, w.Connected)
+
+	if err := w.WriteCommandResult(&CommandResult{CommandID: "cmd-1", Status: ResultSuccess}); err == nil {
+		t.Error("WriteCommandResult succeeded without an ack")
+	}
+	if _, err := os.Stat(filepath.Join(dir, commandResultFile)); !os.IsNotExist(err) {
+		t.Error("command_result.json written for a result the master may have recorded")
+	}
+}
@@ -1,9 +1,15 @@
-// Package ipc provides file-based inter-process communication between master and child agents.
+// Package ipc provides inter-process communication between master and child agents: framed
+// JSON-RPC over a per-child Unix socket, with the original JSON files as a fallback.
 package ipc
 
-import "time"
+import (
+	"time"
 
-// HealthReport is written by the child agent to {ipc-dir}/health.json every 10 seconds.
+	"beacon/internal/state"
+)
+
+// HealthReport is pushed by the child agent over the socket when its checks change and every
+// 10 seconds, or written to {ipc-dir}/health.json when not connected.
 // The master reads these to aggregate project health into heartbeat payloads.
 type HealthReport struct {
 	ProjectID     string         `json:"project_id"`
@@ -15,6 +21,23 @@ type HealthReport struct {
 	Metrics       map[string]any `json:"metrics,omitempty"`
 	LogsTail      []string       `json:"logs_tail,omitempty"`
 	Checks        []CheckResult  `json:"checks"`
+	// Services is the per-container state of a compose project's stack.
+	Services []ServiceStatus `json:"services,omitempty"`
+	// Deploy is set while a deploy of the project is running.
+	Deploy *state.DeployProgress `json:"deploy,omitempty"`
+	// Pending lists new releases held by the project's deploy gate.
+	Pending []state.PendingRelease `json:"pending,omitempty"`
+}
+
+// ServiceStatus is the state of one compose service container.
+type ServiceStatus struct {
+	Name      string `json:"name"`                // compose service name
+	Container string `json:"container,omitempty"` // container name
+	Image     string `json:"image,omitempty"`
+	State     string `json:"state"`            // "running", "exited", "restarting", ...
+	Health    string `json:"health,omitempty"` // "healthy", "unhealthy", "starting"
+	ExitCode  int    `json:"exit_code,omitempty"`
+	Status    string `json:"status,omitempty"` // e.g. "Up 5 minutes (healthy)"
 }
 
 // CheckResult represents the result of a single health check.
@@ -25,23 +48,47 @@ type CheckResult struct {
 	Error     string `json:"error,omitempty"`
 }
 
-// Command is written by the master to {ipc-dir}/command.json for the child to execute.
+// Command is sent by the master over the socket, which queues it in the child, or written
+// to {ipc-dir}/command.json for the child to poll.
 type Command struct {
 	ID        string         `json:"id"`
-	Action    string         `json:"action"` // "restart", "stop", "health_check", "fetch_logs"
-	Payload   map[string]any `json:"payload,omitempty"`
+	Action    string         `json:"action"`            // "restart", "stop", "start", "health_check", "fetch_logs", "approve_deploy"
+	Payload   map[string]any `json:"payload,omitempty"` // restart/stop/start accept "service" for a single compose service
 	Timestamp time.Time      `json:"timestamp"`
 }
 
-// CommandResult is written by the child to {ipc-dir}/command_result.json after executing a command.
+// CommandResult is sent by the child over the socket, or written to
+// {ipc-dir}/command_result.json, after executing a command.
 type CommandResult struct {
 	CommandID string    `json:"command_id"`
-	Status    string    `json:"status"` // "success", "failed"
+	Status    string    `json:"status"` // "success", "failed" ("running" for progress)
 	Message   string    `json:"message,omitempty"`
 	Data      any       `json:"data,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// LifecycleResult is CommandResult.Data for restart, stop and start.
+type LifecycleResult struct {
+	Action     string          `json:"action"`
+	Adapter    string          `json:"adapter"`           // "command", "systemd" or "compose"
+	Target     string          `json:"target,omitempty"`  // unit, service(s) or stack acted on
+	Command    string          `json:"command,omitempty"` // command line that ran
+	ExitCode   int             `json:"exit_code"`         // -1 when the command could not run or timed out
+	TimedOut   bool            `json:"timed_out,omitempty"`
+	Output     string          `json:"output,omitempty"` // combined stdout/stderr (tail)
+	DurationMs int64           `json:"duration_ms"`
+	Health     string          `json:"health"` // project status after the post-action re-check
+	Checks     []CheckResult   `json:"checks,omitempty"`
+	Services   []ServiceStatus `json:"services,omitempty"`
+}
+
+// AgentRestartRequest is written to {ipc-dir}/agent_restart.json by `beacon projects
+// agent-restart`; the master respawns the project's agent and deletes the file.
+type AgentRestartRequest struct {
+	RequestedBy string    `json:"requested_by,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
 // Status constants for HealthReport.Status
 const (
 	StatusHealthy  = "healthy"
@@ -52,14 +99,20 @@ const (
 
 // Action constants for Command.Action
 const (
-	ActionRestart     = "restart"
-	ActionStop        = "stop"
-	ActionHealthCheck = "health_check"
-	ActionFetchLogs   = "fetch_logs"
+	ActionRestart       = "restart"
+	ActionStop          = "stop"
+	ActionStart         = "start"
+	ActionHealthCheck   = "health_check"
+	ActionFetchLogs     = "fetch_logs"
+	ActionApproveDeploy = "approve_deploy" // approve releases held by the deploy gate
 )
 
+// PayloadService is the Command.Payload key naming the compose service to restart, stop or start.
+const PayloadService = "service"
+
 // Result status constants for CommandResult.Status
 const (
 	ResultSuccess = "success"
 	ResultFailed  = "failed"
+	ResultRunning = "running" // progress of a command still running (socket IPC only)
 )
@@ -0,0 +1,177 @@
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SecretPrefix marks an environment value that refers to a stored key instead of holding
+// the value itself: `DB_PASSWORD: key://nextcloud-db` injects the key "nextcloud-db".
+const SecretPrefix = "key://"
+
+// redactedValue replaces secret values in captured output.
+const redactedValue = "********"
+
+// minRedactLen is the shortest secret that is redacted; shorter values would mangle output.
+const minRedactLen = 4
+
+// Env is an environment resolved for a command: KEY=value pairs with key:// references
+// decrypted, plus the secret values to redact from the command's output. Secrets only live
+// in memory and in the child process environment.
+type Env struct {
+	Vars    []string
+	secrets []string
+}
+
+// IsSecretRef reports whether value is a key:// reference.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretPrefix)
+}
+
+// ResolveEnv resolves env maps in order (later maps override earlier ones) using the key
+// store in the Beacon home directory. The key store is only opened when a value is a
+// key:// reference.
+func ResolveEnv(maps ...map[string]string) (*Env, error) {
+	var km *KeyManager
+	return resolveEnv(func(name string) (string, error) {
+		if km == nil {
+			var err error
+			if km, err = NewKeyManager(getConfigDir()); err != nil {
+				return "", fmt.Errorf("failed to initialize key manager: %w", err)
+			}
+		}
+		return km.secret(name)
+	}, maps)
+}
+
+// ResolveValue returns value, or the stored key it names when it is a key:// reference.
+func ResolveValue(value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+	km, err := NewKeyManager(getConfigDir())
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize key manager: %w", err)
+	}
+	return km.secret(strings.TrimPrefix(value, SecretPrefix))
+}
+
+// ResolveEnv resolves env maps in order (later maps override earlier ones) against km.
+func (km *KeyManager) ResolveEnv(maps ...map[string]string) (*Env, error) {
+	return resolveEnv(km.secret, maps)
+}
+
+func resolveEnv(lookup func(name string) (string, error), maps []map[string]string) (*Env, error) {
+	e := &Env{}
+	for _, m := range maps {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			v := m[k]
+			if !IsSecretRef(v) {
+				e.Vars = append(e.Vars, k+"="+os.ExpandEnv(v))
+				continue
+			}
+			secret, err := lookup(strings.TrimPrefix(v, SecretPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("env %s: %w", k, err)
+			}
+			e.Vars = append(e.Vars, k+"="+secret)
+			e.AddSecret(secret)
+		}
+	}
+	return e, nil
+}
+
+// secret returns the value of the stored key name.
+func (km *KeyManager) secret(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty key name in %s reference", SecretPrefix)
+	}
+	key, err := km.GetKey(name)
+	if err != nil {
+		return "", fmt.Errorf("secret '%s': %w", name, err)
+	}
+	return key.Key, nil
+}
+
+// AddSecret registers another value to redact (for example a token passed some other way).
+func (e *Env) AddSecret(value string) {
+	if len(value) < minRedactLen || strings.Contains(redactedValue, value) {
+		return
+	}
+	for _, s := range e.secrets {
+		if s == value {
+			return
+		}
+	}
+	e.secrets = append(e.secrets, value)
+	// Longest first, so a secret containing another is replaced whole
+	sort.Slice(e.secrets, func(i, j int) bool { return len(e.secrets[i]) > len(e.secrets[j]) })
+}
+
+// Redact replaces every secret value in s.
+func (e *Env) Redact(s string) string {
+	if e == nil {
+		return s
+	}
+	for _, secret := range e.secrets {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return s
+}
+
+// Writer wraps w so secret values written to it are redacted, including values split across
+// writes. Close flushes the held-back tail; it does not close w.
+func (e *Env) Writer(w io.Writer) io.WriteCloser {
+	rw := &redactWriter{w: w}
+	if e != nil {
+		rw.secrets = e.secrets
+		for _, s := range e.secrets {
+			if len(s)-1 > rw.hold {
+				rw.hold = len(s) - 1
+			}
+		}
+	}
+	return rw
+}
+
+type redactWriter struct {
+	w       io.Writer
+	secrets []string
+	hold    int // bytes kept back in case they start a secret
+	buf     []byte
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if len(r.secrets) == 0 {
+		return r.w.Write(p)
+	}
+	r.buf = append(r.buf, p...)
+	for _, s := range r.secrets {
+		r.buf = bytes.ReplaceAll(r.buf, []byte(s), []byte(redactedValue))
+	}
+	if n := len(r.buf) - r.hold; n > 0 {
+		if _, err := r.w.Write(r.buf[:n]); err != nil {
+			return 0, err
+		}
+		r.buf = append(r.buf[:0], r.buf[n:]...)
+	}
+	return len(p), nil
+}
+
+func (r *redactWriter) Close() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.buf)
+	r.buf = nil
+	return err
+}
@@ -0,0 +1,56 @@
+package keys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveEnv(t *testing.T) {
+	km, err := NewKeyManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := km.AddKey("db", "hunter2-secret", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REGION", "eu")
+
+	env, err := km.ResolveEnv(
+		map[string]string{"DB_PASSWORD": "key://db", "HOST": "db.$REGION.internal"},
+		map[string]string{"HOST": "override"},
+	)
+	if err != nil {
+		t.Fatalf("ResolveEnv: %v", err)
+	}
+	want := "DB_PASSWORD=hunter2-secret HOST=db.eu.internal HOST=override"
+	if got := strings.Join(env.Vars, " "); got != want {
+		t.Errorf("Vars = %q, want %q", got, want)
+	}
+	if got := env.Redact("password is hunter2-secret"); got != "password is ********" {
+		t.Errorf("Redact = %q", got)
+	}
+
+	if _, err := km.ResolveEnv(map[string]string{"TOKEN": "key://missing"}); err == nil || !strings.Contains(err.Error(), "TOKEN") {
+		t.Errorf("missing key: err = %v", err)
+	}
+}
+
+func TestRedactWriter_SplitWrites(t *testing.T) {
+	env := &Env{}
+	env.AddSecret("abcdef")
+	env.AddSecret("xy") // too short to redact
+
+	var out strings.Builder
+	w := env.Writer(&out)
+	for _, chunk := range []string{"start abc", "def middle ab", "cdefab", "cdef xy end"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "start ******** middle **************** xy end"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
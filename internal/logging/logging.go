@@ -21,6 +21,9 @@ import (
 	"time"
 )
 
+// timeFormat is the timestamp that starts every line.
+const timeFormat = "2006/01/02 15:04:05"
+
 // Level represents a log severity level.
 type Level int32
 
@@ -72,6 +75,11 @@ func SetOutput(w io.Writer) {
 	}
 }
 
+// ParseLevel parses "debug", "info", "warn" or "error".
+func ParseLevel(s string) (Level, bool) {
+	return parseLevel(s)
+}
+
 func parseLevel(s string) (Level, bool) {
 	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "debug":
@@ -113,7 +121,7 @@ func (l *Logger) write(lvl Level, format string, args ...any) {
 	if len(args) > 0 {
 		msg = fmt.Sprintf(format, args...)
 	}
-	ts := time.Now().Format("2006/01/02 15:04:05")
+	ts := time.Now().Format(timeFormat)
 	var line string
 	if lvl == LevelInfo {
 		line = fmt.Sprintf("%s %s %s\n", ts, l.prefix, msg)
@@ -138,6 +146,30 @@ func levelTag(lvl Level) string {
 	}
 }
 
+// ParseLine reads the time and level of a line written by a Logger. ok is false for
+// other lines, such as a panic trace or a command's raw output.
+func ParseLine(line string) (t time.Time, lvl Level, ok bool) {
+	if len(line) < len(timeFormat) {
+		return time.Time{}, LevelInfo, false
+	}
+	t, err := time.ParseInLocation(timeFormat, line[:len(timeFormat)], time.Local)
+	if err != nil {
+		return time.Time{}, LevelInfo, false
+	}
+	rest := strings.TrimPrefix(line[len(timeFormat):], " ")
+	if strings.HasPrefix(rest, "[") {
+		if i := strings.Index(rest, "] "); i >= 0 {
+			rest = rest[i+2:]
+		}
+	}
+	for _, l := range []Level{LevelDebug, LevelWarn, LevelError} {
+		if strings.HasPrefix(rest, levelTag(l)+": ") {
+			return t, l, true
+		}
+	}
+	return t, LevelInfo, true
+}
+
 // Debugf logs at debug level.
 func (l *Logger) Debugf(format string, args ...any) { l.write(LevelDebug, format, args...) }
 
@@ -0,0 +1,219 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source is a named log file (with its rotated files) read by `beacon logs`.
+type Source struct {
+	Name string // "master" or the project
+	Path string
+}
+
+// Entry is a log line together with the lines that continue it, such as a panic trace.
+// Lines not written by a Logger take the time and level of the entry before them.
+type Entry struct {
+	Source string
+	Time   time.Time
+	Level  Level
+	Text   string
+}
+
+// Filter selects log entries.
+type Filter struct {
+	Since    time.Time // zero: the current file and the last rotated one
+	MinLevel Level
+}
+
+func (f Filter) match(e Entry) bool {
+	return e.Level >= f.MinLevel && !e.Time.Before(f.Since)
+}
+
+// ReadEntries reads the entries of a source that match the filter, oldest first.
+func ReadEntries(src Source, filter Filter) ([]Entry, error) {
+	files := RotatedFiles(src.Path)
+	if filter.Since.IsZero() {
+		if len(files) > 1 {
+			files = files[len(files)-1:]
+		}
+	} else {
+		var recent []string
+		for _, f := range files {
+			if at, ok := RotatedAt(f); ok && at.Before(filter.Since) {
+				continue // rotated, so all of it is older
+			}
+			recent = append(recent, f)
+		}
+		files = recent
+	}
+	if _, err := os.Stat(src.Path); err == nil {
+		files = append(files, src.Path)
+	}
+
+	var entries []Entry
+	p := &entryParser{source: src.Name}
+	for _, path := range files {
+		rc, err := OpenLogFile(path)
+		if err != nil {
+			continue // removed by rotation meanwhile
+		}
+		sc := bufio.NewScanner(rc)
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			if e, ok := p.line(sc.Text()); ok && filter.match(e) {
+				entries = append(entries, e)
+			}
+		}
+		rc.Close()
+	}
+	if e, ok := p.flush(); ok && filter.match(e) {
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Merge interleaves the entries of several sources by time.
+func Merge(lists ...[]Entry) []Entry {
+	var all []Entry
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	return all
+}
+
+// entryParser groups lines into entries.
+type entryParser struct {
+	source  string
+	pending *Entry
+	last    Entry // time and level for lines without their own
+}
+
+// line adds a line; it returns the previous entry once a new one starts.
+func (p *entryParser) line(text string) (Entry, bool) {
+	t, lvl, ok := ParseLine(text)
+	if !ok && p.pending != nil {
+		p.pending.Text += "\n" + text
+		return Entry{}, false
+	}
+	done, hasDone := p.flush()
+	if !ok {
+		t, lvl = p.last.Time, p.last.Level
+	}
+	p.pending = &Entry{Source: p.source, Time: t, Level: lvl, Text: text}
+	return done, hasDone
+}
+
+func (p *entryParser) flush() (Entry, bool) {
+	if p.pending == nil {
+		return Entry{}, false
+	}
+	e := *p.pending
+	p.pending = nil
+	p.last = e
+	return e, true
+}
+
+// Follower tails the current files of sources, following rotation.
+type Follower struct {
+	tails []*tail
+}
+
+type tail struct {
+	src     Source
+	f       *os.File
+	partial []byte
+	parser  entryParser
+}
+
+// NewFollower starts following sources from the current end of their files.
+func NewFollower(sources []Source) *Follower {
+	fw := &Follower{}
+	for _, src := range sources {
+		t := &tail{src: src, parser: entryParser{source: src.Name}}
+		if f, err := os.Open(src.Path); err == nil {
+			_, _ = f.Seek(0, io.SeekEnd)
+			t.f = f
+		}
+		fw.tails = append(fw.tails, t)
+	}
+	return fw
+}
+
+// Poll returns the complete entries written since the last poll that match the filter,
+// in time order. An entry is complete once the next one starts, or at the end of a poll.
+func (fw *Follower) Poll(filter Filter) []Entry {
+	var lists [][]Entry
+	for _, t := range fw.tails {
+		lists = append(lists, t.poll(filter))
+	}
+	return Merge(lists...)
+}
+
+// Close closes the followed files.
+func (fw *Follower) Close() {
+	for _, t := range fw.tails {
+		if t.f != nil {
+			t.f.Close()
+		}
+	}
+}
+
+func (t *tail) poll(filter Filter) []Entry {
+	var entries []Entry
+	if t.f != nil {
+		entries = t.read(filter)
+	}
+	// Rotated or created since: finish the old file, then start on the new one
+	info, err := os.Stat(t.src.Path)
+	if err == nil && !t.sameFile(info) {
+		if t.f != nil {
+			t.f.Close()
+		}
+		t.f, t.partial = nil, nil
+		if f, err := os.Open(t.src.Path); err == nil {
+			t.f = f
+			entries = append(entries, t.read(filter)...)
+		}
+	}
+	if e, ok := t.parser.flush(); ok && filter.match(e) {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (t *tail) sameFile(info os.FileInfo) bool {
+	if t.f == nil {
+		return false
+	}
+	cur, err := t.f.Stat()
+	return err == nil && os.SameFile(cur, info)
+}
+
+// read consumes the complete lines appended to the open file.
+func (t *tail) read(filter Filter) []Entry {
+	data, _ := io.ReadAll(t.f)
+	if len(data) == 0 {
+		return nil
+	}
+	data = append(t.partial, data...)
+	i := bytes.LastIndexByte(data, '\n')
+	if i < 0 {
+		t.partial = data
+		return nil
+	}
+	t.partial = append([]byte(nil), data[i+1:]...)
+	var entries []Entry
+	for _, line := range strings.Split(string(data[:i]), "\n") {
+		if e, ok := t.parser.line(line); ok && filter.match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
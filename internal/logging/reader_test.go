@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line string
+		lvl  Level
+		ok   bool
+	}{
+		{"2026/10/18 15:04:05 [Beacon master] started", LevelInfo, true},
+		{"2026/10/18 15:04:05 [Beacon master] WARN: disk low", LevelWarn, true},
+		{"2026/10/18 15:04:05 [Beacon myapp] ERROR: deploy failed", LevelError, true},
+		{"2026/10/18 15:04:05 DEBUG: no prefix", LevelDebug, true},
+		{"goroutine 1 [running]:", LevelInfo, false},
+		{"", LevelInfo, false},
+	}
+	for _, tc := range cases {
+		ts, lvl, ok := ParseLine(tc.line)
+		if ok != tc.ok || lvl != tc.lvl {
+			t.Errorf("ParseLine(%q) = %v, %v; want %v, %v", tc.line, lvl, ok, tc.lvl, tc.ok)
+		}
+		if ok && ts.Format(timeFormat) != "2026/10/18 15:04:05" {
+			t.Errorf("ParseLine(%q) time = %v", tc.line, ts)
+		}
+	}
+}
+
+func TestReadEntries_FiltersAndGroupsContinuations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	log := "2026/10/18 10:00:00 [Beacon app] starting\n" +
+		"2026/10/18 11:00:00 [Beacon app] ERROR: crashed\n" +
+		"panic: boom\n" +
+		"goroutine 1 [running]:\n" +
+		"2026/10/18 12:00:00 [Beacon app] WARN: restarted\n"
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Date(2026, 10, 18, 10, 30, 0, 0, time.Local)
+	entries, err := ReadEntries(Source{Name: "app", Path: path}, Filter{Since: since, MinLevel: LevelWarn})
+	if err != nil {
+		t.Fatalf("ReadEntries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	want := "2026/10/18 11:00:00 [Beacon app] ERROR: crashed\npanic: boom\ngoroutine 1 [running]:"
+	if entries[0].Text != want || entries[0].Level != LevelError || entries[0].Source != "app" {
+		t.Errorf("first entry = %+v, want the error with its trace", entries[0])
+	}
+	if entries[1].Level != LevelWarn {
+		t.Errorf("second entry level = %v, want warn", entries[1].Level)
+	}
+}
+
+func TestReadEntries_IncludesRotatedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	r, err := OpenRotating(path, RotateOptions{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("2026/10/18 10:00:00 [Beacon app] before rotation\n"))
+	r.Rotate()
+	r.Write([]byte("2026/10/18 11:00:00 [Beacon app] after rotation\n"))
+	r.Close()
+
+	entries, err := ReadEntries(Source{Name: "app", Path: path}, Filter{})
+	if err != nil {
+		t.Fatalf("ReadEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Text != "2026/10/18 10:00:00 [Beacon app] before rotation" {
+		t.Errorf("entries = %+v, want the rotated line first", entries)
+	}
+}
+
+func TestMerge_OrdersByTime(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2026, 10, 18, h, 0, 0, 0, time.Local) }
+	master := []Entry{{Source: "master", Time: at(9)}, {Source: "master", Time: at(12)}}
+	app := []Entry{{Source: "app", Time: at(10)}, {Source: "app", Time: at(12)}}
+
+	var got []string
+	for _, e := range Merge(master, app) {
+		got = append(got, e.Source+e.Time.Format("15"))
+	}
+	want := []string{"master09", "app10", "master12", "app12"}
+	if len(got) != len(want) {
+		t.Fatalf("Merge = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Merge = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFollower_FollowsAppendsAndRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	r, err := OpenRotating(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Write([]byte("2026/10/18 10:00:00 [Beacon app] history\n"))
+
+	fw := NewFollower([]Source{{Name: "app", Path: path}})
+	defer fw.Close()
+	if got := fw.Poll(Filter{}); len(got) != 0 {
+		t.Fatalf("first Poll = %+v, want nothing (history is skipped)", got)
+	}
+
+	r.Write([]byte("2026/10/18 10:01:00 [Beacon app] appended\n2026/10/18 10:02:00 [Beacon app] partial"))
+	got := fw.Poll(Filter{})
+	if len(got) != 1 || got[0].Text != "2026/10/18 10:01:00 [Beacon app] appended" {
+		t.Fatalf("Poll after append = %+v, want the complete line only", got)
+	}
+
+	r.Write([]byte(" line\n"))
+	r.Rotate()
+	r.Write([]byte("2026/10/18 10:03:00 [Beacon app] new file\n"))
+	got = fw.Poll(Filter{})
+	if len(got) != 2 || got[0].Text != "2026/10/18 10:02:00 [Beacon app] partial line" ||
+		got[1].Text != "2026/10/18 10:03:00 [Beacon app] new file" {
+		t.Fatalf("Poll across rotation = %+v", got)
+	}
+}
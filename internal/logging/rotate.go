@@ -0,0 +1,282 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the suffix of rotated files: agent.log.20261018-153000[.gz].
+const rotatedTimeFormat = "20060102-150405"
+
+// RotateOptions controls when a RotatingFile rotates and how many old files it keeps.
+type RotateOptions struct {
+	MaxSize    int64         // rotate when the file would grow past this (0 = no size limit)
+	MaxAge     time.Duration // rotate when the file is older than this (0 = no age limit)
+	MaxBackups int           // rotated files kept (0 = keep all)
+	Compress   bool          // gzip rotated files
+}
+
+// RotatingFile appends to a log file and rotates it by size and age. Rotated files are
+// renamed to <name>.<YYYYMMDD-HHMMSS> (gzipped in the background when Compress is set)
+// and the oldest are removed beyond MaxBackups. It is safe for concurrent writers.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	started time.Time
+
+	bg   sync.WaitGroup // compression and pruning
+	bgMu sync.Mutex     // one compression and pruning at a time
+}
+
+// OpenRotating opens (or creates) the log file at path, creating its directory.
+func OpenRotating(path string, opts RotateOptions) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	r := &RotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.started = f, info.Size(), time.Now()
+	if info.Size() > 0 {
+		r.started = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p, rotating first if p would exceed MaxSize or the file is older than MaxAge.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.dueLocked(int64(len(p))) {
+		if err := r.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) dueLocked(next int64) bool {
+	if r.opts.MaxSize > 0 && r.size+next > r.opts.MaxSize {
+		return true
+	}
+	return r.opts.MaxAge > 0 && time.Since(r.started) >= r.opts.MaxAge
+}
+
+// SetOptions changes the rotation settings; they apply from the next write.
+func (r *RotatingFile) SetOptions(opts RotateOptions) {
+	r.mu.Lock()
+	r.opts = opts
+	r.mu.Unlock()
+}
+
+// Rotate rotates the file now.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	return r.rotateLocked()
+}
+
+func (r *RotatingFile) rotateLocked() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	rotated := r.path + "." + time.Now().Format(rotatedTimeFormat)
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%s-%d", r.path, time.Now().Format(rotatedTimeFormat), i)
+	}
+	if err := os.Rename(r.path, rotated); err != nil {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	opts := r.opts
+	r.bg.Add(1)
+	go func() {
+		defer r.bg.Done()
+		r.bgMu.Lock()
+		defer r.bgMu.Unlock()
+		if opts.Compress {
+			_ = compressFile(rotated)
+		}
+		r.prune(opts.MaxBackups)
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond MaxBackups.
+func (r *RotatingFile) prune(maxBackups int) {
+	if maxBackups <= 0 {
+		return
+	}
+	backups := RotatedFiles(r.path)
+	for len(backups) > maxBackups {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// Close closes the file and waits for background compression.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	r.mu.Unlock()
+	r.bg.Wait()
+	return err
+}
+
+// RotatedFiles returns the rotated files of the log at path, oldest first. Files still
+// being compressed are listed once.
+func RotatedFiles(path string) []string {
+	matches, _ := filepath.Glob(path + ".*")
+	seen := make(map[string]bool, len(matches))
+	var files []string
+	for _, m := range matches {
+		base := strings.TrimSuffix(m, ".gz")
+		if strings.HasSuffix(m, ".tmp") || seen[base] {
+			continue
+		}
+		seen[base] = true
+		if m != base && fileExists(base) {
+			m = base // compression in progress; the plain file is complete
+		}
+		files = append(files, m)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		si, ni := rotatedStamp(files[i])
+		sj, nj := rotatedStamp(files[j])
+		if si != sj {
+			return si < sj
+		}
+		return ni < nj
+	})
+	return files
+}
+
+// rotatedStamp splits a rotated file's name into its timestamp and collision number, so
+// "agent.log.<stamp>" sorts before "agent.log.<stamp>-1" whether or not it is compressed.
+func rotatedStamp(path string) (string, int) {
+	name := strings.TrimSuffix(filepath.Base(path), ".gz")
+	stamp := name[strings.LastIndex(name, ".")+1:]
+	if len(stamp) <= len(rotatedTimeFormat) {
+		return stamp, 0
+	}
+	n, _ := strconv.Atoi(strings.TrimPrefix(stamp[len(rotatedTimeFormat):], "-"))
+	return stamp[:len(rotatedTimeFormat)], n
+}
+
+// RotatedAt returns when a rotated file was rotated, from its name.
+func RotatedAt(path string) (time.Time, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), ".gz")
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	stamp := name[i+1:]
+	if len(stamp) > len(rotatedTimeFormat) {
+		stamp = stamp[:len(rotatedTimeFormat)] // "-1" collision suffix
+	}
+	t, err := time.ParseInLocation(rotatedTimeFormat, stamp, time.Local)
+	return t, err == nil
+}
+
+// OpenLogFile opens a current or rotated log file for reading, decompressing .gz files.
+func OpenLogFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, f: f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// compressFile gzips path to path.gz and removes path.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := path + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
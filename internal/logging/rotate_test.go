@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_RotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "agent.log")
+	r, err := OpenRotating(path, RotateOptions{MaxSize: 20})
+	if err != nil {
+		t.Fatalf("OpenRotating: %v", err)
+	}
+	for _, line := range []string{"first line\n", "second line\n", "third line\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "third line\n" {
+		t.Errorf("current file = %q, want the last line only", current)
+	}
+	rotated := RotatedFiles(path)
+	if len(rotated) != 2 {
+		t.Fatalf("RotatedFiles = %v, want 2 files", rotated)
+	}
+	first, _ := os.ReadFile(rotated[0])
+	if string(first) != "first line\n" {
+		t.Errorf("oldest rotated file = %q, want the first line", first)
+	}
+	if at, ok := RotatedAt(rotated[0]); !ok || time.Since(at) > time.Minute {
+		t.Errorf("RotatedAt(%s) = %v, %v; want about now", rotated[0], at, ok)
+	}
+}
+
+func TestRotatingFile_CompressesAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	r, err := OpenRotating(path, RotateOptions{MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("OpenRotating: %v", err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		r.Write([]byte(line))
+		if err := r.Rotate(); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+	}
+	r.Close()
+
+	rotated := RotatedFiles(path)
+	if len(rotated) != 2 {
+		t.Fatalf("RotatedFiles = %v, want 2 kept", rotated)
+	}
+	var got []string
+	for _, f := range rotated {
+		if !strings.HasSuffix(f, ".gz") {
+			t.Errorf("%s is not compressed", f)
+		}
+		rc, err := OpenLogFile(f)
+		if err != nil {
+			t.Fatalf("OpenLogFile(%s): %v", f, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got = append(got, string(data))
+	}
+	if strings.Join(got, "") != "three\nfour\n" {
+		t.Errorf("kept files contain %q, want the two newest", got)
+	}
+}
+
+func TestRotatingFile_RotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(path, old, old)
+
+	r, err := OpenRotating(path, RotateOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("OpenRotating: %v", err)
+	}
+	r.Write([]byte("new\n"))
+	r.Close()
+
+	if current, _ := os.ReadFile(path); string(current) != "new\n" {
+		t.Errorf("current file = %q, want the new line only", current)
+	}
+	if n := len(RotatedFiles(path)); n != 1 {
+		t.Errorf("RotatedFiles: got %d files, want 1", n)
+	}
+}
+
+func TestRotatedFiles_SameSecondOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	for _, name := range []string{"20261018-093000-2", "20261018-093000.gz", "20261018-093000-1.gz", "20261017-120000.gz"} {
+		if err := os.WriteFile(path+"."+name, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, f := range RotatedFiles(path) {
+		got = append(got, strings.TrimPrefix(filepath.Base(f), "agent.log."))
+	}
+	want := "20261017-120000.gz 20261018-093000.gz 20261018-093000-1.gz 20261018-093000-2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("RotatedFiles = %v, want %s", got, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"beacon/internal/ipc"
+	"beacon/internal/state"
 )
 
 const (
@@ -20,6 +21,12 @@ type ProjectHealth struct {
 	Metrics       map[string]any `json:"metrics,omitempty"`
 	LogsTail      []string       `json:"logs_tail,omitempty"`
 	Checks        []CheckHealth  `json:"checks,omitempty"`
+	// Services is the per-service state of compose projects.
+	Services []ipc.ServiceStatus `json:"services,omitempty"`
+	// Deploy is set while a deploy pipeline is running.
+	Deploy *state.DeployProgress `json:"deploy,omitempty"`
+	// Pending lists releases held by the deploy gate (approve with the approve_deploy action).
+	Pending []state.PendingRelease `json:"pending,omitempty"`
 }
 
 // CheckHealth represents a single health check result in the heartbeat.
@@ -80,5 +87,8 @@ func aggregateFromReader(projectID string, reader *ipc.Reader) ProjectHealth {
 		Metrics:       report.Metrics,
 		LogsTail:      report.LogsTail,
 		Checks:        checks,
+		Services:      report.Services,
+		Deploy:        report.Deploy,
+		Pending:       report.Pending,
 	}
 }
@@ -0,0 +1,96 @@
+package master
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"beacon/internal/cloud"
+	"beacon/internal/config"
+	"beacon/internal/identity"
+	"beacon/internal/state"
+)
+
+// CloudSpoolDir returns ~/.beacon/state/cloud_spool, where the master keeps the reports
+// the cloud did not receive.
+func CloudSpoolDir() (string, error) {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "state", "cloud_spool"), nil
+}
+
+func spoolOptions(c *identity.OfflineBufferConfig) state.SpoolOptions {
+	return state.SpoolOptions{MaxBytes: int64(c.EffectiveMaxSizeMB()) << 20, MaxAge: c.EffectiveMaxAge()}
+}
+
+// applySpool opens the spool on first use and applies the offline_buffer settings. The
+// spool stays open when buffering is disabled, so what it holds is still backfilled.
+func (h *heartbeatLoop) applySpool(uc *identity.UserConfig) {
+	h.spoolEnabled = uc.OfflineBuffer.EffectiveEnabled()
+	if h.spool != nil {
+		h.spool.SetOptions(spoolOptions(uc.OfflineBuffer))
+		return
+	}
+	dir, err := CloudSpoolDir()
+	if err == nil {
+		h.spool, err = state.OpenSpool(dir, spoolOptions(uc.OfflineBuffer))
+	}
+	if err != nil && !h.spoolErr {
+		logger.Infof("Offline buffer: %v (reports the cloud misses are lost)", err)
+		h.spoolErr = true
+	}
+}
+
+// spoolHeartbeat keeps a heartbeat the cloud did not receive for backfill: the snapshot,
+// its system metrics sample and each command result as separate entries.
+func (h *heartbeatLoop) spoolHeartbeat(p heartbeatRequest) {
+	if h == nil || h.spool == nil || !h.spoolEnabled {
+		return
+	}
+	now := time.Now()
+	results, metrics := p.CommandResults, p.SystemMetrics
+	p.CommandResults, p.SystemMetrics = nil, nil
+	err := h.spool.Append(state.SpoolHeartbeat, now, p)
+	if metrics != nil && err == nil {
+		if err = h.spool.Append(state.SpoolMetrics, metrics.Timestamp, metrics); err == nil {
+			h.lastSystemMetricsSentAt = now // kept at the configured interval, as if sent
+		}
+	}
+	for _, r := range results {
+		if err == nil {
+			err = h.spool.Append(state.SpoolCommandResult, r.Timestamp, r)
+		}
+	}
+	if err != nil {
+		logger.Infof("Offline buffer: %v", err)
+	}
+}
+
+// backfill sends reports spooled during an outage in the background after a heartbeat
+// got through.
+func (h *heartbeatLoop) backfill(uc *identity.UserConfig, deviceName string) {
+	if h.spool == nil {
+		return
+	}
+	if h.backfiller == nil {
+		h.backfiller = &cloud.Backfiller{Logf: logger.Infof, Done: h.backfillDone}
+	}
+	client := cloud.NewBackfillClient(uc.EffectiveCloudAPIBase(), strings.TrimSpace(uc.APIKey), deviceName, getHostname())
+	h.backfiller.Start(h.ctx, client, h.spool)
+}
+
+// backfillDone updates the backlog after a backfill run and records an event once the
+// spool is empty.
+func (h *heartbeatLoop) backfillDone(sent, left int) {
+	h.statusCache.SetCloudBacklog(left)
+	if left == 0 && sent > 0 {
+		h.eventLog.Append(Event{
+			Timestamp: time.Now(),
+			Type:      EventSync,
+			Message:   fmt.Sprintf("backfilled %d report(s) recorded while the cloud was unreachable", sent),
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package master
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"beacon/internal/identity"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeatLoop_spoolsWhileOfflineAndBackfills(t *testing.T) {
+	var down atomic.Bool
+	var mu sync.Mutex
+	var backfilled []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/agent/backfill" {
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			raw, _ := io.ReadAll(zr)
+			var p struct {
+				Backfilled bool             `json:"backfilled"`
+				Entries    []map[string]any `json:"entries"`
+			}
+			require.NoError(t, json.NewDecoder(bytes.NewReader(raw)).Decode(&p))
+			require.True(t, p.Backfilled)
+			mu.Lock()
+			backfilled = append(backfilled, p.Entries...)
+			mu.Unlock()
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	t.Setenv("HOME", t.TempDir())
+	setTestCloudURL(t, server.URL)
+	cfg := &identity.UserConfig{APIKey: "usr_key", DeviceName: "test-device", CloudReportingEnabled: true}
+	require.NoError(t, cfg.Save())
+
+	eventLog := NewEventLog()
+	h := &heartbeatLoop{
+		ctx:         context.Background(),
+		dispatcher:  NewCommandDispatcher(nil, nil),
+		statusCache: NewStatusCache(nil, eventLog, cfg),
+		eventLog:    eventLog,
+	}
+	defer func() { _ = h.spool.Close() }()
+
+	down.Store(true)
+	h.tryBeat()
+	h.tryBeat()
+	require.NotNil(t, h.spool)
+	pending := h.spool.Pending()
+	require.GreaterOrEqual(t, pending, 2, "both heartbeats spooled")
+	require.Equal(t, pending, h.statusCache.Get().Cloud.Backlog)
+
+	down.Store(false)
+	h.tryBeat()
+	h.backfiller.Wait()
+
+	require.Zero(t, h.spool.Pending())
+	require.Zero(t, h.statusCache.Get().Cloud.Backlog)
+	mu.Lock()
+	require.Len(t, backfilled, pending)
+	require.Equal(t, "heartbeat", backfilled[0]["kind"])
+	require.Equal(t, true, backfilled[0]["backfilled"])
+	mu.Unlock()
+	events := eventLog.Recent()
+	require.Contains(t, events[len(events)-1].Message, "backfilled")
+}
@@ -0,0 +1,283 @@
+//go:build linux
+
+package master
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"beacon/internal/identity"
+)
+
+const (
+	cgroupMount = "/sys/fs/cgroup"
+	// masterCgroupLeaf holds the master itself: cgroup v2 only delegates controllers
+	// from a cgroup without processes of its own.
+	masterCgroupLeaf = "beacon-master"
+	// cpuMaxPeriod is the cpu.max period in microseconds.
+	cpuMaxPeriod = 100000
+)
+
+// cgroupParent is the cgroup the project cgroups are created under: the master's own.
+// It is set up when the first child with resource limits is spawned; a failed setup is
+// tried again on the next one.
+type cgroupParent struct {
+	mu     sync.Mutex
+	dir    string // "" until set up
+	logged bool   // the setup failure has been logged
+}
+
+// cgroupSetup prepares the parent cgroup; tests replace it.
+var cgroupSetup = setupCgroupParent
+
+// cgroup is a project's cgroup v2 directory.
+type cgroup struct {
+	dir string
+}
+
+// create returns the cgroup for a project, creating it and setting up the parent if
+// needed.
+func (p *cgroupParent) create(projectID string) (*cgroup, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.dir == "" {
+		dir, err := cgroupSetup()
+		if err != nil {
+			if !p.logged {
+				logger.Infof("cgroups unavailable, projects run without resource limits: %v", err)
+				p.logged = true
+			}
+			return nil, err
+		}
+		p.dir = dir
+	}
+	dir := filepath.Join(p.dir, "project-"+strings.ReplaceAll(projectID, "/", "_"))
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("create cgroup: %w", err)
+	}
+	return &cgroup{dir: dir}, nil
+}
+
+// ready reports whether the parent has been set up.
+func (p *cgroupParent) ready() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dir != ""
+}
+
+// setupCgroupParent moves the master into a leaf of its cgroup and enables the cpu,
+// memory and pids controllers for the project cgroups next to it. This needs root or a
+// delegated cgroup (systemd Delegate=yes).
+func setupCgroupParent() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return "", errors.New("cgroup v2 (unified hierarchy) is not mounted at " + cgroupMount)
+	}
+	dir, err := processCgroup(os.Getpid())
+	if err != nil {
+		return "", fmt.Errorf("master: %w", err)
+	}
+	if filepath.Base(dir) == masterCgroupLeaf {
+		return filepath.Dir(dir), nil // set up by a previous master (self-upgrade)
+	}
+
+	leaf := filepath.Join(dir, masterCgroupLeaf)
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("create %s: %w (is the cgroup delegated to this user?)", leaf, err)
+	}
+	if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return "", fmt.Errorf("move the master into %s: %w", leaf, err)
+	}
+	available, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	var enable []string
+	for _, c := range strings.Fields(string(available)) {
+		if c == "cpu" || c == "memory" || c == "pids" {
+			enable = append(enable, "+"+c)
+		}
+	}
+	if len(enable) == 0 {
+		return dir, nil
+	}
+	// Agents started before (those without limits) and their processes are still in
+	// dir, which keeps the controllers from being enabled (EBUSY). Move them into the
+	// leaf too; retry in case one forked meanwhile.
+	for attempt := 1; ; attempt++ {
+		if err := moveCgroupProcs(dir, leaf); err != nil {
+			return "", fmt.Errorf("move processes into %s: %w", leaf, err)
+		}
+		err := writeCgroupFile(dir, "cgroup.subtree_control", strings.Join(enable, " "))
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, syscall.EBUSY) || attempt == 3 {
+			return "", fmt.Errorf("enable controllers in %s: %w (other processes in the cgroup? run the master as a service with Delegate=yes)", dir, err)
+		}
+	}
+}
+
+// moveCgroupProcs moves the processes of cgroup from into cgroup to. Processes that
+// exit meanwhile are skipped.
+func moveCgroupProcs(from, to string) error {
+	data, err := os.ReadFile(filepath.Join(from, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, pid := range strings.Fields(string(data)) {
+		if err := writeCgroupFile(to, "cgroup.procs", pid); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("pid %s: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// processCgroup returns the cgroup v2 directory of a process.
+func processCgroup(pid int) (string, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rel, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(cgroupMount, rel), nil
+		}
+	}
+	return "", errors.New("not in a cgroup v2 hierarchy")
+}
+
+// ownCgroup returns the cgroup a child without a project cgroup runs in, or nil if it
+// shares the master's, whose accounting would include the master and other agents.
+func ownCgroup(pid int) *cgroup {
+	dir, err := processCgroup(pid)
+	if err != nil {
+		return nil
+	}
+	if self, err := processCgroup(os.Getpid()); err != nil || self == dir || filepath.Dir(self) == dir {
+		return nil
+	}
+	return &cgroup{dir: dir}
+}
+
+// apply writes the limits; unset limits are reset to unlimited. A limit whose controller
+// is not available is an error, a reset is not.
+func (cg *cgroup) apply(limits *identity.ResourceLimits) error {
+	if limits == nil {
+		limits = &identity.ResourceLimits{}
+	}
+	mem, err := limits.MemoryMaxBytes()
+	if err != nil {
+		return err
+	}
+	quota, err := limits.CPUQuotaPercent()
+	if err != nil {
+		return err
+	}
+	weight := limits.CPUWeight
+	if weight == 0 {
+		weight = 100
+	}
+
+	settings := []struct {
+		file, value string
+		set         bool
+	}{
+		{"memory.max", "max", mem > 0},
+		{"cpu.weight", strconv.Itoa(weight), limits.CPUWeight > 0},
+		{"cpu.max", fmt.Sprintf("max %d", cpuMaxPeriod), quota > 0},
+		{"pids.max", "max", limits.PidsMax > 0},
+	}
+	if mem > 0 {
+		settings[0].value = strconv.FormatInt(mem, 10)
+	}
+	if quota > 0 {
+		settings[2].value = fmt.Sprintf("%d %d", quota*cpuMaxPeriod/100, cpuMaxPeriod)
+	}
+	if limits.PidsMax > 0 {
+		settings[3].value = strconv.Itoa(limits.PidsMax)
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if err := writeCgroupFile(cg.dir, s.file, s.value); err != nil && s.set {
+			errs = append(errs, fmt.Errorf("%s: %w", s.file, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// attach makes cmd start inside the cgroup (clone into the cgroup, so no process the
+// child starts escapes it). The returned func releases the cgroup descriptor after Start.
+func (cg *cgroup) attach(attr *syscall.SysProcAttr) (func(), error) {
+	if cg == nil {
+		return func() {}, nil
+	}
+	f, err := os.Open(cg.dir)
+	if err != nil {
+		return func() {}, err
+	}
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(f.Fd())
+	return func() { f.Close() }, nil
+}
+
+// usage reads the cgroup's accounting. Returns nil if the cgroup is gone.
+func (cg *cgroup) usage() *ResourceUsage {
+	if _, err := os.Stat(cg.dir); err != nil {
+		return nil
+	}
+	u := &ResourceUsage{}
+	u.MemoryBytes, _ = readCgroupInt(cg.dir, "memory.current")
+	u.MemoryMaxBytes, _ = readCgroupInt(cg.dir, "memory.max")
+	u.PIDs, _ = readCgroupInt(cg.dir, "pids.current")
+	u.PidsMax, _ = readCgroupInt(cg.dir, "pids.max")
+	if usec, err := readCgroupKey(cg.dir, "cpu.stat", "usage_usec"); err == nil {
+		u.CPUSeconds = float64(usec) / 1e6
+	}
+	u.OOMKills, _ = readCgroupKey(cg.dir, "memory.events", "oom_kill")
+	return u
+}
+
+// remove deletes the cgroup once its processes are gone.
+func (cg *cgroup) remove() {
+	if cg != nil {
+		_ = os.Remove(cg.dir)
+	}
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return os.WriteFile(filepath.Join(dir, name), []byte(value), 0)
+}
+
+// readCgroupInt reads a single-value file; "max" reads as 0 (unlimited).
+func readCgroupInt(dir, name string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// readCgroupKey reads one "key value" line of a flat-keyed file such as cpu.stat.
+func readCgroupKey(dir, name, key string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, key+" "); ok {
+			return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s: no %s", name, key)
+}
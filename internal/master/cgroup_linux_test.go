@@ -0,0 +1,138 @@
+//go:build linux
+
+package master
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"beacon/internal/identity"
+)
+
+func TestCgroup_applyAndUsage(t *testing.T) {
+	cg := &cgroup{dir: t.TempDir()}
+
+	limits := &identity.ResourceLimits{MemoryMax: "256M", CPUQuota: "50%", PidsMax: 64}
+	if err := cg.apply(limits); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	for file, want := range map[string]string{
+		"memory.max": "268435456",
+		"cpu.weight": "100",
+		"cpu.max":    "50000 100000",
+		"pids.max":   "64",
+	} {
+		got, _ := os.ReadFile(filepath.Join(cg.dir, file))
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+
+	// Cleared limits go back to unlimited
+	if err := cg.apply(nil); err != nil {
+		t.Fatalf("apply(nil) failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(cg.dir, "memory.max")); string(got) != "max" {
+		t.Errorf("memory.max = %q, want max", got)
+	}
+
+	files := map[string]string{
+		"memory.current": "1048576\n",
+		"pids.current":   "7\n",
+		"cpu.stat":       "usage_usec 2500000\nuser_usec 2000000\n",
+		"memory.events":  "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(cg.dir, name), []byte(data), 0644)
+	}
+	u := cg.usage()
+	if u == nil {
+		t.Fatal("usage is nil")
+	}
+	if u.MemoryBytes != 1<<20 || u.MemoryMaxBytes != 0 || u.PIDs != 7 || u.PidsMax != 0 || u.CPUSeconds != 2.5 || u.OOMKills != 1 {
+		t.Errorf("usage = %+v", u)
+	}
+
+	cg.dir = filepath.Join(cg.dir, "gone")
+	if u := cg.usage(); u != nil {
+		t.Errorf("usage of a removed cgroup = %+v", u)
+	}
+}
+
+func TestPrepareSandbox_noLimitsNoCgroup(t *testing.T) {
+	setups := 0
+	old := cgroupSetup
+	t.Cleanup(func() { cgroupSetup = old })
+	cgroupSetup = func() (string, error) {
+		setups++
+		return t.TempDir(), nil
+	}
+	pm := &ProcessManager{}
+
+	for _, limits := range []*identity.ResourceLimits{nil, {}} {
+		child := &ChildProcess{ProjectID: "plain", Resources: limits}
+		if err := pm.prepareSandbox(child); err != nil {
+			t.Fatalf("prepareSandbox failed: %v", err)
+		}
+		if child.cgroup != nil || child.SandboxError != "" {
+			t.Errorf("limits %+v: cgroup %+v, sandbox error %q", limits, child.cgroup, child.SandboxError)
+		}
+	}
+	if setups != 0 {
+		t.Fatalf("cgroups set up %d time(s) for projects without limits", setups)
+	}
+
+	child := &ChildProcess{ProjectID: "limited", Resources: &identity.ResourceLimits{PidsMax: 64}}
+	if err := pm.prepareSandbox(child); err != nil {
+		t.Fatalf("prepareSandbox failed: %v", err)
+	}
+	if setups != 1 || child.cgroup == nil {
+		t.Errorf("limited project: %d setup(s), cgroup %+v", setups, child.cgroup)
+	}
+}
+
+func TestPrepareSandbox_cgroupSetupRetried(t *testing.T) {
+	setups := 0
+	old := cgroupSetup
+	t.Cleanup(func() { cgroupSetup = old })
+	parent := t.TempDir()
+	cgroupSetup = func() (string, error) {
+		setups++
+		if setups == 1 {
+			return "", errors.New("EBUSY")
+		}
+		return parent, nil
+	}
+	pm := &ProcessManager{}
+	limits := &identity.ResourceLimits{PidsMax: 64}
+
+	first := &ChildProcess{ProjectID: "first", Resources: limits}
+	if err := pm.prepareSandbox(first); err != nil {
+		t.Fatalf("prepareSandbox failed: %v", err)
+	}
+	if first.cgroup != nil || first.SandboxError == "" {
+		t.Errorf("failed setup: cgroup %+v, sandbox error %q", first.cgroup, first.SandboxError)
+	}
+
+	second := &ChildProcess{ProjectID: "second", Resources: limits}
+	if err := pm.prepareSandbox(second); err != nil {
+		t.Fatalf("prepareSandbox failed: %v", err)
+	}
+	if setups != 2 || second.cgroup == nil {
+		t.Errorf("retried setup: %d setup(s), cgroup %+v", setups, second.cgroup)
+	}
+
+	// With the parent set up, a project without limits gets a cgroup for its usage
+	plain := &ChildProcess{ProjectID: "plain"}
+	if err := pm.prepareSandbox(plain); err != nil {
+		t.Fatalf("prepareSandbox failed: %v", err)
+	}
+	if plain.cgroup == nil || plain.cgroup.dir != filepath.Join(parent, "project-plain") || plain.SandboxError != "" {
+		t.Errorf("plain project: cgroup %+v, sandbox error %q", plain.cgroup, plain.SandboxError)
+	}
+	if got, _ := os.ReadFile(filepath.Join(plain.cgroup.dir, "memory.max")); string(got) != "max" {
+		t.Errorf("memory.max = %q, want max", got)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package master
+
+import (
+	"errors"
+	"syscall"
+
+	"beacon/internal/identity"
+)
+
+// cgroupParent stands in for the Linux cgroup v2 support; projects run without
+// resource limits on other platforms.
+type cgroupParent struct{}
+
+type cgroup struct{}
+
+func (p *cgroupParent) create(projectID string) (*cgroup, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+func (p *cgroupParent) ready() bool { return false }
+
+func ownCgroup(pid int) *cgroup { return nil }
+
+func (cg *cgroup) apply(limits *identity.ResourceLimits) error { return nil }
+
+func (cg *cgroup) attach(attr *syscall.SysProcAttr) (func(), error) { return func() {}, nil }
+
+func (cg *cgroup) usage() *ResourceUsage { return nil }
+
+func (cg *cgroup) remove() {}
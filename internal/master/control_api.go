@@ -0,0 +1,570 @@
+package master
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/control"
+	"beacon/internal/identity"
+	"beacon/internal/ipc"
+)
+
+// controlCommandTimeout bounds how long a control request waits for a project agent.
+const controlCommandTimeout = 10 * time.Minute
+
+// upgradeHandoffTimeout bounds how long an accepted upgrade waits for Run's goroutine to
+// take it; the upgrade is abandoned after that.
+const upgradeHandoffTimeout = time.Minute
+
+var errPeerCredUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// controlServer serves the local control API (see package control) on the control socket
+// and, with control_token set, under /api/control/ on the status server.
+type controlServer struct {
+	pm          *ProcessManager
+	dispatcher  *CommandDispatcher
+	eventLog    *EventLog
+	statusCache *StatusCache
+	reloader    *configReloader
+
+	// tasks runs config and VPN changes on Run's goroutine, which owns the reloader.
+	tasks chan func()
+	seq   atomic.Uint64
+
+	tokenMu sync.RWMutex
+	token   string
+
+	// ln is the control socket's listener, handed to a new master on self-upgrade.
+	ln         net.Listener
+	socketPath string
+	// upgradeMu guards deploys and upgrading: the master is not upgraded under a deploy,
+	// and no deploy starts once an upgrade was accepted.
+	upgradeMu sync.Mutex
+	deploys   int  // deploys in progress
+	upgrading bool // an upgrade was accepted and has not failed
+
+	// deployCommand builds the deploy process; `beacon projects redeploy --local`.
+	deployCommand func(project string, wait bool) (*exec.Cmd, error)
+}
+
+// newControlServer returns the control API; set dispatcher and reloader before serving it.
+func newControlServer(pm *ProcessManager, eventLog *EventLog, statusCache *StatusCache) *controlServer {
+	return &controlServer{
+		pm:            pm,
+		eventLog:      eventLog,
+		statusCache:   statusCache,
+		tasks:         make(chan func()),
+		deployCommand: redeployCommand,
+	}
+}
+
+// setToken sets the bearer token for the API on the status server; empty disables it.
+func (s *controlServer) setToken(token string) {
+	s.tokenMu.Lock()
+	s.token = strings.TrimSpace(token)
+	s.tokenMu.Unlock()
+}
+
+func (s *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.handleStatus)
+	mux.HandleFunc("POST /v1/projects/{project}/{action}", s.handleProjectAction)
+	mux.HandleFunc("POST /v1/tunnels/{id}/{verb}", s.handleTunnel)
+	mux.HandleFunc("POST /v1/vpn/reconcile", s.handleVPNReconcile)
+	mux.HandleFunc("GET /v1/events", s.handleEvents)
+	mux.HandleFunc("POST /v1/upgrade", s.handleUpgrade)
+	mux.HandleFunc("GET /v1/upgrade", s.handleUpgradeStatus)
+	return mux
+}
+
+// listen serves the API on the control socket until ctx ends. Only the master's own user
+// and root may connect.
+func (s *controlServer) listen(ctx context.Context, path string) error {
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return fmt.Errorf("%s is in use (another master running?)", path)
+	}
+	_ = os.Remove(path) // stale socket from a previous master
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+	s.serve(ctx, ln, path)
+	return nil
+}
+
+// serve serves the API on ln, the control socket at path, until ctx ends. The listener
+// is either opened by listen or inherited from the previous master.
+func (s *controlServer) serve(ctx context.Context, ln net.Listener, path string) {
+	s.ln, s.socketPath = ln, path
+	srv := &http.Server{
+		Handler:           s.peerAuth(s.handler()),
+		ReadHeaderTimeout: 5 * time.Second,
+		// Ends event streams on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			uid, err := peerUID(c)
+			return context.WithValue(ctx, peerKey{}, peer{uid: uid, err: err})
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		shutCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutCtx)
+		_ = os.Remove(path)
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Infof("Control socket: %v", err)
+		}
+	}()
+	logger.Infof("Control API: %s", path)
+}
+
+// listenerFile returns a duplicate of the control socket's listener.
+func (s *controlServer) listenerFile() (*os.File, error) {
+	if s == nil || s.ln == nil {
+		return nil, errors.New("control socket is not listening")
+	}
+	ul, ok := s.ln.(*net.UnixListener)
+	if !ok {
+		return nil, fmt.Errorf("unexpected listener %T", s.ln)
+	}
+	return ul.File()
+}
+
+type peerKey struct{}
+
+type peer struct {
+	uid int
+	err error
+}
+
+// peerAuth admits connections from the master's user and root.
+func (s *controlServer) peerAuth(next http.Handler) http.Handler {
+	self := os.Geteuid()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := r.Context().Value(peerKey{}).(peer)
+		switch {
+		case errors.Is(p.err, errPeerCredUnsupported):
+			// The socket is 0600; its mode is the check
+		case p.err != nil:
+			writeControlError(w, http.StatusForbidden, fmt.Errorf("peer credentials: %w", p.err))
+			return
+		case p.uid != self && p.uid != 0:
+			logger.Warnf("Control API: rejected %s %s from uid %d", r.Method, r.URL.Path, p.uid)
+			writeControlError(w, http.StatusForbidden, fmt.Errorf("uid %d may not control this master", p.uid))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpHandler returns the API for the status server, behind control_token.
+func (s *controlServer) httpHandler() http.Handler {
+	if s == nil {
+		return nil
+	}
+	api := s.handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.tokenMu.RLock()
+		token := s.token
+		s.tokenMu.RUnlock()
+		if token == "" {
+			writeControlError(w, http.StatusNotFound, errors.New("the control API is not enabled over HTTP (set control_token in config.yaml)"))
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(given)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="beacon"`)
+			writeControlError(w, http.StatusUnauthorized, errors.New("invalid or missing control token"))
+			return
+		}
+		// Actions outlast the status server's write timeout
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		http.StripPrefix("/api/control", api).ServeHTTP(w, r)
+	})
+}
+
+func (s *controlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeControlJSON(w, s.statusCache.Get())
+}
+
+func (s *controlServer) handleProjectAction(w http.ResponseWriter, r *http.Request) {
+	project, action := r.PathValue("project"), r.PathValue("action")
+	if !validControlName(project) {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid project name %q", project))
+		return
+	}
+	if action == control.ActionDeploy {
+		s.deploy(w, r, project)
+		return
+	}
+	if s.pm == nil {
+		writeControlError(w, http.StatusServiceUnavailable, errors.New("process manager not available"))
+		return
+	}
+	if _, ok := s.pm.GetChildren()[project]; !ok {
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("project %s is not managed by the master", project))
+		return
+	}
+
+	var ipcAction string
+	var event EventType
+	switch action {
+	case control.ActionStart:
+		ipcAction, event = ipc.ActionStart, EventStart
+	case control.ActionStop:
+		ipcAction, event = ipc.ActionStop, EventStop
+	case control.ActionRestart:
+		ipcAction, event = ipc.ActionRestart, EventRestart
+	case control.ActionCheck:
+		ipcAction = ipc.ActionHealthCheck
+	case control.ActionAgentRestart:
+		if err := s.pm.RestartAgent(project); err != nil {
+			writeControlError(w, http.StatusConflict, err)
+			return
+		}
+		s.record(EventRestart, project, "agent restarted via control API")
+		writeControlJSON(w, control.Result{Message: "agent of " + project + " restarted"})
+		return
+	default:
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("unknown project action %q", action))
+		return
+	}
+
+	cmd := HeartbeatCommand{
+		ID:            fmt.Sprintf("%s%d", localCommandPrefix, s.seq.Add(1)),
+		Action:        ipcAction,
+		TargetProject: project,
+	}
+	if svc := r.URL.Query().Get("service"); svc != "" {
+		cmd.Payload = map[string]any{ipc.PayloadService: svc}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), controlCommandTimeout)
+	defer cancel()
+	res, err := s.dispatcher.Execute(ctx, cmd)
+	if err != nil {
+		writeControlError(w, http.StatusGatewayTimeout, fmt.Errorf("no result from the agent of %s: %w", project, err))
+		return
+	}
+	if event != "" {
+		s.record(event, project, fmt.Sprintf("%s via control API: %s", action, res.Status))
+	}
+	if res.Status != ipc.ResultSuccess {
+		writeControlError(w, http.StatusBadGateway, errors.New(res.Message))
+		return
+	}
+	out := control.Result{Message: res.Message}
+	if res.Data != nil {
+		out.Data, _ = json.Marshal(res.Data)
+	}
+	writeControlJSON(w, out)
+}
+
+// deploy runs `beacon projects redeploy` for the project and streams its output. The
+// deploy runs to completion even if the caller goes away; its output also goes to the
+// project's agent log.
+func (s *controlServer) deploy(w http.ResponseWriter, r *http.Request, project string) {
+	wait := r.URL.Query().Get("wait") != ""
+	if _, err := os.Stat(config.ProjectConfigDir(project)); err != nil {
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("project %q not found (run `beacon projects list` to see available projects)", project))
+		return
+	}
+	cmd, err := s.deployCommand(project, wait)
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.startDeploy(); err != nil {
+		writeControlError(w, http.StatusConflict, err)
+		return
+	}
+	defer s.endDeploy()
+	out := &streamWriter{w: w, rc: http.NewResponseController(w)}
+	if s.pm != nil {
+		if child, ok := s.pm.GetChildren()[project]; ok && child.log != nil {
+			out.log = child.log
+		}
+	}
+	cmd.Stdout, cmd.Stderr = out, out
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Trailer", control.DeployErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+	logger.Infof("Control API: deploying %s", project)
+	s.record(EventDeploy, project, "deploy started via control API")
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		msg := fmt.Sprintf("deploy of %s failed: %v", project, err)
+		w.Header().Set(control.DeployErrorTrailer, msg)
+		s.recordDuration(EventDeploy, project, msg, time.Since(start))
+		return
+	}
+	s.recordDuration(EventDeploy, project, "deploy finished via control API", time.Since(start))
+}
+
+// redeployCommand runs this binary's `projects redeploy --local` for the project.
+func redeployCommand(project string, wait bool) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"projects", "redeploy", project, "--local"}
+	if wait {
+		args = append(args, "--wait")
+	}
+	return exec.Command(exe, args...), nil
+}
+
+// streamWriter copies deploy output to the response, flushing each write, and to the
+// agent log. Write errors (the caller went away) are dropped so the deploy carries on.
+type streamWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	rc   *http.ResponseController
+	log  io.Writer // may be nil
+	gone bool
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.log != nil {
+		_, _ = sw.log.Write(p)
+	}
+	if !sw.gone {
+		if _, err := sw.w.Write(p); err != nil {
+			sw.gone = true
+		} else {
+			_ = sw.rc.Flush()
+		}
+	}
+	return len(p), nil
+}
+
+func (s *controlServer) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	id, verb := r.PathValue("id"), r.PathValue("verb")
+	if verb != "enable" && verb != "disable" {
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("unknown tunnel action %q", verb))
+		return
+	}
+	enabled := verb == "enable"
+	var status string
+	err := s.onRunLoop(r.Context(), func() error {
+		if err := identity.SetTunnelEnabled(id, enabled); err != nil {
+			return err
+		}
+		s.reloader.reload("control API: tunnel " + id + " " + verb + "d")
+		if s.reloader.tm != nil {
+			status = "disabled"
+			for _, ts := range s.reloader.tm.GetTunnelStatuses() {
+				if ts.ID == id {
+					status = ts.Status
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	msg := fmt.Sprintf("tunnel %q %sd", id, verb)
+	if status != "" {
+		msg += " (" + status + ")"
+	}
+	writeControlJSON(w, control.Result{Message: msg})
+}
+
+func (s *controlServer) handleVPNReconcile(w http.ResponseWriter, r *http.Request) {
+	var res control.Result
+	err := s.onRunLoop(r.Context(), func() error {
+		uc, err := identity.LoadUserConfig()
+		if err != nil {
+			return err
+		}
+		if uc == nil {
+			return errors.New("config.yaml not found")
+		}
+		s.reloader.reconcileVPN(uc)
+		vm := s.reloader.beat.vm
+		if vm == nil {
+			res.Message = "VPN not available (needs cloud reporting and an API key)"
+			return nil
+		}
+		st := vm.Status()
+		res.Data, _ = json.Marshal(st)
+		switch {
+		case st.Error != "":
+			res.Message = "VPN reconciled with an error: " + st.Error
+		case st.Enabled:
+			res.Message = fmt.Sprintf("VPN up (%s)", st.Role)
+		default:
+			res.Message = "VPN down"
+		}
+		return nil
+	})
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.record(EventVPN, "", "VPN reconciled via control API")
+	writeControlJSON(w, res)
+}
+
+// handleUpgrade upgrades the master to the binary on disk (see upgrade.go). It replies
+// 202 once the new binary passed its trial run and then hands over, which ends this
+// connection; GET /v1/upgrade tells how it went.
+func (s *controlServer) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	if err := s.startUpgrade(); err != nil {
+		writeControlError(w, http.StatusConflict, err)
+		return
+	}
+	var st *UpgradeStatus
+	err := s.onRunLoop(r.Context(), func() error {
+		var err error
+		st, err = s.reloader.prepareUpgrade()
+		return err
+	})
+	if err != nil {
+		s.endUpgrade()
+	}
+	switch {
+	case errors.Is(err, errUpgradeInProgress):
+		writeControlError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data, _ := json.Marshal(st)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(control.Result{
+		Message: fmt.Sprintf("upgrading the master from %s to %s", st.From, st.To),
+		Data:    data,
+	})
+	_ = http.NewResponseController(w).Flush()
+	logger.Infof("Control API: upgrading the master from %s to %s", st.From, st.To)
+
+	// The reply is on its way before the exec closes the connection
+	ctx, cancel := context.WithTimeout(context.Background(), upgradeHandoffTimeout)
+	defer cancel()
+	if err := s.onRunLoop(ctx, func() error { return s.reloader.upgrade(st) }); errors.Is(err, context.DeadlineExceeded) {
+		s.reloader.upgradeFailed(st, errors.New("the master was busy; upgrade abandoned"))
+	}
+	s.endUpgrade()
+}
+
+// startDeploy counts a deploy in, unless the master is about to be upgraded.
+func (s *controlServer) startDeploy() error {
+	s.upgradeMu.Lock()
+	defer s.upgradeMu.Unlock()
+	if s.upgrading || (s.reloader != nil && s.reloader.upgrading.Load()) {
+		return errors.New("the master is upgrading; deploy when it has finished")
+	}
+	s.deploys++
+	return nil
+}
+
+func (s *controlServer) endDeploy() {
+	s.upgradeMu.Lock()
+	s.deploys--
+	s.upgradeMu.Unlock()
+}
+
+// startUpgrade holds off new deploys for an upgrade, unless a deploy is running.
+func (s *controlServer) startUpgrade() error {
+	s.upgradeMu.Lock()
+	defer s.upgradeMu.Unlock()
+	if s.deploys > 0 {
+		return errors.New("a deploy is running; upgrade when it has finished")
+	}
+	if s.upgrading {
+		return errUpgradeInProgress
+	}
+	s.upgrading = true
+	return nil
+}
+
+func (s *controlServer) endUpgrade() {
+	s.upgradeMu.Lock()
+	s.upgrading = false
+	s.upgradeMu.Unlock()
+}
+
+func (s *controlServer) handleUpgradeStatus(w http.ResponseWriter, r *http.Request) {
+	st, err := ReadUpgradeStatus()
+	switch {
+	case err != nil:
+		writeControlError(w, http.StatusInternalServerError, err)
+	case st == nil:
+		writeControlError(w, http.StatusNotFound, errors.New("the master has not been upgraded"))
+	default:
+		writeControlJSON(w, st)
+	}
+}
+
+func (s *controlServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	serveEvents(w, r, s.eventLog)
+}
+
+// onRunLoop runs fn on Run's goroutine and returns its error.
+func (s *controlServer) onRunLoop(ctx context.Context, fn func() error) error {
+	if s.reloader == nil {
+		return errors.New("config reload not available")
+	}
+	done := make(chan error, 1)
+	select {
+	case s.tasks <- func() { done <- fn() }:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-done
+}
+
+func (s *controlServer) record(typ EventType, project, msg string) {
+	s.recordDuration(typ, project, msg, 0)
+}
+
+func (s *controlServer) recordDuration(typ EventType, project, msg string, d time.Duration) {
+	if s.eventLog == nil {
+		return
+	}
+	s.eventLog.Append(Event{Timestamp: time.Now(), Type: typ, Child: project, Message: msg, DurationMs: d.Milliseconds()})
+}
+
+// validControlName rejects names that could escape a path or pass as a flag.
+func validControlName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.HasPrefix(name, "-") && !strings.ContainsAny(name, `/\`)
+}
+
+func writeControlJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeControlError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(control.ErrorReply{Error: err.Error()})
+}
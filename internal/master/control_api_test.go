@@ -0,0 +1,271 @@
+package master
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/control"
+	"beacon/internal/identity"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestControlServer serves a control API without projects on a socket in BEACON_HOME,
+// running its config tasks like Run does.
+func newTestControlServer(t *testing.T) (*controlServer, *control.Client) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("BEACON_HOME", home)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	ticker := time.NewTicker(time.Minute)
+	t.Cleanup(ticker.Stop)
+	eventLog := NewEventLog()
+	statusCache := NewStatusCache(nil, eventLog, nil)
+	ctl := newControlServer(nil, eventLog, statusCache)
+	ctl.dispatcher = NewCommandDispatcher(nil, nil)
+	ctl.reloader = &configReloader{
+		ctx:         ctx,
+		dispatcher:  ctl.dispatcher,
+		statusCache: statusCache,
+		beat:        &heartbeatLoop{},
+		ticker:      ticker,
+		eventLog:    eventLog,
+		interval:    time.Minute,
+		port:        defaultMetricsPort,
+		stopStatus:  func() {},
+		control:     ctl,
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case task := <-ctl.tasks:
+				task()
+			}
+		}
+	}()
+
+	path := filepath.Join(home, "control.sock")
+	require.NoError(t, ctl.listen(ctx, path))
+	return ctl, control.NewSocketClient(path)
+}
+
+func TestControlServer_Socket(t *testing.T) {
+	ctl, client := newTestControlServer(t)
+	ctx := t.Context()
+
+	var status map[string]any
+	require.NoError(t, client.Status(ctx, &status))
+	require.Contains(t, status, "master")
+
+	_, err := client.ProjectAction(ctx, "myapp", control.ActionRestart)
+	require.ErrorContains(t, err, "process manager not available")
+
+	// A second master cannot take over the socket
+	path, err := control.SocketPath()
+	require.NoError(t, err)
+	require.ErrorContains(t, ctl.listen(ctx, path), "in use")
+}
+
+func TestControlServer_Events(t *testing.T) {
+	ctl, client := newTestControlServer(t)
+	now := time.Now()
+	ctl.eventLog.Append(Event{Timestamp: now.Add(-2 * time.Hour), Type: EventDeploy, Child: "app", Message: "old deploy"})
+	ctl.eventLog.Append(Event{Timestamp: now.Add(-time.Minute), Type: EventDeploy, Child: "app", Message: "deploy"})
+	ctl.eventLog.Append(Event{Timestamp: now.Add(-time.Minute), Type: EventRestart, Child: "web", Message: "restart"})
+
+	var events []Event
+	require.NoError(t, client.Events(t.Context(), url.Values{"since": {"1h"}, "type": {"deploy"}}, &events))
+	require.Len(t, events, 1)
+	require.Equal(t, "deploy", events[0].Message)
+
+	require.NoError(t, client.Events(t.Context(), url.Values{"project": {"web"}}, &events))
+	require.Len(t, events, 1)
+	require.Equal(t, EventRestart, events[0].Type)
+
+	require.NoError(t, client.Events(t.Context(), url.Values{"limit": {"2"}}, &events))
+	require.Len(t, events, 2)
+
+	require.ErrorContains(t, client.Events(t.Context(), url.Values{"since": {"yesterday"}}, &events), "invalid since")
+}
+
+func TestControlServer_Tunnel(t *testing.T) {
+	ctl, client := newTestControlServer(t)
+	disabled := false
+	cfg := &identity.UserConfig{
+		DeviceName: "test-device",
+		Tunnels:    []identity.TunnelConfig{{ID: "ha", LocalPort: 8123, Enabled: &disabled}},
+	}
+	require.NoError(t, cfg.Save())
+
+	res, err := client.SetTunnelEnabled(t.Context(), "ha", true)
+	require.NoError(t, err)
+	require.Contains(t, res.Message, `tunnel "ha" enabled`)
+
+	uc, err := identity.LoadUserConfig()
+	require.NoError(t, err)
+	require.True(t, *uc.Tunnels[0].Enabled)
+	events := ctl.eventLog.Recent()
+	require.NotEmpty(t, events)
+	require.Contains(t, events[len(events)-1].Message, "tunnel ha enabled")
+
+	_, err = client.SetTunnelEnabled(t.Context(), "missing", true)
+	require.ErrorContains(t, err, `tunnel "missing" not found`)
+}
+
+func TestControlServer_Deploy(t *testing.T) {
+	ctl, client := newTestControlServer(t)
+	var gotWait bool
+	ctl.deployCommand = func(project string, wait bool) (*exec.Cmd, error) {
+		gotWait = wait
+		if project == "broken" {
+			return exec.Command("sh", "-c", "echo deploying broken; exit 3"), nil
+		}
+		return exec.Command("sh", "-c", "echo deploying "+project), nil
+	}
+
+	for _, p := range []string{"myapp", "broken"} {
+		require.NoError(t, os.MkdirAll(config.ProjectConfigDir(p), 0755))
+	}
+	_, err := client.ProjectAction(t.Context(), "missing", control.ActionDeploy)
+	require.ErrorContains(t, err, `project "missing" not found`)
+
+	var out bytes.Buffer
+	require.NoError(t, client.Deploy(t.Context(), "myapp", true, &out))
+	require.Equal(t, "deploying myapp\n", out.String())
+	require.True(t, gotWait)
+
+	out.Reset()
+	err = client.Deploy(t.Context(), "broken", false, &out)
+	require.ErrorContains(t, err, "deploy of broken failed: exit status 3")
+	require.Equal(t, "deploying broken\n", out.String())
+
+	_, err = client.ProjectAction(t.Context(), "-x", control.ActionDeploy)
+	require.ErrorContains(t, err, "invalid project name")
+
+	var deploys int
+	for _, e := range ctl.eventLog.Recent() {
+		if e.Type == EventDeploy {
+			deploys++
+		}
+	}
+	require.Equal(t, 4, deploys, "a start and an end event per deploy")
+}
+
+func TestControlServer_UpgradeHoldsOffDeploys(t *testing.T) {
+	ctl, client := newTestControlServer(t)
+	ctl.deployCommand = func(project string, wait bool) (*exec.Cmd, error) {
+		return exec.Command("sh", "-c", "echo deploying "+project), nil
+	}
+	require.NoError(t, os.MkdirAll(config.ProjectConfigDir("myapp"), 0755))
+
+	// An accepted upgrade refuses deploys until it fails
+	require.NoError(t, ctl.startUpgrade())
+	err := client.Deploy(t.Context(), "myapp", false, io.Discard)
+	require.ErrorContains(t, err, "the master is upgrading")
+	ctl.endUpgrade()
+	require.NoError(t, client.Deploy(t.Context(), "myapp", false, io.Discard))
+
+	// A running deploy refuses the upgrade
+	require.NoError(t, ctl.startDeploy())
+	_, err = client.Upgrade(t.Context())
+	require.ErrorContains(t, err, "a deploy is running")
+	ctl.endDeploy()
+	require.NoError(t, ctl.startUpgrade())
+}
+
+func TestControlServer_HTTPToken(t *testing.T) {
+	ctl, _ := newTestControlServer(t)
+	srv := httptest.NewServer(ctl.httpHandler())
+	defer srv.Close()
+
+	get := func(token string) int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/control/v1/events", nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusNotFound, get("secret"), "disabled without control_token")
+	ctl.setToken("secret")
+	require.Equal(t, http.StatusUnauthorized, get(""))
+	require.Equal(t, http.StatusUnauthorized, get("wrong"))
+	require.Equal(t, http.StatusOK, get("secret"))
+}
+
+func TestControlServer_PeerAuth(t *testing.T) {
+	ctl, _ := newTestControlServer(t)
+	h := ctl.peerAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		peer peer
+		want int
+	}{
+		{peer{uid: os.Geteuid()}, http.StatusOK},
+		{peer{uid: 0}, http.StatusOK},
+		{peer{uid: os.Geteuid() + 1000}, http.StatusForbidden},
+		{peer{uid: -1, err: os.ErrInvalid}, http.StatusForbidden},
+		{peer{uid: -1, err: errPeerCredUnsupported}, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/status", nil)
+		req = req.WithContext(context.WithValue(req.Context(), peerKey{}, tc.peer))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, tc.want, rec.Code, "uid %d err %v", tc.peer.uid, tc.peer.err)
+	}
+}
+
+func TestControlServer_FollowEvents(t *testing.T) {
+	ctl, client := newTestControlServer(t)
+	ctl.eventLog.Append(Event{Type: EventDeploy, Child: "app", Message: "deployed v1"})
+	ctl.eventLog.Append(Event{Type: EventAlert, Child: "app", Message: "health healthy -> down"})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	got := make(chan Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.FollowEvents(ctx, url.Values{"type": {"deploy"}, "limit": {"5"}}, func(id string, data []byte) error {
+			var e Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+			if id != strconv.FormatUint(e.ID, 10) {
+				return fmt.Errorf("id %s for event %d", id, e.ID)
+			}
+			got <- e
+			return nil
+		})
+	}()
+
+	require.Equal(t, "deployed v1", (<-got).Message, "backlog")
+	ctl.eventLog.Append(Event{Type: EventRestart, Child: "app", Message: "filtered out"})
+	ctl.eventLog.Append(Event{Type: EventDeploy, Child: "app", Message: "deployed v2"})
+	e := <-got
+	require.Equal(t, "deployed v2", e.Message)
+	require.Equal(t, uint64(4), e.ID)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
@@ -1,6 +1,7 @@
 package master
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -19,8 +20,15 @@ const (
 	actionVPNUse        = "vpn_use"
 	actionVPNDisable    = "vpn_disable"
 	actionTerminalOpen  = "terminal_open"
+	actionAgentRestart  = "agent_restart"
 
 	commandTTL = 1 * time.Hour
+
+	// localCommandPrefix marks the IDs of commands from the local control API; their
+	// results go to the caller, never into the heartbeat.
+	localCommandPrefix = "local-"
+	// localResultPoll is how often Execute collects results while it waits.
+	localResultPoll = 200 * time.Millisecond
 )
 
 // HeartbeatCommand represents a command received from the heartbeat response.
@@ -36,6 +44,7 @@ type CommandResultReport struct {
 	CommandID string    `json:"command_id"`
 	Status    string    `json:"status"`
 	Message   string    `json:"message,omitempty"`
+	Data      any       `json:"data,omitempty"` // structured result from the child, e.g. ipc.LifecycleResult
 	Timestamp time.Time `json:"timestamp"`
 }
 
@@ -44,7 +53,11 @@ type CommandDispatcher struct {
 	pm             *ProcessManager
 	tm             *tunnel.TunnelManager
 	pendingResults []CommandResultReport
+	waiters        map[string]chan CommandResultReport // local commands by ID
+	running        map[string]runningCommand           // cloud commands awaiting a result, for events
+	eventLog       *EventLog                           // may be nil; set by Run() after construction
 	mu             sync.Mutex
+	collectMu      sync.Mutex // one CollectResults at a time
 
 	seenMu       sync.Mutex
 	seenCommands map[string]time.Time
@@ -53,12 +66,20 @@ type CommandDispatcher struct {
 	allowedOverride map[string]bool // nil = use defaultAllowedActions
 }
 
+// runningCommand is a dispatched cloud command, kept to describe its result in the event log.
+type runningCommand struct {
+	cmd HeartbeatCommand
+	at  time.Time
+}
+
 // NewCommandDispatcher creates a new command dispatcher.
 func NewCommandDispatcher(pm *ProcessManager, tm *tunnel.TunnelManager) *CommandDispatcher {
 	return &CommandDispatcher{
 		pm:             pm,
 		tm:             tm,
 		pendingResults: make([]CommandResultReport, 0),
+		waiters:        make(map[string]chan CommandResultReport),
+		running:        make(map[string]runningCommand),
 		seenCommands:   make(map[string]time.Time),
 	}
 }
@@ -132,55 +153,110 @@ func (d *CommandDispatcher) DispatchCommands(commands []HeartbeatCommand) {
 		if !d.isAllowed(cmd.Action) {
 			logger.Infof("Command %s: action %q rejected (not in allowlist)", cmd.ID, cmd.Action)
 			d.recordResult(cmd.ID, ipc.ResultFailed, fmt.Sprintf("action %q not allowed", cmd.Action))
+			d.appendCommandEvent(cmd, ipc.ResultFailed, "not in allowed_remote_commands")
 			continue
 		}
 		if d.isDuplicate(cmd.ID) {
 			logger.Infof("Command %s: duplicate (already executed), skipping", cmd.ID)
 			continue
 		}
+		d.dispatch(cmd, readers)
+	}
+}
 
-		if cmd.Action == actionTunnelConnect {
-			d.dispatchTunnelConnect(cmd)
-			continue
-		}
-		if cmd.Action == actionTerminalOpen {
-			d.dispatchTerminalOpen(cmd)
-			continue
-		}
-		if isVPNAction(cmd.Action) {
-			d.dispatchVPNCommand(cmd)
-			continue
-		}
-		if d.pm == nil {
-			d.recordResult(cmd.ID, ipc.ResultFailed, "Process manager not available")
-			continue
-		}
-		if cmd.TargetProject == "" {
-			d.recordResult(cmd.ID, ipc.ResultFailed, "Device-level commands not supported for action: "+cmd.Action)
-			continue
+// dispatch runs or forwards one command; its result is recorded under cmd.ID.
+func (d *CommandDispatcher) dispatch(cmd HeartbeatCommand, readers map[string]*ipc.Reader) {
+	if !strings.HasPrefix(cmd.ID, localCommandPrefix) {
+		d.mu.Lock()
+		now := time.Now()
+		for id, rc := range d.running {
+			if now.Sub(rc.at) > commandTTL {
+				delete(d.running, id) // its result never came
+			}
 		}
+		d.running[cmd.ID] = runningCommand{cmd: cmd, at: now}
+		d.mu.Unlock()
+	}
+	if cmd.Action == actionTunnelConnect {
+		d.dispatchTunnelConnect(cmd)
+		return
+	}
+	if cmd.Action == actionTerminalOpen {
+		d.dispatchTerminalOpen(cmd)
+		return
+	}
+	if isVPNAction(cmd.Action) {
+		d.dispatchVPNCommand(cmd)
+		return
+	}
+	if cmd.Action == actionAgentRestart {
+		d.dispatchAgentRestart(cmd)
+		return
+	}
+	if d.pm == nil {
+		d.recordResult(cmd.ID, ipc.ResultFailed, "Process manager not available")
+		return
+	}
+	if cmd.TargetProject == "" {
+		d.recordResult(cmd.ID, ipc.ResultFailed, "Device-level commands not supported for action: "+cmd.Action)
+		return
+	}
 
-		reader, exists := readers[cmd.TargetProject]
-		if !exists {
-			logger.Infof("Command %s: project %s not found", cmd.ID, cmd.TargetProject)
-			d.recordResult(cmd.ID, ipc.ResultFailed, "Project not found: "+cmd.TargetProject)
-			continue
-		}
+	reader, exists := readers[cmd.TargetProject]
+	if !exists {
+		logger.Infof("Command %s: project %s not found", cmd.ID, cmd.TargetProject)
+		d.recordResult(cmd.ID, ipc.ResultFailed, "Project not found: "+cmd.TargetProject)
+		return
+	}
 
-		ipcCmd := &ipc.Command{
-			ID:        cmd.ID,
-			Action:    cmd.Action,
-			Payload:   cmd.Payload,
-			Timestamp: time.Now(),
-		}
+	ipcCmd := &ipc.Command{
+		ID:        cmd.ID,
+		Action:    cmd.Action,
+		Payload:   cmd.Payload,
+		Timestamp: time.Now(),
+	}
 
-		if err := reader.WriteCommand(ipcCmd); err != nil {
-			logger.Infof("Failed to dispatch command %s to %s: %v", cmd.ID, cmd.TargetProject, err)
-			d.recordResult(cmd.ID, ipc.ResultFailed, "Failed to dispatch: "+err.Error())
-			continue
-		}
+	if err := reader.WriteCommand(ipcCmd); err != nil {
+		logger.Infof("Failed to dispatch command %s to %s: %v", cmd.ID, cmd.TargetProject, err)
+		d.recordResult(cmd.ID, ipc.ResultFailed, "Failed to dispatch: "+err.Error())
+		return
+	}
 
-		logger.Infof("Dispatched command %s (%s) to %s", cmd.ID, cmd.Action, cmd.TargetProject)
+	logger.Infof("Dispatched command %s (%s) to %s", cmd.ID, cmd.Action, cmd.TargetProject)
+}
+
+// Execute runs a command from the local control API and waits for its result. Unlike
+// cloud commands it is not subject to allowed_remote_commands, and its result is
+// returned instead of being reported in the heartbeat. cmd.ID must start with
+// localCommandPrefix.
+func (d *CommandDispatcher) Execute(ctx context.Context, cmd HeartbeatCommand) (CommandResultReport, error) {
+	ch := make(chan CommandResultReport, 1)
+	d.mu.Lock()
+	d.waiters[cmd.ID] = ch
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.waiters, cmd.ID)
+		d.mu.Unlock()
+	}()
+
+	var readers map[string]*ipc.Reader
+	if d.pm != nil {
+		readers = d.pm.GetIPCReaders()
+	}
+	d.dispatch(cmd, readers)
+
+	tick := time.NewTicker(localResultPoll)
+	defer tick.Stop()
+	for {
+		select {
+		case res := <-ch:
+			return res, nil
+		case <-ctx.Done():
+			return CommandResultReport{}, ctx.Err()
+		case <-tick.C:
+			d.CollectResults()
+		}
 	}
 }
 
@@ -271,26 +347,57 @@ func (d *CommandDispatcher) dispatchTunnelConnect(cmd HeartbeatCommand) {
 	d.recordResult(cmd.ID, ipc.ResultSuccess, fmt.Sprintf("tunnel %q started", tid))
 }
 
+// dispatchAgentRestart respawns the target project's child agent, reviving it if it failed.
+// The master handles it: a failed agent cannot receive commands.
+func (d *CommandDispatcher) dispatchAgentRestart(cmd HeartbeatCommand) {
+	if d.pm == nil {
+		d.recordResult(cmd.ID, ipc.ResultFailed, "Process manager not available")
+		return
+	}
+	if cmd.TargetProject == "" {
+		d.recordResult(cmd.ID, ipc.ResultFailed, "target_project required for "+actionAgentRestart)
+		return
+	}
+	// Stopping a running agent can take a while; don't hold up the heartbeat
+	go func() {
+		if err := d.pm.RestartAgent(cmd.TargetProject); err != nil {
+			d.recordResult(cmd.ID, ipc.ResultFailed, err.Error())
+			return
+		}
+		logger.Infof("Command %s: restarted agent of %s", cmd.ID, cmd.TargetProject)
+		d.recordResult(cmd.ID, ipc.ResultSuccess, "agent restarted")
+	}()
+}
+
 // CollectResults collects command results from all children.
 func (d *CommandDispatcher) CollectResults() {
 	if d.pm == nil {
 		return
 	}
 
+	d.collectMu.Lock()
+	defer d.collectMu.Unlock()
 	readers := d.pm.GetIPCReaders()
 
 	for projectID, reader := range readers {
-		result, err := reader.ReadCommandResult()
-		if err != nil {
-			logger.Infof("Error reading command result from %s: %v", projectID, err)
-			continue
+		// Progress streamed over the socket is reported as a running result
+		for _, p := range reader.ReadProgress() {
+			d.recordResultData(p.CommandID, ipc.ResultRunning, p.Message, p.Data)
 		}
-		if result == nil {
-			continue
+		// Socket results queue up; the file holds at most one
+		for {
+			result, err := reader.ReadCommandResult()
+			if err != nil {
+				logger.Infof("Error reading command result from %s: %v", projectID, err)
+				break
+			}
+			if result == nil {
+				break
+			}
+
+			logger.Infof("Collected result for command %s from %s: %s", result.CommandID, projectID, result.Status)
+			d.recordResultData(result.CommandID, result.Status, result.Message, result.Data)
 		}
-
-		logger.Infof("Collected result for command %s from %s: %s", result.CommandID, projectID, result.Status)
-		d.recordResult(result.CommandID, result.Status, result.Message)
 	}
 }
 
@@ -306,14 +413,51 @@ func (d *CommandDispatcher) GetPendingResults() []CommandResultReport {
 
 // recordResult adds a command result to the pending results list.
 func (d *CommandDispatcher) recordResult(commandID, status, message string) {
+	d.recordResultData(commandID, status, message, nil)
+}
+
+// recordResultData adds a command result with structured data to the pending results list,
+// or hands the final result of a local command to Execute.
+func (d *CommandDispatcher) recordResultData(commandID, status, message string, data any) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	d.pendingResults = append(d.pendingResults, CommandResultReport{
+	res := CommandResultReport{
 		CommandID: commandID,
 		Status:    status,
 		Message:   message,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	if strings.HasPrefix(commandID, localCommandPrefix) {
+		if ch, ok := d.waiters[commandID]; ok && status != ipc.ResultRunning {
+			ch <- res
+			delete(d.waiters, commandID)
+		}
+		return // progress, or the caller gave up
+	}
+	d.pendingResults = append(d.pendingResults, res)
+	if rc, ok := d.running[commandID]; ok && status != ipc.ResultRunning {
+		delete(d.running, commandID)
+		d.appendCommandEvent(rc.cmd, status, message)
+	}
+}
+
+// appendCommandEvent records the outcome of a cloud command. Local commands are recorded
+// by the control API.
+func (d *CommandDispatcher) appendCommandEvent(cmd HeartbeatCommand, status, message string) {
+	if d.eventLog == nil {
+		return
+	}
+	msg := fmt.Sprintf("%s from cloud (%s): %s", cmd.Action, cmd.ID, status)
+	if message != "" {
+		msg += ": " + message
+	}
+	d.eventLog.Append(Event{
 		Timestamp: time.Now(),
+		Type:      EventCommand,
+		Child:     cmd.TargetProject,
+		Message:   msg,
 	})
 }
 
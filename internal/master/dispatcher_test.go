@@ -1,6 +1,7 @@
 package master
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -137,6 +138,24 @@ func TestCommandDispatcher_Allowlist(t *testing.T) {
 	})
 }
 
+func TestCommandDispatcher_CommandEvents(t *testing.T) {
+	d := NewCommandDispatcher(nil, nil)
+	d.eventLog = NewEventLog()
+	d.SetAllowedActions([]string{"restart"})
+	d.DispatchCommands([]HeartbeatCommand{
+		{ID: "cmd1", Action: "restart", TargetProject: "app"},
+		{ID: "cmd2", Action: "stop", TargetProject: "app"},
+	})
+	d.recordResult("cmd1", ipc.ResultSuccess, "ignored: already reported")
+
+	events := d.eventLog.Recent()
+	require.Len(t, events, 2)
+	require.Equal(t, EventCommand, events[0].Type)
+	require.Equal(t, "app", events[0].Child)
+	require.Equal(t, "restart from cloud (cmd1): failed: Process manager not available", events[0].Message)
+	require.Equal(t, "stop from cloud (cmd2): failed: not in allowed_remote_commands", events[1].Message)
+}
+
 func TestCommandDispatcher_VPN(t *testing.T) {
 	setup := func(t *testing.T) *CommandDispatcher {
 		t.Helper()
@@ -240,3 +259,123 @@ func TestCommandResultReport_structure(t *testing.T) {
 	require.Equal(t, ipc.ResultSuccess, r.Status)
 	require.Equal(t, now, r.Timestamp)
 }
+
+func TestCommandDispatcher_recordResultData(t *testing.T) {
+	d := NewCommandDispatcher(nil, nil)
+	d.recordResultData("cmd_r", ipc.ResultSuccess, "Restart completed", &ipc.LifecycleResult{
+		Action: ipc.ActionRestart, Adapter: "systemd", Target: "app.service", Health: ipc.StatusHealthy,
+	})
+
+	results := d.GetPendingResults()
+	require.Len(t, results, 1)
+	data, err := json.Marshal(results[0])
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"data":{"action":"restart","adapter":"systemd","target":"app.service"`)
+	require.Contains(t, string(data), `"health":"healthy"`)
+}
+
+func TestCommandDispatcher_SocketIPC(t *testing.T) {
+	dir := t.TempDir()
+	reader := ipc.NewReader(dir)
+	require.NoError(t, reader.Listen("myapp"))
+	t.Cleanup(func() { reader.Close() })
+	pm := &ProcessManager{children: map[string]*ChildProcess{
+		"myapp": {ProjectID: "myapp", IPCDir: dir, IPC: reader},
+	}}
+	writer, err := ipc.NewWriter(dir)
+	require.NoError(t, err)
+	writer.Connect(t.Context(), "myapp")
+	require.Eventually(t, reader.Connected, 5*time.Second, 10*time.Millisecond)
+
+	d := NewCommandDispatcher(pm, nil)
+	d.DispatchCommands([]HeartbeatCommand{
+		{ID: "cmd1", Action: "health_check", TargetProject: "myapp"},
+		{ID: "cmd2", Action: "fetch_logs", TargetProject: "myapp"},
+	})
+	require.Empty(t, d.GetPendingResults())
+
+	// Both commands are queued in the child and their results are collected together
+	for _, id := range []string{"cmd1", "cmd2"} {
+		cmd, err := writer.ReadCommand()
+		require.NoError(t, err)
+		require.Equal(t, id, cmd.ID)
+		if id == "cmd1" {
+			require.NoError(t, writer.WriteProgress(&ipc.CommandProgress{CommandID: id, Message: "checking"}))
+		}
+		require.NoError(t, writer.WriteCommandResult(&ipc.CommandResult{CommandID: id, Status: ipc.ResultSuccess}))
+	}
+
+	d.CollectResults()
+	results := d.GetPendingResults()
+	require.Len(t, results, 3)
+	require.Equal(t, ipc.ResultRunning, results[0].Status)
+	require.Equal(t, "checking", results[0].Message)
+	require.Equal(t, "cmd1", results[1].CommandID)
+	require.Equal(t, "cmd2", results[2].CommandID)
+}
+
+func TestCommandDispatcher_AgentRestart(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	pm, err := NewProcessManager(t.Context())
+	require.NoError(t, err)
+	d := NewCommandDispatcher(pm, nil)
+
+	d.DispatchCommands([]HeartbeatCommand{
+		{ID: "cmd1", Action: actionAgentRestart},
+		{ID: "cmd2", Action: actionAgentRestart, TargetProject: "missing"},
+	})
+	var results []CommandResultReport
+	require.Eventually(t, func() bool {
+		results = append(results, d.GetPendingResults()...)
+		return len(results) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, r := range results {
+		require.Equal(t, ipc.ResultFailed, r.Status)
+	}
+	require.ElementsMatch(t, []string{"cmd1", "cmd2"}, []string{results[0].CommandID, results[1].CommandID})
+}
+
+func TestCommandDispatcher_Execute(t *testing.T) {
+	dir := t.TempDir()
+	reader := ipc.NewReader(dir)
+	require.NoError(t, reader.Listen("myapp"))
+	t.Cleanup(func() { reader.Close() })
+	pm := &ProcessManager{children: map[string]*ChildProcess{
+		"myapp": {ProjectID: "myapp", IPCDir: dir, IPC: reader},
+	}}
+	writer, err := ipc.NewWriter(dir)
+	require.NoError(t, err)
+	writer.Connect(t.Context(), "myapp")
+	require.Eventually(t, reader.Connected, 5*time.Second, 10*time.Millisecond)
+
+	// The agent answers with progress, then the result
+	go func() {
+		for {
+			cmd, err := writer.ReadCommand()
+			if err != nil {
+				return
+			}
+			if cmd == nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			_ = writer.WriteProgress(&ipc.CommandProgress{CommandID: cmd.ID, Message: "restarting"})
+			_ = writer.WriteCommandResult(&ipc.CommandResult{CommandID: cmd.ID, Status: ipc.ResultSuccess, Message: "restarted"})
+			return
+		}
+	}()
+
+	// Local commands bypass the allowlist
+	d := NewCommandDispatcher(pm, nil)
+	d.SetAllowedActions([]string{"health_check"})
+	res, err := d.Execute(t.Context(), HeartbeatCommand{ID: localCommandPrefix + "1", Action: "restart", TargetProject: "myapp"})
+	require.NoError(t, err)
+	require.Equal(t, ipc.ResultSuccess, res.Status)
+	require.Equal(t, "restarted", res.Message)
+	require.Empty(t, d.GetPendingResults(), "local results stay out of the heartbeat")
+
+	res, err = d.Execute(t.Context(), HeartbeatCommand{ID: localCommandPrefix + "2", Action: "restart", TargetProject: "missing"})
+	require.NoError(t, err)
+	require.Equal(t, ipc.ResultFailed, res.Status)
+	require.Empty(t, d.GetPendingResults())
+}
@@ -8,6 +8,9 @@ import (
 const (
 	maxEvents   = 50
 	maxEventAge = 24 * time.Hour
+
+	// subscriberBuffer is how many events a subscriber may fall behind before it is dropped.
+	subscriberBuffer = 256
 )
 
 // EventType classifies a log entry.
@@ -20,10 +23,17 @@ const (
 	EventRestart EventType = "restart"
 	EventStart   EventType = "start"
 	EventStop    EventType = "stop"
+	EventConfig  EventType = "config"
+	EventTunnel  EventType = "tunnel"
+	EventVPN     EventType = "vpn"
+	EventCommand EventType = "command"
+	EventUpgrade EventType = "upgrade"
 )
 
-// Event is a single entry in the event ring buffer.
+// Event is a single entry in the event log.
 type Event struct {
+	// ID increases with every event, across master restarts when the log is persisted.
+	ID         uint64    `json:"id,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
 	Type       EventType `json:"type"`
 	Child      string    `json:"source,omitempty"`
@@ -31,24 +41,89 @@ type Event struct {
 	DurationMs int64     `json:"duration_ms,omitempty"`
 }
 
-// EventLog is a bounded, thread-safe ring buffer.
+// EventLog keeps recent events in a bounded, thread-safe ring buffer and, once Persist
+// is called, appends every event to an EventStore. Subscribers receive events as they
+// are appended.
 type EventLog struct {
-	mu     sync.RWMutex
-	events []Event
+	mu       sync.RWMutex
+	events   []Event
+	lastID   uint64
+	store    *EventStore // nil = memory only
+	storeErr bool        // a write failed; logged once
+	subs     map[chan Event]struct{}
 }
 
 // NewEventLog creates an empty event log.
 func NewEventLog() *EventLog {
 	return &EventLog{
 		events: make([]Event, 0, maxEvents),
+		subs:   make(map[chan Event]struct{}),
+	}
+}
+
+// Persist appends events to store from now on. IDs continue from the newest stored
+// event, and the ring buffer is seeded with the stored events of the last 24h so they
+// survive a master restart.
+func (el *EventLog) Persist(store *EventStore) {
+	recent, err := store.Read(EventQuery{Since: time.Now().Add(-maxEventAge), Limit: maxEvents})
+	if err != nil {
+		logger.Infof("Event store: %v", err)
+	}
+	lastID := store.LastID()
+
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.store = store
+	// Events appended before Persist are renumbered after the stored ones and written
+	pending := el.events
+	el.events = append(make([]Event, 0, maxEvents), recent...)
+	el.lastID = lastID
+	for _, e := range pending {
+		el.appendLocked(e)
 	}
 }
 
+// Close stops persisting events and closes the store.
+func (el *EventLog) Close() error {
+	el.mu.Lock()
+	store := el.store
+	el.store = nil
+	el.mu.Unlock()
+	if store == nil {
+		return nil
+	}
+	return store.Close()
+}
+
 // Append adds an event. Evicts the oldest entry if at capacity.
 // Also prunes events older than maxEventAge.
 func (el *EventLog) Append(e Event) {
 	el.mu.Lock()
 	defer el.mu.Unlock()
+	el.appendLocked(e)
+}
+
+func (el *EventLog) appendLocked(e Event) {
+	el.lastID++
+	e.ID = el.lastID
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	if el.store != nil {
+		if err := el.store.Append(e); err != nil && !el.storeErr {
+			logger.Infof("Event store: %v (events are kept in memory only)", err)
+			el.storeErr = true
+		}
+	}
+	for ch := range el.subs {
+		select {
+		case ch <- e:
+		default:
+			// Too slow: the subscriber sees its channel close and can resume by ID
+			delete(el.subs, ch)
+			close(ch)
+		}
+	}
 
 	el.events = append(el.events, e)
 
@@ -82,3 +157,43 @@ func (el *EventLog) Recent() []Event {
 	}
 	return result
 }
+
+// Query returns the events matching q, oldest first: from the store when the log is
+// persisted, otherwise from the ring buffer.
+func (el *EventLog) Query(q EventQuery) ([]Event, error) {
+	el.mu.RLock()
+	store := el.store
+	el.mu.RUnlock()
+	if store != nil {
+		return store.Read(q)
+	}
+
+	var events []Event
+	for _, e := range el.Recent() {
+		if q.Match(e) {
+			events = append(events, e)
+		}
+	}
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+	return events, nil
+}
+
+// Subscribe returns a channel that receives every event appended from now on, and a
+// function that ends the subscription. The channel is closed when the subscriber falls
+// more than subscriberBuffer events behind.
+func (el *EventLog) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	el.mu.Lock()
+	el.subs[ch] = struct{}{}
+	el.mu.Unlock()
+	return ch, func() {
+		el.mu.Lock()
+		defer el.mu.Unlock()
+		if _, ok := el.subs[ch]; ok {
+			delete(el.subs, ch)
+			close(ch)
+		}
+	}
+}
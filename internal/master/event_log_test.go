@@ -0,0 +1,135 @@
+package master
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"beacon/internal/ipc"
+	"beacon/internal/state"
+	"beacon/internal/vpn"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLog_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	store, err := OpenEventStore(path)
+	require.NoError(t, err)
+
+	el := NewEventLog()
+	el.Append(Event{Type: EventStart, Message: "before persist"})
+	el.Persist(store)
+	el.Append(Event{Timestamp: time.Now().Add(-48 * time.Hour), Type: EventDeploy, Child: "app", Message: "old"})
+	require.NoError(t, store.f.Rotate())
+	el.Append(Event{Type: EventDeploy, Child: "app", Message: "deployed v2"})
+	el.Append(Event{Type: EventAlert, Child: "web", Message: "health healthy -> down"})
+	require.NoError(t, el.Close())
+
+	// A crash can leave half a line behind
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id":99,"type":"dep`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	events, err := ReadEvents(path, EventQuery{})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	for i, e := range events {
+		require.Equal(t, uint64(i+1), e.ID)
+	}
+
+	events, err = ReadEvents(path, EventQuery{Type: EventDeploy, Since: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "deployed v2", events[0].Message)
+
+	events, err = ReadEvents(path, EventQuery{Limit: 2, AfterID: 1})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 4}, []uint64{events[0].ID, events[1].ID})
+
+	// After a restart IDs continue and the last day is back in the ring buffer
+	store, err = OpenEventStore(path)
+	require.NoError(t, err)
+	el = NewEventLog()
+	el.Persist(store)
+	defer el.Close()
+	el.Append(Event{Type: EventStart, Message: "restarted"})
+	recent := el.Recent()
+	require.Len(t, recent, 4, "the 48h old event is not recent")
+	require.Equal(t, uint64(5), recent[len(recent)-1].ID)
+
+	events, err = el.Query(EventQuery{Project: "web"})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+}
+
+func TestEventLog_Subscribe(t *testing.T) {
+	el := NewEventLog()
+	live, unsubscribe := el.Subscribe()
+	el.Append(Event{Type: EventConfig, Message: "config reloaded"})
+	e := <-live
+	require.Equal(t, "config reloaded", e.Message)
+	require.Equal(t, uint64(1), e.ID)
+	unsubscribe()
+	unsubscribe()
+
+	// A subscriber that falls behind is dropped
+	slow, unsubscribe := el.Subscribe()
+	defer unsubscribe()
+	for range subscriberBuffer + 1 {
+		el.Append(Event{Type: EventSync, Message: "tick"})
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	require.Equal(t, subscriberBuffer, n)
+}
+
+func TestSnapshotChanges(t *testing.T) {
+	prev := StatusSnapshot{
+		Children: []ChildStatus{
+			{Name: "app", Status: "healthy", Deploys: []state.DeployRecord{{ID: "d1", Tag: "v1", Success: true}}},
+			{Name: "web", Status: ipc.StatusUnknown},
+		},
+		Tunnels: []TunnelStatusInfo{{ID: "ha", Status: "connected"}},
+	}
+	cur := StatusSnapshot{
+		Children: []ChildStatus{
+			{
+				Name:   "app",
+				Status: "down",
+				Checks: CheckSummary{Details: []CheckDetail{
+					{Name: "http", Status: "failing", Error: "connection refused"},
+					{Name: "disk", Status: "passing"},
+				}},
+				Deploys: []state.DeployRecord{
+					{ID: "d3", Tag: "v3", Trigger: "poll", Success: false, ExitCode: 2, DurationMs: 1500},
+					{ID: "d2", Tag: "v2", Trigger: "webhook", Success: true},
+					{ID: "d1", Tag: "v1", Success: true},
+				},
+			},
+			{Name: "web", Status: "healthy"},
+			{Name: "new", Status: "down"},
+		},
+		Tunnels: []TunnelStatusInfo{{ID: "ha", Status: "reconnecting"}, {ID: "grafana", Status: "connected"}},
+		VPN:     &vpn.Status{Enabled: true, Role: vpn.RoleClient, Connected: true, PeerDevice: "home"},
+	}
+
+	var got []string
+	for _, e := range snapshotChanges(prev, cur) {
+		got = append(got, string(e.Type)+" "+e.Child+" "+e.Message)
+	}
+	require.Equal(t, []string{
+		"alert app health healthy -> down; failing: http (connection refused)",
+		"deploy app deployed v2 (webhook)",
+		"deploy app deploy of v3 failed (poll): exit code 2",
+		"tunnel  tunnel ha connected -> reconnecting",
+		"vpn  VPN client connected to home",
+	}, got)
+
+	require.Empty(t, snapshotChanges(cur, cur))
+}
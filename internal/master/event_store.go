@@ -0,0 +1,165 @@
+package master
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/logging"
+)
+
+// The event store rotates daily or at eventStoreMaxSize and keeps a month of gzipped files.
+const (
+	eventStoreMaxSize    = 4 << 20
+	eventStoreMaxAge     = 24 * time.Hour
+	eventStoreMaxBackups = 30
+)
+
+// EventStorePath returns ~/.beacon/state/events.jsonl, the master's persistent event log.
+func EventStorePath() (string, error) {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "state", "events.jsonl"), nil
+}
+
+// EventQuery selects events from the event log. Zero fields match everything.
+type EventQuery struct {
+	Since   time.Time
+	AfterID uint64 // only events with a greater ID
+	Type    EventType
+	Project string
+	Limit   int // keep the newest Limit matches (0 = all)
+}
+
+// Match reports whether e is selected by q, ignoring Limit.
+func (q EventQuery) Match(e Event) bool {
+	return e.ID > q.AfterID &&
+		!e.Timestamp.Before(q.Since) &&
+		(q.Type == "" || e.Type == q.Type) &&
+		(q.Project == "" || e.Child == q.Project)
+}
+
+// EventStore appends events as JSON lines to a rotated, compressed file.
+type EventStore struct {
+	path string
+	f    *logging.RotatingFile
+}
+
+// OpenEventStore opens (or creates) the event store at path.
+func OpenEventStore(path string) (*EventStore, error) {
+	f, err := logging.OpenRotating(path, logging.RotateOptions{
+		MaxSize:    eventStoreMaxSize,
+		MaxAge:     eventStoreMaxAge,
+		MaxBackups: eventStoreMaxBackups,
+		Compress:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EventStore{path: path, f: f}, nil
+}
+
+// Append writes one event.
+func (s *EventStore) Append(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+// Read returns the stored events matching q, oldest first.
+func (s *EventStore) Read(q EventQuery) ([]Event, error) {
+	return ReadEvents(s.path, q)
+}
+
+// LastID returns the ID of the newest stored event, 0 if there is none.
+func (s *EventStore) LastID() uint64 {
+	files := append(logging.RotatedFiles(s.path), s.path)
+	for i := len(files) - 1; i >= 0; i-- {
+		var last uint64
+		_ = scanEvents(files[i], func(e Event) { last = max(last, e.ID) })
+		if last > 0 {
+			return last
+		}
+	}
+	return 0
+}
+
+// Close flushes and closes the store.
+func (s *EventStore) Close() error {
+	return s.f.Close()
+}
+
+// ReadEvents reads the event store at path, rotated files included, and returns the
+// events matching q, oldest first. It does not need the master to be running.
+func ReadEvents(path string, q EventQuery) ([]Event, error) {
+	var files []string
+	for _, f := range logging.RotatedFiles(path) {
+		// A rotated file only holds events from before it was rotated
+		if at, ok := logging.RotatedAt(f); ok && at.Before(q.Since) {
+			continue
+		}
+		files = append(files, f)
+	}
+	files = append(files, path)
+
+	var events []Event
+	var lastID uint64
+	for _, f := range files {
+		err := scanEvents(f, func(e Event) {
+			// A file rotated while it was read can show up twice
+			if e.ID <= lastID || !q.Match(e) {
+				return
+			}
+			lastID = e.ID
+			events = append(events, e)
+			if q.Limit > 0 && len(events) >= 2*q.Limit {
+				events = append(events[:0], events[len(events)-q.Limit:]...)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+	return events, nil
+}
+
+// scanEvents calls fn for every well-formed event in a current or rotated store file.
+// A missing file has no events.
+func scanEvents(path string, fn func(Event)) error {
+	r, err := logging.OpenLogFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("open event store: %w", err)
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e Event
+		// Skips a line cut short by a crash or being written right now
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.ID == 0 {
+			continue
+		}
+		fn(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read event store %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
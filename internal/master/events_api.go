@@ -0,0 +1,164 @@
+package master
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultEventLimit caps a query without limit=.
+	defaultEventLimit = 1000
+
+	// eventKeepalive is how often an idle event stream sends a comment, so proxies and
+	// tunnels keep it open.
+	eventKeepalive = 15 * time.Second
+)
+
+// serveEvents answers GET /api/events (and the control API's /v1/events):
+//
+//	?since=1h|RFC3339  ?type=deploy  ?project=myapp  ?limit=100  ?after=<id>
+//
+// It returns a JSON array, oldest first, or a Server-Sent Events stream when the client
+// accepts text/event-stream or passes follow=1. A stream starts with the matching stored
+// events when since, after or limit is given (or Last-Event-ID is sent on reconnect),
+// then sends new events as they happen, each as "id: <id>" and "data: <event JSON>".
+func serveEvents(w http.ResponseWriter, r *http.Request, el *EventLog) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	if el == nil {
+		writeControlError(w, http.StatusServiceUnavailable, errors.New("event log not available"))
+		return
+	}
+	params := r.URL.Query()
+	if params.Get("follow") == "1" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		backlog := params.Has("since") || params.Has("after") || params.Has("limit") || r.Header.Get("Last-Event-ID") != ""
+		streamEvents(w, r, el, q, backlog)
+		return
+	}
+
+	if q.Limit == 0 {
+		q.Limit = defaultEventLimit
+	}
+	events, err := el.Query(q)
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if events == nil {
+		events = []Event{}
+	}
+	writeControlJSON(w, events)
+}
+
+func parseEventQuery(r *http.Request) (EventQuery, error) {
+	params := r.URL.Query()
+	q := EventQuery{Type: EventType(params.Get("type")), Project: params.Get("project")}
+	if v := params.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			q.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			q.Since = t
+		} else {
+			return q, fmt.Errorf("invalid since %q: use a duration or an RFC 3339 time", v)
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+		q.Limit = n
+	}
+	after := params.Get("after")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		after = id
+	}
+	if after != "" {
+		n, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid event id %q", after)
+		}
+		q.AfterID = n
+	}
+	return q, nil
+}
+
+// streamEvents writes the backlog, if asked for, and then new events until the client
+// goes away, the server shuts down or the client falls too far behind.
+func streamEvents(w http.ResponseWriter, r *http.Request, el *EventLog, q EventQuery, backlog bool) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{}) // streams outlast the server's write timeout
+
+	// Subscribe before reading the backlog so nothing falls in between
+	live, unsubscribe := el.Subscribe()
+	defer unsubscribe()
+	var events []Event
+	if backlog {
+		var err error
+		if events, err = el.Query(q); err != nil {
+			writeControlError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	lastID := q.AfterID
+	send := func(e Event) error {
+		if e.ID <= lastID {
+			return nil // already sent with the backlog
+		}
+		lastID = e.ID
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.ID, data)
+		return err
+	}
+	for _, e := range events {
+		if send(e) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-live:
+			if !ok {
+				return // fell behind; the client resumes with Last-Event-ID
+			}
+			if !q.Match(e) {
+				continue
+			}
+			if send(e) != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package master
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"beacon/internal/config"
+	"beacon/internal/identity"
+	"beacon/internal/logging"
+)
+
+// MasterLogPath returns ~/.beacon/logs/master.log, the master's own log.
+func MasterLogPath() (string, error) {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "logs", "master.log"), nil
+}
+
+// AgentLogPath returns ~/.beacon/config/projects/<project>/logs/agent.log, where the
+// master captures the output of the project's child agent.
+func AgentLogPath(projectID string) string {
+	return filepath.Join(config.ProjectConfigDir(projectID), "logs", "agent.log")
+}
+
+// logRotateOptions converts the logs block of config.yaml.
+func logRotateOptions(c *identity.LogConfig) logging.RotateOptions {
+	return logging.RotateOptions{
+		MaxSize:    int64(c.EffectiveMaxSizeMB()) << 20,
+		MaxAge:     c.EffectiveMaxAge(),
+		MaxBackups: c.EffectiveMaxFiles(),
+		Compress:   c.EffectiveCompress(),
+	}
+}
+
+// SetLogOptions sets the rotation of the agent logs, for running and future agents.
+func (pm *ProcessManager) SetLogOptions(opts logging.RotateOptions) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.logOptions = opts
+	for _, child := range pm.children {
+		if child.log != nil {
+			child.log.SetOptions(opts)
+		}
+	}
+}
+
+// openMasterLog sends the master's log to master.log as well as stderr, or only to
+// master.log when stderr is a file (the detached `beacon start` redirects it to
+// master.out to catch crashes). Returns nil if the file cannot be opened.
+func openMasterLog(opts logging.RotateOptions) *logging.RotatingFile {
+	path, err := MasterLogPath()
+	if err != nil {
+		logger.Infof("Master log file disabled: %v", err)
+		return nil
+	}
+	f, err := logging.OpenRotating(path, opts)
+	if err != nil {
+		logger.Infof("Master log file disabled: %v", err)
+		return nil
+	}
+	if info, err := os.Stderr.Stat(); err == nil && info.Mode().IsRegular() {
+		logging.SetOutput(f)
+	} else {
+		logging.SetOutput(io.MultiWriter(os.Stderr, f))
+	}
+	return f
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package master
+
+import "net"
+
+// peerUID is not implemented outside Linux; the control socket's 0600 mode alone keeps
+// other users out.
+func peerUID(c net.Conn) (int, error) {
+	return -1, errPeerCredUnsupported
+}
@@ -3,20 +3,29 @@ package master
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"beacon/internal/identity"
 	"beacon/internal/ipc"
+	"beacon/internal/logging"
+	"beacon/internal/state"
 )
 
 const (
-	maxRestarts  = 5
-	maxBackoff   = 60 * time.Second
 	shutdownWait = 10 * time.Second
+	// childStderrTail is how much of a child's stderr is kept to explain a crash.
+	childStderrTail = 64 << 10
+	// childOutputWait bounds how long an exited agent's output is drained; a process it
+	// left behind can hold the pipes open.
+	childOutputWait = 2 * time.Second
 )
 
 // ChildProcess represents a spawned child agent process.
@@ -24,10 +33,37 @@ type ChildProcess struct {
 	ProjectID  string
 	ConfigPath string
 	IPCDir     string
-	Cmd        *exec.Cmd
+	IPC        *ipc.Reader // listens on the child's socket; nil if it could not be opened
+	Cmd        *exec.Cmd   // nil for an agent adopted from a previous master
+	Process    *os.Process // the agent process, started or adopted
 	StartedAt  time.Time
+	Restart    *identity.RestartPolicy
 	Restarts   int
-	Failed     bool // Set to true if max restarts exceeded
+	Failed     bool // gave up: max restarts exceeded or the respawn failed
+	Exited     bool // exited and not respawned, per its restart policy
+
+	// Last exit of the agent process
+	ExitCode   int    // -1 when killed by a signal
+	ExitReason string // e.g. "exit status 2: panic: runtime error: ..."
+	ExitedAt   time.Time
+
+	Resources    *identity.ResourceLimits
+	RunAs        *identity.RunAs
+	SandboxError string // why resource limits are not enforced
+
+	log     *logging.RotatingFile // agent.log; nil if it could not be opened
+	stderr  *state.TailBuffer
+	output  *agentOutput
+	alive   bool          // the process has not been waited for
+	runAs   *runAsUser    // nil: runs as the master's user
+	cgroup  *cgroup       // nil: cgroups unavailable
+	stopped chan struct{} // closed by Stop: do not respawn
+	exited  chan struct{} // closed when the watcher returns
+}
+
+// Running reports whether the agent process is up or being respawned.
+func (c *ChildProcess) Running() bool {
+	return !c.Failed && !c.Exited
 }
 
 // ProcessManager manages child agent processes.
@@ -38,7 +74,10 @@ type ProcessManager struct {
 	cancel   context.CancelFunc
 	wg       sync.WaitGroup
 	ipcBase  string
-	eventLog *EventLog // may be nil; set by Run() after construction
+	cgroups  cgroupParent
+	// logOptions is the rotation of the agents' log files
+	logOptions logging.RotateOptions
+	eventLog   *EventLog // may be nil; set by Run() after construction
 }
 
 // NewProcessManager creates a new process manager.
@@ -51,10 +90,11 @@ func NewProcessManager(ctx context.Context) (*ProcessManager, error) {
 	childCtx, cancel := context.WithCancel(ctx)
 
 	return &ProcessManager{
-		children: make(map[string]*ChildProcess),
-		ctx:      childCtx,
-		cancel:   cancel,
-		ipcBase:  ipcBase,
+		children:   make(map[string]*ChildProcess),
+		ctx:        childCtx,
+		cancel:     cancel,
+		ipcBase:    ipcBase,
+		logOptions: logRotateOptions(nil),
 	}, nil
 }
 
@@ -92,9 +132,14 @@ func (pm *ProcessManager) Spawn(project identity.ProjectConfig) error {
 	defer pm.mu.Unlock()
 
 	// Check if already running
-	if existing, ok := pm.children[project.ID]; ok && !existing.Failed {
+	if existing, ok := pm.children[project.ID]; ok && existing.Running() {
 		return fmt.Errorf("child for project %s already running", project.ID)
 	}
+	restart := project.Restart
+	if err := restart.Validate(); err != nil {
+		logger.Infof("Project %s: %v; using the default restart policy", project.ID, err)
+		restart = nil
+	}
 
 	// Create IPC directory
 	ipcDir := filepath.Join(pm.ipcBase, project.ID)
@@ -106,9 +151,36 @@ func (pm *ProcessManager) Spawn(project identity.ProjectConfig) error {
 		ProjectID:  project.ID,
 		ConfigPath: project.ConfigPath,
 		IPCDir:     ipcDir,
+		Restart:    restart,
+		Resources:  project.Resources,
+		RunAs:      project.RunAs,
+		stopped:    make(chan struct{}),
+		exited:     make(chan struct{}),
+	}
+	if existing, ok := pm.children[project.ID]; ok && existing.IPC != nil {
+		child.IPC = existing.IPC
+	} else {
+		reader := ipc.NewReader(ipcDir)
+		if err := reader.Listen(project.ID); err != nil {
+			logger.Infof("Project %s: %v; using file IPC", project.ID, err)
+		} else {
+			child.IPC = reader
+		}
 	}
 
+	if existing, ok := pm.children[project.ID]; ok && existing.log != nil {
+		child.log = existing.log
+	} else if lf, err := logging.OpenRotating(AgentLogPath(project.ID), pm.logOptions); err != nil {
+		logger.Infof("Project %s: %v; agent output goes to the master's", project.ID, err)
+	} else {
+		child.log = lf
+	}
+
+	if err := pm.prepareSandbox(child); err != nil {
+		return err
+	}
 	if err := pm.spawnChild(child); err != nil {
+		child.cgroup.remove()
 		return err
 	}
 
@@ -118,7 +190,7 @@ func (pm *ProcessManager) Spawn(project identity.ProjectConfig) error {
 	pm.wg.Add(1)
 	go pm.watchChild(child)
 
-	logger.Infof("Started project %s (PID %d)", project.ID, child.Cmd.Process.Pid)
+	logger.Infof("Started project %s (PID %d)", project.ID, child.Process.Pid)
 	return nil
 }
 
@@ -130,72 +202,150 @@ func (pm *ProcessManager) spawnChild(child *ChildProcess) error {
 		return fmt.Errorf("get executable path: %w", err)
 	}
 
-	cmd := exec.CommandContext(pm.ctx, execPath, "agent",
-		"--project-id", child.ProjectID,
-		"--config", child.ConfigPath,
-		"--ipc-dir", child.IPCDir,
-	)
-
-	// Inherit stdout/stderr for logging
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
+	out, err := newAgentOutput()
+	if err != nil {
+		return err
+	}
+	cmd, err := pm.childCommand(child, execPath, out)
+	if err != nil {
+		out.close()
+		return err
+	}
+	release, err := child.cgroup.attach(cmd.SysProcAttr)
+	if err == nil {
+		err = cmd.Start()
+		release()
+	}
+	if err != nil && child.cgroup != nil {
+		// Rather unlimited than unmonitored
+		child.SandboxError = "resource limits not applied: " + err.Error()
+		logger.Infof("Project %s: cannot start in its cgroup (%v); starting without resource limits", child.ProjectID, err)
+		child.cgroup.remove()
+		child.cgroup = nil
+		if cmd, err = pm.childCommand(child, execPath, out); err == nil {
+			err = cmd.Start()
+		}
+	}
+	if err != nil {
+		out.close()
 		return fmt.Errorf("start child: %w", err)
 	}
 
 	child.Cmd = cmd
+	child.Process = cmd.Process
 	child.StartedAt = time.Now()
+	child.alive = true
+	child.stderr = state.NewTailBuffer(childStderrTail)
+	child.output = out
+	out.started()
+	pm.copyOutput(child)
 
 	return nil
 }
 
+// copyOutput copies the agent's output to its log file, or else to the master's, and
+// keeps the end of stderr to explain a crash.
+func (pm *ProcessManager) copyOutput(child *ChildProcess) {
+	var out io.Writer = os.Stdout
+	errOut := io.Writer(os.Stderr)
+	if child.log != nil {
+		out, errOut = child.log, child.log
+	}
+	child.output.copy(out, io.MultiWriter(errOut, child.stderr))
+}
+
+// childCommand builds the command for a child agent, running as its run_as user if set.
+// The agent writes to pipes so a new master can take its output over on self-upgrade.
+func (pm *ProcessManager) childCommand(child *ChildProcess, execPath string, out *agentOutput) (*exec.Cmd, error) {
+	cmd := exec.Command(execPath, "agent",
+		"--project-id", child.ProjectID,
+		"--config", child.ConfigPath,
+		"--ipc-dir", child.IPCDir,
+	)
+	cmd.Stdout, cmd.Stderr = out.stdoutW, out.stderrW
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if child.runAs != nil {
+		if err := setCredential(cmd.SysProcAttr, child.runAs); err != nil {
+			return nil, err
+		}
+		cmd.Env = child.runAs.environ(pm.beaconHome())
+	}
+	return cmd, nil
+}
+
 // watchChild watches a child process and restarts it on crash.
 func (pm *ProcessManager) watchChild(child *ChildProcess) {
 	defer pm.wg.Done()
+	defer close(child.exited)
 
 	for {
 		// Wait for the process to exit
-		err := child.Cmd.Wait()
+		ps, err := child.Process.Wait()
+		if err == nil && !ps.Success() {
+			err = &exec.ExitError{ProcessState: ps}
+		}
+		child.output.wait()
+		pm.mu.Lock()
+		child.alive = false
+		pm.mu.Unlock()
 
-		// Check if we're shutting down
+		// Check if we're shutting down or the project was stopped
 		select {
 		case <-pm.ctx.Done():
 			logger.Infof("Project %s exited during shutdown", child.ProjectID)
 			return
+		case <-child.stopped:
+			logger.Infof("Project %s stopped", child.ProjectID)
+			return
 		default:
 		}
 
 		// Child crashed or exited unexpectedly
 		exitCode := -1
-		if child.Cmd.ProcessState != nil {
-			exitCode = child.Cmd.ProcessState.ExitCode()
+		if ps != nil {
+			exitCode = ps.ExitCode()
 		}
-		logger.Infof("Project %s exited (code=%d, err=%v)", child.ProjectID, exitCode, err)
+		reason := exitReason(err, child.stderr.String())
+		logger.Infof("Project %s exited (code=%d, reason=%s)", child.ProjectID, exitCode, reason)
 
 		pm.mu.Lock()
-		child.Restarts++
+		child.ExitCode, child.ExitReason, child.ExitedAt = exitCode, reason, time.Now()
+		policy := child.Restart
+		// An agent that stayed up long enough starts over with a fresh restart count
+		if time.Since(child.StartedAt) >= policy.EffectiveResetAfter() {
+			child.Restarts = 0
+		}
+
+		if !policy.ShouldRestart(exitCode) {
+			child.Exited = true
+			pm.mu.Unlock()
+			logger.Infof("Project %s not restarted (restart policy %s)", child.ProjectID, policy.EffectivePolicy())
+			pm.appendEvent(EventStop, child.ProjectID, "agent exited: "+reason)
+			return
+		}
 
-		if child.Restarts > maxRestarts {
+		child.Restarts++
+		maxRestarts := policy.EffectiveMaxRestarts()
+		if maxRestarts >= 0 && child.Restarts > maxRestarts {
 			logger.Infof("Project %s exceeded max restarts (%d), giving up", child.ProjectID, maxRestarts)
 			child.Failed = true
 			pm.mu.Unlock()
+			pm.appendEvent(EventStop, child.ProjectID, fmt.Sprintf("agent failed after %d restarts: %s", maxRestarts, reason))
 			return
 		}
 
-		// Calculate backoff: 2^restarts seconds, capped at maxBackoff
-		backoff := time.Duration(1<<uint(child.Restarts)) * time.Second
-		if backoff > maxBackoff {
-			backoff = maxBackoff
-		}
+		backoff := policy.BackoffFor(child.Restarts)
 		pm.mu.Unlock()
 
-		logger.Infof("Restarting project %s in %v (attempt %d/%d)", child.ProjectID, backoff, child.Restarts, maxRestarts)
+		logger.Infof("Restarting project %s in %v (attempt %d)", child.ProjectID, backoff, child.Restarts)
 
 		// Wait for backoff
 		select {
 		case <-pm.ctx.Done():
 			return
+		case <-child.stopped:
+			return
 		case <-time.After(backoff):
 		}
 
@@ -207,16 +357,170 @@ func (pm *ProcessManager) watchChild(child *ChildProcess) {
 			pm.mu.Unlock()
 			return
 		}
-		logger.Infof("Restarted project %s (PID %d)", child.ProjectID, child.Cmd.Process.Pid)
+		logger.Infof("Restarted project %s (PID %d)", child.ProjectID, child.Process.Pid)
+		pm.mu.Unlock()
+
+		pm.appendEvent(EventRestart, child.ProjectID, fmt.Sprintf("project restarted (attempt %d)", child.Restarts))
+	}
+}
+
+// appendEvent records a child lifecycle event when an event log is attached.
+func (pm *ProcessManager) appendEvent(typ EventType, projectID, message string) {
+	if pm.eventLog == nil {
+		return
+	}
+	pm.eventLog.Append(Event{
+		Timestamp: time.Now(),
+		Type:      typ,
+		Child:     projectID,
+		Message:   message,
+	})
+}
+
+// exitReason describes why an agent exited: the wait error plus the panic or fatal error
+// line from its stderr, or else its last stderr line.
+func exitReason(err error, stderr string) string {
+	reason := "exited"
+	if err != nil {
+		reason = err.Error()
+	}
+	var last string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+			return reason + ": " + line
+		}
+		if line != "" {
+			last = line
+		}
+	}
+	if last != "" {
+		reason += ": " + last
+	}
+	return reason
+}
+
+// RestartAgent respawns a project's child agent with a fresh restart count. A failed or
+// exited agent is revived; a running one is stopped first.
+func (pm *ProcessManager) RestartAgent(projectID string) error {
+	pm.mu.RLock()
+	child, ok := pm.children[projectID]
+	var project identity.ProjectConfig
+	if ok {
+		project = identity.ProjectConfig{
+			ID:         child.ProjectID,
+			ConfigPath: child.ConfigPath,
+			Restart:    child.Restart,
+			Resources:  child.Resources,
+			RunAs:      child.RunAs,
+		}
+	}
+	pm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("project %s is not managed by the master", projectID)
+	}
+
+	if err := pm.Stop(projectID); err != nil {
+		return err
+	}
+	if err := pm.Spawn(project); err != nil {
+		return err
+	}
+	pm.appendEvent(EventRestart, projectID, "agent restarted on request")
+	return nil
+}
+
+// CheckRestartRequests restarts the agents of projects with a pending request from
+// `beacon projects agent-restart`.
+func (pm *ProcessManager) CheckRestartRequests() {
+	for projectID, reader := range pm.GetIPCReaders() {
+		req, err := reader.ReadAgentRestartRequest()
+		if err != nil {
+			logger.Infof("Project %s: %v", projectID, err)
+			continue
+		}
+		if req == nil {
+			continue
+		}
+		logger.Infof("Restarting agent of project %s (requested by %s)", projectID, req.RequestedBy)
+		if err := pm.RestartAgent(projectID); err != nil {
+			logger.Infof("Failed to restart agent of project %s: %v", projectID, err)
+		}
+	}
+}
+
+// Stop stops the child agent of a project and forgets it; it is not respawned.
+func (pm *ProcessManager) Stop(projectID string) error {
+	pm.mu.Lock()
+	child, ok := pm.children[projectID]
+	if !ok {
 		pm.mu.Unlock()
+		return fmt.Errorf("project %s is not running", projectID)
+	}
+	delete(pm.children, projectID)
+	close(child.stopped)
+	proc := child.Process
+	pm.mu.Unlock()
+
+	if proc != nil {
+		_ = proc.Signal(os.Interrupt)
+		select {
+		case <-child.exited:
+		case <-time.After(shutdownWait):
+			logger.Infof("Project %s did not stop in %s, killing", projectID, shutdownWait)
+			_ = proc.Kill()
+			<-child.exited
+		}
+	}
+	if child.IPC != nil {
+		_ = child.IPC.Close()
+	}
+	if child.log != nil {
+		_ = child.log.Close()
+	}
+	child.cgroup.remove()
+	return nil
+}
+
+// Reconcile makes the running children match projects: it spawns enabled projects that
+// are not running, stops children of removed or disabled projects and restarts children
+// whose config path changed.
+func (pm *ProcessManager) Reconcile(projects []identity.ProjectConfig) {
+	want := make(map[string]identity.ProjectConfig, len(projects))
+	for _, project := range projects {
+		if pm.isProjectEnabled(project) {
+			want[project.ID] = project
+		}
+	}
+
+	for id, child := range pm.GetChildren() {
+		project, ok := want[id]
+		switch {
+		case !ok:
+			logger.Infof("Project %s removed or disabled, stopping", id)
+		case project.ConfigPath != child.ConfigPath:
+			logger.Infof("Project %s config path changed, restarting", id)
+		case !reflect.DeepEqual(project.RunAs, child.RunAs):
+			logger.Infof("Project %s run_as changed, restarting", id)
+		case !reflect.DeepEqual(project.Resources, child.Resources) && !pm.updateResources(id, project.Resources):
+			logger.Infof("Project %s resource limits changed, restarting", id)
+		default:
+			delete(want, id) // unchanged; a new restart policy applies from the next exit
+			pm.mu.Lock()
+			if c := pm.children[id]; c != nil {
+				c.Restart = project.Restart
+			}
+			pm.mu.Unlock()
+			continue
+		}
+		if err := pm.Stop(id); err != nil {
+			logger.Infof("Failed to stop project %s: %v", id, err)
+		}
+	}
 
-		if pm.eventLog != nil {
-			pm.eventLog.Append(Event{
-				Timestamp: time.Now(),
-				Type:      EventRestart,
-				Child:     child.ProjectID,
-				Message:   fmt.Sprintf("project restarted (attempt %d)", child.Restarts),
-			})
+	for _, project := range want {
+		if err := pm.Spawn(project); err != nil {
+			logger.Infof("Failed to start project %s: %v", project.ID, err)
 		}
 	}
 }
@@ -231,7 +535,7 @@ func (pm *ProcessManager) Shutdown() {
 	pm.mu.RLock()
 	children := make([]*ChildProcess, 0, len(pm.children))
 	for _, child := range pm.children {
-		if child.Cmd != nil && child.Cmd.Process != nil {
+		if child.Process != nil && child.alive {
 			children = append(children, child)
 		}
 	}
@@ -239,8 +543,8 @@ func (pm *ProcessManager) Shutdown() {
 
 	// Send SIGTERM to all children
 	for _, child := range children {
-		logger.Infof("Stopping project %s (PID %d)", child.ProjectID, child.Cmd.Process.Pid)
-		_ = child.Cmd.Process.Signal(os.Interrupt)
+		logger.Infof("Stopping project %s (PID %d)", child.ProjectID, child.Process.Pid)
+		_ = child.Process.Signal(os.Interrupt)
 	}
 
 	// Wait for children with timeout
@@ -255,11 +559,23 @@ func (pm *ProcessManager) Shutdown() {
 		logger.Infof("All projects stopped gracefully")
 	case <-time.After(shutdownWait):
 		logger.Infof("Timeout waiting for projects to stop, forcing shutdown")
+		pm.mu.RLock()
 		for _, child := range children {
-			if child.Cmd.ProcessState == nil {
-				_ = child.Cmd.Process.Kill()
+			if child.alive {
+				_ = child.Process.Kill()
 			}
 		}
+		pm.mu.RUnlock()
+	}
+
+	for _, child := range pm.GetChildren() {
+		if child.IPC != nil {
+			_ = child.IPC.Close()
+		}
+		if child.log != nil {
+			_ = child.log.Close()
+		}
+		child.cgroup.remove()
 	}
 
 	// Cleanup IPC directories (optional - could keep for debugging)
@@ -280,9 +596,21 @@ func (pm *ProcessManager) GetChildren() map[string]*ChildProcess {
 			ProjectID:  v.ProjectID,
 			ConfigPath: v.ConfigPath,
 			IPCDir:     v.IPCDir,
+			IPC:        v.IPC,
 			StartedAt:  v.StartedAt,
+			Restart:    v.Restart,
 			Restarts:   v.Restarts,
 			Failed:     v.Failed,
+			Exited:     v.Exited,
+			ExitCode:   v.ExitCode,
+			ExitReason: v.ExitReason,
+			ExitedAt:   v.ExitedAt,
+
+			Resources:    v.Resources,
+			RunAs:        v.RunAs,
+			SandboxError: v.SandboxError,
+			cgroup:       v.cgroup,
+			log:          v.log,
 		}
 	}
 	return result
@@ -294,21 +622,91 @@ func (pm *ProcessManager) GetChildPIDs() map[string]int {
 	defer pm.mu.RUnlock()
 	pids := make(map[string]int, len(pm.children))
 	for id, child := range pm.children {
-		if child.Cmd != nil && child.Cmd.Process != nil && !child.Failed {
-			pids[id] = child.Cmd.Process.Pid
+		if child.Process != nil && child.Running() {
+			pids[id] = child.Process.Pid
 		}
 	}
 	return pids
 }
 
-// GetIPCReaders returns IPC readers for all children (for health aggregation).
+// GetIPCReaders returns IPC readers for all children (for health aggregation and commands).
 func (pm *ProcessManager) GetIPCReaders() map[string]*ipc.Reader {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
 	readers := make(map[string]*ipc.Reader, len(pm.children))
 	for projectID, child := range pm.children {
-		readers[projectID] = ipc.NewReader(child.IPCDir)
+		if child.IPC != nil {
+			readers[projectID] = child.IPC
+		} else {
+			readers[projectID] = ipc.NewReader(child.IPCDir)
+		}
 	}
 	return readers
 }
+
+// agentOutput is an agent's stdout and stderr pipes. The master keeps the read ends,
+// which a self-upgrade hands to the new master with the agent.
+type agentOutput struct {
+	stdout, stderr   *os.File // read ends
+	stdoutW, stderrW *os.File // write ends; closed once the agent has started
+	copying          sync.WaitGroup
+}
+
+func newAgentOutput() (*agentOutput, error) {
+	o := &agentOutput{}
+	var err error
+	if o.stdout, o.stdoutW, err = os.Pipe(); err != nil {
+		return nil, fmt.Errorf("create output pipe: %w", err)
+	}
+	if o.stderr, o.stderrW, err = os.Pipe(); err != nil {
+		o.close()
+		return nil, fmt.Errorf("create output pipe: %w", err)
+	}
+	return o, nil
+}
+
+// started closes the write ends the agent inherited.
+func (o *agentOutput) started() {
+	_ = o.stdoutW.Close()
+	_ = o.stderrW.Close()
+	o.stdoutW, o.stderrW = nil, nil
+}
+
+// copy copies the pipes to out and errOut until the agent closes them.
+func (o *agentOutput) copy(out, errOut io.Writer) {
+	o.copying.Add(2)
+	go func() {
+		defer o.copying.Done()
+		_, _ = io.Copy(out, o.stdout)
+	}()
+	go func() {
+		defer o.copying.Done()
+		_, _ = io.Copy(errOut, o.stderr)
+	}()
+}
+
+// wait waits up to childOutputWait for the output of an exited agent and closes the pipes.
+func (o *agentOutput) wait() {
+	if o == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		o.copying.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(childOutputWait):
+	}
+	o.close()
+}
+
+func (o *agentOutput) close() {
+	for _, f := range []*os.File{o.stdout, o.stderr, o.stdoutW, o.stderrW} {
+		if f != nil {
+			_ = f.Close()
+		}
+	}
+}
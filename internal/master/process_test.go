@@ -2,14 +2,31 @@ package master
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"beacon/internal/identity"
 )
 
+// TestMain lets the test binary stand in for a crashing child agent: spawned as
+// "agent ..." with BEACON_TEST_AGENT_EXIT set, it exits with that code.
+func TestMain(m *testing.M) {
+	if code := os.Getenv("BEACON_TEST_AGENT_EXIT"); code != "" && len(os.Args) > 1 && os.Args[1] == "agent" {
+		n, _ := strconv.Atoi(code)
+		if n != 0 {
+			fmt.Fprintln(os.Stderr, "panic: test agent crashed")
+		}
+		os.Exit(n)
+	}
+	os.Exit(m.Run())
+}
+
 func TestNewProcessManager(t *testing.T) {
 	ctx := context.Background()
 	pm, err := NewProcessManager(ctx)
@@ -220,3 +237,141 @@ checks: []
 		t.Error("reader for test-project not found")
 	}
 }
+
+func TestProcessManager_Reconcile(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	dir := t.TempDir()
+	config1 := filepath.Join(dir, "project1.yml")
+	config2 := filepath.Join(dir, "project2.yml")
+	for _, p := range []string{config1, config2} {
+		os.WriteFile(p, []byte("checks: []\n"), 0644)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pm, _ := NewProcessManager(ctx)
+	defer pm.Shutdown()
+
+	disabled := false
+	pm.Reconcile([]identity.ProjectConfig{
+		{ID: "project1", ConfigPath: config1},
+		{ID: "project2", ConfigPath: config2},
+		{ID: "project3", ConfigPath: config2, Enabled: &disabled},
+	})
+	if children := pm.GetChildren(); len(children) != 2 || children["project3"] != nil {
+		t.Fatalf("expected project1 and project2, got %v", children)
+	}
+
+	// project2 removed, project1 moved to another config
+	pm.Reconcile([]identity.ProjectConfig{{ID: "project1", ConfigPath: config2}})
+	children := pm.GetChildren()
+	if len(children) != 1 {
+		t.Fatalf("expected 1 child, got %d", len(children))
+	}
+	if children["project1"] == nil || children["project1"].ConfigPath != config2 {
+		t.Errorf("project1 not restarted with the new config: %+v", children["project1"])
+	}
+
+	if err := pm.Stop("project2"); err == nil {
+		t.Error("expected error stopping a project that is not running")
+	}
+}
+
+func waitForChild(t *testing.T, pm *ProcessManager, id string, cond func(*ChildProcess) bool) *ChildProcess {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if c := pm.GetChildren()[id]; c != nil && cond(c) {
+			return c
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("child %s did not reach the expected state: %+v", id, pm.GetChildren()[id])
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestProcessManager_RestartPolicy(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	t.Setenv("BEACON_TEST_AGENT_EXIT", "3")
+	configPath := filepath.Join(t.TempDir(), "monitor.yml")
+	os.WriteFile(configPath, []byte("checks: []\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pm, _ := NewProcessManager(ctx)
+	pm.eventLog = NewEventLog()
+	defer pm.Shutdown()
+
+	project := identity.ProjectConfig{
+		ID:         "crashy",
+		ConfigPath: configPath,
+		Restart:    &identity.RestartPolicy{Policy: identity.RestartOnFailure, MaxRestarts: 2, Backoff: time.Millisecond},
+	}
+	if err := pm.Spawn(project); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+
+	// Crashes are respawned until max_restarts, then the agent is failed
+	child := waitForChild(t, pm, "crashy", func(c *ChildProcess) bool { return c.Failed })
+	if child.Restarts != 3 {
+		t.Errorf("restarts = %d, want 3", child.Restarts)
+	}
+	if child.ExitCode != 3 || !strings.Contains(child.ExitReason, "panic: test agent crashed") {
+		t.Errorf("exit code %d, reason %q", child.ExitCode, child.ExitReason)
+	}
+	if pids := pm.GetChildPIDs(); len(pids) != 0 {
+		t.Errorf("failed child reported as running: %v", pids)
+	}
+
+	// A revived agent starts over; a clean exit is not restarted under on-failure
+	t.Setenv("BEACON_TEST_AGENT_EXIT", "0")
+	if err := pm.RestartAgent("crashy"); err != nil {
+		t.Fatalf("RestartAgent failed: %v", err)
+	}
+	child = waitForChild(t, pm, "crashy", func(c *ChildProcess) bool { return c.Exited })
+	if child.Failed || child.Restarts != 0 || child.ExitCode != 0 {
+		t.Errorf("after revive: failed=%v restarts=%d exit=%d", child.Failed, child.Restarts, child.ExitCode)
+	}
+
+	if err := pm.RestartAgent("unknown"); err == nil {
+		t.Error("expected error restarting an unmanaged project")
+	}
+}
+
+func TestProcessManager_SpawnRunAs(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+	t.Setenv("BEACON_HOME", t.TempDir())
+	t.Setenv("BEACON_TEST_AGENT_EXIT", "0")
+	configPath := filepath.Join(t.TempDir(), "monitor.yml")
+	os.WriteFile(configPath, []byte("checks: []\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pm, _ := NewProcessManager(ctx)
+	defer pm.Shutdown()
+
+	project := identity.ProjectConfig{
+		ID:         "sandboxed",
+		ConfigPath: configPath,
+		Restart:    &identity.RestartPolicy{Policy: identity.RestartNever},
+		RunAs:      &identity.RunAs{User: current.Username},
+	}
+	if err := pm.Spawn(project); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	child := waitForChild(t, pm, "sandboxed", func(c *ChildProcess) bool { return c.Exited })
+	if child.ExitCode != 0 || child.RunAs == nil {
+		t.Errorf("exit code %d, run_as %+v", child.ExitCode, child.RunAs)
+	}
+
+	project.ID = "bad-user"
+	project.RunAs = &identity.RunAs{User: "beacon-no-such-user"}
+	if err := pm.Spawn(project); err == nil {
+		t.Error("expected Spawn to fail for an unknown run_as user")
+	}
+}
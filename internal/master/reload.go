@@ -0,0 +1,229 @@
+package master
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"beacon/internal/identity"
+	"beacon/internal/logging"
+	"beacon/internal/tunnel"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDebounce collapses the burst of events an editor or an atomic save produces.
+const configReloadDebounce = 500 * time.Millisecond
+
+// configReloader applies edits of ~/.beacon/config.yaml to the running master without a
+// restart: projects, tunnels, VPN, allowed remote commands, the status server address,
+// the heartbeat interval and the log level. It runs on Run's goroutine.
+type configReloader struct {
+	ctx         context.Context
+	pm          *ProcessManager
+	tm          *tunnel.TunnelManager
+	dispatcher  *CommandDispatcher
+	statusCache *StatusCache
+	beat        *heartbeatLoop
+	ticker      *time.Ticker
+	eventLog    *EventLog
+
+	interval    time.Duration
+	port        int
+	listenAddr  string
+	status      *StatusServer // nil in tests
+	stopStatus  func()
+	vpnKey      string                // cloud endpoint, API key and device the VPN manager was built with
+	childLogEnv bool                  // BEACON_LOG_LEVEL came from the environment; children keep it
+	masterLog   *logging.RotatingFile // may be nil
+	control     *controlServer        // may be nil
+	upgrading   atomic.Bool           // a self-upgrade is being handed over or verified
+}
+
+// reload re-reads config.yaml and reconciles the master with it. A config that fails to
+// load leaves everything as it is.
+func (r *configReloader) reload(reason string) {
+	uc, err := identity.LoadUserConfig()
+	if err != nil {
+		logger.Infof("Config reload (%s): %v; keeping the current config", reason, err)
+		return
+	}
+	if uc == nil {
+		logger.Infof("Config reload (%s): config.yaml not found; keeping the current config", reason)
+		return
+	}
+	logger.Infof("Reloading config (%s)", reason)
+
+	r.applyLogLevel(uc.LogLevel)
+	logOpts := logRotateOptions(uc.Logs)
+	if r.masterLog != nil {
+		r.masterLog.SetOptions(logOpts)
+	}
+	r.statusCache.UpdateConfig(uc)
+	r.dispatcher.SetAllowedActions(uc.AllowedRemoteCommands)
+	if r.control != nil {
+		r.control.setToken(uc.ControlToken)
+	}
+	if r.pm != nil {
+		r.pm.SetLogOptions(logOpts)
+		r.pm.Reconcile(uc.Projects)
+	}
+	if r.tm != nil {
+		reconcileTunnels(r.tm, uc)
+	}
+	r.reconcileVPN(uc)
+	r.applyStatusServer(uc)
+	if d := uc.HeartbeatIntervalDuration(); d != r.interval {
+		logger.Infof("Heartbeat interval %s -> %s", r.interval, d)
+		r.interval = d
+		r.ticker.Reset(d)
+	}
+	r.statusCache.Refresh()
+
+	r.eventLog.Append(Event{
+		Timestamp: time.Now(),
+		Type:      EventConfig,
+		Message:   "config reloaded (" + reason + ")",
+	})
+}
+
+// applyLogLevel sets the master's level and the level inherited by children spawned later.
+func (r *configReloader) applyLogLevel(level string) {
+	if level == "" {
+		logging.SetLevel("info")
+		if !r.childLogEnv {
+			_ = os.Unsetenv("BEACON_LOG_LEVEL")
+		}
+		return
+	}
+	logging.SetLevel(level)
+	if !r.childLogEnv {
+		_ = os.Setenv("BEACON_LOG_LEVEL", level)
+	}
+}
+
+// reconcileVPN rebuilds the VPN manager when cloud access changed and reconciles it with
+// the VPN config.
+func (r *configReloader) reconcileVPN(uc *identity.UserConfig) {
+	if key := vpnManagerKey(uc); key != r.vpnKey {
+		if r.beat.vm != nil {
+			r.beat.vm.Stop()
+		}
+		r.beat.vm = initVPNManager(r.ctx, uc)
+		r.statusCache.SetVPNManager(r.beat.vm)
+		r.vpnKey = key
+	}
+	if r.beat.vm != nil {
+		if err := r.beat.vm.Reconcile(r.ctx, uc.VPN); err != nil {
+			logger.Infof("VPN reconcile: %v", err)
+		}
+	}
+}
+
+// applyStatusServer restarts the status server when its port or listen address changed.
+func (r *configReloader) applyStatusServer(uc *identity.UserConfig) {
+	port, listenAddr := statusServerAddr(uc)
+	if port == r.port && listenAddr == r.listenAddr {
+		return
+	}
+	logger.Infof("Status server moving to %s:%d", listenAddrOrDefault(listenAddr), port)
+	r.stopStatus()
+	r.status, r.stopStatus = startStatusServer(r.ctx, r.statusCache, port, listenAddr, r.control.httpHandler(), nil)
+	r.port, r.listenAddr = port, listenAddr
+}
+
+// statusServerAddr returns the status server port and listen address configured in uc.
+func statusServerAddr(uc *identity.UserConfig) (int, string) {
+	port := defaultMetricsPort
+	if uc != nil && uc.MetricsPort > 0 {
+		port = uc.MetricsPort
+	}
+	if uc == nil {
+		return port, ""
+	}
+	return port, uc.MetricsListenAddr
+}
+
+func listenAddrOrDefault(addr string) string {
+	if addr == "" {
+		return defaultListenAddr
+	}
+	return addr
+}
+
+// vpnManagerKey identifies the cloud access a VPN manager is built with; "" when
+// initVPNManager would not build one.
+func vpnManagerKey(uc *identity.UserConfig) string {
+	if uc == nil || !uc.CloudReportingEnabled || strings.TrimSpace(uc.APIKey) == "" {
+		return ""
+	}
+	return strings.Join([]string{uc.EffectiveCloudAPIBase(), strings.TrimSpace(uc.APIKey), strings.TrimSpace(uc.DeviceName)}, "\x00")
+}
+
+// reconcileTunnels starts and stops tunnels to match uc. Tunnels only run with cloud
+// reporting enabled and an API key.
+func reconcileTunnels(tm *tunnel.TunnelManager, uc *identity.UserConfig) {
+	apiKey := strings.TrimSpace(uc.APIKey)
+	if !uc.CloudReportingEnabled {
+		apiKey = ""
+	}
+	deviceName := strings.TrimSpace(uc.DeviceName)
+	if deviceName == "" {
+		deviceName = getHostname()
+	}
+	tm.Reconcile(uc.Tunnels, uc.EffectiveCloudAPIBase(), apiKey, deviceName)
+	if len(uc.Tunnels) > 0 {
+		logger.Infof("Tunnels: %d/%d active", len(tm.GetTunnelStatuses()), len(uc.Tunnels))
+	}
+}
+
+// watchUserConfig signals on the returned channel when config.yaml changes. The directory
+// is watched so that editors and atomic saves that replace the file are seen.
+func watchUserConfig(ctx context.Context) (<-chan struct{}, error) {
+	path, err := identity.UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer watcher.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == path && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					debounce = time.After(configReloadDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Infof("Config watcher error: %v", err)
+			case <-debounce:
+				debounce = nil
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
@@ -0,0 +1,108 @@
+package master
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"beacon/internal/identity"
+	"beacon/internal/logging"
+
+	"github.com/stretchr/testify/require"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestConfigReloader_reload(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	t.Setenv("BEACON_LOG_LEVEL", "")
+	t.Cleanup(func() { logging.SetLevel("info") })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	eventLog := NewEventLog()
+	statusCache := NewStatusCache(nil, eventLog, nil)
+	r := &configReloader{
+		ctx:         ctx,
+		dispatcher:  NewCommandDispatcher(nil, nil),
+		statusCache: statusCache,
+		beat:        &heartbeatLoop{},
+		ticker:      ticker,
+		eventLog:    eventLog,
+		interval:    time.Minute,
+		port:        defaultMetricsPort,
+		stopStatus:  func() {},
+	}
+
+	// A missing config changes nothing
+	r.reload("test")
+	require.Empty(t, eventLog.Recent())
+
+	port := freePort(t)
+	cfg := &identity.UserConfig{
+		DeviceName:            "test-device",
+		HeartbeatInterval:     5,
+		MetricsPort:           port,
+		LogLevel:              "debug",
+		AllowedRemoteCommands: []string{"health_check"},
+	}
+	require.NoError(t, cfg.Save())
+	r.reload("test")
+	defer r.stopStatus()
+
+	require.True(t, r.dispatcher.isAllowed("health_check"))
+	require.False(t, r.dispatcher.isAllowed("restart"))
+	require.Equal(t, 5*time.Second, r.interval)
+	require.Equal(t, "debug", os.Getenv("BEACON_LOG_LEVEL"))
+	require.Nil(t, r.beat.vm, "no VPN manager without cloud reporting")
+
+	// The status server moved to the new port
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/health", port))
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond)
+
+	events := eventLog.Recent()
+	require.Len(t, events, 1)
+	require.Equal(t, EventConfig, events[0].Type)
+}
+
+func TestWatchUserConfig(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	cfg := &identity.UserConfig{DeviceName: "test-device"}
+	require.NoError(t, cfg.Save())
+
+	changes, err := watchUserConfig(t.Context())
+	require.NoError(t, err)
+
+	cfg.HeartbeatInterval = 30
+	require.NoError(t, cfg.Save())
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change not signalled")
+	}
+
+	// One signal per burst of writes
+	select {
+	case <-changes:
+		t.Fatal("unexpected second signal")
+	case <-time.After(2 * configReloadDebounce):
+	}
+}
@@ -9,13 +9,17 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"beacon/internal/cloud"
+	"beacon/internal/control"
 	"beacon/internal/identity"
 	"beacon/internal/logging"
+	"beacon/internal/state"
 	"beacon/internal/tunnel"
 	"beacon/internal/version"
 	"beacon/internal/vpn"
@@ -129,6 +133,18 @@ func getOutboundIP() string {
 // Run blocks until ctx is canceled. Reads ~/.beacon/config.yaml (v2 identity).
 // Spawns child agents for configured projects and sends heartbeats to the cloud.
 func Run(ctx context.Context) {
+	// A self-upgrade hands over agents and listeners; a fresh start first rolls back an
+	// upgrade whose new master died
+	handoff, err := takeHandoff()
+	if err != nil {
+		logger.Infof("Self-upgrade handoff: %v; starting fresh", err)
+	}
+	if handoff == nil {
+		recoverUpgrade()
+	} else if handoff.Watchdog > 0 {
+		reapWatchdog(handoff.Watchdog)
+	}
+
 	uc, err := identity.LoadUserConfig()
 	if err != nil {
 		logger.Infof("Failed to load config: %v", err)
@@ -142,6 +158,7 @@ func Run(ctx context.Context) {
 			uc, _ = identity.LoadUserConfig()
 		}
 	}
+	childLogEnv := os.Getenv("BEACON_LOG_LEVEL") != ""
 	if uc != nil && uc.LogLevel != "" {
 		logging.SetLevel(uc.LogLevel)
 		// Propagate to spawned children via env inheritance (only if env var not already set).
@@ -153,33 +170,85 @@ func Run(ctx context.Context) {
 	if uc != nil {
 		interval = uc.HeartbeatIntervalDuration()
 	}
+	var logCfg *identity.LogConfig
+	if uc != nil {
+		logCfg = uc.Logs
+	}
+	masterLog := openMasterLog(logRotateOptions(logCfg))
+	if masterLog != nil {
+		defer func() {
+			logging.SetOutput(nil)
+			_ = masterLog.Close()
+		}()
+	}
 
 	pm, err := NewProcessManager(ctx)
 	if err != nil {
 		logger.Infof("Failed to create process manager: %v", err)
+	} else {
+		pm.SetLogOptions(logRotateOptions(logCfg))
 	}
 
 	eventLog := NewEventLog()
+	if path, err := EventStorePath(); err != nil {
+		logger.Infof("Event store disabled: %v", err)
+	} else if store, err := OpenEventStore(path); err != nil {
+		logger.Infof("Event store disabled: %v", err)
+	} else {
+		eventLog.Persist(store)
+		defer func() { _ = eventLog.Close() }()
+	}
+	eventLog.Append(Event{
+		Timestamp: time.Now(),
+		Type:      EventStart,
+		Message:   fmt.Sprintf("master started (version %s, PID %d)", version.GetVersion(), os.Getpid()),
+	})
 	if pm != nil {
 		pm.eventLog = eventLog
 	}
-
-	port := defaultMetricsPort
-	if uc != nil && uc.MetricsPort > 0 {
-		port = uc.MetricsPort
-	}
-	listenAddr := ""
-	if uc != nil {
-		listenAddr = uc.MetricsListenAddr
+	switch {
+	case handoff == nil:
+	case handoff.Reason == handoffRollback:
+		eventLog.Append(Event{
+			Timestamp: time.Now(),
+			Type:      EventUpgrade,
+			Message:   fmt.Sprintf("rolled back from %s: %s", handoff.From, handoff.Error),
+		})
+	default:
+		logger.Infof("Took over from %s; checking health within %s", handoff.From, upgradeSettle+upgradeGrace)
+	}
+
+	port, listenAddr := statusServerAddr(uc)
+	var statusLn net.Listener
+	if handoff != nil {
+		if statusLn, err = inheritListener(handoff.StatusFD, "status server"); err != nil {
+			logger.Infof("%v", err)
+		} else if a, ok := statusLn.(*net.TCPListener); ok && a.Addr().(*net.TCPAddr).Port != port {
+			_ = statusLn.Close() // the port changed in config.yaml meanwhile
+			statusLn = nil
+		}
 	}
 
 	statusCache := NewStatusCache(pm, eventLog, uc)
 	statusCache.Refresh()
 
-	startStatusServer(ctx, statusCache, port, listenAddr)
+	// Wired up below; it serves nothing before its token is set or the socket is up
+	ctl := newControlServer(pm, eventLog, statusCache)
+
+	statusServer, stopStatus := startStatusServer(ctx, statusCache, port, listenAddr, ctl.httpHandler(), statusLn)
 	startCacheRefresh(ctx, statusCache)
 
-	if pm != nil && uc != nil && len(uc.Projects) > 0 {
+	if pm != nil {
+		startRestartRequestWatch(ctx, pm)
+	}
+
+	switch {
+	case pm != nil && handoff != nil:
+		pm.Adopt(handoff.Children)
+		if uc != nil {
+			pm.Reconcile(uc.Projects)
+		}
+	case pm != nil && uc != nil && len(uc.Projects) > 0:
 		logger.Infof("Spawning %d project(s)...", len(uc.Projects))
 		pm.SpawnAll(uc.Projects)
 	}
@@ -191,6 +260,10 @@ func Run(ctx context.Context) {
 	statusCache.SetVPNManager(vm)
 
 	dispatcher := NewCommandDispatcher(pm, tm)
+	dispatcher.eventLog = eventLog
+	if uc != nil {
+		dispatcher.SetAllowedActions(uc.AllowedRemoteCommands)
+	}
 	startAgentControl(ctx, uc, dispatcher)
 
 	ticker := time.NewTicker(interval)
@@ -208,6 +281,55 @@ func Run(ctx context.Context) {
 		eventLog:    eventLog,
 	}
 
+	reloader := &configReloader{
+		ctx:         ctx,
+		pm:          pm,
+		tm:          tm,
+		dispatcher:  dispatcher,
+		statusCache: statusCache,
+		beat:        beat,
+		ticker:      ticker,
+		eventLog:    eventLog,
+		interval:    interval,
+		port:        port,
+		listenAddr:  listenAddr,
+		status:      statusServer,
+		stopStatus:  stopStatus,
+		vpnKey:      vpnManagerKey(uc),
+		childLogEnv: childLogEnv,
+		masterLog:   masterLog,
+		control:     ctl,
+	}
+	ctl.dispatcher, ctl.reloader = dispatcher, reloader
+	if uc != nil {
+		ctl.setToken(uc.ControlToken)
+	}
+	if path, err := control.SocketPath(); err == nil {
+		var ln net.Listener
+		if handoff != nil {
+			if ln, err = inheritListener(handoff.ControlFD, "control socket"); err != nil {
+				logger.Infof("%v", err)
+			}
+		}
+		if ln != nil {
+			ctl.serve(ctx, ln, path)
+		} else if err := ctl.listen(ctx, path); err != nil {
+			logger.Infof("Control socket disabled: %v", err)
+		}
+	}
+	if handoff != nil && handoff.Reason == handoffUpgrade {
+		reloader.upgrading.Store(true)
+		go reloader.verifyUpgrade(ctx, handoff)
+	}
+
+	configChanged, err := watchUserConfig(ctx)
+	if err != nil {
+		logger.Infof("Config file watch disabled: %v (send SIGHUP to reload)", err)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
 	if uc != nil && uc.CloudReportingEnabled {
 		beat.tryBeat()
 	}
@@ -216,8 +338,15 @@ func Run(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			logger.Infof("Stopping")
-			if vm != nil {
-				vm.Stop()
+			eventLog.Append(Event{Timestamp: time.Now(), Type: EventStop, Message: "master stopping"})
+			if beat.vm != nil {
+				beat.vm.Stop()
+			}
+			if beat.backfiller != nil {
+				beat.backfiller.Wait()
+			}
+			if beat.spool != nil {
+				_ = beat.spool.Close()
 			}
 			if tm != nil {
 				tm.Shutdown()
@@ -228,22 +357,39 @@ func Run(ctx context.Context) {
 			return
 		case <-ticker.C:
 			beat.tryBeat()
+		case <-configChanged:
+			reloader.reload("config.yaml changed")
+		case <-hup:
+			reloader.reload("SIGHUP")
+		case task := <-ctl.tasks:
+			task()
 		}
 	}
 }
 
-func startStatusServer(ctx context.Context, cache *StatusCache, port int, listenAddr string) {
-	var srv *StatusServer
+// startStatusServer serves the dashboard until ctx ends or the returned stop is called;
+// stop returns once the listener is closed. inherited, if not nil, is the listener a
+// previous master handed over.
+func startStatusServer(ctx context.Context, cache *StatusCache, port int, listenAddr string, control http.Handler, inherited net.Listener) (srv *StatusServer, stop func()) {
 	if listenAddr != "" {
 		srv = NewStatusServerWithAddr(cache, port, listenAddr)
 	} else {
 		srv = NewStatusServer(cache, port)
 	}
+	srv.control = control
+	srv.inherited = inherited
+	srvCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
 	go func() {
-		if err := srv.Start(ctx); err != nil && ctx.Err() == nil {
+		defer close(done)
+		if err := srv.Start(srvCtx); err != nil && srvCtx.Err() == nil {
 			logger.Infof("Status server: %v", err)
 		}
 	}()
+	return srv, func() {
+		cancel()
+		<-done
+	}
 }
 
 func startCacheRefresh(ctx context.Context, cache *StatusCache) {
@@ -261,6 +407,23 @@ func startCacheRefresh(ctx context.Context, cache *StatusCache) {
 	}()
 }
 
+// startRestartRequestWatch serves `beacon projects agent-restart` requests left in the
+// projects' IPC directories.
+func startRestartRequestWatch(ctx context.Context, pm *ProcessManager) {
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				pm.CheckRestartRequests()
+			}
+		}
+	}()
+}
+
 // vpnCloudAdapter adapts cloud.VPNClient to the vpn.PeerResolver interface.
 // The two packages can't import each other directly (cycle via identity), so the
 // adapter lives in master where both are already imported.
@@ -306,37 +469,17 @@ func initVPNManager(_ context.Context, uc *identity.UserConfig) *vpn.Manager {
 	return vpn.NewManager(&vpnCloudAdapter{c: client})
 }
 
-// initTunnelManager creates and auto-starts enabled tunnels if cloud reporting is configured.
+// initTunnelManager creates the tunnel manager and starts enabled tunnels if cloud
+// reporting is configured. Tunnels added to the config later are started on reload.
 func initTunnelManager(ctx context.Context, uc *identity.UserConfig) *tunnel.TunnelManager {
-	if uc == nil || len(uc.Tunnels) == 0 || !uc.CloudReportingEnabled || strings.TrimSpace(uc.APIKey) == "" {
-		return nil
-	}
 	tm, err := tunnel.NewTunnelManager(ctx)
 	if err != nil {
 		logger.Infof("Failed to create tunnel manager: %v", err)
 		return nil
 	}
-	apiKey := strings.TrimSpace(uc.APIKey)
-	deviceName := strings.TrimSpace(uc.DeviceName)
-	if deviceName == "" {
-		deviceName = getHostname()
-	}
-	started := 0
-	for _, t := range uc.Tunnels {
-		if !tunnel.ConfigTunnelEnabled(t) {
-			continue
-		}
-		if started >= tunnel.MaxActiveTunnels {
-			logger.Infof("Tunnel %s skipped (limit: %d active tunnels)", t.ID, tunnel.MaxActiveTunnels)
-			continue
-		}
-		if err := tm.EnsureStarted(t, uc.EffectiveCloudAPIBase(), apiKey, deviceName); err != nil {
-			logger.Infof("Tunnel %s failed to start: %v", t.ID, err)
-		} else {
-			started++
-		}
+	if uc != nil {
+		reconcileTunnels(tm, uc)
 	}
-	logger.Infof("Tunnel manager started (%d/%d tunnel(s) active)", started, len(uc.Tunnels))
 	return tm
 }
 
@@ -350,8 +493,24 @@ type heartbeatLoop struct {
 	statusCache             *StatusCache
 	eventLog                *EventLog
 	lastSystemMetricsSentAt time.Time
+	syncState               syncState
+
+	// Reports the cloud did not receive, backfilled when it is reachable again
+	spool        *state.Spool // nil until opened
+	spoolEnabled bool
+	spoolErr     bool              // opening failed; logged once
+	backfiller   *cloud.Backfiller // nil until the first backfill
 }
 
+// syncState is the outcome of the last cloud heartbeat.
+type syncState int
+
+const (
+	syncUnknown syncState = iota
+	syncOK
+	syncFailing
+)
+
 func (h *heartbeatLoop) tryBeat() {
 	uc, err := identity.LoadUserConfig()
 	if err != nil {
@@ -370,6 +529,7 @@ func (h *heartbeatLoop) tryBeat() {
 	}
 
 	h.statusCache.UpdateConfig(uc)
+	h.applySpool(uc)
 	h.dispatcher.SetAllowedActions(uc.AllowedRemoteCommands)
 	h.dispatcher.CollectResults()
 
@@ -381,16 +541,35 @@ func (h *heartbeatLoop) tryBeat() {
 		}
 	}
 
-	if err := sendCloudHeartbeat(h.ctx, h, uc, name, h.pm, h.dispatcher, h.tm); err != nil {
+	err = sendCloudHeartbeat(h.ctx, h, uc, name, h.pm, h.dispatcher, h.tm)
+	if err != nil {
 		logger.Infof("Heartbeat: %v", err)
 	} else {
 		h.statusCache.UpdateCloudSync()
+	}
+	// Only changes are recorded, so a heartbeat every minute does not flood the event log
+	if failed := err != nil; h.syncState == syncUnknown || failed != (h.syncState == syncFailing) {
+		msg := "cloud heartbeat OK"
+		h.syncState = syncOK
+		if failed {
+			msg = "cloud heartbeat failed: " + err.Error()
+			if h.spool != nil && h.spoolEnabled {
+				msg += " (reports are spooled for backfill)"
+			}
+			h.syncState = syncFailing
+		}
 		h.eventLog.Append(Event{
 			Timestamp: time.Now(),
 			Type:      EventSync,
-			Message:   "cloud heartbeat OK",
+			Message:   msg,
 		})
 	}
+	if err == nil {
+		h.backfill(uc, name)
+	}
+	if h.spool != nil {
+		h.statusCache.SetCloudBacklog(h.spool.Pending())
+	}
 }
 
 func buildVPNHeartbeatReport(vm *vpn.Manager) *vpnHeartbeatReport {
@@ -470,11 +649,13 @@ func sendCloudHeartbeat(ctx context.Context, h *heartbeatLoop, cfg *identity.Use
 	client := &http.Client{Timeout: 45 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
+		h.spoolHeartbeat(payload)
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		h.spoolHeartbeat(payload)
 		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
 	}
 	if h != nil && payload.SystemMetrics != nil {
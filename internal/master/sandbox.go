@@ -0,0 +1,205 @@
+package master
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"beacon/internal/identity"
+	"beacon/internal/ipc"
+)
+
+// defaultChildPath is PATH for a run_as child when the master has none.
+const defaultChildPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// ResourceUsage is a project's cgroup accounting, reported in /api/status and /metrics.
+type ResourceUsage struct {
+	MemoryBytes    int64   `json:"memory_bytes"`
+	MemoryMaxBytes int64   `json:"memory_max_bytes,omitempty"` // 0 = unlimited
+	CPUSeconds     float64 `json:"cpu_seconds"`
+	PIDs           int64   `json:"pids"`
+	PidsMax        int64   `json:"pids_max,omitempty"` // 0 = unlimited
+	OOMKills       int64   `json:"oom_kills,omitempty"`
+}
+
+// runAsUser is a resolved projects[].run_as.
+type runAsUser struct {
+	name     string
+	uid, gid uint32
+	home     string
+	env      []string // variables passed through from the master
+}
+
+// resolveRunAs looks up the user and group of a run_as block. Switching to another user
+// requires the master to run as root.
+func resolveRunAs(r *identity.RunAs) (*runAsUser, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	u, err := user.Lookup(strings.TrimSpace(r.User))
+	if err != nil {
+		return nil, fmt.Errorf("run_as: %w", err)
+	}
+	gid := u.Gid
+	if r.Group != "" {
+		g, err := user.LookupGroup(strings.TrimSpace(r.Group))
+		if err != nil {
+			return nil, fmt.Errorf("run_as: %w", err)
+		}
+		gid = g.Gid
+	}
+	uidN, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("run_as: user %s has non-numeric uid %q", u.Username, u.Uid)
+	}
+	gidN, err := strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("run_as: group has non-numeric gid %q", gid)
+	}
+	if euid := os.Geteuid(); euid != 0 && uint64(euid) != uidN {
+		return nil, fmt.Errorf("run_as: switching to user %s requires the master to run as root", u.Username)
+	}
+	return &runAsUser{name: u.Username, uid: uint32(uidN), gid: uint32(gidN), home: u.HomeDir, env: r.Env}, nil
+}
+
+// environ returns the child's restricted environment: the user's identity, PATH, locale
+// and time zone, the BEACON_* variables (BEACON_HOME pinned to the master's) and the
+// variables listed in run_as.env.
+func (u *runAsUser) environ(beaconHome string) []string {
+	keep := map[string]bool{"PATH": true, "LANG": true, "LC_ALL": true, "TZ": true}
+	for _, k := range u.env {
+		keep[strings.TrimSpace(k)] = true
+	}
+	env := []string{"HOME=" + u.home, "USER=" + u.name, "LOGNAME=" + u.name, "BEACON_HOME=" + beaconHome}
+	hasPath := false
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		switch {
+		case k == "HOME" || k == "USER" || k == "LOGNAME" || k == "BEACON_HOME":
+			continue
+		case keep[k] || strings.HasPrefix(k, "BEACON_"):
+			env = append(env, kv)
+			hasPath = hasPath || k == "PATH"
+		}
+	}
+	if !hasPath {
+		env = append(env, "PATH="+defaultChildPath)
+	}
+	return env
+}
+
+// grant lets the run_as user connect to the project's socket and write its state. The
+// IPC directory stays owned by the master, which writes files there as root, so the
+// child talks to the master over the socket only. A directory handed to the user by an
+// earlier version is taken back.
+func (u *runAsUser) grant(beaconHome, ipcDir string) error {
+	stateDir := filepath.Join(beaconHome, "state", filepath.Base(ipcDir))
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	if err := os.Lchown(ipcDir, os.Geteuid(), os.Getegid()); err != nil {
+		return fmt.Errorf("run_as: %w", err)
+	}
+	for _, path := range []string{ipc.SocketPath(ipcDir), stateDir} {
+		if err := os.Lchown(path, int(u.uid), int(u.gid)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("run_as: %w", err)
+		}
+	}
+	return nil
+}
+
+// prepareSandbox resolves the child's run_as user and, when it has resource limits,
+// creates its cgroup. Projects without limits do not set up cgroups themselves. A
+// run_as or limits config that cannot be honoured fails the spawn; cgroups being
+// unavailable only leaves the limits unenforced (recorded in SandboxError).
+func (pm *ProcessManager) prepareSandbox(child *ChildProcess) error {
+	if err := child.Resources.Validate(); err != nil {
+		return err
+	}
+	if child.RunAs != nil {
+		u, err := resolveRunAs(child.RunAs)
+		if err != nil {
+			return err
+		}
+		if err := u.grant(pm.beaconHome(), child.IPCDir); err != nil {
+			return err
+		}
+		child.runAs = u
+	}
+	if child.IPC != nil {
+		child.IPC.SetSocketOnly(child.runAs != nil)
+	}
+
+	if child.Resources.IsZero() {
+		// Only placed in a cgroup of its own, for its usage, once another project's
+		// limits have set up the parent
+		if pm.cgroups.ready() {
+			if cg, err := pm.cgroups.create(child.ProjectID); err == nil && cg.apply(nil) == nil {
+				child.cgroup = cg
+			}
+		}
+		return nil
+	}
+	cg, err := pm.cgroups.create(child.ProjectID)
+	if err != nil {
+		child.SandboxError = "resource limits not applied: " + err.Error()
+		logger.Infof("Project %s: %s", child.ProjectID, child.SandboxError)
+		return nil
+	}
+	if err := cg.apply(child.Resources); err != nil {
+		child.SandboxError = "resource limits not applied: " + err.Error()
+		logger.Infof("Project %s: %s", child.ProjectID, child.SandboxError)
+	}
+	child.cgroup = cg
+	return nil
+}
+
+// updateResources applies new limits to a running child's cgroup. It reports false when
+// the child has no cgroup (it had no limits) and must be restarted instead.
+func (pm *ProcessManager) updateResources(projectID string, limits *identity.ResourceLimits) bool {
+	if err := limits.Validate(); err != nil {
+		logger.Infof("Project %s: %v; keeping the current limits", projectID, err)
+		return true
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	child := pm.children[projectID]
+	if child == nil || child.cgroup == nil {
+		return false
+	}
+	child.Resources = limits
+	child.SandboxError = ""
+	if err := child.cgroup.apply(limits); err != nil {
+		child.SandboxError = "resource limits not applied: " + err.Error()
+		logger.Infof("Project %s: %s", projectID, child.SandboxError)
+	}
+	return true
+}
+
+// ResourceUsage returns the cgroup accounting of each child: its project cgroup, else
+// the cgroup it runs in unless that is shared with the master.
+func (pm *ProcessManager) ResourceUsage() map[string]*ResourceUsage {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	usage := make(map[string]*ResourceUsage)
+	for id, child := range pm.children {
+		cg := child.cgroup
+		if cg == nil && child.alive && child.Process != nil {
+			cg = ownCgroup(child.Process.Pid)
+		}
+		if cg == nil {
+			continue
+		}
+		if u := cg.usage(); u != nil {
+			usage[id] = u
+		}
+	}
+	return usage
+}
+
+func (pm *ProcessManager) beaconHome() string {
+	return filepath.Dir(pm.ipcBase)
+}
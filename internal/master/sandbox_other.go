@@ -0,0 +1,12 @@
+//go:build !unix
+
+package master
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setCredential(attr *syscall.SysProcAttr, u *runAsUser) error {
+	return errors.New("run_as is only supported on Linux and macOS")
+}
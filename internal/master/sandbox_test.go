@@ -0,0 +1,54 @@
+package master
+
+import (
+	"os/user"
+	"slices"
+	"testing"
+
+	"beacon/internal/identity"
+)
+
+func TestRunAsUser_environ(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin:/bin")
+	t.Setenv("BEACON_LOG_LEVEL", "debug")
+	t.Setenv("BEACON_HOME", "/elsewhere")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("DOCKER_HOST", "unix:///run/docker.sock")
+
+	u := &runAsUser{name: "web", home: "/home/web", env: []string{"DOCKER_HOST"}}
+	env := u.environ("/var/lib/beacon")
+	for _, want := range []string{
+		"HOME=/home/web", "USER=web", "LOGNAME=web", "BEACON_HOME=/var/lib/beacon",
+		"PATH=/usr/bin:/bin", "BEACON_LOG_LEVEL=debug", "DOCKER_HOST=unix:///run/docker.sock",
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("environment lacks %s: %v", want, env)
+		}
+	}
+	for _, kv := range env {
+		if kv == "AWS_SECRET_ACCESS_KEY=secret" || kv == "BEACON_HOME=/elsewhere" {
+			t.Errorf("environment leaks %s", kv)
+		}
+	}
+}
+
+func TestResolveRunAs(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+	u, err := resolveRunAs(&identity.RunAs{User: current.Username})
+	if err != nil {
+		t.Fatalf("resolveRunAs(%s) failed: %v", current.Username, err)
+	}
+	if u.name != current.Username || u.home != current.HomeDir {
+		t.Errorf("resolved %+v", u)
+	}
+
+	if _, err := resolveRunAs(&identity.RunAs{User: "beacon-no-such-user"}); err == nil {
+		t.Error("expected error for an unknown user")
+	}
+	if _, err := resolveRunAs(&identity.RunAs{}); err == nil {
+		t.Error("expected error without a user")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package master
+
+import (
+	"os"
+	"syscall"
+)
+
+// setCredential makes the child run as the run_as user and group, without the master's
+// supplementary groups (dropping them needs root; a non-root master can only run_as itself).
+func setCredential(attr *syscall.SysProcAttr, u *runAsUser) error {
+	attr.Credential = &syscall.Credential{Uid: u.uid, Gid: u.gid, Groups: []uint32{}, NoSetGroups: os.Geteuid() != 0}
+	return nil
+}
@@ -1,19 +1,29 @@
 package master
 
 import (
+	"cmp"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"beacon/internal/cloud"
+	"beacon/internal/config"
 	"beacon/internal/identity"
 	"beacon/internal/ipc"
+	"beacon/internal/state"
 	"beacon/internal/tunnel"
 	"beacon/internal/version"
 	"beacon/internal/vpn"
 )
 
-const defaultMetricsPort = 9100
+const (
+	defaultMetricsPort = 9100
+	statusDeployLimit  = 5 // recent deploy history entries per project in /api/status
+)
 
 // MasterInfo describes the master process itself.
 type MasterInfo struct {
@@ -47,13 +57,45 @@ type ChildStatus struct {
 	PID        int          `json:"pid,omitempty"`
 	DeployedAt *time.Time   `json:"deployed_at,omitempty"`
 	Checks     CheckSummary `json:"checks"`
+	// Services is the per-service state of compose projects.
+	Services []ipc.ServiceStatus `json:"services,omitempty"`
+	// Deploy is set while a deploy pipeline is running (current stage and its start time).
+	Deploy *state.DeployProgress `json:"deploy,omitempty"`
+	// Pending lists releases held by the deploy gate (outside a window or awaiting approval).
+	Pending []state.PendingRelease `json:"pending,omitempty"`
+	// LogsTail holds the last log lines of failing checks' log sources.
+	LogsTail []string `json:"logs_tail,omitempty"`
+	// Deploys holds the most recent deploy history entries (newest first, output omitted).
+	Deploys []state.DeployRecord `json:"deploys,omitempty"`
+	// Agent is the state of the project's child agent: running, exited (not respawned
+	// per its restart policy) or failed (gave up after max restarts).
+	Agent    string `json:"agent,omitempty"`
+	Restarts int    `json:"restarts,omitempty"`
+	// ExitCode and CrashReason describe the agent's last exit, if it exited.
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	CrashReason string     `json:"crash_reason,omitempty"`
+	LastExitAt  *time.Time `json:"last_exit_at,omitempty"`
+	// Resources is the agent's cgroup usage (Linux, cgroup v2).
+	Resources *ResourceUsage `json:"resources,omitempty"`
+	// RunAs is the user the agent runs as, when not the master's.
+	RunAs string `json:"run_as,omitempty"`
+	// SandboxError says why configured resource limits are not enforced.
+	SandboxError string `json:"sandbox_error,omitempty"`
 }
 
+// Agent states for ChildStatus.Agent
+const (
+	AgentRunning = "running"
+	AgentExited  = "exited"
+	AgentFailed  = "failed"
+)
+
 // CloudStatus describes cloud connectivity.
 type CloudStatus struct {
 	Connected bool      `json:"connected"`
 	LastSync  time.Time `json:"last_sync,omitempty"`
 	Endpoint  string    `json:"endpoint,omitempty"`
+	Backlog   int       `json:"backlog,omitempty"` // reports spooled for backfill
 }
 
 // TunnelStatusInfo describes a tunnel's status for /api/status.
@@ -78,6 +120,7 @@ type StatusSnapshot struct {
 	VPN      *vpn.Status        `json:"vpn,omitempty"`
 	Events   []Event            `json:"events"`
 	Cloud    CloudStatus        `json:"cloud"`
+	Upgrade  *UpgradeStatus     `json:"upgrade,omitempty"` // the last self-upgrade
 }
 
 // StatusCache holds the latest snapshot, refreshed every 10 seconds.
@@ -146,6 +189,7 @@ func (sc *StatusCache) Refresh() {
 	if sc.eventLog != nil {
 		snap.Events = sc.eventLog.Recent()
 	}
+	snap.Upgrade, _ = ReadUpgradeStatus()
 
 	// Preserve cloud sync state and apply config
 	sc.mu.Lock()
@@ -153,8 +197,127 @@ func (sc *StatusCache) Refresh() {
 	if sc.cfg != nil && sc.cfg.CloudReportingEnabled {
 		snap.Cloud.Endpoint = cloud.BeaconInfraAPIBase()
 	}
+	var changes []Event
+	if sc.snapshot.Master.PID != 0 {
+		changes = snapshotChanges(sc.snapshot, snap)
+	}
 	sc.snapshot = snap
 	sc.mu.Unlock()
+
+	if sc.eventLog != nil {
+		for _, e := range changes {
+			sc.eventLog.Append(e)
+		}
+	}
+}
+
+// snapshotChanges returns events for what changed between two snapshots: project health,
+// new deploys, tunnel states and the VPN connection. Projects and tunnels that appear or
+// disappear are reported by the config reload instead.
+func snapshotChanges(prev, cur StatusSnapshot) []Event {
+	now := time.Now()
+	var events []Event
+	add := func(typ EventType, child, msg string, d int64) {
+		events = append(events, Event{Timestamp: now, Type: typ, Child: child, Message: msg, DurationMs: d})
+	}
+
+	before := make(map[string]ChildStatus, len(prev.Children))
+	for _, c := range prev.Children {
+		before[c.Name] = c
+	}
+	for _, c := range cur.Children {
+		p, ok := before[c.Name]
+		if !ok {
+			continue
+		}
+		// Unknown only means no fresh health report, e.g. while an agent starts
+		if p.Status != c.Status && p.Status != ipc.StatusUnknown && c.Status != ipc.StatusUnknown {
+			add(EventAlert, c.Name, healthChange(p, c), 0)
+		}
+		for _, d := range newDeploys(p.Deploys, c.Deploys) {
+			add(EventDeploy, c.Name, deployMessage(d), d.DurationMs)
+		}
+	}
+
+	tunnels := make(map[string]string, len(prev.Tunnels))
+	for _, t := range prev.Tunnels {
+		tunnels[t.ID] = t.Status
+	}
+	for _, t := range cur.Tunnels {
+		if was, ok := tunnels[t.ID]; ok && was != t.Status {
+			add(EventTunnel, "", fmt.Sprintf("tunnel %s %s -> %s", t.ID, was, t.Status), 0)
+		}
+	}
+
+	if was, is := vpnState(prev.VPN), vpnState(cur.VPN); was != is {
+		add(EventVPN, "", "VPN "+is, 0)
+	}
+	return events
+}
+
+// healthChange describes a project's health transition and its failing checks.
+func healthChange(prev, cur ChildStatus) string {
+	msg := fmt.Sprintf("health %s -> %s", prev.Status, cur.Status)
+	var failing []string
+	for _, c := range cur.Checks.Details {
+		if c.Status != "failing" {
+			continue
+		}
+		if c.Error != "" {
+			failing = append(failing, c.Name+" ("+c.Error+")")
+		} else {
+			failing = append(failing, c.Name)
+		}
+	}
+	if len(failing) > 0 {
+		msg += "; failing: " + strings.Join(failing, ", ")
+	}
+	return msg
+}
+
+// newDeploys returns the deploy records in cur (newest first) that are newer than the
+// newest one in prev, oldest first.
+func newDeploys(prev, cur []state.DeployRecord) []state.DeployRecord {
+	if len(cur) == 0 || (len(prev) > 0 && cur[0].ID == prev[0].ID) {
+		return nil
+	}
+	var fresh []state.DeployRecord
+	for _, d := range cur {
+		if len(prev) > 0 && d.ID == prev[0].ID {
+			break
+		}
+		fresh = append(fresh, d)
+	}
+	slices.Reverse(fresh)
+	return fresh
+}
+
+func deployMessage(d state.DeployRecord) string {
+	what := cmp.Or(d.Tag, d.Image, d.CommitRange(), d.ID)
+	switch {
+	case d.Refused:
+		return fmt.Sprintf("deploy of %s refused (%s): %s", what, d.Trigger, d.Error)
+	case !d.Success && d.Error != "":
+		return fmt.Sprintf("deploy of %s failed (%s): %s", what, d.Trigger, d.Error)
+	case !d.Success:
+		return fmt.Sprintf("deploy of %s failed (%s): exit code %d", what, d.Trigger, d.ExitCode)
+	}
+	return fmt.Sprintf("deployed %s (%s)", what, d.Trigger)
+}
+
+// vpnState summarizes the VPN connection for change events.
+func vpnState(s *vpn.Status) string {
+	switch {
+	case s == nil || !s.Enabled:
+		return "disabled"
+	case s.Error != "":
+		return fmt.Sprintf("%s error: %s", s.Role, s.Error)
+	case s.Connected && s.PeerDevice != "":
+		return fmt.Sprintf("%s connected to %s", s.Role, s.PeerDevice)
+	case s.Connected:
+		return fmt.Sprintf("%s connected", s.Role)
+	}
+	return fmt.Sprintf("%s not connected", s.Role)
 }
 
 // Get returns a copy of the current snapshot.
@@ -172,6 +335,13 @@ func (sc *StatusCache) UpdateCloudSync() {
 	sc.snapshot.Cloud.LastSync = time.Now()
 }
 
+// SetCloudBacklog records how many reports wait to be backfilled.
+func (sc *StatusCache) SetCloudBacklog(n int) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.snapshot.Cloud.Backlog = n
+}
+
 // SetTunnelManager sets the tunnel manager for status reporting.
 func (sc *StatusCache) SetTunnelManager(tm *tunnel.TunnelManager) {
 	sc.mu.Lock()
@@ -204,6 +374,8 @@ func (sc *StatusCache) buildChildren() []ChildStatus {
 	}
 
 	pids := sc.pm.GetChildPIDs()
+	procs := sc.pm.GetChildren()
+	usage := sc.pm.ResourceUsage()
 
 	children := make([]ChildStatus, 0, len(readers))
 	for projectID, reader := range readers {
@@ -211,11 +383,39 @@ func (sc *StatusCache) buildChildren() []ChildStatus {
 		if pid, ok := pids[projectID]; ok {
 			child.PID = pid
 		}
+		if proc, ok := procs[projectID]; ok {
+			setAgentState(&child, proc)
+		}
+		child.Resources = usage[projectID]
+		child.Deploys = recentDeploys(projectID)
 		children = append(children, child)
 	}
 	return children
 }
 
+// setAgentState fills in the agent process state and its last exit.
+func setAgentState(child *ChildStatus, proc *ChildProcess) {
+	switch {
+	case proc.Failed:
+		child.Agent = AgentFailed
+	case proc.Exited:
+		child.Agent = AgentExited
+	default:
+		child.Agent = AgentRunning
+	}
+	child.Restarts = proc.Restarts
+	child.SandboxError = proc.SandboxError
+	if proc.RunAs != nil {
+		child.RunAs = proc.RunAs.User
+	}
+	if !proc.ExitedAt.IsZero() {
+		exitCode, exitedAt := proc.ExitCode, proc.ExitedAt
+		child.ExitCode = &exitCode
+		child.CrashReason = proc.ExitReason
+		child.LastExitAt = &exitedAt
+	}
+}
+
 // childFromReader builds a ChildStatus from an IPC reader.
 func (sc *StatusCache) childFromReader(projectID string, reader *ipc.Reader) ChildStatus {
 	report, err := reader.ReadHealthIfFresh(healthMaxAge)
@@ -251,6 +451,10 @@ func (sc *StatusCache) childFromReader(projectID string, reader *ipc.Reader) Chi
 		Version:    report.Version,
 		Status:     report.Status,
 		DeployedAt: report.DeployedAt,
+		Services:   report.Services,
+		Deploy:     report.Deploy,
+		Pending:    report.Pending,
+		LogsTail:   report.LogsTail,
 		Checks: CheckSummary{
 			Total:   len(report.Checks),
 			Passing: passing,
@@ -259,3 +463,19 @@ func (sc *StatusCache) childFromReader(projectID string, reader *ipc.Reader) Chi
 		},
 	}
 }
+
+// recentDeploys returns the latest deploy history entries for a project without captured output.
+func recentDeploys(projectID string) []state.DeployRecord {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		return nil
+	}
+	records, err := state.NewHistory(filepath.Join(base, "state", projectID)).List(statusDeployLimit)
+	if err != nil || len(records) == 0 {
+		return nil
+	}
+	for i := range records {
+		records[i] = records[i].Summary()
+	}
+	return records
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,6 +25,11 @@ type StatusServer struct {
 	cache      *StatusCache
 	port       int
 	listenAddr string
+	control    http.Handler // /api/control/; nil = not served
+	inherited  net.Listener // served instead of binding the port; from a previous master
+
+	mu sync.Mutex
+	ln net.Listener // nil until bound
 }
 
 // NewStatusServer creates a StatusServer on the given port, bound to 127.0.0.1.
@@ -37,8 +46,12 @@ func NewStatusServerWithAddr(cache *StatusCache, port int, listenAddr string) *S
 func (s *StatusServer) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/status", s.handleAPIStatus)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
 	mux.HandleFunc("/metrics", s.handleMetrics)
 	mux.HandleFunc("/health", s.handleHealth)
+	if s.control != nil {
+		mux.Handle("/api/control/", s.control)
+	}
 	mux.HandleFunc("/", s.handleDashboard)
 
 	addr := fmt.Sprintf("%s:%d", s.listenAddr, s.port)
@@ -47,12 +60,20 @@ func (s *StatusServer) Start(ctx context.Context) error {
 		Handler:      mux,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
+		// Ends event streams on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("status server bind %s: %w", addr, err)
+	ln := s.inherited
+	if ln == nil {
+		var err error
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return fmt.Errorf("status server bind %s: %w", addr, err)
+		}
 	}
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
 
 	logger.Infof("Dashboard: http://%s:%d  API: http://%s:%d/api/status", s.listenAddr, s.port, s.listenAddr, s.port)
 
@@ -69,6 +90,40 @@ func (s *StatusServer) Start(ctx context.Context) error {
 	return nil
 }
 
+// listenerFile returns a duplicate of the bound listener, for handing it to a new master
+// on self-upgrade.
+func (s *StatusServer) listenerFile() (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tl, ok := s.ln.(*net.TCPListener)
+	if !ok {
+		return nil, errors.New("status server is not listening")
+	}
+	return tl.File()
+}
+
+// loopbackAddr returns the address to reach the server from this machine, "" if it is
+// not listening.
+func (s *StatusServer) loopbackAddr() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return ""
+	}
+	addr, ok := s.ln.Addr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	ip := addr.IP
+	if ip.IsUnspecified() {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(addr.Port))
+}
+
 func (s *StatusServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
@@ -89,6 +144,10 @@ func (s *StatusServer) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
+func (s *StatusServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	serveEvents(w, r, s.cache.eventLog)
+}
+
 func (s *StatusServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	snap := s.cache.Get()
 	sys := snap.System
@@ -127,6 +186,31 @@ func (s *StatusServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		metric("beacon_temperature_celsius", "CPU temperature in Celsius", "gauge", sys.TempCelsius)
 	}
 
+	// Per-project cgroup usage
+	projectMetric := func(name, help, typ string, val func(*ResourceUsage) float64) {
+		header := false
+		for _, c := range snap.Children {
+			if c.Resources == nil {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+				header = true
+			}
+			fmt.Fprintf(&b, "%s{project=%q} %.6g\n", name, c.Name, val(c.Resources))
+		}
+	}
+	projectMetric("beacon_project_memory_bytes", "Memory used by the project's agent and checks", "gauge",
+		func(u *ResourceUsage) float64 { return float64(u.MemoryBytes) })
+	projectMetric("beacon_project_memory_max_bytes", "Memory limit of the project (0 = unlimited)", "gauge",
+		func(u *ResourceUsage) float64 { return float64(u.MemoryMaxBytes) })
+	projectMetric("beacon_project_cpu_seconds_total", "CPU time used by the project's agent and checks", "counter",
+		func(u *ResourceUsage) float64 { return u.CPUSeconds })
+	projectMetric("beacon_project_pids", "Processes and threads of the project", "gauge",
+		func(u *ResourceUsage) float64 { return float64(u.PIDs) })
+	projectMetric("beacon_project_oom_kills_total", "Processes of the project killed by the OOM killer", "counter",
+		func(u *ResourceUsage) float64 { return float64(u.OOMKills) })
+
 	_, _ = fmt.Fprint(w, b.String())
 }
 
@@ -0,0 +1,882 @@
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/control"
+	"beacon/internal/identity"
+	"beacon/internal/ipc"
+	"beacon/internal/logging"
+	"beacon/internal/state"
+	"beacon/internal/version"
+)
+
+// Self-upgrade
+//
+// `beacon update --restart-master` replaces the binary on disk and asks the running master
+// to upgrade (POST /v1/upgrade; `beacon update --apply` only asks). The master execs the
+// new binary in its own process: the PID stays the same, so the project agents remain its
+// children and a service manager keeps tracking it. The new master inherits the status server and control socket listeners,
+// each agent's IPC socket and output pipes, and adopts the agents by PID; they keep
+// running. Tunnels and the VPN are stopped before the exec and come back up in the new
+// master.
+//
+// The new master checks itself and commits the upgrade once healthy. If it is not
+// healthy within upgradeGrace it restores the previous binary and hands back to it the
+// same way. If it dies instead, the next start (the service restarts it) finds the
+// upgrade pending and rolls back before doing anything else. A watchdog run from the
+// previous binary covers a new master that hangs or dies without a service to restart
+// it (see WatchUpgrade).
+
+// Upgrade states in UpgradeStatus.State.
+const (
+	UpgradePending    = "pending"     // the new master has not passed its health check yet
+	UpgradeCommitted  = "committed"   // the new master is healthy
+	UpgradeRolledBack = "rolled_back" // the previous binary is running again
+	UpgradeFailed     = "failed"      // the handoff did not happen; the old master runs on
+)
+
+const (
+	// handoffEnv names the handoff file for the exec'd master.
+	handoffEnv = "BEACON_HANDOFF"
+
+	handoffUpgrade  = "upgrade"
+	handoffRollback = "rollback"
+
+	// upgradeCheckTimeout bounds the new binary's trial run and each self-check.
+	upgradeCheckTimeout = 10 * time.Second
+	// upgradeRecoveryWindow is how long past its deadline a pending upgrade is still
+	// rolled back when the master starts.
+	upgradeRecoveryWindow = 10 * time.Minute
+	// upgradeWatchdogMargin is how long past the deadline the watchdog leaves the new
+	// master to roll itself back before stepping in.
+	upgradeWatchdogMargin = 30 * time.Second
+)
+
+var (
+	// upgradeGrace is how long a new master has to pass its health check.
+	upgradeGrace = 60 * time.Second
+	// upgradeSettle is how long a new master runs before it first checks itself.
+	upgradeSettle = 5 * time.Second
+	// upgradeCheckInterval is the pause between failed self-checks.
+	upgradeCheckInterval = 5 * time.Second
+	// upgradeWatchInterval is the pause between the watchdog's looks at the upgrade.
+	upgradeWatchInterval = 2 * time.Second
+
+	// execMaster replaces the process with another master; masterExecutable is the
+	// binary on disk. Tests replace both.
+	execMaster       = execBinary
+	masterExecutable = os.Executable
+
+	errUpgradeInProgress = errors.New("an upgrade is already in progress")
+)
+
+// UpgradeStatus is the state of the last self-upgrade, kept in
+// ~/.beacon/upgrade/status.json and reported in /api/status.
+type UpgradeStatus struct {
+	State      string    `json:"state"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	StartedAt  time.Time `json:"started_at"`
+	Deadline   time.Time `json:"deadline"` // the new master must be healthy by then
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// handoffState is what a master passes to the master it execs, in
+// ~/.beacon/upgrade/handoff.json. A zero descriptor was not handed over.
+type handoffState struct {
+	Reason    string         `json:"reason"` // handoffUpgrade or handoffRollback
+	From      string         `json:"from"`   // version of the master handing over
+	Backup    string         `json:"backup,omitempty"`
+	Error     string         `json:"error,omitempty"` // why it rolled back
+	StatusFD  int            `json:"status_fd,omitempty"`
+	ControlFD int            `json:"control_fd,omitempty"`
+	Watchdog  int            `json:"watchdog_pid,omitempty"` // reaped by the new master
+	Children  []handoffChild `json:"children,omitempty"`
+}
+
+// handoffChild is an agent handed over with its restart state. PID is 0 when the agent
+// is not running: it exited, failed or is waiting to be respawned.
+type handoffChild struct {
+	ProjectID  string                   `json:"project_id"`
+	ConfigPath string                   `json:"config_path"`
+	IPCDir     string                   `json:"ipc_dir"`
+	PID        int                      `json:"pid,omitempty"`
+	StartedAt  time.Time                `json:"started_at"`
+	Restart    *identity.RestartPolicy  `json:"restart,omitempty"`
+	Restarts   int                      `json:"restarts,omitempty"`
+	Failed     bool                     `json:"failed,omitempty"`
+	Exited     bool                     `json:"exited,omitempty"`
+	ExitCode   int                      `json:"exit_code,omitempty"`
+	ExitReason string                   `json:"exit_reason,omitempty"`
+	ExitedAt   time.Time                `json:"exited_at,omitempty"`
+	Resources  *identity.ResourceLimits `json:"resources,omitempty"`
+	RunAs      *identity.RunAs          `json:"run_as,omitempty"`
+	StdoutFD   int                      `json:"stdout_fd,omitempty"`
+	StderrFD   int                      `json:"stderr_fd,omitempty"`
+	IPCFD      int                      `json:"ipc_fd,omitempty"`
+}
+
+func upgradeDir() (string, error) {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "upgrade"), nil
+}
+
+// ReadUpgradeStatus returns the state of the last self-upgrade, nil if there was none.
+// It does not need the master to be running.
+func ReadUpgradeStatus() (*UpgradeStatus, error) {
+	dir, err := upgradeDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "status.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st UpgradeStatus
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse upgrade status: %w", err)
+	}
+	return &st, nil
+}
+
+func writeUpgradeStatus(st *UpgradeStatus) error {
+	dir, err := upgradeDir()
+	if err != nil {
+		return err
+	}
+	return writeUpgradeFile(filepath.Join(dir, "status.json"), st)
+}
+
+// writeUpgradeFile writes v as JSON to path atomically.
+func writeUpgradeFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// binaryVersion runs `exe version` and returns the version it reports. A binary that
+// does not run is not handed over to.
+func binaryVersion(exe string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upgradeCheckTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, exe, "version").Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	v, ok := strings.CutPrefix(strings.TrimSpace(line), "Beacon ")
+	if !ok {
+		return "", fmt.Errorf("unexpected `version` output %q", line)
+	}
+	return v, nil
+}
+
+// installBinary copies src over dst atomically and makes it executable.
+func installBinary(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".beacon-install-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0755); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// masterArgs returns the command line to exec exe with, the master's own arguments.
+func masterArgs(exe string) []string {
+	return append([]string{exe}, os.Args[1:]...)
+}
+
+// masterEnv returns the environment for the exec'd master. BEACON_LOG_LEVEL is dropped
+// unless it came from the master's own environment, so the new master reads it from
+// config.yaml again.
+func masterEnv(handoffPath string, keepLogLevel bool) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		if k == handoffEnv || (k == "BEACON_LOG_LEVEL" && !keepLogLevel) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	if handoffPath != "" {
+		env = append(env, handoffEnv+"="+handoffPath)
+	}
+	return env
+}
+
+// handoffFiles are the descriptors passed to the exec'd master. They must stay open
+// until the exec; if it fails, release makes them close-on-exec again.
+type handoffFiles struct {
+	passed []*os.File
+	dups   []*os.File // listener duplicates, closed by release
+}
+
+// pass clears close-on-exec on f and returns its descriptor. dup marks a duplicate
+// that belongs to the handoff.
+func (h *handoffFiles) pass(f *os.File, dup bool) (int, error) {
+	if dup {
+		h.dups = append(h.dups, f)
+	}
+	fd, err := setInheritable(f, true)
+	if err != nil {
+		return 0, fmt.Errorf("pass %s: %w", f.Name(), err)
+	}
+	h.passed = append(h.passed, f)
+	return fd, nil
+}
+
+func (h *handoffFiles) release() {
+	for _, f := range h.passed {
+		_, _ = setInheritable(f, false)
+	}
+	for _, f := range h.dups {
+		_ = f.Close()
+	}
+	h.passed, h.dups = nil, nil
+}
+
+// handoff freezes the process manager and calls exec with its agents: nothing is
+// spawned, stopped or reaped until exec returns, which it only does on failure.
+func (pm *ProcessManager) handoff(files *handoffFiles, exec func([]handoffChild) error) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	children := make([]handoffChild, 0, len(pm.children))
+	for _, c := range pm.children {
+		hc := handoffChild{
+			ProjectID:  c.ProjectID,
+			ConfigPath: c.ConfigPath,
+			IPCDir:     c.IPCDir,
+			StartedAt:  c.StartedAt,
+			Restart:    c.Restart,
+			Restarts:   c.Restarts,
+			Failed:     c.Failed,
+			Exited:     c.Exited,
+			ExitCode:   c.ExitCode,
+			ExitReason: c.ExitReason,
+			ExitedAt:   c.ExitedAt,
+			Resources:  c.Resources,
+			RunAs:      c.RunAs,
+		}
+		if c.alive {
+			var err error
+			hc.PID = c.Process.Pid
+			if hc.StdoutFD, err = files.pass(c.output.stdout, false); err != nil {
+				return err
+			}
+			if hc.StderrFD, err = files.pass(c.output.stderr, false); err != nil {
+				return err
+			}
+		}
+		if c.IPC != nil {
+			if f, err := c.IPC.ListenerFile(); err != nil {
+				logger.Infof("Project %s: socket not handed over (%v); the agent falls back to file IPC", c.ProjectID, err)
+			} else if hc.IPCFD, err = files.pass(f, true); err != nil {
+				return err
+			}
+		}
+		children = append(children, hc)
+	}
+	return exec(children)
+}
+
+// Adopt takes over the agents a previous master handed over on self-upgrade. Running
+// agents are watched by PID with their output pipes and IPC sockets, agents that were
+// waiting to be respawned are started, and exited or failed ones are kept for status.
+func (pm *ProcessManager) Adopt(children []handoffChild) {
+	for _, hc := range children {
+		if err := pm.adopt(hc); err != nil {
+			logger.Infof("Project %s: cannot adopt the agent: %v", hc.ProjectID, err)
+		}
+	}
+}
+
+func (pm *ProcessManager) adopt(hc handoffChild) error {
+	child := &ChildProcess{
+		ProjectID:  hc.ProjectID,
+		ConfigPath: hc.ConfigPath,
+		IPCDir:     hc.IPCDir,
+		StartedAt:  hc.StartedAt,
+		Restart:    hc.Restart,
+		Restarts:   hc.Restarts,
+		Failed:     hc.Failed,
+		Exited:     hc.Exited,
+		ExitCode:   hc.ExitCode,
+		ExitReason: hc.ExitReason,
+		ExitedAt:   hc.ExitedAt,
+		Resources:  hc.Resources,
+		RunAs:      hc.RunAs,
+		stderr:     state.NewTailBuffer(childStderrTail),
+		stopped:    make(chan struct{}),
+		exited:     make(chan struct{}),
+	}
+	var proc *os.Process
+	if hc.PID > 0 {
+		var err error
+		if proc, err = os.FindProcess(hc.PID); err != nil {
+			return err
+		}
+		child.output = &agentOutput{
+			stdout: inheritedFile(hc.StdoutFD, hc.ProjectID+" stdout"),
+			stderr: inheritedFile(hc.StderrFD, hc.ProjectID+" stderr"),
+		}
+	}
+
+	reader := ipc.NewReader(hc.IPCDir)
+	var err error
+	if hc.IPCFD > 0 {
+		err = reader.ListenFile(inheritedFile(hc.IPCFD, hc.ProjectID+" socket"), hc.ProjectID)
+	} else {
+		err = reader.Listen(hc.ProjectID)
+	}
+	if err != nil {
+		logger.Infof("Project %s: %v; using file IPC", hc.ProjectID, err)
+	} else {
+		child.IPC = reader
+	}
+	if lf, err := logging.OpenRotating(AgentLogPath(hc.ProjectID), pm.logOptions); err != nil {
+		logger.Infof("Project %s: %v; agent output goes to the master's", hc.ProjectID, err)
+	} else {
+		child.log = lf
+	}
+
+	if err := pm.prepareSandbox(child); err != nil {
+		// Not respawned without its sandbox; the next reconcile starts it over
+		if proc != nil {
+			_ = proc.Signal(os.Interrupt)
+			go func() { _, _ = proc.Wait() }()
+			child.output.close()
+		}
+		if child.IPC != nil {
+			_ = child.IPC.Close()
+		}
+		if child.log != nil {
+			_ = child.log.Close()
+		}
+		return err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.children[hc.ProjectID] = child
+	switch {
+	case proc != nil:
+		child.Process = proc
+		child.alive = true
+		pm.copyOutput(child)
+		logger.Infof("Adopted project %s (PID %d)", hc.ProjectID, hc.PID)
+	case child.Running():
+		if err := pm.spawnChild(child); err != nil {
+			child.Failed = true
+			return err
+		}
+		logger.Infof("Started project %s (PID %d)", hc.ProjectID, child.Process.Pid)
+	default:
+		close(child.exited)
+		return nil
+	}
+	pm.wg.Add(1)
+	go pm.watchChild(child)
+	return nil
+}
+
+// inheritedFile wraps a descriptor handed over by the previous master; nil if fd is 0.
+func inheritedFile(fd int, name string) *os.File {
+	if fd <= 0 {
+		return nil
+	}
+	return os.NewFile(uintptr(fd), name)
+}
+
+// inheritListener returns the listener at a descriptor handed over by the previous master.
+func inheritListener(fd int, name string) (net.Listener, error) {
+	f := inheritedFile(fd, name)
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherit %s listener: %w", name, err)
+	}
+	return ln, nil
+}
+
+// takeHandoff returns what the previous master handed over, nil on a fresh start.
+func takeHandoff() (*handoffState, error) {
+	path := os.Getenv(handoffEnv)
+	if path == "" {
+		return nil, nil
+	}
+	_ = os.Unsetenv(handoffEnv) // not for the agents
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read handoff: %w", err)
+	}
+	var h handoffState
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("parse handoff: %w", err)
+	}
+	return &h, nil
+}
+
+// prepareUpgrade tries the binary on disk and saves the running one for a rollback.
+// It runs on Run's goroutine.
+func (r *configReloader) prepareUpgrade() (*UpgradeStatus, error) {
+	if !selfUpgradeSupported {
+		return nil, errors.New("self-upgrade is only supported on Linux; restart the master to use the new binary")
+	}
+	if r.upgrading.Load() {
+		return nil, errUpgradeInProgress
+	}
+	exe, err := masterExecutable()
+	if err != nil {
+		return nil, fmt.Errorf("find the binary: %w", err)
+	}
+	to, err := binaryVersion(exe)
+	if err != nil {
+		return nil, fmt.Errorf("the binary at %s does not run: %w", exe, err)
+	}
+	dir, err := upgradeDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := installBinary(runningBinary, filepath.Join(dir, "beacon.previous")); err != nil {
+		return nil, fmt.Errorf("save the running binary: %w", err)
+	}
+	now := time.Now()
+	st := &UpgradeStatus{
+		State:     UpgradePending,
+		From:      version.GetVersion(),
+		To:        to,
+		StartedAt: now,
+		Deadline:  now.Add(upgradeSettle + upgradeGrace),
+	}
+	if err := writeUpgradeStatus(st); err != nil {
+		return nil, fmt.Errorf("write upgrade status: %w", err)
+	}
+	r.upgrading.Store(true)
+	return st, nil
+}
+
+// upgrade hands over to the binary on disk. It only returns if the handoff failed, with
+// this master carrying on. It runs on Run's goroutine.
+func (r *configReloader) upgrade(st *UpgradeStatus) error {
+	dir, err := upgradeDir()
+	if err == nil {
+		var exe string
+		if exe, err = masterExecutable(); err == nil {
+			r.eventLog.Append(Event{
+				Timestamp: time.Now(),
+				Type:      EventUpgrade,
+				Message:   fmt.Sprintf("upgrading the master from %s to %s", st.From, st.To),
+			})
+			h := handoffState{Reason: handoffUpgrade, From: st.From, Backup: filepath.Join(dir, "beacon.previous")}
+			watchdog, wdErr := startWatchdog(h.Backup, exe)
+			if wdErr != nil {
+				logger.Infof("Upgrade watchdog: %v (continuing without it)", wdErr)
+			} else {
+				h.Watchdog = watchdog.Pid
+			}
+			err = r.handoff(exe, h)
+			if watchdog != nil {
+				_ = watchdog.Kill()
+				_, _ = watchdog.Wait()
+			}
+		}
+	}
+	r.upgradeFailed(st, err)
+	return err
+}
+
+// upgradeFailed records that the upgrade to st.To did not happen, with this master
+// carrying on, and allows a new one to be tried.
+func (r *configReloader) upgradeFailed(st *UpgradeStatus, err error) {
+	r.upgrading.Store(false)
+	st.State, st.Error, st.FinishedAt = UpgradeFailed, err.Error(), time.Now()
+	_ = writeUpgradeStatus(st)
+	logger.Infof("Upgrade to %s failed: %v", st.To, err)
+	r.eventLog.Append(Event{Timestamp: time.Now(), Type: EventUpgrade, Message: "upgrade to " + st.To + " failed: " + err.Error()})
+}
+
+// handoff execs exe as the new master and passes it the listeners and agents. Tunnels
+// and the VPN are stopped first; they reconnect from the new master. It only returns if
+// the exec failed, after bringing tunnels and the VPN back.
+func (r *configReloader) handoff(exe string, h handoffState) error {
+	files := &handoffFiles{}
+	if r.status != nil {
+		if f, err := r.status.listenerFile(); err == nil {
+			if h.StatusFD, err = files.pass(f, true); err != nil {
+				files.release()
+				return err
+			}
+		}
+	}
+	if f, err := r.control.listenerFile(); err == nil {
+		if h.ControlFD, err = files.pass(f, true); err != nil {
+			files.release()
+			return err
+		}
+	}
+	dir, err := upgradeDir()
+	if err != nil {
+		files.release()
+		return err
+	}
+	path := filepath.Join(dir, "handoff.json")
+
+	if r.tm != nil {
+		r.tm.Reconcile(nil, "", "", "")
+	}
+	if r.beat != nil && r.beat.vm != nil {
+		r.beat.vm.Stop()
+	}
+	logger.Infof("Handing over to %s (%s)", exe, h.Reason)
+	execNew := func(children []handoffChild) error {
+		h.Children = children
+		if err := writeUpgradeFile(path, h); err != nil {
+			return fmt.Errorf("write handoff: %w", err)
+		}
+		if err := execMaster(exe, masterArgs(exe), masterEnv(path, r.childLogEnv)); err != nil {
+			return fmt.Errorf("exec %s: %w", exe, err)
+		}
+		return errors.New("exec returned")
+	}
+	if r.pm != nil {
+		err = r.pm.handoff(files, execNew)
+	} else {
+		err = execNew(nil)
+	}
+
+	// Still here: the exec failed
+	_ = os.Remove(path)
+	files.release()
+	if uc, loadErr := identity.LoadUserConfig(); loadErr == nil && uc != nil {
+		if r.tm != nil {
+			reconcileTunnels(r.tm, uc)
+		}
+		if r.beat != nil {
+			r.reconcileVPN(uc)
+		}
+	}
+	return err
+}
+
+// verifyUpgrade checks the new master until it is healthy and commits the upgrade. If it
+// is not healthy within upgradeGrace, it rolls back to the previous binary.
+func (r *configReloader) verifyUpgrade(ctx context.Context, h *handoffState) {
+	st, err := ReadUpgradeStatus()
+	if err != nil || st == nil || st.State != UpgradePending {
+		now := time.Now()
+		st = &UpgradeStatus{State: UpgradePending, From: h.From, To: version.GetVersion(), StartedAt: now, Deadline: now.Add(upgradeSettle + upgradeGrace)}
+	}
+	deadline := time.Now().Add(upgradeSettle + upgradeGrace)
+	wait := upgradeSettle
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if err = r.selfCheck(ctx, h); err == nil {
+			break
+		}
+		logger.Infof("Upgrade health check: %v", err)
+		if time.Now().After(deadline) {
+			r.rollback(st, h, err)
+			return
+		}
+		wait = upgradeCheckInterval
+	}
+
+	st.State, st.FinishedAt = UpgradeCommitted, time.Now()
+	if err := writeUpgradeStatus(st); err != nil {
+		logger.Infof("Write upgrade status: %v", err)
+	}
+	r.upgrading.Store(false)
+	if r.statusCache != nil {
+		r.statusCache.Refresh()
+	}
+	logger.Infof("Upgraded from %s to %s", st.From, st.To)
+	r.eventLog.Append(Event{
+		Timestamp: time.Now(),
+		Type:      EventUpgrade,
+		Message:   fmt.Sprintf("master upgraded from %s to %s", st.From, st.To),
+	})
+}
+
+// selfCheck reports whether the new master works: its run loop takes tasks and the
+// control socket and status server it inherited answer.
+func (r *configReloader) selfCheck(ctx context.Context, h *handoffState) error {
+	ctx, cancel := context.WithTimeout(ctx, upgradeCheckTimeout)
+	defer cancel()
+	if err := r.control.onRunLoop(ctx, func() error { return nil }); err != nil {
+		return fmt.Errorf("run loop: %w", err)
+	}
+	if h.ControlFD > 0 {
+		var snap StatusSnapshot
+		if err := control.NewSocketClient(r.control.socketPath).Status(ctx, &snap); err != nil {
+			return fmt.Errorf("control socket: %w", err)
+		}
+	}
+	if h.StatusFD > 0 {
+		addr := r.status.loopbackAddr()
+		if addr == "" {
+			return errors.New("status server is not listening")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/health", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("status server: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status server: /health returned HTTP %d", resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+// rollback restores the previous binary and hands back to it, keeping the agents. The
+// handoff runs on Run's goroutine, or on this one if the run loop is stuck.
+func (r *configReloader) rollback(st *UpgradeStatus, h *handoffState, cause error) {
+	logger.Infof("Upgrade to %s failed its health check (%v); rolling back to %s", st.To, cause, st.From)
+	r.eventLog.Append(Event{
+		Timestamp: time.Now(),
+		Type:      EventUpgrade,
+		Message:   fmt.Sprintf("upgrade to %s failed its health check: %v; rolling back to %s", st.To, cause, st.From),
+	})
+	target, err := restorePrevious(h.Backup, "")
+	if err != nil {
+		r.failRollback(st, err)
+		return
+	}
+	st.State, st.Error, st.FinishedAt = UpgradeRolledBack, cause.Error(), time.Now()
+	_ = writeUpgradeStatus(st)
+
+	back := handoffState{Reason: handoffRollback, From: version.GetVersion(), Error: cause.Error(), Watchdog: h.Watchdog}
+	done := make(chan error, 1)
+	select {
+	case r.control.tasks <- func() { done <- r.handoff(target, back) }:
+		err = <-done
+	case <-time.After(upgradeCheckTimeout):
+		err = r.handoff(target, back)
+	}
+	r.failRollback(st, err)
+}
+
+func (r *configReloader) failRollback(st *UpgradeStatus, err error) {
+	r.upgrading.Store(false)
+	st.State, st.FinishedAt = UpgradeFailed, time.Now()
+	st.Error = "rollback failed: " + err.Error()
+	_ = writeUpgradeStatus(st)
+	logger.Infof("Rollback to %s failed: %v; staying on %s", st.From, err, st.To)
+	r.eventLog.Append(Event{Timestamp: time.Now(), Type: EventUpgrade, Message: "rollback to " + st.From + " failed: " + err.Error()})
+}
+
+// restorePrevious puts the saved binary back in place of exe (the master's executable if
+// empty) and returns the path to exec. If the binary on disk cannot be replaced, the
+// saved copy is run directly.
+func restorePrevious(backup, exe string) (string, error) {
+	if backup == "" {
+		return "", errors.New("no previous binary saved")
+	}
+	if _, err := os.Stat(backup); err != nil {
+		return "", err
+	}
+	var err error
+	if exe == "" {
+		exe, err = masterExecutable()
+	}
+	if err == nil {
+		err = installBinary(backup, exe)
+	}
+	if err != nil {
+		logger.Infof("Cannot restore the previous binary (%v); running %s", err, backup)
+		return backup, nil
+	}
+	return exe, nil
+}
+
+// recoverUpgrade rolls back an upgrade whose new master died before passing its health
+// check. It runs first thing on a fresh start and only returns when there is nothing to
+// roll back or the rollback failed; otherwise the previous binary takes over.
+func recoverUpgrade() {
+	st, err := ReadUpgradeStatus()
+	if err != nil || st == nil || st.State != UpgradePending {
+		return
+	}
+	now := time.Now()
+	st.FinishedAt = now
+	if version.GetVersion() != st.To || st.To == st.From || now.After(st.Deadline.Add(upgradeRecoveryWindow)) {
+		st.State, st.Error = UpgradeFailed, "the master restarted before the upgrade was confirmed"
+		_ = writeUpgradeStatus(st)
+		return
+	}
+
+	cause := "the new master exited before passing its health check"
+	dir, err := upgradeDir()
+	if err != nil {
+		return
+	}
+	target, err := restorePrevious(filepath.Join(dir, "beacon.previous"), "")
+	if err != nil {
+		st.State, st.Error = UpgradeFailed, cause+"; cannot roll back: "+err.Error()
+		_ = writeUpgradeStatus(st)
+		return
+	}
+	st.State, st.Error = UpgradeRolledBack, cause
+	_ = writeUpgradeStatus(st)
+	logger.Infof("Upgrade to %s: %s; rolling back to %s", st.To, cause, st.From)
+	recordEvent(Event{Timestamp: now, Type: EventUpgrade, Message: fmt.Sprintf("upgrade to %s: %s; rolled back to %s", st.To, cause, st.From)})
+
+	if err := execMaster(target, masterArgs(target), masterEnv("", os.Getenv("BEACON_LOG_LEVEL") != "")); err != nil {
+		st.State, st.Error = UpgradeFailed, cause+"; cannot roll back: "+err.Error()
+		_ = writeUpgradeStatus(st)
+		logger.Infof("Rollback to %s failed: %v", st.From, err)
+	}
+}
+
+// WatchUpgrade watches a pending upgrade from outside the master, whose PID is pid. It is
+// run from the previous binary by `beacon upgrade-watchdog` and returns once the upgrade
+// is settled. A new master that dies, or hangs past its deadline without rolling itself
+// back, cannot be trusted to recover: the watchdog restores the previous binary over exe
+// and stops the master's agents. A hung master is killed and started again, unless a
+// service manager restarts it.
+func WatchUpgrade(pid int, exe string) error {
+	dir, err := upgradeDir()
+	if err != nil {
+		return err
+	}
+	for {
+		time.Sleep(upgradeWatchInterval)
+		st, err := ReadUpgradeStatus()
+		if err != nil || st == nil || st.State != UpgradePending {
+			return err
+		}
+		cause := "the new master exited before passing its health check"
+		alive := processAlive(pid)
+		if alive {
+			if time.Now().Before(st.Deadline.Add(upgradeWatchdogMargin)) {
+				continue
+			}
+			cause = "the new master did not pass its health check in time"
+		}
+		return rescueUpgrade(st, pid, alive, filepath.Join(dir, "beacon.previous"), exe, cause)
+	}
+}
+
+// rescueUpgrade is the watchdog's rollback (see WatchUpgrade).
+func rescueUpgrade(st *UpgradeStatus, pid int, alive bool, backup, exe, cause string) error {
+	st.FinishedAt = time.Now()
+	target, err := restorePrevious(backup, exe)
+	if err != nil {
+		st.State, st.Error = UpgradeFailed, cause+"; cannot roll back: "+err.Error()
+		_ = writeUpgradeStatus(st)
+		return err
+	}
+	st.State, st.Error = UpgradeRolledBack, cause
+	_ = writeUpgradeStatus(st)
+	recordEvent(Event{Timestamp: st.FinishedAt, Type: EventUpgrade, Message: fmt.Sprintf("upgrade watchdog: %s; rolled back to %s", cause, st.From)})
+
+	// The agents lose their master either way; stop them so the next master starts its own
+	agents := childPIDs(pid)
+	if alive {
+		if p, err := os.FindProcess(pid); err == nil {
+			_ = p.Kill()
+		}
+		for i := 0; i < 50 && processAlive(pid); i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	for _, agent := range agents {
+		if p, err := os.FindProcess(agent); err == nil {
+			_ = p.Signal(os.Interrupt)
+		}
+	}
+	if !alive || os.Getenv("INVOCATION_ID") != "" {
+		return nil // the master stopped, or systemd restarts it
+	}
+	cmd := exec.Command(target, "start")
+	cmd.Env = masterEnv("", true)
+	return cmd.Run()
+}
+
+// reapWatchdog waits for the watchdog the previous master started, which is now this
+// master's child, so it does not linger as a zombie.
+func reapWatchdog(pid int) {
+	if p, err := os.FindProcess(pid); err == nil {
+		go func() { _, _ = p.Wait() }()
+	}
+}
+
+// recordEvent appends one event to the event store, before the event log is set up.
+func recordEvent(e Event) {
+	path, err := EventStorePath()
+	if err != nil {
+		return
+	}
+	store, err := OpenEventStore(path)
+	if err != nil {
+		return
+	}
+	el := NewEventLog()
+	el.Persist(store)
+	el.Append(e)
+	_ = el.Close()
+}
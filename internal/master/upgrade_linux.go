@@ -0,0 +1,92 @@
+//go:build linux
+
+package master
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// selfUpgradeSupported reports whether the master can exec a new binary with its agents.
+const selfUpgradeSupported = true
+
+// runningBinary is the master's own executable, still readable after `beacon update`
+// replaced the file on disk.
+var runningBinary = "/proc/self/exe"
+
+// setInheritable clears close-on-exec on f, or sets it back, and returns its descriptor.
+func setInheritable(f *os.File, inherit bool) (int, error) {
+	raw, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	flags := uintptr(syscall.FD_CLOEXEC)
+	if inherit {
+		flags = 0
+	}
+	var fd int
+	var errno syscall.Errno
+	if err := raw.Control(func(p uintptr) {
+		fd = int(p)
+		_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, p, syscall.F_SETFD, flags)
+	}); err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return fd, nil
+}
+
+// execBinary replaces the master process with exe.
+func execBinary(exe string, argv, env []string) error {
+	return syscall.Exec(exe, argv, env)
+}
+
+// startWatchdog runs `backup upgrade-watchdog` for this master (see WatchUpgrade), in its
+// own session so it outlives the exec.
+func startWatchdog(backup, exe string) (*os.Process, error) {
+	cmd := exec.Command(backup, "upgrade-watchdog", "--pid", strconv.Itoa(os.Getpid()), "--exe", exe)
+	cmd.Env = masterEnv("", true)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
+
+// processAlive reports whether pid exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// childPIDs lists the processes whose parent is ppid, other than this one.
+func childPIDs(ppid int) []int {
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	var pids []int
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// pid (comm) state ppid ...; comm may contain spaces and parentheses
+		i := strings.LastIndexByte(string(data), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(data[i+1:]))
+		if len(fields) < 2 || fields[1] != strconv.Itoa(ppid) {
+			continue
+		}
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err == nil && pid != os.Getpid() {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
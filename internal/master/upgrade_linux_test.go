@@ -0,0 +1,91 @@
+//go:build linux
+
+package master
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessManager_AdoptRunningAgent(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pm, err := NewProcessManager(ctx)
+	require.NoError(t, err)
+
+	// An agent started by the previous master, with its output pipe handed over
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	cmd := exec.Command("sh", "-c", "echo adopted; exec sleep 60")
+	cmd.Stdout = w
+	require.NoError(t, cmd.Start())
+	w.Close()
+	fd, err := syscall.Dup(int(r.Fd()))
+	require.NoError(t, err)
+	r.Close()
+
+	pm.Adopt([]handoffChild{{
+		ProjectID: "app",
+		IPCDir:    t.TempDir(),
+		PID:       cmd.Process.Pid,
+		StartedAt: time.Now(),
+		StdoutFD:  fd,
+	}})
+
+	child := pm.GetChildren()["app"]
+	require.NotNil(t, child)
+	require.Equal(t, map[string]int{"app": cmd.Process.Pid}, pm.GetChildPIDs())
+	require.Eventually(t, func() bool {
+		log, _ := os.ReadFile(AgentLogPath("app"))
+		return strings.Contains(string(log), "adopted")
+	}, 5*time.Second, 50*time.Millisecond, "agent output goes to its log")
+
+	pm.Shutdown()
+	require.False(t, processAlive(cmd.Process.Pid), "adopted agent stopped")
+}
+
+func TestWatchUpgrade_deadMaster(t *testing.T) {
+	exe, _ := stubUpgrade(t, "2.0.0")
+	writeBackup(t, "old")
+	old := upgradeWatchInterval
+	upgradeWatchInterval = 10 * time.Millisecond
+	t.Cleanup(func() { upgradeWatchInterval = old })
+	now := time.Now()
+	require.NoError(t, writeUpgradeStatus(&UpgradeStatus{
+		State: UpgradePending, From: "1.0.0", To: "2.0.0", StartedAt: now, Deadline: now.Add(time.Minute),
+	}))
+	dead := exec.Command("true")
+	require.NoError(t, dead.Run())
+
+	require.NoError(t, WatchUpgrade(dead.Process.Pid, exe))
+
+	got, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(got), "previous binary restored")
+	st, err := ReadUpgradeStatus()
+	require.NoError(t, err)
+	require.Equal(t, UpgradeRolledBack, st.State)
+}
+
+func TestWatchUpgrade_committed(t *testing.T) {
+	exe, _ := stubUpgrade(t, "2.0.0")
+	writeBackup(t, "old")
+	old := upgradeWatchInterval
+	upgradeWatchInterval = 10 * time.Millisecond
+	t.Cleanup(func() { upgradeWatchInterval = old })
+	require.NoError(t, writeUpgradeStatus(&UpgradeStatus{State: UpgradeCommitted, From: "1.0.0", To: "2.0.0"}))
+
+	require.NoError(t, WatchUpgrade(os.Getpid(), exe))
+
+	got, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(got))
+}
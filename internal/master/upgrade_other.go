@@ -0,0 +1,34 @@
+//go:build !linux
+
+package master
+
+import (
+	"errors"
+	"os"
+)
+
+const selfUpgradeSupported = false
+
+var runningBinary = ""
+
+var errSelfUpgradeUnsupported = errors.New("self-upgrade is not supported on this platform")
+
+func setInheritable(f *os.File, inherit bool) (int, error) {
+	return 0, errSelfUpgradeUnsupported
+}
+
+func execBinary(exe string, argv, env []string) error {
+	return errSelfUpgradeUnsupported
+}
+
+func startWatchdog(backup, exe string) (*os.Process, error) {
+	return nil, errSelfUpgradeUnsupported
+}
+
+func processAlive(pid int) bool {
+	return false
+}
+
+func childPIDs(ppid int) []int {
+	return nil
+}
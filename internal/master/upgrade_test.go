@@ -0,0 +1,115 @@
+package master
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"beacon/internal/version"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stubUpgrade points the self-upgrade at a fake binary in a temp BEACON_HOME and records
+// the execs instead of running them. It returns the binary and the recorded exec paths.
+func stubUpgrade(t *testing.T, running string) (exe string, execs *[]string) {
+	t.Helper()
+	t.Setenv("BEACON_HOME", t.TempDir())
+	exe = filepath.Join(t.TempDir(), "beacon")
+	require.NoError(t, os.WriteFile(exe, []byte("new"), 0755))
+
+	oldVersion, oldExec, oldExe := version.Version, execMaster, masterExecutable
+	t.Cleanup(func() { version.Version, execMaster, masterExecutable = oldVersion, oldExec, oldExe })
+	version.Version = running
+	execs = new([]string)
+	execMaster = func(path string, argv, env []string) error {
+		*execs = append(*execs, path)
+		return nil
+	}
+	masterExecutable = func() (string, error) { return exe, nil }
+	return exe, execs
+}
+
+func writeBackup(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := upgradeDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	path := filepath.Join(dir, "beacon.previous")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0755))
+	return path
+}
+
+func TestRecoverUpgrade_rollsBackDeadMaster(t *testing.T) {
+	exe, execs := stubUpgrade(t, "2.0.0")
+	writeBackup(t, "old")
+	now := time.Now()
+	require.NoError(t, writeUpgradeStatus(&UpgradeStatus{
+		State: UpgradePending, From: "1.0.0", To: "2.0.0", StartedAt: now, Deadline: now.Add(time.Minute),
+	}))
+
+	recoverUpgrade()
+
+	got, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(got), "previous binary restored")
+	require.Equal(t, []string{exe}, *execs)
+	st, err := ReadUpgradeStatus()
+	require.NoError(t, err)
+	require.Equal(t, UpgradeRolledBack, st.State)
+	require.NotEmpty(t, st.Error)
+}
+
+func TestRecoverUpgrade_otherVersion(t *testing.T) {
+	// The previous binary already runs again (or someone installed another one): nothing
+	// to roll back
+	exe, execs := stubUpgrade(t, "1.0.0")
+	writeBackup(t, "old")
+	now := time.Now()
+	require.NoError(t, writeUpgradeStatus(&UpgradeStatus{
+		State: UpgradePending, From: "1.0.0", To: "2.0.0", StartedAt: now, Deadline: now.Add(time.Minute),
+	}))
+
+	recoverUpgrade()
+
+	got, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(got))
+	require.Empty(t, *execs)
+	st, err := ReadUpgradeStatus()
+	require.NoError(t, err)
+	require.Equal(t, UpgradeFailed, st.State)
+}
+
+func TestRecoverUpgrade_settled(t *testing.T) {
+	_, execs := stubUpgrade(t, "2.0.0")
+	writeBackup(t, "old")
+	require.NoError(t, writeUpgradeStatus(&UpgradeStatus{State: UpgradeCommitted, From: "1.0.0", To: "2.0.0"}))
+
+	recoverUpgrade()
+
+	require.Empty(t, *execs)
+	st, err := ReadUpgradeStatus()
+	require.NoError(t, err)
+	require.Equal(t, UpgradeCommitted, st.State)
+}
+
+func TestConfigReloader_upgradeFailedExec(t *testing.T) {
+	_, _ = stubUpgrade(t, "1.0.0")
+	execMaster = func(path string, argv, env []string) error { return os.ErrPermission }
+	r := &configReloader{eventLog: NewEventLog(), control: &controlServer{}}
+	r.upgrading.Store(true)
+	st := &UpgradeStatus{State: UpgradePending, From: "1.0.0", To: "2.0.0", StartedAt: time.Now()}
+
+	require.ErrorIs(t, r.upgrade(st), os.ErrPermission)
+
+	require.False(t, r.upgrading.Load(), "a new upgrade may be tried")
+	got, err := ReadUpgradeStatus()
+	require.NoError(t, err)
+	require.Equal(t, UpgradeFailed, got.State)
+	dir, err := upgradeDir()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "handoff.json"))
+	require.True(t, os.IsNotExist(err), "handoff file removed")
+}
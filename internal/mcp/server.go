@@ -41,6 +41,13 @@ type DiffInput struct {
 	To      string `json:"to" jsonschema:"Git ref"`
 }
 
+// HistoryInput for beacon_history
+type HistoryInput struct {
+	Project       string `json:"project" jsonschema:"Project name"`
+	Limit         int    `json:"limit,omitempty" jsonschema:"Max entries to return (default 10)"`
+	IncludeOutput bool   `json:"include_output,omitempty" jsonschema:"Include captured stdout/stderr"`
+}
+
 // DeployInput for beacon_deploy
 type DeployInput struct {
 	Project           string `json:"project" jsonschema:"Project name"`
@@ -48,6 +55,18 @@ type DeployInput struct {
 	ConfirmationToken string `json:"confirmation_token,omitempty" jsonschema:"Token from previous call to confirm"`
 }
 
+// PlanInput for beacon_plan
+type PlanInput struct {
+	Project string `json:"project" jsonschema:"Project name"`
+	Ref     string `json:"ref,omitempty" jsonschema:"Plan a deploy of this tag or ref instead of the deploy policy's choice"`
+}
+
+// ApproveInput for beacon_approve
+type ApproveInput struct {
+	Project           string `json:"project" jsonschema:"Project name"`
+	ConfirmationToken string `json:"confirmation_token,omitempty" jsonschema:"Token from previous call to confirm"`
+}
+
 // RestartInput for beacon_restart
 type RestartInput struct {
 	Project           string `json:"project" jsonschema:"Project name"`
@@ -267,9 +286,25 @@ func registerTools(server *mcp.Server, cfg *Config, backend *ToolBackend, wrap f
 		return nil, out.(DiffOutput), nil
 	})
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "beacon_history",
+		Description: "Show deploy history for a project (what changed and when)",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, in HistoryInput) (*mcp.CallToolResult, HistoryOutput, error) {
+		out, err := wrap("beacon_history", func() (any, error) {
+			if !cfg.IsToolAllowed("beacon_history") {
+				return nil, errToolNotAllowed
+			}
+			return backend.ToolHistory(in.Project, in.Limit, in.IncludeOutput)
+		})
+		if err != nil {
+			return nil, HistoryOutput{}, err
+		}
+		return nil, out.(HistoryOutput), nil
+	})
+
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "beacon_deploy",
-		Description: "Trigger deploy (gated; requires BEACON_MCP_DEPLOY_ENABLED=1 and confirmation)",
+		Description: "Trigger deploy (gated; requires BEACON_MCP_DEPLOY_ENABLED=1 and confirmation). Reports a deploy already in progress instead of starting another",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, in DeployInput) (*mcp.CallToolResult, DeployOutput, error) {
 		out, err := wrap("beacon_deploy", func() (any, error) {
 			if !cfg.IsToolAllowed("beacon_deploy") {
@@ -283,6 +318,38 @@ func registerTools(server *mcp.Server, cfg *Config, backend *ToolBackend, wrap f
 		return nil, out.(DeployOutput), nil
 	})
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "beacon_plan",
+		Description: "Dry-run the next deploy: current vs candidate release, commits and diffstat, images to pull with sizes, stages to run, and checks that would block it. Does not deploy, change the checkout or run the gate's ready command; the Git repository is fetched only while no deploy is running",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, in PlanInput) (*mcp.CallToolResult, PlanOutput, error) {
+		out, err := wrap("beacon_plan", func() (any, error) {
+			if !cfg.IsToolAllowed("beacon_plan") {
+				return nil, errToolNotAllowed
+			}
+			return backend.ToolPlan(in.Project, in.Ref)
+		})
+		if err != nil {
+			return nil, PlanOutput{}, err
+		}
+		return nil, out.(PlanOutput), nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "beacon_approve",
+		Description: "Approve the release held by a project's deploy gate (gated; requires BEACON_MCP_DEPLOY_ENABLED=1 and confirmation). The first call lists the held releases",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, in ApproveInput) (*mcp.CallToolResult, ApproveOutput, error) {
+		out, err := wrap("beacon_approve", func() (any, error) {
+			if !cfg.IsToolAllowed("beacon_approve") {
+				return nil, errToolNotAllowed
+			}
+			return backend.ToolApprove(in.Project, in.ConfirmationToken)
+		})
+		if err != nil {
+			return nil, ApproveOutput{}, err
+		}
+		return nil, out.(ApproveOutput), nil
+	})
+
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "beacon_restart",
 		Description: "Restart deploy or monitor service (gated; requires BEACON_MCP_RESTART_ENABLED=1 and confirmation)",
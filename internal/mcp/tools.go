@@ -1,8 +1,8 @@
 package mcp
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -15,6 +15,7 @@ import (
 	"beacon/internal/projects"
 	"beacon/internal/state"
 	"beacon/internal/systemd"
+	"beacon/internal/util"
 )
 
 // ToolBackend provides data access for MCP tools
@@ -34,7 +35,10 @@ type InventoryOutput struct {
 type StatusOutput struct {
 	Project   string    `json:"project"`
 	UpdatedAt time.Time `json:"updated_at"`
-	Checks    []struct {
+	// Deploy and QueuedDeploy describe a running and a waiting deploy (single project only).
+	Deploy       *state.DeployProgress `json:"deploy,omitempty"`
+	QueuedDeploy *state.DeployRequest  `json:"queued_deploy,omitempty"`
+	Checks       []struct {
 		Name   string `json:"name"`
 		Status string `json:"status"`
 		Error  string `json:"error,omitempty"`
@@ -55,13 +59,33 @@ type DiffOutput struct {
 	Diff    string `json:"diff"`
 }
 
+// HistoryOutput is the result of beacon_history
+type HistoryOutput struct {
+	Project string               `json:"project"`
+	Deploys []state.DeployRecord `json:"deploys"`
+}
+
 // DeployOutput is the result of beacon_deploy
 type DeployOutput struct {
 	Message           string `json:"message"`
 	ConfirmationToken string `json:"confirmation_token,omitempty"`
 	Deployed          bool   `json:"deployed,omitempty"`
+	// InProgress is set when another deploy of the project is running; nothing was started.
+	InProgress bool                  `json:"in_progress,omitempty"`
+	Running    *state.DeployProgress `json:"running,omitempty"`
+}
+
+// ApproveOutput is the result of beacon_approve
+type ApproveOutput struct {
+	Message           string                 `json:"message"`
+	ConfirmationToken string                 `json:"confirmation_token,omitempty"`
+	Approved          bool                   `json:"approved,omitempty"`
+	Pending           []state.PendingRelease `json:"pending,omitempty"`
 }
 
+// PlanOutput is the result of beacon_plan
+type PlanOutput = deploy.Plan
+
 // RestartOutput is the result of beacon_restart
 type RestartOutput struct {
 	Message           string `json:"message"`
@@ -144,6 +168,12 @@ func (b *ToolBackend) ToolStatus(project string) (StatusOutput, error) {
 			break
 		}
 	}
+	if project != "" {
+		dir := b.Paths.GetProjectStateDir(project)
+		out.Project = project
+		out.Deploy, _ = state.ReadDeployProgress(dir)
+		out.QueuedDeploy, _ = state.ReadDeployRequest(dir)
+	}
 	return out, nil
 }
 
@@ -224,6 +254,32 @@ func (b *ToolBackend) ToolDiff(project, from, to string) (DiffOutput, error) {
 	return DiffOutput{Project: project, From: from, To: to, Diff: diff}, nil
 }
 
+const defaultHistoryLimit = 10
+
+func (b *ToolBackend) ToolHistory(project string, limit int, includeOutput bool) (HistoryOutput, error) {
+	names, err := b.projectNames()
+	if err != nil {
+		return HistoryOutput{}, err
+	}
+	if err := ValidateProjectName(project, names); err != nil {
+		return HistoryOutput{}, err
+	}
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	records, err := state.NewHistory(b.Paths.GetProjectStateDir(project)).List(limit)
+	if err != nil {
+		return HistoryOutput{}, err
+	}
+	if !includeOutput {
+		for i := range records {
+			records[i] = records[i].Summary()
+		}
+	}
+	return HistoryOutput{Project: project, Deploys: records}, nil
+}
+
 func (b *ToolBackend) ToolDeploy(project, ref, confirmationToken string) (DeployOutput, error) {
 	if !b.Config.DeployEnabled {
 		return DeployOutput{Message: "deploy is disabled; set BEACON_MCP_DEPLOY_ENABLED=1 to enable"}, nil
@@ -245,6 +301,11 @@ func (b *ToolBackend) ToolDeploy(project, ref, confirmationToken string) (Deploy
 		}
 	}
 
+	// Report a running deploy instead of racing it (or handing out a token that would)
+	if running, _ := state.ReadDeployProgress(b.Paths.GetProjectStateDir(project)); running != nil {
+		return busyDeployOutput(&deploy.BusyError{Progress: running}), nil
+	}
+
 	if confirmationToken != "" {
 		tool, args, err := b.Confirm.Confirm(confirmationToken)
 		if err != nil {
@@ -256,18 +317,19 @@ func (b *ToolBackend) ToolDeploy(project, ref, confirmationToken string) (Deploy
 		project = args["project"].(string)
 		refVal, _ := args["ref"].(string)
 
-		envPath := b.Paths.GetProjectEnvFile(project)
-		if err := configLoadEnv(envPath); err != nil {
+		cfg, st, err := b.loadProjectConfig(project)
+		if err != nil {
 			return DeployOutput{}, err
 		}
-		_ = os.Setenv("BEACON_PROJECT_NAME", project)
-		cfg := config.Load()
-		base, berr := config.BeaconHomeDir()
-		if berr != nil {
-			base = filepath.Join(os.Getenv("HOME"), ".beacon")
+		lock, err := deploy.TryLock(cfg)
+		var busy *deploy.BusyError
+		if errors.As(err, &busy) {
+			return busyDeployOutput(busy), nil
+		}
+		if err != nil {
+			return DeployOutput{}, err
 		}
-		statusPath := filepath.Join(base, cfg.ProjectDir)
-		st := state.NewStatus(statusPath)
+		defer lock.Unlock()
 		if err := deployProject(cfg, refVal, st); err != nil {
 			return DeployOutput{}, err
 		}
@@ -284,6 +346,95 @@ func (b *ToolBackend) ToolDeploy(project, ref, confirmationToken string) (Deploy
 	}, nil
 }
 
+func (b *ToolBackend) ToolApprove(project, confirmationToken string) (ApproveOutput, error) {
+	if !b.Config.DeployEnabled {
+		return ApproveOutput{Message: "approve is disabled; set BEACON_MCP_DEPLOY_ENABLED=1 to enable"}, nil
+	}
+	if !b.RateLimit.Allow("beacon_approve") {
+		return ApproveOutput{}, fmt.Errorf("rate limited; try again later")
+	}
+
+	names, err := b.projectNames()
+	if err != nil {
+		return ApproveOutput{}, err
+	}
+	if err := ValidateProjectName(project, names); err != nil {
+		return ApproveOutput{}, err
+	}
+
+	if confirmationToken != "" {
+		tool, args, err := b.Confirm.Confirm(confirmationToken)
+		if err != nil {
+			return ApproveOutput{}, err
+		}
+		if tool != "beacon_approve" {
+			return ApproveOutput{}, fmt.Errorf("token is for %s, not approve", tool)
+		}
+		cfg, _, err := b.loadProjectConfig(args["project"].(string))
+		if err != nil {
+			return ApproveOutput{}, err
+		}
+		approved, err := deploy.ApproveReleases(cfg, state.TriggerMCP)
+		if err != nil {
+			return ApproveOutput{}, err
+		}
+		if len(approved) == 0 {
+			return ApproveOutput{Message: "no releases are held"}, nil
+		}
+		return ApproveOutput{Message: "approved; the next poll deploys inside a deploy window", Approved: true, Pending: approved}, nil
+	}
+
+	cfg, _, err := b.loadProjectConfig(project)
+	if err != nil {
+		return ApproveOutput{}, err
+	}
+	pending, err := deploy.PendingReleases(cfg)
+	if err != nil {
+		return ApproveOutput{}, err
+	}
+	if len(pending) == 0 {
+		return ApproveOutput{Message: "no releases are held"}, nil
+	}
+	token, err := b.Confirm.CreateToken("beacon_approve", map[string]any{"project": project})
+	if err != nil {
+		return ApproveOutput{}, err
+	}
+	return ApproveOutput{
+		Message:           "approval requires confirmation; call again with confirmation_token",
+		ConfirmationToken: token,
+		Pending:           pending,
+	}, nil
+}
+
+func (b *ToolBackend) ToolPlan(project, ref string) (PlanOutput, error) {
+	if !b.RateLimit.Allow("beacon_plan") {
+		return PlanOutput{}, fmt.Errorf("rate limited; try again later")
+	}
+
+	names, err := b.projectNames()
+	if err != nil {
+		return PlanOutput{}, err
+	}
+	if err := ValidateProjectName(project, names); err != nil {
+		return PlanOutput{}, err
+	}
+	if ref != "" {
+		if err := ValidateGitRef(ref); err != nil {
+			return PlanOutput{}, err
+		}
+	}
+
+	cfg, st, err := b.loadProjectConfig(project)
+	if err != nil {
+		return PlanOutput{}, err
+	}
+	plan, err := deploy.PlanDeploy(cfg, ref, st)
+	if err != nil {
+		return PlanOutput{}, err
+	}
+	return *plan, nil
+}
+
 func (b *ToolBackend) ToolRestart(project, service, confirmationToken string) (RestartOutput, error) {
 	if !b.Config.RestartEnabled {
 		return RestartOutput{Message: "restart is disabled; set BEACON_MCP_RESTART_ENABLED=1 to enable"}, nil
@@ -330,35 +481,38 @@ func (b *ToolBackend) ToolRestart(project, service, confirmationToken string) (R
 	}, nil
 }
 
-func configLoadEnv(envPath string) error {
-	f, err := os.Open(envPath)
+// loadProjectConfig returns the project's deploy config, read from its env file without
+// changing the process environment, and its status.
+func (b *ToolBackend) loadProjectConfig(project string) (*config.Config, *state.Status, error) {
+	env, err := util.ParseEnvFile(b.Paths.GetProjectEnvFile(project))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer func() { _ = f.Close() }()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		if len(value) >= 2 && ((value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'')) {
-			value = value[1 : len(value)-1]
-		}
-		value = os.ExpandEnv(value)
-		_ = os.Setenv(key, value)
+	env["BEACON_PROJECT_NAME"] = project
+	cfg := config.LoadFromEnv(env)
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		base = filepath.Join(os.Getenv("HOME"), ".beacon")
+	}
+	return cfg, state.NewStatus(filepath.Join(base, cfg.ProjectDir)), nil
+}
+
+func busyDeployOutput(busy *deploy.BusyError) DeployOutput {
+	return DeployOutput{
+		Message:    busy.Error() + "; try again when it has finished",
+		InProgress: true,
+		Running:    busy.Progress,
 	}
-	return scanner.Err()
 }
 
 func deployProject(cfg *config.Config, tag string, st *state.Status) error {
-	return deploy.Deploy(cfg, tag, st)
+	switch cfg.DeploymentType {
+	case "compose":
+		return deploy.DeployCompose(cfg, st, state.TriggerMCP)
+	case "artifact":
+		return deploy.DeployArtifact(cfg, tag, st, state.TriggerMCP)
+	}
+	return deploy.Deploy(cfg, tag, st, state.TriggerMCP)
 }
 
 func restartSystemdService(projectName string) error {
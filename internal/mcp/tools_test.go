@@ -8,9 +8,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"beacon/internal/config"
 	"beacon/internal/projects"
+	"beacon/internal/state"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -168,3 +170,83 @@ func TestMCPTools_Status(t *testing.T) {
 		t.Fatal("no TextContent in result")
 	}
 }
+
+func TestMCPTools_DeployReportsInProgress(t *testing.T) {
+	homeDir := t.TempDir()
+	paths := config.NewBeaconPathsFromBase(homeDir)
+	if err := paths.EnsureDirectories(); err != nil {
+		t.Fatalf("EnsureDirectories: %v", err)
+	}
+	if err := projects.SaveInventory(paths.GetProjectsFilePath(), &projects.Inventory{
+		Projects: []projects.ProjectEntry{
+			{Name: "testproj", Location: filepath.Join(homeDir, "beacon", "testproj"), ConfigDir: paths.GetProjectConfigDir("testproj")},
+		},
+	}); err != nil {
+		t.Fatalf("SaveInventory: %v", err)
+	}
+	err := state.WriteDeployProgress(paths.GetProjectStateDir("testproj"), state.DeployProgress{
+		ID: "d1", PID: os.Getpid(), Trigger: state.TriggerPoll, Stage: "migrate", StageStartedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("WriteDeployProgress: %v", err)
+	}
+
+	_, backend, err := NewServerAndBackend(homeDir)
+	if err != nil {
+		t.Fatalf("NewServerAndBackend: %v", err)
+	}
+	backend.Config.DeployEnabled = true
+
+	out, err := backend.ToolDeploy("testproj", "", "")
+	if err != nil {
+		t.Fatalf("ToolDeploy: %v", err)
+	}
+	if !out.InProgress || out.ConfirmationToken != "" || out.Running == nil || out.Running.Stage != "migrate" {
+		t.Errorf("ToolDeploy = %+v, want in-progress report without token", out)
+	}
+
+	status, err := backend.ToolStatus("testproj")
+	if err != nil {
+		t.Fatalf("ToolStatus: %v", err)
+	}
+	if status.Deploy == nil || status.Deploy.Stage != "migrate" {
+		t.Errorf("ToolStatus deploy = %+v", status.Deploy)
+	}
+}
+
+func TestMCPTools_LoadProjectConfigLeavesEnvironment(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("BEACON_HOME", homeDir)
+	t.Setenv("BEACON_PROJECT_NAME", "other")
+	paths := config.NewBeaconPathsFromBase(homeDir)
+	if err := paths.EnsureDirectories(); err != nil {
+		t.Fatalf("EnsureDirectories: %v", err)
+	}
+	envFile := paths.GetProjectEnvFile("testproj")
+	localPath := filepath.Join(homeDir, "beacon", "testproj")
+	if err := os.MkdirAll(filepath.Dir(envFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := "BEACON_DEPLOYMENT_TYPE=artifact\nBEACON_LOCAL_PATH=" + localPath + "\nBEACON_DEPLOY_CMD=\"./deploy.sh\"\nBEACON_TEST_ONLY=1\n"
+	if err := os.WriteFile(envFile, []byte(env), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, backend, err := NewServerAndBackend(homeDir)
+	if err != nil {
+		t.Fatalf("NewServerAndBackend: %v", err)
+	}
+	cfg, _, err := backend.loadProjectConfig("testproj")
+	if err != nil {
+		t.Fatalf("loadProjectConfig: %v", err)
+	}
+	if cfg.DeploymentType != "artifact" || cfg.LocalPath != localPath || cfg.DeployCommand != "./deploy.sh" || cfg.ProjectName != "testproj" {
+		t.Errorf("config = %+v", cfg)
+	}
+	if got := os.Getenv("BEACON_PROJECT_NAME"); got != "other" {
+		t.Errorf("BEACON_PROJECT_NAME = %q, want the process's own", got)
+	}
+	if _, ok := os.LookupEnv("BEACON_TEST_ONLY"); ok {
+		t.Error("the project env file was loaded into the process environment")
+	}
+}
@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"beacon/internal/cloud"
+	"beacon/internal/identity"
+	"beacon/internal/state"
+)
+
+// checkTransition is a check changing status while the cloud was unreachable.
+type checkTransition struct {
+	Project   string    `json:"project,omitempty"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// openSpool opens ~/.beacon/state/<project>/cloud_spool, where reports the cloud did not
+// receive wait to be backfilled. Without a spool they are dropped, as before.
+func (m *Monitor) openSpool(uc *identity.UserConfig) {
+	var ob *identity.OfflineBufferConfig
+	if uc != nil {
+		ob = uc.OfflineBuffer
+	}
+	m.spoolEnabled = ob.EffectiveEnabled()
+	dir := filepath.Join(getConfigDir(), "state", m.getProjectNameFromConfigPath(), "cloud_spool")
+	sp, err := state.OpenSpool(dir, state.SpoolOptions{
+		MaxBytes: int64(ob.EffectiveMaxSizeMB()) << 20,
+		MaxAge:   ob.EffectiveMaxAge(),
+	})
+	if err != nil {
+		logger.Infof("Offline buffer: %v (reports the cloud misses are lost)", err)
+		return
+	}
+	m.spool = sp
+}
+
+// spoolReport keeps a report the cloud did not receive for backfill.
+func (m *Monitor) spoolReport(kind string, recordedAt time.Time, data any) bool {
+	if m.spool == nil || !m.spoolEnabled {
+		return false
+	}
+	if err := m.spool.Append(kind, recordedAt, data); err != nil {
+		logger.Infof("Offline buffer: %v", err)
+		return false
+	}
+	return true
+}
+
+// spoolCheckTransition records a check changing status while the cloud is unreachable,
+// so the outage timeline survives between heartbeat snapshots.
+func (m *Monitor) spoolCheckTransition(prev *CheckResult, result CheckResult) {
+	if prev == nil || prev.Status == result.Status || !m.cloudOffline.Load() {
+		return
+	}
+	m.spoolReport(state.SpoolCheckTransition, result.Timestamp, checkTransition{
+		Project:   m.getProjectNameFromConfigPath(),
+		Name:      result.Name,
+		Type:      result.Type,
+		From:      prev.Status,
+		To:        result.Status,
+		Error:     result.Error,
+		Timestamp: result.Timestamp,
+	})
+}
+
+// backfill sends spooled reports in the background after a report got through to the cloud.
+func (m *Monitor) backfill() {
+	if m.spool == nil {
+		return
+	}
+	hostname, _ := getHostname()
+	client := cloud.NewBackfillClient(strings.TrimSuffix(m.config.Report.SendTo, "/"), m.currentToken, m.config.Device.Name, hostname)
+	m.backfiller.Start(m.ctx, client, m.spool)
+}
@@ -2,6 +2,7 @@ package monitor
 
 import (
 	"beacon/internal/config"
+	"beacon/internal/container"
 	"beacon/internal/util"
 	"bufio"
 	"context"
@@ -26,6 +27,8 @@ const (
 	minLogFlushInterval     = 60 * time.Second
 	defaultLogFlushInterval = minLogFlushInterval
 	logPositionsFilename    = "log_positions.json"
+	logBufferSize           = 1000 // entries kept in memory for Tail
+	defaultTailLines        = 100
 )
 
 // logCursor is persisted per source+identifier (container or file path)
@@ -107,6 +110,7 @@ type LogManager struct {
 	pendingMux      sync.Mutex
 	flushTicker     *time.Ticker
 	flushStop       chan struct{}
+	localOnly       bool // keep entries in memory only (child agents), never forward
 }
 
 // getStateDir returns ~/.beacon/state for cursor persistence
@@ -138,6 +142,19 @@ func NewLogManager(config *Config, httpClient *http.Client, getAuthToken func()
 	return lm
 }
 
+// NewProjectLogManager creates a log manager that only keeps entries in memory for Tail, for
+// a child agent. Read cursors are persisted in the project's state dir so projects do not
+// share (and overwrite) each other's positions.
+func NewProjectLogManager(config *Config, stateDir string) *LogManager {
+	lm := NewLogManager(config, nil, nil)
+	if stateDir != "" {
+		_ = os.MkdirAll(stateDir, 0755)
+		lm.stateDir = stateDir
+	}
+	lm.localOnly = true
+	return lm
+}
+
 func (lm *LogManager) authSecret() string {
 	if lm.getAuthToken != nil {
 		return lm.getAuthToken()
@@ -146,7 +163,7 @@ func (lm *LogManager) authSecret() string {
 }
 
 func (lm *LogManager) canForwardLogs() bool {
-	if lm.config.Report.SendTo == "" {
+	if lm.localOnly || lm.config.Report.SendTo == "" {
 		return false
 	}
 	if lm.getAuthToken != nil {
@@ -704,36 +721,47 @@ func (lm *LogManager) runDockerLogCollection(collector *LogCollector) {
 	}
 }
 
-// collectDockerLogSince reads log entries from Docker containers since a specific timestamp
+// containerRuntime returns the runtime docker log sources are read through.
+func (lm *LogManager) containerRuntime() (*container.Runtime, error) {
+	cc := config.ContainerFromEnv(os.Getenv)
+	if lm.config != nil {
+		cc = cc.Override(&lm.config.Container)
+	}
+	return container.Detect(cc)
+}
+
+// collectDockerLogSince reads log entries from Docker or Podman containers since a specific timestamp
 func (lm *LogManager) collectDockerLogSince(source LogSource, since time.Time) []LogEntry {
 	var entries []LogEntry
 
+	rt, err := lm.containerRuntime()
+	if err != nil {
+		logger.Infof("Error reading container logs: %v", err)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
 	containers := source.Containers
 	if source.AllContainers {
 		// Get all running containers
-		cmd := exec.Command("docker", "ps", "--format", "{{.Names}}")
-		output, err := cmd.Output()
+		containers, err = rt.RunningContainers(ctx)
 		if err != nil {
-			logger.Infof("Error getting docker containers: %v", err)
+			logger.Infof("Error getting containers: %v", err)
 			return nil
 		}
-		containers = strings.Split(strings.TrimSpace(string(output)), "\n")
 	}
 
-	for _, container := range containers {
-		if container == "" {
+	for _, ctr := range containers {
+		if ctr == "" {
 			continue
 		}
 
-		// Use --since with timestamp instead of --tail
-		sinceStr := since.Format("2006-01-02T15:04:05")
-		args := []string{"logs", "--since", sinceStr, "--timestamps"}
-
-		// Add any additional docker options
+		// Extra options for `docker logs`; --tail and --since are ours
+		var extraArgs []string
 		if source.DockerOptions != "" {
 			optArgs := strings.Fields(source.DockerOptions)
 			// Filter out --tail and --since options to avoid conflicts
-			filteredOpts := []string{}
 			skipNext := false
 			for _, opt := range optArgs {
 				if skipNext {
@@ -747,16 +775,13 @@ func (lm *LogManager) collectDockerLogSince(source LogSource, since time.Time) [
 				if strings.HasPrefix(opt, "--tail=") || strings.HasPrefix(opt, "--since=") {
 					continue
 				}
-				filteredOpts = append(filteredOpts, opt)
+				extraArgs = append(extraArgs, opt)
 			}
-			args = append(args, filteredOpts...)
 		}
-		args = append(args, container)
 
-		cmd := exec.Command("docker", args...)
-		output, err := cmd.Output()
+		output, err := rt.Logs(ctx, ctr, since, extraArgs)
 		if err != nil {
-			logger.Infof("Error getting docker logs for %s: %v", container, err)
+			logger.Infof("Error getting container logs for %s: %v", ctr, err)
 			continue
 		}
 
@@ -774,7 +799,7 @@ func (lm *LogManager) collectDockerLogSince(source LogSource, since time.Time) [
 				entry := LogEntry{
 					Source:    source.Name,
 					Type:      source.Type,
-					Container: container,
+					Container: ctr,
 					Content:   logContent,
 					Timestamp: logTimestamp,
 					Level:     lm.detectLogLevel(logContent),
@@ -881,14 +906,21 @@ func (lm *LogManager) runCommandLogCollection(collector *LogCollector) {
 
 // collectCommandLog executes a command and collects its output as log entries
 func (lm *LogManager) collectCommandLog(source LogSource) []LogEntry {
+	env, err := lm.config.CommandEnv()
+	if err != nil {
+		logger.Infof("Error executing command log %s: %v", source.Command, err)
+		return nil
+	}
 	cmd := exec.Command("sh", "-c", source.Command)
+	cmd.Env = append(os.Environ(), env.Vars...)
 	output, err := cmd.Output()
 	if err != nil {
 		logger.Infof("Error executing command log %s: %v", source.Command, err)
 		return nil
 	}
 
-	lines := strings.Split(string(output), "\n")
+	// Secret values are redacted before lines are stored or forwarded
+	lines := strings.Split(env.Redact(string(output)), "\n")
 	var entries []LogEntry
 
 	for _, line := range lines {
@@ -1067,9 +1099,9 @@ func (lm *LogManager) addLogEntries(entries []LogEntry) {
 	lm.logsMux.Lock()
 	lm.logs = append(lm.logs, filteredEntries...)
 
-	// Keep only last 1000 log entries to prevent memory issues
-	if len(lm.logs) > 1000 {
-		lm.logs = lm.logs[len(lm.logs)-1000:]
+	// Keep only the last logBufferSize entries to prevent memory issues
+	if len(lm.logs) > logBufferSize {
+		lm.logs = lm.logs[len(lm.logs)-logBufferSize:]
 	}
 	lm.logsMux.Unlock()
 
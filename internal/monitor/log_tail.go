@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LogQuery selects entries from a log manager's in-memory buffer.
+type LogQuery struct {
+	Lines   int       // most recent matching entries to return (default 100)
+	Since   time.Time // only entries at or after this time
+	Grep    string    // regular expression the line must match
+	Sources []string  // only entries from these log sources (default: all)
+}
+
+// Tail returns the most recent buffered entries matching q, oldest first.
+func (lm *LogManager) Tail(q LogQuery) ([]LogEntry, error) {
+	var re *regexp.Regexp
+	if q.Grep != "" {
+		var err error
+		if re, err = regexp.Compile(q.Grep); err != nil {
+			return nil, fmt.Errorf("invalid grep pattern: %w", err)
+		}
+	}
+	lines := q.Lines
+	if lines <= 0 {
+		lines = defaultTailLines
+	}
+
+	lm.logsMux.RLock()
+	defer lm.logsMux.RUnlock()
+
+	var out []LogEntry
+	for i := len(lm.logs) - 1; i >= 0 && len(out) < lines; i-- {
+		e := lm.logs[i]
+		if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
+			continue
+		}
+		if len(q.Sources) > 0 && !slices.Contains(q.Sources, e.Source) {
+			continue
+		}
+		if re != nil && !re.MatchString(e.Content) && !re.MatchString(e.Container) {
+			continue
+		}
+		out = append(out, e)
+	}
+	slices.Reverse(out)
+	return out, nil
+}
+
+// FormatLogLine renders an entry as "<RFC 3339 time> [source/container] content".
+func FormatLogLine(e LogEntry) string {
+	origin := e.Source
+	if e.Container != "" {
+		origin += "/" + e.Container
+	}
+	return fmt.Sprintf("%s [%s] %s", e.Timestamp.UTC().Format(time.RFC3339), origin, e.Content)
+}
+
+// ParseLogSince parses a since value: an RFC 3339 time or a duration before now ("15m", "2h").
+func ParseLogSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid since %q (use a duration like 15m or an RFC 3339 time)", s)
+	}
+	return now.Add(-d), nil
+}
@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogManager_Tail(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	lm := NewProjectLogManager(&Config{Report: ReportConfig{SendTo: "https://cloud.example.com", Token: "tok"}}, "")
+	if lm.canForwardLogs() {
+		t.Fatal("project log manager would forward logs")
+	}
+
+	base := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	lm.addLogEntries([]LogEntry{
+		{Source: "app", Type: "file", Content: "started", Timestamp: base},
+		{Source: "app", Type: "file", Content: "ERROR db timeout", Timestamp: base.Add(time.Minute)},
+		{Source: "web", Type: "docker", Container: "proxy", Content: "GET /", Timestamp: base.Add(2 * time.Minute)},
+		{Source: "app", Type: "file", Content: "ERROR db refused", Timestamp: base.Add(3 * time.Minute)},
+	})
+
+	tests := []struct {
+		name string
+		q    LogQuery
+		want []string
+	}{
+		{"all", LogQuery{}, []string{"started", "ERROR db timeout", "GET /", "ERROR db refused"}},
+		{"last lines", LogQuery{Lines: 2}, []string{"GET /", "ERROR db refused"}},
+		{"since", LogQuery{Since: base.Add(90 * time.Second)}, []string{"GET /", "ERROR db refused"}},
+		{"grep", LogQuery{Grep: "ERROR db (timeout|refused)", Lines: 1}, []string{"ERROR db refused"}},
+		{"grep container", LogQuery{Grep: "^proxy$"}, []string{"GET /"}},
+		{"source", LogQuery{Sources: []string{"web"}}, []string{"GET /"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := lm.Tail(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Content)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Tail(%+v) = %q, want %q", tt.q, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := lm.Tail(LogQuery{Grep: "("}); err == nil {
+		t.Error("invalid grep pattern accepted")
+	}
+	if got := FormatLogLine(LogEntry{Source: "web", Container: "proxy", Content: "GET /", Timestamp: base}); got != "2026-10-18T10:00:00Z [web/proxy] GET /" {
+		t.Errorf("FormatLogLine = %q", got)
+	}
+}
+
+func TestProjectLogManager_cursorInStateDir(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	stateDir := filepath.Join(t.TempDir(), "state", "app")
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(logFile, []byte("2026-10-18T10:00:00Z boot\n"), 0644)
+
+	lm := NewProjectLogManager(&Config{LogSources: []LogSource{
+		{Name: "app", Type: "file", Enabled: true, FilePath: logFile, Interval: 50 * time.Millisecond},
+	}}, stateDir)
+	lm.StartLogCollection(context.Background())
+	time.Sleep(150 * time.Millisecond)
+	lm.StopLogCollection()
+
+	if entries, _ := lm.Tail(LogQuery{Sources: []string{"app"}}); len(entries) != 1 || entries[0].Content != "boot" {
+		t.Errorf("entries = %+v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, logPositionsFilename)); err != nil {
+		t.Errorf("cursor not saved in project state dir: %v", err)
+	}
+}
+
+func TestParseLogSince(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for in, want := range map[string]time.Time{
+		"":                     {},
+		"15m":                  now.Add(-15 * time.Minute),
+		"2026-10-18T09:30:00Z": time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC),
+	} {
+		if got, err := ParseLogSince(in, now); err != nil || !got.Equal(want) {
+			t.Errorf("ParseLogSince(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"yesterday", "-5m"} {
+		if _, err := ParseLogSince(in, now); err == nil {
+			t.Errorf("ParseLogSince(%q) accepted", in)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -54,6 +55,19 @@ type Config struct {
 	Plugins       []plugins.PluginConfig `yaml:"plugins,omitempty"`
 	AlertRules    []plugins.AlertRule    `yaml:"alert_rules,omitempty"`
 	Report        ReportConfig           `yaml:"report"`
+	// Env is passed to command checks, alert commands and command log sources. Values of
+	// the form key://<name> are decrypted from the key store and redacted from output.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Container selects the runtime for docker log sources (default: auto-detect, as for deploys)
+	Container config.ContainerConfig `yaml:"container,omitempty"`
+}
+
+// CommandEnv resolves Env for a command run by a check, alert or log source.
+func (c *Config) CommandEnv() (*keys.Env, error) {
+	if c == nil {
+		return &keys.Env{}, nil
+	}
+	return keys.ResolveEnv(c.Env)
 }
 
 type CheckConfig struct {
@@ -66,6 +80,7 @@ type CheckConfig struct {
 	Interval     time.Duration `yaml:"interval"`
 	ExpectStatus int           `yaml:"expect_status,omitempty"`
 	AlertCommand string        `yaml:"alert_command,omitempty"`
+	LogSources   []string      `yaml:"log_sources,omitempty"` // log sources whose last lines are reported while the check fails (default: all)
 }
 
 type SystemMetricsConfig struct {
@@ -183,6 +198,12 @@ type Monitor struct {
 	agentIdentity             *identity.Identity
 	agentYAMLPath             string
 	userConfigPath            string
+
+	// Reports the cloud did not receive, backfilled when it is reachable again
+	spool        *state.Spool // nil when unavailable
+	spoolEnabled bool
+	cloudOffline atomic.Bool // the last report failed
+	backfiller   cloud.Backfiller
 }
 
 // LinuxSystemMetricsCollector implements SystemMetricsCollector for Linux systems
@@ -237,6 +258,9 @@ func LoadConfig(path string) (*Config, error) {
 		)
 		return nil, beaconErr
 	}
+	if err := cfg.Container.Validate(); err != nil {
+		return nil, errors.NewConfigError(path, err)
+	}
 
 	return &cfg, nil
 }
@@ -275,6 +299,10 @@ func NewMonitor(cfg *Config, configPath string) (*Monitor, error) {
 	applyUserConfigToMonitorConfig(cfg, uc)
 	ag, _ := identity.LoadAgent()
 	applyAgentIdentityToMonitorConfig(cfg, ag)
+	if configPath != "" {
+		// container: in monitor.yml wins over the project's deploy settings
+		cfg.Container = deploy.ProjectContainerConfig(filepath.Dir(configPath)).Override(&cfg.Container)
+	}
 	currentToken, err := resolveMonitorAuthToken(cfg, keyManager, ag, uc)
 	if err != nil {
 		cancel()
@@ -298,6 +326,7 @@ func NewMonitor(cfg *Config, configPath string) (*Monitor, error) {
 		userConfigPath:   userConfigPath,
 	}
 	m.logManager = NewLogManager(cfg, httpClient.Client, func() string { return m.currentToken })
+	m.backfiller.Logf = logger.Infof
 
 	return m, nil
 }
@@ -550,6 +579,12 @@ func (m *Monitor) Start() error {
 		go m.startPrometheusServer()
 	}
 
+	// Keep reports the cloud misses for backfill
+	if m.config.Report.SendTo != "" && m.currentToken != "" {
+		uc, _ := identity.LoadUserConfig()
+		m.openSpool(uc)
+	}
+
 	// Start heartbeat if enabled
 	if m.config.Report.Heartbeat.Enabled {
 		interval := m.config.Report.Heartbeat.Interval
@@ -610,6 +645,9 @@ func (m *Monitor) Start() error {
 
 	m.cancel()
 	wg.Wait()
+	if m.spool != nil {
+		util.Close(m.spool, "offline buffer")
+	}
 
 	return nil
 }
@@ -703,8 +741,10 @@ func (m *Monitor) executeCheck(check CheckConfig) {
 
 	// Store result
 	m.resultsMux.Lock()
+	prev := m.results[check.Name]
 	m.results[check.Name] = &result
 	m.resultsMux.Unlock()
+	m.spoolCheckTransition(prev, result)
 
 	// Persist check results for CLI (beacon projects list / status)
 	m.persistCheckResults()
@@ -873,18 +913,27 @@ func (m *Monitor) executeCommandCheck(check CheckConfig) CheckResult {
 		Timestamp: time.Now(),
 	}
 
+	env, err := m.config.CommandEnv()
+	if err != nil {
+		result.Status = "down"
+		result.Error = errors.FormatError(errors.NewBeaconError(errors.ErrorTypeConfig, "Failed to resolve command environment", err).
+			WithNextSteps("List stored secrets: beacon keys list", "Add the missing secret: beacon keys add --name <name> --key <value>"))
+		return result
+	}
+
 	cmd := exec.CommandContext(m.ctx, "sh", "-c", check.Cmd)
+	cmd.Env = append(os.Environ(), env.Vars...)
 
 	// Capture stdout and stderr
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 
-	// Always capture output, regardless of success/failure
-	result.CommandOutput = strings.TrimSpace(stdout.String())
-	result.CommandError = strings.TrimSpace(stderr.String())
+	// Always capture output, regardless of success/failure; secret values never leave the device
+	result.CommandOutput = env.Redact(strings.TrimSpace(stdout.String()))
+	result.CommandError = env.Redact(strings.TrimSpace(stderr.String()))
 
 	if err != nil {
 		result.Status = "down"
@@ -930,19 +979,26 @@ func (m *Monitor) executeAlertCommand(command string, result CheckResult) {
 			expandedCommand = strings.ReplaceAll(expandedCommand, "$BEACON_CHECK_OUTPUT", result.CommandOutput)
 		}
 
+		env, err := m.config.CommandEnv()
+		if err != nil {
+			logger.Infof("Alert command not run: %v", err)
+			return
+		}
+
 		cmd := exec.CommandContext(m.ctx, "sh", "-c", expandedCommand)
+		cmd.Env = append(os.Environ(), env.Vars...)
 
 		// Capture output for logging
 		var stdout, stderr bytes.Buffer
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
 
-		err := cmd.Run()
+		err = cmd.Run()
 
 		if err != nil {
-			logger.Infof("Alert command failed: %v, stderr: %s", err, stderr.String())
+			logger.Infof("Alert command failed: %v, stderr: %s", err, env.Redact(stderr.String()))
 		} else {
-			logger.Infof("Alert command executed successfully: %s", stdout.String())
+			logger.Infof("Alert command executed successfully: %s", env.Redact(stdout.String()))
 		}
 	}()
 }
@@ -1058,7 +1114,15 @@ func (m *Monitor) reportSystemMetrics() {
 		return
 	}
 	metricsURL := strings.TrimSuffix(m.config.Report.SendTo, "/") + "/agent/metrics"
-	m.sendToAPI(metricsURL, metrics)
+	if _, err := m.doAPIRequest(metricsURL, metrics); err != nil {
+		logger.Infof("Failed to send metrics: %v", err)
+		m.cloudOffline.Store(true)
+		m.spoolReport(state.SpoolMetrics, metrics.Timestamp, metrics)
+	} else {
+		logger.Infof("Successfully sent data to %s", metricsURL)
+		m.cloudOffline.Store(false)
+		m.backfill()
+	}
 	if m.config.Report.PrometheusFilePath != "" {
 		m.writePrometheusFile()
 	}
@@ -1122,8 +1186,17 @@ func (m *Monitor) sendHeartbeat() {
 	body, err := m.doAPIRequest(heartbeatURL, heartbeat)
 	if err != nil {
 		logger.Infof("Heartbeat request failed: %v", err)
+		m.cloudOffline.Store(true)
+		metrics := heartbeat.SystemMetrics
+		heartbeat.SystemMetrics = nil
+		if m.spoolReport(state.SpoolHeartbeat, time.Now(), heartbeat) && metrics != nil &&
+			m.spoolReport(state.SpoolMetrics, metrics.Timestamp, metrics) {
+			m.lastSystemMetricsSendAt = time.Now() // kept at the configured interval, as if sent
+		}
 		return
 	}
+	m.cloudOffline.Store(false)
+	m.backfill()
 	m.persistAgentDeviceIDIfNew(body)
 	if attachedSystemMetrics {
 		m.lastSystemMetricsSendAt = time.Now()
@@ -1164,6 +1237,9 @@ func (m *Monitor) doAPIRequest(url string, payload interface{}) ([]byte, error)
 	return body, rerr
 }
 
+// deployQueueTimeout bounds how long a cloud deploy request waits behind a running deploy.
+const deployQueueTimeout = 30 * time.Minute
+
 func (m *Monitor) runDeployRequested() deployResultPayload {
 	projectName := m.getProjectNameFromConfigPath()
 	envPath := filepath.Join(getConfigDir(), "config", "projects", projectName, "env")
@@ -1179,17 +1255,33 @@ func (m *Monitor) runDeployRequested() deployResultPayload {
 		return deployResultPayload{Success: false, Error: err.Error()}
 	}
 	status := state.NewStatus(statusDir)
+
+	// Wait behind a running deploy; a newer request supersedes this one
+	ctx, cancel := context.WithTimeout(context.Background(), deployQueueTimeout)
+	defer cancel()
+	lock, err := deploy.Acquire(ctx, cfg, state.TriggerCloud, "")
+	if err != nil {
+		logger.Infof("Deploy not started: %v", err)
+		return deployResultPayload{Success: false, Error: err.Error()}
+	}
+	defer lock.Unlock()
+
 	deploymentType := cfg.DeploymentType
 	if deploymentType == "" {
 		deploymentType = "git"
 	}
-	var err error
-	if deploymentType == "docker" {
-		deploy.CheckForNewImageTag(cfg, status)
+	switch deploymentType {
+	case "docker":
+		deploy.CheckForNewImageTag(cfg, status, state.TriggerCloud)
 		// CheckForNewImageTag does not return error; assume success
-	} else {
+	case "compose":
+		err = deploy.DeployCompose(cfg, status, state.TriggerCloud)
+	case "artifact":
+		lastTag, _ := status.Get()
+		err = deploy.DeployArtifact(cfg, lastTag, status, state.TriggerCloud)
+	default:
 		lastTag, _ := status.Get()
-		err = deploy.Deploy(cfg, lastTag, status)
+		err = deploy.Deploy(cfg, lastTag, status, state.TriggerCloud)
 	}
 	if err != nil {
 		logger.Infof("Deploy failed: %v", err)
@@ -1211,36 +1303,6 @@ func (m *Monitor) postDeployResult(result deployResultPayload) {
 	_, _ = m.doAPIRequest(url, payload)
 }
 
-func (m *Monitor) sendToAPI(url string, payload interface{}) {
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		logger.Infof("Failed to marshal payload: %v", err)
-		return
-	}
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
-	if err != nil {
-		logger.Infof("Failed to create API request: %v", err)
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	setAgentAuthHeaders(req, m.currentToken)
-
-	resp, err := m.httpClient.Do(m.ctx, req)
-	if err != nil {
-		logger.Infof("Failed to send to API: %v", err)
-		return
-	}
-	defer util.DeferClose(resp.Body, "HTTP response body")()
-
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		logger.Infof("Successfully sent data to %s", url)
-	} else {
-		logger.Infof("API request failed: HTTP %d", resp.StatusCode)
-	}
-}
-
 func (m *Monitor) startPrometheusServer() {
 	http.HandleFunc("/metrics", m.prometheusHandler)
 
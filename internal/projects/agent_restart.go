@@ -0,0 +1,92 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"beacon/internal/control"
+	"beacon/internal/identity"
+	"beacon/internal/ipc"
+
+	"github.com/spf13/cobra"
+)
+
+// agentRestartWait is how long agent-restart waits for the master to take the request.
+const agentRestartWait = 15 * time.Second
+
+func createAgentRestartCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "agent-restart <project-id>",
+		Short: "Restart a project's monitoring agent in the master",
+		Long: `Ask the running master (beacon start) to respawn the child agent of a
+project listed under projects: in ~/.beacon/config.yaml.
+
+Use it to revive an agent the master gave up on after too many crashes
+(max_restarts in the project's restart policy) or one that exited and was
+not respawned (policy on-failure or never). A running agent is stopped
+first. The restart count starts over.`,
+		Example: `  beacon projects agent-restart myapp`,
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := AgentRestart(args[0]); err != nil {
+				fmt.Printf("❌ Failed to restart agent: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// AgentRestart asks the master to respawn a project's child agent: over the control
+// socket, or with a request file that an older master picks up.
+func AgentRestart(projectID string) error {
+	uc, err := identity.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	if uc == nil || !hasMasterProject(uc, projectID) {
+		return fmt.Errorf("project %s is not in ~/.beacon/config.yaml projects", projectID)
+	}
+	if client, err := control.NewClient(); err == nil {
+		_, err := client.ProjectAction(context.Background(), projectID, control.ActionAgentRestart)
+		if err == nil {
+			fmt.Printf("✅ Master restarted the agent of %s\n", projectID)
+			return nil
+		}
+		if !errors.Is(err, control.ErrMasterNotRunning) {
+			return err
+		}
+	}
+
+	dir, err := ipc.ProjectIPCDir(projectID)
+	if err != nil {
+		return err
+	}
+	req := &ipc.AgentRestartRequest{RequestedBy: approver(), Timestamp: time.Now()}
+	if err := ipc.WriteAgentRestartRequest(dir, req); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(agentRestartWait)
+	for ipc.AgentRestartPending(dir) {
+		if time.Now().After(deadline) {
+			fmt.Printf("⏳ Restart of %s requested, but the master has not picked it up yet\n", projectID)
+			fmt.Println("   Is the master running? Check with: beacon status")
+			return nil
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	fmt.Printf("✅ Master is restarting the agent of %s\n", projectID)
+	return nil
+}
+
+func hasMasterProject(uc *identity.UserConfig, projectID string) bool {
+	for _, p := range uc.Projects {
+		if p.ID == projectID {
+			return true
+		}
+	}
+	return false
+}
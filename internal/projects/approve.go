@@ -0,0 +1,121 @@
+package projects
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"beacon/internal/config"
+	"beacon/internal/deploy"
+	"beacon/internal/state"
+
+	"github.com/spf13/cobra"
+)
+
+func createApproveCommand(pm *ProjectManager) *cobra.Command {
+	var list bool
+
+	cmd := &cobra.Command{
+		Use:   "approve <project-name>",
+		Short: "Approve the release the deploy gate is holding",
+		Long: `Approve the new release(s) held for a project with gate.require_approval
+set in its deploy.yml.
+
+The poll loop keeps detecting new releases but parks them until they are
+approved. Once approved, the next poll deploys the release, provided it is
+inside one of the project's deploy windows and gate.ready_command succeeds.
+A newer release replaces a pending one and needs its own approval.
+
+Use --list to show the held releases and why they are held without approving.`,
+		Example: `  beacon projects approve homeassistant
+  beacon projects approve homeassistant --list`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := pm.Approve(args[0], list); err != nil {
+				fmt.Printf("❌ Failed to approve: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&list, "list", false, "Only list held releases")
+	return cmd
+}
+
+// Approve approves (or with list, only shows) the releases held for a project.
+func (pm *ProjectManager) Approve(projectName string, list bool) error {
+	cfg, err := pm.loadDeployConfig(projectName)
+	if err != nil {
+		return err
+	}
+
+	var pending []state.PendingRelease
+	if list {
+		pending, err = deploy.PendingReleases(cfg)
+	} else {
+		pending, err = deploy.ApproveReleases(cfg, approver())
+	}
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Printf("No releases are held for %s\n", projectName)
+		if !cfg.Gate.Enabled() {
+			fmt.Println("  (no deploy gate is configured in deploy.yml)")
+		}
+		return nil
+	}
+
+	if !list {
+		fmt.Printf("✅ Approved %d release(s) for %s\n", len(pending), projectName)
+	}
+	for _, p := range pending {
+		fmt.Printf("\n  %s\n", pendingName(p))
+		fmt.Printf("    detected: %s\n", p.DetectedAt.Local().Format(time.RFC1123))
+		if p.Approved {
+			fmt.Printf("    approved: by %s at %s\n", p.ApprovedBy, p.ApprovedAt.Local().Format(time.RFC1123))
+		}
+		fmt.Printf("    status:   %s\n", deploy.DescribeHold(cfg, p))
+	}
+	printWindows(cfg.Gate)
+	return nil
+}
+
+// pendingName formats a held release for display.
+func pendingName(p state.PendingRelease) string {
+	name := p.Tag
+	if p.Image != "" {
+		name = p.Image + ":" + p.Tag
+	}
+	if name == "" {
+		name = "latest changes"
+	}
+	if len(p.Target) > 12 {
+		name += " (" + p.Target[:12] + ")"
+	}
+	return name
+}
+
+// printWindows lists the configured deploy windows.
+func printWindows(g *config.GateConfig) {
+	if g == nil || len(g.Windows) == 0 {
+		return
+	}
+	fmt.Printf("\nDeploy windows (%s):\n", g.Location())
+	for _, w := range g.Windows {
+		days := "every day"
+		if len(w.Days) > 0 {
+			days = fmt.Sprint(w.Days)
+		}
+		fmt.Printf("  %s–%s  %s\n", w.Start, w.End, days)
+	}
+}
+
+// approver names the user approving from the CLI.
+func approver() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return "cli:" + name
+}
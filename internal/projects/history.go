@@ -0,0 +1,175 @@
+package projects
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"beacon/internal/state"
+
+	"github.com/spf13/cobra"
+)
+
+func createHistoryCommand(pm *ProjectManager) *cobra.Command {
+	var limit int
+	var asJSON, showOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "history <project-name>",
+		Short: "Show the deploy history for a project",
+		Long: `Show the append-only deploy ledger for a project, newest first.
+
+Each entry records the tag or image digest, what triggered the deploy
+(poll, webhook, deploy_requested, mcp, cli_redeploy), start/end time, exit code
+and the commit range that was deployed.`,
+		Example: `  beacon projects history myapp
+  beacon projects history myapp --limit 5 --output
+  beacon projects history myapp --json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := pm.ShowHistory(args[0], limit, asJSON, showOutput); err != nil {
+				fmt.Printf("❌ Failed to show history: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Maximum number of entries to show (0 = all)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output raw JSON")
+	cmd.Flags().BoolVar(&showOutput, "output", false, "Include captured stdout/stderr")
+	return cmd
+}
+
+// DeployHistory returns up to limit deploy records for a project, newest first.
+func (pm *ProjectManager) DeployHistory(projectName string, limit int) ([]state.DeployRecord, error) {
+	if !pm.paths.ProjectExists(projectName) {
+		return nil, fmt.Errorf("project %q not found (run `beacon projects list` to see available projects)", projectName)
+	}
+	return state.NewHistory(pm.paths.GetProjectStateDir(projectName)).List(limit)
+}
+
+// ShowHistory prints the deploy history for a project.
+func (pm *ProjectManager) ShowHistory(projectName string, limit int, asJSON, showOutput bool) error {
+	records, err := pm.DeployHistory(projectName, limit)
+	if err != nil {
+		return err
+	}
+
+	if !showOutput {
+		for i := range records {
+			records[i] = records[i].Summary()
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+
+	if len(records) == 0 {
+		fmt.Printf("No deploys recorded for %s\n", projectName)
+		return nil
+	}
+
+	fmt.Printf("Deploy history for %s:\n\n", projectName)
+	for _, r := range records {
+		result := "✅"
+		if r.Refused {
+			result = "⛔ refused (signature)"
+		} else if !r.Success {
+			result = fmt.Sprintf("❌ exit %d", r.ExitCode)
+		}
+		version := r.Tag
+		if version == "" {
+			version = "default"
+		}
+		if r.Image != "" {
+			version = r.Image + ":" + version
+		}
+		fmt.Printf("%s  %-14s %s  %s (%s)\n",
+			r.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			r.Trigger, result, version, (time.Duration(r.DurationMs) * time.Millisecond).String())
+		if r.PreviousTag != "" && r.PreviousTag != r.Tag {
+			fmt.Printf("    previous: %s\n", r.PreviousTag)
+		}
+		if cr := r.CommitRange(); cr != "" {
+			fmt.Printf("    commits:  %s\n", cr)
+		}
+		if r.Asset != "" {
+			fmt.Printf("    asset:    %s\n", r.Asset)
+		}
+		if r.Digest != "" {
+			fmt.Printf("    digest:   %s\n", r.Digest)
+		}
+		if r.Signature != "" {
+			fmt.Printf("    signed:   %s\n", r.Signature)
+		}
+		if r.FetchDurationMs > 0 {
+			fmt.Printf("    fetch:    %s in %s\n", humanBytes(r.FetchBytes), (time.Duration(r.FetchDurationMs) * time.Millisecond).String())
+		}
+		if r.Error != "" {
+			fmt.Printf("    error:    %s\n", r.Error)
+		}
+		if len(r.Stages) > 1 {
+			printStages(r.Stages)
+		}
+		if showOutput {
+			printIndented("stdout", r.Stdout)
+			printIndented("stderr", r.Stderr)
+		}
+	}
+	return nil
+}
+
+// printStages lists pipeline stages with their outcome and log file.
+func printStages(stages []state.StageRecord) {
+	fmt.Printf("    stages:\n")
+	for _, st := range stages {
+		var result string
+		switch {
+		case st.Skipped:
+			result = "skipped"
+		case st.TimedOut:
+			result = "❌ timed out"
+		case !st.Success:
+			result = fmt.Sprintf("❌ exit %d", st.ExitCode)
+		default:
+			result = "✅"
+		}
+		if st.Skipped {
+			fmt.Printf("      %-12s %s\n", st.Name, result)
+			continue
+		}
+		fmt.Printf("      %-12s %s (%s)\n", st.Name, result, (time.Duration(st.DurationMs) * time.Millisecond).String())
+		if st.LogFile != "" && !st.Success {
+			fmt.Printf("      %-12s log: %s\n", "", st.LogFile)
+		}
+	}
+}
+
+func printIndented(label, text string) {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return
+	}
+	fmt.Printf("    %s:\n", label)
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Printf("      %s\n", line)
+	}
+}
+
+// humanBytes formats a byte count with binary units (e.g. "1.5 MiB").
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for x := n / unit; x >= unit; x /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -50,7 +50,11 @@ Beacon projects in a consistent way.`,
   beacon projects status
   beacon projects status myapp
   beacon projects remove myapp
-  beacon projects info myapp`,
+  beacon projects info myapp
+  beacon projects history myapp
+  beacon projects plan myapp
+  beacon projects approve myapp
+  beacon projects agent-restart myapp`,
 	}
 
 	projectCmd.AddCommand(createListCommand(pm))
@@ -60,6 +64,10 @@ Beacon projects in a consistent way.`,
 	projectCmd.AddCommand(createInfoCommand(pm))
 	projectCmd.AddCommand(createCleanCommand(pm))
 	projectCmd.AddCommand(createRedeployCommand(pm))
+	projectCmd.AddCommand(createHistoryCommand(pm))
+	projectCmd.AddCommand(createPlanCommand(pm))
+	projectCmd.AddCommand(createApproveCommand(pm))
+	projectCmd.AddCommand(createAgentRestartCommand())
 
 	return projectCmd
 }
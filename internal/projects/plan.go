@@ -0,0 +1,184 @@
+package projects
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"beacon/internal/deploy"
+
+	"github.com/spf13/cobra"
+)
+
+func createPlanCommand(pm *ProjectManager) *cobra.Command {
+	var ref string
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "plan <project-name>",
+		Short: "Show what the next deploy would do, without deploying",
+		Long: `Resolve exactly what the next deploy of a project would do, without doing it.
+
+Shows the deployed release against the candidate the deploy policy selects (or
+--ref), the commits and changed files between them for Git projects, the images
+that would be pulled with their download size, the artifact that would be
+downloaded, the stages that would run, and the checks that would hold or
+refuse the deploy (signatures, checksums, secrets, deploy windows, approval, a
+running deploy, health).
+
+Nothing is checked out, pulled or run, except gate.ready_command. For Git projects the project's mirror
+is refreshed, as the next deploy would do anyway.`,
+		Example: `  beacon projects plan myapp
+  beacon projects plan myapp --ref v1.4.0
+  beacon projects plan myapp --json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := pm.ShowPlan(args[0], ref, asJSON); err != nil {
+				fmt.Printf("❌ Failed to plan deploy: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&ref, "ref", "", "Plan a deploy of this tag, branch or commit instead of the policy's choice")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output raw JSON")
+	return cmd
+}
+
+// PlanDeploy resolves what the next deploy of a project would do.
+func (pm *ProjectManager) PlanDeploy(projectName, ref string) (*deploy.Plan, error) {
+	cfg, err := pm.loadDeployConfig(projectName)
+	if err != nil {
+		return nil, err
+	}
+	return deploy.PlanDeploy(cfg, ref, projectStatus(cfg))
+}
+
+// ShowPlan prints the deploy plan for a project.
+func (pm *ProjectManager) ShowPlan(projectName, ref string, asJSON bool) error {
+	plan, err := pm.PlanDeploy(projectName, ref)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	fmt.Printf("Deploy plan for %s (%s):\n\n", projectName, plan.Type)
+	fmt.Printf("  current:   %s\n", planRelease(plan.Current, "nothing deployed"))
+	fmt.Printf("  candidate: %s\n", planRelease(plan.Candidate, "default branch"))
+
+	if len(plan.Commits) > 0 {
+		more := ""
+		if plan.CommitsTruncated {
+			more = "+"
+		}
+		fmt.Printf("\nCommits (%d%s):\n", len(plan.Commits), more)
+		for _, c := range plan.Commits {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+	if plan.DiffStat != "" {
+		fmt.Printf("\nChanges:\n")
+		for _, line := range strings.Split(plan.DiffStat, "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+
+	if len(plan.Images) > 0 {
+		fmt.Printf("\nImages:\n")
+		for _, img := range plan.Images {
+			action := "unchanged"
+			switch {
+			case img.Error != "":
+				action = "❌ " + img.Error
+			case img.Pull && img.Size > 0:
+				action = "pull " + humanBytes(img.Size)
+			case img.Pull:
+				action = "pull"
+			}
+			fmt.Printf("  %s:%s  %s\n", img.Image, img.Tag, action)
+			if img.Pull && img.CurrentDigest != "" && img.Digest != "" {
+				fmt.Printf("    %s -> %s\n", shortDigest(img.CurrentDigest), shortDigest(img.Digest))
+			}
+		}
+	}
+
+	fmt.Printf("\nStages:\n")
+	for _, st := range plan.Stages {
+		switch {
+		case st.Command == "":
+			fmt.Printf("  %-12s (built-in) %s\n", st.Name, st.Description)
+		default:
+			extra := "timeout " + st.Timeout
+			if st.ContinueOnError {
+				extra += ", continue on error"
+			}
+			if st.Name == "on_failure" {
+				extra += ", only if a stage fails"
+			}
+			fmt.Printf("  %-12s %s  (%s)\n", st.Name, st.Command, extra)
+		}
+	}
+
+	fmt.Printf("\nChecks:\n")
+	for _, c := range plan.Checks {
+		icon := map[string]string{deploy.PlanPass: "✅", deploy.PlanWarn: "⚠️ ", deploy.PlanBlock: "⛔", deploy.PlanHold: "⏸️ ", deploy.PlanSkip: "➖"}[c.Result]
+		fmt.Printf("  %s %-12s %s\n", icon, c.Name, c.Detail)
+	}
+	for _, n := range plan.Notes {
+		fmt.Printf("\nNote: %s\n", n)
+	}
+
+	fmt.Println()
+	switch {
+	case plan.Blocked:
+		fmt.Println("Result: the deploy would be refused (see checks above).")
+	case plan.Held:
+		fmt.Printf("Result: %s is held by the deploy gate; the poll loop deploys it once the gate opens.\n", planRelease(plan.Candidate, "the default branch"))
+	case plan.UpToDate:
+		fmt.Println("Result: up to date; the poll loop would not deploy (redeploy would run the stages again).")
+	default:
+		fmt.Printf("Result: would deploy %s.\n", planRelease(plan.Candidate, "the default branch"))
+	}
+	return nil
+}
+
+// planRelease formats a release as "tag (commit/digest)".
+func planRelease(r deploy.PlanRelease, empty string) string {
+	name := r.Tag
+	if r.Asset != "" {
+		name += " " + r.Asset
+		if r.Size > 0 {
+			name += " (" + humanBytes(r.Size) + ")"
+		}
+	}
+	id := r.Commit
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	if id == "" && r.Digest != "" {
+		id = shortDigest(r.Digest)
+	}
+	switch {
+	case name == "" && id == "":
+		return empty
+	case name == "":
+		return id
+	case id == "":
+		return name
+	}
+	return name + " (" + id + ")"
+}
+
+// shortDigest abbreviates "sha256:<hex>" to its first 12 hex characters.
+func shortDigest(digest string) string {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) <= 12 {
+		return digest
+	}
+	return algo + ":" + hex[:12]
+}
@@ -1,11 +1,16 @@
 package projects
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"beacon/internal/config"
+	"beacon/internal/control"
 	"beacon/internal/deploy"
 	"beacon/internal/state"
 	"beacon/internal/util"
@@ -14,61 +19,172 @@ import (
 )
 
 func createRedeployCommand(pm *ProjectManager) *cobra.Command {
-	return &cobra.Command{
+	var wait, cancel, local bool
+
+	cmd := &cobra.Command{
 		Use:   "redeploy <project-name>",
 		Short: "Run a full deploy cycle for a project",
 		Long: `Triggers a full deploy for a project using its existing configuration.
 
 Loads the project's env file, builds the deploy config (same as beacon deploy),
-and runs the full deploy cycle (clone + deploy command for git projects,
-or the configured deploy flow for docker projects).`,
-		Example: `  beacon projects redeploy myapp`,
-		Args:    cobra.ExactArgs(1),
+and runs the full deploy cycle (fetch + deploy command for git projects,
+docker compose pull + up -d for compose projects, or the configured deploy
+flow for docker projects).
+
+Only one deploy runs per project at a time. If a deploy is already running
+(poll loop, webhook, cloud request, MCP or another redeploy) or queued behind
+one, the command reports it and exits; use --wait to queue behind it. Only the latest queued
+request is kept: a newer one replaces it. --cancel stops the running deploy
+(its on_failure stage still runs) and drops the queued request.
+
+When the master (beacon start) is running, it runs the deploy and this command
+streams its output; the output also goes to the project's agent log. The deploy
+carries on if the command is interrupted (use --cancel to stop it). Without a
+running master, or with --local, the deploy runs in this process.`,
+		Example: `  beacon projects redeploy myapp
+  beacon projects redeploy myapp --wait
+  beacon projects redeploy myapp --cancel`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := pm.Redeploy(args[0]); err != nil {
+			var err error
+			switch {
+			case cancel:
+				err = pm.CancelDeploy(args[0])
+			case local:
+				err = pm.Redeploy(args[0], wait)
+			default:
+				err = redeployViaMaster(args[0], wait)
+				if errors.Is(err, control.ErrMasterNotRunning) {
+					err = pm.Redeploy(args[0], wait)
+				}
+			}
+			if err != nil {
 				fmt.Printf("Redeploy failed: %v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
+	cmd.Flags().BoolVar(&wait, "wait", false, "Queue behind a running deploy instead of failing")
+	cmd.Flags().BoolVar(&cancel, "cancel", false, "Cancel the running and queued deploy of the project")
+	cmd.Flags().BoolVar(&local, "local", false, "Deploy in this process instead of the running master")
+	return cmd
 }
 
-// Redeploy runs a full deploy cycle for a project.
-func (pm *ProjectManager) Redeploy(projectName string) error {
-	if !pm.paths.ProjectExists(projectName) {
-		return fmt.Errorf("project %q not found (run `beacon projects list` to see available projects)", projectName)
+// redeployViaMaster has the running master deploy the project and streams the output.
+func redeployViaMaster(projectName string, wait bool) error {
+	client, err := control.NewClient()
+	if err != nil {
+		return err
 	}
+	return client.Deploy(context.Background(), projectName, wait, os.Stdout)
+}
 
-	envFile := pm.paths.GetProjectEnvFile(projectName)
-	if _, err := os.Stat(envFile); err != nil {
-		return fmt.Errorf("env file not found: %s", envFile)
+// Redeploy runs a full deploy cycle for a project. With wait, it queues behind a running
+// deploy; otherwise a running deploy is reported as an error.
+func (pm *ProjectManager) Redeploy(projectName string, wait bool) error {
+	cfg, err := pm.loadDeployConfig(projectName)
+	if err != nil {
+		return err
 	}
 
-	if err := util.LoadEnvFile(envFile); err != nil {
-		return fmt.Errorf("load env file: %w", err)
+	var lock *deploy.Lock
+	if wait {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if running, _ := deploy.DeployStatus(cfg); running != nil {
+			fmt.Printf("Waiting for running deploy (%s, trigger %s)...\n", running.Stage, running.Trigger)
+		}
+		lock, err = deploy.Acquire(ctx, cfg, state.TriggerCLI, "")
+	} else {
+		lock, err = deploy.TryLock(cfg)
+		if errors.Is(err, deploy.ErrDeployInProgress) {
+			err = fmt.Errorf("%w; use --wait to queue or --cancel to stop it", err)
+		}
 	}
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
-	cfg := config.Load()
-
-	statusDir := filepath.Join(os.Getenv("HOME"), ".beacon", cfg.ProjectDir)
-	status := state.NewStatus(statusDir)
+	status := projectStatus(cfg)
 
 	fmt.Printf("Deploying %s (%s) from %s\n", projectName, cfg.DeploymentType, cfg.LocalPath)
 
 	tag := ""
 	if cfg.DeploymentType == "" || cfg.DeploymentType == "git" {
-		tag = deploy.LatestGitTag(cfg)
+		tag = deploy.TargetGitRef(cfg)
 		if tag != "" {
-			fmt.Printf("Deploying latest tag: %s\n", tag)
+			fmt.Printf("Deploying %s\n", tag)
 		} else {
 			fmt.Println("No Git tags found; deploying default branch.")
 		}
 	}
 
-	if err := deploy.Deploy(cfg, tag, status); err != nil {
-		return err
+	switch cfg.DeploymentType {
+	case "compose":
+		if err := deploy.DeployCompose(cfg, status, state.TriggerCLI); err != nil {
+			return err
+		}
+	case "artifact":
+		// Newest release allowed by the deploy policy
+		if err := deploy.DeployArtifact(cfg, "", status, state.TriggerCLI); err != nil {
+			return err
+		}
+	default:
+		if err := deploy.Deploy(cfg, tag, status, state.TriggerCLI); err != nil {
+			return err
+		}
 	}
 
 	fmt.Printf("Redeploy of %s complete.\n", projectName)
 	return nil
 }
+
+// CancelDeploy cancels the running and queued deploy of a project.
+func (pm *ProjectManager) CancelDeploy(projectName string) error {
+	cfg, err := pm.loadDeployConfig(projectName)
+	if err != nil {
+		return err
+	}
+	running, _ := deploy.DeployStatus(cfg)
+	canceled, err := deploy.CancelDeploy(cfg)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !canceled:
+		fmt.Printf("No deploy in progress for %s.\n", projectName)
+	case running != nil:
+		fmt.Printf("Cancel requested for %s deploy (stage %s).\n", projectName, running.Stage)
+	default:
+		fmt.Printf("Queued deploy for %s canceled.\n", projectName)
+	}
+	return nil
+}
+
+// projectStatus returns the deploy status of cfg's project (~/.beacon/<project-dir>).
+func projectStatus(cfg *config.Config) *state.Status {
+	base, err := config.BeaconHomeDir()
+	if err != nil {
+		base = filepath.Join(os.Getenv("HOME"), ".beacon")
+	}
+	return state.NewStatus(filepath.Join(base, cfg.ProjectDir))
+}
+
+// loadDeployConfig loads the project's env file and builds its deploy config (same as beacon deploy).
+func (pm *ProjectManager) loadDeployConfig(projectName string) (*config.Config, error) {
+	if !pm.paths.ProjectExists(projectName) {
+		return nil, fmt.Errorf("project %q not found (run `beacon projects list` to see available projects)", projectName)
+	}
+
+	envFile := pm.paths.GetProjectEnvFile(projectName)
+	if _, err := os.Stat(envFile); err != nil {
+		return nil, fmt.Errorf("env file not found: %s", envFile)
+	}
+
+	if err := util.LoadEnvFile(envFile); err != nil {
+		return nil, fmt.Errorf("load env file: %w", err)
+	}
+
+	return config.Load(), nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package state
+
+import "os"
+
+// flock always succeeds where flock is unavailable; updates of the state files are then
+// not serialized.
+func flock(f *os.File) error {
+	return nil
+}
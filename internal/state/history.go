@@ -0,0 +1,305 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	historyFile     = "deploy_history.jsonl"
+	historyLockFile = "deploy_history.lock"
+
+	// MaxDeployOutput caps captured stdout/stderr per deploy record (tail is kept).
+	MaxDeployOutput = 64 * 1024
+
+	// MaxStageOutput caps the output tail kept per pipeline stage in the history.
+	MaxStageOutput = 8 * 1024
+
+	// MaxDeployRecords is how many deploys a project's history keeps; older records are
+	// pruned, and so are their stage logs.
+	MaxDeployRecords = 200
+
+	// MaxHistoryBytes caps the history file; the oldest records are pruned beyond it.
+	MaxHistoryBytes = 8 << 20
+)
+
+// Deploy trigger constants for DeployRecord.Trigger
+const (
+	TriggerPoll    = "poll"             // beacon deploy poll loop
+	TriggerCloud   = "deploy_requested" // BeaconInfra heartbeat flag
+	TriggerMCP     = "mcp"              // MCP beacon_deploy tool
+	TriggerCLI     = "cli_redeploy"     // beacon projects redeploy
+	TriggerWebhook = "webhook"          // signed Git provider webhook
+	TriggerManual  = "manual"           // anything else
+)
+
+// DeployRecord is one entry in a project's deploy history.
+type DeployRecord struct {
+	ID          string    `json:"id"`
+	Project     string    `json:"project"`
+	Type        string    `json:"type"` // "git", "docker", "compose" or "artifact"
+	Trigger     string    `json:"trigger"`
+	Tag         string    `json:"tag,omitempty"`
+	PreviousTag string    `json:"previous_tag,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Digest      string    `json:"digest,omitempty"`
+	Asset       string    `json:"asset,omitempty"` // release asset deployed by an artifact project
+	FromCommit  string    `json:"from_commit,omitempty"`
+	ToCommit    string    `json:"to_commit,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	DurationMs  int64     `json:"duration_ms"`
+	Success     bool      `json:"success"`
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"`
+	Stdout      string    `json:"stdout,omitempty"`
+	Stderr      string    `json:"stderr,omitempty"`
+	// Signature describes the verified signature of the release (see verify in deploy.yml).
+	Signature string `json:"signature,omitempty"`
+	// Refused is set when the release failed signature or checksum verification and was not deployed.
+	Refused bool `json:"refused,omitempty"`
+	// FetchBytes and FetchDurationMs describe the Git fetch/checkout (bytes added to the
+	// local mirror, roughly what was transferred).
+	FetchBytes      int64 `json:"fetch_bytes,omitempty"`
+	FetchDurationMs int64 `json:"fetch_duration_ms,omitempty"`
+	// Stages holds one entry per pipeline stage that ran (or was skipped) during the deploy.
+	Stages []StageRecord `json:"stages,omitempty"`
+}
+
+// StageRecord is the outcome of one deploy pipeline stage.
+type StageRecord struct {
+	Name       string    `json:"name"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	ExitCode   int       `json:"exit_code"`
+	TimedOut   bool      `json:"timed_out,omitempty"`
+	Skipped    bool      `json:"skipped,omitempty"` // not run because an earlier stage failed
+	Error      string    `json:"error,omitempty"`
+	LogFile    string    `json:"log_file,omitempty"` // full stage output
+	Output     string    `json:"output,omitempty"`   // tail of combined stdout/stderr
+}
+
+// CommitRange returns "from..to" (or just "to" for first deployments).
+func (r DeployRecord) CommitRange() string {
+	switch {
+	case r.FromCommit != "" && r.ToCommit != "" && r.FromCommit != r.ToCommit:
+		return shortSHA(r.FromCommit) + ".." + shortSHA(r.ToCommit)
+	case r.ToCommit != "":
+		return shortSHA(r.ToCommit)
+	}
+	return ""
+}
+
+// Summary returns a copy of the record without captured output (for status payloads).
+func (r DeployRecord) Summary() DeployRecord {
+	r.Stdout = ""
+	r.Stderr = ""
+	if len(r.Stages) > 0 {
+		stages := make([]StageRecord, len(r.Stages))
+		for i, st := range r.Stages {
+			st.Output = ""
+			stages[i] = st
+		}
+		r.Stages = stages
+	}
+	return r
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// History is an append-only deploy ledger stored as JSON lines in
+// ~/.beacon/state/<project>/deploy_history.jsonl. It keeps the last MaxDeployRecords
+// records within MaxHistoryBytes.
+type History struct {
+	mu       sync.Mutex
+	filepath string
+}
+
+// NewHistory returns the deploy history for the given project state directory.
+// The directory is created lazily on the first Append.
+func NewHistory(storageDir string) *History {
+	return &History{filepath: filepath.Join(storageDir, historyFile)}
+}
+
+// Path returns the path of the history file.
+func (h *History) Path() string {
+	return h.filepath
+}
+
+// Append writes a record to the end of the ledger and prunes the oldest records beyond
+// the history's limits.
+func (h *History) Append(rec DeployRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if rec.ID == "" {
+		rec.ID = rec.StartedAt.UTC().Format("20060102T150405.000Z")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal deploy record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.filepath), 0755); err != nil {
+		return fmt.Errorf("create history directory: %w", err)
+	}
+	// Other beacon processes append too; prune must not drop their records
+	unlock, err := lockFile(filepath.Join(filepath.Dir(h.filepath), historyLockFile))
+	if err != nil {
+		return fmt.Errorf("lock history file: %w", err)
+	}
+	defer unlock()
+	f, err := os.OpenFile(h.filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open history file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write history file: %w", err)
+	}
+	return h.prune()
+}
+
+// prune rewrites the ledger without its oldest records when it holds more than
+// MaxDeployRecords or MaxHistoryBytes. The caller holds h.mu and the ledger lock.
+func (h *History) prune() error {
+	lines, err := h.readLines()
+	if err != nil {
+		return err
+	}
+	size := 0
+	for _, line := range lines {
+		size += len(line)
+	}
+	drop := 0
+	for len(lines)-drop > 1 && (len(lines)-drop > MaxDeployRecords || size > MaxHistoryBytes) {
+		size -= len(lines[drop])
+		drop++
+	}
+	if drop == 0 {
+		return nil
+	}
+	if err := writeFileAtomic(h.filepath, bytes.Join(lines[drop:], nil), 0644); err != nil {
+		return fmt.Errorf("prune history file: %w", err)
+	}
+	return nil
+}
+
+// readLines returns the ledger's lines, each with its newline. The caller holds h.mu.
+func (h *History) readLines() ([][]byte, error) {
+	f, err := os.Open(h.filepath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open history file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var lines [][]byte
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read history file: %w", err)
+		}
+	}
+}
+
+// List returns up to limit most recent records, newest first. limit <= 0 returns all.
+// Malformed lines are skipped. A missing file yields an empty slice.
+func (h *History) List(limit int) ([]DeployRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lines, err := h.readLines()
+	if err != nil {
+		return nil, err
+	}
+	var records []DeployRecord
+	for _, line := range lines {
+		var rec DeployRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	// Reverse to newest first
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	if records == nil {
+		records = []DeployRecord{}
+	}
+	return records, nil
+}
+
+// Last returns the most recent record, or nil if the history is empty.
+func (h *History) Last() (*DeployRecord, error) {
+	records, err := h.List(1)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+// TailBuffer is an io.Writer that keeps only the last max bytes written to it.
+type TailBuffer struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+// NewTailBuffer creates a TailBuffer bounded to max bytes.
+func NewTailBuffer(max int) *TailBuffer {
+	return &TailBuffer{max: max}
+}
+
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the buffered tail, prefixed with a marker if earlier output was dropped.
+func (t *TailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.truncated {
+		return "... (truncated)\n" + string(t.buf)
+	}
+	return string(t.buf)
+}
@@ -0,0 +1,210 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistory_AppendList(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state", "proj")
+	h := NewHistory(dir)
+
+	records, err := h.List(0)
+	if err != nil {
+		t.Fatalf("List on missing file: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected empty history, got %d", len(records))
+	}
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, tag := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		rec := DeployRecord{
+			Project:   "proj",
+			Type:      "git",
+			Trigger:   TriggerPoll,
+			Tag:       tag,
+			StartedAt: start.Add(time.Duration(i) * time.Minute),
+			Success:   true,
+			Stdout:    "ok\n",
+		}
+		if err := h.Append(rec); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	records, err = h.List(2)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if records[0].Tag != "v1.2.0" || records[1].Tag != "v1.1.0" {
+		t.Errorf("expected newest first, got %s, %s", records[0].Tag, records[1].Tag)
+	}
+	if records[0].ID == "" {
+		t.Error("expected ID to be assigned")
+	}
+
+	last, err := h.Last()
+	if err != nil || last == nil || last.Tag != "v1.2.0" {
+		t.Errorf("Last: got %+v, %v", last, err)
+	}
+}
+
+func TestHistory_SkipsMalformedLines(t *testing.T) {
+	dir := t.TempDir()
+	h := NewHistory(dir)
+	if err := h.Append(DeployRecord{Tag: "v1", StartedAt: time.Now()}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	f, err := os.OpenFile(h.Path(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, _ = f.WriteString("{not json\n")
+	_ = f.Close()
+
+	records, err := h.List(0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("expected 1 valid record, got %d", len(records))
+	}
+}
+
+func TestHistory_LongRecords(t *testing.T) {
+	h := NewHistory(t.TempDir())
+	// HTML escaping makes each '<' six bytes: far longer than the captured output
+	noisy := strings.Repeat("<", MaxDeployOutput)
+	if err := h.Append(DeployRecord{Tag: "v1", StartedAt: time.Now(), Stdout: noisy, Stderr: noisy}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := h.Append(DeployRecord{Tag: "v2", StartedAt: time.Now()}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	records, err := h.List(0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(records) != 2 || records[0].Tag != "v2" || records[1].Stdout != noisy {
+		t.Errorf("got %d records", len(records))
+	}
+}
+
+func TestHistory_PrunesOldest(t *testing.T) {
+	h := NewHistory(t.TempDir())
+	for i := range MaxDeployRecords + 5 {
+		if err := h.Append(DeployRecord{ID: fmt.Sprintf("d%d", i), StartedAt: time.Now()}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	records, err := h.List(0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(records) != MaxDeployRecords || records[0].ID != fmt.Sprintf("d%d", MaxDeployRecords+4) || records[len(records)-1].ID != "d5" {
+		t.Errorf("kept %d records, %s..%s", len(records), records[len(records)-1].ID, records[0].ID)
+	}
+
+	// Large records are pruned by size
+	big := strings.Repeat("x", MaxDeployOutput)
+	for range MaxHistoryBytes/(2*MaxDeployOutput) + 10 {
+		if err := h.Append(DeployRecord{StartedAt: time.Now(), Stdout: big, Stderr: big}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if fi, err := os.Stat(h.Path()); err != nil || fi.Size() > MaxHistoryBytes {
+		t.Errorf("history file is %d bytes, want at most %d", fi.Size(), MaxHistoryBytes)
+	}
+}
+
+func TestHistory_ConcurrentAppendsWhilePruning(t *testing.T) {
+	dir := t.TempDir()
+	for i := range MaxDeployRecords {
+		if err := NewHistory(dir).Append(DeployRecord{ID: fmt.Sprintf("old%d", i), StartedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Separate handles stand in for separate processes: only the ledger lock orders them
+	const n = 50
+	var wg sync.WaitGroup
+	for _, writer := range []string{"a", "b"} {
+		h := NewHistory(dir)
+		wg.Go(func() {
+			for i := range n {
+				if err := h.Append(DeployRecord{ID: fmt.Sprintf("%s%d", writer, i), StartedAt: time.Now()}); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	records, err := NewHistory(dir).List(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, r := range records {
+		seen[r.ID] = true
+	}
+	for _, writer := range []string{"a", "b"} {
+		for i := range n {
+			if id := fmt.Sprintf("%s%d", writer, i); !seen[id] {
+				t.Errorf("record %s lost by a concurrent prune", id)
+			}
+		}
+	}
+	if len(records) != MaxDeployRecords {
+		t.Errorf("kept %d records, want %d", len(records), MaxDeployRecords)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmps) != 0 {
+		t.Errorf("temp files left behind: %v", tmps)
+	}
+}
+
+func TestDeployRecord_CommitRangeAndSummary(t *testing.T) {
+	r := DeployRecord{
+		FromCommit: "0123456789abcdef0123",
+		ToCommit:   "fedcba9876543210fedc",
+		Stdout:     "out",
+		Stderr:     "err",
+	}
+	if got := r.CommitRange(); got != "0123456789ab..fedcba987654" {
+		t.Errorf("CommitRange = %q", got)
+	}
+	r.FromCommit = ""
+	if got := r.CommitRange(); got != "fedcba987654" {
+		t.Errorf("CommitRange (first deploy) = %q", got)
+	}
+	s := r.Summary()
+	if s.Stdout != "" || s.Stderr != "" {
+		t.Error("Summary should drop captured output")
+	}
+	if r.Stdout != "out" {
+		t.Error("Summary must not modify the original record")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := NewTailBuffer(8)
+	_, _ = b.Write([]byte("0123"))
+	if b.String() != "0123" {
+		t.Errorf("got %q", b.String())
+	}
+	_, _ = b.Write([]byte("456789ab"))
+	got := b.String()
+	if !strings.HasSuffix(got, "456789ab") || !strings.HasPrefix(got, "... (truncated)") {
+		t.Errorf("expected truncated tail, got %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	pendingFile     = "pending_deploy.json"
+	pendingLockFile = "pending_deploy.lock"
+)
+
+// Reasons a release is held
+const (
+	HoldWindow   = "window"    // outside the deploy windows
+	HoldApproval = "approval"  // waiting for `beacon projects approve`
+	HoldNotReady = "not_ready" // gate.ready_command failed
+)
+
+// PendingRelease is a new release the poll loop found but did not deploy yet because the
+// project's deploy gate holds it. It is kept in ~/.beacon/state/<project>/pending_deploy.json,
+// one entry per image (Image is empty for Git, compose and artifact projects), and removed once
+// the release is deployed.
+type PendingRelease struct {
+	Image      string     `json:"image,omitempty"`
+	Tag        string     `json:"tag,omitempty"`
+	Target     string     `json:"target,omitempty"` // commit or digest, when known
+	DetectedAt time.Time  `json:"detected_at"`
+	Reason     string     `json:"reason"`                // HoldWindow, HoldApproval or HoldNotReady
+	Detail     string     `json:"detail,omitempty"`      // e.g. the ready command's output
+	NextWindow *time.Time `json:"next_window,omitempty"` // when the next deploy window opens
+	Approved   bool       `json:"approved,omitempty"`
+	ApprovedBy string     `json:"approved_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+}
+
+// Same reports whether p is the same release as image/tag/target. Targets must match
+// exactly: an unknown (empty) target is only the same as another unknown one.
+func (p PendingRelease) Same(image, tag, target string) bool {
+	return p.Image == image && p.Tag == tag && p.Target == target
+}
+
+// ReadPendingReleases returns the releases held for the project state directory.
+func ReadPendingReleases(storageDir string) ([]PendingRelease, error) {
+	data, err := os.ReadFile(filepath.Join(storageDir, pendingFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pending []PendingRelease
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("parse pending releases: %w", err)
+	}
+	return pending, nil
+}
+
+// WritePendingReleases replaces the held releases; an empty list removes the file.
+func WritePendingReleases(storageDir string, pending []PendingRelease) error {
+	path := filepath.Join(storageDir, pendingFile)
+	if len(pending) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal pending releases: %w", err)
+	}
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("write pending releases: %w", err)
+	}
+	return nil
+}
+
+// UpdatePendingReleases replaces the held releases with update(held) under a lock shared
+// by every writer, so the poll loop holding a release and an approval cannot overwrite
+// each other. A file that cannot be parsed is passed on as no releases.
+func UpdatePendingReleases(storageDir string, update func([]PendingRelease) []PendingRelease) error {
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	unlock, err := lockFile(filepath.Join(storageDir, pendingLockFile))
+	if err != nil {
+		return fmt.Errorf("lock pending releases: %w", err)
+	}
+	defer unlock()
+	pending, err := ReadPendingReleases(storageDir)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+		return err
+	}
+	return WritePendingReleases(storageDir, update(pending))
+}
+
+// ApprovePendingReleases approves every held release of the project and returns them.
+// Approved releases still wait for the deploy window and are deployed by the next poll.
+func ApprovePendingReleases(storageDir, by string) ([]PendingRelease, error) {
+	if _, err := os.Stat(storageDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	var approved []PendingRelease
+	err := UpdatePendingReleases(storageDir, func(pending []PendingRelease) []PendingRelease {
+		now := time.Now()
+		for i := range pending {
+			if pending[i].Approved {
+				continue
+			}
+			pending[i].Approved = true
+			pending[i].ApprovedBy = by
+			pending[i].ApprovedAt = &now
+		}
+		approved = pending
+		return pending
+	})
+	if err != nil {
+		return nil, err
+	}
+	return approved, nil
+}
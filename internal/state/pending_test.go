@@ -0,0 +1,64 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPendingRelease_Same(t *testing.T) {
+	p := PendingRelease{Image: "app", Tag: "latest", Target: "sha256:aaa"}
+	for _, tc := range []struct {
+		image, tag, target string
+		want               bool
+	}{
+		{"app", "latest", "sha256:aaa", true},
+		{"app", "latest", "sha256:bbb", false},
+		{"app", "latest", "", false},
+		{"app", "v2", "sha256:aaa", false},
+	} {
+		if got := p.Same(tc.image, tc.tag, tc.target); got != tc.want {
+			t.Errorf("Same(%q, %q, %q) = %v, want %v", tc.image, tc.tag, tc.target, got, tc.want)
+		}
+	}
+	if (PendingRelease{Tag: "v1"}).Same("", "v1", "abc") {
+		t.Error("a release held without a target matched a known one")
+	}
+}
+
+func TestUpdatePendingReleases_keepsApproval(t *testing.T) {
+	dir := t.TempDir()
+	if err := WritePendingReleases(dir, []PendingRelease{{Tag: "v1", Reason: HoldApproval}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The poll loop holds the lock while the release is approved
+	unlock, err := lockFile(filepath.Join(dir, pendingLockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := ApprovePendingReleases(dir, "tester")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("ApprovePendingReleases did not wait for the lock: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	pending, _ := ReadPendingReleases(dir)
+	pending[0].Detail = "checked by the poll loop"
+	if err := WritePendingReleases(dir, pending); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	pending, _ = ReadPendingReleases(dir)
+	if len(pending) != 1 || !pending[0].Approved || pending[0].Detail != "checked by the poll loop" {
+		t.Errorf("pending = %+v", pending)
+	}
+}
@@ -0,0 +1,89 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const progressFile = "deploy_progress.json"
+
+// DeployProgress describes a deploy that is currently running. It is written to
+// ~/.beacon/state/<project>/deploy_progress.json by the deploying process and removed when
+// the deploy finishes, so the child agent can report it in its health report.
+type DeployProgress struct {
+	ID             string    `json:"id"` // deploy record ID
+	PID            int       `json:"pid"`
+	Trigger        string    `json:"trigger,omitempty"`
+	Tag            string    `json:"tag,omitempty"`
+	Stage          string    `json:"stage"`
+	StartedAt      time.Time `json:"started_at"`
+	StageStartedAt time.Time `json:"stage_started_at"`
+}
+
+// StageElapsed returns how long the current stage has been running.
+func (p DeployProgress) StageElapsed() time.Duration {
+	return time.Since(p.StageStartedAt)
+}
+
+// WriteDeployProgress records p in the project state directory.
+func WriteDeployProgress(storageDir string, p DeployProgress) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("marshal deploy progress: %w", err)
+	}
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	path := filepath.Join(storageDir, progressFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write deploy progress: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadDeployProgress returns the running deploy for the project state directory, or nil if no
+// deploy is running. Progress left behind by a process that no longer exists is ignored.
+func ReadDeployProgress(storageDir string) (*DeployProgress, error) {
+	data, err := os.ReadFile(filepath.Join(storageDir, progressFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p DeployProgress
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse deploy progress: %w", err)
+	}
+	if !processAlive(p.PID) {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// ClearDeployProgress removes the progress file once a deploy has finished.
+func ClearDeployProgress(storageDir string) error {
+	err := os.Remove(filepath.Join(storageDir, progressFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// processAlive reports whether pid refers to a running process. Signal 0 is not supported
+// on Windows, where progress is therefore never reported.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
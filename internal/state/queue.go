@@ -0,0 +1,126 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	queueFile     = "deploy_queue.json"
+	queueLockFile = "deploy_queue.lock"
+	cancelFile    = "deploy_cancel"
+)
+
+// DeployRequest is a deploy waiting for the project's deploy lock. The queue holds a single
+// request: a newer request replaces the waiting one (latest wins), and the replaced waiter
+// gives up when it sees the change.
+type DeployRequest struct {
+	ID          string    `json:"id"`
+	PID         int       `json:"pid"`
+	Trigger     string    `json:"trigger,omitempty"`
+	Tag         string    `json:"tag,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// lockQueue takes the lock serializing changes to the queue slot, so clearing a request
+// cannot remove a newer one written in between. The returned func releases it.
+func lockQueue(storageDir string) (func(), error) {
+	unlock, err := lockFile(filepath.Join(storageDir, queueLockFile))
+	if err != nil {
+		return nil, fmt.Errorf("lock deploy queue: %w", err)
+	}
+	return unlock, nil
+}
+
+// WriteDeployRequest queues req, replacing any waiting request.
+func WriteDeployRequest(storageDir string, req DeployRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal deploy request: %w", err)
+	}
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	unlock, err := lockQueue(storageDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	path := filepath.Join(storageDir, queueFile)
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write deploy request: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadDeployRequest returns the waiting request, or nil if none is queued. Requests left
+// behind by a process that no longer exists are ignored.
+func ReadDeployRequest(storageDir string) (*DeployRequest, error) {
+	data, err := os.ReadFile(filepath.Join(storageDir, queueFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var req DeployRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("parse deploy request: %w", err)
+	}
+	if !processAlive(req.PID) {
+		return nil, nil
+	}
+	return &req, nil
+}
+
+// ClearDeployRequest removes the queued request if it is still the one with the given ID
+// (any request when id is empty). The check and the removal hold the queue lock.
+func ClearDeployRequest(storageDir, id string) error {
+	unlock, err := lockQueue(storageDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // no state directory, so nothing queued
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if id != "" {
+		req, err := ReadDeployRequest(storageDir)
+		if err != nil || req == nil || req.ID != id {
+			return err
+		}
+	}
+	err = os.Remove(filepath.Join(storageDir, queueFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// RequestDeployCancel asks the deploy with the given ID (see DeployProgress.ID) to stop.
+func RequestDeployCancel(storageDir, deployID string) error {
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	return os.WriteFile(filepath.Join(storageDir, cancelFile), []byte(deployID), 0644)
+}
+
+// DeployCancelRequested reports whether cancellation of deployID was requested.
+func DeployCancelRequested(storageDir, deployID string) bool {
+	data, err := os.ReadFile(filepath.Join(storageDir, cancelFile))
+	return err == nil && string(data) == deployID
+}
+
+// ClearDeployCancel removes a cancellation request.
+func ClearDeployCancel(storageDir string) error {
+	err := os.Remove(filepath.Join(storageDir, cancelFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
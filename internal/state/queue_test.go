@@ -0,0 +1,63 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClearDeployRequest_keepsNewerRequest(t *testing.T) {
+	dir := t.TempDir()
+	pid := os.Getpid()
+	if err := WriteDeployRequest(dir, DeployRequest{ID: "old", PID: pid}); err != nil {
+		t.Fatalf("WriteDeployRequest: %v", err)
+	}
+
+	// A writer holds the queue lock while the old request's waiter clears it
+	unlock, err := lockQueue(dir)
+	if err != nil {
+		t.Fatalf("lockQueue: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- ClearDeployRequest(dir, "old") }()
+	select {
+	case err := <-done:
+		t.Fatalf("ClearDeployRequest did not wait for the queue lock: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// What the writer does under the lock: replace the request
+	writeQueued(t, dir, DeployRequest{ID: "new", PID: pid})
+	unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("ClearDeployRequest: %v", err)
+	}
+	req, err := ReadDeployRequest(dir)
+	if err != nil || req == nil || req.ID != "new" {
+		t.Fatalf("queued request = %+v, %v; want the newer one kept", req, err)
+	}
+
+	if err := ClearDeployRequest(dir, "new"); err != nil {
+		t.Fatalf("ClearDeployRequest: %v", err)
+	}
+	if req, _ := ReadDeployRequest(dir); req != nil {
+		t.Errorf("request %+v not cleared", req)
+	}
+	if err := ClearDeployRequest(t.TempDir()+"/missing", ""); err != nil {
+		t.Errorf("ClearDeployRequest without state directory: %v", err)
+	}
+}
+
+// writeQueued replaces the queued request without taking the lock.
+func writeQueued(t *testing.T, dir string, req DeployRequest) {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, queueFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
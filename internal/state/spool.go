@@ -0,0 +1,382 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of spooled reports (SpoolEntry.Kind)
+const (
+	SpoolHeartbeat       = "heartbeat"        // a heartbeat snapshot
+	SpoolMetrics         = "metrics"          // a system metrics sample
+	SpoolCheckTransition = "check_transition" // a health check changing status
+	SpoolCommandResult   = "command_result"   // the result of a cloud command
+)
+
+const (
+	spoolStateFile = "state.json"
+	spoolSuffix    = ".jsonl"
+
+	// minSpoolSegment is the smallest segment file; larger spools use a sixteenth of
+	// their size, so dropping the oldest segment frees a little at a time.
+	minSpoolSegment = 64 << 10
+)
+
+// SpoolEntry is one report kept for backfill.
+type SpoolEntry struct {
+	Seq        uint64          `json:"seq"`
+	Kind       string          `json:"kind"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// SpoolOptions bounds a spool. Zero values mean no limit.
+type SpoolOptions struct {
+	MaxBytes int64         // the oldest entries are dropped beyond this size
+	MaxAge   time.Duration // older entries are dropped instead of sent
+}
+
+// SpoolBatch is the oldest pending entries, to be sent and then acknowledged with Ack.
+type SpoolBatch struct {
+	Entries []SpoolEntry
+	// Dropped counts the entries lost to the spool's limits before these ones.
+	Dropped int
+
+	last          uint64
+	droppedBefore int
+}
+
+// Spool is a bounded on-disk queue of reports the cloud did not receive, kept until
+// they are backfilled. Entries are JSON lines in segment files named after their first
+// sequence number; state.json records how far the cloud has acknowledged.
+type Spool struct {
+	mu       sync.Mutex
+	dir      string
+	opts     SpoolOptions
+	segments []*spoolSegment // oldest first; the last one is appended to
+	cur      *os.File        // the last segment, open for appending
+	nextSeq  uint64
+	acked    uint64
+	dropped  int
+}
+
+type spoolSegment struct {
+	path        string
+	first, last uint64 // last < first when empty
+	size        int64
+}
+
+type spoolState struct {
+	Acked   uint64 `json:"acked"`
+	Dropped int    `json:"dropped,omitempty"`
+}
+
+// OpenSpool opens (or creates) the spool in dir.
+func OpenSpool(dir string, opts SpoolOptions) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create spool directory: %w", err)
+	}
+	s := &Spool{dir: dir, opts: opts, nextSeq: 1}
+	if data, err := os.ReadFile(filepath.Join(dir, spoolStateFile)); err == nil {
+		var st spoolState
+		if err := json.Unmarshal(data, &st); err == nil {
+			s.acked, s.dropped = st.Acked, st.Dropped
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), spoolSuffix), 10, 64)
+		if err != nil || first == 0 {
+			continue
+		}
+		seg, err := scanSpoolSegment(path, first)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].first < s.segments[j].first })
+	for _, seg := range s.segments {
+		s.nextSeq = max(s.nextSeq, seg.last+1, seg.first)
+	}
+	s.nextSeq = max(s.nextSeq, s.acked+1)
+	s.removeAcked()
+	return s, nil
+}
+
+// scanSpoolSegment reads a segment's bounds. A line cut short by a crash is truncated
+// away so the next append starts on a fresh line.
+func scanSpoolSegment(path string, first uint64) (*spoolSegment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		data = data[:end]
+		if err := os.Truncate(path, int64(end)); err != nil {
+			return nil, err
+		}
+	}
+	seg := &spoolSegment{path: path, first: first, last: first - 1, size: int64(len(data))}
+	for line := range bytes.Lines(data) {
+		var e SpoolEntry
+		if json.Unmarshal(line, &e) == nil && e.Seq > seg.last {
+			seg.last = e.Seq
+		}
+	}
+	return seg, nil
+}
+
+// SetOptions changes the spool's limits; they apply from the next Append.
+func (s *Spool) SetOptions(opts SpoolOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts = opts
+}
+
+// Append adds a report recorded at the given time. data is marshalled to JSON.
+func (s *Spool) Append(kind string, recordedAt time.Time, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", kind, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line, err := json.Marshal(SpoolEntry{Seq: s.nextSeq, Kind: kind, RecordedAt: recordedAt, Data: raw})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	seg := s.current()
+	if seg == nil || (seg.size > 0 && seg.size+int64(len(line)) > s.segmentSize()) {
+		if seg, err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.cur.Write(line); err != nil {
+		return fmt.Errorf("write spool: %w", err)
+	}
+	seg.last = s.nextSeq
+	seg.size += int64(len(line))
+	s.nextSeq++
+	s.enforceSize()
+	return nil
+}
+
+// Pending returns how many entries wait to be sent.
+func (s *Spool) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, seg := range s.segments {
+		if seg.last > s.acked {
+			n += int(seg.last - max(seg.first-1, s.acked))
+		}
+	}
+	return n
+}
+
+// Next returns up to limit of the oldest pending entries, or nil when there are none.
+// Entries past the spool's MaxAge are skipped and counted as dropped.
+func (s *Spool) Next(limit int) (*SpoolBatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := &SpoolBatch{last: s.acked, droppedBefore: s.dropped}
+	expired := 0
+	cutoff := time.Time{}
+	if s.opts.MaxAge > 0 {
+		cutoff = time.Now().Add(-s.opts.MaxAge)
+	}
+	for _, seg := range s.segments {
+		if seg.last <= s.acked || len(b.Entries) >= limit {
+			continue
+		}
+		err := scanSpoolEntries(seg.path, func(e SpoolEntry) bool {
+			if e.Seq <= b.last {
+				return true
+			}
+			b.last = e.Seq
+			if e.RecordedAt.Before(cutoff) {
+				expired++
+			} else {
+				b.Entries = append(b.Entries, e)
+			}
+			return len(b.Entries) < limit
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.Dropped = b.droppedBefore + expired
+	if len(b.Entries) == 0 {
+		if b.last > s.acked {
+			// Only expired entries: nothing to send, but they are gone
+			s.acked, s.dropped = b.last, s.dropped+expired
+			_ = s.saveState()
+			s.removeAcked()
+		}
+		return nil, nil
+	}
+	return b, nil
+}
+
+// Ack marks a batch from Next as sent: its entries (and the expired ones it skipped) are
+// removed and the drops it reported are forgotten.
+func (s *Spool) Ack(b *SpoolBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = max(s.acked, b.last)
+	s.dropped = max(0, s.dropped-b.droppedBefore)
+	err := s.saveState()
+	s.removeAcked()
+	return err
+}
+
+// Close closes the spool's open segment.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil {
+		return nil
+	}
+	err := s.cur.Close()
+	s.cur = nil
+	return err
+}
+
+func (s *Spool) segmentSize() int64 {
+	return max(minSpoolSegment, s.opts.MaxBytes/16)
+}
+
+// current returns the segment being appended to, opening its file if needed.
+func (s *Spool) current() *spoolSegment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	seg := s.segments[len(s.segments)-1]
+	if s.cur == nil {
+		f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil
+		}
+		s.cur = f
+	}
+	return seg
+}
+
+// rotate starts a new segment at the next sequence number.
+func (s *Spool) rotate() (*spoolSegment, error) {
+	if s.cur != nil {
+		_ = s.cur.Close()
+		s.cur = nil
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSeq, spoolSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("create spool segment: %w", err)
+	}
+	s.cur = f
+	seg := &spoolSegment{path: path, first: s.nextSeq, last: s.nextSeq - 1}
+	s.segments = append(s.segments, seg)
+	return seg, nil
+}
+
+// enforceSize drops the oldest segments while the spool is over MaxBytes, counting the
+// unsent entries lost.
+func (s *Spool) enforceSize() {
+	if s.opts.MaxBytes <= 0 {
+		return
+	}
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	changed := false
+	for total > s.opts.MaxBytes && len(s.segments) > 1 {
+		seg := s.segments[0]
+		if seg.last > s.acked {
+			s.dropped += int(seg.last - max(seg.first-1, s.acked))
+			s.acked = seg.last
+			changed = true
+		}
+		_ = os.Remove(seg.path)
+		total -= seg.size
+		s.segments = s.segments[1:]
+	}
+	if changed {
+		_ = s.saveState()
+	}
+}
+
+// removeAcked deletes the segments whose entries were all sent. The segment being
+// appended to is kept unless it is done too.
+func (s *Spool) removeAcked() {
+	for len(s.segments) > 0 {
+		seg := s.segments[0]
+		if seg.last > s.acked || (seg.last < seg.first && len(s.segments) == 1) {
+			return
+		}
+		if len(s.segments) == 1 && s.cur != nil {
+			_ = s.cur.Close()
+			s.cur = nil
+		}
+		_ = os.Remove(seg.path)
+		s.segments = s.segments[1:]
+	}
+}
+
+func (s *Spool) saveState() error {
+	data, err := json.Marshal(spoolState{Acked: s.acked, Dropped: s.dropped})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, spoolStateFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write spool state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// scanSpoolEntries calls fn for each entry in a segment until it returns false.
+func scanSpoolEntries(path string, fn func(SpoolEntry) bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var e SpoolEntry
+			if json.Unmarshal(line, &e) == nil && !fn(e) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func spoolSeqs(t *testing.T, b *SpoolBatch) []uint64 {
+	t.Helper()
+	if b == nil {
+		return nil
+	}
+	var seqs []uint64
+	for _, e := range b.Entries {
+		seqs = append(seqs, e.Seq)
+	}
+	return seqs
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpool_AppendNextAck(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	now := time.Now()
+	for i := range 5 {
+		if err := s.Append(SpoolHeartbeat, now, map[string]int{"n": i}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if n := s.Pending(); n != 5 {
+		t.Fatalf("Pending = %d, want 5", n)
+	}
+
+	b, err := s.Next(3)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if got := spoolSeqs(t, b); !equalSeqs(got, []uint64{1, 2, 3}) {
+		t.Fatalf("first batch = %v", got)
+	}
+	var data map[string]int
+	if err := json.Unmarshal(b.Entries[0].Data, &data); err != nil || data["n"] != 0 {
+		t.Fatalf("entry data = %s", b.Entries[0].Data)
+	}
+	// Not acknowledged: the same entries come back
+	if again, _ := s.Next(3); !equalSeqs(spoolSeqs(t, again), []uint64{1, 2, 3}) {
+		t.Fatalf("unacked batch = %v", spoolSeqs(t, again))
+	}
+	if err := s.Ack(b); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if n := s.Pending(); n != 2 {
+		t.Fatalf("Pending after ack = %d, want 2", n)
+	}
+
+	// The acknowledged position and the rest survive a restart
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	s, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	if err := s.Append(SpoolMetrics, now, "six"); err != nil {
+		t.Fatalf("Append after reopen: %v", err)
+	}
+	b, _ = s.Next(10)
+	if got := spoolSeqs(t, b); !equalSeqs(got, []uint64{4, 5, 6}) {
+		t.Fatalf("batch after reopen = %v", got)
+	}
+	if err := s.Ack(b); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if b, _ := s.Next(10); b != nil {
+		t.Fatalf("expected empty spool, got %v", spoolSeqs(t, b))
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(segments) != 0 {
+		t.Errorf("sent segments not removed: %v", segments)
+	}
+}
+
+func TestSpool_MaxBytesDropsOldest(t *testing.T) {
+	s, err := OpenSpool(t.TempDir(), SpoolOptions{MaxBytes: 3 * minSpoolSegment})
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	defer s.Close()
+	payload := string(make([]byte, 1000))
+	for range 1000 {
+		if err := s.Append(SpoolMetrics, time.Now(), payload); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	b, err := s.Next(1)
+	if err != nil || b == nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if b.Dropped == 0 || b.Entries[0].Seq != uint64(b.Dropped)+1 {
+		t.Fatalf("oldest entry %d after %d dropped", b.Entries[0].Seq, b.Dropped)
+	}
+	if pending := s.Pending(); pending+b.Dropped != 1000 {
+		t.Fatalf("pending %d + dropped %d != 1000", pending, b.Dropped)
+	}
+	if err := s.Ack(b); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	// The drops are reported once
+	if next, _ := s.Next(1); next.Dropped != 0 {
+		t.Errorf("drops reported again: %d", next.Dropped)
+	}
+}
+
+func TestSpool_MaxAgeExpires(t *testing.T) {
+	s, err := OpenSpool(t.TempDir(), SpoolOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	defer s.Close()
+	_ = s.Append(SpoolHeartbeat, time.Now().Add(-2*time.Hour), "old")
+	_ = s.Append(SpoolHeartbeat, time.Now(), "new")
+
+	b, _ := s.Next(10)
+	if got := spoolSeqs(t, b); !equalSeqs(got, []uint64{2}) || b.Dropped != 1 {
+		t.Fatalf("batch = %v, dropped %d", got, b.Dropped)
+	}
+}
+
+func TestSpool_TornLine(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := OpenSpool(dir, SpoolOptions{})
+	_ = s.Append(SpoolHeartbeat, time.Now(), "one")
+	_ = s.Close()
+	// A crash in the middle of the second append
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	f, _ := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = f.WriteString(`{"seq":2,"kind":"heart`)
+	_ = f.Close()
+
+	s, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	_ = s.Append(SpoolHeartbeat, time.Now(), "two")
+	b, _ := s.Next(10)
+	if got := spoolSeqs(t, b); !equalSeqs(got, []uint64{1, 2}) {
+		t.Fatalf("batch = %v", got)
+	}
+}
@@ -12,6 +12,8 @@ import (
 type Status struct {
 	mu           sync.RWMutex
 	LastTag      string    `json:"last_tag"`
+	LastCommit   string    `json:"last_commit,omitempty"`
+	LastDigest   string    `json:"last_digest,omitempty"`
 	LastDeployed time.Time `json:"last_deployed"`
 	filepath     string
 }
@@ -47,10 +49,31 @@ func (s *Status) Get() (string, time.Time) {
 	return s.LastTag, s.LastDeployed
 }
 
+// Commit returns the commit SHA of the last Git deployment, if known.
+func (s *Status) Commit() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LastCommit
+}
+
+// Digest returns the content digest of the last Docker deployment, if known.
+func (s *Status) Digest() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LastDigest
+}
+
 func (s *Status) Set(tag string, t time.Time) {
+	s.SetWithCommit(tag, "", t)
+}
+
+// SetWithCommit records a deployment of tag at commit (commit may be empty for non-Git deploys).
+func (s *Status) SetWithCommit(tag, commit string, t time.Time) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.LastTag = tag
+	s.LastCommit = commit
+	s.LastDigest = ""
 	s.LastDeployed = t
 
 	// Save to disk
@@ -59,6 +82,32 @@ func (s *Status) Set(tag string, t time.Time) {
 	}
 }
 
+// SetWithDigest records a deployment of image tag at the given content digest.
+func (s *Status) SetWithDigest(tag, digest string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastTag = tag
+	s.LastCommit = ""
+	s.LastDigest = digest
+	s.LastDeployed = t
+
+	if err := s.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "[Beacon] Failed to save status: %v\n", err)
+	}
+}
+
+// SetDigest records digest for the current tag without changing the deploy time.
+// Used to establish a baseline for deployments made before digests were tracked.
+func (s *Status) SetDigest(digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastDigest = digest
+
+	if err := s.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "[Beacon] Failed to save status: %v\n", err)
+	}
+}
+
 // Load reads the status from the JSON file
 func (s *Status) Load() error {
 	data, err := os.ReadFile(s.filepath)
@@ -332,6 +332,7 @@ func (sm *ServiceManager) generateMasterServiceContent(execStart, workingDir str
 	}
 	// systemd requires absolute paths; WorkingDirectory must exist for the user running the service.
 	// --foreground is required because beacon start daemonizes by default, but systemd manages the lifecycle.
+	// Delegate=yes hands the unit's cgroup to the master for per-project resource limits.
 	return fmt.Sprintf(`[Unit]
 Description=Beacon master agent (cloud health reporting, project-independent)
 After=network-online.target
@@ -344,6 +345,7 @@ WorkingDirectory=%s
 Environment=HOME=%s
 Restart=always
 RestartSec=10
+Delegate=yes
 StandardOutput=journal
 StandardError=journal
 
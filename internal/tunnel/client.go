@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"beacon/internal/ipc"
@@ -49,7 +50,7 @@ type Client struct {
 	// Active WebSocket passthrough streams (streamID -> local ws conn)
 	streams sync.Map
 
-	connected bool
+	connected atomic.Bool
 	startedAt time.Time
 }
 
@@ -95,7 +96,7 @@ func (c *Client) Run(ctx context.Context) error {
 		attempt++
 		if attempt > maxReconnects {
 			c.log.Warnf("Max reconnects (%d) exceeded, giving up", maxReconnects)
-			c.connected = false
+			c.connected.Store(false)
 			c.writeHealthOnce()
 			return fmt.Errorf("max reconnects exceeded after error: %v", err)
 		}
@@ -106,7 +107,7 @@ func (c *Client) Run(ctx context.Context) error {
 		}
 		c.log.Infof("Disconnected (%v), reconnecting in %v (attempt %d/%d)",
 			err, backoff, attempt, maxReconnects)
-		c.connected = false
+		c.connected.Store(false)
 		c.writeHealthOnce()
 
 		select {
@@ -134,7 +135,7 @@ func (c *Client) connectAndServe(ctx context.Context) error {
 
 	c.mu.Lock()
 	c.conn = conn
-	c.connected = true
+	c.connected.Store(true)
 	c.mu.Unlock()
 
 	c.log.Infof("Connected to %s", wsURL)
@@ -292,7 +293,7 @@ func (c *Client) closeConn() {
 		_ = c.conn.Close()
 		c.conn = nil
 	}
-	c.connected = false
+	c.connected.Store(false)
 
 	// Close all active WS streams
 	c.streams.Range(func(key, value any) bool {
@@ -320,7 +321,7 @@ func (c *Client) healthLoop(ctx context.Context) {
 
 func (c *Client) writeHealthOnce() {
 	status := ipc.StatusDown
-	if c.connected {
+	if c.connected.Load() {
 		status = ipc.StatusHealthy
 	}
 
@@ -335,7 +336,7 @@ func (c *Client) writeHealthOnce() {
 			"local_port":      c.cfg.Dial.Port,
 			"upstream_host":   c.cfg.Dial.Host,
 			"upstream_scheme": c.cfg.Dial.Protocol,
-			"connected":       c.connected,
+			"connected":       c.connected.Load(),
 		},
 	}
 
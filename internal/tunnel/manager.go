@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 
@@ -40,6 +41,14 @@ type TunnelManager struct {
 type managedTunnel struct {
 	client *Client
 	cfg    identity.TunnelConfig
+	cloud  cloudCredentials
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// cloudCredentials are what a tunnel client uses to reach the cloud.
+type cloudCredentials struct {
+	url, apiKey, deviceName string
 }
 
 // NewTunnelManager creates a new tunnel manager.
@@ -97,22 +106,87 @@ func (tm *TunnelManager) start(t identity.TunnelConfig, cloudURL, apiKey, device
 		IPCDir:     ipcDir,
 	})
 
+	ctx, cancel := context.WithCancel(tm.ctx)
 	mt := &managedTunnel{
 		client: client,
 		cfg:    t,
+		cloud:  cloudCredentials{url: cloudURL, apiKey: apiKey, deviceName: deviceName},
+		cancel: cancel,
+		done:   make(chan struct{}),
 	}
 	tm.tunnels[t.ID] = mt
 
 	tm.wg.Add(1)
 	go func() {
 		defer tm.wg.Done()
+		defer close(mt.done)
 		managerLog.Infof("Starting tunnel %s -> %s://%s:%d", t.ID, proto, host, port)
-		if err := client.Run(tm.ctx); err != nil && tm.ctx.Err() == nil {
+		if err := client.Run(ctx); err != nil && ctx.Err() == nil {
 			managerLog.Warnf("Tunnel %s stopped: %v", t.ID, err)
 		}
 	}()
 }
 
+// Stop stops a running tunnel and waits for it to exit.
+func (tm *TunnelManager) Stop(id string) {
+	tm.mu.Lock()
+	mt, ok := tm.tunnels[id]
+	delete(tm.tunnels, id)
+	tm.mu.Unlock()
+	if !ok {
+		return
+	}
+	managerLog.Infof("Stopping tunnel %s", id)
+	mt.cancel()
+	<-mt.done
+}
+
+// Reconcile makes the running tunnels match the config: tunnels that were removed,
+// disabled or changed (including new cloud credentials) are stopped, and enabled ones
+// are started up to MaxActiveTunnels.
+func (tm *TunnelManager) Reconcile(tunnels []identity.TunnelConfig, cloudURL, apiKey, deviceName string) {
+	creds := cloudCredentials{url: cloudURL, apiKey: apiKey, deviceName: deviceName}
+	want := make(map[string]identity.TunnelConfig, len(tunnels))
+	for _, t := range tunnels {
+		if isTunnelEnabled(t) {
+			want[t.ID] = t
+		}
+	}
+
+	tm.mu.RLock()
+	var stale []string
+	for id, mt := range tm.tunnels {
+		if t, ok := want[id]; !ok || !reflect.DeepEqual(t, mt.cfg) || mt.cloud != creds {
+			stale = append(stale, id)
+		}
+	}
+	tm.mu.RUnlock()
+	for _, id := range stale {
+		tm.Stop(id)
+	}
+	if apiKey == "" {
+		return
+	}
+
+	for _, t := range tunnels {
+		if _, ok := want[t.ID]; !ok {
+			continue
+		}
+		tm.mu.RLock()
+		_, running := tm.tunnels[t.ID]
+		active := len(tm.tunnels)
+		tm.mu.RUnlock()
+		if running {
+			continue
+		}
+		if active >= MaxActiveTunnels {
+			managerLog.Infof("Tunnel %s skipped (limit: %d active tunnels)", t.ID, MaxActiveTunnels)
+			continue
+		}
+		tm.start(t, cloudURL, apiKey, deviceName)
+	}
+}
+
 // GetIPCReaders returns IPC readers for all managed tunnels.
 func (tm *TunnelManager) GetIPCReaders() map[string]*ipc.Reader {
 	tm.mu.RLock()
@@ -134,7 +208,7 @@ func (tm *TunnelManager) GetTunnelStatuses() []TunnelStatus {
 	statuses := make([]TunnelStatus, 0, len(tm.tunnels))
 	for id, mt := range tm.tunnels {
 		status := "reconnecting"
-		if mt.client.connected {
+		if mt.client.connected.Load() {
 			status = "connected"
 		}
 		proto, host, port, _ := mt.cfg.EffectiveUpstream()
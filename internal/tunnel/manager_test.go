@@ -0,0 +1,59 @@
+package tunnel
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"beacon/internal/identity"
+)
+
+func tunnelIDs(tm *TunnelManager) []string {
+	var ids []string
+	for _, s := range tm.GetTunnelStatuses() {
+		ids = append(ids, s.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestTunnelManager_Reconcile(t *testing.T) {
+	t.Setenv("BEACON_HOME", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tm, err := NewTunnelManager(ctx)
+	if err != nil {
+		t.Fatalf("NewTunnelManager failed: %v", err)
+	}
+	defer tm.Shutdown()
+
+	cloud := "http://127.0.0.1:1" // nothing listens; clients keep retrying
+	disabled := false
+	tunnels := []identity.TunnelConfig{
+		{ID: "ha", LocalPort: 8123},
+		{ID: "nc", LocalPort: 8080},
+		{ID: "git", LocalPort: 3000},
+		{ID: "off", LocalPort: 9000, Enabled: &disabled},
+	}
+	tm.Reconcile(tunnels, cloud, "key", "dev")
+	if got := tunnelIDs(tm); !slices.Equal(got, []string{"ha", "nc"}) {
+		t.Fatalf("active tunnels = %v, want [ha nc] (limit %d)", got, MaxActiveTunnels)
+	}
+
+	// Removing one frees a slot; a changed port restarts the tunnel
+	tm.Reconcile([]identity.TunnelConfig{{ID: "nc", LocalPort: 8081}, {ID: "git", LocalPort: 3000}}, cloud, "key", "dev")
+	if got := tunnelIDs(tm); !slices.Equal(got, []string{"git", "nc"}) {
+		t.Fatalf("active tunnels = %v, want [git nc]", got)
+	}
+	for _, s := range tm.GetTunnelStatuses() {
+		if s.ID == "nc" && s.LocalPort != 8081 {
+			t.Errorf("nc port = %d, want 8081", s.LocalPort)
+		}
+	}
+
+	// Without an API key (cloud reporting off) everything stops
+	tm.Reconcile([]identity.TunnelConfig{{ID: "git", LocalPort: 3000}}, cloud, "", "dev")
+	if got := tunnelIDs(tm); len(got) != 0 {
+		t.Errorf("active tunnels = %v, want none", got)
+	}
+}
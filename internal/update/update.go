@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -197,27 +198,50 @@ func DownloadAndReplace(ctx context.Context) error {
 }
 
 func fetchExpectedHash(ctx context.Context, url, assetName string) (string, error) {
+	return FetchExpectedHash(ctx, url, assetName, nil)
+}
+
+// FetchExpectedHash downloads a checksum file in sha256sum format (SHA256SUMS.txt,
+// checksums.txt) and returns the hash listed for assetName. A file holding a single bare hash
+// (<asset>.sha256) is accepted too. header is added to the request (for example
+// Authorization for private releases) and may be nil.
+func FetchExpectedHash(ctx context.Context, url, assetName string, header http.Header) (string, error) {
 	client := &http.Client{Timeout: 15 * time.Second}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return "", err
 	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer func() { _ = resp.Body.Close() }()
-	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checksum file returned HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
 	if err != nil {
 		return "", err
 	}
+	var lines [][]string
 	for _, line := range strings.Split(string(body), "\n") {
-		parts := strings.Fields(line)
-		if len(parts) == 2 && parts[1] == assetName {
-			return parts[0], nil
+		if parts := strings.Fields(line); len(parts) > 0 {
+			lines = append(lines, parts)
+		}
+	}
+	for _, parts := range lines {
+		// "*name" marks binary mode; some tools list paths like "./dist/name"
+		if len(parts) == 2 && path.Base(strings.TrimPrefix(parts[1], "*")) == assetName {
+			return strings.ToLower(parts[0]), nil
 		}
 	}
-	return "", fmt.Errorf("no checksum for %q in SHA256SUMS.txt", assetName)
+	if len(lines) == 1 && len(lines[0]) == 1 && len(lines[0][0]) == sha256.Size*2 {
+		return strings.ToLower(lines[0][0]), nil
+	}
+	return "", fmt.Errorf("no checksum for %q in %s", assetName, path.Base(url))
 }
 
 // isNewerVersion returns true if remote is a higher semver than current.
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Supported providers
+const (
+	ProviderGitHub  = "github"
+	ProviderGitea   = "gitea" // also Forgejo
+	ProviderGitLab  = "gitlab"
+	ProviderUnknown = ""
+)
+
+// Event kinds the receiver acts on
+const (
+	KindPush    = "push"    // commits pushed to a branch
+	KindTag     = "tag"     // tag created
+	KindRelease = "release" // release published
+	KindPing    = "ping"    // provider connectivity test
+	KindOther   = "other"
+)
+
+// Event is the provider-independent form of a webhook delivery.
+type Event struct {
+	Provider string
+	Kind     string
+	Branch   string   // set for KindPush
+	Tag      string   // set for KindTag and KindRelease (when known)
+	Commit   string   // head commit after the push, if known
+	Repos    []string // repository identifiers (full name, clone/ssh/web URLs)
+}
+
+// detectProvider identifies the sender from its event header.
+// Gitea and Forgejo also send X-GitHub-Event for compatibility, so they are checked first.
+func detectProvider(h http.Header) (provider, event string) {
+	switch {
+	case h.Get("X-Forgejo-Event") != "":
+		return ProviderGitea, h.Get("X-Forgejo-Event")
+	case h.Get("X-Gitea-Event") != "":
+		return ProviderGitea, h.Get("X-Gitea-Event")
+	case h.Get("X-Gitlab-Event") != "":
+		return ProviderGitLab, h.Get("X-Gitlab-Event")
+	case h.Get("X-GitHub-Event") != "":
+		return ProviderGitHub, h.Get("X-GitHub-Event")
+	}
+	return ProviderUnknown, ""
+}
+
+// verifySignature checks the delivery against secret using the provider's scheme:
+// GitHub signs the body with HMAC-SHA256 (X-Hub-Signature-256: sha256=<hex>), Gitea/Forgejo
+// send the bare hex HMAC (X-Gitea-Signature / X-Forgejo-Signature), and GitLab echoes the
+// configured secret token (X-Gitlab-Token).
+func verifySignature(provider string, h http.Header, body, secret []byte) error {
+	switch provider {
+	case ProviderGitHub:
+		sig, ok := strings.CutPrefix(h.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			return fmt.Errorf("missing X-Hub-Signature-256 header")
+		}
+		return compareHMAC(sig, body, secret)
+	case ProviderGitea:
+		sig := h.Get("X-Forgejo-Signature")
+		if sig == "" {
+			sig = h.Get("X-Gitea-Signature")
+		}
+		if sig == "" {
+			sig = strings.TrimPrefix(h.Get("X-Hub-Signature-256"), "sha256=")
+		}
+		if sig == "" {
+			return fmt.Errorf("missing X-Gitea-Signature header")
+		}
+		return compareHMAC(sig, body, secret)
+	case ProviderGitLab:
+		token := h.Get("X-Gitlab-Token")
+		if token == "" {
+			return fmt.Errorf("missing X-Gitlab-Token header")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), secret) != 1 {
+			return fmt.Errorf("token mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown provider")
+}
+
+func compareHMAC(sigHex string, body, secret []byte) error {
+	got, err := hex.DecodeString(strings.TrimSpace(sigHex))
+	if err != nil {
+		return fmt.Errorf("malformed signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// payload covers the fields Beacon needs from GitHub, Gitea/Forgejo and GitLab deliveries.
+type payload struct {
+	Ref     string `json:"ref"`
+	RefType string `json:"ref_type"` // GitHub/Gitea "create" event
+	After   string `json:"after"`
+	Action  string `json:"action"`
+
+	// GitHub, Gitea/Forgejo
+	Repository struct {
+		FullName string `json:"full_name"`
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	Release struct {
+		TagName string `json:"tag_name"`
+	} `json:"release"`
+
+	// GitLab
+	ObjectKind string `json:"object_kind"`
+	Project    struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		GitHTTPURL        string `json:"git_http_url"`
+		GitSSHURL         string `json:"git_ssh_url"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	Tag string `json:"tag"` // GitLab release hook
+}
+
+// parseEvent converts a verified delivery into an Event.
+func parseEvent(provider, eventHeader string, body []byte) (Event, error) {
+	ev := Event{Provider: provider, Kind: KindOther}
+	if provider == ProviderGitHub && eventHeader == "ping" {
+		ev.Kind = KindPing
+		return ev, nil
+	}
+
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return ev, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	for _, r := range []string{
+		p.Repository.FullName, p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL,
+		p.Project.PathWithNamespace, p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL,
+	} {
+		if r != "" {
+			ev.Repos = append(ev.Repos, r)
+		}
+	}
+
+	event := strings.ToLower(eventHeader)
+	switch {
+	case event == "push" || event == "push hook" || event == "tag push hook":
+		if tag, ok := strings.CutPrefix(p.Ref, "refs/tags/"); ok {
+			ev.Kind, ev.Tag = KindTag, tag
+		} else if branch, ok := strings.CutPrefix(p.Ref, "refs/heads/"); ok {
+			ev.Kind, ev.Branch = KindPush, branch
+		}
+		if strings.Trim(p.After, "0") != "" {
+			ev.Commit = p.After
+		} else if ev.Kind == KindTag {
+			// All-zero "after" means the tag was deleted
+			ev.Kind = KindOther
+		}
+	case event == "create":
+		if p.RefType == "tag" {
+			ev.Kind, ev.Tag = KindTag, p.Ref
+		}
+	case event == "release" || event == "release hook":
+		ev.Tag = p.Release.TagName
+		if ev.Tag == "" {
+			ev.Tag = p.Tag
+		}
+		// GitHub: published/released; Gitea: published; GitLab: create
+		switch p.Action {
+		case "published", "released", "create", "":
+			ev.Kind = KindRelease
+		}
+	}
+	return ev, nil
+}
@@ -0,0 +1,184 @@
+// Package webhook receives signed push, tag and release webhooks from GitHub, Gitea/Forgejo
+// and GitLab and turns them into deploy triggers for the `beacon deploy` agent. The master's
+// project agents have no poll loop to wake and do not mount it.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"beacon/internal/logging"
+)
+
+// Path is where the deploy agent serves the receiver.
+const Path = "/webhook"
+
+// maxBodySize matches the tunnel's body limit; provider payloads are far smaller.
+const maxBodySize = 10 << 20
+
+var logger = logging.New("webhook")
+
+// Config configures a Receiver.
+type Config struct {
+	// Secret is the shared webhook secret (HMAC key for GitHub/Gitea, token for GitLab).
+	Secret string
+	// Repositories lists the repositories this project deploys from: the project's repo URL
+	// plus any mirrors. Deliveries for other repositories are ignored.
+	Repositories []string
+	// Branch is the branch whose pushes trigger a deploy (deploy policy track: branch).
+	// When empty only tag and release events trigger.
+	Branch string
+}
+
+// Receiver is an http.Handler that verifies webhook deliveries and calls notify for the
+// ones that should trigger a deploy check.
+type Receiver struct {
+	secret []byte
+	repos  []string
+	branch string
+	notify func(Event)
+}
+
+// NewReceiver creates a receiver. A secret is required: unsigned deliveries are never accepted.
+func NewReceiver(cfg Config, notify func(Event)) (*Receiver, error) {
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf("webhook secret is required")
+	}
+	r := &Receiver{secret: []byte(cfg.Secret), branch: cfg.Branch, notify: notify}
+	for _, repo := range cfg.Repositories {
+		if n := NormalizeRepo(repo); n != "" {
+			r.repos = append(r.repos, n)
+		}
+	}
+	return r, nil
+}
+
+type response struct {
+	Status string `json:"status"` // "queued", "ignored", "pong"
+	Reason string `json:"reason,omitempty"`
+}
+
+// ServeHTTP handles one webhook delivery.
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxBodySize {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	provider, eventHeader := detectProvider(r.Header)
+	if provider == ProviderUnknown {
+		http.Error(w, "unknown webhook provider", http.StatusBadRequest)
+		return
+	}
+	if err := verifySignature(provider, r.Header, body, rc.secret); err != nil {
+		logger.Infof("Rejected %s webhook: %v", provider, err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	ev, err := parseEvent(provider, eventHeader, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ev.Kind == KindPing {
+		writeJSON(w, http.StatusOK, response{Status: "pong"})
+		return
+	}
+
+	if reason := rc.ignoreReason(ev); reason != "" {
+		logger.Infof("Ignored %s %q webhook: %s", provider, eventHeader, reason)
+		writeJSON(w, http.StatusOK, response{Status: "ignored", Reason: reason})
+		return
+	}
+
+	logger.Infof("Accepted %s %s webhook (tag=%q branch=%q)", provider, ev.Kind, ev.Tag, ev.Branch)
+	if rc.notify != nil {
+		rc.notify(ev)
+	}
+	writeJSON(w, http.StatusAccepted, response{Status: "queued"})
+}
+
+// ignoreReason returns why ev should not trigger a deploy, or "" if it should.
+func (rc *Receiver) ignoreReason(ev Event) string {
+	if !rc.matchesRepo(ev.Repos) {
+		return "repository does not belong to this project"
+	}
+	switch ev.Kind {
+	case KindTag, KindRelease:
+		return ""
+	case KindPush:
+		if rc.branch == "" {
+			return "branch pushes are ignored (deploy policy does not track a branch)"
+		}
+		if ev.Branch != rc.branch {
+			return fmt.Sprintf("push to %s, tracking %s", ev.Branch, rc.branch)
+		}
+		return ""
+	}
+	return "event does not trigger deploys"
+}
+
+// matchesRepo reports whether any identifier from the delivery names a configured repository.
+// Bare paths such as "owner/repo" (GitHub full_name) match on the path suffix.
+func (rc *Receiver) matchesRepo(identifiers []string) bool {
+	for _, id := range identifiers {
+		n := NormalizeRepo(id)
+		if n == "" {
+			continue
+		}
+		for _, repo := range rc.repos {
+			if n == repo || (!hasHost(n) && strings.HasSuffix(repo, "/"+n)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeRepo reduces HTTPS, SSH and scp-style repository URLs to "host/owner/repo" (lowercase,
+// without credentials, port or .git suffix) so that clone, SSH and web URLs compare equal.
+func NormalizeRepo(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	} else if at := strings.Index(s, "@"); at >= 0 && strings.Contains(s[at:], ":") {
+		// scp-like: git@host:owner/repo
+		s = strings.Replace(s[at+1:], ":", "/", 1)
+	}
+	if at := strings.LastIndex(s, "@"); at >= 0 {
+		s = s[at+1:]
+	}
+	if host, path, found := strings.Cut(s, "/"); found {
+		host, _, _ = strings.Cut(host, ":") // drop port
+		s = host + "/" + path
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+	return s
+}
+
+// hasHost reports whether a normalized identifier starts with a host name.
+func hasHost(n string) bool {
+	host, _, _ := strings.Cut(n, "/")
+	return strings.Contains(host, ".") || host == "localhost"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSecret = "s3cret"
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newTestReceiver(t *testing.T, branch string) (*Receiver, *[]Event) {
+	t.Helper()
+	var got []Event
+	r, err := NewReceiver(Config{
+		Secret:       testSecret,
+		Repositories: []string{"git@github.com:acme/app.git"},
+		Branch:       branch,
+	}, func(ev Event) { got = append(got, ev) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, &got
+}
+
+func deliver(r http.Handler, headers map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+const githubTagPush = `{"ref":"refs/tags/v1.2.0","after":"abc123","repository":{"full_name":"acme/app","clone_url":"https://github.com/acme/app.git"}}`
+
+func TestReceiver_GitHubTagPush(t *testing.T) {
+	r, got := newTestReceiver(t, "")
+	rec := deliver(r, map[string]string{
+		"X-GitHub-Event":      "push",
+		"X-Hub-Signature-256": "sha256=" + sign(githubTagPush),
+	}, githubTagPush)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if len(*got) != 1 || (*got)[0].Kind != KindTag || (*got)[0].Tag != "v1.2.0" || (*got)[0].Commit != "abc123" {
+		t.Errorf("events = %+v", *got)
+	}
+}
+
+func TestReceiver_RejectsBadSignature(t *testing.T) {
+	r, got := newTestReceiver(t, "")
+	for name, headers := range map[string]map[string]string{
+		"wrong":   {"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign("other body")},
+		"missing": {"X-GitHub-Event": "push"},
+		"gitlab":  {"X-Gitlab-Event": "Tag Push Hook", "X-Gitlab-Token": "nope"},
+	} {
+		if rec := deliver(r, headers, githubTagPush); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", name, rec.Code)
+		}
+	}
+	if len(*got) != 0 {
+		t.Errorf("unexpected events: %+v", *got)
+	}
+}
+
+func TestReceiver_GiteaAndGitLab(t *testing.T) {
+	r, got := newTestReceiver(t, "")
+
+	gitea := `{"ref":"v2.0.0","ref_type":"tag","repository":{"ssh_url":"git@github.com:acme/app.git"}}`
+	rec := deliver(r, map[string]string{
+		"X-Gitea-Event":     "create",
+		"X-GitHub-Event":    "create",
+		"X-Gitea-Signature": sign(gitea),
+	}, gitea)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("gitea: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	gitlab := `{"object_kind":"release","action":"create","tag":"v3.0.0","project":{"git_http_url":"https://GitHub.com/acme/app"}}`
+	rec = deliver(r, map[string]string{
+		"X-Gitlab-Event": "Release Hook",
+		"X-Gitlab-Token": testSecret,
+	}, gitlab)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("gitlab: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	if len(*got) != 2 || (*got)[0].Provider != ProviderGitea || (*got)[0].Tag != "v2.0.0" ||
+		(*got)[1].Kind != KindRelease || (*got)[1].Tag != "v3.0.0" {
+		t.Errorf("events = %+v", *got)
+	}
+}
+
+func TestReceiver_Ignored(t *testing.T) {
+	branchPush := `{"ref":"refs/heads/main","after":"def456","repository":{"full_name":"acme/app"}}`
+	otherRepo := `{"ref":"refs/tags/v1.0.0","after":"abc","repository":{"full_name":"acme/other"}}`
+	deletedTag := `{"ref":"refs/tags/v1.0.0","after":"0000000000000000000000000000000000000000","repository":{"full_name":"acme/app"}}`
+
+	r, got := newTestReceiver(t, "")
+	for name, body := range map[string]string{"branch push": branchPush, "other repo": otherRepo, "deleted tag": deletedTag} {
+		rec := deliver(r, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(body)}, body)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ignored"`) {
+			t.Errorf("%s: status = %d, body %s", name, rec.Code, rec.Body)
+		}
+	}
+	if len(*got) != 0 {
+		t.Errorf("unexpected events: %+v", *got)
+	}
+
+	// Tracking main: the same branch push triggers
+	r, got = newTestReceiver(t, "main")
+	rec := deliver(r, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(branchPush)}, branchPush)
+	if rec.Code != http.StatusAccepted || len(*got) != 1 || (*got)[0].Branch != "main" {
+		t.Errorf("tracked branch push: status = %d, events = %+v", rec.Code, *got)
+	}
+}
+
+func TestReceiver_PingAndMethod(t *testing.T) {
+	r, _ := newTestReceiver(t, "")
+	rec := deliver(r, map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign("{}")}, "{}")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "pong") {
+		t.Errorf("ping: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, Path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want 405", w.Code)
+	}
+}
+
+func TestNormalizeRepo(t *testing.T) {
+	want := "github.com/acme/app"
+	for _, in := range []string{
+		"https://github.com/acme/app.git",
+		"https://token@github.com/Acme/App",
+		"git@github.com:acme/app.git",
+		"ssh://git@github.com:22/acme/app.git",
+		"github.com/acme/app/",
+	} {
+		if got := NormalizeRepo(in); got != want {
+			t.Errorf("NormalizeRepo(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := NormalizeRepo("acme/app"); got != "acme/app" {
+		t.Errorf("NormalizeRepo(full name) = %q", got)
+	}
+}